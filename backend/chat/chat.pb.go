@@ -22,9 +22,67 @@ const (
 )
 
 type ChatMessage struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	Role          string                 `protobuf:"bytes,1,opt,name=role,proto3" json:"role,omitempty"`
-	Content       string                 `protobuf:"bytes,2,opt,name=content,proto3" json:"content,omitempty"`
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	Role    string                 `protobuf:"bytes,1,opt,name=role,proto3" json:"role,omitempty"`
+	Content string                 `protobuf:"bytes,2,opt,name=content,proto3" json:"content,omitempty"`
+	// 消息类型, 空表示普通对话消息; session 表示服务端下发的会话信息; artifact 表示工具生成的附件;
+	// transcript 表示语音识别结果; summary 表示一轮对话结束后的耗时和费用统计;
+	// tool_result 表示工具返回的 JSON 结果, 供前端渲染表格; status 表示对话进行到哪一步, 见 status 字段;
+	// choice 表示 N-best 模式下的一个候选回答; pick 由客户端发送, 表示选定第 choice 个候选
+	// ack 由客户端发送, 确认已收到 seq 不大于 ack 的消息
+	// warning 表示本轮对话的提醒, 比如有 MCP 服务获取工具失败, 回答可能不完整;
+	// 连接时没有任何可用的 MCP 服务则在 session 之后下发 status 为 llm_only 的 warning
+	// rejected 表示连接被拒绝, status 为原因 (server_full | user_limit | ip_limit | unsupported_protocol), 随后服务端关闭连接
+	// debug 表示本轮各阶段的耗时 (见 timing), 只发给连接时带上 debug=1 的会话;
+	// status 为 context 的 debug 是一次发给大模型的完整请求 (脱敏后的 JSON, 在 content 中), 只发给带上 debug_context=1 的管理员连接
+	// hello 是连接后服务端下发的第一条消息, 见 hello 字段; 连接时用 ?protocol= 声明客户端使用的协议版本,
+	// 服务端不再支持该版本时随后下发 status 为 unsupported_protocol 的 rejected 并关闭连接
+	// approval_request 表示配置了 requireApproval 的工具调用等待用户批准, 见 approval 字段;
+	// approval 由客户端发送, 批准或拒绝 approval.id 对应的调用
+	// elicitation_request 表示 MCP 服务在工具调用中途向用户索取信息, 见 elicitation 字段;
+	// elicitation 由客户端发送, 回复 elicitation.id 对应的请求, 工具调用随后继续
+	Type      string    `protobuf:"bytes,3,opt,name=type,proto3" json:"type,omitempty"`
+	SessionId string    `protobuf:"bytes,4,opt,name=session_id,json=sessionId,proto3" json:"session_id,omitempty"`
+	Artifact  *Artifact `protobuf:"bytes,5,opt,name=artifact,proto3" json:"artifact,omitempty"`
+	// 客户端发送语音时填写, content 留空; audio_format 为音频文件扩展名, 比如 webm
+	Audio       []byte       `protobuf:"bytes,6,opt,name=audio,proto3" json:"audio,omitempty"`
+	AudioFormat string       `protobuf:"bytes,7,opt,name=audio_format,json=audioFormat,proto3" json:"audio_format,omitempty"`
+	Summary     *TurnSummary `protobuf:"bytes,8,opt,name=summary,proto3" json:"summary,omitempty"`
+	// 客户端希望得到的候选回答个数, 大于 1 时服务端以 choice 消息返回各个候选, 用户选定之前不写入历史
+	Candidates int32 `protobuf:"varint,9,opt,name=candidates,proto3" json:"candidates,omitempty"`
+	// choice 和 pick 消息中候选回答的序号, 从 0 开始
+	Choice int32 `protobuf:"varint,10,opt,name=choice,proto3" json:"choice,omitempty"`
+	// 连接时带上 ack=1 后服务端下发的消息按会话编号, 客户端据此去重并回复 ack
+	Seq int64 `protobuf:"varint,11,opt,name=seq,proto3" json:"seq,omitempty"`
+	Ack int64 `protobuf:"varint,12,opt,name=ack,proto3" json:"ack,omitempty"`
+	// 连接时带上 gzip=1 且 content 超过配置的阈值时, 服务端把 content 用 gzip 压缩后放在这里, content 留空
+	ContentGzip []byte `protobuf:"bytes,13,opt,name=content_gzip,json=contentGzip,proto3" json:"content_gzip,omitempty"`
+	// 本轮对话的 trace id, 服务端日志中以 trace=<id> 记录, 反馈问题时提供
+	TraceId    string      `protobuf:"bytes,14,opt,name=trace_id,json=traceId,proto3" json:"trace_id,omitempty"`
+	ToolResult *ToolResult `protobuf:"bytes,15,opt,name=tool_result,json=toolResult,proto3" json:"tool_result,omitempty"`
+	// status 消息的状态: thinking | calling_tool | tool_budget | condensing | summarizing | verifying | translating | cached, content 为对应的提示文字;
+	// rejected 消息中为拒绝连接的原因; warning 消息中为 llm_only 或空
+	Status string `protobuf:"bytes,16,opt,name=status,proto3" json:"status,omitempty"`
+	// session 消息中为 true 表示这是旁观连接 (watch=1), 只接收会话的消息, 不能发送
+	Spectator bool `protobuf:"varint,17,opt,name=spectator,proto3" json:"spectator,omitempty"`
+	// 多人会话中发送这条用户消息的用户, 其他参与者据此显示发送者
+	Sender string `protobuf:"bytes,18,opt,name=sender,proto3" json:"sender,omitempty"`
+	// 客户端按名字使用保存的提示词模板时填写, content 留空; variables 为模板变量的值。
+	// 服务端把替换后的文本作为用户消息发回, 客户端据此显示
+	Prompt    string            `protobuf:"bytes,19,opt,name=prompt,proto3" json:"prompt,omitempty"`
+	Variables map[string]string `protobuf:"bytes,20,rep,name=variables,proto3" json:"variables,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	// 回答消息中为 true 表示回答来自语义缓存 (最近回答过相似的问题), 没有调用大模型
+	Cached bool `protobuf:"varint,21,opt,name=cached,proto3" json:"cached,omitempty"`
+	// debug 消息中为本轮各阶段的耗时, 连接时带上 debug=1 的会话才下发
+	Timing *TurnTiming `protobuf:"bytes,22,opt,name=timing,proto3" json:"timing,omitempty"`
+	// 配置了 verification 时回答消息中为核对的结论, 回答和工具结果一致时不填
+	Verification *Verification `protobuf:"bytes,23,opt,name=verification,proto3" json:"verification,omitempty"`
+	// hello 消息中为服务端的版本和协商的协议版本
+	Hello *Hello `protobuf:"bytes,24,opt,name=hello,proto3" json:"hello,omitempty"`
+	// approval_request 和 approval 消息中为等待批准的工具调用
+	Approval *Approval `protobuf:"bytes,25,opt,name=approval,proto3" json:"approval,omitempty"`
+	// elicitation_request 和 elicitation 消息中为 MCP 服务索取的信息
+	Elicitation   *Elicitation `protobuf:"bytes,26,opt,name=elicitation,proto3" json:"elicitation,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -73,14 +131,984 @@ func (x *ChatMessage) GetContent() string {
 	return ""
 }
 
-var File_chat_chat_proto protoreflect.FileDescriptor
+func (x *ChatMessage) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
 
-const file_chat_chat_proto_rawDesc = "" +
-	"\n" +
-	"\x0fchat/chat.proto\x12\x04chat\";\n" +
-	"\vChatMessage\x12\x12\n" +
-	"\x04role\x18\x01 \x01(\tR\x04role\x12\x18\n" +
-	"\acontent\x18\x02 \x01(\tR\acontentB(Z&github.com/guobinqiu/mcp-host-web/chatb\x06proto3"
+func (x *ChatMessage) GetSessionId() string {
+	if x != nil {
+		return x.SessionId
+	}
+	return ""
+}
+
+func (x *ChatMessage) GetArtifact() *Artifact {
+	if x != nil {
+		return x.Artifact
+	}
+	return nil
+}
+
+func (x *ChatMessage) GetAudio() []byte {
+	if x != nil {
+		return x.Audio
+	}
+	return nil
+}
+
+func (x *ChatMessage) GetAudioFormat() string {
+	if x != nil {
+		return x.AudioFormat
+	}
+	return ""
+}
+
+func (x *ChatMessage) GetSummary() *TurnSummary {
+	if x != nil {
+		return x.Summary
+	}
+	return nil
+}
+
+func (x *ChatMessage) GetCandidates() int32 {
+	if x != nil {
+		return x.Candidates
+	}
+	return 0
+}
+
+func (x *ChatMessage) GetChoice() int32 {
+	if x != nil {
+		return x.Choice
+	}
+	return 0
+}
+
+func (x *ChatMessage) GetSeq() int64 {
+	if x != nil {
+		return x.Seq
+	}
+	return 0
+}
+
+func (x *ChatMessage) GetAck() int64 {
+	if x != nil {
+		return x.Ack
+	}
+	return 0
+}
+
+func (x *ChatMessage) GetContentGzip() []byte {
+	if x != nil {
+		return x.ContentGzip
+	}
+	return nil
+}
+
+func (x *ChatMessage) GetTraceId() string {
+	if x != nil {
+		return x.TraceId
+	}
+	return ""
+}
+
+func (x *ChatMessage) GetToolResult() *ToolResult {
+	if x != nil {
+		return x.ToolResult
+	}
+	return nil
+}
+
+func (x *ChatMessage) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+func (x *ChatMessage) GetSpectator() bool {
+	if x != nil {
+		return x.Spectator
+	}
+	return false
+}
+
+func (x *ChatMessage) GetSender() string {
+	if x != nil {
+		return x.Sender
+	}
+	return ""
+}
+
+func (x *ChatMessage) GetPrompt() string {
+	if x != nil {
+		return x.Prompt
+	}
+	return ""
+}
+
+func (x *ChatMessage) GetVariables() map[string]string {
+	if x != nil {
+		return x.Variables
+	}
+	return nil
+}
+
+func (x *ChatMessage) GetCached() bool {
+	if x != nil {
+		return x.Cached
+	}
+	return false
+}
+
+func (x *ChatMessage) GetTiming() *TurnTiming {
+	if x != nil {
+		return x.Timing
+	}
+	return nil
+}
+
+func (x *ChatMessage) GetVerification() *Verification {
+	if x != nil {
+		return x.Verification
+	}
+	return nil
+}
+
+func (x *ChatMessage) GetHello() *Hello {
+	if x != nil {
+		return x.Hello
+	}
+	return nil
+}
+
+func (x *ChatMessage) GetApproval() *Approval {
+	if x != nil {
+		return x.Approval
+	}
+	return nil
+}
+
+func (x *ChatMessage) GetElicitation() *Elicitation {
+	if x != nil {
+		return x.Elicitation
+	}
+	return nil
+}
+
+// protocol_version 为本次连接使用的协议版本: 客户端没有声明或声明的版本比服务端新时为服务端的当前版本,
+// 客户端据此决定是否继续; supported_protocols 为服务端支持的全部协议版本
+type Hello struct {
+	state              protoimpl.MessageState `protogen:"open.v1"`
+	ServerVersion      string                 `protobuf:"bytes,1,opt,name=server_version,json=serverVersion,proto3" json:"server_version,omitempty"`
+	ProtocolVersion    int32                  `protobuf:"varint,2,opt,name=protocol_version,json=protocolVersion,proto3" json:"protocol_version,omitempty"`
+	SupportedProtocols []int32                `protobuf:"varint,3,rep,packed,name=supported_protocols,json=supportedProtocols,proto3" json:"supported_protocols,omitempty"`
+	unknownFields      protoimpl.UnknownFields
+	sizeCache          protoimpl.SizeCache
+}
+
+func (x *Hello) Reset() {
+	*x = Hello{}
+	mi := &file_chat_chat_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Hello) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Hello) ProtoMessage() {}
+
+func (x *Hello) ProtoReflect() protoreflect.Message {
+	mi := &file_chat_chat_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Hello.ProtoReflect.Descriptor instead.
+func (*Hello) Descriptor() ([]byte, []int) {
+	return file_chat_chat_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Hello) GetServerVersion() string {
+	if x != nil {
+		return x.ServerVersion
+	}
+	return ""
+}
+
+func (x *Hello) GetProtocolVersion() int32 {
+	if x != nil {
+		return x.ProtocolVersion
+	}
+	return 0
+}
+
+func (x *Hello) GetSupportedProtocols() []int32 {
+	if x != nil {
+		return x.SupportedProtocols
+	}
+	return nil
+}
+
+// verdict 为 fixed (回答和工具结果矛盾, 已改正) | low_confidence (无法确定回答是否正确);
+// note 为核对模型给出的说明
+type Verification struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Verdict       string                 `protobuf:"bytes,1,opt,name=verdict,proto3" json:"verdict,omitempty"`
+	Note          string                 `protobuf:"bytes,2,opt,name=note,proto3" json:"note,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Verification) Reset() {
+	*x = Verification{}
+	mi := &file_chat_chat_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Verification) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Verification) ProtoMessage() {}
+
+func (x *Verification) ProtoReflect() protoreflect.Message {
+	mi := &file_chat_chat_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Verification.ProtoReflect.Descriptor instead.
+func (*Verification) Descriptor() ([]byte, []int) {
+	return file_chat_chat_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *Verification) GetVerdict() string {
+	if x != nil {
+		return x.Verdict
+	}
+	return ""
+}
+
+func (x *Verification) GetNote() string {
+	if x != nil {
+		return x.Note
+	}
+	return ""
+}
+
+// 一轮对话各阶段的耗时, 用于排查慢的轮次
+type TurnTiming struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	TotalMs       int64                  `protobuf:"varint,1,opt,name=total_ms,json=totalMs,proto3" json:"total_ms,omitempty"`
+	Phases        []*TimingPhase         `protobuf:"bytes,2,rep,name=phases,proto3" json:"phases,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *TurnTiming) Reset() {
+	*x = TurnTiming{}
+	mi := &file_chat_chat_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TurnTiming) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TurnTiming) ProtoMessage() {}
+
+func (x *TurnTiming) ProtoReflect() protoreflect.Message {
+	mi := &file_chat_chat_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TurnTiming.ProtoReflect.Descriptor instead.
+func (*TurnTiming) Descriptor() ([]byte, []int) {
+	return file_chat_chat_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *TurnTiming) GetTotalMs() int64 {
+	if x != nil {
+		return x.TotalMs
+	}
+	return 0
+}
+
+func (x *TurnTiming) GetPhases() []*TimingPhase {
+	if x != nil {
+		return x.Phases
+	}
+	return nil
+}
+
+// phase 为 discovery (获取工具) | llm (一次大模型调用, name 为模型) | tool (一次工具调用, name 为工具) |
+// serialize (本轮推送给客户端的消息的编码和发送, 合计为一项, name 为消息数);
+// start_ms 为相对本轮开始的时间
+type TimingPhase struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Phase         string                 `protobuf:"bytes,1,opt,name=phase,proto3" json:"phase,omitempty"`
+	Name          string                 `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	StartMs       int64                  `protobuf:"varint,3,opt,name=start_ms,json=startMs,proto3" json:"start_ms,omitempty"`
+	DurationMs    int64                  `protobuf:"varint,4,opt,name=duration_ms,json=durationMs,proto3" json:"duration_ms,omitempty"`
+	Error         bool                   `protobuf:"varint,5,opt,name=error,proto3" json:"error,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *TimingPhase) Reset() {
+	*x = TimingPhase{}
+	mi := &file_chat_chat_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TimingPhase) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TimingPhase) ProtoMessage() {}
+
+func (x *TimingPhase) ProtoReflect() protoreflect.Message {
+	mi := &file_chat_chat_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TimingPhase.ProtoReflect.Descriptor instead.
+func (*TimingPhase) Descriptor() ([]byte, []int) {
+	return file_chat_chat_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *TimingPhase) GetPhase() string {
+	if x != nil {
+		return x.Phase
+	}
+	return ""
+}
+
+func (x *TimingPhase) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *TimingPhase) GetStartMs() int64 {
+	if x != nil {
+		return x.StartMs
+	}
+	return 0
+}
+
+func (x *TimingPhase) GetDurationMs() int64 {
+	if x != nil {
+		return x.DurationMs
+	}
+	return 0
+}
+
+func (x *TimingPhase) GetError() bool {
+	if x != nil {
+		return x.Error
+	}
+	return false
+}
+
+// approval_request 中服务端填写 id、server、tool 和 arguments (调用参数的 JSON 文本);
+// 客户端回复 approval 时填写 id 和 approved, 超过本轮对话的超时没有回复视为拒绝
+type Approval struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Server        string                 `protobuf:"bytes,2,opt,name=server,proto3" json:"server,omitempty"`
+	Tool          string                 `protobuf:"bytes,3,opt,name=tool,proto3" json:"tool,omitempty"`
+	Arguments     string                 `protobuf:"bytes,4,opt,name=arguments,proto3" json:"arguments,omitempty"`
+	Approved      bool                   `protobuf:"varint,5,opt,name=approved,proto3" json:"approved,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Approval) Reset() {
+	*x = Approval{}
+	mi := &file_chat_chat_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Approval) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Approval) ProtoMessage() {}
+
+func (x *Approval) ProtoReflect() protoreflect.Message {
+	mi := &file_chat_chat_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Approval.ProtoReflect.Descriptor instead.
+func (*Approval) Descriptor() ([]byte, []int) {
+	return file_chat_chat_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *Approval) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Approval) GetServer() string {
+	if x != nil {
+		return x.Server
+	}
+	return ""
+}
+
+func (x *Approval) GetTool() string {
+	if x != nil {
+		return x.Tool
+	}
+	return ""
+}
+
+func (x *Approval) GetArguments() string {
+	if x != nil {
+		return x.Arguments
+	}
+	return ""
+}
+
+func (x *Approval) GetApproved() bool {
+	if x != nil {
+		return x.Approved
+	}
+	return false
+}
+
+// elicitation_request 中服务端填写 id、server、message (服务的说明) 和 schema (要求的回答格式, JSON Schema 文本,
+// 只含一层基本类型的属性); 客户端回复 elicitation 时填写 id、action (accept | decline | cancel) 和 content
+// (accept 时为符合 schema 的 JSON 对象文本), 没有回复时工具调用在超时后失败; 回复不符合 schema 时服务端下发
+// 带 elicitation.id 的 error, 请求仍在等待, 客户端改正后重新回复
+type Elicitation struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Server        string                 `protobuf:"bytes,2,opt,name=server,proto3" json:"server,omitempty"`
+	Message       string                 `protobuf:"bytes,3,opt,name=message,proto3" json:"message,omitempty"`
+	Schema        string                 `protobuf:"bytes,4,opt,name=schema,proto3" json:"schema,omitempty"`
+	Action        string                 `protobuf:"bytes,5,opt,name=action,proto3" json:"action,omitempty"`
+	Content       string                 `protobuf:"bytes,6,opt,name=content,proto3" json:"content,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Elicitation) Reset() {
+	*x = Elicitation{}
+	mi := &file_chat_chat_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Elicitation) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Elicitation) ProtoMessage() {}
+
+func (x *Elicitation) ProtoReflect() protoreflect.Message {
+	mi := &file_chat_chat_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Elicitation.ProtoReflect.Descriptor instead.
+func (*Elicitation) Descriptor() ([]byte, []int) {
+	return file_chat_chat_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *Elicitation) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Elicitation) GetServer() string {
+	if x != nil {
+		return x.Server
+	}
+	return ""
+}
+
+func (x *Elicitation) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+func (x *Elicitation) GetSchema() string {
+	if x != nil {
+		return x.Schema
+	}
+	return ""
+}
+
+func (x *Elicitation) GetAction() string {
+	if x != nil {
+		return x.Action
+	}
+	return ""
+}
+
+func (x *Elicitation) GetContent() string {
+	if x != nil {
+		return x.Content
+	}
+	return ""
+}
+
+// 工具返回的 JSON 结果, json 为原始 JSON 文本
+type ToolResult struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Json          string                 `protobuf:"bytes,2,opt,name=json,proto3" json:"json,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ToolResult) Reset() {
+	*x = ToolResult{}
+	mi := &file_chat_chat_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ToolResult) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ToolResult) ProtoMessage() {}
+
+func (x *ToolResult) ProtoReflect() protoreflect.Message {
+	mi := &file_chat_chat_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ToolResult.ProtoReflect.Descriptor instead.
+func (*ToolResult) Descriptor() ([]byte, []int) {
+	return file_chat_chat_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *ToolResult) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *ToolResult) GetJson() string {
+	if x != nil {
+		return x.Json
+	}
+	return ""
+}
+
+// 一轮对话的耗时、token 用量和估算费用
+type TurnSummary struct {
+	state            protoimpl.MessageState `protogen:"open.v1"`
+	TotalMs          int64                  `protobuf:"varint,1,opt,name=total_ms,json=totalMs,proto3" json:"total_ms,omitempty"`
+	LlmMs            int64                  `protobuf:"varint,2,opt,name=llm_ms,json=llmMs,proto3" json:"llm_ms,omitempty"`
+	Tools            []*ToolLatency         `protobuf:"bytes,3,rep,name=tools,proto3" json:"tools,omitempty"`
+	PromptTokens     int64                  `protobuf:"varint,4,opt,name=prompt_tokens,json=promptTokens,proto3" json:"prompt_tokens,omitempty"`
+	CompletionTokens int64                  `protobuf:"varint,5,opt,name=completion_tokens,json=completionTokens,proto3" json:"completion_tokens,omitempty"`
+	TotalTokens      int64                  `protobuf:"varint,6,opt,name=total_tokens,json=totalTokens,proto3" json:"total_tokens,omitempty"`
+	// 按配置中的 pricing 估算, 未配置价格的模型不计入
+	Cost   float64  `protobuf:"fixed64,7,opt,name=cost,proto3" json:"cost,omitempty"`
+	Models []string `protobuf:"bytes,8,rep,name=models,proto3" json:"models,omitempty"`
+	// 本轮使用了缓存的回答
+	Cached        bool `protobuf:"varint,9,opt,name=cached,proto3" json:"cached,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *TurnSummary) Reset() {
+	*x = TurnSummary{}
+	mi := &file_chat_chat_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TurnSummary) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TurnSummary) ProtoMessage() {}
+
+func (x *TurnSummary) ProtoReflect() protoreflect.Message {
+	mi := &file_chat_chat_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TurnSummary.ProtoReflect.Descriptor instead.
+func (*TurnSummary) Descriptor() ([]byte, []int) {
+	return file_chat_chat_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *TurnSummary) GetTotalMs() int64 {
+	if x != nil {
+		return x.TotalMs
+	}
+	return 0
+}
+
+func (x *TurnSummary) GetLlmMs() int64 {
+	if x != nil {
+		return x.LlmMs
+	}
+	return 0
+}
+
+func (x *TurnSummary) GetTools() []*ToolLatency {
+	if x != nil {
+		return x.Tools
+	}
+	return nil
+}
+
+func (x *TurnSummary) GetPromptTokens() int64 {
+	if x != nil {
+		return x.PromptTokens
+	}
+	return 0
+}
+
+func (x *TurnSummary) GetCompletionTokens() int64 {
+	if x != nil {
+		return x.CompletionTokens
+	}
+	return 0
+}
+
+func (x *TurnSummary) GetTotalTokens() int64 {
+	if x != nil {
+		return x.TotalTokens
+	}
+	return 0
+}
+
+func (x *TurnSummary) GetCost() float64 {
+	if x != nil {
+		return x.Cost
+	}
+	return 0
+}
+
+func (x *TurnSummary) GetModels() []string {
+	if x != nil {
+		return x.Models
+	}
+	return nil
+}
+
+func (x *TurnSummary) GetCached() bool {
+	if x != nil {
+		return x.Cached
+	}
+	return false
+}
+
+type ToolLatency struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Ms            int64                  `protobuf:"varint,2,opt,name=ms,proto3" json:"ms,omitempty"`
+	Error         bool                   `protobuf:"varint,3,opt,name=error,proto3" json:"error,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ToolLatency) Reset() {
+	*x = ToolLatency{}
+	mi := &file_chat_chat_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ToolLatency) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ToolLatency) ProtoMessage() {}
+
+func (x *ToolLatency) ProtoReflect() protoreflect.Message {
+	mi := &file_chat_chat_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ToolLatency.ProtoReflect.Descriptor instead.
+func (*ToolLatency) Descriptor() ([]byte, []int) {
+	return file_chat_chat_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *ToolLatency) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *ToolLatency) GetMs() int64 {
+	if x != nil {
+		return x.Ms
+	}
+	return 0
+}
+
+func (x *ToolLatency) GetError() bool {
+	if x != nil {
+		return x.Error
+	}
+	return false
+}
+
+// 工具生成的文件, 通过 url 下载
+type Artifact struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Name          string                 `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	MimeType      string                 `protobuf:"bytes,3,opt,name=mime_type,json=mimeType,proto3" json:"mime_type,omitempty"`
+	Size          int64                  `protobuf:"varint,4,opt,name=size,proto3" json:"size,omitempty"`
+	Url           string                 `protobuf:"bytes,5,opt,name=url,proto3" json:"url,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Artifact) Reset() {
+	*x = Artifact{}
+	mi := &file_chat_chat_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Artifact) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Artifact) ProtoMessage() {}
+
+func (x *Artifact) ProtoReflect() protoreflect.Message {
+	mi := &file_chat_chat_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Artifact.ProtoReflect.Descriptor instead.
+func (*Artifact) Descriptor() ([]byte, []int) {
+	return file_chat_chat_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *Artifact) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Artifact) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Artifact) GetMimeType() string {
+	if x != nil {
+		return x.MimeType
+	}
+	return ""
+}
+
+func (x *Artifact) GetSize() int64 {
+	if x != nil {
+		return x.Size
+	}
+	return 0
+}
+
+func (x *Artifact) GetUrl() string {
+	if x != nil {
+		return x.Url
+	}
+	return ""
+}
+
+var File_chat_chat_proto protoreflect.FileDescriptor
+
+const file_chat_chat_proto_rawDesc = "" +
+	"\n" +
+	"\x0fchat/chat.proto\x12\x04chat\"\xaf\a\n" +
+	"\vChatMessage\x12\x12\n" +
+	"\x04role\x18\x01 \x01(\tR\x04role\x12\x18\n" +
+	"\acontent\x18\x02 \x01(\tR\acontent\x12\x12\n" +
+	"\x04type\x18\x03 \x01(\tR\x04type\x12\x1d\n" +
+	"\n" +
+	"session_id\x18\x04 \x01(\tR\tsessionId\x12*\n" +
+	"\bartifact\x18\x05 \x01(\v2\x0e.chat.ArtifactR\bartifact\x12\x14\n" +
+	"\x05audio\x18\x06 \x01(\fR\x05audio\x12!\n" +
+	"\faudio_format\x18\a \x01(\tR\vaudioFormat\x12+\n" +
+	"\asummary\x18\b \x01(\v2\x11.chat.TurnSummaryR\asummary\x12\x1e\n" +
+	"\n" +
+	"candidates\x18\t \x01(\x05R\n" +
+	"candidates\x12\x16\n" +
+	"\x06choice\x18\n" +
+	" \x01(\x05R\x06choice\x12\x10\n" +
+	"\x03seq\x18\v \x01(\x03R\x03seq\x12\x10\n" +
+	"\x03ack\x18\f \x01(\x03R\x03ack\x12!\n" +
+	"\fcontent_gzip\x18\r \x01(\fR\vcontentGzip\x12\x19\n" +
+	"\btrace_id\x18\x0e \x01(\tR\atraceId\x121\n" +
+	"\vtool_result\x18\x0f \x01(\v2\x10.chat.ToolResultR\n" +
+	"toolResult\x12\x16\n" +
+	"\x06status\x18\x10 \x01(\tR\x06status\x12\x1c\n" +
+	"\tspectator\x18\x11 \x01(\bR\tspectator\x12\x16\n" +
+	"\x06sender\x18\x12 \x01(\tR\x06sender\x12\x16\n" +
+	"\x06prompt\x18\x13 \x01(\tR\x06prompt\x12>\n" +
+	"\tvariables\x18\x14 \x03(\v2 .chat.ChatMessage.VariablesEntryR\tvariables\x12\x16\n" +
+	"\x06cached\x18\x15 \x01(\bR\x06cached\x12(\n" +
+	"\x06timing\x18\x16 \x01(\v2\x10.chat.TurnTimingR\x06timing\x126\n" +
+	"\fverification\x18\x17 \x01(\v2\x12.chat.VerificationR\fverification\x12!\n" +
+	"\x05hello\x18\x18 \x01(\v2\v.chat.HelloR\x05hello\x12*\n" +
+	"\bapproval\x18\x19 \x01(\v2\x0e.chat.ApprovalR\bapproval\x123\n" +
+	"\velicitation\x18\x1a \x01(\v2\x11.chat.ElicitationR\velicitation\x1a<\n" +
+	"\x0eVariablesEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"\x8a\x01\n" +
+	"\x05Hello\x12%\n" +
+	"\x0eserver_version\x18\x01 \x01(\tR\rserverVersion\x12)\n" +
+	"\x10protocol_version\x18\x02 \x01(\x05R\x0fprotocolVersion\x12/\n" +
+	"\x13supported_protocols\x18\x03 \x03(\x05R\x12supportedProtocols\"<\n" +
+	"\fVerification\x12\x18\n" +
+	"\averdict\x18\x01 \x01(\tR\averdict\x12\x12\n" +
+	"\x04note\x18\x02 \x01(\tR\x04note\"R\n" +
+	"\n" +
+	"TurnTiming\x12\x19\n" +
+	"\btotal_ms\x18\x01 \x01(\x03R\atotalMs\x12)\n" +
+	"\x06phases\x18\x02 \x03(\v2\x11.chat.TimingPhaseR\x06phases\"\x89\x01\n" +
+	"\vTimingPhase\x12\x14\n" +
+	"\x05phase\x18\x01 \x01(\tR\x05phase\x12\x12\n" +
+	"\x04name\x18\x02 \x01(\tR\x04name\x12\x19\n" +
+	"\bstart_ms\x18\x03 \x01(\x03R\astartMs\x12\x1f\n" +
+	"\vduration_ms\x18\x04 \x01(\x03R\n" +
+	"durationMs\x12\x14\n" +
+	"\x05error\x18\x05 \x01(\bR\x05error\"\x80\x01\n" +
+	"\bApproval\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x16\n" +
+	"\x06server\x18\x02 \x01(\tR\x06server\x12\x12\n" +
+	"\x04tool\x18\x03 \x01(\tR\x04tool\x12\x1c\n" +
+	"\targuments\x18\x04 \x01(\tR\targuments\x12\x1a\n" +
+	"\bapproved\x18\x05 \x01(\bR\bapproved\"\x99\x01\n" +
+	"\vElicitation\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x16\n" +
+	"\x06server\x18\x02 \x01(\tR\x06server\x12\x18\n" +
+	"\amessage\x18\x03 \x01(\tR\amessage\x12\x16\n" +
+	"\x06schema\x18\x04 \x01(\tR\x06schema\x12\x16\n" +
+	"\x06action\x18\x05 \x01(\tR\x06action\x12\x18\n" +
+	"\acontent\x18\x06 \x01(\tR\acontent\"4\n" +
+	"\n" +
+	"ToolResult\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x12\n" +
+	"\x04json\x18\x02 \x01(\tR\x04json\"\xa1\x02\n" +
+	"\vTurnSummary\x12\x19\n" +
+	"\btotal_ms\x18\x01 \x01(\x03R\atotalMs\x12\x15\n" +
+	"\x06llm_ms\x18\x02 \x01(\x03R\x05llmMs\x12'\n" +
+	"\x05tools\x18\x03 \x03(\v2\x11.chat.ToolLatencyR\x05tools\x12#\n" +
+	"\rprompt_tokens\x18\x04 \x01(\x03R\fpromptTokens\x12+\n" +
+	"\x11completion_tokens\x18\x05 \x01(\x03R\x10completionTokens\x12!\n" +
+	"\ftotal_tokens\x18\x06 \x01(\x03R\vtotalTokens\x12\x12\n" +
+	"\x04cost\x18\a \x01(\x01R\x04cost\x12\x16\n" +
+	"\x06models\x18\b \x03(\tR\x06models\x12\x16\n" +
+	"\x06cached\x18\t \x01(\bR\x06cached\"G\n" +
+	"\vToolLatency\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x0e\n" +
+	"\x02ms\x18\x02 \x01(\x03R\x02ms\x12\x14\n" +
+	"\x05error\x18\x03 \x01(\bR\x05error\"q\n" +
+	"\bArtifact\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x12\n" +
+	"\x04name\x18\x02 \x01(\tR\x04name\x12\x1b\n" +
+	"\tmime_type\x18\x03 \x01(\tR\bmimeType\x12\x12\n" +
+	"\x04size\x18\x04 \x01(\x03R\x04size\x12\x10\n" +
+	"\x03url\x18\x05 \x01(\tR\x03urlB(Z&github.com/guobinqiu/mcp-host-web/chatb\x06proto3"
 
 var (
 	file_chat_chat_proto_rawDescOnce sync.Once
@@ -94,16 +1122,38 @@ func file_chat_chat_proto_rawDescGZIP() []byte {
 	return file_chat_chat_proto_rawDescData
 }
 
-var file_chat_chat_proto_msgTypes = make([]protoimpl.MessageInfo, 1)
+var file_chat_chat_proto_msgTypes = make([]protoimpl.MessageInfo, 12)
 var file_chat_chat_proto_goTypes = []any{
-	(*ChatMessage)(nil), // 0: chat.ChatMessage
+	(*ChatMessage)(nil),  // 0: chat.ChatMessage
+	(*Hello)(nil),        // 1: chat.Hello
+	(*Verification)(nil), // 2: chat.Verification
+	(*TurnTiming)(nil),   // 3: chat.TurnTiming
+	(*TimingPhase)(nil),  // 4: chat.TimingPhase
+	(*Approval)(nil),     // 5: chat.Approval
+	(*Elicitation)(nil),  // 6: chat.Elicitation
+	(*ToolResult)(nil),   // 7: chat.ToolResult
+	(*TurnSummary)(nil),  // 8: chat.TurnSummary
+	(*ToolLatency)(nil),  // 9: chat.ToolLatency
+	(*Artifact)(nil),     // 10: chat.Artifact
+	nil,                  // 11: chat.ChatMessage.VariablesEntry
 }
 var file_chat_chat_proto_depIdxs = []int32{
-	0, // [0:0] is the sub-list for method output_type
-	0, // [0:0] is the sub-list for method input_type
-	0, // [0:0] is the sub-list for extension type_name
-	0, // [0:0] is the sub-list for extension extendee
-	0, // [0:0] is the sub-list for field type_name
+	10, // 0: chat.ChatMessage.artifact:type_name -> chat.Artifact
+	8,  // 1: chat.ChatMessage.summary:type_name -> chat.TurnSummary
+	7,  // 2: chat.ChatMessage.tool_result:type_name -> chat.ToolResult
+	11, // 3: chat.ChatMessage.variables:type_name -> chat.ChatMessage.VariablesEntry
+	3,  // 4: chat.ChatMessage.timing:type_name -> chat.TurnTiming
+	2,  // 5: chat.ChatMessage.verification:type_name -> chat.Verification
+	1,  // 6: chat.ChatMessage.hello:type_name -> chat.Hello
+	5,  // 7: chat.ChatMessage.approval:type_name -> chat.Approval
+	6,  // 8: chat.ChatMessage.elicitation:type_name -> chat.Elicitation
+	4,  // 9: chat.TurnTiming.phases:type_name -> chat.TimingPhase
+	9,  // 10: chat.TurnSummary.tools:type_name -> chat.ToolLatency
+	11, // [11:11] is the sub-list for method output_type
+	11, // [11:11] is the sub-list for method input_type
+	11, // [11:11] is the sub-list for extension type_name
+	11, // [11:11] is the sub-list for extension extendee
+	0,  // [0:11] is the sub-list for field type_name
 }
 
 func init() { file_chat_chat_proto_init() }
@@ -117,7 +1167,7 @@ func file_chat_chat_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_chat_chat_proto_rawDesc), len(file_chat_chat_proto_rawDesc)),
 			NumEnums:      0,
-			NumMessages:   1,
+			NumMessages:   12,
 			NumExtensions: 0,
 			NumServices:   0,
 		},
@@ -0,0 +1,8 @@
+package chat
+
+import _ "embed"
+
+// Proto 是生成本包时使用的 chat.proto 原文, 服务端通过 /api/schema/chat.proto 提供给客户端生成代码
+//
+//go:embed chat.proto
+var Proto []byte
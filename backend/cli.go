@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/guobinqiu/mcp-host-web/pkg/host"
+	"github.com/joho/godotenv"
+	"github.com/spf13/cobra"
+)
+
+// newRootCmd 命令行入口, 不带子命令时等同于 serve
+func newRootCmd() *cobra.Command {
+	var configPath, addr string
+	root := &cobra.Command{
+		Use:           "mcp-host",
+		Short:         "连接 MCP 服务的大模型对话服务",
+		Version:       host.Version,
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		Args:          cobra.NoArgs,
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			// 先加载 .env, 配置文件中的 ${VAR} 也可以引用其中的变量
+			_ = godotenv.Load()
+			if configPath == "" {
+				configPath = host.FindConfigFile()
+			}
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return host.Serve(configPath, addr)
+		},
+	}
+	root.PersistentFlags().StringVarP(&configPath, "config", "c", "", "配置文件路径, 支持 .json, .yaml, .toml, 缺省依次查找 config.json, config.yaml, config.yml, config.toml")
+	root.Flags().StringVar(&addr, "addr", ":8080", "监听地址")
+
+	serve := &cobra.Command{
+		Use:   "serve",
+		Short: "启动 HTTP 和 WebSocket 服务",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return host.Serve(configPath, addr)
+		},
+	}
+	serve.Flags().StringVar(&addr, "addr", ":8080", "监听地址")
+
+	validate := &cobra.Command{
+		Use:   "validate-config",
+		Short: "检查配置文件, 有错误时以非零状态退出",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := host.LoadConfig(configPath)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(cmd.OutOrStdout(), host.T(cfg.Locale, "cli.config_ok", configPath))
+			return nil
+		},
+	}
+
+	tools := &cobra.Command{Use: "tools", Short: "查看 MCP 服务提供的工具"}
+	tools.AddCommand(&cobra.Command{
+		Use:   "list",
+		Short: "连接配置中的 MCP 服务并列出发现的工具",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runToolsList(cmd.OutOrStdout(), configPath)
+		},
+	})
+
+	var timeout time.Duration
+	var load host.LoadTestOptions
+	chatCmd := &cobra.Command{
+		Use:   "chat [问题]",
+		Short: "单次提问, 问题缺省从标准输入读取",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			query := strings.Join(args, " ")
+			if query == "" {
+				b, err := io.ReadAll(cmd.InOrStdin())
+				if err != nil {
+					return err
+				}
+				query = strings.TrimSpace(string(b))
+			}
+			if query == "" {
+				return host.NewError("cli.empty_query")
+			}
+			return runChat(cmd.OutOrStdout(), configPath, query, timeout)
+		},
+	}
+	chatCmd.Flags().DurationVar(&timeout, "timeout", 0, "本次对话的超时, 缺省使用配置中的 turnTimeout")
+
+	loadtest := &cobra.Command{
+		Use:   "loadtest",
+		Short: "使用模拟的大模型和 MCP 服务做并发压测",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return host.RunLoadTest(load)
+		},
+	}
+	loadtest.Flags().IntVar(&load.Sessions, "sessions", 50, "并发 WebSocket 会话数")
+	loadtest.Flags().IntVar(&load.Turns, "turns", 5, "每个会话的对话轮数")
+	loadtest.Flags().StringVar(&load.Prompts, "prompts", "", "提示词文件, 每行一条, 缺省使用内置提示词")
+	loadtest.Flags().DurationVar(&load.LLMLatency, "llm-latency", 20*time.Millisecond, "模拟大模型每次调用的耗时")
+	loadtest.Flags().DurationVar(&load.ToolLatency, "tool-latency", 10*time.Millisecond, "模拟工具调用的耗时")
+
+	root.AddCommand(serve, validate, tools, chatCmd, loadtest)
+	return root
+}
+
+// runToolsList 连接所有 MCP 服务, 按服务列出工具 (已应用配置中的描述覆盖)
+func runToolsList(w io.Writer, configPath string) error {
+	cfg, err := host.LoadConfig(configPath)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	tools, errs := host.ListTools(ctx, cfg)
+	for _, err := range errs {
+		fmt.Fprintln(os.Stderr, err)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "SERVER\tTOOL\tDESCRIPTION")
+	for _, tool := range tools {
+		desc, _, _ := strings.Cut(tool.Description, "\n")
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", tool.Server, tool.Name, desc)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if len(errs) > 0 {
+		return host.NewError("cli.servers_failed", len(errs))
+	}
+	return nil
+}
+
+// runChat 不启动服务, 直接完成一轮对话并把回答写到标准输出
+func runChat(w io.Writer, configPath, query string, timeout time.Duration) error {
+	cfg, err := host.LoadConfig(configPath)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	engine, err := host.New(ctx, cfg, host.Options{TurnTimeout: timeout})
+	if err != nil {
+		return err
+	}
+	defer engine.Close()
+
+	response, err := engine.Chat(context.Background(), engine.NewSession(""), query, nil)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(w, response)
+	return nil
+}
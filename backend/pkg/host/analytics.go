@@ -0,0 +1,395 @@
+package host
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultAnalyticsDir        = "data/analytics"
+	defaultAnalyticsInterval   = 24 * time.Hour
+	defaultAnalyticsTopPrompts = 10
+	analyticsPromptLength      = 100 // 记录的问题最多字符数, 相同开头的问题合并统计
+)
+
+// promptCellPattern 匹配 usageCSV 写出的 "问题 (次数)" 条目, 条目之间以 "; " 分隔
+var promptCellPattern = regexp.MustCompile(`(.+?) \((\d+)\)(?:; |$)`)
+
+// ToolUsage 是一个工具的调用统计
+type ToolUsage struct {
+	Server      string        `json:"server"`
+	Tool        string        `json:"tool"`
+	Calls       int           `json:"calls"`
+	Failures    int           `json:"failures"`
+	SuccessRate float64       `json:"success_rate"` // 没有调用过时为 0
+	AvgMs       int64         `json:"avg_ms"`
+	TopPrompts  []PromptCount `json:"top_prompts"` // 触发调用最多的问题, 按次数排序
+}
+
+// PromptCount 是触发工具调用的一个问题及其次数
+type PromptCount struct {
+	Prompt string `json:"prompt"`
+	Count  int    `json:"count"`
+}
+
+type toolUsageKey struct{ server, tool string }
+
+type toolUsageStats struct {
+	calls    int
+	failures int
+	total    time.Duration
+	prompts  map[string]*promptUsage
+}
+
+// promptUsage 是一个问题触发调用的次数, 同时按用户计数, 清除用户数据时减去该用户的部分
+type promptUsage struct {
+	count int
+	users map[string]int
+}
+
+// toolAnalytics 统计本副本启动以来各工具的调用情况, 用于判断哪些 MCP 服务值得保留;
+// 每隔 interval 把累计的统计导出为 dir/tools-<时间>.csv。问题只保存在内存和导出文件中, 不随事件转发
+type toolAnalytics struct {
+	dir      string
+	interval time.Duration
+	top      int
+
+	mu    sync.Mutex
+	since time.Time
+	tools map[toolUsageKey]*toolUsageStats
+
+	exportMu sync.Mutex // 导出和清除用户数据时改写导出文件互斥
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// newToolAnalytics 未配置 analytics 时返回 nil
+func newToolAnalytics(cfg *AnalyticsConfig) (*toolAnalytics, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+	a := &toolAnalytics{
+		dir:      defaultAnalyticsDir,
+		interval: defaultAnalyticsInterval,
+		top:      defaultAnalyticsTopPrompts,
+		since:    time.Now(),
+		tools:    make(map[toolUsageKey]*toolUsageStats),
+	}
+	if cfg.Dir != "" {
+		a.dir = cfg.Dir
+	}
+	if cfg.Interval > 0 {
+		a.interval = time.Duration(cfg.Interval)
+	}
+	if cfg.TopPrompts > 0 {
+		a.top = cfg.TopPrompts
+	}
+	if err := os.MkdirAll(a.dir, 0o700); err != nil {
+		return nil, err
+	}
+	a.ctx, a.cancel = context.WithCancel(context.Background())
+	return a, nil
+}
+
+// analyticsPrompt 合并空白并截断问题, 相同开头的问题按同一个统计
+func analyticsPrompt(prompt string) string {
+	prompt = strings.Join(strings.Fields(prompt), " ")
+	if r := []rune(prompt); len(r) > analyticsPromptLength {
+		prompt = string(r[:analyticsPromptLength]) + "…"
+	}
+	return prompt
+}
+
+// record 记录一次工具调用, userID 是提问的用户; a 为 nil 时什么也不做
+func (a *toolAnalytics) record(server, tool, userID, prompt string, d time.Duration, err error) {
+	if a == nil {
+		return
+	}
+	prompt = analyticsPrompt(prompt)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	key := toolUsageKey{server, tool}
+	s := a.tools[key]
+	if s == nil {
+		s = &toolUsageStats{prompts: make(map[string]*promptUsage)}
+		a.tools[key] = s
+	}
+	s.calls++
+	s.total += d
+	if err != nil {
+		s.failures++
+	}
+	if prompt != "" {
+		u := s.prompts[prompt]
+		if u == nil {
+			u = &promptUsage{users: make(map[string]int)}
+			s.prompts[prompt] = u
+		}
+		u.count++
+		u.users[userID]++
+		// 不同的问题很多时只保留次数最多的一部分, 避免内存无限增长
+		if len(s.prompts) > 4*a.top {
+			keep := make(map[string]*promptUsage, 2*a.top)
+			for _, p := range topPrompts(s.prompts, 2*a.top) {
+				keep[p.Prompt] = s.prompts[p.Prompt]
+			}
+			s.prompts = keep
+		}
+	}
+}
+
+func topPrompts(prompts map[string]*promptUsage, n int) []PromptCount {
+	out := make([]PromptCount, 0, len(prompts))
+	for p, u := range prompts {
+		out = append(out, PromptCount{Prompt: p, Count: u.count})
+	}
+	slices.SortFunc(out, func(x, y PromptCount) int {
+		if x.Count != y.Count {
+			return y.Count - x.Count
+		}
+		return strings.Compare(x.Prompt, y.Prompt)
+	})
+	if len(out) > n {
+		out = out[:n]
+	}
+	return out
+}
+
+// snapshot 返回累计的统计, 按调用次数从多到少排序; advertised 中没有调用过的工具也列出, 调用次数为 0
+func (a *toolAnalytics) snapshot(advertised []toolUsageKey) (time.Time, []ToolUsage) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	usage := make([]ToolUsage, 0, len(a.tools))
+	for key, s := range a.tools {
+		u := ToolUsage{Server: key.server, Tool: key.tool, Calls: s.calls, Failures: s.failures, TopPrompts: topPrompts(s.prompts, a.top)}
+		if s.calls > 0 {
+			u.SuccessRate = float64(s.calls-s.failures) / float64(s.calls)
+			u.AvgMs = (s.total / time.Duration(s.calls)).Milliseconds()
+		}
+		usage = append(usage, u)
+	}
+	for _, key := range advertised {
+		if _, ok := a.tools[key]; !ok {
+			usage = append(usage, ToolUsage{Server: key.server, Tool: key.tool, TopPrompts: []PromptCount{}})
+		}
+	}
+	slices.SortFunc(usage, func(x, y ToolUsage) int {
+		if x.Calls != y.Calls {
+			return y.Calls - x.Calls
+		}
+		if c := strings.Compare(x.Server, y.Server); c != 0 {
+			return c
+		}
+		return strings.Compare(x.Tool, y.Tool)
+	})
+	return a.since, usage
+}
+
+// Start 每隔 interval 导出一次, 只在 serve 中启动
+func (a *toolAnalytics) Start() {
+	if a == nil {
+		return
+	}
+	a.wg.Add(1)
+	go func() {
+		defer a.wg.Done()
+		ticker := time.NewTicker(a.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-a.ctx.Done():
+				return
+			case now := <-ticker.C:
+				if err := a.export(now); err != nil {
+					logf("analytics.export_failed", err)
+				}
+			}
+		}
+	}()
+}
+
+// Close 停止定时导出
+func (a *toolAnalytics) Close() {
+	if a == nil {
+		return
+	}
+	a.cancel()
+	a.wg.Wait()
+}
+
+// export 把累计的统计写入 dir/tools-<时间>.csv, 只包含调用过的工具
+func (a *toolAnalytics) export(now time.Time) error {
+	a.exportMu.Lock()
+	defer a.exportMu.Unlock()
+	_, usage := a.snapshot(nil)
+	data, err := usageCSV(usage)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(a.dir, "tools-"+now.UTC().Format("20060102T150405Z")+".csv")
+	// 先写临时文件再改名, 读取导出目录的程序不会读到写了一半的文件
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	logf("analytics.exported", path, len(usage))
+	return nil
+}
+
+// usageCSV 每个工具一行, 常见问题写成 "问题 (次数)" 并用 "; " 分隔
+func usageCSV(usage []ToolUsage) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write([]string{"server", "tool", "calls", "failures", "success_rate", "avg_ms", "top_prompts"})
+	for _, u := range usage {
+		prompts := make([]string, len(u.TopPrompts))
+		for i, p := range u.TopPrompts {
+			prompts[i] = fmt.Sprintf("%s (%d)", p.Prompt, p.Count)
+		}
+		w.Write([]string{
+			u.Server, u.Tool, strconv.Itoa(u.Calls), strconv.Itoa(u.Failures),
+			strconv.FormatFloat(u.SuccessRate, 'f', 4, 64), strconv.FormatInt(u.AvgMs, 10),
+			strings.Join(prompts, "; "),
+		})
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+// purge 从内存中的统计和已经导出的 csv 中去掉用户的问题, 返回去掉的问题条数, dryRun 时只统计不修改。
+// 内存中按用户计数, 只减去该用户的次数; 导出文件中没有记录提问的用户, 与 prompts (用户会话中的问题) 或内存中该用户的问题
+// 相同的条目整条去掉, 其他用户问过的相同问题也一并去掉
+func (a *toolAnalytics) purge(userID string, prompts []string, dryRun bool) (int, error) {
+	if a == nil {
+		return 0, nil
+	}
+	a.exportMu.Lock()
+	defer a.exportMu.Unlock()
+
+	remove := make(map[string]bool, len(prompts))
+	for _, p := range prompts {
+		if p = analyticsPrompt(p); p != "" {
+			remove[p] = true
+		}
+	}
+	n := 0
+	a.mu.Lock()
+	for _, s := range a.tools {
+		for p, u := range s.prompts {
+			c, ok := u.users[userID]
+			if !ok {
+				continue
+			}
+			remove[p] = true
+			n++
+			if dryRun {
+				continue
+			}
+			delete(u.users, userID)
+			if u.count -= c; u.count <= 0 {
+				delete(s.prompts, p)
+			}
+		}
+	}
+	a.mu.Unlock()
+
+	files, err := filepath.Glob(filepath.Join(a.dir, "tools-*.csv"))
+	if err != nil {
+		return n, err
+	}
+	for _, file := range files {
+		removed, err := scrubUsageCSV(file, remove, dryRun)
+		if err != nil {
+			return n, err
+		}
+		n += removed
+	}
+	return n, nil
+}
+
+// scrubUsageCSV 从导出文件的 top_prompts 列中去掉 remove 中的问题, 有改动且不是 dryRun 时改写文件
+func scrubUsageCSV(file string, remove map[string]bool, dryRun bool) (int, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return 0, err
+	}
+	rows, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", file, err)
+	}
+	n := 0
+	for _, row := range rows[min(1, len(rows)):] {
+		last := len(row) - 1
+		if last < 0 || row[last] == "" {
+			continue
+		}
+		var keep []string
+		for _, m := range promptCellPattern.FindAllStringSubmatch(row[last], -1) {
+			if remove[m[1]] {
+				n++
+				continue
+			}
+			keep = append(keep, m[1]+" ("+m[2]+")")
+		}
+		row[last] = strings.Join(keep, "; ")
+	}
+	if n == 0 || dryRun {
+		return n, nil
+	}
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.WriteAll(rows)
+	if err := w.Error(); err != nil {
+		return 0, err
+	}
+	tmp := file + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0o600); err != nil {
+		return 0, err
+	}
+	return n, os.Rename(tmp, file)
+}
+
+// GET /api/analytics/tools 各工具的调用统计, format=csv 时返回 csv
+func (cc *ChatClient) handleToolAnalytics(w http.ResponseWriter, r *http.Request) {
+	if cc.analytics == nil {
+		writeError(w, r, http.StatusNotFound, "api.analytics_disabled")
+		return
+	}
+	// 缓存中的工具列表里有但没有调用过的工具也列出, 便于发现没人使用的服务
+	var advertised []toolUsageKey
+	for _, c := range cc.servers() {
+		tools, _ := cc.tools.cached(c)
+		for _, t := range tools {
+			advertised = append(advertised, toolUsageKey{c.Name, t.Name})
+		}
+	}
+	since, usage := cc.analytics.snapshot(advertised)
+	if r.URL.Query().Get("format") == "csv" {
+		data, err := usageCSV(usage)
+		if err != nil {
+			writeError(w, r, http.StatusInternalServerError, "error.request_failed")
+			return
+		}
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="tools.csv"`)
+		w.Write(data)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"since": since, "tools": usage})
+}
@@ -0,0 +1,78 @@
+package host
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func promptCounts(a *toolAnalytics) map[string]int {
+	_, usage := a.snapshot(nil)
+	counts := map[string]int{}
+	for _, u := range usage {
+		for _, p := range u.TopPrompts {
+			counts[p.Prompt] += p.Count
+		}
+	}
+	return counts
+}
+
+func TestToolAnalyticsPurge(t *testing.T) {
+	dir := t.TempDir()
+	a, err := newToolAnalytics(&AnalyticsConfig{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.record("weather", "forecast", "alice", "weather in  Paris", time.Millisecond, nil)
+	a.record("weather", "forecast", "bob", "weather in Paris", time.Millisecond, nil)
+	a.record("weather", "forecast", "bob", "weather in Paris", time.Millisecond, nil)
+	a.record("hr", "payroll", "alice", "my salary is 5000; raise?", time.Millisecond, nil)
+	a.record("hr", "payroll", "bob", "holidays left", time.Millisecond, nil)
+	if err := a.export(time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)); err != nil {
+		t.Fatal(err)
+	}
+	// 重启后内存中的统计已经清空, 只能按会话中的问题从导出文件中去掉
+	old := filepath.Join(dir, "tools-20240101T000000Z.csv")
+	if err := os.WriteFile(old, []byte("server,tool,calls,failures,success_rate,avg_ms,top_prompts\nhr,payroll,2,0,1.0000,1,what is my bonus (1); holidays left (1)\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	before, _ := os.ReadFile(filepath.Join(dir, "tools-20240501T000000Z.csv"))
+
+	n, err := a.purge("alice", []string{"what is my   bonus"}, true)
+	if err != nil || n != 5 {
+		t.Fatalf("dry run: got %d, %v, want 5", n, err)
+	}
+	if after, _ := os.ReadFile(filepath.Join(dir, "tools-20240501T000000Z.csv")); string(after) != string(before) {
+		t.Fatal("dry run changed the export")
+	}
+	if got := promptCounts(a)["weather in Paris"]; got != 3 {
+		t.Fatalf("dry run changed the counts: %d", got)
+	}
+
+	if _, err := a.purge("alice", []string{"what is my   bonus"}, false); err != nil {
+		t.Fatal(err)
+	}
+	counts := promptCounts(a)
+	if counts["weather in Paris"] != 2 || counts["holidays left"] != 1 {
+		t.Errorf("other users' counts changed: %v", counts)
+	}
+	if _, ok := counts["my salary is 5000; raise?"]; ok {
+		t.Errorf("alice's prompt is still counted: %v", counts)
+	}
+	for _, file := range []string{"tools-20240501T000000Z.csv", "tools-20240101T000000Z.csv"} {
+		data, err := os.ReadFile(filepath.Join(dir, file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, p := range []string{"salary", "weather in Paris", "bonus"} {
+			if strings.Contains(string(data), p) {
+				t.Errorf("%s still contains %q:\n%s", file, p, data)
+			}
+		}
+		if !strings.Contains(string(data), "holidays left (1)") {
+			t.Errorf("%s lost other prompts:\n%s", file, data)
+		}
+	}
+}
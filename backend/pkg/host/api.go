@@ -0,0 +1,125 @@
+package host
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 500
+)
+
+// withCORS 允许前端开发服务器跨域访问 REST 接口
+func (cc *ChatClient) withCORS(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if origin := r.Header.Get("Origin"); cc.corsOrigin != "" && origin == cc.corsOrigin {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Set("Access-Control-Allow-Credentials", "true")
+			w.Header().Add("Vary", "Origin")
+		} else {
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+		}
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Resume-Token")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		h(w, r)
+	}
+}
+
+// checkOrigin 检查 WebSocket 握手的 Origin: 浏览器跨站发起的连接会带上 cookie 和代理的登录状态,
+// 启用认证时只接受同源、配置的前端地址和不带 Origin 的 (非浏览器) 客户端; 未启用认证时不检查
+func (cc *ChatClient) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if cc.auth == nil || origin == "" {
+		return true
+	}
+	if cc.corsOrigin != "" && origin == cc.corsOrigin {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// writeError 按请求的语言返回错误信息, key 为消息目录中的 key
+func writeError(w http.ResponseWriter, r *http.Request, status int, key string, args ...any) {
+	writeJSON(w, status, map[string]string{"error": T(requestLocale(r), key, args...)})
+}
+
+// queryInt 读取非负整数查询参数, 缺省或非法时返回 def
+func queryInt(r *http.Request, name string, def int) int {
+	v, err := strconv.Atoi(r.URL.Query().Get(name))
+	if err != nil || v < 0 {
+		return def
+	}
+	return v
+}
+
+type messagesPage struct {
+	SessionID string           `json:"session_id"`
+	Total     int              `json:"total"`
+	Offset    int              `json:"offset"`
+	Limit     int              `json:"limit"`
+	Messages  []HistoryMessage `json:"messages"`
+}
+
+// GET /api/sessions/{id}/messages?offset=0&limit=50&role=user&tool=calculate
+// role 按角色过滤, tool 只保留调用了该工具的助理消息和该工具的返回结果
+func (cc *ChatClient) handleSessionMessages(w http.ResponseWriter, r *http.Request) {
+	sess, ok := cc.sessionFor(r, r.PathValue("id"))
+	if !ok {
+		writeError(w, r, http.StatusNotFound, "api.session_not_found")
+		return
+	}
+
+	role := r.URL.Query().Get("role")
+	tool := r.URL.Query().Get("tool")
+	offset := queryInt(r, "offset", 0)
+	limit := queryInt(r, "limit", defaultPageSize)
+	if limit == 0 {
+		limit = defaultPageSize
+	}
+	limit = min(limit, maxPageSize)
+
+	filtered := []HistoryMessage{}
+	for _, m := range sess.History() {
+		if role != "" && m.Role != role {
+			continue
+		}
+		if tool != "" && !usesTool(m, tool) {
+			continue
+		}
+		filtered = append(filtered, m)
+	}
+
+	page := messagesPage{SessionID: sess.ID, Total: len(filtered), Offset: offset, Limit: limit, Messages: []HistoryMessage{}}
+	if offset < len(filtered) {
+		end := min(offset+limit, len(filtered))
+		page.Messages = filtered[offset:end]
+	}
+	writeJSON(w, http.StatusOK, page)
+}
+
+func usesTool(m HistoryMessage, tool string) bool {
+	if m.Role == "tool" {
+		return m.Name == tool
+	}
+	for _, tc := range m.ToolCalls {
+		if tc.Function.Name == tool {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,116 @@
+package host
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+
+	"github.com/guobinqiu/mcp-host-web/chat"
+)
+
+var toolApprovals = metrics.Counter("tool_approvals_total", "Tool calls that required approval, by outcome.", "outcome")
+
+const (
+	approvalApproved = "approved"
+	approvalDenied   = "denied"
+	approvalTimeout  = "timeout"
+)
+
+// approvalGate 记录等待用户批准的工具调用。配置了 requireApproval 的工具在调用前下发 approval_request,
+// 用户通过 WebSocket 的 approval 消息或 POST /api/sessions/{id}/approvals/{approval} 批准或拒绝;
+// 等待时间计入本轮对话的超时, 超时视为拒绝
+type approvalGate struct {
+	mu      sync.Mutex
+	pending map[string]*pendingApproval // approval id ->
+}
+
+type pendingApproval struct {
+	sessionID string
+	decision  chan bool // 容量为 1, 决定后从 pending 中删除, 不会再次写入
+}
+
+func newApprovalGate() *approvalGate {
+	return &approvalGate{pending: map[string]*pendingApproval{}}
+}
+
+// request 下发 approval_request 并等待用户的决定, 返回 approved | denied | timeout;
+// 连接断开或本轮被取消时返回 ctx 的错误
+func (g *approvalGate) request(ctx context.Context, sessionID, server, tool string, args any, emit func(*chat.ChatMessage)) (string, error) {
+	id := newTraceID()
+	p := &pendingApproval{sessionID: sessionID, decision: make(chan bool, 1)}
+	g.mu.Lock()
+	g.pending[id] = p
+	g.mu.Unlock()
+	defer func() {
+		g.mu.Lock()
+		delete(g.pending, id)
+		g.mu.Unlock()
+	}()
+
+	argsJSON, _ := json.Marshal(args)
+	emit(&chat.ChatMessage{
+		Type:      "approval_request",
+		Content:   T(clientInfoFrom(ctx).locale, "approval.request", tool),
+		SessionId: sessionID,
+		Approval:  &chat.Approval{Id: id, Server: server, Tool: tool, Arguments: string(argsJSON)},
+	})
+	select {
+	case approved := <-p.decision:
+		if approved {
+			return approvalApproved, nil
+		}
+		return approvalDenied, nil
+	case <-ctx.Done():
+		if context.Cause(ctx) == errTurnTimeout {
+			return approvalTimeout, nil
+		}
+		return "", ctx.Err()
+	}
+}
+
+// resolve 记录用户的决定, 没有这个等待中的调用 (已超时、已决定或属于其他会话) 时返回 false
+func (g *approvalGate) resolve(sessionID, id string, approved bool) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	p, ok := g.pending[id]
+	if !ok || p.sessionID != sessionID {
+		return false
+	}
+	delete(g.pending, id)
+	p.decision <- approved
+	return true
+}
+
+// approvalMessage 是没有批准时代替工具结果交给大模型的说明
+func approvalMessage(tool, outcome string) string {
+	if outcome == approvalTimeout {
+		return "error: the user did not approve the call of " + tool + " in time, so it was not executed. Tell the user and do not call it again unless asked."
+	}
+	return "error: the user declined the call of " + tool + ", so it was not executed. Do not call it again unless the user asks; ask what they want to change instead."
+}
+
+// POST /api/sessions/{id}/approvals/{approval} {"approved": true} 批准或拒绝等待中的工具调用
+func (cc *ChatClient) handleApproval(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, r, http.StatusMethodNotAllowed, "api.method_not_allowed")
+		return
+	}
+	sess, ok := cc.sessionFor(r, r.PathValue("id"))
+	if !ok {
+		writeError(w, r, http.StatusNotFound, "api.session_not_found")
+		return
+	}
+	var body struct {
+		Approved bool `json:"approved"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, r, http.StatusBadRequest, "api.bad_request", err)
+		return
+	}
+	if !cc.approvals.resolve(sess.ID, r.PathValue("approval"), body.Approved) {
+		writeError(w, r, http.StatusNotFound, "api.approval_not_found")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,96 @@
+package host
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/guobinqiu/mcp-host-web/chat"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/sashabaranov/go-openai"
+)
+
+// 批准请求会广播给会话的所有连接, 其中不能有主机注入的令牌和用户 id, 工具仍然要收到这些参数
+func TestApprovalRequestHidesInjectedArguments(t *testing.T) {
+	llm := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req openai.ChatCompletionRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		msg := openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant}
+		if last := req.Messages[len(req.Messages)-1]; last.Role == openai.ChatMessageRoleUser {
+			msg.ToolCalls = []openai.ToolCall{{ID: "call_send", Type: openai.ToolTypeFunction,
+				Function: openai.FunctionCall{Name: "send_mail", Arguments: `{"to": "bob@example.com", "token": "forged"}`}}}
+		} else {
+			msg.Content = last.Content
+		}
+		writeJSON(w, http.StatusOK, openai.ChatCompletionResponse{
+			Choices: []openai.ChatCompletionChoice{{Message: msg, FinishReason: openai.FinishReasonStop}},
+		})
+	}))
+	defer llm.Close()
+
+	s := server.NewMCPServer("mail", "1.0.0")
+	s.AddTool(mcp.NewTool("send_mail"), func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		args, _ := json.Marshal(req.Params.Arguments)
+		return mcp.NewToolResultText(string(args)), nil
+	})
+	mail, err := newInProcessMCPClient("mail", s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { mail.Close() })
+	mail.Tools = map[string]ToolOverride{"send_mail": {
+		RequireApproval: true,
+		Inject:          map[string]string{"token": InjectAuthToken, "user": InjectUserID},
+	}}
+
+	config := openai.DefaultConfig("test")
+	config.BaseURL = llm.URL
+	cc := newDiscoveryClient(t)
+	cc.mcpClients = []*MCPClient{mail}
+	cc.provider = openai.NewClientWithConfig(config)
+	cc.model = "mock"
+	cc.sessions = NewSessionStore(nil)
+	cc.approvals = newApprovalGate()
+	cc.turnTimeout = defaultTurnTimeout
+	if cc.uploads, err = NewUploadStore(&UploadsConfig{Dir: t.TempDir()}); err != nil {
+		t.Fatal(err)
+	}
+	if cc.artifacts, err = NewArtifactStore(&ArtifactsConfig{Dir: t.TempDir()}); err != nil {
+		t.Fatal(err)
+	}
+
+	sess := cc.sessions.Create("alice")
+	ctx := withToolIdentity(context.Background(), toolIdentity{token: "secret-token"})
+	var request *chat.ChatMessage
+	got, err := cc.ProcessQuery(ctx, sess, "mail bob", func(msg *chat.ChatMessage) {
+		if msg.Type == "approval_request" {
+			request = msg
+			cc.approvals.resolve(sess.ID, msg.GetApproval().GetId(), true)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if request == nil {
+		t.Fatal("no approval_request was sent")
+	}
+	var shown map[string]any
+	if err := json.Unmarshal([]byte(request.GetApproval().GetArguments()), &shown); err != nil {
+		t.Fatal(err)
+	}
+	if len(shown) != 1 || shown["to"] != "bob@example.com" {
+		t.Errorf("approval arguments = %v, want only the model's to", shown)
+	}
+	for _, secret := range []string{"secret-token", "alice", "forged"} {
+		if strings.Contains(request.GetApproval().GetArguments(), secret) {
+			t.Errorf("approval arguments leak %q: %s", secret, request.GetApproval().GetArguments())
+		}
+	}
+	if !strings.Contains(got, `"token": "secret-token"`) || !strings.Contains(got, `"user": "alice"`) {
+		t.Errorf("tool did not receive the injected arguments: %s", got)
+	}
+}
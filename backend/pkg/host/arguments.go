@@ -0,0 +1,96 @@
+package host
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+// 由主机而不是大模型提供的工具参数的来源
+const (
+	InjectUserID    = "user_id"    // 发送本轮消息的用户, 匿名时为会话所有者
+	InjectSessionID = "session_id" // 会话 id
+	InjectAuthToken = "auth_token" // 连接时的 Authorization: Bearer 令牌或登录 cookie 中的 ID token
+)
+
+var injectSources = []string{InjectUserID, InjectSessionID, InjectAuthToken}
+
+// toolIdentity 是注入工具参数时使用的身份
+type toolIdentity struct {
+	userID    string
+	sessionID string
+	token     string
+}
+
+type toolIdentityKey struct{}
+
+func withToolIdentity(ctx context.Context, id toolIdentity) context.Context {
+	return context.WithValue(ctx, toolIdentityKey{}, id)
+}
+
+func toolIdentityFrom(ctx context.Context) toolIdentity {
+	id, _ := ctx.Value(toolIdentityKey{}).(toolIdentity)
+	return id
+}
+
+// requestToken 取连接请求中的令牌, 和 OIDC 登录的查找顺序相同
+func requestToken(r *http.Request) string {
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return token
+	}
+	if c, err := r.Cookie(idTokenCookie); err == nil {
+		return c.Value
+	}
+	return ""
+}
+
+// toolArguments 在大模型给出的工具参数上合并配置: defaults 只补充没有给出的参数,
+// inject 把主机提供的值写入参数, 覆盖大模型给出的同名参数, 没有值的来源不写入
+func (c *MCPClient) toolArguments(ctx context.Context, tool string, args map[string]any) map[string]any {
+	o := c.Tools[tool]
+	if len(o.Defaults) == 0 && len(o.Inject) == 0 {
+		return args
+	}
+	if args == nil {
+		args = make(map[string]any, len(o.Defaults)+len(o.Inject))
+	}
+	for param, v := range o.Defaults {
+		if _, ok := args[param]; !ok {
+			args[param] = v
+		}
+	}
+	id := toolIdentityFrom(ctx)
+	for param, source := range o.Inject {
+		var v string
+		switch source {
+		case InjectUserID:
+			v = id.userID
+		case InjectSessionID:
+			v = id.sessionID
+		case InjectAuthToken:
+			v = id.token
+		}
+		if v == "" {
+			delete(args, param)
+			continue
+		}
+		args[param] = v
+	}
+	return args
+}
+
+// visibleArguments 返回去掉 inject 参数的副本, 用于下发给客户端 (比如批准请求):
+// 注入的令牌和用户 id 不能让会话的参与者和旁观者看到
+func (c *MCPClient) visibleArguments(tool string, args map[string]any) map[string]any {
+	inject := c.Tools[tool].Inject
+	if len(inject) == 0 {
+		return args
+	}
+	visible := make(map[string]any, len(args))
+	for param, v := range args {
+		if _, ok := inject[param]; !ok {
+			visible[param] = v
+		}
+	}
+	return visible
+}
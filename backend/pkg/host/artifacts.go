@@ -0,0 +1,313 @@
+package host
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/guobinqiu/mcp-host-web/chat"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// 超过该长度的文本工具结果也会保存为附件
+const defaultInlineLimit = 64 * 1024
+
+// 保存为附件后, 给大模型保留的文本预览长度
+const artifactPreviewLen = 2000
+
+// Artifact 描述一个由工具产生的文件
+type Artifact struct {
+	ID        string    `json:"id"`
+	SessionID string    `json:"session_id"`
+	Name      string    `json:"name"`
+	MimeType  string    `json:"mime_type"`
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (a *Artifact) URL() string {
+	return "/api/artifacts/" + a.ID
+}
+
+// ArtifactStore 把附件保存在本地目录, 每个附件一个数据文件和一个元数据文件
+type ArtifactStore struct {
+	dir         string
+	inlineLimit int
+}
+
+func NewArtifactStore(cfg *ArtifactsConfig) (*ArtifactStore, error) {
+	st := &ArtifactStore{dir: "data/artifacts", inlineLimit: defaultInlineLimit}
+	if cfg != nil {
+		if cfg.Dir != "" {
+			st.dir = cfg.Dir
+		}
+		if cfg.InlineLimit > 0 {
+			st.inlineLimit = cfg.InlineLimit
+		}
+	}
+	if err := os.MkdirAll(st.dir, 0o700); err != nil {
+		return nil, err
+	}
+	return st, nil
+}
+
+func (st *ArtifactStore) Save(sessionID, name, mimeType string, data []byte) (*Artifact, error) {
+	a := &Artifact{
+		ID:        newID(),
+		SessionID: sessionID,
+		Name:      name,
+		MimeType:  mimeType,
+		Size:      int64(len(data)),
+		CreatedAt: time.Now(),
+	}
+	if err := os.WriteFile(filepath.Join(st.dir, a.ID), data, 0o600); err != nil {
+		return nil, err
+	}
+	meta, _ := json.Marshal(a)
+	if err := os.WriteFile(filepath.Join(st.dir, a.ID+".json"), meta, 0o600); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (st *ArtifactStore) Get(id string) (*Artifact, string, error) {
+	if !sessionIDPattern.MatchString(id) {
+		return nil, "", os.ErrNotExist
+	}
+	meta, err := os.ReadFile(filepath.Join(st.dir, id+".json"))
+	if err != nil {
+		return nil, "", err
+	}
+	var a Artifact
+	if err := json.Unmarshal(meta, &a); err != nil {
+		return nil, "", err
+	}
+	return &a, filepath.Join(st.dir, id), nil
+}
+
+// BySessions 返回属于这些会话的附件 id
+func (st *ArtifactStore) BySessions(sessions []string) ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(st.dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for _, file := range files {
+		meta, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		var a Artifact
+		if json.Unmarshal(meta, &a) == nil && slices.Contains(sessions, a.SessionID) {
+			ids = append(ids, a.ID)
+		}
+	}
+	return ids, nil
+}
+
+// Delete 删除附件的数据和元数据文件
+func (st *ArtifactStore) Delete(id string) error {
+	if !sessionIDPattern.MatchString(id) {
+		return os.ErrNotExist
+	}
+	for _, path := range []string{filepath.Join(st.dir, id), filepath.Join(st.dir, id+".json")} {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// GET /api/artifacts/{id} 只有能访问附件所属会话的用户可以下载, 其他用户和不存在的附件一样返回 404
+func (cc *ChatClient) handleArtifact(w http.ResponseWriter, r *http.Request) {
+	a, file, err := cc.artifacts.Get(r.PathValue("id"))
+	if err != nil {
+		writeError(w, r, http.StatusNotFound, "api.artifact_not_found")
+		return
+	}
+	if _, ok := cc.sessionFor(r, a.SessionID); !ok {
+		writeError(w, r, http.StatusNotFound, "api.artifact_not_found")
+		return
+	}
+	w.Header().Set("Content-Type", a.MimeType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": a.Name}))
+	http.ServeFile(w, r, file)
+}
+
+// toolResultText 把工具返回的内容转成给大模型的文本
+// 图片、音频、二进制资源和过大的文本保存为附件, 通过 emit 通知客户端下载地址, 只在文本中保留说明;
+// ephemeral 工具的结果不落盘也不推送给客户端, 文本原样返回, 二进制内容只保留说明
+func (cc *ChatClient) toolResultText(sess *Session, toolName string, contents []mcp.Content, ephemeral bool, emit func(*chat.ChatMessage)) string {
+	if ephemeral {
+		return ephemeralText(contents)
+	}
+	var parts []string
+	for i, content := range contents {
+		name := fmt.Sprintf("%s-%d", toolName, i+1)
+		switch c := content.(type) {
+		case mcp.TextContent:
+			if compact, pretty, ok := jsonOutput(c.Text); ok {
+				// JSON 结果同时推送给客户端渲染表格, 给大模型的是缩进后的 JSON 代码块
+				if len(compact) <= maxToolResultEvent {
+					emit(&chat.ChatMessage{Type: "tool_result", ToolResult: &chat.ToolResult{Name: toolName, Json: compact}, SessionId: sess.ID})
+				}
+				text := cc.inlineOrArtifact(sess, name+".json", "application/json", pretty, emit)
+				if text == pretty {
+					text = "```json\n" + pretty + "\n```"
+				}
+				parts = append(parts, text)
+				continue
+			}
+			parts = append(parts, cc.inlineOrArtifact(sess, name+".txt", "text/plain; charset=utf-8", c.Text, emit))
+		case mcp.ImageContent:
+			parts = append(parts, cc.saveBase64(sess, name, c.MIMEType, c.Data, emit))
+		case mcp.AudioContent:
+			parts = append(parts, cc.saveBase64(sess, name, c.MIMEType, c.Data, emit))
+		case mcp.EmbeddedResource:
+			switch res := c.Resource.(type) {
+			case mcp.TextResourceContents:
+				if n := path.Base(res.URI); n != "." && n != "/" {
+					name = n
+				}
+				mimeType := res.MIMEType
+				if mimeType == "" {
+					mimeType = "text/plain; charset=utf-8"
+				}
+				parts = append(parts, cc.inlineOrArtifact(sess, name, mimeType, res.Text, emit))
+			case mcp.BlobResourceContents:
+				if n := path.Base(res.URI); n != "." && n != "/" {
+					name = n
+				}
+				parts = append(parts, cc.saveBase64(sess, name, res.MIMEType, res.Blob, emit))
+			}
+		default:
+			b, _ := json.Marshal(content)
+			parts = append(parts, string(b))
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+func ephemeralText(contents []mcp.Content) string {
+	var parts []string
+	for _, content := range contents {
+		switch c := content.(type) {
+		case mcp.TextContent:
+			parts = append(parts, c.Text)
+		case mcp.ImageContent:
+			parts = append(parts, T(serverLocale, "prompt.ephemeral_binary", c.MIMEType))
+		case mcp.AudioContent:
+			parts = append(parts, T(serverLocale, "prompt.ephemeral_binary", c.MIMEType))
+		case mcp.EmbeddedResource:
+			switch res := c.Resource.(type) {
+			case mcp.TextResourceContents:
+				parts = append(parts, res.Text)
+			case mcp.BlobResourceContents:
+				parts = append(parts, T(serverLocale, "prompt.ephemeral_binary", res.MIMEType))
+			}
+		default:
+			b, _ := json.Marshal(content)
+			parts = append(parts, string(b))
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+// 超过该大小的 JSON 结果不推送给客户端
+const maxToolResultEvent = 64 << 10
+
+// jsonOutput 工具输出是 JSON 对象或数组时返回压缩和缩进两种形式
+func jsonOutput(text string) (compact, pretty string, ok bool) {
+	trimmed := strings.TrimSpace(text)
+	if trimmed == "" || (trimmed[0] != '{' && trimmed[0] != '[') {
+		return "", "", false
+	}
+	var c, p bytes.Buffer
+	if err := json.Compact(&c, []byte(trimmed)); err != nil {
+		return "", "", false
+	}
+	if err := json.Indent(&p, c.Bytes(), "", "  "); err != nil {
+		return "", "", false
+	}
+	return c.String(), p.String(), true
+}
+
+// truncateOutput 按工具配置的 maxOutputBytes 截断结果, 不截断半个 UTF-8 字符
+func truncateOutput(text string, max int) string {
+	if max <= 0 || len(text) <= max {
+		return text
+	}
+	cut := max
+	for cut > 0 && !utf8.RuneStart(text[cut]) {
+		cut--
+	}
+	return text[:cut] + fmt.Sprintf("\n[truncated, %d of %d bytes shown]", cut, len(text))
+}
+
+func (cc *ChatClient) inlineOrArtifact(sess *Session, name, mimeType, text string, emit func(*chat.ChatMessage)) string {
+	if cc.artifacts == nil || len(text) <= cc.artifacts.inlineLimit {
+		return text
+	}
+	a, err := cc.saveArtifact(sess, name, mimeType, []byte(text), emit)
+	if err != nil {
+		return text
+	}
+	preview := []rune(text)
+	if len(preview) > artifactPreviewLen {
+		preview = preview[:artifactPreviewLen]
+	}
+	return string(preview) + "\n" + T(serverLocale, "prompt.truncated", a.Name, a.Size)
+}
+
+func (cc *ChatClient) saveBase64(sess *Session, name, mimeType, data string, emit func(*chat.ChatMessage)) string {
+	if cc.artifacts == nil {
+		return T(serverLocale, "prompt.no_artifacts", mimeType)
+	}
+	raw, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return T(serverLocale, "prompt.decode_failed", mimeType, err)
+	}
+	if filepath.Ext(name) == "" {
+		if exts, _ := mime.ExtensionsByType(mimeType); len(exts) > 0 {
+			name += exts[0]
+		}
+	}
+	a, err := cc.saveArtifact(sess, name, mimeType, raw, emit)
+	if err != nil {
+		return T(serverLocale, "prompt.save_failed", err)
+	}
+	return T(serverLocale, "prompt.artifact_saved", a.Name, a.MimeType, a.Size)
+}
+
+func (cc *ChatClient) saveArtifact(sess *Session, name, mimeType string, data []byte, emit func(*chat.ChatMessage)) (*Artifact, error) {
+	if mimeType == "" {
+		mimeType = "application/octet-stream"
+	}
+	a, err := cc.artifacts.Save(sess.ID, name, mimeType, data)
+	if err != nil {
+		return nil, err
+	}
+	emit(&chat.ChatMessage{
+		Type:      "artifact",
+		SessionId: sess.ID,
+		Artifact: &chat.Artifact{
+			Id:       a.ID,
+			Name:     a.Name,
+			MimeType: a.MimeType,
+			Size:     a.Size,
+			Url:      a.URL(),
+		},
+	})
+	return a, nil
+}
@@ -0,0 +1,60 @@
+package host
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHandleArtifactOwnership(t *testing.T) {
+	artifacts, err := NewArtifactStore(&ArtifactsConfig{Dir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cc := &ChatClient{
+		auth:      &AuthConfig{UserHeader: "X-Forwarded-User", DefaultRole: RoleUser},
+		network:   newNetworkPolicy(&NetworkConfig{TrustedProxies: []string{"192.0.2.1"}}), // httptest 请求的来源地址
+		sessions:  NewSessionStore(nil),
+		artifacts: artifacts,
+	}
+	owned, err := artifacts.Save(cc.sessions.Create("alice").ID, "report.txt", "text/plain", []byte("alice's report"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	anonymous, err := artifacts.Save(cc.sessions.Create("").ID, "notes.txt", "text/plain", []byte("shared notes"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	orphan, err := artifacts.Save("0123456789abcdef0123456789abcdef", "old.txt", "text/plain", []byte("no session"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		id   string
+		user string
+		want int
+	}{
+		{"owner", owned.ID, "alice", http.StatusOK},
+		{"other user", owned.ID, "bob", http.StatusNotFound},
+		{"anonymous", owned.ID, "", http.StatusNotFound},
+		{"anonymous session", anonymous.ID, "bob", http.StatusOK},
+		{"session gone", orphan.ID, "alice", http.StatusNotFound},
+		{"unknown artifact", "ffffffffffffffffffffffffffffffff", "alice", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/api/artifacts/"+tt.id, nil)
+			r.SetPathValue("id", tt.id)
+			if tt.user != "" {
+				r.Header.Set("X-Forwarded-User", tt.user)
+			}
+			w := httptest.NewRecorder()
+			cc.handleArtifact(w, r)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+		})
+	}
+}
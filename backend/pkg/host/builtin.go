@@ -0,0 +1,70 @@
+package host
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/guobinqiu/mcp-host-web/pkg/tools"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// builtinPrefix 配置中 "type": "builtin:<名称>" 表示使用随程序打包或通过 RegisterServer 注册的 MCP 服务
+const builtinPrefix = "builtin:"
+
+// builtinServers 是在进程内运行的 MCP 服务, 不需要单独启动和管理进程
+var (
+	builtinMu      sync.RWMutex
+	builtinServers = map[string]func() *server.MCPServer{
+		"browser":      tools.NewBrowserServer,
+		"calculator":   tools.NewCalculatorServer,
+		"calendar":     tools.NewCalendarServer,
+		"code_sandbox": tools.NewSandboxServer,
+		"document":     tools.NewDocumentServer,
+		"email":        tools.NewEmailServer,
+		"finance":      tools.NewFinanceServer,
+		"git":          tools.NewGitServer,
+		"ip_location":  tools.NewIPLocationServer,
+		"k8s":          tools.NewK8sServer,
+		"news":         tools.NewNewsServer,
+		"prometheus":   tools.NewPrometheusServer,
+		"translate":    tools.NewTranslateServer,
+		"web_search":   tools.NewWebSearchServer,
+	}
+)
+
+// RegisterServer 注册 Go 实现的 MCP 服务, 配置中用 "type": "builtin:<name>" 引用, 通过进程内传输连接;
+// 每次连接调用一次 newServer。应在加载配置之前 (比如 init 中) 调用, 名称重复或 newServer 为 nil 时 panic
+func RegisterServer(name string, newServer func() *server.MCPServer) {
+	builtinMu.Lock()
+	defer builtinMu.Unlock()
+	if newServer == nil {
+		panic("host: RegisterServer " + name + " with nil newServer")
+	}
+	if _, ok := builtinServers[name]; ok {
+		panic("host: RegisterServer called twice for " + name)
+	}
+	builtinServers[name] = newServer
+}
+
+func lookupBuiltin(name string) func() *server.MCPServer {
+	builtinMu.RLock()
+	defer builtinMu.RUnlock()
+	return builtinServers[name]
+}
+
+// builtinName 从服务类型中取出内置服务的名称
+func builtinName(typ string) (string, bool) {
+	return strings.CutPrefix(typ, builtinPrefix)
+}
+
+func builtinNames() string {
+	builtinMu.RLock()
+	defer builtinMu.RUnlock()
+	names := make([]string, 0, len(builtinServers))
+	for name := range builtinServers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,207 @@
+package host
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+var cacheLookups = metrics.Counter("response_cache_lookups_total", "Number of semantic response cache lookups.", "result")
+
+const (
+	defaultCacheThreshold  = 0.95
+	defaultCacheTTL        = time.Hour
+	defaultCacheMaxEntries = 1000
+)
+
+// Embedder 把文本转换为向量, 用于语义缓存; *openai.Client 实现了这个接口
+type Embedder interface {
+	CreateEmbeddings(ctx context.Context, conv openai.EmbeddingRequestConverter) (openai.EmbeddingResponse, error)
+}
+
+// newEmbedderFromEnv 按环境变量 OPENAI_EMBEDDING_API_KEY / OPENAI_EMBEDDING_API_BASE 连接 embedding 接口,
+// 未设置时使用大模型的接口
+func newEmbedderFromEnv(apiKey, baseURL string) (Embedder, error) {
+	if v := os.Getenv("OPENAI_EMBEDDING_API_KEY"); v != "" {
+		apiKey = v
+	}
+	if v := os.Getenv("OPENAI_EMBEDDING_API_BASE"); v != "" {
+		baseURL = v
+	}
+	if apiKey == "" || baseURL == "" {
+		return nil, newError("cache.env_missing")
+	}
+	config := openai.DefaultConfig(apiKey)
+	config.BaseURL = baseURL
+	httpClient, err := newProxyHTTPClient(os.Getenv("OPENAI_API_PROXY"))
+	if err != nil {
+		return nil, err
+	}
+	if httpClient != nil {
+		config.HTTPClient = httpClient
+	}
+	return openai.NewClientWithConfig(config), nil
+}
+
+// cacheEntry 是一个缓存的回答, vector 是问题归一化后的向量
+type cacheEntry struct {
+	scope   string
+	vector  []float32
+	answer  string
+	created time.Time
+}
+
+// responseCache 是本副本内的语义缓存: 问题的向量和最近回答过的问题的余弦相似度达到 threshold 时直接使用当时的回答。
+// 回答可能依赖上下文和当时的工具结果, 只缓存会话的第一个问题, 并按模型、角色和回答语言分开
+type responseCache struct {
+	embedder  Embedder
+	model     openai.EmbeddingModel
+	threshold float64
+	ttl       time.Duration
+	max       int
+
+	mu      sync.Mutex
+	entries []cacheEntry // 按加入的时间排序
+}
+
+// newResponseCache 未配置 cache 时返回 nil
+func newResponseCache(cfg *CacheConfig, embedder Embedder) *responseCache {
+	if cfg == nil {
+		return nil
+	}
+	c := &responseCache{
+		embedder:  embedder,
+		model:     openai.SmallEmbedding3,
+		threshold: defaultCacheThreshold,
+		ttl:       defaultCacheTTL,
+		max:       defaultCacheMaxEntries,
+	}
+	if cfg.Model != "" {
+		c.model = openai.EmbeddingModel(cfg.Model)
+	}
+	if cfg.Threshold > 0 {
+		c.threshold = cfg.Threshold
+	}
+	if cfg.TTL > 0 {
+		c.ttl = time.Duration(cfg.TTL)
+	}
+	if cfg.MaxEntries > 0 {
+		c.max = cfg.MaxEntries
+	}
+	return c
+}
+
+// embed 返回问题归一化后的向量
+func (c *responseCache) embed(ctx context.Context, question string) ([]float32, error) {
+	resp, err := c.embedder.CreateEmbeddings(ctx, openai.EmbeddingRequestStrings{Input: []string{question}, Model: c.model})
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Data) == 0 || len(resp.Data[0].Embedding) == 0 {
+		return nil, newError("cache.empty_embedding")
+	}
+	v := resp.Data[0].Embedding
+	var norm float64
+	for _, x := range v {
+		norm += float64(x) * float64(x)
+	}
+	norm = math.Sqrt(norm)
+	if norm == 0 {
+		return nil, newError("cache.empty_embedding")
+	}
+	for i := range v {
+		v[i] = float32(float64(v[i]) / norm)
+	}
+	return v, nil
+}
+
+// lookup 返回同一范围内最相似且未过期的回答
+func (c *responseCache) lookup(scope string, vector []float32) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.expire(time.Now())
+	best, answer := c.threshold, ""
+	found := false
+	for _, e := range c.entries {
+		if e.scope != scope || len(e.vector) != len(vector) {
+			continue
+		}
+		var sim float64
+		for i := range vector {
+			sim += float64(vector[i]) * float64(e.vector[i])
+		}
+		if sim >= best {
+			best, answer, found = sim, e.answer, true
+		}
+	}
+	return answer, found
+}
+
+// store 加入回答, 超出 maxEntries 时淘汰最早的
+func (c *responseCache) store(scope string, vector []float32, answer string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	c.expire(now)
+	c.entries = append(c.entries, cacheEntry{scope: scope, vector: vector, answer: answer, created: now})
+	if n := len(c.entries) - c.max; n > 0 {
+		c.entries = c.entries[n:]
+	}
+}
+
+func (c *responseCache) expire(now time.Time) {
+	i := 0
+	for i < len(c.entries) && now.Sub(c.entries[i].created) > c.ttl {
+		i++
+	}
+	c.entries = c.entries[i:]
+}
+
+// cacheScope 返回本轮可以使用缓存时的范围 (模型、角色、回答语言和格式), 不能使用时返回 false: 只用于会话的第一个问题,
+// 使用用户记忆或附件、可以调用注入了用户身份的工具的对话回答因人而异, 候选回答模式要由用户挑选, 都不缓存
+func (cc *ChatClient) cacheScope(ctx context.Context, sess *Session, model string, candidates int) (string, bool) {
+	if cc.cache == nil || candidates > 1 || len(sess.History()) > 0 {
+		return "", false
+	}
+	if _, ok := cc.memoryOwner(sess.UserID()); ok {
+		return "", false
+	}
+	if _, ok := cc.uploads.attachmentsMessage(sess.ID); ok {
+		return "", false
+	}
+	if cc.injectsIdentity(roleFrom(ctx)) {
+		return "", false
+	}
+	p := sess.Preferences()
+	return fmt.Sprintf("%s\x00%s\x00%s\x00%s\x00%d", model, roleFrom(ctx), sess.Language(), p.Format, p.MaxLength), true
+}
+
+// injectsIdentity 角色可以使用的工具中有配置了 inject 的时返回 true, 这些工具的结果取决于当前用户或会话
+func (cc *ChatClient) injectsIdentity(role string) bool {
+	for _, c := range cc.servers() {
+		for tool, o := range c.Tools {
+			if len(o.Inject) > 0 && cc.toolAllowed(role, tool) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type cachedKey struct{}
+
+// withCachedFlag 让调用方得知本轮的回答是否来自缓存, ProcessQuery 使用缓存时把 *flag 设为 true
+func withCachedFlag(ctx context.Context, flag *bool) context.Context {
+	return context.WithValue(ctx, cachedKey{}, flag)
+}
+
+func markCached(ctx context.Context) {
+	if flag, ok := ctx.Value(cachedKey{}).(*bool); ok {
+		*flag = true
+	}
+}
@@ -0,0 +1,43 @@
+package host
+
+import (
+	"context"
+	"testing"
+)
+
+func TestCacheScopeInjectedTools(t *testing.T) {
+	uploads, err := NewUploadStore(&UploadsConfig{Dir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth := &AuthConfig{DefaultRole: RoleUser, Roles: map[string]RoleConfig{RoleUser: {Tools: []string{"get_*"}}}}
+	tests := []struct {
+		name      string
+		tools     map[string]ToolOverride
+		role      string
+		cacheable bool
+	}{
+		{"no overrides", nil, RoleUser, true},
+		{"defaults only", map[string]ToolOverride{"get_weather": {Defaults: map[string]any{"unit": "c"}}}, RoleUser, true},
+		{"injected user", map[string]ToolOverride{"get_orders": {Inject: map[string]string{"customer": InjectUserID}}}, RoleUser, false},
+		{"injected token", map[string]ToolOverride{"get_profile": {Inject: map[string]string{"token": InjectAuthToken}}}, RoleAdmin, false},
+		// 角色不能使用的工具不会在本轮调用
+		{"injected but not allowed", map[string]ToolOverride{"delete_orders": {Inject: map[string]string{"customer": InjectUserID}}}, RoleUser, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cc := &ChatClient{
+				auth:       auth,
+				cache:      newResponseCache(&CacheConfig{}, nil),
+				uploads:    uploads,
+				sessions:   NewSessionStore(nil),
+				mcpClients: []*MCPClient{{Name: "shop", Tools: tt.tools}},
+			}
+			sess := cc.sessions.Create("alice")
+			ctx := context.WithValue(context.Background(), roleKey{}, tt.role)
+			if _, ok := cc.cacheScope(ctx, sess, "gpt", 1); ok != tt.cacheable {
+				t.Errorf("cacheable = %v, want %v", ok, tt.cacheable)
+			}
+		})
+	}
+}
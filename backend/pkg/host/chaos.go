@@ -0,0 +1,87 @@
+package host
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"os"
+	"time"
+)
+
+var chaosInjected = metrics.Counter("chaos_injected_total", "Number of faults injected by the chaos mode.", "kind")
+
+// 慢工具缺省的延迟
+const defaultChaosDelay = 5 * time.Second
+
+// 注入的故障, 也是 chaos_injected_total 的 kind 标签
+const (
+	chaosToolFailure = "tool_failure"
+	chaosSlowTool    = "slow_tool"
+	chaosDropFrame   = "drop_frame"
+	chaosDisconnect  = "disconnect"
+)
+
+// 注入的错误, 日志中可以据此和真实故障区分
+var (
+	errChaosToolFailure = errors.New("chaos: injected tool failure")
+	errChaosDisconnect  = errors.New("chaos: injected disconnect")
+)
+
+// chaosInjector 按配置的比例随机注入故障, 用于在压力下验证重试、连接池健康检查和断线重连;
+// 为 nil 时不注入任何故障
+type chaosInjector struct {
+	cfg ChaosConfig
+}
+
+// newChaosInjector 未配置 chaos 时返回 nil; APP_ENV=prod 时忽略配置, 避免测试配置带到生产环境
+func newChaosInjector(cfg *ChaosConfig) *chaosInjector {
+	if cfg == nil {
+		return nil
+	}
+	if os.Getenv(appEnvVar) == "prod" {
+		logf("chaos.ignored", appEnvVar)
+		return nil
+	}
+	logf("chaos.enabled", cfg.ToolFailureRate, cfg.SlowToolRate, cfg.DropFrameRate, cfg.DisconnectRate)
+	return &chaosInjector{cfg: *cfg}
+}
+
+func (c *chaosInjector) hit(rate float64, kind string) bool {
+	if rate <= 0 || rand.Float64() >= rate {
+		return false
+	}
+	chaosInjected.Inc(kind)
+	return true
+}
+
+// beforeToolCall 在工具调用前随机延迟或直接失败
+func (c *chaosInjector) beforeToolCall(ctx context.Context) error {
+	if c == nil {
+		return nil
+	}
+	if c.hit(c.cfg.SlowToolRate, chaosSlowTool) {
+		delay := time.Duration(c.cfg.SlowToolDelay)
+		if delay <= 0 {
+			delay = defaultChaosDelay
+		}
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if c.hit(c.cfg.ToolFailureRate, chaosToolFailure) {
+		return errChaosToolFailure
+	}
+	return nil
+}
+
+// dropFrame 为 true 时丢弃这条 WebSocket 消息 (假装已发送), 客户端启用确认时 outbox 会在重连后重发
+func (c *chaosInjector) dropFrame() bool {
+	return c != nil && c.hit(c.cfg.DropFrameRate, chaosDropFrame)
+}
+
+// disconnect 为 true 时在发送消息前断开连接, 用来验证客户端的断线重连
+func (c *chaosInjector) disconnect() bool {
+	return c != nil && c.hit(c.cfg.DisconnectRate, chaosDisconnect)
+}
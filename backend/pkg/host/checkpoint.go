@@ -0,0 +1,183 @@
+package host
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// 每个会话最多保留的检查点, 超过时丢弃最早的
+const maxCheckpoints = 20
+
+// Checkpoint 记录会话在某一时刻的状态, 回滚时删除之后的消息, 并把草稿和用户的记忆恢复为当时的内容
+type Checkpoint struct {
+	Name      string    `json:"name"`
+	Messages  int       `json:"messages"` // 创建时的消息数, 回滚后只保留这些消息
+	Memories  int       `json:"memories"` // 快照中的记忆条数, 未启用记忆时为 0
+	CreatedAt time.Time `json:"created_at"`
+
+	scratchpad string
+	memories   []Fact // 为 nil 时没有记忆快照, 回滚时不改动记忆
+}
+
+// SaveCheckpoint 在当前位置保存检查点, 同名的检查点被替换
+func (s *Session) SaveCheckpoint(cp Checkpoint) Checkpoint {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cp.Messages, cp.scratchpad = len(s.messages), s.scratchpad
+	s.checkpoints = slices.DeleteFunc(s.checkpoints, func(c Checkpoint) bool { return c.Name == cp.Name })
+	s.checkpoints = append(s.checkpoints, cp)
+	if len(s.checkpoints) > maxCheckpoints {
+		s.checkpoints = slices.Delete(s.checkpoints, 0, len(s.checkpoints)-maxCheckpoints)
+	}
+	return cp
+}
+
+// Checkpoints 按创建顺序返回会话的检查点
+func (s *Session) Checkpoints() []Checkpoint {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]Checkpoint{}, s.checkpoints...)
+}
+
+func (s *Session) checkpoint(name string) (Checkpoint, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	i := slices.IndexFunc(s.checkpoints, func(c Checkpoint) bool { return c.Name == name })
+	if i < 0 {
+		return Checkpoint{}, false
+	}
+	return s.checkpoints[i], true
+}
+
+// DeleteCheckpoint 删除检查点, 不存在时返回 false
+func (s *Session) DeleteCheckpoint(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := len(s.checkpoints)
+	s.checkpoints = slices.DeleteFunc(s.checkpoints, func(c Checkpoint) bool { return c.Name == name })
+	return len(s.checkpoints) < n
+}
+
+// rollback 删除检查点之后的消息 (包括持久化存储和搜索索引中的) 并恢复草稿, 返回删除的消息数。
+// 之后创建的检查点、固定的消息和等待挑选的候选回答一并丢弃。存储不支持删除消息时返回错误, 会话不变
+func (s *Session) rollback(cp Checkpoint) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := cp.Messages
+	removed := max(len(s.messages)-n, 0)
+	if removed > 0 {
+		if s.store != nil {
+			ts, ok := s.store.(TruncatableHistoryStore)
+			if !ok {
+				return 0, newError("checkpoint.unsupported_store")
+			}
+			if err := ts.Truncate(s.ID, n); err != nil {
+				return 0, err
+			}
+		}
+		if ix, ok := s.index.(TruncatableIndex); ok {
+			if err := ix.Truncate(s.ID, n); err != nil {
+				logf("search.index_failed", s.ID, err)
+			}
+		}
+		s.messages = slices.Clip(s.messages[:n])
+		for i := range s.pins {
+			if i >= n {
+				delete(s.pins, i)
+			}
+		}
+	}
+	s.scratchpad = cp.scratchpad
+	s.choices = nil
+	s.checkpoints = slices.DeleteFunc(s.checkpoints, func(c Checkpoint) bool { return c.Messages > n })
+	return removed, nil
+}
+
+// rollbackSession 等待正在进行的一轮对话结束后回滚到检查点, 有记忆快照时同时恢复用户的记忆
+func (cc *ChatClient) rollbackSession(r *http.Request, sess *Session, cp Checkpoint) (int, error) {
+	end, err := cc.sessions.BeginTurn(r.Context(), sess)
+	if err != nil {
+		return 0, err
+	}
+	defer end()
+	removed, err := sess.rollback(cp)
+	if err != nil {
+		return 0, err
+	}
+	if owner, ok := cc.memoryOwner(sess.UserID()); ok && cp.memories != nil {
+		if err := cc.memory.Replace(owner, cp.memories); err != nil {
+			return 0, err
+		}
+	}
+	return removed, nil
+}
+
+// GET /api/sessions/{id}/checkpoints 列出检查点
+// POST /api/sessions/{id}/checkpoints {"name": "before-refactor"} 在当前位置创建检查点, 同名的被替换
+// DELETE /api/sessions/{id}/checkpoints/{name} 删除检查点
+// POST /api/sessions/{id}/checkpoints/{name}/rollback 回滚到检查点
+func (cc *ChatClient) handleCheckpoints(w http.ResponseWriter, r *http.Request) {
+	sess, ok := cc.sessionFor(r, r.PathValue("id"))
+	if !ok {
+		writeError(w, r, http.StatusNotFound, "api.session_not_found")
+		return
+	}
+	name := r.PathValue("name")
+	if name == "" {
+		switch r.Method {
+		case http.MethodGet:
+			writeJSON(w, http.StatusOK, map[string]any{"checkpoints": sess.Checkpoints()})
+		case http.MethodPost:
+			var body struct {
+				Name string `json:"name"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				writeError(w, r, http.StatusBadRequest, "api.bad_request", err)
+				return
+			}
+			if !promptNamePattern.MatchString(body.Name) {
+				writeError(w, r, http.StatusBadRequest, "api.checkpoint_invalid_name")
+				return
+			}
+			cp := Checkpoint{Name: body.Name, CreatedAt: time.Now().UTC()}
+			if owner, ok := cc.memoryOwner(sess.UserID()); ok {
+				facts, err := cc.memory.List(owner)
+				if err != nil {
+					logf("memory.load_failed", err)
+					writeError(w, r, http.StatusInternalServerError, "error.request_failed")
+					return
+				}
+				cp.memories, cp.Memories = facts, len(facts)
+			}
+			writeJSON(w, http.StatusCreated, sess.SaveCheckpoint(cp))
+		default:
+			writeError(w, r, http.StatusMethodNotAllowed, "api.method_not_allowed")
+		}
+		return
+	}
+
+	cp, ok := sess.checkpoint(name)
+	if !ok {
+		writeError(w, r, http.StatusNotFound, "api.checkpoint_not_found", name)
+		return
+	}
+	switch {
+	case strings.HasSuffix(r.URL.Path, "/rollback") && r.Method == http.MethodPost:
+		removed, err := cc.rollbackSession(r, sess, cp)
+		if err != nil {
+			logf("checkpoint.rollback_failed", sess.ID, name, err)
+			writeError(w, r, http.StatusInternalServerError, "error.request_failed")
+			return
+		}
+		logf("checkpoint.rolled_back", sess.ID, name, removed)
+		writeJSON(w, http.StatusOK, map[string]any{"checkpoint": cp, "removed": removed})
+	case !strings.HasSuffix(r.URL.Path, "/rollback") && r.Method == http.MethodDelete:
+		sess.DeleteCheckpoint(name)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, r, http.StatusMethodNotAllowed, "api.method_not_allowed")
+	}
+}
@@ -0,0 +1,131 @@
+package host
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// 加密后的内容以该前缀开头, 方便和旧的明文记录区分
+const encryptedPrefix = "enc:v1:"
+
+// ContentCipher 使用 AES-GCM 加密历史消息中的内容
+type ContentCipher struct {
+	aead cipher.AEAD
+}
+
+func NewContentCipher(key []byte) (*ContentCipher, error) {
+	if len(key) != 32 {
+		return nil, newError("cipher.key_size", len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &ContentCipher{aead: aead}, nil
+}
+
+// LoadEncryptionKey 按配置从环境变量、文件或外部命令 (比如 KMS 解密) 读取 base64 编码的密钥
+func LoadEncryptionKey(cfg *EncryptionConfig) ([]byte, error) {
+	var encoded []byte
+	switch {
+	case cfg.KeyEnv != "":
+		encoded = []byte(os.Getenv(cfg.KeyEnv))
+		if len(encoded) == 0 {
+			return nil, newError("cipher.env_unset", cfg.KeyEnv)
+		}
+	case cfg.KeyFile != "":
+		data, err := os.ReadFile(cfg.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		encoded = data
+	case len(cfg.KeyCommand) > 0:
+		var stderr bytes.Buffer
+		cmd := exec.Command(cfg.KeyCommand[0], cfg.KeyCommand[1:]...)
+		cmd.Stderr = &stderr
+		out, err := cmd.Output()
+		if err != nil {
+			return nil, newError("cipher.key_command", err, strings.TrimSpace(stderr.String()))
+		}
+		encoded = out
+	default:
+		return nil, newError("cipher.no_source")
+	}
+
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(encoded)))
+	if err != nil {
+		return nil, newError("cipher.bad_base64", err)
+	}
+	return key, nil
+}
+
+func (c *ContentCipher) Encrypt(plain string) (string, error) {
+	if plain == "" {
+		return "", nil
+	}
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := c.aead.Seal(nonce, nonce, []byte(plain), nil)
+	return encryptedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt 解密内容, 未加密的旧记录原样返回
+func (c *ContentCipher) Decrypt(s string) (string, error) {
+	if !strings.HasPrefix(s, encryptedPrefix) {
+		return s, nil
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(s, encryptedPrefix))
+	if err != nil {
+		return "", err
+	}
+	n := c.aead.NonceSize()
+	if len(sealed) < n {
+		return "", newError("cipher.bad_ciphertext")
+	}
+	plain, err := c.aead.Open(nil, sealed[:n], sealed[n:], nil)
+	if err != nil {
+		return "", newError("cipher.decrypt_failed")
+	}
+	return string(plain), nil
+}
+
+// EncryptMessage 加密消息内容和工具调用参数, 角色、时间等元数据保持明文
+func (c *ContentCipher) EncryptMessage(m HistoryMessage) (HistoryMessage, error) {
+	return c.transform(m, c.Encrypt)
+}
+
+func (c *ContentCipher) DecryptMessage(m HistoryMessage) (HistoryMessage, error) {
+	return c.transform(m, c.Decrypt)
+}
+
+func (c *ContentCipher) transform(m HistoryMessage, fn func(string) (string, error)) (HistoryMessage, error) {
+	var err error
+	if m.Content, err = fn(m.Content); err != nil {
+		return m, err
+	}
+	if len(m.ToolCalls) > 0 {
+		calls := make([]openai.ToolCall, len(m.ToolCalls))
+		copy(calls, m.ToolCalls)
+		for i := range calls {
+			if calls[i].Function.Arguments, err = fn(calls[i].Function.Arguments); err != nil {
+				return m, err
+			}
+		}
+		m.ToolCalls = calls
+	}
+	return m, nil
+}
@@ -0,0 +1,85 @@
+package host
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/sashabaranov/go-openai"
+)
+
+const clockServerName = "clock"
+
+// clientInfo 是客户端连接时声明的时区和语言, 用于回答 "现在几点"、"明天是几号" 之类的问题
+type clientInfo struct {
+	loc    *time.Location
+	locale string
+}
+
+type clientInfoKey struct{}
+
+func withClientInfo(ctx context.Context, info clientInfo) context.Context {
+	return context.WithValue(ctx, clientInfoKey{}, info)
+}
+
+// clientInfoFrom 取 ctx 中的客户端信息, 没有时使用服务端的时区和语言
+func clientInfoFrom(ctx context.Context) clientInfo {
+	if info, ok := ctx.Value(clientInfoKey{}).(clientInfo); ok {
+		return info
+	}
+	return clientInfo{loc: time.Local, locale: serverLocale}
+}
+
+// loadTimezone 解析 IANA 时区名 (比如 Asia/Shanghai), 为空或无效时使用服务端时区
+func loadTimezone(name string) *time.Location {
+	if name == "" {
+		return time.Local
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		logf("clock.bad_timezone", name, err)
+		return time.Local
+	}
+	return loc
+}
+
+// clockMessage 把当前时间、用户时区和语言作为系统消息提供给大模型
+// 只精确到分钟, 同一分钟内的请求上下文不变
+func clockMessage(ctx context.Context) openai.ChatCompletionMessage {
+	info := clientInfoFrom(ctx)
+	now := time.Now().In(info.loc)
+	return openai.ChatCompletionMessage{
+		Role:    openai.ChatMessageRoleSystem,
+		Content: T(info.locale, "clock.prompt", now.Format("2006-01-02 15:04 Monday -07:00"), info.loc.String(), info.locale),
+	}
+}
+
+// newClockClient 在进程内的 MCP 服务上提供 get_current_time 工具
+func newClockClient() (*MCPClient, error) {
+	s := server.NewMCPServer(clockServerName, "1.0.0")
+	s.AddTool(mcp.NewTool("get_current_time",
+		mcp.WithDescription("获取当前的日期和时间, 缺省使用用户的时区"),
+		mcp.WithString("timezone", mcp.Description("IANA 时区名, 比如 Asia/Shanghai, America/New_York")),
+	), func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		loc := clientInfoFrom(ctx).loc
+		if name := req.GetString("timezone", ""); name != "" {
+			l, err := time.LoadLocation(name)
+			if err != nil {
+				return mcp.NewToolResultError("unknown timezone " + name), nil
+			}
+			loc = l
+		}
+		now := time.Now().In(loc)
+		b, _ := json.Marshal(map[string]any{
+			"time":     now.Format(time.RFC3339),
+			"timezone": loc.String(),
+			"weekday":  now.Weekday().String(),
+			"unix":     now.Unix(),
+		})
+		return mcp.NewToolResultText(string(b)), nil
+	})
+
+	return newInProcessMCPClient(clockServerName, s)
+}
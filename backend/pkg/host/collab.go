@@ -0,0 +1,108 @@
+package host
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// 多人会话: 会话所有者可以邀请其他登录用户参与同一个对话, 每条用户消息记录发送者 (sender),
+// 发给大模型时放在消息的 name 中, 并用一条系统消息说明有哪些参与者
+
+type senderKey struct{}
+
+// withSender 记录本轮对话的发送者, 匿名时为空
+func withSender(ctx context.Context, user string) context.Context {
+	return context.WithValue(ctx, senderKey{}, user)
+}
+
+func senderFrom(ctx context.Context) string {
+	user, _ := ctx.Value(senderKey{}).(string)
+	return user
+}
+
+var nameUnsafe = regexp.MustCompile(`[^a-zA-Z0-9_-]+`)
+
+// senderName 把用户标识转换为大模型接口允许的 name (字母、数字、下划线和连字符, 最多 64 个字符),
+// 比如 alice@example.com 转换为 alice_example_com
+func senderName(user string) string {
+	name := strings.Trim(nameUnsafe.ReplaceAllString(user, "_"), "_")
+	if len(name) > 64 {
+		name = name[:64]
+	}
+	if name == "" {
+		return "user"
+	}
+	return name
+}
+
+// participantsMessage 多人会话中告诉大模型有哪些参与者, 以及如何区分发送者
+func participantsMessage(sess *Session) (openai.ChatCompletionMessage, bool) {
+	participants := sess.Participants()
+	if len(participants) == 0 {
+		return openai.ChatCompletionMessage{}, false
+	}
+	names := []string{}
+	if owner := sess.UserID(); owner != "" {
+		names = append(names, senderName(owner))
+	}
+	for _, p := range participants {
+		names = append(names, senderName(p))
+	}
+	return openai.ChatCompletionMessage{
+		Role:    openai.ChatMessageRoleSystem,
+		Content: T(serverLocale, "prompt.participants", strings.Join(names, ", ")),
+	}, true
+}
+
+// GET /api/sessions/{id}/participants 列出会话的所有者和参与者
+// POST /api/sessions/{id}/participants {"user": "bob"} 邀请用户参与对话
+// DELETE /api/sessions/{id}/participants/{user} 移除参与者
+// 只有会话所有者和 admin 可以修改参与者, 匿名会话不支持
+func (cc *ChatClient) handleParticipants(w http.ResponseWriter, r *http.Request) {
+	sess, ok := cc.sessionFor(r, r.PathValue("id"))
+	if !ok {
+		writeError(w, r, http.StatusNotFound, "api.session_not_found")
+		return
+	}
+	owner := sess.UserID()
+	if r.Method == http.MethodGet {
+		writeJSON(w, http.StatusOK, map[string]any{"owner": owner, "participants": sess.Participants()})
+		return
+	}
+	if owner == "" {
+		writeError(w, r, http.StatusBadRequest, "api.session_anonymous")
+		return
+	}
+	if owner != cc.userID(r) && cc.role(r) != RoleAdmin {
+		writeError(w, r, http.StatusForbidden, "api.forbidden")
+		return
+	}
+	switch r.Method {
+	case http.MethodPost:
+		var body struct {
+			User string `json:"user"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeError(w, r, http.StatusBadRequest, "api.bad_request", err)
+			return
+		}
+		user := strings.TrimSpace(body.User)
+		if user == "" || user == owner {
+			writeError(w, r, http.StatusBadRequest, "api.bad_participant", body.User)
+			return
+		}
+		sess.AddParticipant(user)
+		logf("session.participant_added", sess.ID, user)
+		writeJSON(w, http.StatusOK, map[string]any{"owner": owner, "participants": sess.Participants()})
+	case http.MethodDelete:
+		sess.RemoveParticipant(r.PathValue("user"))
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, r, http.StatusMethodNotAllowed, "api.method_not_allowed")
+	}
+}
@@ -0,0 +1,54 @@
+package host
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"net/http"
+
+	"github.com/gorilla/websocket"
+	"github.com/guobinqiu/mcp-host-web/chat"
+)
+
+// upgrade 升级为 WebSocket 连接, 握手的 Origin 见 checkOrigin; 配置了 compression.websocket 时协商 permessage-deflate
+// 客户端不支持时退回不压缩
+func (cc *ChatClient) upgrade(w http.ResponseWriter, r *http.Request) (*websocket.Conn, error) {
+	u := upgrader
+	u.CheckOrigin = cc.checkOrigin
+	c := cc.compression
+	if c == nil || !c.WebSocket {
+		return u.Upgrade(w, r, nil)
+	}
+	u.EnableCompression = true
+	ws, err := u.Upgrade(w, r, nil)
+	if err != nil {
+		return nil, err
+	}
+	level := c.Level
+	if level == 0 {
+		level = flate.BestSpeed
+	}
+	if err := ws.SetCompressionLevel(level); err != nil {
+		ws.Close()
+		return nil, err
+	}
+	return ws, nil
+}
+
+// compressContent 把超过阈值的 content 用 gzip 压缩后放到 content_gzip, 压缩后没有变小时保持原样
+func compressContent(msg *chat.ChatMessage, threshold int) *chat.ChatMessage {
+	if threshold <= 0 || len(msg.Content) <= threshold {
+		return msg
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write([]byte(msg.Content)); err != nil {
+		return msg
+	}
+	if err := zw.Close(); err != nil || buf.Len() >= len(msg.Content) {
+		return msg
+	}
+	msg.ContentGzip = buf.Bytes()
+	msg.Content = ""
+	return msg
+}
@@ -0,0 +1,1262 @@
+package host
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+type MCPConfig struct {
+	Locale       string                `json:"locale,omitempty"`   // 日志和错误信息的语言, 缺省为 zh
+	LogLevel     string                `json:"logLevel,omitempty"` // 带级别的日志 (比如 stdio 服务的 stderr) 的最低级别, 缺省 info
+	MCPServers   map[string]MCPServer  `json:"mcpServers"`
+	History      *HistoryConfig        `json:"history,omitempty"`
+	Artifacts    *ArtifactsConfig      `json:"artifacts,omitempty"`
+	Uploads      *UploadsConfig        `json:"uploads,omitempty"`
+	PolicyFile   string                `json:"policyFile,omitempty"` // 内容过滤规则文件, 相对路径按配置文件所在目录解析
+	Experiments  []ExperimentConfig    `json:"experiments,omitempty"`
+	Pricing      map[string]ModelPrice `json:"pricing,omitempty"` // 按模型名配置价格, 用于估算每轮对话的费用
+	Events       *EventsConfig         `json:"events,omitempty"`
+	RateLimit    *RateLimitConfig      `json:"rateLimit,omitempty"` // 大模型请求限流, 按服务商配额填写
+	Search       *SearchConfig         `json:"search,omitempty"`
+	Auth         *AuthConfig           `json:"auth,omitempty"`
+	Memory       *MemoryConfig         `json:"memory,omitempty"`
+	Prompts      *PromptsConfig        `json:"prompts,omitempty"`
+	TurnTimeout  Duration              `json:"turnTimeout,omitempty"`    // 每轮对话的总超时, 缺省 60s
+	SessionIdle  Duration              `json:"sessionIdleTTL,omitempty"` // 没有连接的会话空闲多久后移出内存, 缺省不移出
+	Workflows    []WorkflowConfig      `json:"workflows,omitempty"`
+	Language     *LanguageConfig       `json:"language,omitempty"`
+	Response     *ResponseConfig       `json:"response,omitempty"`
+	Compression  *CompressionConfig    `json:"compression,omitempty"`
+	ToolSchema   string                `json:"toolSchema,omitempty"` // 工具参数 schema 的方言: openai | basic | gemini, 缺省按接口地址推断
+	HealthCheck  *HealthCheckConfig    `json:"healthCheck,omitempty"`
+	Context      *ContextConfig        `json:"context,omitempty"`
+	Scratchpad   *ScratchpadConfig     `json:"scratchpad,omitempty"`
+	ToolHints    *ToolHintsConfig      `json:"toolHints,omitempty"`
+	Chaos        *ChaosConfig          `json:"chaos,omitempty"` // 只用于测试, APP_ENV=prod 时忽略
+	Connections  *ConnectionsConfig    `json:"connections,omitempty"`
+	Network      *NetworkConfig        `json:"network,omitempty"`
+	Resume       *ResumeConfig         `json:"resume,omitempty"`
+	Digest       *DigestConfig         `json:"digest,omitempty"`
+	Startup      *StartupConfig        `json:"startup,omitempty"`
+	ConfigSource *ConfigSourceConfig   `json:"configSource,omitempty"`
+	Cache        *CacheConfig          `json:"cache,omitempty"`
+	Verification *VerificationConfig   `json:"verification,omitempty"`
+	LeakGuard    *LeakGuardConfig      `json:"leakGuard,omitempty"`
+	Analytics    *AnalyticsConfig      `json:"analytics,omitempty"`
+	Demo         *DemoConfig           `json:"demo,omitempty"`
+	ToolBudget   *ToolBudgetConfig     `json:"toolBudget,omitempty"`
+	Purge        *PurgeConfig          `json:"purge,omitempty"`
+
+	file     string   // 配置文件的路径
+	envNames []string // 配置中引用的环境变量名
+}
+
+// DemoConfig 开启演示模式: 工具照常列出但不会执行, 调用时返回 result; token 用量限制得很小, 用于公开演示
+type DemoConfig struct {
+	Result          string `json:"result,omitempty"`          // 代替工具结果交给大模型的文字, 缺省说明这是演示、工具没有执行
+	MaxTokensPerDay int    `json:"maxTokensPerDay,omitempty"` // 每个用户 (匿名时每个会话) 每天的 token 上限, 缺省 5000; 角色配置了更小的上限时以角色为准
+	MaxTokens       int    `json:"maxTokens,omitempty"`       // 每次调用大模型最多生成的 token 数, 缺省 500
+}
+
+// ToolBudgetConfig 限制每轮对话的工具调用, 用完后由大模型根据已有的结果回答; 两项都为 0 时不限制
+type ToolBudgetConfig struct {
+	MaxCalls    int      `json:"maxCalls,omitempty"`    // 每轮最多调用工具的次数, 包括失败的调用
+	MaxDuration Duration `json:"maxDuration,omitempty"` // 每轮工具调用的累计耗时, 比如 "60s"; 单次调用的超时也不超过剩下的时间
+}
+
+// PurgeConfig 开启用户数据的软删除: 清除请求先隐藏用户的数据, 保留 retention 后彻底删除, 在此之前可以恢复
+type PurgeConfig struct {
+	Retention Duration `json:"retention"`      // 软删除后保留的时间, 比如 "720h"
+	File      string   `json:"file,omitempty"` // 记录等待清除的用户, 缺省为 data/purges.json; 多副本时放在共享存储上
+}
+
+// AnalyticsConfig 开启工具调用统计: 各工具的调用次数、成功率、耗时和触发调用的常见问题, 定期导出为 csv 文件
+type AnalyticsConfig struct {
+	Dir        string   `json:"dir,omitempty"`        // 导出目录, 缺省为 data/analytics
+	Interval   Duration `json:"interval,omitempty"`   // 导出间隔, 缺省 24h
+	TopPrompts int      `json:"topPrompts,omitempty"` // 每个工具保留的常见问题数, 缺省 10
+}
+
+// LeakGuardConfig 开启回答的泄露检查: 回答中出现的内部接口地址、配置文件和数据目录的路径、环境变量名替换为 replacement
+type LeakGuardConfig struct {
+	Extra       []string `json:"extra,omitempty"`       // 其他不能出现在回答中的内容, 比如内部域名
+	Replacement string   `json:"replacement,omitempty"` // 缺省 ****
+}
+
+// VerificationConfig 开启回答核对: 本轮调用过工具时, 再用一次大模型对照原始的工具结果检查最终回答,
+// 有矛盾时改正回答, 无法确定时在回答消息中标记 low_confidence
+type VerificationConfig struct {
+	Model string `json:"model,omitempty"` // 核对使用的模型, 缺省为对话使用的模型
+}
+
+// CacheConfig 开启语义缓存: 会话的第一个问题和最近回答过的问题足够相似时直接返回当时的回答, 不再调用大模型
+type CacheConfig struct {
+	Threshold  float64  `json:"threshold,omitempty"`  // 余弦相似度达到该值才算相同的问题, 缺省 0.95
+	TTL        Duration `json:"ttl,omitempty"`        // 回答的有效期, 缺省 1h
+	MaxEntries int      `json:"maxEntries,omitempty"` // 最多缓存的回答数, 超出时淘汰最早的, 缺省 1000
+	Model      string   `json:"model,omitempty"`      // embedding 模型, 缺省 text-embedding-3-small
+}
+
+// ConfigSourceConfig 从 etcd 或 Consul 读取 MCP 服务配置并监听变更, 用于集中管理多个副本的配置。
+// key 的值和配置文件的格式相同, 只使用其中的 mcpServers, 和配置文件中的服务合并, 同名时以远程配置为准
+type ConfigSourceConfig struct {
+	Backend string `json:"backend"`         // etcd | consul
+	Address string `json:"address"`         // 比如 http://127.0.0.1:2379 (etcd v3 的 JSON 网关) 或 http://127.0.0.1:8500
+	Key     string `json:"key"`             // 保存配置的 key
+	Token   string `json:"token,omitempty"` // Consul 的 ACL 令牌或 etcd 的认证令牌, 可以写成 {"fromEnv": "X"} 等引用
+}
+
+// StartupConfig 控制 serve 启动时的自检
+type StartupConfig struct {
+	SkipSelfTest    bool     `json:"skipSelfTest,omitempty"`    // 不检查大模型和 MCP 服务, 直接启动
+	SelfTestTimeout Duration `json:"selfTestTimeout,omitempty"` // 自检的超时, 缺省 30s
+	RequireServers  bool     `json:"requireServers,omitempty"`  // 有 MCP 服务连接失败时不启动; 缺省跳过失败的服务, 全部失败时只和大模型对话
+}
+
+// DigestConfig 定期汇总有新消息的会话, 摘要按天保存为 jsonl 文件
+type DigestConfig struct {
+	Interval    Duration `json:"interval,omitempty"`    // 汇总间隔, 缺省 24h
+	Dir         string   `json:"dir,omitempty"`         // 缺省为 data/digests
+	Model       string   `json:"model,omitempty"`       // 汇总使用的模型, 缺省为对话使用的模型
+	MinMessages int      `json:"minMessages,omitempty"` // 这段时间内的消息达到该数量才汇总, 缺省 2
+}
+
+// ResumeConfig 配置会话转移令牌, 多副本部署时各副本要使用相同的 secret
+type ResumeConfig struct {
+	Secret string   `json:"secret,omitempty"` // 签名密钥, 可以写成 {"fromEnv": "X"} 等引用; 缺省每次启动随机生成
+	TTL    Duration `json:"ttl,omitempty"`    // 令牌有效期, 缺省 10m
+}
+
+// NetworkConfig 配置反向代理和来源 IP 的访问控制, 条目可以是 IP 地址或 CIDR 网段
+type NetworkConfig struct {
+	TrustedProxies []string        `json:"trustedProxies,omitempty"` // 只有来自这些地址的 X-Forwarded-For、X-Real-IP 才被采信
+	WebSocket      *IPAccessConfig `json:"webSocket,omitempty"`      // /ws
+	Admin          *IPAccessConfig `json:"admin,omitempty"`          // 需要 admin 角色的接口, 比如 /metrics、/debug/*
+}
+
+// IPAccessConfig 是一组接口的 IP 访问控制: 命中 deny 的拒绝, allow 不为空时只允许其中的地址
+type IPAccessConfig struct {
+	Allow []string `json:"allow,omitempty"`
+	Deny  []string `json:"deny,omitempty"`
+}
+
+// ConnectionsConfig 限制同时打开的 WebSocket 连接数, 0 表示不限制
+type ConnectionsConfig struct {
+	MaxTotal   int `json:"maxTotal,omitempty"`   // 所有连接
+	MaxPerUser int `json:"maxPerUser,omitempty"` // 每个用户, 匿名连接不按用户限制
+	MaxPerIP   int `json:"maxPerIP,omitempty"`   // 每个来源 IP
+}
+
+// ChaosConfig 按比例 (0 到 1) 随机注入故障, 用于验证重试、连接池健康检查和断线重连
+type ChaosConfig struct {
+	ToolFailureRate float64  `json:"toolFailureRate,omitempty"` // 工具调用直接失败的比例
+	SlowToolRate    float64  `json:"slowToolRate,omitempty"`    // 工具调用先延迟 slowToolDelay 的比例
+	SlowToolDelay   Duration `json:"slowToolDelay,omitempty"`   // 缺省 5s
+	DropFrameRate   float64  `json:"dropFrameRate,omitempty"`   // 丢弃发往客户端的 WebSocket 消息的比例
+	DisconnectRate  float64  `json:"disconnectRate,omitempty"`  // 发送消息前断开 WebSocket 连接的比例
+}
+
+// ToolHintsConfig 按最近的实际调用在工具描述后附上耗时、结果大小和失败比例, 帮助大模型在可替代的工具中做选择
+type ToolHintsConfig struct {
+	Window     int `json:"window,omitempty"`     // 每个工具保留的最近调用数, 缺省 50
+	MinSamples int `json:"minSamples,omitempty"` // 调用数达到该值才附加提示, 缺省 5
+}
+
+// ScratchpadConfig 把一轮中的多个工具结果用便宜的模型汇总成会话的草稿, 之后的请求只带草稿而不是全部原始结果
+type ScratchpadConfig struct {
+	Model      string `json:"model,omitempty"`      // 汇总使用的模型, 缺省为对话使用的模型
+	MinResults int    `json:"minResults,omitempty"` // 一轮的工具结果达到该数量时才汇总, 缺省 2
+}
+
+// ContextConfig 限制发给大模型的历史长度, 超出时从最早的轮次开始丢弃, 固定的消息始终保留
+type ContextConfig struct {
+	MaxMessages int `json:"maxMessages,omitempty"` // 最多保留的历史消息数, 0 表示不限制
+	MaxTokens   int `json:"maxTokens,omitempty"`   // 历史消息估算的 token 上限, 0 表示不限制
+}
+
+// HealthCheckConfig 定期检查 MCP 服务, 结果见 /api/status
+type HealthCheckConfig struct {
+	Interval Duration `json:"interval,omitempty"` // 检查间隔, 缺省 30s
+	History  int      `json:"history,omitempty"`  // 每个服务保留的检查记录数, 缺省 120
+	// ping 延迟: 最近几次的中位数超过更早记录的中位数的 latencyFactor 倍 (缺省 3), 或者超过 maxRtt 时标记为变慢
+	LatencyFactor float64  `json:"latencyFactor,omitempty"`
+	MaxRTT        Duration `json:"maxRtt,omitempty"`
+}
+
+// CompressionConfig 压缩下发给客户端的消息, 工具输出较长时可以明显减少流量
+type CompressionConfig struct {
+	WebSocket        bool `json:"websocket,omitempty"`        // 和客户端协商 permessage-deflate
+	Level            int  `json:"level,omitempty"`            // deflate 压缩级别 1-9, 缺省 1
+	PayloadThreshold int  `json:"payloadThreshold,omitempty"` // content 超过该字节数时 gzip 压缩 (客户端需带上 gzip=1), 0 表示不压缩
+}
+
+// ResponseConfig 大模型返回多个候选回答时如何选出最终回答
+type ResponseConfig struct {
+	Strategy string `json:"strategy,omitempty"` // first (缺省) | longest | rerank
+}
+
+// LanguageConfig 回答语言, 会话可以通过 ?language= 声明自己的语言
+type LanguageConfig struct {
+	Default   string `json:"default,omitempty"`   // 会话未声明时使用的语言, 缺省不限制
+	Translate bool   `json:"translate,omitempty"` // 是否再把最终回答翻译成会话语言, 会多一次大模型调用
+}
+
+// WorkflowConfig 是固定的工具调用序列, 作为一个工具提供给大模型
+// 参数和条件是 Go 模板, 可以用 .input.<参数> 和 .steps.<步骤 id> 引用调用参数和之前步骤的结果
+type WorkflowConfig struct {
+	Name        string                   `json:"name"`
+	Description string                   `json:"description,omitempty"`
+	Inputs      map[string]WorkflowInput `json:"inputs,omitempty"`
+	Steps       []WorkflowStep           `json:"steps"`
+	Output      string                   `json:"output,omitempty"` // 返回给大模型的内容, 缺省为最后一步的结果
+}
+
+type WorkflowInput struct {
+	Type        string `json:"type,omitempty"` // JSON schema 类型, 缺省为 string
+	Description string `json:"description,omitempty"`
+	Required    bool   `json:"required,omitempty"`
+}
+
+type WorkflowStep struct {
+	ID   string         `json:"id"`
+	Tool string         `json:"tool"`
+	Args map[string]any `json:"args,omitempty"`
+	If   string         `json:"if,omitempty"` // 结果为空、false、0 时跳过该步骤
+}
+
+// MemoryConfig 用户长期记忆, 保存在 dir 下, 每个用户一个文件
+type MemoryConfig struct {
+	Dir      string `json:"dir,omitempty"`      // 缺省为 data/memory
+	MaxFacts int    `json:"maxFacts,omitempty"` // 每个用户最多保存的条数, 缺省 50
+}
+
+// PromptsConfig 用户的提示词模板库, 每个用户一个 json 文件
+type PromptsConfig struct {
+	Dir string `json:"dir,omitempty"` // 缺省为 data/prompts
+}
+
+// SearchConfig 会话全文搜索, 索引保存在 SQLite 文件中
+type SearchConfig struct {
+	DB string `json:"db"` // 比如 data/search.db
+}
+
+// AuthConfig 用户认证, 未配置时所有请求都是匿名用户
+type AuthConfig struct {
+	UserHeader  string                `json:"userHeader,omitempty"`  // 反向代理设置的用户标识请求头, 比如 X-Forwarded-User
+	RoleHeader  string                `json:"roleHeader,omitempty"`  // 身份提供方传来的角色或组, 比如 X-Forwarded-Groups
+	DefaultRole string                `json:"defaultRole,omitempty"` // 缺省为 user
+	Users       map[string]string     `json:"users,omitempty"`       // 按用户指定角色, 优先于 roleHeader
+	Roles       map[string]RoleConfig `json:"roles,omitempty"`       // 各角色的限制
+	OIDC        *OIDCConfig           `json:"oidc,omitempty"`        // 前端通过 OIDC 登录, 和 userHeader 二选一
+}
+
+// OIDCConfig 授权码流程登录, client secret 从环境变量读取
+type OIDCConfig struct {
+	Issuer          string   `json:"issuer"`
+	ClientID        string   `json:"clientId"`
+	ClientSecretEnv string   `json:"clientSecretEnv,omitempty"` // 缺省为 OIDC_CLIENT_SECRET
+	RedirectURL     string   `json:"redirectUrl"`               // 比如 http://localhost:8080/auth/callback
+	Scopes          []string `json:"scopes,omitempty"`          // 缺省为 openid profile email
+	UserClaim       string   `json:"userClaim,omitempty"`       // 作为用户标识的 claim, 缺省为 email
+	RoleClaim       string   `json:"roleClaim,omitempty"`       // 角色或组的 claim, 比如 groups
+	FrontendURL     string   `json:"frontendUrl,omitempty"`     // 登录后跳回的前端地址, 缺省为 /
+}
+
+// RoleConfig 角色的工具白名单和用量限制
+type RoleConfig struct {
+	Tools           []string `json:"tools,omitempty"`           // 允许调用的工具, 支持 * 通配, 不配置时允许全部
+	MaxTokensPerDay int      `json:"maxTokensPerDay,omitempty"` // 每个用户每天的 token 上限, 0 表示不限制
+}
+
+type RateLimitConfig struct {
+	RequestsPerMinute int `json:"requestsPerMinute,omitempty"`
+	TokensPerMinute   int `json:"tokensPerMinute,omitempty"`
+}
+
+// EventsConfig 内部事件总线, 缺省只在进程内分发; redis / nats 时同时把事件发布到 subject
+type EventsConfig struct {
+	Backend string `json:"backend,omitempty"` // memory | redis | nats
+	URL     string `json:"url,omitempty"`
+	Subject string `json:"subject,omitempty"` // redis channel 或 nats subject, 缺省为 mcp-host.events
+}
+
+// ModelPrice 是每百万 token 的价格
+type ModelPrice struct {
+	Input  float64 `json:"input"`
+	Output float64 `json:"output"`
+}
+
+// ExperimentConfig 定义一个 A/B 实验, 会话按权重分配到其中一个分组
+type ExperimentConfig struct {
+	Name     string          `json:"name"`
+	Variants []VariantConfig `json:"variants"`
+}
+
+// VariantConfig 是实验分组, 未设置的参数沿用默认值
+type VariantConfig struct {
+	Name         string   `json:"name"`
+	Weight       int      `json:"weight,omitempty"` // 缺省为 1
+	SystemPrompt string   `json:"systemPrompt,omitempty"`
+	Model        string   `json:"model,omitempty"`
+	Temperature  *float32 `json:"temperature,omitempty"`
+}
+
+// UploadsConfig 用户上传文件的保存位置, 缺省为 data/uploads
+type UploadsConfig struct {
+	Dir      string `json:"dir,omitempty"`
+	MaxBytes int64  `json:"maxBytes,omitempty"` // 单个文件大小上限, 缺省 20MB
+}
+
+// ArtifactsConfig 工具生成的文件保存位置, 缺省为 data/artifacts
+type ArtifactsConfig struct {
+	Dir         string `json:"dir,omitempty"`
+	InlineLimit int    `json:"inlineLimit,omitempty"` // 超过该字节数的文本结果也保存为附件
+}
+
+// HistoryConfig 会话历史持久化, 不配置时只保存在内存中
+// dir 和 redis 二选一, 多副本部署时用 redis 共享会话
+type HistoryConfig struct {
+	Dir        string            `json:"dir,omitempty"`
+	Redis      *RedisConfig      `json:"redis,omitempty"`
+	Encryption *EncryptionConfig `json:"encryption,omitempty"`
+}
+
+type RedisConfig struct {
+	URL       string   `json:"url"`                 // 比如 redis://:password@localhost:6379/0
+	KeyPrefix string   `json:"keyPrefix,omitempty"` // 缺省为 mcp-host:
+	TTL       Duration `json:"ttl,omitempty"`       // 会话过期时间, 缺省不过期
+}
+
+// EncryptionConfig 指定 AES-256 密钥来源 (base64 编码), 三选一
+type EncryptionConfig struct {
+	KeyEnv     string   `json:"keyEnv,omitempty"`
+	KeyFile    string   `json:"keyFile,omitempty"`
+	KeyCommand []string `json:"keyCommand,omitempty"` // 比如调用 KMS 解密出密钥
+}
+
+type MCPServer struct {
+	Type string `json:"type,omitempty"` // stdio | http | sse | builtin:<名称>, 缺省按是否配置 url 推断
+
+	// stdio
+	Command string            `json:"command,omitempty"`
+	Args    []string          `json:"args,omitempty"`
+	Env     map[string]string `json:"env,omitempty"`
+	// 按系统覆盖 command, 比如 Windows 上使用 npx.cmd 或其他路径
+	CommandWindows string `json:"commandWindows,omitempty"`
+	CommandDarwin  string `json:"commandDarwin,omitempty"`
+	CommandLinux   string `json:"commandLinux,omitempty"`
+	// 关闭时发出终止信号后等待进程退出的时间, 超时后强制结束整个进程组, 缺省 5s
+	ShutdownTimeout Duration `json:"shutdownTimeout,omitempty"`
+	// stderr 每行写入日志的级别: debug | info | warn | error | off, 缺省 info
+	StderrLevel string `json:"stderrLevel,omitempty"`
+
+	// http / sse
+	URL     string            `json:"url,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Proxy   string            `json:"proxy,omitempty"` // http / https / socks5 代理, direct 表示直连, 缺省按 HTTP_PROXY 等环境变量
+
+	// 单次请求超时, 比如 "30s", 对所有类型生效
+	Timeout Duration `json:"timeout,omitempty"`
+
+	// 按工具名覆盖或补充工具描述, 不需要改动 MCP 服务本身
+	Tools map[string]ToolOverride `json:"tools,omitempty"`
+
+	// http / sse 的连接池, 高并发时把工具调用分摊到多个连接
+	Pool *PoolConfig `json:"pool,omitempty"`
+}
+
+type PoolConfig struct {
+	Size                int      `json:"size"`                          // 连接数
+	HealthCheckInterval Duration `json:"healthCheckInterval,omitempty"` // 健康检查间隔, 缺省 30s
+}
+
+// ToolOverride 调整提供给大模型的工具描述
+type ToolOverride struct {
+	Description       string                       `json:"description,omitempty"`       // 替换原描述
+	AppendDescription string                       `json:"appendDescription,omitempty"` // 追加在描述后面, 比如使用限制或示例
+	Parameters        map[string]ParameterOverride `json:"parameters,omitempty"`
+	// 由主机提供的参数: 参数名 -> 来源 (user_id | session_id | auth_token), 从提供给大模型的 schema 中去掉,
+	// 调用时填入当前的值, 覆盖大模型给出的同名参数
+	Inject map[string]string `json:"inject,omitempty"`
+	// 参数的缺省值, 比如 {"units": "metric"}, 大模型没有给出时使用; 有缺省值的参数不再是必填的
+	Defaults map[string]any `json:"defaults,omitempty"`
+
+	// 执行限制
+	Timeout         Duration `json:"timeout,omitempty"`         // 单次调用超时, 缺省按服务的 timeout
+	MaxOutputBytes  int      `json:"maxOutputBytes,omitempty"`  // 结果超过该字节数时截断
+	MaxCallsPerTurn int      `json:"maxCallsPerTurn,omitempty"` // 每轮对话最多调用次数
+	Ephemeral       bool     `json:"ephemeral,omitempty"`       // 结果只在当轮对话中使用, 历史和之后的上下文中替换为占位文字
+	RequireApproval bool     `json:"requireApproval,omitempty"` // 调用前等待用户批准, 比如发送邮件
+
+	Transform *TransformConfig `json:"transform,omitempty"` // 结果交给大模型之前的转换
+}
+
+// TransformConfig 用 jq 表达式或 Go 模板转换工具的文本结果, 二选一
+// 结果是 JSON 时作用于解析后的值, 比如 jq `.city + ", " + .country` 或模板 `{{.city}}, {{.country}}`
+type TransformConfig struct {
+	JQ       string `json:"jq,omitempty"`
+	Template string `json:"template,omitempty"`
+}
+
+type ParameterOverride struct {
+	Description       string `json:"description,omitempty"`
+	AppendDescription string `json:"appendDescription,omitempty"`
+}
+
+// Duration 支持在 json 中写 "30s" 这样的字符串
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return newError("config.duration_type")
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return newError("config.duration_invalid", s)
+	}
+	if v < 0 {
+		return newError("config.duration_negative", s)
+	}
+	*d = Duration(v)
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// ConfigError 描述配置文件中某个位置的错误, 带行列号方便定位
+type ConfigError struct {
+	File string
+	Line int
+	Col  int
+	Path string // 出错字段的路径, 比如 mcpServers.calculator.type
+	Msg  string
+}
+
+func (e *ConfigError) Error() string {
+	loc := e.File
+	if e.Line > 0 {
+		loc = fmt.Sprintf("%s:%d:%d", e.File, e.Line, e.Col)
+	}
+	if e.Path == "" {
+		return fmt.Sprintf("%s: %s", loc, e.Msg)
+	}
+	return fmt.Sprintf("%s: %s: %s", loc, e.Path, e.Msg)
+}
+
+// LoadConfig 读取并校验配置文件 (按扩展名识别 JSON, YAML, TOML), 所有错误一次性返回 (errors.Join)
+// LoadConfig 读取配置文件, 设置了 APP_ENV 时叠加对应的环境配置, 见 loadConfigDoc
+func LoadConfig(configPath string) (*MCPConfig, error) {
+	doc, err := loadConfigDoc(configPath)
+	if err != nil {
+		return nil, err
+	}
+	return parseConfigDoc(doc)
+}
+
+func ParseConfig(file string, data []byte) (*MCPConfig, error) {
+	doc, err := newConfigDoc(file, data)
+	if err != nil {
+		return nil, err
+	}
+	return parseConfigDoc(doc)
+}
+
+func parseConfigDoc(doc *configDoc) (*MCPConfig, error) {
+	// 先取出 locale, 后面的错误信息按配置的语言输出
+	var head struct {
+		Locale string `json:"locale"`
+	}
+	_ = json.Unmarshal(doc.data, &head)
+	if l := matchLocale(head.Locale); l != "" {
+		doc.locale = l
+	}
+
+	// 替换密钥引用之前记下引用了哪些环境变量
+	envNames := configEnvNames(doc.data)
+	if errs := doc.resolveSecrets(); len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	var cfg MCPConfig
+	if errs := doc.decode(&cfg); len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	cfg.file, cfg.envNames = doc.file, envNames
+
+	if errs := cfg.expandEnv(doc); len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	cfg.applyDefaults(doc)
+	if errs := cfg.validate(doc); len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return &cfg, nil
+}
+
+func (cfg *MCPConfig) applyDefaults(doc *configDoc) {
+	if cfg.Locale == "" {
+		cfg.Locale = defaultLocale
+	}
+	for i := range cfg.Experiments {
+		for j := range cfg.Experiments[i].Variants {
+			if cfg.Experiments[i].Variants[j].Weight == 0 {
+				cfg.Experiments[i].Variants[j].Weight = 1
+			}
+		}
+	}
+	if cfg.TurnTimeout == 0 {
+		cfg.TurnTimeout = Duration(defaultTurnTimeout)
+	}
+	if cfg.Auth != nil && cfg.Auth.DefaultRole == "" {
+		cfg.Auth.DefaultRole = RoleUser
+	}
+	if cfg.Auth != nil && cfg.Auth.OIDC != nil {
+		o := cfg.Auth.OIDC
+		if o.ClientSecretEnv == "" {
+			o.ClientSecretEnv = "OIDC_CLIENT_SECRET"
+		}
+		if len(o.Scopes) == 0 {
+			o.Scopes = []string{"openid", "profile", "email"}
+		}
+		if o.UserClaim == "" {
+			o.UserClaim = "email"
+		}
+		if o.FrontendURL == "" {
+			o.FrontendURL = "/"
+		}
+	}
+	if cfg.PolicyFile != "" && !filepath.IsAbs(cfg.PolicyFile) {
+		cfg.PolicyFile = filepath.Join(filepath.Dir(doc.file), cfg.PolicyFile)
+	}
+	for name, s := range cfg.MCPServers {
+		s.Type = strings.ToLower(s.Type)
+		if s.Type == "" {
+			if s.URL != "" {
+				s.Type = "http"
+			} else {
+				s.Type = "stdio"
+			}
+		}
+		// 兼容旧配置: http/sse 曾经用 command 字段填写服务地址
+		if (s.Type == "http" || s.Type == "sse") && s.URL == "" && s.Command != "" {
+			log.Print(doc.t("config.deprecated_command", name))
+			s.URL, s.Command = s.Command, ""
+		}
+		if s.Type == "stdio" {
+			if _, c := s.platformCommand(runtime.GOOS); c != nil && *c != "" {
+				s.Command = *c
+			}
+		}
+		if s.Args == nil {
+			s.Args = []string{}
+		}
+		cfg.MCPServers[name] = s
+	}
+}
+
+func (cfg *MCPConfig) validate(doc *configDoc) []error {
+	var errs []error
+	if cfg.MCPServers == nil {
+		return []error{doc.errorAt("mcpServers", -1, doc.t("config.required"))}
+	}
+	if _, ok := logLevels[cfg.LogLevel]; !ok && cfg.LogLevel != "" {
+		errs = append(errs, doc.errorAt("logLevel", -1, doc.t("config.unknown_log_level", cfg.LogLevel, "debug, info, warn, error")))
+	}
+	if matchLocale(cfg.Locale) == "" {
+		errs = append(errs, doc.errorAt("locale", -1, doc.t("config.unknown_locale", cfg.Locale, strings.Join(supportedLocales(), ", "))))
+	}
+	if cfg.SessionIdle < 0 {
+		errs = append(errs, doc.errorAt("sessionIdleTTL", -1, doc.t("config.negative", cfg.SessionIdle)))
+	}
+
+	if h := cfg.History; h != nil {
+		if (h.Dir == "") == (h.Redis == nil) {
+			errs = append(errs, doc.errorAt("history", -1, doc.t("config.history_backend")))
+		}
+		if h.Redis != nil {
+			if _, err := redis.ParseURL(h.Redis.URL); err != nil {
+				errs = append(errs, doc.errorAt("history.redis.url", -1, doc.t("config.redis_url", err)))
+			}
+		}
+		if e := h.Encryption; e != nil {
+			n := 0
+			for _, set := range []bool{e.KeyEnv != "", e.KeyFile != "", len(e.KeyCommand) > 0} {
+				if set {
+					n++
+				}
+			}
+			if n != 1 {
+				errs = append(errs, doc.errorAt("history.encryption", -1, doc.t("config.key_source")))
+			}
+		}
+	}
+
+	errs = append(errs, cfg.validateExperiments(doc)...)
+	errs = append(errs, cfg.validateWorkflows(doc)...)
+
+	if r := cfg.Response; r != nil && r.Strategy != "" && !slices.Contains(responseStrategies, r.Strategy) {
+		errs = append(errs, doc.errorAt("response.strategy", -1, doc.t("config.unknown_strategy", r.Strategy, strings.Join(responseStrategies, ", "))))
+	}
+
+	if cfg.ToolSchema != "" && !slices.Contains(schemaDialects, cfg.ToolSchema) {
+		errs = append(errs, doc.errorAt("toolSchema", -1, doc.t("config.unknown_dialect", cfg.ToolSchema, strings.Join(schemaDialects, ", "))))
+	}
+
+	if c := cfg.Compression; c != nil {
+		if c.Level != 0 && (c.Level < flate.BestSpeed || c.Level > flate.BestCompression) {
+			errs = append(errs, doc.errorAt("compression.level", -1, doc.t("config.compression_level", c.Level)))
+		}
+		if c.PayloadThreshold < 0 {
+			errs = append(errs, doc.errorAt("compression.payloadThreshold", -1, doc.t("config.negative", c.PayloadThreshold)))
+		}
+	}
+
+	if cfg.Search != nil && cfg.Search.DB == "" {
+		errs = append(errs, doc.errorAt("search.db", -1, doc.t("config.required")))
+	}
+	// 全文索引保存的是明文, 会绕过历史加密
+	if cfg.Search != nil && cfg.History != nil && cfg.History.Encryption != nil {
+		errs = append(errs, doc.errorAt("search", -1, doc.t("config.search_encrypted")))
+	}
+
+	if a := cfg.Auth; a != nil {
+		roles := strings.Join([]string{RoleAdmin, RoleUser, RoleReadonly}, ", ")
+		if roleRank[a.DefaultRole] == 0 {
+			errs = append(errs, doc.errorAt("auth.defaultRole", -1, doc.t("config.unknown_role", a.DefaultRole, roles)))
+		}
+		// 请求头中的身份只有经过受信任的代理才可信, 没有配置代理时任何客户端都可以冒充其他用户
+		if a.OIDC == nil && (a.UserHeader != "" || a.RoleHeader != "") && (cfg.Network == nil || len(cfg.Network.TrustedProxies) == 0) {
+			field := "auth.userHeader"
+			if a.UserHeader == "" {
+				field = "auth.roleHeader"
+			}
+			errs = append(errs, doc.errorAt(field, -1, doc.t("config.auth_header_untrusted")))
+		}
+		if o := a.OIDC; o != nil {
+			if a.UserHeader != "" || a.RoleHeader != "" {
+				errs = append(errs, doc.errorAt("auth.oidc", -1, doc.t("config.auth_source")))
+			}
+			required := []struct{ field, value string }{{"issuer", o.Issuer}, {"clientId", o.ClientID}, {"redirectUrl", o.RedirectURL}}
+			for _, f := range required {
+				if f.value == "" {
+					errs = append(errs, doc.errorAt("auth.oidc."+f.field, -1, doc.t("config.required")))
+				}
+			}
+		}
+		for _, user := range sortedKeys(a.Users) {
+			if roleRank[a.Users[user]] == 0 {
+				errs = append(errs, doc.errorAt("auth.users."+user, -1, doc.t("config.unknown_role", a.Users[user], roles)))
+			}
+		}
+		for _, role := range sortedKeys(a.Roles) {
+			if roleRank[role] == 0 {
+				errs = append(errs, doc.errorAt("auth.roles."+role, -1, doc.t("config.unknown_role", role, roles)))
+			}
+			if n := a.Roles[role].MaxTokensPerDay; n < 0 {
+				errs = append(errs, doc.errorAt("auth.roles."+role+".maxTokensPerDay", -1, doc.t("config.negative", n)))
+			}
+		}
+	}
+
+	if hc := cfg.HealthCheck; hc != nil {
+		if hc.History < 0 {
+			errs = append(errs, doc.errorAt("healthCheck.history", -1, doc.t("config.negative", hc.History)))
+		}
+		if hc.LatencyFactor != 0 && hc.LatencyFactor <= 1 {
+			errs = append(errs, doc.errorAt("healthCheck.latencyFactor", -1, doc.t("config.latency_factor", hc.LatencyFactor)))
+		}
+		if hc.MaxRTT < 0 {
+			errs = append(errs, doc.errorAt("healthCheck.maxRtt", -1, doc.t("config.negative", hc.MaxRTT)))
+		}
+	}
+
+	if c := cfg.Connections; c != nil {
+		for _, l := range []struct {
+			field string
+			n     int
+		}{
+			{"maxTotal", c.MaxTotal},
+			{"maxPerUser", c.MaxPerUser},
+			{"maxPerIP", c.MaxPerIP},
+		} {
+			if l.n < 0 {
+				errs = append(errs, doc.errorAt("connections."+l.field, -1, doc.t("config.negative", l.n)))
+			}
+		}
+	}
+	if c := cfg.Chaos; c != nil {
+		for _, r := range []struct {
+			field string
+			rate  float64
+		}{
+			{"toolFailureRate", c.ToolFailureRate},
+			{"slowToolRate", c.SlowToolRate},
+			{"dropFrameRate", c.DropFrameRate},
+			{"disconnectRate", c.DisconnectRate},
+		} {
+			if r.rate < 0 || r.rate > 1 {
+				errs = append(errs, doc.errorAt("chaos."+r.field, -1, doc.t("config.rate_range", r.rate)))
+			}
+		}
+	}
+	if c := cfg.Startup; c != nil && c.SelfTestTimeout < 0 {
+		errs = append(errs, doc.errorAt("startup.selfTestTimeout", -1, doc.t("config.negative", c.SelfTestTimeout)))
+	}
+	if c := cfg.Digest; c != nil {
+		if c.Interval < 0 {
+			errs = append(errs, doc.errorAt("digest.interval", -1, doc.t("config.negative", c.Interval)))
+		}
+		if c.MinMessages < 0 {
+			errs = append(errs, doc.errorAt("digest.minMessages", -1, doc.t("config.negative", c.MinMessages)))
+		}
+	}
+	if c := cfg.Demo; c != nil {
+		if c.MaxTokensPerDay < 0 {
+			errs = append(errs, doc.errorAt("demo.maxTokensPerDay", -1, doc.t("config.negative", c.MaxTokensPerDay)))
+		}
+		if c.MaxTokens < 0 {
+			errs = append(errs, doc.errorAt("demo.maxTokens", -1, doc.t("config.negative", c.MaxTokens)))
+		}
+	}
+	if c := cfg.ToolBudget; c != nil {
+		if c.MaxCalls < 0 {
+			errs = append(errs, doc.errorAt("toolBudget.maxCalls", -1, doc.t("config.negative", c.MaxCalls)))
+		}
+		if c.MaxDuration < 0 {
+			errs = append(errs, doc.errorAt("toolBudget.maxDuration", -1, doc.t("config.negative", c.MaxDuration)))
+		}
+	}
+	if c := cfg.Purge; c != nil {
+		if c.Retention < 0 {
+			errs = append(errs, doc.errorAt("purge.retention", -1, doc.t("config.negative", c.Retention)))
+		} else if c.Retention == 0 {
+			errs = append(errs, doc.errorAt("purge.retention", -1, doc.t("config.required")))
+		}
+	}
+	if c := cfg.Analytics; c != nil {
+		if c.Interval < 0 {
+			errs = append(errs, doc.errorAt("analytics.interval", -1, doc.t("config.negative", c.Interval)))
+		}
+		if c.TopPrompts < 0 {
+			errs = append(errs, doc.errorAt("analytics.topPrompts", -1, doc.t("config.negative", c.TopPrompts)))
+		}
+	}
+	if c := cfg.Cache; c != nil {
+		if c.Threshold < 0 || c.Threshold > 1 {
+			errs = append(errs, doc.errorAt("cache.threshold", -1, doc.t("config.rate_range", c.Threshold)))
+		}
+		if c.TTL < 0 {
+			errs = append(errs, doc.errorAt("cache.ttl", -1, doc.t("config.negative", c.TTL)))
+		}
+		if c.MaxEntries < 0 {
+			errs = append(errs, doc.errorAt("cache.maxEntries", -1, doc.t("config.negative", c.MaxEntries)))
+		}
+	}
+	if c := cfg.ConfigSource; c != nil {
+		if !slices.Contains(configBackends, c.Backend) {
+			errs = append(errs, doc.errorAt("configSource.backend", -1, doc.t("config.unknown_config_backend", c.Backend, strings.Join(configBackends, ", "))))
+		}
+		if u, err := url.Parse(c.Address); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, doc.errorAt("configSource.address", -1, doc.t("config.url_invalid", c.Address)))
+		}
+		if c.Key == "" {
+			errs = append(errs, doc.errorAt("configSource.key", -1, doc.t("config.required")))
+		}
+	}
+	if c := cfg.Resume; c != nil && c.TTL < 0 {
+		errs = append(errs, doc.errorAt("resume.ttl", -1, doc.t("config.negative", c.TTL)))
+	}
+	if c := cfg.Network; c != nil {
+		lists := map[string][]string{"network.trustedProxies": c.TrustedProxies}
+		if a := c.WebSocket; a != nil {
+			lists["network.webSocket.allow"], lists["network.webSocket.deny"] = a.Allow, a.Deny
+		}
+		if a := c.Admin; a != nil {
+			lists["network.admin.allow"], lists["network.admin.deny"] = a.Allow, a.Deny
+		}
+		for _, path := range slices.Sorted(maps.Keys(lists)) {
+			if _, i, err := parseIPList(lists[path]); err != nil {
+				errs = append(errs, doc.errorAt(fmt.Sprintf("%s[%d]", path, i), -1, doc.t("config.invalid_ip", lists[path][i])))
+			}
+		}
+	}
+	if c := cfg.ToolHints; c != nil {
+		if c.Window < 0 {
+			errs = append(errs, doc.errorAt("toolHints.window", -1, doc.t("config.negative", c.Window)))
+		}
+		if c.MinSamples < 0 {
+			errs = append(errs, doc.errorAt("toolHints.minSamples", -1, doc.t("config.negative", c.MinSamples)))
+		}
+	}
+	if c := cfg.Scratchpad; c != nil && c.MinResults < 0 {
+		errs = append(errs, doc.errorAt("scratchpad.minResults", -1, doc.t("config.negative", c.MinResults)))
+	}
+	if c := cfg.Context; c != nil {
+		if c.MaxMessages < 0 {
+			errs = append(errs, doc.errorAt("context.maxMessages", -1, doc.t("config.negative", c.MaxMessages)))
+		}
+		if c.MaxTokens < 0 {
+			errs = append(errs, doc.errorAt("context.maxTokens", -1, doc.t("config.negative", c.MaxTokens)))
+		}
+	}
+
+	if m := cfg.Memory; m != nil && m.MaxFacts < 0 {
+		errs = append(errs, doc.errorAt("memory.maxFacts", -1, doc.t("config.negative", m.MaxFacts)))
+	}
+
+	if rl := cfg.RateLimit; rl != nil {
+		if rl.RequestsPerMinute < 0 {
+			errs = append(errs, doc.errorAt("rateLimit.requestsPerMinute", -1, doc.t("config.negative", rl.RequestsPerMinute)))
+		}
+		if rl.TokensPerMinute < 0 {
+			errs = append(errs, doc.errorAt("rateLimit.tokensPerMinute", -1, doc.t("config.negative", rl.TokensPerMinute)))
+		}
+	}
+
+	if e := cfg.Events; e != nil {
+		switch e.Backend {
+		case "", "memory":
+		case "redis", "nats":
+			if e.URL == "" {
+				errs = append(errs, doc.errorAt("events.url", -1, doc.t("config.url_required", e.Backend)))
+			}
+		default:
+			errs = append(errs, doc.errorAt("events.backend", -1, doc.t("config.unknown_backend", e.Backend, "memory, redis, nats")))
+		}
+	}
+
+	// 按名称排序, 保证错误输出顺序稳定
+	for _, name := range sortedKeys(cfg.MCPServers) {
+		s := cfg.MCPServers[name]
+		path := "mcpServers." + name
+		switch s.Type {
+		case "stdio":
+			if s.Command == "" {
+				errs = append(errs, doc.errorAt(path+".command", -1, doc.t("config.stdio_command")))
+			}
+			if s.URL != "" {
+				errs = append(errs, doc.errorAt(path+".url", -1, doc.t("config.unsupported_field", s.Type, "url")))
+			}
+			if len(s.Headers) > 0 {
+				errs = append(errs, doc.errorAt(path+".headers", -1, doc.t("config.unsupported_field", s.Type, "headers")))
+			}
+			if s.Pool != nil {
+				errs = append(errs, doc.errorAt(path+".pool", -1, doc.t("config.unsupported_field", s.Type, "pool")))
+			}
+			if s.Proxy != "" {
+				errs = append(errs, doc.errorAt(path+".proxy", -1, doc.t("config.unsupported_field", s.Type, "proxy")))
+			}
+			if s.ShutdownTimeout < 0 {
+				errs = append(errs, doc.errorAt(path+".shutdownTimeout", -1, doc.t("config.negative", s.ShutdownTimeout)))
+			}
+			if _, ok := logLevels[s.StderrLevel]; !ok && s.StderrLevel != "" && s.StderrLevel != "off" {
+				errs = append(errs, doc.errorAt(path+".stderrLevel", -1, doc.t("config.unknown_log_level", s.StderrLevel, "debug, info, warn, error, off")))
+			}
+		case "http", "sse":
+			if s.URL == "" {
+				errs = append(errs, doc.errorAt(path+".url", -1, doc.t("config.url_required", s.Type)))
+			} else if u, err := url.Parse(s.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				errs = append(errs, doc.errorAt(path+".url", -1, doc.t("config.url_invalid", s.URL)))
+			}
+			if s.Command != "" {
+				errs = append(errs, doc.errorAt(path+".command", -1, doc.t("config.command_and_url", s.Type)))
+			}
+			for _, f := range platformCommandFields(s) {
+				errs = append(errs, doc.errorAt(path+"."+f, -1, doc.t("config.unsupported_field", s.Type, f)))
+			}
+			if s.ShutdownTimeout != 0 {
+				errs = append(errs, doc.errorAt(path+".shutdownTimeout", -1, doc.t("config.unsupported_field", s.Type, "shutdownTimeout")))
+			}
+			if s.StderrLevel != "" {
+				errs = append(errs, doc.errorAt(path+".stderrLevel", -1, doc.t("config.unsupported_field", s.Type, "stderrLevel")))
+			}
+			if len(s.Args) > 0 {
+				errs = append(errs, doc.errorAt(path+".args", -1, doc.t("config.unsupported_field", s.Type, "args")))
+			}
+			if len(s.Env) > 0 {
+				errs = append(errs, doc.errorAt(path+".env", -1, doc.t("config.unsupported_field", s.Type, "env")))
+			}
+			if s.Proxy != "" {
+				if _, err := parseProxy(s.Proxy); err != nil {
+					errs = append(errs, doc.errorAt(path+".proxy", -1, localize(err, doc.locale)))
+				}
+			}
+			if s.Pool != nil && s.Pool.Size < 1 {
+				errs = append(errs, doc.errorAt(path+".pool.size", -1, doc.t("config.pool_size", s.Pool.Size)))
+			}
+		default:
+			builtin, ok := builtinName(s.Type)
+			if !ok {
+				errs = append(errs, doc.errorAt(path+".type", -1, doc.t("config.unknown_type", s.Type)))
+				break
+			}
+			if lookupBuiltin(builtin) == nil {
+				errs = append(errs, doc.errorAt(path+".type", -1, doc.t("config.unknown_builtin", builtin, builtinNames())))
+			}
+			// 内置服务在进程内运行, 连接相关的字段都不适用
+			for _, f := range []struct {
+				name string
+				set  bool
+			}{
+				{"command", s.Command != ""},
+				{"args", len(s.Args) > 0},
+				{"env", len(s.Env) > 0},
+				{"url", s.URL != ""},
+				{"headers", len(s.Headers) > 0},
+				{"proxy", s.Proxy != ""},
+				{"pool", s.Pool != nil},
+				{"shutdownTimeout", s.ShutdownTimeout != 0},
+				{"stderrLevel", s.StderrLevel != ""},
+			} {
+				if f.set {
+					errs = append(errs, doc.errorAt(path+"."+f.name, -1, doc.t("config.unsupported_field", s.Type, f.name)))
+				}
+			}
+			for _, f := range platformCommandFields(s) {
+				errs = append(errs, doc.errorAt(path+"."+f, -1, doc.t("config.unsupported_field", s.Type, f)))
+			}
+		}
+		for _, tool := range sortedKeys(s.Tools) {
+			o := s.Tools[tool]
+			if o.MaxOutputBytes < 0 {
+				errs = append(errs, doc.errorAt(path+".tools."+tool+".maxOutputBytes", -1, doc.t("config.negative", o.MaxOutputBytes)))
+			}
+			if o.MaxCallsPerTurn < 0 {
+				errs = append(errs, doc.errorAt(path+".tools."+tool+".maxCallsPerTurn", -1, doc.t("config.negative", o.MaxCallsPerTurn)))
+			}
+			for _, param := range sortedKeys(o.Inject) {
+				if !slices.Contains(injectSources, o.Inject[param]) {
+					errs = append(errs, doc.errorAt(path+".tools."+tool+".inject."+param, -1, doc.t("config.unknown_inject_source", o.Inject[param], strings.Join(injectSources, ", "))))
+				}
+			}
+			if t := o.Transform; t != nil {
+				if (t.JQ == "") == (t.Template == "") {
+					errs = append(errs, doc.errorAt(path+".tools."+tool+".transform", -1, doc.t("config.transform_source")))
+				} else if _, err := compileTransform(t); err != nil {
+					errs = append(errs, doc.errorAt(path+".tools."+tool+".transform", -1, doc.t("config.transform_invalid", err)))
+				}
+			}
+		}
+	}
+	return errs
+}
+
+func (cfg *MCPConfig) validateExperiments(doc *configDoc) []error {
+	var errs []error
+	seen := map[string]bool{}
+	for i, exp := range cfg.Experiments {
+		path := fmt.Sprintf("experiments[%d]", i)
+		if exp.Name == "" {
+			errs = append(errs, doc.errorAt(path+".name", -1, doc.t("config.required")))
+		} else if seen[exp.Name] {
+			errs = append(errs, doc.errorAt(path+".name", -1, doc.t("config.duplicate_name", exp.Name)))
+		}
+		seen[exp.Name] = true
+		if len(exp.Variants) == 0 {
+			errs = append(errs, doc.errorAt(path+".variants", -1, doc.t("config.required")))
+		}
+		variants := map[string]bool{}
+		for j, v := range exp.Variants {
+			vpath := fmt.Sprintf("%s.variants[%d]", path, j)
+			if v.Name == "" {
+				errs = append(errs, doc.errorAt(vpath+".name", -1, doc.t("config.required")))
+			} else if variants[v.Name] {
+				errs = append(errs, doc.errorAt(vpath+".name", -1, doc.t("config.duplicate_name", v.Name)))
+			}
+			variants[v.Name] = true
+			if v.Weight < 0 {
+				errs = append(errs, doc.errorAt(vpath+".weight", -1, doc.t("config.negative", v.Weight)))
+			}
+			if v.Temperature != nil && (*v.Temperature < 0 || *v.Temperature > 2) {
+				errs = append(errs, doc.errorAt(vpath+".temperature", -1, doc.t("config.temperature_range", *v.Temperature)))
+			}
+		}
+	}
+	return errs
+}
+
+func (cfg *MCPConfig) validateWorkflows(doc *configDoc) []error {
+	var errs []error
+	seen := map[string]bool{}
+	for i, wf := range cfg.Workflows {
+		path := fmt.Sprintf("workflows[%d]", i)
+		if wf.Name == "" {
+			errs = append(errs, doc.errorAt(path+".name", -1, doc.t("config.required")))
+		} else if seen[wf.Name] {
+			errs = append(errs, doc.errorAt(path+".name", -1, doc.t("config.duplicate_name", wf.Name)))
+		}
+		seen[wf.Name] = true
+		if len(wf.Steps) == 0 {
+			errs = append(errs, doc.errorAt(path+".steps", -1, doc.t("config.required")))
+		}
+		ids := map[string]bool{}
+		for j, step := range wf.Steps {
+			spath := fmt.Sprintf("%s.steps[%d]", path, j)
+			if step.ID == "" {
+				errs = append(errs, doc.errorAt(spath+".id", -1, doc.t("config.required")))
+			} else if ids[step.ID] {
+				errs = append(errs, doc.errorAt(spath+".id", -1, doc.t("config.duplicate_name", step.ID)))
+			}
+			ids[step.ID] = true
+			if step.Tool == "" {
+				errs = append(errs, doc.errorAt(spath+".tool", -1, doc.t("config.required")))
+			}
+		}
+		if _, err := compileWorkflow(wf); err != nil {
+			errs = append(errs, doc.errorAt(path, -1, doc.t("config.workflow_invalid", err)))
+		}
+	}
+	return errs
+}
+
+// configDoc 保存原始配置内容及字段路径到文件偏移量的映射
+type configDoc struct {
+	file   string
+	format string
+	src    []byte           // 原文件内容, 错误的行列号按它计算
+	data   []byte           // JSON 内容, YAML 和 TOML 转换后的结果
+	pos    map[string]int64 // 字段在 src 中的偏移
+	locale string
+
+	converted bool       // data 不是原文件内容 (格式转换、替换了密钥引用或叠加了环境配置), 其中的偏移不能用于定位
+	overlay   *configDoc // 叠加的环境配置, 其中写出的字段按它定位
+}
+
+// newConfigDoc 做语法检查并记录每个字段在文件中的位置
+func newConfigDoc(file string, data []byte) (*configDoc, error) {
+	doc := &configDoc{file: file, format: configFormat(file), src: data, data: data, pos: map[string]int64{}, locale: serverLocale}
+	index := doc.index
+	if doc.format != formatJSON {
+		index = doc.toJSON
+	}
+	if err := index(); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// decode 检查未知字段后解码到 v, 返回带位置的错误
+func (d *configDoc) decode(v any) []error {
+	var raw any
+	if err := json.Unmarshal(d.data, &raw); err != nil {
+		return []error{d.errorAt("", 0, err.Error())}
+	}
+	var errs []error
+	d.checkKeys("", raw, reflect.TypeOf(v), &errs)
+
+	if err := json.Unmarshal(d.data, v); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			// Offset 是值结束的位置, 转换格式时还是转换后的 JSON 中的位置; 按字段路径定位到字段名, 和其他错误一致
+			errs = append(errs, d.errorAt(typeErr.Field, -1, d.t("config.type_mismatch", typeErr.Type, typeErr.Value)))
+		} else if len(errs) == 0 {
+			errs = append(errs, d.errorAt("", -1, err.Error()))
+		}
+	}
+	return errs
+}
+
+func (d *configDoc) t(key string, args ...any) string {
+	return T(d.locale, key, args...)
+}
+
+// index 遍历 json token, 记录每个 key 的起始位置
+func (d *configDoc) index() error {
+	dec := json.NewDecoder(bytes.NewReader(d.data))
+	var walk func(path string) error
+	walk = func(path string) error {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		delim, ok := tok.(json.Delim)
+		if !ok {
+			return nil
+		}
+		switch delim {
+		case '{':
+			for dec.More() {
+				start := d.skipSpace(dec.InputOffset())
+				keyTok, err := dec.Token()
+				if err != nil {
+					return err
+				}
+				key := keyTok.(string)
+				child := key
+				if path != "" {
+					child = path + "." + key
+				}
+				d.pos[child] = start
+				if err := walk(child); err != nil {
+					return err
+				}
+			}
+		case '[':
+			for i := 0; dec.More(); i++ {
+				child := fmt.Sprintf("%s[%d]", path, i)
+				d.pos[child] = d.skipSpace(dec.InputOffset())
+				if err := walk(child); err != nil {
+					return err
+				}
+			}
+		}
+		_, err = dec.Token() // 结束符 } 或 ]
+		return err
+	}
+
+	if err := walk(""); err != nil {
+		var syntaxErr *json.SyntaxError
+		if errors.As(err, &syntaxErr) {
+			return d.errorAt("", syntaxErr.Offset, d.t("config.syntax", syntaxErr))
+		}
+		return d.errorAt("", int64(len(d.data)), d.t("config.syntax", err))
+	}
+	return nil
+}
+
+// skipSpace 跳过分隔符和空白, 定位到下一个 token 的起始位置
+func (d *configDoc) skipSpace(off int64) int64 {
+	for off < int64(len(d.data)) {
+		switch d.data[off] {
+		case ' ', '\t', '\r', '\n', ',', ':':
+			off++
+		default:
+			return off
+		}
+	}
+	return off
+}
+
+// checkKeys 对照结构体的 json tag 检查未知字段
+func (d *configDoc) checkKeys(path string, v any, t reflect.Type, errs *[]error) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	// 自定义类型 (比如 Duration) 在这里提前解析, 以便错误能带上位置
+	if u, ok := reflect.New(t).Interface().(json.Unmarshaler); ok {
+		b, _ := json.Marshal(v)
+		if err := u.UnmarshalJSON(b); err != nil {
+			*errs = append(*errs, d.errorAt(path, -1, localize(err, d.locale)))
+		}
+		return
+	}
+	switch val := v.(type) {
+	case map[string]any:
+		keys := make([]string, 0, len(val))
+		for k := range val {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			child := k
+			if path != "" {
+				child = path + "." + k
+			}
+			switch t.Kind() {
+			case reflect.Map:
+				d.checkKeys(child, val[k], t.Elem(), errs)
+			case reflect.Struct:
+				field, ok := jsonField(t, k)
+				if !ok {
+					*errs = append(*errs, d.errorAt(child, -1, d.t("config.unknown_field")))
+					continue
+				}
+				d.checkKeys(child, val[k], field.Type, errs)
+			}
+		}
+	case []any:
+		if t.Kind() != reflect.Slice {
+			return
+		}
+		for i, item := range val {
+			d.checkKeys(fmt.Sprintf("%s[%d]", path, i), item, t.Elem(), errs)
+		}
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func jsonField(t reflect.Type, key string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == key {
+			return f, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// errorAt 生成带行列号的错误, offset 为 -1 时按 path 查找位置
+func (d *configDoc) errorAt(path string, offset int64, msg string) *ConfigError {
+	src := d
+	if offset < 0 {
+		src, offset = d.lookup(path)
+	}
+	e := &ConfigError{File: src.file, Path: path, Msg: msg}
+	if offset >= 0 {
+		e.Line, e.Col = src.lineCol(offset)
+	}
+	return e
+}
+
+// lookup 查找 path 所在的文件和位置, 字段不存在时退回到最近的父级; 环境配置中写出的字段优先
+func (d *configDoc) lookup(path string) (*configDoc, int64) {
+	for path != "" {
+		if d.overlay != nil {
+			if off, ok := d.overlay.pos[path]; ok {
+				return d.overlay, off
+			}
+		}
+		if off, ok := d.pos[path]; ok {
+			return d, off
+		}
+		i := strings.LastIndex(path, ".")
+		if i < 0 {
+			break
+		}
+		path = path[:i]
+	}
+	return d, -1
+}
+
+func (d *configDoc) lineCol(offset int64) (int, int) {
+	if offset > int64(len(d.src)) {
+		offset = int64(len(d.src))
+	}
+	line, col := 1, 1
+	for _, b := range d.src[:offset] {
+		if b == '\n' {
+			line++
+			col = 1
+		} else {
+			col++
+		}
+	}
+	return line, col
+}
@@ -0,0 +1,170 @@
+package host
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// parseTestConfig 在 config 前面补上必填的 mcpServers
+func parseTestConfig(config string) error {
+	_, err := ParseConfig("config.json", []byte(`{"mcpServers": {}, `+strings.TrimPrefix(config, "{")))
+	return err
+}
+
+// errorLocations 取出每条错误的 "文件:行:列: 字段" 部分, 不比较按语言变化的说明
+func errorLocations(err error) []string {
+	if err == nil {
+		return nil
+	}
+	var locs []string
+	for _, line := range strings.Split(err.Error(), "\n") {
+		parts := strings.SplitN(line, ": ", 3)
+		locs = append(locs, strings.Join(parts[:min(2, len(parts))], ": "))
+	}
+	slices.Sort(locs)
+	return locs
+}
+
+func TestConfigErrorPositions(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		data string
+		want []string
+	}{
+		{
+			name: "json unknown field and bad duration",
+			file: "config.json",
+			data: "{\n  \"mcpServers\": {},\n  \"turnTimeout\": \"soon\",\n  \"unknownKey\": 1\n}",
+			want: []string{"config.json:3:3: turnTimeout", "config.json:4:3: unknownKey"},
+		},
+		{
+			name: "json type error",
+			file: "config.json",
+			data: "{\n  \"mcpServers\": {},\n  \"rateLimit\": {\"requestsPerMinute\": \"x\"}\n}",
+			want: []string{"config.json:3:17: rateLimit.requestsPerMinute"},
+		},
+		{
+			name: "json nested validation",
+			file: "config.json",
+			data: "{\n  \"mcpServers\": {\n    \"calc\": {\"type\": \"bogus\"}\n  }\n}",
+			want: []string{"config.json:3:14: mcpServers.calc.type"},
+		},
+		{
+			name: "json syntax error",
+			file: "config.json",
+			data: "{\n  \"mcpServers\": {,\n}",
+			want: []string{"config.json:2:19: 语法错误"},
+		},
+		{
+			name: "yaml decode errors",
+			file: "config.yaml",
+			data: "mcpServers:\n  calc:\n    type: stdio\nsessionIdleTTL: -1m\nrateLimit:\n  requestsPerMinute: many\nfoo: 1\n",
+			want: []string{"config.yaml:4:1: sessionIdleTTL", "config.yaml:6:3: rateLimit.requestsPerMinute", "config.yaml:7:1: foo"},
+		},
+		{
+			name: "yaml validation",
+			file: "config.yaml",
+			data: "mcpServers:\n  calc:\n    type: bogus\nlocale: xx\n",
+			want: []string{"config.yaml:3:5: mcpServers.calc.type", "config.yaml:4:1: locale"},
+		},
+		{
+			name: "toml",
+			file: "config.toml",
+			data: "turnTimeout = \"60s\"\n\n[mcpServers.calc]\ntype = \"bogus\"\n",
+			want: []string{"config.toml:4:1: mcpServers.calc.type"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseConfig(tt.file, []byte(tt.data))
+			if got := errorLocations(err); !slices.Equal(got, tt.want) {
+				t.Errorf("got %q, want %q\n%v", got, tt.want, err)
+			}
+		})
+	}
+}
+
+// 环境配置中写出的字段按环境配置文件定位, 其余的按基础配置定位
+func TestConfigErrorPositionsWithOverlay(t *testing.T) {
+	dir := t.TempDir()
+	base := filepath.Join(dir, "config.json")
+	if err := os.WriteFile(base, []byte("{\n  \"mcpServers\": {\n    \"calc\": {\"type\": \"bogus\"}\n  }\n}"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "config.dev.json"), []byte("{\n  \"locale\": \"xx\"\n}"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("APP_ENV", "dev")
+	_, err := LoadConfig(base)
+	want := []string{
+		filepath.Join(dir, "config.dev.json") + ":2:3: locale",
+		base + ":3:14: mcpServers.calc.type",
+	}
+	slices.Sort(want)
+	if got := errorLocations(err); !slices.Equal(got, want) {
+		t.Errorf("got %q, want %q\n%v", got, want, err)
+	}
+}
+
+func TestSearchRejectsEncryptedHistory(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		wantErr bool
+	}{
+		{"search only", `{"search": {"db": "data/search.db"}}`, false},
+		{"encryption only", `{"history": {"dir": "data/sessions", "encryption": {"keyEnv": "KEY"}}}`, false},
+		{"search with plaintext history", `{"history": {"dir": "data/sessions"}, "search": {"db": "data/search.db"}}`, false},
+		{"search with encrypted history", `{"history": {"dir": "data/sessions", "encryption": {"keyEnv": "KEY"}}, "search": {"db": "data/search.db"}}`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := parseTestConfig(tt.config)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !strings.Contains(err.Error(), "history.encryption") {
+				t.Errorf("error does not explain the conflict: %v", err)
+			}
+		})
+	}
+}
+
+func TestPurgeRetention(t *testing.T) {
+	tests := []struct {
+		config  string
+		wantErr bool
+	}{
+		{`{"purge": {"retention": "720h"}}`, false},
+		{`{"purge": {"retention": "720h", "file": "data/purges.json"}}`, false},
+		{`{"purge": {}}`, true},
+		{`{"purge": {"retention": "-1h"}}`, true},
+	}
+	for _, tt := range tests {
+		err := parseTestConfig(tt.config)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: err = %v, wantErr %v", tt.config, err, tt.wantErr)
+		}
+		if err != nil && !strings.Contains(err.Error(), "purge.retention") {
+			t.Errorf("%s: error does not name the field: %v", tt.config, err)
+		}
+	}
+}
+
+func TestSessionIdleTTL(t *testing.T) {
+	cfg, err := ParseConfig("config.json", []byte(`{"mcpServers": {}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 没有配置时不移出会话, 没有持久化的会话不会丢失
+	if cfg.SessionIdle != 0 {
+		t.Errorf("default sessionIdleTTL = %v, want 0", cfg.SessionIdle)
+	}
+	if err := parseTestConfig(`{"sessionIdleTTL": "-1m"}`); err == nil || !strings.Contains(err.Error(), "sessionIdleTTL") {
+		t.Errorf("negative sessionIdleTTL: err = %v", err)
+	}
+}
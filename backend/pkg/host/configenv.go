@@ -0,0 +1,69 @@
+package host
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"runtime"
+)
+
+// ${VAR} 或 ${VAR:-缺省值}, $$ 表示字面的 $
+var envRefRe = regexp.MustCompile(`\$\$|\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// expandEnv 展开字符串中引用的环境变量, 返回未设置且没有缺省值的变量
+func expandEnv(s string) (string, []string) {
+	var missing []string
+	out := envRefRe.ReplaceAllStringFunc(s, func(ref string) string {
+		if ref == "$$" {
+			return "$"
+		}
+		m := envRefRe.FindStringSubmatch(ref)
+		if v, ok := os.LookupEnv(m[1]); ok {
+			return v
+		}
+		if m[2] != "" {
+			return m[3]
+		}
+		missing = append(missing, m[1])
+		return ""
+	})
+	return out, missing
+}
+
+// expandEnv 加载时展开 MCP 服务的 command (包括当前系统的 commandWindows 等), args, url, env 和 headers 中引用的环境变量,
+// 密钥之类的值不用写进配置文件
+func (cfg *MCPConfig) expandEnv(doc *configDoc) []error {
+	var errs []error
+	expand := func(path string, s *string) {
+		v, missing := expandEnv(*s)
+		for _, name := range missing {
+			errs = append(errs, doc.errorAt(path, -1, doc.t("config.env_missing", name)))
+		}
+		*s = v
+	}
+	for _, name := range sortedKeys(cfg.MCPServers) {
+		s := cfg.MCPServers[name]
+		path := "mcpServers." + name
+		expand(path+".command", &s.Command)
+		// 只展开当前系统使用的命令, 其他系统的命令可能引用这里没有的变量
+		if field, c := s.platformCommand(runtime.GOOS); c != nil {
+			expand(path+"."+field, c)
+		}
+		expand(path+".url", &s.URL)
+		for i := range s.Args {
+			expand(fmt.Sprintf("%s.args[%d]", path, i), &s.Args[i])
+		}
+		for _, k := range sortedKeys(s.Env) {
+			v := s.Env[k]
+			expand(path+".env."+k, &v)
+			s.Env[k] = v
+		}
+		for _, k := range sortedKeys(s.Headers) {
+			v := s.Headers[k]
+			expand(path+".headers."+k, &v)
+			s.Headers[k] = v
+		}
+		cfg.MCPServers[name] = s
+	}
+	return errs
+}
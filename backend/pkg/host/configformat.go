@@ -0,0 +1,284 @@
+package host
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pelletier/go-toml/v2"
+	"github.com/pelletier/go-toml/v2/unstable"
+	"gopkg.in/yaml.v3"
+)
+
+// 支持的配置文件格式, 按扩展名识别, 字段和 JSON 完全相同
+const (
+	formatJSON = "json"
+	formatYAML = "yaml"
+	formatTOML = "toml"
+)
+
+// defaultConfigFiles 未指定配置文件时依次查找
+var defaultConfigFiles = []string{"config.json", "config.yaml", "config.yml", "config.toml"}
+
+func configFormat(file string) string {
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".yaml", ".yml":
+		return formatYAML
+	case ".toml":
+		return formatTOML
+	default:
+		return formatJSON
+	}
+}
+
+// FindConfigFile 返回第一个存在的缺省配置文件, 都不存在时返回 config.json (随后报文件不存在)
+func FindConfigFile() string {
+	for _, name := range defaultConfigFiles {
+		if _, err := os.Stat(name); err == nil {
+			return name
+		}
+	}
+	return defaultConfigFiles[0]
+}
+
+// toJSON 把 YAML 或 TOML 转换为 JSON, 之后的解码和校验与 JSON 配置相同;
+// 同时按原文件记录每个字段的位置, 错误信息中的行列号指向原文件
+func (d *configDoc) toJSON() error {
+	var v any
+	var err error
+	switch d.format {
+	case formatYAML:
+		v, err = d.indexYAML()
+	case formatTOML:
+		v, err = d.indexTOML()
+	}
+	if err != nil {
+		return err
+	}
+	if v == nil {
+		v = map[string]any{} // 空文件
+	}
+	d.data, err = json.Marshal(v)
+	if err != nil {
+		return d.errorAt("", -1, d.t("config.syntax", err))
+	}
+	d.converted = true
+	return nil
+}
+
+var yamlLineRe = regexp.MustCompile(`^yaml: line (\d+): `)
+
+func (d *configDoc) indexYAML() (any, error) {
+	var root yaml.Node
+	if err := yaml.Unmarshal(d.src, &root); err != nil {
+		msg := err.Error()
+		offset := int64(-1)
+		if m := yamlLineRe.FindStringSubmatch(msg); m != nil {
+			line, _ := strconv.Atoi(m[1])
+			offset = d.offsetOf(line, 1)
+			msg = msg[len(m[0]):]
+		}
+		return nil, d.errorAt("", offset, d.t("config.syntax", msg))
+	}
+	if len(root.Content) == 0 {
+		return nil, nil
+	}
+	return d.walkYAML("", root.Content[0])
+}
+
+func (d *configDoc) walkYAML(path string, n *yaml.Node) (any, error) {
+	switch n.Kind {
+	case yaml.AliasNode:
+		return d.walkYAML(path, n.Alias)
+	case yaml.MappingNode:
+		m := make(map[string]any, len(n.Content)/2)
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			k, v := n.Content[i], n.Content[i+1]
+			if k.Kind == yaml.ScalarNode && k.Tag == "!!merge" {
+				// <<: *alias 合并锚点中的字段
+				merged, err := d.walkYAML(path, v)
+				if err != nil {
+					return nil, err
+				}
+				if mm, ok := merged.(map[string]any); ok {
+					for mk, mv := range mm {
+						if _, exists := m[mk]; !exists {
+							m[mk] = mv
+						}
+					}
+				}
+				continue
+			}
+			child := joinPath(path, k.Value)
+			if _, ok := d.pos[child]; !ok {
+				d.pos[child] = d.offsetOf(k.Line, k.Column)
+			}
+			val, err := d.walkYAML(child, v)
+			if err != nil {
+				return nil, err
+			}
+			m[k.Value] = val
+		}
+		return m, nil
+	case yaml.SequenceNode:
+		s := make([]any, len(n.Content))
+		for i, item := range n.Content {
+			child := fmt.Sprintf("%s[%d]", path, i)
+			if _, ok := d.pos[child]; !ok {
+				d.pos[child] = d.offsetOf(item.Line, item.Column)
+			}
+			val, err := d.walkYAML(child, item)
+			if err != nil {
+				return nil, err
+			}
+			s[i] = val
+		}
+		return s, nil
+	case yaml.ScalarNode:
+		var v any
+		if err := n.Decode(&v); err != nil {
+			return nil, d.errorAt(path, d.offsetOf(n.Line, n.Column), d.t("config.syntax", err))
+		}
+		return v, nil
+	}
+	return nil, nil
+}
+
+func (d *configDoc) indexTOML() (any, error) {
+	var v map[string]any
+	if err := toml.Unmarshal(d.src, &v); err != nil {
+		var decodeErr *toml.DecodeError
+		if errors.As(err, &decodeErr) {
+			line, col := decodeErr.Position()
+			return nil, d.errorAt("", d.offsetOf(line, col), d.t("config.syntax", decodeErr))
+		}
+		return nil, d.errorAt("", -1, d.t("config.syntax", err))
+	}
+
+	// 语法已经检查过, 这里只记录字段位置
+	// [[table]] 每出现一次对应数组的下一个元素, 后续的键都属于最近的元素
+	p := unstable.Parser{}
+	p.Reset(d.src)
+	arrays := map[string]int{}
+	resolve := func(parts []string) string {
+		path := ""
+		for _, part := range parts {
+			path = joinPath(path, part)
+			if n, ok := arrays[path]; ok {
+				path = fmt.Sprintf("%s[%d]", path, n-1)
+			}
+		}
+		return path
+	}
+	current := ""
+	for p.NextExpression() {
+		expr := p.Expression()
+		switch expr.Kind {
+		case unstable.Table:
+			parts, offsets := tomlKey(expr)
+			current = d.recordTOMLKey(resolve(parts[:len(parts)-1]), parts[len(parts)-1:], offsets[len(offsets)-1:])
+		case unstable.ArrayTable:
+			parts, offsets := tomlKey(expr)
+			table := d.recordTOMLKey(resolve(parts[:len(parts)-1]), parts[len(parts)-1:], offsets[len(offsets)-1:])
+			arrays[table]++
+			current = fmt.Sprintf("%s[%d]", table, arrays[table]-1)
+			d.pos[current] = offsets[len(offsets)-1]
+		case unstable.KeyValue:
+			d.indexTOMLKeyValue(current, expr)
+		}
+	}
+	return v, nil
+}
+
+// tomlKey 取表头或键值对的 (可能带点的) 键及各部分在文件中的偏移
+func tomlKey(n *unstable.Node) ([]string, []int64) {
+	var parts []string
+	var offsets []int64
+	it := n.Key()
+	for it.Next() {
+		k := it.Node()
+		parts = append(parts, string(k.Data))
+		offsets = append(offsets, int64(k.Raw.Offset))
+	}
+	return parts, offsets
+}
+
+// recordTOMLKey 记录 base 下各级键的位置, 返回完整路径
+func (d *configDoc) recordTOMLKey(base string, parts []string, offsets []int64) string {
+	path := base
+	for i, part := range parts {
+		path = joinPath(path, part)
+		if _, ok := d.pos[path]; !ok {
+			d.pos[path] = offsets[i]
+		}
+	}
+	return path
+}
+
+func (d *configDoc) indexTOMLKeyValue(base string, kv *unstable.Node) int64 {
+	parts, offsets := tomlKey(kv)
+	path := d.recordTOMLKey(base, parts, offsets)
+	d.indexTOMLValue(path, kv.Value())
+	return offsets[0]
+}
+
+// indexTOMLValue 记录内联表和数组元素的位置
+func (d *configDoc) indexTOMLValue(path string, v *unstable.Node) int64 {
+	switch v.Kind {
+	case unstable.InlineTable:
+		first := int64(-1)
+		it := v.Children()
+		for it.Next() {
+			off := d.indexTOMLKeyValue(path, it.Node())
+			if first < 0 {
+				first = off
+			}
+		}
+		return first
+	case unstable.Array:
+		it := v.Children()
+		for i := 0; it.Next(); i++ {
+			child := fmt.Sprintf("%s[%d]", path, i)
+			if off := d.indexTOMLValue(child, it.Node()); off >= 0 {
+				d.pos[child] = off
+			}
+		}
+		return -1
+	default:
+		if v.Raw.Length == 0 {
+			return -1
+		}
+		return int64(v.Raw.Offset)
+	}
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// offsetOf 把行列号 (从 1 开始, 列按字符计) 转换为原文件中的字节偏移
+func (d *configDoc) offsetOf(line, col int) int64 {
+	off := 0
+	for l := 1; l < line; l++ {
+		i := bytes.IndexByte(d.src[off:], '\n')
+		if i < 0 {
+			return int64(len(d.src))
+		}
+		off += i + 1
+	}
+	for c := 1; c < col && off < len(d.src) && d.src[off] != '\n'; c++ {
+		_, size := utf8.DecodeRune(d.src[off:])
+		off += size
+	}
+	return int64(off)
+}
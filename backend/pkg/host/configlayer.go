@@ -0,0 +1,88 @@
+package host
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// appEnvVar 指定运行环境, 比如 dev、staging、prod; 设置后在基础配置上叠加 config.<env>.<ext>
+const appEnvVar = "APP_ENV"
+
+// envConfigFile 返回环境配置文件的路径: 和基础配置同目录同格式, 比如 config.json -> config.prod.json
+func envConfigFile(base, env string) string {
+	ext := filepath.Ext(base)
+	return strings.TrimSuffix(base, ext) + "." + env + ext
+}
+
+// loadConfigDoc 读取配置文件; 设置了 APP_ENV 且存在对应的环境配置时, 把它叠加到基础配置上
+func loadConfigDoc(configPath string) (*configDoc, error) {
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := newConfigDoc(configPath, data)
+	if err != nil {
+		return nil, err
+	}
+	env := os.Getenv(appEnvVar)
+	if env == "" {
+		return doc, nil
+	}
+	overlayPath := envConfigFile(configPath, env)
+	data, err = os.ReadFile(overlayPath)
+	if os.IsNotExist(err) {
+		logf("config.overlay_missing", appEnvVar, env, overlayPath)
+		return doc, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	overlay, err := newConfigDoc(overlayPath, data)
+	if err != nil {
+		return nil, err
+	}
+	if err := doc.merge(overlay); err != nil {
+		return nil, err
+	}
+	logf("config.overlay_applied", overlayPath)
+	return doc, nil
+}
+
+// merge 把环境配置叠加到 d 上: 对象按 key 递归合并 (所以 mcpServers 按服务名合并, 只需写出有变化的字段),
+// 数组和其他值整体替换, 值为 null 时删除基础配置中的该项 (比如生产环境去掉只在开发时使用的服务)。
+// 之后的错误优先定位到环境配置中的字段, 环境配置没有写的字段定位到基础配置
+func (d *configDoc) merge(overlay *configDoc) error {
+	var base, top any
+	if err := json.Unmarshal(d.data, &base); err != nil {
+		return d.errorAt("", -1, d.t("config.syntax", err))
+	}
+	if err := json.Unmarshal(overlay.data, &top); err != nil {
+		return overlay.errorAt("", -1, overlay.t("config.syntax", err))
+	}
+	merged, err := json.Marshal(mergeConfigValue(base, top))
+	if err != nil {
+		return d.errorAt("", -1, d.t("config.syntax", err))
+	}
+	d.data = merged
+	d.converted = true
+	d.overlay = overlay
+	return nil
+}
+
+func mergeConfigValue(base, top any) any {
+	baseMap, ok1 := base.(map[string]any)
+	topMap, ok2 := top.(map[string]any)
+	if !ok1 || !ok2 {
+		return top
+	}
+	for k, v := range topMap {
+		if v == nil {
+			delete(baseMap, k)
+			continue
+		}
+		baseMap[k] = mergeConfigValue(baseMap[k], v)
+	}
+	return baseMap
+}
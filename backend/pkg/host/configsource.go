@@ -0,0 +1,410 @@
+package host
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"maps"
+	"net/http"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var configSourceUpdates = metrics.Counter("config_source_updates_total", "Number of MCP server config changes received from etcd or Consul.", "status")
+
+var configBackends = []string{"etcd", "consul"}
+
+const (
+	configWatchRetry = 5 * time.Second // 读取或监听失败后的重试间隔
+	consulWait       = "5m"            // Consul 阻塞查询的最长等待
+)
+
+// configSource 是保存 MCP 服务配置的键值存储, 值的格式和配置文件相同, 只使用其中的 mcpServers; key 不存在时值为 nil
+type configSource interface {
+	// get 读取当前的值和版本
+	get(ctx context.Context) ([]byte, int64, error)
+	// watch 阻塞到值在 version 之后发生变化, 返回新的值和版本; 等待超时时返回原来的版本
+	watch(ctx context.Context, version int64) ([]byte, int64, error)
+	// name 用于日志和配置错误的位置, 比如 consul:mcp-host/config
+	name() string
+}
+
+func newConfigSource(cfg *ConfigSourceConfig) configSource {
+	addr := strings.TrimRight(cfg.Address, "/")
+	if cfg.Backend == "consul" {
+		return &consulSource{addr: addr, key: strings.TrimLeft(cfg.Key, "/"), token: cfg.Token}
+	}
+	return &etcdSource{addr: addr, key: cfg.Key, token: cfg.Token}
+}
+
+// consulSource 通过 Consul KV 的 HTTP API 读取配置, 用阻塞查询 (?index=) 监听变更
+type consulSource struct {
+	addr, key, token string
+}
+
+func (s *consulSource) name() string { return "consul:" + s.key }
+
+func (s *consulSource) get(ctx context.Context) ([]byte, int64, error) {
+	return s.watch(ctx, 0)
+}
+
+func (s *consulSource) watch(ctx context.Context, index int64) ([]byte, int64, error) {
+	u := s.addr + "/v1/kv/" + s.key
+	if index > 0 {
+		u += "?index=" + strconv.FormatInt(index, 10) + "&wait=" + consulWait
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	if s.token != "" {
+		req.Header.Set("X-Consul-Token", s.token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	// 索引为 0 的阻塞查询会立即返回, 按 Consul 文档把无效的索引当作 1
+	next, _ := strconv.ParseInt(resp.Header.Get("X-Consul-Index"), 10, 64)
+	if next < 1 {
+		next = 1
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, next, nil
+	default:
+		return nil, 0, newError("configsource.status", s.name(), resp.Status)
+	}
+	var kvs []struct {
+		Value []byte `json:"Value"` // base64
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&kvs); err != nil {
+		return nil, 0, err
+	}
+	if len(kvs) == 0 {
+		return nil, next, nil
+	}
+	return kvs[0].Value, next, nil
+}
+
+// etcdSource 通过 etcd v3 的 JSON 网关 (/v3/kv/range, /v3/watch) 读取配置, 版本是 etcd 的 revision
+type etcdSource struct {
+	addr, key, token string
+}
+
+type etcdKV struct {
+	Value       []byte `json:"value"`
+	ModRevision int64  `json:"mod_revision,string"`
+}
+
+func (s *etcdSource) name() string { return "etcd:" + s.key }
+
+func (s *etcdSource) post(ctx context.Context, path string, body any) (*http.Response, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.addr+path, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.token != "" {
+		req.Header.Set("Authorization", s.token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, newError("configsource.status", s.name(), resp.Status)
+	}
+	return resp, nil
+}
+
+func (s *etcdSource) get(ctx context.Context) ([]byte, int64, error) {
+	resp, err := s.post(ctx, "/v3/kv/range", map[string][]byte{"key": []byte(s.key)})
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	var body struct {
+		Header struct {
+			Revision int64 `json:"revision,string"`
+		} `json:"header"`
+		Kvs []etcdKV `json:"kvs"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, 0, err
+	}
+	if len(body.Kvs) == 0 {
+		return nil, body.Header.Revision, nil
+	}
+	return body.Kvs[0].Value, body.Header.Revision, nil
+}
+
+func (s *etcdSource) watch(ctx context.Context, revision int64) ([]byte, int64, error) {
+	type createRequest struct {
+		Key           []byte `json:"key"`
+		StartRevision int64  `json:"start_revision,string"`
+	}
+	resp, err := s.post(ctx, "/v3/watch", map[string]createRequest{
+		"create_request": {Key: []byte(s.key), StartRevision: revision + 1},
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	// 网关把监听到的事件逐个以 JSON 对象的形式推送, 第一个对象只确认监听已经建立
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var msg struct {
+			Result struct {
+				Events []struct {
+					Type string `json:"type"` // PUT 是缺省值, 不出现在 JSON 中
+					Kv   etcdKV `json:"kv"`
+				} `json:"events"`
+				Canceled        bool   `json:"canceled"`
+				CancelReason    string `json:"cancel_reason"`
+				CompactRevision int64  `json:"compact_revision,string"`
+			} `json:"result"`
+			Error *struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if err := dec.Decode(&msg); err != nil {
+			if err == io.EOF {
+				return nil, revision, nil
+			}
+			return nil, 0, err
+		}
+		if msg.Error != nil {
+			return nil, 0, newError("configsource.status", s.name(), msg.Error.Message)
+		}
+		if r := msg.Result; r.Canceled {
+			// 要监听的版本已经被压缩掉, 重新读取当前的值
+			if r.CompactRevision > 0 {
+				return s.get(ctx)
+			}
+			return nil, 0, newError("configsource.status", s.name(), r.CancelReason)
+		}
+		if n := len(msg.Result.Events); n > 0 {
+			ev := msg.Result.Events[n-1]
+			if ev.Type == "DELETE" {
+				return nil, ev.Kv.ModRevision, nil
+			}
+			return ev.Kv.Value, ev.Kv.ModRevision, nil
+		}
+	}
+}
+
+// parseRemoteServers 按配置文件的规则解析和校验远程配置中的 mcpServers, 值为空时没有远程服务
+func parseRemoteServers(name string, value []byte) (map[string]MCPServer, error) {
+	if len(bytes.TrimSpace(value)) == 0 {
+		return map[string]MCPServer{}, nil
+	}
+	cfg, err := ParseConfig(name, value)
+	if err != nil {
+		return nil, err
+	}
+	return cfg.MCPServers, nil
+}
+
+// mergeServers 合并配置文件和远程配置中的服务, 同名时以远程配置为准
+func mergeServers(local, remote map[string]MCPServer) map[string]MCPServer {
+	servers := maps.Clone(local)
+	if servers == nil {
+		servers = map[string]MCPServer{}
+	}
+	maps.Copy(servers, remote)
+	return servers
+}
+
+// loadRemoteServers 读取远程配置并和配置文件中的服务合并, 返回合并后的服务和远程配置的版本
+func loadRemoteServers(ctx context.Context, src configSource, local map[string]MCPServer) (map[string]MCPServer, int64, error) {
+	value, version, err := src.get(ctx)
+	if err != nil {
+		return nil, 0, newError("configsource.read_failed", src.name(), err)
+	}
+	remote, err := parseRemoteServers(src.name(), value)
+	if err != nil {
+		return nil, 0, err
+	}
+	return mergeServers(local, remote), version, nil
+}
+
+// configWatcher 监听 etcd 或 Consul 中的 MCP 服务配置, 变化时增加、重新连接或断开服务, 不需要重启。
+// 新的配置有错误时记录日志并保持当前的服务不变
+type configWatcher struct {
+	cc      *ChatClient
+	src     configSource
+	local   map[string]MCPServer // 配置文件中的服务
+	configs map[string]MCPServer // 当前已连接的服务使用的配置, 不包括进程内的服务
+	version int64                // 为 0 时还没有读取成功
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func newConfigWatcher(cc *ChatClient, src configSource, local, servers map[string]MCPServer, version int64) *configWatcher {
+	w := &configWatcher{cc: cc, src: src, local: local, configs: map[string]MCPServer{}, version: version}
+	for _, c := range cc.servers() {
+		if cfg, ok := servers[c.Name]; ok {
+			w.configs[c.Name] = cfg
+		}
+	}
+	w.ctx, w.cancel = context.WithCancel(context.Background())
+	return w
+}
+
+// Start 开始监听, 只在 serve 中启动
+func (w *configWatcher) Start() {
+	if w == nil {
+		return
+	}
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		w.run(w.ctx)
+	}()
+}
+
+// Close 停止监听, 正在连接的服务被取消
+func (w *configWatcher) Close() {
+	if w == nil {
+		return
+	}
+	w.cancel()
+	w.wg.Wait()
+}
+
+func (w *configWatcher) run(ctx context.Context) {
+	for {
+		var value []byte
+		var version int64
+		var err error
+		if w.version == 0 {
+			value, version, err = w.src.get(ctx)
+		} else {
+			value, version, err = w.src.watch(ctx, w.version)
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			logf("configsource.watch_failed", w.src.name(), err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(configWatchRetry):
+			}
+			continue
+		}
+		if version == w.version {
+			continue
+		}
+		w.version = version
+		remote, err := parseRemoteServers(w.src.name(), value)
+		if err != nil {
+			configSourceUpdates.Inc("invalid")
+			logf("configsource.invalid", w.src.name(), err)
+			continue
+		}
+		configSourceUpdates.Inc("applied")
+		w.apply(ctx, mergeServers(w.local, remote))
+	}
+}
+
+// apply 按新的配置调整服务: 新增和配置变化的服务重新连接, 成功后替换旧的连接, 移除的服务断开连接。
+// 连接失败时保留旧的连接 (如果有), 下次配置变化时再尝试
+func (w *configWatcher) apply(ctx context.Context, servers map[string]MCPServer) {
+	var next, stale []*MCPClient
+	connected := map[string]*MCPClient{}
+	for _, c := range w.cc.servers() {
+		if _, ok := w.configs[c.Name]; ok {
+			connected[c.Name] = c
+		} else {
+			next = append(next, c) // 进程内的服务不受远程配置影响
+		}
+	}
+	inProcess := slices.Clone(next)
+
+	configs := map[string]MCPServer{}
+	added, changed, removed := 0, 0, 0
+	for _, name := range sortedKeys(servers) {
+		cfg := servers[name]
+		if slices.ContainsFunc(inProcess, func(c *MCPClient) bool { return c.Name == name }) {
+			logf("mcp.duplicate_server", name)
+			continue
+		}
+		old, ok := connected[name]
+		if ok && reflect.DeepEqual(w.configs[name], cfg) {
+			next = append(next, old)
+			configs[name] = cfg
+			continue
+		}
+		c, errs := connectMCPClient(ctx, name, cfg)
+		for _, err := range errs {
+			logf("configsource.server_failed", name, err)
+		}
+		if c == nil {
+			if ok {
+				next = append(next, old)
+				configs[name] = w.configs[name]
+			}
+			continue
+		}
+		c.chaos = w.cc.chaos
+		next = append(next, c)
+		configs[name] = cfg
+		if ok {
+			stale = append(stale, old)
+			changed++
+		} else {
+			added++
+		}
+	}
+	for name, old := range connected {
+		if _, ok := servers[name]; !ok {
+			stale = append(stale, old)
+			removed++
+		}
+	}
+
+	w.cc.setServers(next)
+	w.configs = configs
+	// 正在使用旧连接的工具调用会失败, 和服务重启时的表现相同
+	for _, c := range stale {
+		c.Close()
+	}
+	w.cc.tools.forget(stale...)
+	logf("configsource.applied", w.src.name(), added, changed, removed, len(next))
+}
+
+// servers 返回当前连接的 MCP 服务, 配置了 configSource 时会随远程配置变化
+func (cc *ChatClient) servers() []*MCPClient {
+	cc.serversMu.RLock()
+	defer cc.serversMu.RUnlock()
+	return cc.mcpClients
+}
+
+func (cc *ChatClient) setServers(clients []*MCPClient) {
+	cc.serversMu.Lock()
+	cc.mcpClients = clients
+	cc.serversMu.Unlock()
+	cc.health.setClients(clients)
+}
+
+// llmOnly 为 true 表示没有可用的 MCP 服务, 只能和大模型对话
+func (cc *ChatClient) llmOnly() bool {
+	return len(cc.servers()) == 0
+}
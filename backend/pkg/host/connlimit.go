@@ -0,0 +1,111 @@
+package host
+
+import (
+	"net/http"
+	"net/netip"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/guobinqiu/mcp-host-web/chat"
+)
+
+var wsRejected = metrics.Counter("ws_connections_rejected_total", "Number of WebSocket connections rejected by connection quotas.", "reason")
+
+// 连接被拒绝的原因, 作为 rejected 消息的 status 发给客户端, 也是 ws_connections_rejected_total 的 reason 标签
+const (
+	rejectServerFull = "server_full"
+	rejectUserLimit  = "user_limit"
+	rejectIPLimit    = "ip_limit"
+)
+
+// 按来源限制连接数时 IPv6 地址按 /64 网段合并: 一个客户端通常分到整个 /64, 可以随意换用其中的地址
+const ipv6LimitPrefix = 64
+
+// connLimiter 限制同时打开的 WebSocket 连接数 (包括旁观连接), 避免连接耗尽服务端资源; 只统计本副本
+type connLimiter struct {
+	cfg ConnectionsConfig
+
+	mu    sync.Mutex
+	total int
+	users map[string]int
+	ips   map[string]int
+}
+
+// newConnLimiter 未配置 connections 时返回 nil, 不限制
+func newConnLimiter(cfg *ConnectionsConfig) *connLimiter {
+	if cfg == nil {
+		return nil
+	}
+	return &connLimiter{cfg: *cfg, users: make(map[string]int), ips: make(map[string]int)}
+}
+
+// ipLimitKey 返回按来源计数的 key: IPv4 (包括映射到 IPv6 的) 为地址本身, IPv6 为所在的 /64 网段
+func ipLimitKey(ip string) string {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return ip
+	}
+	addr = addr.Unmap().WithZone("")
+	if addr.Is4() {
+		return addr.String()
+	}
+	prefix, _ := addr.Prefix(ipv6LimitPrefix)
+	return prefix.String()
+}
+
+// acquire 占用一个连接名额, 超出限制时返回拒绝的原因; 匿名用户不按用户限制, IPv6 来源按 /64 网段限制
+func (l *connLimiter) acquire(user, ip string) (release func(), reason string) {
+	if l == nil {
+		return func() {}, ""
+	}
+	ip = ipLimitKey(ip)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	switch {
+	case l.cfg.MaxTotal > 0 && l.total >= l.cfg.MaxTotal:
+		return nil, rejectServerFull
+	case l.cfg.MaxPerUser > 0 && user != "" && l.users[user] >= l.cfg.MaxPerUser:
+		return nil, rejectUserLimit
+	case l.cfg.MaxPerIP > 0 && l.ips[ip] >= l.cfg.MaxPerIP:
+		return nil, rejectIPLimit
+	}
+	l.total++
+	if user != "" {
+		l.users[user]++
+	}
+	l.ips[ip]++
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			l.total--
+			if user != "" {
+				if l.users[user]--; l.users[user] <= 0 {
+					delete(l.users, user)
+				}
+			}
+			if l.ips[ip]--; l.ips[ip] <= 0 {
+				delete(l.ips, ip)
+			}
+		})
+	}, ""
+}
+
+// reject 告诉客户端连接被拒绝的原因 (type=rejected, status 为原因), 再关闭连接:
+// 协议版本不支持时以 1003 (Unsupported Data) 关闭, 重试也不会成功; 其他原因以 1013 (Try Again Later) 关闭
+func reject(conn *wsConn, r *http.Request, ip, reason string) {
+	wsRejected.Inc(reason)
+	text := T(requestLocale(r), "ws.rejected_"+reason)
+	logf("ws.rejected", ip, reason)
+	if err := conn.write(&chat.ChatMessage{Type: "rejected", Status: reason, Content: text}, broadcastWriteTimeout); err != nil {
+		return
+	}
+	code := websocket.CloseTryAgainLater
+	if reason == rejectUnsupportedProtocol {
+		code = websocket.CloseUnsupportedData
+	}
+	_ = conn.ws.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(broadcastWriteTimeout))
+}
@@ -0,0 +1,43 @@
+package host
+
+import "testing"
+
+func TestIPLimitKey(t *testing.T) {
+	for ip, want := range map[string]string{
+		"192.0.2.1":                  "192.0.2.1",
+		"::ffff:192.0.2.1":           "192.0.2.1",
+		"2001:db8:1:2:aaaa::1":       "2001:db8:1:2::/64",
+		"2001:db8:1:2:ffff:ffff:1:2": "2001:db8:1:2::/64",
+		"fe80::1%eth0":               "fe80::/64",
+		"not an ip":                  "not an ip",
+	} {
+		if got := ipLimitKey(ip); got != want {
+			t.Errorf("ipLimitKey(%q) = %q, want %q", ip, got, want)
+		}
+	}
+}
+
+// 同一 /64 中换用不同的 IPv6 地址不能绕过每个来源的连接数限制, 其他网段不受影响
+func TestConnLimiterIPv6Prefix(t *testing.T) {
+	l := newConnLimiter(&ConnectionsConfig{MaxPerIP: 2})
+	var releases []func()
+	for _, ip := range []string{"2001:db8:1:2::1", "2001:db8:1:2::2"} {
+		release, reason := l.acquire("", ip)
+		if reason != "" {
+			t.Fatalf("acquire(%s) rejected: %s", ip, reason)
+		}
+		releases = append(releases, release)
+	}
+	if _, reason := l.acquire("", "2001:db8:1:2:dead:beef::3"); reason != rejectIPLimit {
+		t.Errorf("third address in the same /64: reason = %q, want %q", reason, rejectIPLimit)
+	}
+	release, reason := l.acquire("", "2001:db8:1:3::1")
+	if reason != "" {
+		t.Errorf("address in another /64 rejected: %s", reason)
+	}
+	release()
+	releases[0]()
+	if _, reason := l.acquire("", "2001:db8:1:2::9"); reason != "" {
+		t.Errorf("acquire after release rejected: %s", reason)
+	}
+}
@@ -0,0 +1,126 @@
+package host
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// contextMessages 按配置裁剪发给大模型的历史: 从最早的轮次开始整轮丢弃, 保证工具调用和结果成对出现;
+// 当前这一轮和固定 (pin) 的消息始终保留。cfg 为 nil 时不裁剪
+func contextMessages(msgs []HistoryMessage, pinned map[int]bool, cfg *ContextConfig) []HistoryMessage {
+	if cfg == nil || (cfg.MaxMessages <= 0 && cfg.MaxTokens <= 0) {
+		return msgs
+	}
+
+	// 按用户消息切分轮次, turns[i] 为第 i 轮第一条消息的下标
+	var turns []int
+	for i, m := range msgs {
+		if i == 0 || m.Role == openai.ChatMessageRoleUser {
+			turns = append(turns, i)
+		}
+	}
+	if len(turns) == 0 {
+		return msgs
+	}
+
+	// 固定的消息先计入用量
+	count, tokens := 0, 0
+	for i := range pinned {
+		if i < len(msgs) {
+			count++
+			tokens += messageTokens(msgs[i])
+		}
+	}
+	fits := func(c, t int) bool {
+		return (cfg.MaxMessages <= 0 || c <= cfg.MaxMessages) && (cfg.MaxTokens <= 0 || t <= cfg.MaxTokens)
+	}
+
+	// 从最新的一轮往前, 放不下时更早的轮次都丢弃 (最新一轮总是保留)
+	keepFrom := len(msgs)
+	for t := len(turns) - 1; t >= 0; t-- {
+		start, end := turns[t], len(msgs)
+		if t+1 < len(turns) {
+			end = turns[t+1]
+		}
+		c, n := count, tokens
+		for i := start; i < end; i++ {
+			if !pinned[i] {
+				c++
+				n += messageTokens(msgs[i])
+			}
+		}
+		if t < len(turns)-1 && !fits(c, n) {
+			break
+		}
+		count, tokens, keepFrom = c, n, start
+	}
+
+	out := make([]HistoryMessage, 0, len(msgs)-keepFrom+len(pinned))
+	for i, m := range msgs {
+		if i >= keepFrom || pinned[i] {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+// messageTokens 粗略估算一条消息的 token 数, 与 estimateTokens 的算法相同
+func messageTokens(m HistoryMessage) int {
+	n := len(m.Content) + 16
+	for _, tc := range m.ToolCalls {
+		n += len(tc.Function.Name) + len(tc.Function.Arguments)
+	}
+	return n / 4
+}
+
+// pinnable 只能固定用户消息和助理的文字回答, 工具调用和结果必须成对出现, 不能单独保留
+func pinnable(m HistoryMessage) bool {
+	switch m.Role {
+	case openai.ChatMessageRoleUser:
+		return true
+	case openai.ChatMessageRoleAssistant:
+		return len(m.ToolCalls) == 0 && m.Content != ""
+	}
+	return false
+}
+
+// GET /api/sessions/{id}/pins 列出固定的消息序号
+// POST /api/sessions/{id}/pins {"index": 3} 固定一条消息, 裁剪上下文时始终保留
+// DELETE /api/sessions/{id}/pins/{index} 取消固定
+func (cc *ChatClient) handlePins(w http.ResponseWriter, r *http.Request) {
+	sess, ok := cc.sessionFor(r, r.PathValue("id"))
+	if !ok {
+		writeError(w, r, http.StatusNotFound, "api.session_not_found")
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, map[string]any{"pins": sess.Pins()})
+	case http.MethodPost:
+		var body struct {
+			Index int `json:"index"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeError(w, r, http.StatusBadRequest, "api.bad_request", err)
+			return
+		}
+		if !sess.Pin(body.Index) {
+			writeError(w, r, http.StatusBadRequest, "api.not_pinnable", body.Index)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"pins": sess.Pins()})
+	case http.MethodDelete:
+		index, err := strconv.Atoi(r.PathValue("index"))
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, "api.bad_request", err)
+			return
+		}
+		sess.Unpin(index)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, r, http.StatusMethodNotAllowed, "api.method_not_allowed")
+	}
+}
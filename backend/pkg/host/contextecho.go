@@ -0,0 +1,141 @@
+package host
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/guobinqiu/mcp-host-web/chat"
+	"github.com/sashabaranov/go-openai"
+)
+
+const (
+	// 每个连接每分钟最多下发的上下文数, 超出的跳过, 避免很长的上下文占满连接
+	contextEchoPerMinute = 20
+	// 每条消息下发的最多字符数, 超出部分截断
+	contextEchoMaxContent = 4000
+)
+
+// contextEcho 把每次发给大模型的完整请求 (脱敏后) 以 type=debug、status=context 的消息下发给开启了 debug_context 的管理员连接,
+// 代替在代码中临时打印上下文。只发给这个连接, 不广播给会话的其他参与者和旁观者
+type contextEcho struct {
+	sessionID string
+	send      func(*chat.ChatMessage) error
+
+	mu      sync.Mutex
+	window  time.Time // 当前一分钟的开始
+	sent    int
+	skipped int // 上次下发之后跳过的请求数
+}
+
+func newContextEcho(sessionID string, send func(*chat.ChatMessage) error) *contextEcho {
+	return &contextEcho{sessionID: sessionID, send: send}
+}
+
+// contextPayload 是 status=context 的消息 content 中的 JSON
+type contextPayload struct {
+	Model    string                         `json:"model"`
+	Messages []openai.ChatCompletionMessage `json:"messages"`
+	Tools    []string                       `json:"tools,omitempty"`   // 只列出工具名, 完整的 schema 见工具列表
+	Skipped  int                            `json:"skipped,omitempty"` // 因为限流而没有下发的请求数
+}
+
+// echo 下发一次请求的上下文, e 为 nil (没有开启) 时什么也不做
+func (e *contextEcho) echo(ctx context.Context, req openai.ChatCompletionRequest) {
+	if e == nil {
+		return
+	}
+	e.mu.Lock()
+	now := time.Now()
+	if now.Sub(e.window) >= time.Minute {
+		e.window, e.sent = now, 0
+	}
+	if e.sent >= contextEchoPerMinute {
+		e.skipped++
+		e.mu.Unlock()
+		return
+	}
+	e.sent++
+	skipped := e.skipped
+	e.skipped = 0
+	e.mu.Unlock()
+
+	payload := contextPayload{Model: req.Model, Messages: redactMessages(req.Messages), Skipped: skipped}
+	for _, t := range req.Tools {
+		if t.Function != nil {
+			payload.Tools = append(payload.Tools, t.Function.Name)
+		}
+	}
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return
+	}
+	if err := e.send(&chat.ChatMessage{Type: "debug", Status: "context", Content: string(b), SessionId: e.sessionID, TraceId: traceFrom(ctx)}); err != nil {
+		logf("ws.write_failed", e.sessionID, err)
+	}
+}
+
+type contextEchoKey struct{}
+
+func withContextEcho(ctx context.Context, e *contextEcho) context.Context {
+	return context.WithValue(ctx, contextEchoKey{}, e)
+}
+
+// contextEchoFrom 没有开启时返回 nil
+func contextEchoFrom(ctx context.Context) *contextEcho {
+	e, _ := ctx.Value(contextEchoKey{}).(*contextEcho)
+	return e
+}
+
+// 看起来像密钥和令牌的内容, 第一组 (如果有) 保留
+var secretPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`\bsk-[A-Za-z0-9_-]{16,}`),
+	regexp.MustCompile(`\beyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`), // JWT
+	regexp.MustCompile(`(?i)(\bbearer\s+)[A-Za-z0-9._~+/-]+=*`),
+	regexp.MustCompile(`(?i)(\b(?:api[_-]?key|access[_-]?token|token|secret|password)["']?\s*[:=]\s*["']?)[^\s"',;&]+`),
+}
+
+// redactMessages 返回脱敏后的副本: 掩盖密钥和令牌, 截断很长的内容, 图片的 data URL 只保留长度
+func redactMessages(msgs []openai.ChatCompletionMessage) []openai.ChatCompletionMessage {
+	out := make([]openai.ChatCompletionMessage, len(msgs))
+	for i, m := range msgs {
+		m.Content = redactText(m.Content)
+		if len(m.MultiContent) > 0 {
+			parts := make([]openai.ChatMessagePart, len(m.MultiContent))
+			for j, p := range m.MultiContent {
+				p.Text = redactText(p.Text)
+				if p.ImageURL != nil && strings.HasPrefix(p.ImageURL.URL, "data:") {
+					img := *p.ImageURL
+					img.URL = fmt.Sprintf("data:...(%d bytes)", len(img.URL))
+					p.ImageURL = &img
+				}
+				parts[j] = p
+			}
+			m.MultiContent = parts
+		}
+		if len(m.ToolCalls) > 0 {
+			calls := make([]openai.ToolCall, len(m.ToolCalls))
+			for j, c := range m.ToolCalls {
+				c.Function.Arguments = redactText(c.Function.Arguments)
+				calls[j] = c
+			}
+			m.ToolCalls = calls
+		}
+		out[i] = m
+	}
+	return out
+}
+
+func redactText(s string) string {
+	for _, re := range secretPatterns {
+		s = re.ReplaceAllString(s, "${1}"+defaultMaskReplacement)
+	}
+	if r := []rune(s); len(r) > contextEchoMaxContent {
+		s = fmt.Sprintf("%s…(%d more)", string(r[:contextEchoMaxContent]), len(r)-contextEchoMaxContent)
+	}
+	return s
+}
@@ -0,0 +1,221 @@
+package host
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	dashboardErrors  = 50 // 保留最近的错误条数
+	dashboardSamples = 40 // 每个工具保留最近的耗时样本数
+)
+
+// Dashboard 订阅事件总线, 在内存中汇总运行状态, 供 /debug/dashboard 展示
+// 只统计本副本的数据, 重启后清空
+type Dashboard struct {
+	mu      sync.Mutex
+	live    map[string]*liveSession
+	errors  []Event
+	latency map[string][]int64 // 工具名 -> 最近的耗时 (毫秒)
+}
+
+type liveSession struct {
+	User     string
+	Since    time.Time
+	Conns    int
+	Turns    int
+	LastTurn time.Time
+}
+
+func NewDashboard(events *EventBus) *Dashboard {
+	d := &Dashboard{live: make(map[string]*liveSession), latency: make(map[string][]int64)}
+	events.Subscribe("dashboard", d.handle)
+	return d
+}
+
+func (d *Dashboard) handle(e Event) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	switch e.Type {
+	case EventSessionStarted:
+		s, ok := d.live[e.SessionID]
+		if !ok {
+			user, _ := e.Data["user"].(string)
+			s = &liveSession{User: user, Since: e.Time}
+			d.live[e.SessionID] = s
+		}
+		s.Conns++
+	case EventSessionEnded:
+		if s, ok := d.live[e.SessionID]; ok {
+			if s.Conns--; s.Conns <= 0 {
+				delete(d.live, e.SessionID)
+			}
+		}
+	case EventTurnFinished:
+		if s, ok := d.live[e.SessionID]; ok {
+			s.Turns++
+			s.LastTurn = e.Time
+		}
+	case EventToolExecuted:
+		tool, _ := e.Data["tool"].(string)
+		ms, _ := e.Data["duration_ms"].(int64)
+		samples := append(d.latency[tool], ms)
+		if len(samples) > dashboardSamples {
+			samples = samples[len(samples)-dashboardSamples:]
+		}
+		d.latency[tool] = samples
+		if errMsg, ok := e.Data["error"]; ok {
+			d.addError(Event{Type: e.Type, SessionID: e.SessionID, Time: e.Time, Data: map[string]any{"stage": "tool " + tool, "error": errMsg}})
+		}
+	case EventError:
+		d.addError(e)
+	}
+}
+
+func (d *Dashboard) addError(e Event) {
+	d.errors = append(d.errors, e)
+	if len(d.errors) > dashboardErrors {
+		d.errors = d.errors[len(d.errors)-dashboardErrors:]
+	}
+}
+
+type dashboardServer struct {
+	Name    string
+	OK      bool
+	Latency time.Duration
+	Error   string
+}
+
+type dashboardSession struct {
+	ID string
+	*liveSession
+}
+
+type dashboardTool struct {
+	Name      string
+	Calls     int
+	Last, P50 int64
+	Sparkline template.HTML
+}
+
+type dashboardError struct {
+	Time      time.Time
+	SessionID string
+	Stage     string
+	Message   string
+}
+
+// snapshot 复制当前数据, 渲染页面时不持有锁
+func (d *Dashboard) snapshot() ([]dashboardSession, []dashboardTool, []dashboardError) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	sessions := make([]dashboardSession, 0, len(d.live))
+	for id, s := range d.live {
+		copied := *s
+		sessions = append(sessions, dashboardSession{ID: id, liveSession: &copied})
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].Since.Before(sessions[j].Since) })
+
+	tools := make([]dashboardTool, 0, len(d.latency))
+	for _, name := range sortedKeys(d.latency) {
+		samples := d.latency[name]
+		sorted := append([]int64(nil), samples...)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+		tools = append(tools, dashboardTool{
+			Name:      name,
+			Calls:     len(samples),
+			Last:      samples[len(samples)-1],
+			P50:       sorted[len(sorted)/2],
+			Sparkline: sparkline(samples),
+		})
+	}
+
+	errs := make([]dashboardError, 0, len(d.errors))
+	for i := len(d.errors) - 1; i >= 0; i-- {
+		e := d.errors[i]
+		stage, _ := e.Data["stage"].(string)
+		errs = append(errs, dashboardError{Time: e.Time, SessionID: e.SessionID, Stage: stage, Message: fmt.Sprint(e.Data["error"])})
+	}
+	return sessions, tools, errs
+}
+
+// sparkline 把耗时样本画成内联 SVG 折线
+func sparkline(samples []int64) template.HTML {
+	const w, h = 160, 24
+	var peak int64 = 1
+	for _, v := range samples {
+		peak = max(peak, v)
+	}
+	points := make([]string, len(samples))
+	for i, v := range samples {
+		x := 0.0
+		if len(samples) > 1 {
+			x = float64(i) * w / float64(len(samples)-1)
+		}
+		y := h - float64(v)*(h-2)/float64(peak) - 1
+		points[i] = fmt.Sprintf("%.1f,%.1f", x, y)
+	}
+	return template.HTML(fmt.Sprintf(`<svg width="%d" height="%d"><polyline fill="none" stroke="#36c" stroke-width="1.5" points="%s"/></svg>`,
+		w, h, strings.Join(points, " ")))
+}
+
+var dashboardTemplate = template.Must(template.New("dashboard").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><meta http-equiv="refresh" content="5"><title>mcp-host dashboard</title>
+<style>body{font:13px sans-serif;margin:20px}table{border-collapse:collapse;margin-bottom:24px}td,th{border:1px solid #ddd;padding:4px 8px;text-align:left}.err{color:#c00}</style>
+</head><body>
+<h2>MCP servers</h2>
+<table><tr><th>name</th><th>status</th><th>ping</th></tr>
+{{range .Servers}}<tr><td>{{.Name}}</td>{{if .OK}}<td>ok</td>{{else}}<td class="err">{{.Error}}</td>{{end}}<td>{{.Latency}}</td></tr>{{end}}
+</table>
+<h2>Live sessions ({{len .Sessions}})</h2>
+<table><tr><th>session</th><th>user</th><th>connected</th><th>connections</th><th>turns</th><th>last turn</th></tr>
+{{range .Sessions}}<tr><td>{{.ID}}</td><td>{{.User}}</td><td>{{.Since.Format "15:04:05"}}</td><td>{{.Conns}}</td><td>{{.Turns}}</td><td>{{if not .LastTurn.IsZero}}{{.LastTurn.Format "15:04:05"}}{{end}}</td></tr>{{end}}
+</table>
+<h2>Tool latency (ms)</h2>
+<table><tr><th>tool</th><th>samples</th><th>last</th><th>p50</th><th>recent</th></tr>
+{{range .Tools}}<tr><td>{{.Name}}</td><td>{{.Calls}}</td><td>{{.Last}}</td><td>{{.P50}}</td><td>{{.Sparkline}}</td></tr>{{end}}
+</table>
+<h2>Recent errors</h2>
+<table><tr><th>time</th><th>session</th><th>stage</th><th>error</th></tr>
+{{range .Errors}}<tr><td>{{.Time.Format "15:04:05"}}</td><td>{{.SessionID}}</td><td>{{.Stage}}</td><td class="err">{{.Message}}</td></tr>{{end}}
+</table>
+<p>generated at {{.Now.Format "2006-01-02 15:04:05"}}</p>
+</body></html>
+`))
+
+// GET /debug/dashboard 服务端渲染的运行状态页面, 每 5 秒自动刷新
+func (cc *ChatClient) handleDashboard(w http.ResponseWriter, r *http.Request) {
+	var servers []dashboardServer
+	for _, mcpClient := range cc.servers() {
+		ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+		start := time.Now()
+		err := mcpClient.Ping(ctx)
+		cancel()
+		s := dashboardServer{Name: mcpClient.Name, OK: err == nil, Latency: time.Since(start).Round(time.Millisecond)}
+		if err != nil {
+			s.Error = err.Error()
+		}
+		servers = append(servers, s)
+	}
+	sort.Slice(servers, func(i, j int) bool { return servers[i].Name < servers[j].Name })
+
+	sessions, tools, errs := cc.dashboard.snapshot()
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	err := dashboardTemplate.Execute(w, map[string]any{
+		"Servers":  servers,
+		"Sessions": sessions,
+		"Tools":    tools,
+		"Errors":   errs,
+		"Now":      time.Now(),
+	})
+	if err != nil {
+		logf("dashboard.render_failed", err)
+	}
+}
@@ -0,0 +1,23 @@
+package host
+
+import (
+	"expvar"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+)
+
+func init() {
+	expvar.Publish("goroutines", expvar.Func(func() any { return runtime.NumGoroutine() }))
+}
+
+// registerDebugHandlers 注册 pprof 和 /debug/vars, 只有 admin 可以访问
+// net/http/pprof 和 expvar 会在 http.DefaultServeMux 上注册不带鉴权的路由, 所以服务使用单独的 ServeMux
+func (cc *ChatClient) registerDebugHandlers(mux *http.ServeMux) {
+	mux.HandleFunc("/debug/pprof/", cc.requireRole(RoleAdmin, pprof.Index))
+	mux.HandleFunc("/debug/pprof/cmdline", cc.requireRole(RoleAdmin, pprof.Cmdline))
+	mux.HandleFunc("/debug/pprof/profile", cc.requireRole(RoleAdmin, pprof.Profile))
+	mux.HandleFunc("/debug/pprof/symbol", cc.requireRole(RoleAdmin, pprof.Symbol))
+	mux.HandleFunc("/debug/pprof/trace", cc.requireRole(RoleAdmin, pprof.Trace))
+	mux.HandleFunc("/debug/vars", cc.requireRole(RoleAdmin, expvar.Handler().ServeHTTP))
+}
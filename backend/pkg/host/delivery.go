@@ -0,0 +1,104 @@
+package host
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/guobinqiu/mcp-host-web/chat"
+)
+
+// 每个会话最多缓存的未确认消息数, 超过后丢弃最早的
+const outboxLimit = 1000
+
+// wsConn 串行化对同一连接的写: 连接自己的对话、outbox 重发和会话内其他连接的广播可能同时写
+type wsConn struct {
+	mu    sync.Mutex
+	ws    *websocket.Conn
+	chaos *chaosInjector // 为 nil 时不注入故障
+}
+
+// write 发送一条消息, timeout 大于 0 时限制写入时间
+func (c *wsConn) write(msg *chat.ChatMessage, timeout time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.chaos.disconnect() {
+		c.ws.Close()
+		return errChaosDisconnect
+	}
+	if c.chaos.dropFrame() {
+		return nil
+	}
+	if timeout > 0 {
+		c.ws.SetWriteDeadline(time.Now().Add(timeout))
+		defer c.ws.SetWriteDeadline(time.Time{})
+	}
+	return writeMessage(c.ws, msg)
+}
+
+// outbox 实现至少一次投递: 客户端连接时带上 ack=1 后, 发往该客户端的消息按递增编号,
+// 缓存到客户端确认为止; 断线重连 (同一 session_id) 时重发所有未确认的消息, 客户端按 seq 去重
+// 每个会话的每个参与者一个 outbox, 只保存在本副本内存中, 会话从持久化存储恢复时为空
+type outbox struct {
+	mu      sync.Mutex
+	seq     int64
+	pending []*chat.ChatMessage
+	conn    *wsConn // 当前连接, 断开后为 nil, 这期间的消息只缓存
+}
+
+// attach 把消息改为发往 conn, 并重发未确认的消息
+// 旧连接上尚未结束的这轮对话此后产生的消息也发往新连接
+func (o *outbox) attach(conn *wsConn) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.conn = conn
+	for _, msg := range o.pending {
+		if err := conn.write(msg, 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// detach 连接断开, 已经被新连接取代时不做处理
+func (o *outbox) detach(conn *wsConn) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.conn == conn {
+		o.conn = nil
+	}
+}
+
+// send 编号并缓存消息, 有连接时立即发送; 发送失败的消息等重连后重发
+func (o *outbox) send(msg *chat.ChatMessage) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.seq++
+	msg.Seq = o.seq
+	o.pending = append(o.pending, msg)
+	if len(o.pending) > outboxLimit {
+		o.pending = o.pending[len(o.pending)-outboxLimit:]
+	}
+	if o.conn == nil {
+		return nil
+	}
+	return o.conn.write(msg, 0)
+}
+
+// lastSeq 返回已分配的最大编号
+func (o *outbox) lastSeq() int64 {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.seq
+}
+
+// ack 丢弃客户端已确认的消息
+func (o *outbox) ack(seq int64) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	i := 0
+	for i < len(o.pending) && o.pending[i].Seq <= seq {
+		i++
+	}
+	o.pending = o.pending[i:]
+}
@@ -0,0 +1,70 @@
+package host
+
+import (
+	"fmt"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/sashabaranov/go-openai"
+)
+
+var demoToolCalls = metrics.Counter("demo_tool_calls_total", "Number of tool calls answered with the canned demo result.")
+
+const (
+	defaultDemoMaxTokensPerDay = 5000
+	defaultDemoMaxTokens       = 500
+	// 缺省的工具结果, %s 为工具名; 交给大模型, 和其他工具错误一样使用英文
+	defaultDemoResult = "Demo mode: tool calls are disabled and %s was not executed. Tell the user this is a demo and explain what the tool would have done."
+)
+
+// demoMode 用于公开演示: 工具照常列给大模型, 但不会真正执行, 调用时返回固定的结果; 每个用户每天的 token 和每次回答的长度都限制得很小,
+// 避免演示产生真实的副作用和费用。为 nil 时不是演示模式
+type demoMode struct {
+	result          string
+	maxTokensPerDay int
+	maxTokens       int
+}
+
+// newDemoMode 未配置 demo 时返回 nil
+func newDemoMode(cfg *DemoConfig) *demoMode {
+	if cfg == nil {
+		return nil
+	}
+	d := &demoMode{result: cfg.Result, maxTokensPerDay: defaultDemoMaxTokensPerDay, maxTokens: defaultDemoMaxTokens}
+	if cfg.MaxTokensPerDay > 0 {
+		d.maxTokensPerDay = cfg.MaxTokensPerDay
+	}
+	if cfg.MaxTokens > 0 {
+		d.maxTokens = cfg.MaxTokens
+	}
+	logf("demo.enabled", d.maxTokensPerDay, d.maxTokens)
+	return d
+}
+
+// toolResult 返回代替真实调用的结果, d 为 nil 时返回 false, 要真正调用工具
+func (d *demoMode) toolResult(tool string) (*mcp.CallToolResult, bool) {
+	if d == nil {
+		return nil, false
+	}
+	demoToolCalls.Inc()
+	text := d.result
+	if text == "" {
+		text = fmt.Sprintf(defaultDemoResult, tool)
+	}
+	return mcp.NewToolResultText(text), true
+}
+
+// tokensPerDay 返回每天的 token 上限: 演示模式下取角色配置和演示上限中较小的一个, limit 为 0 表示不限制
+func (d *demoMode) tokensPerDay(limit int) int {
+	if d == nil || (limit > 0 && limit < d.maxTokensPerDay) {
+		return limit
+	}
+	return d.maxTokensPerDay
+}
+
+// limitRequest 演示模式下限制每次回答的长度
+func (d *demoMode) limitRequest(req *openai.ChatCompletionRequest) {
+	if d == nil || (req.MaxTokens > 0 && req.MaxTokens < d.maxTokens) {
+		return
+	}
+	req.MaxTokens = d.maxTokens
+}
@@ -0,0 +1,360 @@
+package host
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// EventDigestCreated 在生成一份会话摘要后发布, 配置了 events 时随其他事件一起转发出去
+const EventDigestCreated = "digest.created"
+
+const (
+	defaultDigestInterval = 24 * time.Hour
+	defaultDigestDir      = "data/digests"
+	digestTimeout         = 2 * time.Minute // 每个会话的汇总超时
+	digestMessageLimit    = 2000            // 每条消息交给大模型的最多字符数, 工具结果可能很长
+)
+
+// Digest 是一个会话在一段时间内的摘要
+type Digest struct {
+	SessionID   string    `json:"session_id"`
+	UserID      string    `json:"user_id,omitempty"`
+	From        time.Time `json:"from"`
+	To          time.Time `json:"to"`
+	Messages    int       `json:"messages"` // 这段时间内的消息数
+	Summary     string    `json:"summary"`
+	TotalTokens int       `json:"total_tokens"` // 生成摘要消耗的 token
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// digester 定期汇总这段时间内有新消息的会话, 用于长时间运行的运维类对话; 摘要按天追加到 dir/<日期>.jsonl。
+// 只汇总本副本缓存中的会话, 多副本部署时每个副本各自汇总自己处理过的会话
+type digester struct {
+	cc          *ChatClient
+	interval    time.Duration
+	dir         string
+	model       string
+	minMessages int
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	mu     sync.Mutex // 保护摘要文件的读写
+	last   time.Time  // 上次汇总的截止时间
+}
+
+// newDigester 未配置 digest 时返回 nil
+func newDigester(cc *ChatClient, cfg *DigestConfig) (*digester, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+	d := &digester{cc: cc, interval: defaultDigestInterval, dir: defaultDigestDir, model: cfg.Model, minMessages: cfg.MinMessages}
+	if cfg.Interval > 0 {
+		d.interval = time.Duration(cfg.Interval)
+	}
+	if cfg.Dir != "" {
+		d.dir = cfg.Dir
+	}
+	if d.model == "" {
+		d.model = cc.model
+	}
+	if d.minMessages == 0 {
+		d.minMessages = 2
+	}
+	if err := os.MkdirAll(d.dir, 0o700); err != nil {
+		return nil, err
+	}
+	d.ctx, d.cancel = context.WithCancel(context.Background())
+	return d, nil
+}
+
+// Start 每隔 interval 汇总一次, 只在 serve 中启动
+func (d *digester) Start() {
+	if d == nil {
+		return
+	}
+	d.last = time.Now()
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		ticker := time.NewTicker(d.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-d.ctx.Done():
+				return
+			case now := <-ticker.C:
+				d.run(d.ctx, d.last, now)
+				d.last = now
+			}
+		}
+	}()
+}
+
+// Close 停止定时汇总, 正在进行的汇总被取消
+func (d *digester) Close() {
+	if d == nil {
+		return
+	}
+	d.cancel()
+	d.wg.Wait()
+}
+
+// run 汇总 [from, to) 之间有新消息的会话, 单个会话失败记录日志后继续
+func (d *digester) run(ctx context.Context, from, to time.Time) {
+	done := 0
+	for _, sess := range d.cc.sessions.All() {
+		if ctx.Err() != nil {
+			return
+		}
+		var msgs []HistoryMessage
+		for _, m := range sess.History() {
+			if !m.CreatedAt.Before(from) && m.CreatedAt.Before(to) && m.Content != "" {
+				msgs = append(msgs, m)
+			}
+		}
+		if len(msgs) < d.minMessages {
+			continue
+		}
+		digest, err := d.summarize(ctx, sess, msgs, from, to)
+		if err != nil {
+			logf("digest.failed", sess.ID, err)
+			continue
+		}
+		if err := d.save(digest); err != nil {
+			logf("digest.save_failed", sess.ID, err)
+			continue
+		}
+		d.cc.events.Publish(EventDigestCreated, sess.ID, map[string]any{
+			"user": digest.UserID, "from": from, "to": to, "messages": digest.Messages, "summary": digest.Summary,
+		})
+		done++
+	}
+	logf("digest.finished", done, from.Format(time.RFC3339), to.Format(time.RFC3339))
+}
+
+// summarize 把这段时间的消息整理成文字记录交给大模型汇总
+func (d *digester) summarize(ctx context.Context, sess *Session, msgs []HistoryMessage, from, to time.Time) (Digest, error) {
+	ctx, cancel := context.WithTimeout(ctx, digestTimeout)
+	defer cancel()
+	var b strings.Builder
+	for _, m := range msgs {
+		who := m.Role
+		switch {
+		case m.Role == openai.ChatMessageRoleTool && m.Name != "":
+			who = "tool " + m.Name
+		case m.Sender != "":
+			who = m.Role + " " + m.Sender
+		}
+		content := m.Content
+		if r := []rune(content); len(r) > digestMessageLimit {
+			content = string(r[:digestMessageLimit]) + "..."
+		}
+		fmt.Fprintf(&b, "[%s %s]\n%s\n\n", m.CreatedAt.UTC().Format(time.RFC3339), who, content)
+	}
+	stats := newTurnStats(d.cc.pricing)
+	resp, err := d.cc.createChatCompletion(ctx, sess.ID, stats, openai.ChatCompletionRequest{
+		Model: d.model,
+		Messages: []openai.ChatCompletionMessage{
+			{Role: openai.ChatMessageRoleSystem, Content: T(serverLocale, "digest.prompt")},
+			{Role: openai.ChatMessageRoleUser, Content: b.String()},
+		},
+	})
+	if err != nil {
+		return Digest{}, err
+	}
+	if len(resp.Choices) == 0 || resp.Choices[0].Message.Content == "" {
+		return Digest{}, newError("digest.empty")
+	}
+	return Digest{
+		SessionID:   sess.ID,
+		UserID:      sess.UserID(),
+		From:        from.UTC(),
+		To:          to.UTC(),
+		Messages:    len(msgs),
+		Summary:     resp.Choices[0].Message.Content,
+		TotalTokens: stats.usage.TotalTokens,
+		CreatedAt:   time.Now().UTC(),
+	}, nil
+}
+
+// path 摘要按截止时间的日期 (UTC) 分文件
+func (d *digester) path(date string) string {
+	return filepath.Join(d.dir, date+".jsonl")
+}
+
+func (d *digester) save(digest Digest) error {
+	data, err := json.Marshal(digest)
+	if err != nil {
+		return err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	f, err := os.OpenFile(d.path(digest.To.Format(time.DateOnly)), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// load 读取一个文件中满足条件的摘要, 文件不存在时返回空
+func (d *digester) load(path string, keep func(Digest) bool) ([]Digest, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return readDigests(path, keep)
+}
+
+func readDigests(path string, keep func(Digest) bool) ([]Digest, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var digests []Digest
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var digest Digest
+		if err := json.Unmarshal(scanner.Bytes(), &digest); err != nil {
+			continue
+		}
+		if keep(digest) {
+			digests = append(digests, digest)
+		}
+	}
+	return digests, scanner.Err()
+}
+
+// sessionDigests 按时间顺序返回一个会话的所有摘要
+func (d *digester) sessionDigests(sessionID string) ([]Digest, error) {
+	files, err := filepath.Glob(filepath.Join(d.dir, "*.jsonl"))
+	if err != nil {
+		return nil, err
+	}
+	slices.Sort(files)
+	digests := []Digest{}
+	for _, file := range files {
+		found, err := d.load(file, func(digest Digest) bool { return digest.SessionID == sessionID })
+		if err != nil {
+			return nil, err
+		}
+		digests = append(digests, found...)
+	}
+	return digests, nil
+}
+
+// purge 删除 userID 或这些会话的摘要, dryRun 时只统计, 返回删除 (或将要删除) 的摘要数
+func (d *digester) purge(userID string, sessions []string, dryRun bool) (int, error) {
+	files, err := filepath.Glob(filepath.Join(d.dir, "*.jsonl"))
+	if err != nil {
+		return 0, err
+	}
+	owned := func(digest Digest) bool {
+		return digest.UserID == userID || slices.Contains(sessions, digest.SessionID)
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	total := 0
+	for _, file := range files {
+		all, err := readDigests(file, func(Digest) bool { return true })
+		if err != nil {
+			return total, err
+		}
+		kept := slices.DeleteFunc(slices.Clone(all), owned)
+		n := len(all) - len(kept)
+		if n == 0 {
+			continue
+		}
+		total += n
+		if dryRun {
+			continue
+		}
+		if err := d.rewrite(file, kept); err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// rewrite 用 digests 替换文件的内容, 先写临时文件再改名; 调用方持有 d.mu
+func (d *digester) rewrite(path string, digests []Digest) error {
+	var b strings.Builder
+	for _, digest := range digests {
+		data, err := json.Marshal(digest)
+		if err != nil {
+			return err
+		}
+		b.Write(data)
+		b.WriteByte('\n')
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(b.String()), 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// GET /api/digests?date=2024-05-01 导出某一天 (UTC, 缺省为今天) 生成的所有摘要, 只有 admin 可以访问
+func (cc *ChatClient) handleDigests(w http.ResponseWriter, r *http.Request) {
+	if cc.digests == nil {
+		writeError(w, r, http.StatusNotFound, "api.digest_disabled")
+		return
+	}
+	date := r.URL.Query().Get("date")
+	if date == "" {
+		date = time.Now().UTC().Format(time.DateOnly)
+	}
+	if _, err := time.Parse(time.DateOnly, date); err != nil {
+		writeError(w, r, http.StatusBadRequest, "api.bad_request", err)
+		return
+	}
+	// 软删除的用户的摘要不再导出
+	digests, err := cc.digests.load(cc.digests.path(date), func(d Digest) bool { return !cc.softDeletes.hidden(d.UserID) })
+	if err != nil {
+		logf("digest.load_failed", err)
+		writeError(w, r, http.StatusInternalServerError, "error.request_failed")
+		return
+	}
+	if digests == nil {
+		digests = []Digest{}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"date": date, "digests": digests})
+}
+
+// GET /api/sessions/{id}/digests 一个会话的所有摘要
+func (cc *ChatClient) handleSessionDigests(w http.ResponseWriter, r *http.Request) {
+	if cc.digests == nil {
+		writeError(w, r, http.StatusNotFound, "api.digest_disabled")
+		return
+	}
+	sess, ok := cc.sessionFor(r, r.PathValue("id"))
+	if !ok {
+		writeError(w, r, http.StatusNotFound, "api.session_not_found")
+		return
+	}
+	digests, err := cc.digests.sessionDigests(sess.ID)
+	if err != nil {
+		logf("digest.load_failed", err)
+		writeError(w, r, http.StatusInternalServerError, "error.request_failed")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"session_id": sess.ID, "digests": digests})
+}
@@ -0,0 +1,121 @@
+package host
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/guobinqiu/mcp-host-web/chat"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/sashabaranov/go-openai"
+)
+
+// toolNamePattern 是大模型接口接受的函数名, 其他名字的工具会让整个请求被拒绝
+var toolNamePattern = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+
+var errServerDown = errors.New("server failed its last health check")
+
+// toolCatalog 是一轮对话中提供给大模型的工具
+type toolCatalog struct {
+	tools   []openai.Tool
+	servers map[string]*MCPClient // 工具名 -> 提供该工具的 MCP 服务
+	failed  []string              // 获取工具失败的服务, 本轮不能使用它们的工具
+}
+
+// listServerTools 获取一个 MCP 服务的工具, 服务返回空结果或处理过程中 panic 时也作为错误返回
+func listServerTools(ctx context.Context, c *MCPClient) (tools []mcp.Tool, err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = fmt.Errorf("panic: %v", v)
+		}
+	}()
+	listCtx, cancel := c.WithTimeout(ctx)
+	defer cancel()
+	resp, err := c.ListTools(listCtx, mcp.ListToolsRequest{})
+	if err != nil {
+		return nil, err
+	}
+	if resp == nil {
+		return nil, newError("mcp.empty_tools_response")
+	}
+	return resp.Tools, nil
+}
+
+// discoverTools 从工具注册表取各 MCP 服务的工具 (缓存中没有的并发获取), 按角色过滤并应用配置中的覆盖。
+// 每个服务单独处理: 失败 (连接断开、超时、返回空结果) 和最近一次健康检查失败的服务记录日志和错误事件后跳过,
+// 其他服务的工具照常使用; 名字不符合大模型接口要求的工具跳过, 同名工具只保留排在前面的服务提供的那个,
+// 避免大模型接口拒绝整个请求
+func (cc *ChatClient) discoverTools(ctx context.Context, sessionID string, clients []*MCPClient, role string) *toolCatalog {
+	// 不健康的服务不再等它超时
+	var healthy []*MCPClient
+	for _, c := range clients {
+		if !cc.health.down(c.Name) {
+			healthy = append(healthy, c)
+		}
+	}
+	fetched, fetchErrs := cc.tools.snapshot(ctx, healthy)
+	results, errs := make([][]mcp.Tool, len(clients)), make([]error, len(clients))
+	for i, j := 0, 0; i < len(clients); i++ {
+		if j < len(healthy) && clients[i] == healthy[j] {
+			results[i], errs[i] = fetched[j], fetchErrs[j]
+			j++
+		} else {
+			errs[i] = errServerDown
+		}
+	}
+
+	catalog := &toolCatalog{tools: []openai.Tool{}, servers: make(map[string]*MCPClient)}
+	for i, c := range clients {
+		if errs[i] != nil {
+			logf("mcp.list_tools_failed", c.Name, errs[i])
+			cc.events.Publish(EventError, sessionID, traceData(ctx, map[string]any{"stage": "list_tools", "server": c.Name, "error": errs[i].Error()}))
+			catalog.failed = append(catalog.failed, c.Name)
+			continue
+		}
+		for _, tool := range results[i] {
+			if !toolNamePattern.MatchString(tool.Name) {
+				logf("mcp.invalid_tool_name", c.Name, tool.Name)
+				continue
+			}
+			if !cc.toolAllowed(role, tool.Name) {
+				continue
+			}
+			if other, ok := catalog.servers[tool.Name]; ok {
+				logf("mcp.duplicate_tool", tool.Name, other.Name, c.Name)
+				continue
+			}
+			tool = c.ApplyOverrides(tool)
+			tool.Description = cc.hints.annotate(tool.Name, tool.Description)
+			catalog.tools = append(catalog.tools, openai.Tool{
+				Type: openai.ToolTypeFunction,
+				Function: &openai.FunctionDefinition{
+					Name:        tool.Name,
+					Description: tool.Description,
+					Parameters:  sanitizeSchema(cc.toolSchema, tool.InputSchema),
+				},
+			})
+			catalog.servers[tool.Name] = c
+		}
+	}
+	return catalog
+}
+
+// unknownToolMessage 是大模型调用了本轮没有提供的工具时代替结果的说明, 列出可用的工具
+func unknownToolMessage(name string, servers map[string]*MCPClient) string {
+	names := slices.Sorted(maps.Keys(servers))
+	if len(names) == 0 {
+		return "error: unknown tool " + name + "; no tools are available in this turn, answer without tools."
+	}
+	return "error: unknown tool " + name + "; available tools: " + strings.Join(names, ", ") + "."
+}
+
+// warn 把获取工具失败的服务以 type=warning 的消息告诉客户端, 回答可能因此不完整
+func (t *toolCatalog) warn(ctx context.Context, sessionID string, emit func(*chat.ChatMessage)) {
+	for _, name := range t.failed {
+		emit(&chat.ChatMessage{Type: "warning", Content: T(clientInfoFrom(ctx).locale, "warning.tools_unavailable", name), SessionId: sessionID})
+	}
+}
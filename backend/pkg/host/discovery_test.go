@@ -0,0 +1,272 @@
+package host
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/guobinqiu/mcp-host-web/chat"
+	"github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/client/transport"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/sashabaranov/go-openai"
+)
+
+// newToolServer 启动一个提供 names 中各工具的进程内服务
+func newToolServer(t *testing.T, name string, names ...string) *MCPClient {
+	t.Helper()
+	s := server.NewMCPServer(name, "1.0.0")
+	for _, n := range names {
+		s.AddTool(mcp.NewTool(n), func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			return mcp.NewToolResultText(name + ":" + req.Params.Name), nil
+		})
+	}
+	c, err := newInProcessMCPClient(name, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+// stubTransport 模拟远程服务: 完成初始化, tools/list 交给 list 处理, 和 stdio、http 传输一样遵守请求的 ctx
+type stubTransport struct {
+	list func(ctx context.Context) (*mcp.JSONRPCErrorDetails, error)
+}
+
+func (s *stubTransport) Start(context.Context) error { return nil }
+
+func (s *stubTransport) SendRequest(ctx context.Context, req transport.JSONRPCRequest) (*transport.JSONRPCResponse, error) {
+	resp := &transport.JSONRPCResponse{JSONRPC: mcp.JSONRPC_VERSION, ID: req.ID}
+	switch req.Method {
+	case string(mcp.MethodInitialize):
+		resp.Result, _ = json.Marshal(mcp.InitializeResult{ProtocolVersion: mcp.LATEST_PROTOCOL_VERSION})
+	case string(mcp.MethodToolsList):
+		rpcErr, err := s.list(ctx)
+		if err != nil {
+			return nil, err
+		}
+		resp.Error = rpcErr
+	}
+	return resp, nil
+}
+
+func (s *stubTransport) SendNotification(context.Context, mcp.JSONRPCNotification) error { return nil }
+func (s *stubTransport) SetNotificationHandler(func(mcp.JSONRPCNotification))            {}
+func (s *stubTransport) Close() error                                                    { return nil }
+func (s *stubTransport) GetSessionId() string                                            { return "" }
+
+func newStubServer(t *testing.T, name string, list func(ctx context.Context) (*mcp.JSONRPCErrorDetails, error)) *MCPClient {
+	t.Helper()
+	c := client.NewClient(&stubTransport{list: list})
+	mcpClient := &MCPClient{Client: c, Name: name, Timeout: 50 * time.Millisecond}
+	if _, err := mcpClient.initialize(context.Background(), c); err != nil {
+		t.Fatal(err)
+	}
+	return mcpClient
+}
+
+// newHangingServer 的 tools/list 一直不返回, 直到超时
+func newHangingServer(t *testing.T, name string) *MCPClient {
+	return newStubServer(t, name, func(ctx context.Context) (*mcp.JSONRPCErrorDetails, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+}
+
+// newBrokenServer 的 tools/list 返回 JSON-RPC 错误
+func newBrokenServer(t *testing.T, name string) *MCPClient {
+	return newStubServer(t, name, func(context.Context) (*mcp.JSONRPCErrorDetails, error) {
+		return &mcp.JSONRPCErrorDetails{Code: mcp.INTERNAL_ERROR, Message: "database is locked"}, nil
+	})
+}
+
+func newDiscoveryClient(t *testing.T) *ChatClient {
+	t.Helper()
+	events, err := NewEventBus(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(events.Close)
+	return &ChatClient{events: events, tools: newToolRegistry(), health: NewHealthMonitor(nil, nil)}
+}
+
+func catalogTools(c *toolCatalog) []string {
+	var names []string
+	for _, tool := range c.tools {
+		names = append(names, tool.Function.Name+"@"+c.servers[tool.Function.Name].Name)
+	}
+	return names
+}
+
+func TestListServerTools(t *testing.T) {
+	tests := []struct {
+		name    string
+		client  func(t *testing.T) *MCPClient
+		want    []string
+		wantErr bool
+	}{
+		{"ok", func(t *testing.T) *MCPClient { return newToolServer(t, "a", "add", "sub") }, []string{"add", "sub"}, false},
+		{"timeout", func(t *testing.T) *MCPClient { return newHangingServer(t, "slow") }, nil, true},
+		{"list error", func(t *testing.T) *MCPClient { return newBrokenServer(t, "broken") }, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := time.Now()
+			tools, err := listServerTools(context.Background(), tt.client(t))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if time.Since(start) > 5*time.Second {
+				t.Errorf("listing took %v, the server timeout was not applied", time.Since(start))
+			}
+			var names []string
+			for _, tool := range tools {
+				names = append(names, tool.Name)
+			}
+			slices.Sort(names)
+			if !slices.Equal(names, tt.want) {
+				t.Errorf("got %v, want %v", names, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiscoverTools(t *testing.T) {
+	tests := []struct {
+		name       string
+		clients    func(t *testing.T, cc *ChatClient) []*MCPClient
+		want       []string
+		wantFailed []string
+	}{
+		{
+			name: "timeout",
+			clients: func(t *testing.T, cc *ChatClient) []*MCPClient {
+				return []*MCPClient{newHangingServer(t, "slow"), newToolServer(t, "a", "add")}
+			},
+			want:       []string{"add@a"},
+			wantFailed: []string{"slow"},
+		},
+		{
+			name: "list error",
+			clients: func(t *testing.T, cc *ChatClient) []*MCPClient {
+				return []*MCPClient{newToolServer(t, "a", "add"), newBrokenServer(t, "broken")}
+			},
+			want:       []string{"add@a"},
+			wantFailed: []string{"broken"},
+		},
+		{
+			name: "duplicate names keep the first server",
+			clients: func(t *testing.T, cc *ChatClient) []*MCPClient {
+				return []*MCPClient{newToolServer(t, "a", "add"), newToolServer(t, "b", "add", "mul")}
+			},
+			want: []string{"add@a", "mul@b"},
+		},
+		{
+			name: "invalid names are skipped",
+			clients: func(t *testing.T, cc *ChatClient) []*MCPClient {
+				return []*MCPClient{newToolServer(t, "a", "add", "web search", "文件", "fs.read", strings.Repeat("x", 65), "ok-name_2")}
+			},
+			want: []string{"add@a", "ok-name_2@a"},
+		},
+		{
+			name: "unhealthy server is not asked",
+			clients: func(t *testing.T, cc *ChatClient) []*MCPClient {
+				cc.health.record("down", healthCheck{Time: time.Now(), OK: false, Error: "connection refused"})
+				cc.health.record("a", healthCheck{Time: time.Now(), OK: true})
+				return []*MCPClient{newHangingServer(t, "down"), newToolServer(t, "a", "add")}
+			},
+			want:       []string{"add@a"},
+			wantFailed: []string{"down"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cc := newDiscoveryClient(t)
+			clients := tt.clients(t, cc)
+			start := time.Now()
+			catalog := cc.discoverTools(context.Background(), "s1", clients, RoleUser)
+			if got := catalogTools(catalog); !slices.Equal(got, tt.want) {
+				t.Errorf("tools = %v, want %v", got, tt.want)
+			}
+			if !slices.Equal(catalog.failed, tt.wantFailed) {
+				t.Errorf("failed = %v, want %v", catalog.failed, tt.wantFailed)
+			}
+			if tt.name == "unhealthy server is not asked" && time.Since(start) >= 50*time.Millisecond {
+				t.Errorf("discovery waited %v for an unhealthy server", time.Since(start))
+			}
+		})
+	}
+}
+
+// 大模型调用了本轮没有的工具时, 下一次请求中要有对应 tool_call_id 的工具消息, 否则接口会拒绝请求
+func TestUnknownToolCall(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		requests []openai.ChatCompletionRequest
+	)
+	llm := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req openai.ChatCompletionRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		mu.Lock()
+		requests = append(requests, req)
+		mu.Unlock()
+		msg := openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant}
+		if last := req.Messages[len(req.Messages)-1]; last.Role == openai.ChatMessageRoleUser {
+			msg.ToolCalls = []openai.ToolCall{
+				{ID: "call_missing", Type: openai.ToolTypeFunction, Function: openai.FunctionCall{Name: "missing", Arguments: "{}"}},
+				{ID: "call_add", Type: openai.ToolTypeFunction, Function: openai.FunctionCall{Name: "add", Arguments: "{}"}},
+			}
+		} else {
+			msg.Content = "done"
+		}
+		writeJSON(w, http.StatusOK, openai.ChatCompletionResponse{
+			Choices: []openai.ChatCompletionChoice{{Message: msg, FinishReason: openai.FinishReasonStop}},
+		})
+	}))
+	defer llm.Close()
+
+	config := openai.DefaultConfig("test")
+	config.BaseURL = llm.URL
+	cc := newDiscoveryClient(t)
+	cc.mcpClients = []*MCPClient{newToolServer(t, "a", "add")}
+	cc.provider = openai.NewClientWithConfig(config)
+	cc.model = "mock"
+	cc.sessions = NewSessionStore(nil)
+	cc.turnTimeout = defaultTurnTimeout
+	var err error
+	if cc.uploads, err = NewUploadStore(&UploadsConfig{Dir: t.TempDir()}); err != nil {
+		t.Fatal(err)
+	}
+	if cc.artifacts, err = NewArtifactStore(&ArtifactsConfig{Dir: t.TempDir()}); err != nil {
+		t.Fatal(err)
+	}
+
+	sess := cc.sessions.Create("")
+	got, err := cc.ProcessQuery(context.Background(), sess, "hi", func(*chat.ChatMessage) {})
+	if err != nil || got != "done" {
+		t.Fatalf("got %q, %v", got, err)
+	}
+	if len(requests) != 2 {
+		t.Fatalf("got %d model requests, want 2", len(requests))
+	}
+	answered := map[string]string{}
+	for _, m := range requests[1].Messages {
+		if m.Role == openai.ChatMessageRoleTool {
+			answered[m.ToolCallID] = m.Content
+		}
+	}
+	if !strings.Contains(answered["call_missing"], "unknown tool missing") || !strings.Contains(answered["call_missing"], "add") {
+		t.Errorf("unknown tool answer = %q", answered["call_missing"])
+	}
+	if answered["call_add"] != "a:add" {
+		t.Errorf("add answer = %q", answered["call_add"])
+	}
+}
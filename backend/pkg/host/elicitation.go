@@ -0,0 +1,251 @@
+package host
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+
+	"github.com/guobinqiu/mcp-host-web/chat"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+var toolElicitations = metrics.Counter("tool_elicitations_total", "Elicitation requests from MCP servers, by outcome.", "outcome")
+
+var errElicitationNotFound = errors.New("no such pending elicitation")
+
+// elicitationGate 记录 MCP 服务在工具调用中途发起、等待用户回复的 elicitation 请求。请求以 elicitation_request
+// 下发给会话, 用户通过 WebSocket 的 elicitation 消息或 POST /api/sessions/{id}/elicitations/{elicitation} 回复,
+// 回复交给服务后工具调用继续; 等待时间计入工具调用的超时
+type elicitationGate struct {
+	mu      sync.Mutex
+	pending map[string]*pendingElicitation // elicitation id ->
+}
+
+type pendingElicitation struct {
+	sessionID string
+	schema    any
+	reply     chan *mcp.ElicitationResult // 容量为 1, 回复后从 pending 中删除, 不会再次写入
+}
+
+func newElicitationGate() *elicitationGate {
+	return &elicitationGate{pending: map[string]*pendingElicitation{}}
+}
+
+// request 下发 elicitation_request 并等待用户回复; ctx 结束 (工具调用超时或本轮被取消) 时返回 ctx 的错误,
+// 服务收到错误后自行结束这次调用
+func (g *elicitationGate) request(ctx context.Context, sessionID, server string, req mcp.ElicitationRequest, emit func(*chat.ChatMessage)) (*mcp.ElicitationResult, error) {
+	id := newTraceID()
+	p := &pendingElicitation{sessionID: sessionID, schema: req.Params.RequestedSchema, reply: make(chan *mcp.ElicitationResult, 1)}
+	g.mu.Lock()
+	g.pending[id] = p
+	g.mu.Unlock()
+	defer func() {
+		g.mu.Lock()
+		delete(g.pending, id)
+		g.mu.Unlock()
+	}()
+
+	schemaJSON, _ := json.Marshal(req.Params.RequestedSchema)
+	emit(&chat.ChatMessage{
+		Type:        "elicitation_request",
+		Content:     T(clientInfoFrom(ctx).locale, "elicitation.request", server),
+		SessionId:   sessionID,
+		Elicitation: &chat.Elicitation{Id: id, Server: server, Message: req.Params.Message, Schema: string(schemaJSON)},
+	})
+	select {
+	case result := <-p.reply:
+		toolElicitations.Inc(string(result.Action))
+		return result, nil
+	case <-ctx.Done():
+		toolElicitations.Inc("timeout")
+		return nil, ctx.Err()
+	}
+}
+
+// resolve 把用户的回复交给等待中的请求, action 为 accept | decline | cancel, content 为 accept 时的 JSON 对象文本;
+// 没有这个等待中的请求 (已超时、已回复或属于其他会话) 时返回 errElicitationNotFound, 回复不符合 schema 时返回原因
+func (g *elicitationGate) resolve(sessionID, id, action, content string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	p, ok := g.pending[id]
+	if !ok || p.sessionID != sessionID {
+		return errElicitationNotFound
+	}
+	result := &mcp.ElicitationResult{ElicitationResponse: mcp.ElicitationResponse{Action: mcp.ElicitationResponseAction(action)}}
+	switch result.Action {
+	case mcp.ElicitationResponseActionAccept:
+		var values map[string]any
+		if err := json.Unmarshal([]byte(content), &values); err != nil || values == nil {
+			return errors.New("content must be a JSON object")
+		}
+		if err := checkElicitation(p.schema, values); err != nil {
+			return err
+		}
+		result.Content = values
+	case mcp.ElicitationResponseActionDecline, mcp.ElicitationResponseActionCancel:
+	default:
+		return fmt.Errorf("unknown action %q", action)
+	}
+	delete(g.pending, id)
+	p.reply <- result
+	return nil
+}
+
+// checkElicitation 按 elicitation 允许的 schema (一层 string | number | integer | boolean 属性, 可以有 enum)
+// 检查必填属性和属性类型, 服务收到的回答不会缺少必填项
+func checkElicitation(schema any, values map[string]any) error {
+	s, _ := schema.(map[string]any)
+	props, _ := s["properties"].(map[string]any)
+	required, _ := s["required"].([]any)
+	for _, name := range required {
+		if n, ok := name.(string); ok {
+			if _, ok := values[n]; !ok {
+				return fmt.Errorf("%s is required", n)
+			}
+		}
+	}
+	for name, v := range values {
+		prop, ok := props[name].(map[string]any)
+		if !ok {
+			continue
+		}
+		var valid bool
+		switch prop["type"] {
+		case "string":
+			_, valid = v.(string)
+		case "number":
+			_, valid = v.(float64)
+		case "integer":
+			f, ok := v.(float64)
+			valid = ok && f == float64(int64(f))
+		case "boolean":
+			_, valid = v.(bool)
+		default:
+			valid = true
+		}
+		if !valid {
+			return fmt.Errorf("%s must be of type %v", name, prop["type"])
+		}
+		if enum, ok := prop["enum"].([]any); ok && !slices.Contains(enum, v) {
+			return fmt.Errorf("%s must be one of %v", name, enum)
+		}
+	}
+	return nil
+}
+
+// elicitTarget 是一次工具调用所属的会话, elicitation 请求转给这个会话的前端
+type elicitTarget struct {
+	ctx       context.Context // 工具调用的 ctx, 调用结束时不再等待回复
+	gate      *elicitationGate
+	sessionID string
+	emit      func(*chat.ChatMessage)
+}
+
+type elicitTargetKey struct{}
+
+// withElicitTarget 标记工具调用所属的会话, 调用期间服务发起的 elicitation 请求转给这个会话
+func withElicitTarget(ctx context.Context, gate *elicitationGate, sessionID string, emit func(*chat.ChatMessage)) context.Context {
+	t := &elicitTarget{gate: gate, sessionID: sessionID, emit: emit}
+	t.ctx = context.WithValue(ctx, elicitTargetKey{}, t)
+	return t.ctx
+}
+
+func elicitTargetFrom(ctx context.Context) *elicitTarget {
+	t, _ := ctx.Value(elicitTargetKey{}).(*elicitTarget)
+	return t
+}
+
+// elicitationHandler 处理一个 MCP 服务发起的 elicitation 请求。进程内和 http 传输的请求带着工具调用的 ctx,
+// 直接转给所属的会话; stdio 传输的请求不带调用的 ctx, 只有一个会话正在调用这个服务的工具时才能确定转给谁,
+// 否则拒绝请求, 不会把表单发给其他用户
+type elicitationHandler struct {
+	server string
+
+	mu      sync.Mutex
+	callers map[*elicitTarget]int // 正在调用工具的会话 -> 进行中的调用数
+}
+
+func newElicitationHandler(server string) *elicitationHandler {
+	return &elicitationHandler{server: server, callers: map[*elicitTarget]int{}}
+}
+
+// track 记录一次进行中的工具调用, 返回的函数在调用结束时调用
+func (h *elicitationHandler) track(ctx context.Context) func() {
+	t := elicitTargetFrom(ctx)
+	if h == nil || t == nil {
+		return func() {}
+	}
+	h.mu.Lock()
+	h.callers[t]++
+	h.mu.Unlock()
+	return func() {
+		h.mu.Lock()
+		if h.callers[t]--; h.callers[t] <= 0 {
+			delete(h.callers, t)
+		}
+		h.mu.Unlock()
+	}
+}
+
+// soleCaller 返回唯一正在调用工具的会话, 没有或有多个会话时返回 nil
+func (h *elicitationHandler) soleCaller() *elicitTarget {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var found *elicitTarget
+	for t := range h.callers {
+		if found != nil && found.sessionID != t.sessionID {
+			return nil
+		}
+		found = t
+	}
+	return found
+}
+
+func (h *elicitationHandler) Elicit(ctx context.Context, req mcp.ElicitationRequest) (*mcp.ElicitationResult, error) {
+	t := elicitTargetFrom(ctx)
+	if t == nil {
+		t = h.soleCaller()
+	}
+	if t == nil {
+		logf("mcp.elicitation_unrouted", h.server)
+		toolElicitations.Inc("unrouted")
+		return nil, errors.New("elicitation is only supported while one session is calling a tool of this server")
+	}
+	logf("mcp.elicitation", logTag(t.ctx, t.sessionID), h.server)
+	return t.gate.request(t.ctx, t.sessionID, h.server, req, t.emit)
+}
+
+// POST /api/sessions/{id}/elicitations/{elicitation} {"action": "accept", "content": {...}} 回复等待中的 elicitation 请求
+func (cc *ChatClient) handleElicitation(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, r, http.StatusMethodNotAllowed, "api.method_not_allowed")
+		return
+	}
+	sess, ok := cc.sessionFor(r, r.PathValue("id"))
+	if !ok {
+		writeError(w, r, http.StatusNotFound, "api.session_not_found")
+		return
+	}
+	var body struct {
+		Action  string          `json:"action"`
+		Content json.RawMessage `json:"content"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, r, http.StatusBadRequest, "api.bad_request", err)
+		return
+	}
+	err := cc.elicitations.resolve(sess.ID, r.PathValue("elicitation"), body.Action, string(body.Content))
+	if errors.Is(err, errElicitationNotFound) {
+		writeError(w, r, http.StatusNotFound, "api.elicitation_not_found")
+		return
+	}
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "api.bad_request", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
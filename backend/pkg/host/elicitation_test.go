@@ -0,0 +1,174 @@
+package host
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/guobinqiu/mcp-host-web/chat"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+var accountSchema = map[string]any{
+	"type": "object",
+	"properties": map[string]any{
+		"account": map[string]any{"type": "string", "enum": []any{"alice", "bob"}},
+		"amount":  map[string]any{"type": "integer"},
+	},
+	"required": []any{"account"},
+}
+
+// newElicitingClient 启动一个工具中途索取账户名的进程内服务
+func newElicitingClient(t *testing.T) *MCPClient {
+	t.Helper()
+	s := server.NewMCPServer("elicit", "1.0.0")
+	s.AddTool(mcp.NewTool("transfer"), func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		result, err := s.RequestElicitation(ctx, mcp.ElicitationRequest{Params: mcp.ElicitationParams{
+			Message:         "Which account?",
+			RequestedSchema: accountSchema,
+		}})
+		if err != nil {
+			return nil, err
+		}
+		if result.Action != mcp.ElicitationResponseActionAccept {
+			return mcp.NewToolResultText("cancelled: " + string(result.Action)), nil
+		}
+		content, _ := result.Content.(map[string]any)
+		account, _ := content["account"].(string)
+		return mcp.NewToolResultText("transferred from " + account), nil
+	})
+	c, err := newInProcessMCPClient("elicit", s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func callTransfer(ctx context.Context, c *MCPClient) (string, error) {
+	req := mcp.CallToolRequest{}
+	req.Params.Name = "transfer"
+	resp, err := c.CallTool(ctx, req)
+	if err != nil {
+		return "", err
+	}
+	return resp.Content[0].(mcp.TextContent).Text, nil
+}
+
+func TestElicitationRoundTrip(t *testing.T) {
+	tests := []struct {
+		name    string
+		replies [][2]string // 依次回复的 action 和 content
+		want    string
+	}{
+		{"accept", [][2]string{{"accept", `{"account":"alice"}`}}, "transferred from alice"},
+		{"decline", [][2]string{{"decline", ""}}, "cancelled: decline"},
+		{"invalid then accept", [][2]string{{"accept", `{"amount":1}`}, {"accept", `{"account":"bob","amount":2}`}}, "transferred from bob"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newElicitingClient(t)
+			gate := newElicitationGate()
+			requests := make(chan *chat.ChatMessage, 1)
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			ctx = withElicitTarget(ctx, gate, "s1", func(msg *chat.ChatMessage) { requests <- msg })
+
+			done := make(chan error, 1)
+			go func() {
+				msg := <-requests
+				if msg.Type != "elicitation_request" || msg.GetElicitation().GetMessage() != "Which account?" {
+					done <- errors.New("unexpected message " + msg.String())
+					return
+				}
+				id := msg.GetElicitation().GetId()
+				if err := gate.resolve("s2", id, "cancel", ""); !errors.Is(err, errElicitationNotFound) {
+					done <- errors.New("another session resolved the request")
+					return
+				}
+				for i, r := range tt.replies {
+					err := gate.resolve("s1", id, r[0], r[1])
+					if last := i == len(tt.replies)-1; (err == nil) != last {
+						done <- errors.New("reply " + r[1] + ": unexpected result")
+						return
+					}
+				}
+				done <- nil
+			}()
+
+			got, err := callTransfer(ctx, c)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := <-done; err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestElicitationTimeout(t *testing.T) {
+	c := newElicitingClient(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	ctx = withElicitTarget(ctx, newElicitationGate(), "s1", func(*chat.ChatMessage) {})
+	if _, err := callTransfer(ctx, c); err == nil {
+		t.Fatal("call should fail when nobody answers")
+	}
+}
+
+// stdio 传输的请求不带调用的 ctx, 只有一个会话在调用时才能确定转给谁
+func TestElicitationHandlerRouting(t *testing.T) {
+	h := newElicitationHandler("stdio")
+	gate := newElicitationGate()
+	req := mcp.ElicitationRequest{Params: mcp.ElicitationParams{Message: "?", RequestedSchema: map[string]any{}}}
+
+	if _, err := h.Elicit(context.Background(), req); err == nil {
+		t.Fatal("request without a caller should be rejected")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	emitted := make(chan *chat.ChatMessage, 1)
+	done := h.track(withElicitTarget(ctx, gate, "s1", func(msg *chat.ChatMessage) { emitted <- msg }))
+	go func() {
+		msg := <-emitted
+		gate.resolve("s1", msg.GetElicitation().GetId(), "accept", `{}`)
+	}()
+	result, err := h.Elicit(context.Background(), req)
+	if err != nil || result.Action != mcp.ElicitationResponseActionAccept {
+		t.Fatalf("sole caller: got %v, %v", result, err)
+	}
+
+	other := h.track(withElicitTarget(ctx, gate, "s2", func(*chat.ChatMessage) { t.Error("form sent to an ambiguous session") }))
+	if _, err := h.Elicit(context.Background(), req); err == nil {
+		t.Fatal("request with two calling sessions should be rejected")
+	}
+	other()
+	done()
+}
+
+func TestCheckElicitation(t *testing.T) {
+	tests := []struct {
+		values  map[string]any
+		wantErr bool
+	}{
+		{map[string]any{"account": "alice"}, false},
+		{map[string]any{"account": "alice", "amount": 3.0}, false},
+		{map[string]any{"amount": 3.0}, true},                        // 缺少必填项
+		{map[string]any{"account": "carol"}, true},                   // 不在 enum 中
+		{map[string]any{"account": "alice", "amount": 1.5}, true},    // 不是整数
+		{map[string]any{"account": "alice", "amount": "3"}, true},    // 类型不对
+		{map[string]any{"account": "alice", "note": "extra"}, false}, // schema 之外的属性不检查
+	}
+	for _, tt := range tests {
+		if err := checkElicitation(accountSchema, tt.values); (err != nil) != tt.wantErr {
+			t.Errorf("%v: err = %v, wantErr %v", tt.values, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,276 @@
+// Package host 是可嵌入的 MCP 对话引擎: 按配置连接 MCP 服务, 把工具提供给大模型,
+// 循环执行工具调用直到得到回答。mcp-host 命令行就是在它之上实现的, 其他 Go 程序也可以直接嵌入:
+//
+//	cfg, err := host.LoadConfig("config.json")
+//	if err != nil { ... }
+//	engine, err := host.New(ctx, cfg, host.Options{})
+//	if err != nil { ... }
+//	defer engine.Close()
+//
+//	sess := engine.NewSession("")
+//	answer, err := engine.Chat(ctx, sess, "北京现在几点", nil)
+//
+// 需要 Web 界面的接口时把 engine.Handler() 挂到自己的 HTTP 服务上即可
+package host
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/guobinqiu/mcp-host-web/chat"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/sashabaranov/go-openai"
+)
+
+// Config 是引擎的配置, 格式见 README
+type Config = MCPConfig
+
+// Provider 是大模型接口, *openai.Client 即满足; 嵌入时可以换成自己的实现 (比如测试用的模拟服务或其他 SDK 的适配)
+type Provider interface {
+	CreateChatCompletion(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error)
+}
+
+// Options 是 New 的可选参数
+type Options struct {
+	// Provider 为 nil 时按环境变量 OPENAI_API_KEY / OPENAI_API_BASE / OPENAI_API_MODEL 创建 OpenAI 兼容的客户端
+	Provider Provider
+	// Model 是 Provider 不为 nil 时使用的模型名
+	Model string
+	// TurnTimeout 大于 0 时覆盖配置中的 turnTimeout
+	TurnTimeout time.Duration
+	// Servers 是 Go 实现的 MCP 服务, 按名称通过进程内传输连接, 和配置中的服务一起提供给大模型;
+	// 名称和配置中的服务重复时忽略。需要在配置中覆盖工具描述等设置时改用 RegisterServer
+	Servers map[string]*server.MCPServer
+	// Summarizer 不为 nil 时用它汇总工具结果 (见 ScratchpadConfig), 未配置 scratchpad 时按缺省值启用
+	Summarizer Summarizer
+	// Embedder 是配置了 cache 时计算问题向量的接口, 为 nil 时按环境变量 OPENAI_EMBEDDING_API_* 或 OPENAI_API_* 连接
+	Embedder Embedder
+}
+
+// Engine 是一个对话引擎实例, 可以被多个 goroutine 同时使用
+type Engine struct {
+	cc       *ChatClient
+	closeAll func()
+	started  sync.Once
+}
+
+// New 按配置连接 MCP 服务并创建引擎, ctx 只用于连接阶段; 连接失败的 MCP 服务记录日志后跳过
+func New(ctx context.Context, cfg *Config, opts Options) (*Engine, error) {
+	SetLocale(cfg.Locale)
+	setLogLevel(cfg.LogLevel)
+	cc, closeAll, err := newChatClient(ctx, cfg, opts)
+	if err != nil {
+		return nil, err
+	}
+	if opts.TurnTimeout > 0 {
+		cc.turnTimeout = opts.TurnTimeout
+	}
+	return &Engine{cc: cc, closeAll: closeAll}, nil
+}
+
+// Close 断开所有 MCP 服务并释放资源
+func (e *Engine) Close() {
+	e.cc.health.Close()
+	e.cc.digests.Close()
+	e.cc.analytics.Close()
+	e.cc.softDeletes.Close()
+	e.cc.sessions.Close()
+	e.cc.config.Close()
+	e.closeAll()
+}
+
+// NewSession 新建会话, userID 为空表示匿名会话; 配置了缺省语言时使用该语言回答
+func (e *Engine) NewSession(userID string) *Session {
+	sess := e.cc.sessions.Create(userID)
+	if e.cc.language != nil {
+		sess.SetLanguage(e.cc.language.Default)
+	}
+	return sess
+}
+
+// LLMOnly 为 true 表示没有可用的 MCP 服务 (没有配置或全部连接失败), 对话中没有工具
+func (e *Engine) LLMOnly() bool {
+	return e.cc.llmOnly()
+}
+
+// Session 按 id 取会话, 配置了 history 时会从持久化存储中恢复
+func (e *Engine) Session(id string) (*Session, bool) {
+	return e.cc.sessions.Get(id)
+}
+
+// Chat 在会话中完成一轮对话并返回回答。onEvent 接收对话过程中的事件 (状态、工具结果、附件等), 可以为 nil;
+// 出错时返回的错误带有本轮的 trace id, 与日志中的记录对应
+func (e *Engine) Chat(ctx context.Context, sess *Session, input string, onEvent func(*chat.ChatMessage)) (string, error) {
+	if onEvent == nil {
+		onEvent = func(*chat.ChatMessage) {}
+	}
+	traceID := traceFrom(ctx)
+	if traceID == "" {
+		traceID = newTraceID()
+		ctx = withTrace(ctx, traceID)
+	}
+	if sender := sess.UserID(); sender != "" && senderFrom(ctx) == "" {
+		ctx = withSender(ctx, sender)
+	}
+	response, err := e.cc.ProcessQuery(ctx, sess, input, onEvent)
+	if err != nil {
+		return "", newError("cli.turn_failed", err, traceID)
+	}
+	return response, nil
+}
+
+// Approve 批准或拒绝会话中等待批准的工具调用, id 为 approval_request 事件中的 approval.id;
+// 没有这个等待中的调用时返回 false
+func (e *Engine) Approve(sessionID, id string, approved bool) bool {
+	return e.cc.approvals.resolve(sessionID, id, approved)
+}
+
+// Elicit 回复 MCP 服务在工具调用中途发起的 elicitation 请求, id 为 elicitation_request 事件中的 elicitation.id,
+// action 为 accept | decline | cancel, content 为 accept 时的 JSON 对象文本; 没有这个请求或回复不符合要求时返回错误
+func (e *Engine) Elicit(sessionID, id, action, content string) error {
+	return e.cc.elicitations.resolve(sessionID, id, action, content)
+}
+
+// Handler 返回 mcp-host serve 提供的全部 HTTP 和 WebSocket 接口 (/ws、/api/...), 并开始定期检查 MCP 服务、生成会话摘要和移出空闲的会话
+func (e *Engine) Handler() http.Handler {
+	e.started.Do(func() {
+		e.cc.health.Start()
+		e.cc.digests.Start()
+		e.cc.analytics.Start()
+		e.cc.softDeletes.Start(e.cc.purgeExpired)
+		e.cc.sessions.Start(e.cc.sessionIdle)
+		e.cc.config.Start()
+	})
+	return e.cc.handler()
+}
+
+// ToolInfo 是一个 MCP 服务提供的工具
+type ToolInfo struct {
+	Server      string
+	Name        string
+	Description string
+}
+
+// ListTools 连接配置中的 MCP 服务, 返回各服务的工具 (已应用配置中的描述覆盖), 按服务名排序;
+// 不需要大模型接口。连接或获取工具失败的服务不影响其他服务, 错误一并返回
+func ListTools(ctx context.Context, cfg *Config) ([]ToolInfo, []error) {
+	SetLocale(cfg.Locale)
+	setLogLevel(cfg.LogLevel)
+	var errs []error
+	if cfg.ConfigSource != nil {
+		servers, _, err := loadRemoteServers(ctx, newConfigSource(cfg.ConfigSource), cfg.MCPServers)
+		if err != nil {
+			errs = append(errs, err)
+		} else {
+			c := *cfg
+			c.MCPServers = servers
+			cfg = &c
+		}
+	}
+	mcpClients, loadErrs := LoadMCPClients(cfg, ctx)
+	errs = append(errs, loadErrs...)
+	defer func() {
+		for _, mcpClient := range mcpClients {
+			mcpClient.Close()
+		}
+	}()
+
+	slices.SortFunc(mcpClients, func(a, b *MCPClient) int { return strings.Compare(a.Name, b.Name) })
+	var tools []ToolInfo
+	for _, mcpClient := range mcpClients {
+		serverTools, err := listServerTools(ctx, mcpClient)
+		if err != nil {
+			errs = append(errs, newError("mcp.list_tools_failed", mcpClient.Name, err))
+			continue
+		}
+		for _, tool := range serverTools {
+			tool = mcpClient.ApplyOverrides(tool)
+			tools = append(tools, ToolInfo{Server: mcpClient.Name, Name: tool.Name, Description: tool.Description})
+		}
+	}
+	return tools, errs
+}
+
+// 收到退出信号后等待进行中的 HTTP 请求完成的时间
+const serverShutdownTimeout = 10 * time.Second
+
+// Serve 按配置文件启动 HTTP 和 WebSocket 服务, 即 mcp-host serve
+func Serve(configPath, addr string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	cfg, err := LoadConfig(configPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		// 没有配置文件时不连接 MCP 服务, 只和大模型对话
+		logf("config.missing", configPath)
+		cfg, err = ParseConfig(configPath, []byte(`{"mcpServers": {}}`))
+	}
+	if err != nil {
+		return err
+	}
+	engine, err := New(ctx, cfg, Options{})
+	if err != nil {
+		return err
+	}
+	defer engine.Close()
+
+	// 启动时检查大模型和 MCP 服务, 配置错误时直接退出, 而不是等到第一条用户消息才发现
+	if s := cfg.Startup; s == nil || !s.SkipSelfTest {
+		timeout := defaultSelfTestTimeout
+		if s != nil && s.SelfTestTimeout > 0 {
+			timeout = time.Duration(s.SelfTestTimeout)
+		}
+		testCtx, testCancel := context.WithTimeout(context.Background(), timeout)
+		_, err := engine.SelfTest(testCtx)
+		testCancel()
+		if err != nil {
+			return err
+		}
+	}
+
+	// 收到 SIGINT / SIGTERM 时停止接受请求并关闭引擎, stdio 服务的进程随之结束
+	sigCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	srv := &http.Server{Addr: addr, Handler: engine.Handler()}
+	errc := make(chan error, 1)
+	go func() { errc <- srv.ListenAndServe() }()
+	logf("server.started", addr)
+	select {
+	case err := <-errc:
+		return newError("server.listen_failed", err)
+	case <-sigCtx.Done():
+	}
+	logf("server.stopping")
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), serverShutdownTimeout)
+	defer shutdownCancel()
+	// Shutdown 不等待已经升级的 WebSocket 连接, 进程退出时断开, 客户端会自动重连到新的进程
+	_ = srv.Shutdown(shutdownCtx)
+	return nil
+}
+
+// SetLocale 设置日志和错误信息的语言 (zh 或 en)
+func SetLocale(locale string) {
+	serverLocale = locale
+}
+
+// setLogLevel 设置 slog 默认日志的最低级别, 空值时保持缺省的 info
+func setLogLevel(level string) {
+	if l, ok := logLevels[level]; ok {
+		slog.SetLogLoggerLevel(l)
+	}
+}
+
+// NewError 返回按 SetLocale 设置的语言本地化的错误, key 见 i18n.go 中的消息目录
+func NewError(key string, args ...any) error {
+	return newError(key, args...)
+}
@@ -0,0 +1,164 @@
+package host
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/redis/go-redis/v9"
+)
+
+// 内部事件类型
+const (
+	EventSessionStarted = "session.started"
+	EventSessionEnded   = "session.ended"
+	EventTurnStarted    = "turn.started"
+	EventTurnFinished   = "turn.finished"
+	EventToolExecuted   = "tool.executed"
+	EventError          = "error"
+)
+
+const (
+	defaultEventsSubject = "mcp-host.events"
+	subscriberBuffer     = 256
+)
+
+var (
+	eventsPublished = metrics.Counter("events_published_total", "Number of internal events published.", "type")
+	eventsDropped   = metrics.Counter("events_dropped_total", "Number of events dropped because a subscriber was too slow.", "subscriber")
+)
+
+// Event 是各模块发布到事件总线的消息
+type Event struct {
+	Type      string         `json:"type"`
+	SessionID string         `json:"session_id,omitempty"`
+	Time      time.Time      `json:"time"`
+	Data      map[string]any `json:"data,omitempty"`
+}
+
+// EventBus 是进程内的事件总线, 发布方不需要知道有哪些消费者 (webhook, 指标, 审计...)
+// 每个订阅者有独立的缓冲队列和 goroutine, 处理慢的订阅者不会阻塞对话, 队列满时丢弃事件
+type EventBus struct {
+	mu     sync.RWMutex
+	subs   map[*subscriber]struct{}
+	closed bool
+	wg     sync.WaitGroup
+	closer func() // 关闭外部连接
+}
+
+type subscriber struct {
+	name string
+	ch   chan Event
+}
+
+// NewEventBus 创建事件总线, 配置了 redis 或 nats 时把所有事件转发出去, 供其他服务消费
+func NewEventBus(cfg *EventsConfig) (*EventBus, error) {
+	b := &EventBus{subs: make(map[*subscriber]struct{})}
+	if cfg == nil || cfg.Backend == "" || cfg.Backend == "memory" {
+		return b, nil
+	}
+	subject := cfg.Subject
+	if subject == "" {
+		subject = defaultEventsSubject
+	}
+
+	var publish func(payload []byte) error
+	switch cfg.Backend {
+	case "redis":
+		opts, err := redis.ParseURL(cfg.URL)
+		if err != nil {
+			return nil, err
+		}
+		client := redis.NewClient(opts)
+		publish = func(payload []byte) error {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			return client.Publish(ctx, subject, payload).Err()
+		}
+		b.closer = func() { client.Close() }
+	case "nats":
+		nc, err := nats.Connect(cfg.URL, nats.Name("mcp-host-web"))
+		if err != nil {
+			return nil, newError("events.connect_failed", cfg.Backend, err)
+		}
+		publish = func(payload []byte) error {
+			return nc.Publish(subject, payload)
+		}
+		b.closer = nc.Close
+	}
+
+	b.Subscribe(cfg.Backend, func(e Event) {
+		payload, err := json.Marshal(e)
+		if err == nil {
+			err = publish(payload)
+		}
+		if err != nil {
+			logf("events.forward_failed", cfg.Backend, e.Type, err)
+		}
+	})
+	return b, nil
+}
+
+// Publish 发布事件, 不会阻塞
+func (b *EventBus) Publish(typ, sessionID string, data map[string]any) {
+	e := Event{Type: typ, SessionID: sessionID, Time: time.Now(), Data: data}
+	eventsPublished.Inc(typ)
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if b.closed {
+		return
+	}
+	for s := range b.subs {
+		select {
+		case s.ch <- e:
+		default:
+			eventsDropped.Inc(s.name)
+		}
+	}
+}
+
+// Subscribe 注册消费者, 返回的函数用于取消订阅
+func (b *EventBus) Subscribe(name string, fn func(Event)) (unsubscribe func()) {
+	s := &subscriber{name: name, ch: make(chan Event, subscriberBuffer)}
+	b.mu.Lock()
+	b.subs[s] = struct{}{}
+	b.mu.Unlock()
+
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+		for e := range s.ch {
+			fn(e)
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			b.mu.Lock()
+			if _, ok := b.subs[s]; ok {
+				delete(b.subs, s)
+				close(s.ch)
+			}
+			b.mu.Unlock()
+		})
+	}
+}
+
+// Close 停止接收新事件, 等待订阅者处理完已排队的事件
+func (b *EventBus) Close() {
+	b.mu.Lock()
+	b.closed = true
+	for s := range b.subs {
+		close(s.ch)
+	}
+	b.subs = map[*subscriber]struct{}{}
+	b.mu.Unlock()
+	b.wg.Wait()
+	if b.closer != nil {
+		b.closer()
+	}
+}
@@ -0,0 +1,137 @@
+package host
+
+import (
+	"hash/fnv"
+	"net/http"
+	"sort"
+	"time"
+)
+
+var (
+	experimentTurns   = metrics.Counter("experiment_turns_total", "Number of turns per experiment variant.", "experiment", "variant", "status")
+	experimentSeconds = metrics.Counter("experiment_turn_seconds_total", "Total turn latency per experiment variant.", "experiment", "variant")
+	experimentTokens  = metrics.Counter("experiment_tokens_total", "Total LLM tokens per experiment variant.", "experiment", "variant")
+)
+
+// Experiments 把会话分配到各实验的分组, 分组决定系统提示词、模型和温度
+type Experiments struct {
+	list []ExperimentConfig
+}
+
+func NewExperiments(list []ExperimentConfig) *Experiments {
+	return &Experiments{list: list}
+}
+
+// turnSettings 是一轮对话实际使用的模型参数
+type turnSettings struct {
+	model        string
+	temperature  float32
+	systemPrompt string
+	variants     map[string]string // 实验名 -> 分组名, 记录在历史消息中
+}
+
+// settings 计算会话的模型参数, 后面的实验覆盖前面的设置
+// 会话已有分组记录时沿用原分组, 否则按会话 id 哈希分配, 保证同一会话始终落在同一组
+func (e *Experiments) settings(sess *Session, model string) turnSettings {
+	ts := turnSettings{model: model}
+	if e == nil || len(e.list) == 0 {
+		return ts
+	}
+	prev := sess.Variants()
+	ts.variants = make(map[string]string, len(e.list))
+	for _, exp := range e.list {
+		v := exp.find(prev[exp.Name])
+		if v == nil {
+			v = exp.assign(sess.ID)
+		}
+		ts.variants[exp.Name] = v.Name
+		if v.Model != "" {
+			ts.model = v.Model
+		}
+		if v.Temperature != nil {
+			ts.temperature = *v.Temperature
+		}
+		if v.SystemPrompt != "" {
+			ts.systemPrompt = v.SystemPrompt
+		}
+	}
+	return ts
+}
+
+func (exp *ExperimentConfig) find(name string) *VariantConfig {
+	for i := range exp.Variants {
+		if exp.Variants[i].Name == name {
+			return &exp.Variants[i]
+		}
+	}
+	return nil
+}
+
+// assign 按权重把会话哈希到某个分组
+func (exp *ExperimentConfig) assign(sessionID string) *VariantConfig {
+	total := 0
+	for _, v := range exp.Variants {
+		total += v.Weight
+	}
+	h := fnv.New32a()
+	h.Write([]byte(exp.Name + "/" + sessionID))
+	n := int(h.Sum32() % uint32(total))
+	for i := range exp.Variants {
+		n -= exp.Variants[i].Weight
+		if n < 0 {
+			return &exp.Variants[i]
+		}
+	}
+	return &exp.Variants[len(exp.Variants)-1]
+}
+
+// record 按分组累计一轮对话的结果
+func (e *Experiments) record(ts turnSettings, elapsed time.Duration, tokens int, err error) {
+	status := "ok"
+	if err != nil {
+		status = "error"
+	}
+	for exp, variant := range ts.variants {
+		experimentTurns.Inc(exp, variant, status)
+		experimentSeconds.Add(elapsed.Seconds(), exp, variant)
+		experimentTokens.Add(float64(tokens), exp, variant)
+	}
+}
+
+type variantStats struct {
+	Name         string  `json:"name"`
+	Weight       int     `json:"weight"`
+	Model        string  `json:"model,omitempty"`
+	Turns        int     `json:"turns"`
+	Errors       int     `json:"errors"`
+	AvgLatencyMs float64 `json:"avg_latency_ms"`
+	AvgTokens    float64 `json:"avg_tokens"`
+}
+
+type experimentStats struct {
+	Name     string         `json:"name"`
+	Variants []variantStats `json:"variants"`
+}
+
+// GET /api/experiments 返回各实验分组的汇总数据
+func (cc *ChatClient) handleExperiments(w http.ResponseWriter, r *http.Request) {
+	result := []experimentStats{}
+	if cc.experiments != nil {
+		for _, exp := range cc.experiments.list {
+			es := experimentStats{Name: exp.Name}
+			for _, v := range exp.Variants {
+				ok := experimentTurns.Value(exp.Name, v.Name, "ok")
+				failed := experimentTurns.Value(exp.Name, v.Name, "error")
+				vs := variantStats{Name: v.Name, Weight: v.Weight, Model: v.Model, Turns: int(ok + failed), Errors: int(failed)}
+				if vs.Turns > 0 {
+					vs.AvgLatencyMs = experimentSeconds.Value(exp.Name, v.Name) * 1000 / float64(vs.Turns)
+					vs.AvgTokens = experimentTokens.Value(exp.Name, v.Name) / float64(vs.Turns)
+				}
+				es.Variants = append(es.Variants, vs)
+			}
+			result = append(result, es)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	writeJSON(w, http.StatusOK, result)
+}
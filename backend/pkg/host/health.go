@@ -0,0 +1,305 @@
+package host
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	defaultHealthHistory = 120 // 每个服务保留的检查记录数, 按 30s 间隔约 1 小时
+	healthCheckTimeout   = 5 * time.Second
+
+	defaultLatencyFactor = 3.0
+	latencyWindow        = 5                     // 取最近几次 ping 的中位数判断延迟, 避免偶尔一次慢就报警
+	minDegradedRTT       = 10 * time.Millisecond // 延迟低于该值时不算变慢, 避免本机服务亚毫秒级的抖动被放大
+)
+
+var (
+	mcpServerUp     = metrics.Gauge("mcp_server_up", "Whether the last health check of an MCP server succeeded.", "server")
+	mcpHealthChecks = metrics.Counter("mcp_health_checks_total", "Number of MCP server health checks.", "server", "status")
+	mcpHealthFlaps  = metrics.Counter("mcp_health_transitions_total", "Number of MCP server up/down transitions.", "server")
+	mcpPingRTT      = metrics.Gauge("mcp_ping_rtt_seconds", "Round-trip time of the last successful ping to an MCP server.", "server")
+	mcpDegraded     = metrics.Gauge("mcp_server_degraded", "Whether the recent ping latency of an MCP server has degraded.", "server")
+)
+
+// HealthMonitor 定期检查每个 MCP 服务, 记录最近的结果, 通过 /api/status 和指标展示,
+// 在用户遇到工具调用失败之前发现不稳定的服务
+type HealthMonitor struct {
+	clients  []*MCPClient      // 受 mu 保护, 配置了 configSource 时会被替换
+	onChange func(name string) // 服务状态变化时调用, 可以为 nil
+	interval time.Duration
+	limit    int
+	factor   float64       // 最近的延迟超过基线的这么多倍时算变慢
+	maxRTT   time.Duration // 最近的延迟超过该值时算变慢, 0 表示只和基线比较
+
+	mu      sync.Mutex
+	servers map[string]*serverHealth
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+type healthCheck struct {
+	Time      time.Time `json:"time"`
+	OK        bool      `json:"ok"`
+	LatencyMs int64     `json:"latency_ms"`
+	RTTMs     float64   `json:"rtt_ms,omitempty"` // ping 的往返时间, 服务不支持 ping 时为空
+	Error     string    `json:"error,omitempty"`
+}
+
+type serverHealth struct {
+	healthy  bool
+	since    time.Time // 进入当前状态的时间
+	history  []healthCheck
+	degraded bool
+}
+
+// ServerStatus 是 /api/status 中一个服务的状态
+type ServerStatus struct {
+	Name        string        `json:"name"`
+	Healthy     bool          `json:"healthy"`
+	Since       time.Time     `json:"since"`
+	Uptime      float64       `json:"uptime"`      // 最近记录中成功的比例
+	Transitions int           `json:"transitions"` // 最近记录中状态变化的次数, 较大说明服务不稳定
+	LastError   string        `json:"last_error,omitempty"`
+	RTTMs       float64       `json:"rtt_ms,omitempty"`          // 最近几次 ping 往返时间的中位数
+	BaselineMs  float64       `json:"baseline_rtt_ms,omitempty"` // 更早的 ping 往返时间的中位数, 记录不够时为空
+	Degraded    bool          `json:"degraded"`                  // 延迟明显变慢
+	History     []healthCheck `json:"history"`
+}
+
+func NewHealthMonitor(clients []*MCPClient, cfg *HealthCheckConfig) *HealthMonitor {
+	h := &HealthMonitor{
+		clients:  clients,
+		interval: defaultHealthCheckInterval,
+		limit:    defaultHealthHistory,
+		factor:   defaultLatencyFactor,
+		servers:  make(map[string]*serverHealth),
+		stop:     make(chan struct{}),
+	}
+	if cfg != nil {
+		if cfg.Interval > 0 {
+			h.interval = time.Duration(cfg.Interval)
+		}
+		if cfg.History > 0 {
+			h.limit = cfg.History
+		}
+		if cfg.LatencyFactor > 0 {
+			h.factor = cfg.LatencyFactor
+		}
+		h.maxRTT = time.Duration(cfg.MaxRTT)
+	}
+	return h
+}
+
+// Start 立即检查一次, 之后按间隔检查, 只在 serve 中启动
+func (h *HealthMonitor) Start() {
+	h.wg.Add(1)
+	go func() {
+		defer h.wg.Done()
+		ticker := time.NewTicker(h.interval)
+		defer ticker.Stop()
+		for {
+			h.checkAll()
+			select {
+			case <-h.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (h *HealthMonitor) Close() {
+	close(h.stop)
+	h.wg.Wait()
+}
+
+// checkAll 并发检查所有服务, 慢的服务不影响其他服务的检查
+func (h *HealthMonitor) checkAll() {
+	h.mu.Lock()
+	clients := h.clients
+	h.mu.Unlock()
+	var wg sync.WaitGroup
+	for _, c := range clients {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			start := time.Now()
+			rtt, err := checkServer(c)
+			hc := healthCheck{Time: start, OK: err == nil, LatencyMs: time.Since(start).Milliseconds(), RTTMs: durationMs(rtt)}
+			if err != nil {
+				hc.Error = err.Error()
+			}
+			h.record(c.Name, hc)
+		}()
+	}
+	wg.Wait()
+}
+
+// setClients 替换要检查的服务, 已移除的服务不再出现在状态中
+func (h *HealthMonitor) setClients(clients []*MCPClient) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.clients = clients
+	for name := range h.servers {
+		if !slices.ContainsFunc(clients, func(c *MCPClient) bool { return c.Name == name }) {
+			delete(h.servers, name)
+		}
+	}
+}
+
+// checkServer 先用 ping, 成功时返回往返时间; 不支持 ping 的服务退回 tools/list, 往返时间为 0
+func checkServer(c *MCPClient) (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), healthCheckTimeout)
+	defer cancel()
+	start := time.Now()
+	if err := c.Ping(ctx); err == nil {
+		return time.Since(start), nil
+	}
+	_, err := listServerTools(ctx, c)
+	return 0, err
+}
+
+func durationMs(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// pingLatency 返回最近 latencyWindow 次 ping 往返时间的中位数, 以及更早的记录的中位数作为基线;
+// 早的记录不到 latencyWindow 次时 baseline 为 0
+func pingLatency(history []healthCheck) (recent, baseline float64) {
+	var rtts []float64
+	for _, hc := range history {
+		if hc.RTTMs > 0 {
+			rtts = append(rtts, hc.RTTMs)
+		}
+	}
+	if len(rtts) == 0 {
+		return 0, 0
+	}
+	n := max(len(rtts)-latencyWindow, 0)
+	recent = median(rtts[n:])
+	if n >= latencyWindow {
+		baseline = median(rtts[:n])
+	}
+	return recent, baseline
+}
+
+func median(values []float64) float64 {
+	sorted := slices.Clone(values)
+	slices.Sort(sorted)
+	if n := len(sorted); n%2 == 0 {
+		return (sorted[n/2-1] + sorted[n/2]) / 2
+	}
+	return sorted[len(sorted)/2]
+}
+
+// latencyDegraded 最近的延迟超过 maxRTT, 或者超过基线的 factor 倍时算变慢
+func (h *HealthMonitor) latencyDegraded(recent, baseline float64) bool {
+	if recent < durationMs(minDegradedRTT) {
+		return false
+	}
+	if h.maxRTT > 0 && recent > durationMs(h.maxRTT) {
+		return true
+	}
+	return baseline > 0 && recent > h.factor*baseline
+}
+
+func (h *HealthMonitor) record(name string, hc healthCheck) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s, ok := h.servers[name]
+	if !ok {
+		s = &serverHealth{healthy: hc.OK, since: hc.Time}
+		h.servers[name] = s
+	} else if s.healthy != hc.OK {
+		s.healthy, s.since = hc.OK, hc.Time
+		mcpHealthFlaps.Inc(name)
+		if h.onChange != nil {
+			h.onChange(name)
+		}
+		if hc.OK {
+			logf("mcp.health_up", name)
+		} else {
+			logf("mcp.health_down", name, hc.Error)
+		}
+	}
+	s.history = append(s.history, hc)
+	if len(s.history) > h.limit {
+		s.history = s.history[len(s.history)-h.limit:]
+	}
+
+	status, up := "ok", 1.0
+	if !hc.OK {
+		status, up = "error", 0
+	}
+	mcpHealthChecks.Inc(name, status)
+	mcpServerUp.Set(up, name)
+
+	if hc.RTTMs > 0 {
+		mcpPingRTT.Set(hc.RTTMs/1000, name)
+	}
+	recent, baseline := pingLatency(s.history)
+	if degraded := h.latencyDegraded(recent, baseline); degraded != s.degraded {
+		s.degraded = degraded
+		if degraded {
+			logf("mcp.latency_degraded", name, recent, baseline)
+		} else {
+			logf("mcp.latency_recovered", name, recent)
+		}
+	}
+	degraded := 0.0
+	if s.degraded {
+		degraded = 1
+	}
+	mcpDegraded.Set(degraded, name)
+}
+
+// down 服务最近一次检查失败时返回 true, 还没有检查过的服务不算; h 为 nil 时返回 false
+func (h *HealthMonitor) down(name string) bool {
+	if h == nil {
+		return false
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s, ok := h.servers[name]
+	return ok && !s.healthy
+}
+
+// Status 返回各服务的当前状态和最近的检查记录, 按服务名排序
+func (h *HealthMonitor) Status() []ServerStatus {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	out := make([]ServerStatus, 0, len(h.servers))
+	for name, s := range h.servers {
+		st := ServerStatus{Name: name, Healthy: s.healthy, Since: s.since, History: append([]healthCheck(nil), s.history...)}
+		ok := 0
+		for i, hc := range s.history {
+			if hc.OK {
+				ok++
+			} else {
+				st.LastError = hc.Error
+			}
+			if i > 0 && hc.OK != s.history[i-1].OK {
+				st.Transitions++
+			}
+		}
+		if len(s.history) > 0 {
+			st.Uptime = float64(ok) / float64(len(s.history))
+		}
+		st.RTTMs, st.BaselineMs = pingLatency(s.history)
+		st.Degraded = s.degraded
+		out = append(out, st)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// GET /api/status MCP 服务的健康状态和最近的检查记录, llm_only 为 true 表示启动时没有可用的 MCP 服务
+func (cc *ChatClient) handleStatus(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{"servers": cc.health.Status(), "llm_only": cc.llmOnly()})
+}
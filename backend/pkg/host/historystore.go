@@ -0,0 +1,301 @@
+package host
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+var ErrSessionNotFound = errors.New("session not found")
+
+// HistoryStore 持久化会话历史, 未启用时会话只保存在内存中
+type HistoryStore interface {
+	Append(sessionID string, msgs ...HistoryMessage) error
+	Load(sessionID string) ([]HistoryMessage, error)
+}
+
+// SharedHistoryStore 是多个副本共享的存储 (比如 Redis), 会话不再依赖某个副本的内存:
+// 新会话要登记到存储中, 每轮对话前要加分布式锁并重新读取历史
+type SharedHistoryStore interface {
+	HistoryStore
+	Create(sessionID string) error
+	LockTurn(ctx context.Context, sessionID string) (unlock func(), err error)
+}
+
+// PurgeableHistoryStore 可以按用户查找和删除会话历史, 用于清除用户数据
+type PurgeableHistoryStore interface {
+	HistoryStore
+	UserSessions(userID string) ([]string, error)
+	Delete(sessionID string) error
+	// SenderSessions 返回 sender 发送过消息、但由其他用户拥有的会话 (多人会话)
+	SenderSessions(sender string) ([]string, error)
+	// Redact 把会话中 sender 发送的消息替换为占位文字, 返回替换的消息序号; dryRun 时只返回序号
+	Redact(sessionID, sender string, dryRun bool) ([]int, error)
+}
+
+// purgedMessage 代替被清除的用户在多人会话中发送的消息, 会话的其他内容保持不变
+const purgedMessage = "[message removed]"
+
+// redactSender 把 msgs 中 sender 发送的消息替换为占位文字, 返回替换的消息序号; dryRun 时不修改
+func redactSender(msgs []HistoryMessage, sender string, dryRun bool) []int {
+	var idxs []int
+	for i := range msgs {
+		if sender == "" || msgs[i].Sender != sender {
+			continue
+		}
+		idxs = append(idxs, msgs[i].Index)
+		if !dryRun {
+			msgs[i].Content, msgs[i].Sender, msgs[i].Name = purgedMessage, "", ""
+		}
+	}
+	return idxs
+}
+
+// TruncatableHistoryStore 可以删除会话中某条之后的消息, 用于回滚到检查点
+type TruncatableHistoryStore interface {
+	HistoryStore
+	Truncate(sessionID string, n int) error // 只保留前 n 条消息
+}
+
+var sessionIDPattern = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+// FileHistoryStore 每个会话一个 jsonl 文件, 只追加写入
+type FileHistoryStore struct {
+	dir    string
+	cipher *ContentCipher // 为 nil 时明文保存
+
+	mu sync.Mutex
+}
+
+func NewFileHistoryStore(dir string, cipher *ContentCipher) (*FileHistoryStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &FileHistoryStore{dir: dir, cipher: cipher}, nil
+}
+
+func (fs *FileHistoryStore) path(sessionID string) (string, error) {
+	if !sessionIDPattern.MatchString(sessionID) {
+		return "", fmt.Errorf("invalid session id %q", sessionID)
+	}
+	return filepath.Join(fs.dir, sessionID+".jsonl"), nil
+}
+
+func (fs *FileHistoryStore) Append(sessionID string, msgs ...HistoryMessage) error {
+	path, err := fs.path(sessionID)
+	if err != nil {
+		return err
+	}
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	enc := json.NewEncoder(f)
+	for _, m := range msgs {
+		if fs.cipher != nil {
+			if m, err = fs.cipher.EncryptMessage(m); err != nil {
+				return err
+			}
+		}
+		if err := enc.Encode(m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (fs *FileHistoryStore) Load(sessionID string) ([]HistoryMessage, error) {
+	path, err := fs.path(sessionID)
+	if err != nil {
+		return nil, ErrSessionNotFound
+	}
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return fs.read(path)
+}
+
+// read 读出并解密一个会话文件的全部消息, 调用方持有 fs.mu
+func (fs *FileHistoryStore) read(path string) ([]HistoryMessage, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrSessionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var msgs []HistoryMessage
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var m HistoryMessage
+		if err := json.Unmarshal(scanner.Bytes(), &m); err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		if fs.cipher != nil {
+			if m, err = fs.cipher.DecryptMessage(m); err != nil {
+				return nil, fmt.Errorf("%s: %v", path, err)
+			}
+		}
+		msgs = append(msgs, m)
+	}
+	return msgs, scanner.Err()
+}
+
+// UserSessions 返回 userID 拥有的会话, 会话的所有者记录在每条消息中, 只需读取第一条
+func (fs *FileHistoryStore) UserSessions(userID string) ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(fs.dir, "*.jsonl"))
+	if err != nil {
+		return nil, err
+	}
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	var ids []string
+	for _, file := range files {
+		id := strings.TrimSuffix(filepath.Base(file), ".jsonl")
+		if !sessionIDPattern.MatchString(id) {
+			continue
+		}
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, err
+		}
+		var m HistoryMessage
+		err = json.NewDecoder(f).Decode(&m)
+		f.Close()
+		if err == nil && m.UserID == userID {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+// SenderSessions 扫描所有会话的全部消息, 返回 sender 发送过消息、但由其他用户拥有的会话
+func (fs *FileHistoryStore) SenderSessions(sender string) ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(fs.dir, "*.jsonl"))
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for _, file := range files {
+		id := strings.TrimSuffix(filepath.Base(file), ".jsonl")
+		if !sessionIDPattern.MatchString(id) {
+			continue
+		}
+		msgs, err := fs.Load(id)
+		if errors.Is(err, ErrSessionNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(msgs) > 0 && msgs[0].UserID != sender && len(redactSender(msgs, sender, true)) > 0 {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+// Redact 读出全部消息, 替换后写入临时文件再改名替换原文件
+func (fs *FileHistoryStore) Redact(sessionID, sender string, dryRun bool) ([]int, error) {
+	path, err := fs.path(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	msgs, err := fs.read(path)
+	if errors.Is(err, ErrSessionNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	idxs := redactSender(msgs, sender, dryRun)
+	if dryRun || len(idxs) == 0 {
+		return idxs, nil
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, m := range msgs {
+		if fs.cipher != nil {
+			if m, err = fs.cipher.EncryptMessage(m); err != nil {
+				return nil, err
+			}
+		}
+		if err := enc.Encode(m); err != nil {
+			return nil, err
+		}
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0o600); err != nil {
+		return nil, err
+	}
+	return idxs, os.Rename(tmp, path)
+}
+
+func (fs *FileHistoryStore) Delete(sessionID string) error {
+	path, err := fs.path(sessionID)
+	if err != nil {
+		return err
+	}
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// Truncate 只保留前 n 条消息, 写入临时文件后改名替换原文件
+func (fs *FileHistoryStore) Truncate(sessionID string, n int) error {
+	path, err := fs.path(sessionID)
+	if err != nil {
+		return err
+	}
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	// 每条消息一行, 不需要解析 (和解密) 内容
+	end := 0
+	for i := 0; i < n && end < len(data); i++ {
+		next := bytes.IndexByte(data[end:], '\n')
+		if next < 0 {
+			end = len(data)
+			break
+		}
+		end += next + 1
+	}
+	if end == len(data) {
+		return nil
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data[:end], 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
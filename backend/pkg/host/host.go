@@ -0,0 +1,1146 @@
+package host
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/guobinqiu/mcp-host-web/chat"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/sashabaranov/go-openai"
+	"google.golang.org/protobuf/proto"
+)
+
+// 每轮对话 (包括所有大模型和工具调用) 的缺省超时
+const defaultTurnTimeout = 60 * time.Second
+
+// upgrader 的 CheckOrigin 在 ChatClient.upgrade 中按配置设置
+var upgrader = websocket.Upgrader{}
+
+type ChatClient struct {
+	mcpClients   []*MCPClient // 通过 servers() 读取, 配置了 configSource 时会被替换
+	serversMu    sync.RWMutex
+	provider     Provider
+	model        string
+	sessions     *SessionStore // 每个会话单独保存历史消息，实现多轮对话
+	artifacts    *ArtifactStore
+	uploads      *UploadStore
+	transcriber  *Transcriber
+	policy       *Policy // 为 nil 时不过滤
+	experiments  *Experiments
+	pricing      map[string]ModelPrice
+	events       *EventBus    // 对话过程中的事件, 新的消费者在这里订阅即可
+	limiter      *LLMLimiter  // 为 nil 时不限流
+	search       *SearchIndex // 为 nil 时不提供搜索
+	auth         *AuthConfig
+	memory       *MemoryStore   // 为 nil 时不启用用户记忆
+	prompts      *PromptStore   // 为 nil 时不启用提示词模板
+	cache        *responseCache // 为 nil 时不缓存回答
+	budget       tokenBudget    // 按角色限制每天的 token 用量
+	oidc         *OIDCAuth      // 为 nil 时不提供登录
+	corsOrigin   string         // 允许携带 cookie 跨域访问的前端地址, 启用 OIDC 时取自 frontendUrl
+	turnTimeout  time.Duration
+	sessionIdle  time.Duration // 没有连接的会话空闲多久后移出内存, 为 0 时不移出
+	workflows    *MCPClient    // 工作流工具, 为 nil 时没有配置工作流
+	clock        *MCPClient    // get_current_time 工具
+	language     *LanguageConfig
+	dashboard    *Dashboard
+	response     *ResponseConfig
+	compression  *CompressionConfig // 为 nil 时不压缩
+	toolSchema   string             // 工具参数 schema 的方言, 见 sanitizeSchema
+	health       *HealthMonitor
+	tools        *toolRegistry     // 各服务的工具列表, 在轮次之间共享
+	context      *ContextConfig    // 为 nil 时发送全部历史
+	scratchpad   *ScratchpadConfig // 为 nil 时不汇总工具结果
+	summarizer   Summarizer        // 为 nil 时用 scratchpad.model 汇总
+	hints        *toolHints        // 为 nil 时不在工具描述后附加耗时等提示
+	chaos        *chaosInjector    // 为 nil 时不注入故障
+	conns        *connLimiter      // 为 nil 时不限制连接数
+	network      *networkPolicy    // 为 nil 时不信任代理, 不限制来源地址
+	resume       *resumeSigner
+	digests      *digester           // 为 nil 时不生成会话摘要
+	config       *configWatcher      // 为 nil 时没有配置 configSource
+	verification *VerificationConfig // 为 nil 时不核对回答
+	leaks        *leakGuard          // 为 nil 时不检查回答是否泄露内部配置
+	analytics    *toolAnalytics      // 为 nil 时不统计工具调用
+	softDeletes  *softDeletes        // 为 nil 时清除请求立即删除数据
+	demo         *demoMode           // 为 nil 时不是演示模式
+	toolBudget   *toolBudget         // 为 nil 时不限制每轮的工具调用
+	approvals    *approvalGate       // 等待用户批准的工具调用
+	elicitations *elicitationGate    // MCP 服务等待用户回复的 elicitation 请求
+}
+
+// newChatClient 按配置创建对话服务的各个组件, 返回的 closeAll 按创建的相反顺序释放资源
+// opts.Provider 为 nil 时按环境变量 OPENAI_API_KEY / OPENAI_API_BASE / OPENAI_API_MODEL 连接大模型
+func newChatClient(ctx context.Context, mcpConfig *MCPConfig, opts Options) (cc *ChatClient, closeAll func(), err error) {
+	var closers []func()
+	// 出错时返回的 closeAll 为 nil, 清理使用这里的副本
+	cleanup := func() {
+		for i := len(closers) - 1; i >= 0; i-- {
+			closers[i]()
+		}
+	}
+	closeAll = cleanup
+	defer func() {
+		if err != nil {
+			cleanup()
+		}
+	}()
+
+	history, err := newHistoryStore(mcpConfig.History)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	artifacts, err := NewArtifactStore(mcpConfig.Artifacts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	uploads, err := NewUploadStore(mcpConfig.Uploads)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var policy *Policy
+	if mcpConfig.PolicyFile != "" {
+		if policy, err = LoadPolicy(mcpConfig.PolicyFile); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	sessions := NewSessionStore(history)
+	var search *SearchIndex
+	if mcpConfig.Search != nil {
+		if search, err = NewSearchIndex(mcpConfig.Search.DB); err != nil {
+			return nil, nil, err
+		}
+		closers = append(closers, func() { search.Close() })
+		sessions.SetIndex(search)
+	}
+
+	var memory *MemoryStore
+	if mcpConfig.Memory != nil {
+		if memory, err = NewMemoryStore(mcpConfig.Memory); err != nil {
+			return nil, nil, err
+		}
+		closers = append(closers, func() { memory.client.Close() })
+	}
+
+	var prompts *PromptStore
+	if mcpConfig.Prompts != nil {
+		if prompts, err = NewPromptStore(mcpConfig.Prompts); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	events, err := NewEventBus(mcpConfig.Events)
+	if err != nil {
+		return nil, nil, err
+	}
+	closers = append(closers, events.Close)
+
+	// 配置了 configSource 时合并远程配置中的服务; 读取失败时先用配置文件中的服务, 之后监听时重试
+	var remote configSource
+	var remoteVersion int64
+	localServers := mcpConfig.MCPServers
+	if mcpConfig.ConfigSource != nil {
+		remote = newConfigSource(mcpConfig.ConfigSource)
+		servers, version, err := loadRemoteServers(ctx, remote, localServers)
+		if err != nil {
+			logf("configsource.startup_failed", err)
+		} else {
+			c := *mcpConfig
+			c.MCPServers, remoteVersion = servers, version
+			mcpConfig = &c
+		}
+	}
+
+	mcpClients, errs := LoadMCPClients(mcpConfig, ctx)
+	for _, name := range sortedKeys(opts.Servers) {
+		if _, ok := mcpConfig.MCPServers[name]; ok {
+			errs = append(errs, newError("mcp.duplicate_server", name))
+			continue
+		}
+		mcpClient, err := newInProcessMCPClient(name, opts.Servers[name])
+		if err != nil {
+			errs = append(errs, newError("mcp.init_failed", name, err))
+			continue
+		}
+		logf("mcp.in_process", name)
+		mcpClients = append(mcpClients, mcpClient)
+	}
+	if len(errs) > 0 {
+		for _, err := range errs {
+			log.Println(err)
+		}
+	}
+	closers = append(closers, func() {
+		if cc != nil {
+			mcpClients = cc.servers()
+		}
+		for _, mcpClient := range mcpClients {
+			mcpClient.Close()
+		}
+	})
+	if s := mcpConfig.Startup; s != nil && s.RequireServers && len(errs) > 0 {
+		return nil, nil, newError("startup.servers_required", len(errs))
+	}
+	// 没有可用的 MCP 服务时仍然可以对话, 只是没有工具
+	if len(mcpClients) == 0 {
+		logf("startup.llm_only")
+	}
+
+	apiKey := os.Getenv("OPENAI_API_KEY")
+	baseURL := os.Getenv("OPENAI_API_BASE")
+	model := os.Getenv("OPENAI_API_MODEL")
+	provider := opts.Provider
+	if provider != nil {
+		model = opts.Model
+	} else {
+		if apiKey == "" || baseURL == "" || model == "" {
+			return nil, nil, &ProviderError{Err: newError("server.env_missing")}
+		}
+		config := openai.DefaultConfig(apiKey)
+		config.BaseURL = baseURL
+		if httpClient, err := newProxyHTTPClient(os.Getenv("OPENAI_API_PROXY")); err != nil {
+			return nil, nil, err
+		} else if httpClient != nil {
+			config.HTTPClient = httpClient
+		}
+		provider = openai.NewClientWithConfig(config)
+	}
+
+	transcriber, err := NewTranscriberFromEnv(apiKey, baseURL)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var cache *responseCache
+	if mcpConfig.Cache != nil {
+		embedder := opts.Embedder
+		if embedder == nil {
+			if embedder, err = newEmbedderFromEnv(apiKey, baseURL); err != nil {
+				return nil, nil, err
+			}
+		}
+		cache = newResponseCache(mcpConfig.Cache, embedder)
+	}
+
+	var oidcAuth *OIDCAuth
+	var corsOrigin string
+	if mcpConfig.Auth != nil && mcpConfig.Auth.OIDC != nil {
+		if oidcAuth, err = NewOIDCAuth(ctx, mcpConfig.Auth.OIDC); err != nil {
+			return nil, nil, err
+		}
+		corsOrigin = urlOrigin(mcpConfig.Auth.OIDC.FrontendURL)
+	}
+
+	clock, err := newClockClient()
+	if err != nil {
+		return nil, nil, err
+	}
+	closers = append(closers, func() { clock.Close() })
+
+	cc = &ChatClient{
+		mcpClients:   mcpClients,
+		provider:     provider,
+		model:        model,
+		sessions:     sessions,
+		artifacts:    artifacts,
+		uploads:      uploads,
+		transcriber:  transcriber,
+		policy:       policy,
+		experiments:  NewExperiments(mcpConfig.Experiments),
+		pricing:      mcpConfig.Pricing,
+		events:       events,
+		limiter:      NewLLMLimiter(mcpConfig.RateLimit),
+		search:       search,
+		auth:         mcpConfig.Auth,
+		memory:       memory,
+		prompts:      prompts,
+		cache:        cache,
+		oidc:         oidcAuth,
+		corsOrigin:   corsOrigin,
+		turnTimeout:  time.Duration(mcpConfig.TurnTimeout),
+		sessionIdle:  time.Duration(mcpConfig.SessionIdle),
+		clock:        clock,
+		language:     mcpConfig.Language,
+		dashboard:    NewDashboard(events),
+		response:     mcpConfig.Response,
+		compression:  mcpConfig.Compression,
+		toolSchema:   mcpConfig.ToolSchema,
+		health:       NewHealthMonitor(mcpClients, mcpConfig.HealthCheck),
+		tools:        newToolRegistry(),
+		context:      mcpConfig.Context,
+		scratchpad:   mcpConfig.Scratchpad,
+		summarizer:   opts.Summarizer,
+		hints:        newToolHints(mcpConfig.ToolHints, events),
+		chaos:        newChaosInjector(mcpConfig.Chaos),
+		conns:        newConnLimiter(mcpConfig.Connections),
+		network:      newNetworkPolicy(mcpConfig.Network),
+		resume:       newResumeSigner(mcpConfig.Resume),
+		verification: mcpConfig.Verification,
+		demo:         newDemoMode(mcpConfig.Demo),
+		toolBudget:   newToolBudget(mcpConfig.ToolBudget),
+		approvals:    newApprovalGate(),
+		elicitations: newElicitationGate(),
+	}
+	for _, mcpClient := range mcpClients {
+		mcpClient.chaos = cc.chaos
+	}
+	// 服务恢复或中断后工具可能变化, 下一轮重新获取
+	cc.health.onChange = cc.tools.invalidateName
+	if cc.summarizer != nil && cc.scratchpad == nil {
+		cc.scratchpad = &ScratchpadConfig{}
+	}
+	if cc.toolSchema == "" {
+		cc.toolSchema = detectSchemaDialect(baseURL)
+	}
+
+	if len(mcpConfig.Workflows) > 0 {
+		if cc.workflows, err = newWorkflowClient(mcpConfig.Workflows, cc.callTool); err != nil {
+			return nil, nil, err
+		}
+		closers = append(closers, func() { cc.workflows.Close() })
+	}
+	if cc.digests, err = newDigester(cc, mcpConfig.Digest); err != nil {
+		return nil, nil, err
+	}
+	if cc.analytics, err = newToolAnalytics(mcpConfig.Analytics); err != nil {
+		return nil, nil, err
+	}
+	if cc.softDeletes, err = newSoftDeletes(mcpConfig.Purge); err != nil {
+		return nil, nil, err
+	}
+	cc.sessions.SetHidden(cc.softDeletes.hidden)
+	cc.leaks = newLeakGuard(mcpConfig, baseURL, cc.dataDirs())
+	if remote != nil {
+		cc.config = newConfigWatcher(cc, remote, localServers, mcpConfig.MCPServers, remoteVersion)
+	}
+	return cc, closeAll, nil
+}
+
+// handler 注册所有 HTTP 和 WebSocket 接口
+func (cc *ChatClient) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ws", cc.ChatLoop)
+	mux.HandleFunc("/api/sessions/{id}/messages", cc.withCORS(cc.handleSessionMessages))
+	mux.HandleFunc("/api/sessions/{id}/pins", cc.withCORS(cc.requireRole(RoleUser, cc.handlePins)))
+	mux.HandleFunc("/api/sessions/{id}/pins/{index}", cc.withCORS(cc.requireRole(RoleUser, cc.handlePins)))
+	mux.HandleFunc("/api/sessions/{id}/checkpoints", cc.withCORS(cc.requireRole(RoleUser, cc.handleCheckpoints)))
+	mux.HandleFunc("/api/sessions/{id}/checkpoints/{name}", cc.withCORS(cc.requireRole(RoleUser, cc.handleCheckpoints)))
+	mux.HandleFunc("/api/sessions/{id}/checkpoints/{name}/rollback", cc.withCORS(cc.requireRole(RoleUser, cc.handleCheckpoints)))
+	mux.HandleFunc("/api/sessions/{id}/approvals/{approval}", cc.withCORS(cc.requireRole(RoleUser, cc.handleApproval)))
+	mux.HandleFunc("/api/sessions/{id}/elicitations/{elicitation}", cc.withCORS(cc.requireRole(RoleUser, cc.handleElicitation)))
+	mux.HandleFunc("/api/sessions/{id}/participants", cc.withCORS(cc.requireRole(RoleUser, cc.handleParticipants)))
+	mux.HandleFunc("/api/sessions/{id}/digests", cc.withCORS(cc.handleSessionDigests))
+	mux.HandleFunc("/api/sessions/{id}/resume", cc.withCORS(cc.requireRole(RoleUser, cc.handleResumeToken)))
+	mux.HandleFunc("/api/sessions/{id}/participants/{user}", cc.withCORS(cc.requireRole(RoleUser, cc.handleParticipants)))
+	mux.HandleFunc("/api/artifacts/{id}", cc.withCORS(cc.handleArtifact))
+	mux.HandleFunc("/api/upload", cc.withCORS(cc.requireRole(RoleUser, cc.handleUpload)))
+	mux.HandleFunc("/api/transcribe", cc.withCORS(cc.requireRole(RoleUser, cc.handleTranscribe)))
+	mux.HandleFunc("/api/experiments", cc.withCORS(cc.requireRole(RoleAdmin, cc.handleExperiments)))
+	mux.HandleFunc("/api/search", cc.withCORS(cc.handleSearch))
+	mux.HandleFunc("/api/memories", cc.withCORS(cc.handleMemories))
+	mux.HandleFunc("/api/memories/{id}", cc.withCORS(cc.handleMemories))
+	mux.HandleFunc("/api/prompts", cc.withCORS(cc.handlePrompts))
+	mux.HandleFunc("/api/prompts/{name}", cc.withCORS(cc.handlePrompts))
+	mux.HandleFunc("/api/prompts/{name}/render", cc.withCORS(cc.handlePrompts))
+	mux.HandleFunc("/api/me", cc.withCORS(cc.handleMe))
+	mux.HandleFunc("/api/resources/templates", cc.withCORS(cc.requireRole(RoleUser, cc.handleResourceTemplates)))
+	mux.HandleFunc("/api/complete", cc.withCORS(cc.requireRole(RoleUser, cc.handleComplete)))
+	mux.HandleFunc("/api/digests", cc.withCORS(cc.requireRole(RoleAdmin, cc.handleDigests)))
+	mux.HandleFunc("/api/users/{id}/data", cc.withCORS(cc.requireRole(RoleAdmin, cc.handlePurgeUser)))
+	mux.HandleFunc("/api/users/{id}/data/restore", cc.withCORS(cc.requireRole(RoleAdmin, cc.handleRestoreUser)))
+	mux.HandleFunc("/api/analytics/tools", cc.withCORS(cc.requireRole(RoleAdmin, cc.handleToolAnalytics)))
+	mux.HandleFunc("/api/status", cc.withCORS(cc.requireRole(RoleAdmin, cc.handleStatus)))
+	mux.HandleFunc("/api/openapi.json", cc.withCORS(cc.handleOpenAPI))
+	mux.HandleFunc("/api/schema", cc.withCORS(cc.handleSchema))
+	mux.HandleFunc("/api/schema/chat.proto", cc.withCORS(cc.handleProtoFile))
+	if cc.oidc != nil {
+		mux.HandleFunc("/auth/login", cc.oidc.handleLogin)
+		mux.HandleFunc("/auth/callback", cc.oidc.handleCallback)
+		mux.HandleFunc("/auth/logout", cc.oidc.handleLogout)
+	}
+	mux.HandleFunc("/metrics", cc.requireRole(RoleAdmin, metrics.ServeHTTP))
+	mux.HandleFunc("/debug/dashboard", cc.requireRole(RoleAdmin, cc.handleDashboard))
+	cc.registerDebugHandlers(mux)
+	return cc.withRecover(mux)
+}
+
+// newHistoryStore 按配置创建持久化存储, 未配置时返回 nil
+func newHistoryStore(cfg *HistoryConfig) (HistoryStore, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+	var contentCipher *ContentCipher
+	if cfg.Encryption != nil {
+		key, err := LoadEncryptionKey(cfg.Encryption)
+		if err != nil {
+			return nil, newError("history.key_failed", err)
+		}
+		if contentCipher, err = NewContentCipher(key); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.Redis != nil {
+		store, err := NewRedisHistoryStore(cfg.Redis, contentCipher)
+		if err != nil {
+			return nil, err
+		}
+		return store, nil
+	}
+	store, err := NewFileHistoryStore(cfg.Dir, contentCipher)
+	if err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+func (cc *ChatClient) ChatLoop(w http.ResponseWriter, r *http.Request) {
+	ip := cc.clientIP(r)
+	if !cc.network.wsAllowed(ip) {
+		ipDenied.Inc("ws")
+		logf("ws.ip_denied", ip)
+		writeError(w, r, http.StatusForbidden, "api.ip_forbidden")
+		return
+	}
+	ws, err := cc.upgrade(w, r)
+	if err != nil {
+		// upgrader 已经向客户端返回了错误响应
+		logf("ws.upgrade_failed", err)
+		return
+	}
+	locale := requestLocale(r)
+	defer ws.Close()
+	conn := &wsConn{ws: ws, chaos: cc.chaos}
+	// 第一条消息告诉客户端服务端的版本和协商的协议版本, 客户端的协议版本不再支持时拒绝连接
+	protocol, ok := negotiateProtocol(r)
+	if err := conn.write(helloMessage(protocol), 0); err != nil {
+		logf("ws.write_failed", ip, err)
+		return
+	}
+	if !ok {
+		reject(conn, r, ip, rejectUnsupportedProtocol)
+		return
+	}
+	// 超出连接数限制时告诉客户端原因后关闭
+	release, reason := cc.conns.acquire(cc.userID(r), ip)
+	if reason != "" {
+		reject(conn, r, ip, reason)
+		return
+	}
+	defer release()
+	if r.URL.Query().Get("watch") == "1" {
+		cc.spectate(conn, r)
+		return
+	}
+
+	// 带上 session_id 或转移令牌 (?resume=) 时恢复之前的会话, 否则新建
+	sessionID := r.URL.Query().Get("session_id")
+	if claims, ok := cc.resumeClaims(r); ok && sessionID == "" {
+		sessionID = claims.SessionID
+	}
+	sess, ok := cc.sessionFor(r, sessionID)
+	if !ok {
+		sess = cc.sessions.Create(cc.userID(r))
+	}
+	// 回答语言: 本次连接声明的语言优先, 其次是会话之前的语言, 最后是配置的缺省语言
+	language := sanitizeLanguage(r.URL.Query().Get("language"))
+	if language == "" {
+		language = sess.Language()
+	}
+	if language == "" && cc.language != nil {
+		language = cc.language.Default
+	}
+	sess.SetLanguage(language)
+	// 客户端通过 ?format=bullets|prose|code 和 ?max_length= 声明对回答格式和长度的要求, 没有带上时沿用会话之前的要求
+	sess.SetPreferences(sess.Preferences().applyQuery(r.URL.Query()))
+	// 客户端通过 ?debug=1 开启会话的调试, 每轮下发各阶段的耗时; debug=0 关闭
+	switch r.URL.Query().Get("debug") {
+	case "1":
+		sess.SetDebug(true)
+	case "0":
+		sess.SetDebug(false)
+	}
+	// 管理员通过 ?debug_context=1 开启上下文调试, 其他角色的请求忽略
+	admin := roleRank[cc.role(r)] >= roleRank[RoleAdmin]
+	switch r.URL.Query().Get("debug_context") {
+	case "1":
+		if admin {
+			sess.SetDebugContext(true)
+		}
+	case "0":
+		sess.SetDebugContext(false)
+	}
+	cc.events.Publish(EventSessionStarted, sess.ID, map[string]any{"resumed": ok, "user": sess.UserID()})
+	defer cc.events.Publish(EventSessionEnded, sess.ID, nil)
+	// 连接内的 panic 只断开这个连接, 不影响其他会话
+	defer cc.recoverPanic(r.Context(), "connection", sess.ID, nil)
+	// 多人会话中每个参与者有自己的 outbox, 其他参与者的消息通过广播收到
+	// 凭转移令牌连接时以签发者的身份继续对话
+	user := cc.sessionUser(r, sess)
+	box := sess.outboxFor(user)
+	// seq 为已分配的最大消息编号, 客户端据此判断服务端的 outbox 是否已经重置
+	if err := conn.write(&chat.ChatMessage{Type: "session", SessionId: sess.ID, Seq: box.lastSeq()}, 0); err != nil {
+		logf("ws.write_failed", sess.ID, err)
+		return
+	}
+	// 要恢复的会话不存在 (已删除, 或者没有持久化时已移出内存) 时告诉客户端这是一个新会话
+	if sessionID != "" && !ok {
+		if err := conn.write(&chat.ChatMessage{Type: "warning", Status: "session_not_found", Content: T(locale, "warning.session_not_found"), SessionId: sess.ID}, 0); err != nil {
+			logf("ws.write_failed", sess.ID, err)
+			return
+		}
+	}
+	// 告诉客户端现在没有工具可用, 回答只来自大模型
+	if cc.llmOnly() {
+		if err := conn.write(&chat.ChatMessage{Type: "warning", Status: "llm_only", Content: T(locale, "warning.llm_only"), SessionId: sess.ID}, 0); err != nil {
+			logf("ws.write_failed", sess.ID, err)
+			return
+		}
+	}
+	sess.audience.add(conn)
+	defer sess.audience.remove(conn)
+	// 客户端通过 ?ack=1 启用确认, 之后的消息经过 outbox 发送, 断线重连后补发未确认的消息
+	acked := r.URL.Query().Get("ack") == "1"
+	send := func(msg *chat.ChatMessage) error { return conn.write(msg, 0) }
+	if acked {
+		defer box.detach(conn)
+		if err := box.attach(conn); err != nil {
+			logf("ws.write_failed", sess.ID, err)
+			return
+		}
+		send = box.send
+	}
+	// 客户端通过 ?gzip=1 声明可以解压 content_gzip, 较长的内容压缩后下发
+	if c := cc.compression; c != nil && c.PayloadThreshold > 0 && r.URL.Query().Get("gzip") == "1" {
+		next := send
+		send = func(msg *chat.ChatMessage) error { return next(compressContent(msg, c.PayloadThreshold)) }
+	}
+
+	// 上下文只发给管理员自己的连接, 限流按连接计算
+	var echo *contextEcho
+	if admin && sess.DebugContext() {
+		echo = newContextEcho(sess.ID, send)
+	}
+
+	// 连接级别的 ctx, 客户端断开时取消正在进行的大模型和工具调用
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	ctx = withRole(ctx, cc.role(r))
+	ctx = withSender(ctx, user)
+	// 工具可以配置注入连接时的令牌, 只保存在连接的 ctx 中
+	ctx = withToolIdentity(ctx, toolIdentity{token: requestToken(r)})
+	// 客户端通过 ?tz= 声明所在时区, 比如 Asia/Shanghai
+	ctx = withClientInfo(ctx, clientInfo{loc: loadTimezone(r.URL.Query().Get("tz")), locale: locale})
+
+	// 单独的 goroutine 读取消息, 处理对话期间也能及时发现连接断开
+	incoming := make(chan *chat.ChatMessage, 16)
+	go func() {
+		// 启用确认时断开连接不取消正在进行的这轮对话, 回答缓存起来等重连后补发
+		if !acked {
+			defer cancel()
+		}
+		defer close(incoming)
+		defer cc.recoverPanic(ctx, "connection", sess.ID, nil)
+		for {
+			_, msgBytes, err := conn.ws.ReadMessage()
+			if err != nil {
+				logf("ws.read_failed", sess.ID, err)
+				return
+			}
+
+			recvMsg := &chat.ChatMessage{}
+			if err := proto.Unmarshal(msgBytes, recvMsg); err != nil {
+				logf("ws.unmarshal_failed", sess.ID, err)
+				continue
+			}
+			// 对话进行中也要及时处理确认, 不经过 incoming
+			if recvMsg.Type == "ack" {
+				box.ack(recvMsg.Ack)
+				continue
+			}
+			// 批准工具调用时这一轮正在等待, 同样不经过 incoming
+			if recvMsg.Type == "approval" {
+				if !cc.approvals.resolve(sess.ID, recvMsg.GetApproval().GetId(), recvMsg.GetApproval().GetApproved()) {
+					logf("mcp.approval_unknown", sess.ID, recvMsg.GetApproval().GetId())
+				}
+				continue
+			}
+			// 回复 elicitation 时工具调用正在等待, 同样不经过 incoming
+			if recvMsg.Type == "elicitation" {
+				e := recvMsg.GetElicitation()
+				if err := cc.elicitations.resolve(sess.ID, e.GetId(), e.GetAction(), e.GetContent()); err != nil {
+					logf("mcp.elicitation_rejected", sess.ID, e.GetId(), err)
+					if !errors.Is(err, errElicitationNotFound) {
+						// 回复不符合要求时请求仍在等待, 告诉用户改正后重新提交, elicitation.id 标明是哪个请求
+						send(&chat.ChatMessage{Type: "error", Content: T(locale, "error.invalid_elicitation", err), SessionId: sess.ID, Elicitation: &chat.Elicitation{Id: e.GetId()}})
+					}
+				}
+				continue
+			}
+			select {
+			case incoming <- recvMsg:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	for recvMsg := range incoming {
+		// fmt.Println(recvMsg)
+
+		// 每条消息 (一轮对话) 一个 trace id, 这一轮下发的所有消息都带上
+		traceID := newTraceID()
+		turnCtx := withTrace(ctx, traceID)
+		var timings *turnTimings
+		if sess.Debug() {
+			timings = newTurnTimings()
+			turnCtx = withTimings(turnCtx, timings)
+		}
+		if echo != nil {
+			turnCtx = withContextEcho(turnCtx, echo)
+		}
+		emit := func(msg *chat.ChatMessage) {
+			if msg.TraceId == "" {
+				msg.TraceId = traceID
+			}
+			start := time.Now()
+			sess.audience.broadcast(msg, conn)
+			if err := send(msg); err != nil {
+				logf("ws.write_failed", sess.ID, err)
+			}
+			timings.addSerialize(time.Since(start))
+		}
+
+		// N-best 模式下用户挑选的候选回答写入历史
+		if recvMsg.Type == "pick" {
+			picked, ok := sess.PickChoice(int(recvMsg.Choice))
+			if !ok {
+				emit(&chat.ChatMessage{Type: "error", Content: T(locale, "error.invalid_choice"), SessionId: sess.ID})
+				continue
+			}
+			emit(&chat.ChatMessage{Role: openai.ChatMessageRoleAssistant, Content: picked, SessionId: sess.ID})
+			continue
+		}
+
+		// 语音消息先转成文字, 并把识别结果发回客户端显示
+		if len(recvMsg.Audio) > 0 {
+			transcribeCtx, transcribeCancel := context.WithTimeout(turnCtx, 60*time.Second)
+			text, err := cc.transcriber.Transcribe(transcribeCtx, recvMsg.Audio, recvMsg.AudioFormat)
+			transcribeCancel()
+			if ctx.Err() != nil {
+				break
+			}
+			if err != nil {
+				logf("chat.transcribe_failed", logTag(turnCtx, sess.ID), err)
+				cc.events.Publish(EventError, sess.ID, traceData(turnCtx, map[string]any{"stage": "transcribe", "error": err.Error()}))
+				emit(&chat.ChatMessage{Type: "error", Content: T(locale, "error.transcribe_failed"), SessionId: sess.ID})
+				continue
+			}
+			recvMsg.Content = text
+			emit(&chat.ChatMessage{Type: "transcript", Role: openai.ChatMessageRoleUser, Content: text, SessionId: sess.ID})
+		}
+
+		// 按名字使用提示词模板, 替换变量后的文本作为用户消息发回, 客户端事先不知道模板的内容
+		if recvMsg.Prompt != "" {
+			text, key, args := cc.renderPrompt(user, recvMsg.Prompt, recvMsg.Variables)
+			if key != "" {
+				emit(&chat.ChatMessage{Type: "error", Content: T(locale, key, args...), SessionId: sess.ID})
+				continue
+			}
+			recvMsg.Content = text
+			emit(&chat.ChatMessage{Role: openai.ChatMessageRoleUser, Content: text, SessionId: sess.ID, Sender: user})
+		}
+
+		// 用户消息由客户端自己显示, 单独转发给其他参与者和旁观者 (语音消息和模板消息已经发出)
+		if len(recvMsg.Audio) == 0 && recvMsg.Prompt == "" {
+			sess.audience.broadcast(&chat.ChatMessage{Role: openai.ChatMessageRoleUser, Content: recvMsg.Content, SessionId: sess.ID, TraceId: traceID, Sender: user}, conn)
+		}
+		cached := false
+		var verification *chat.Verification
+		queryCtx := withVerification(withCachedFlag(withCandidates(turnCtx, int(recvMsg.Candidates)), &cached), &verification)
+		response, err := cc.ProcessQuery(queryCtx, sess, recvMsg.Content, emit)
+		if ctx.Err() != nil {
+			// 客户端已断开, 不用再回复
+			logf("chat.cancelled", logTag(turnCtx, sess.ID))
+			break
+		}
+		// 各阶段的耗时在回答之前下发, 不包括回答消息本身的发送
+		if timings != nil {
+			emit(&chat.ChatMessage{Type: "debug", Timing: timings.message(), SessionId: sess.ID})
+		}
+		if err != nil {
+			var panicErr *PanicError
+			if errors.As(err, &panicErr) {
+				// 已记录日志和错误事件, 连接继续可用
+				emit(&chat.ChatMessage{Type: "error", Content: T(locale, "error.request_failed"), SessionId: sess.ID})
+				continue
+			}
+			var violation *PolicyViolation
+			if errors.As(err, &violation) {
+				cc.events.Publish(EventError, sess.ID, traceData(turnCtx, map[string]any{"stage": "policy", "rule": violation.Rule, "direction": violation.Direction}))
+				emit(&chat.ChatMessage{Type: "error", Content: T(locale, "error.policy_blocked"), SessionId: sess.ID})
+				continue
+			}
+			if errors.Is(err, ErrForbidden) || errors.Is(err, ErrBudgetExceeded) {
+				key := "error.forbidden"
+				if errors.Is(err, ErrBudgetExceeded) {
+					key = "error.budget_exceeded"
+				}
+				emit(&chat.ChatMessage{Type: "error", Content: T(locale, key), SessionId: sess.ID})
+				continue
+			}
+			logf("chat.request_failed", logTag(turnCtx, sess.ID), err)
+			cc.events.Publish(EventError, sess.ID, traceData(turnCtx, map[string]any{"stage": "turn", "error": err.Error()}))
+			emit(&chat.ChatMessage{Type: "error", Content: T(locale, "error.request_failed"), SessionId: sess.ID})
+			continue
+		}
+
+		if sess.HasChoices() {
+			// 候选回答已经以 choice 消息发出, 等待用户挑选
+			continue
+		}
+
+		replyMsg := &chat.ChatMessage{}
+		replyMsg.Role = openai.ChatMessageRoleAssistant
+		replyMsg.Content = response
+		replyMsg.SessionId = sess.ID
+		replyMsg.Cached = cached
+		replyMsg.Verification = verification
+		emit(replyMsg)
+	}
+}
+
+func writeMessage(ws *websocket.Conn, msg *chat.ChatMessage) error {
+	buf, err := proto.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return ws.WriteMessage(websocket.BinaryMessage, buf)
+}
+
+// ProcessQuery 处理一轮对话, emit 用于在生成回答的过程中向客户端推送事件 (比如附件)
+// ctx 取消 (比如客户端断开) 时停止后续的大模型和工具调用
+func (cc *ChatClient) ProcessQuery(ctx context.Context, sess *Session, userInput string, emit func(*chat.ChatMessage)) (response string, err error) {
+	// 本轮对话中的 panic (比如工具结果处理) 作为错误返回, 不影响同一连接的后续对话
+	defer cc.recoverPanic(ctx, "turn", sess.ID, &err)
+	ctx, cancel := context.WithTimeoutCause(ctx, cc.turnTimeout, errTurnTimeout)
+	defer cancel()
+
+	// 只读角色不能对话, 其他角色按配置限制每天的用量
+	role := roleFrom(ctx)
+	if roleRank[role] < roleRank[RoleUser] {
+		return "", ErrForbidden
+	}
+	if err := cc.budget.check(budgetKey(ctx, sess), cc.demo.tokensPerDay(cc.roleConfig(role).MaxTokensPerDay)); err != nil {
+		return "", err
+	}
+
+	endTurn, err := cc.sessions.BeginTurn(ctx, sess)
+	if err != nil {
+		return "", err
+	}
+	defer endTurn()
+	// 临时工具的结果只在这一轮中使用 (包括出错的情况)
+	defer sess.ForgetEphemeral()
+	// 上一轮的候选回答没有挑选就继续对话时采用第一个, 保证历史中每个问题都有回答
+	sess.PickChoice(0)
+	n := candidatesFrom(ctx)
+
+	// 按实验分组确定本轮使用的模型参数, 并统计各分组的效果
+	settings := cc.experiments.settings(sess, cc.model)
+	sess.SetVariants(settings.variants)
+	// 统计本轮耗时和用量, 结束时 (包括出错) 推送 summary 事件
+	stats := newTurnStats(cc.pricing)
+	cc.events.Publish(EventTurnStarted, sess.ID, traceData(ctx, map[string]any{"model": settings.model, "variants": settings.variants}))
+	defer func() {
+		cc.budget.add(budgetKey(ctx, sess), stats.usage.TotalTokens)
+		cc.experiments.record(settings, time.Since(stats.start), stats.usage.TotalTokens, err)
+		cc.events.Publish(EventTurnFinished, sess.ID, traceData(ctx, map[string]any{
+			"duration_ms": time.Since(stats.start).Milliseconds(),
+			"tokens":      stats.usage.TotalTokens,
+			"cost":        stats.cost,
+			"ok":          err == nil,
+		}))
+		emit(&chat.ChatMessage{Type: "summary", Summary: stats.summary(), SessionId: sess.ID})
+	}()
+	// 超过总超时时用已经得到的内容回答, 并注明在哪一步超时
+	progress := &turnProgress{}
+	defer func() {
+		if err != nil && timedOut(ctx) {
+			response, err = cc.partialResponse(ctx, sess, progress)
+		}
+	}()
+
+	// 先按策略过滤用户输入, 被拦截的消息不进入历史
+	userInput, err = cc.policy.Apply(policyInput, userInput)
+	if err != nil {
+		return "", err
+	}
+
+	// 推送对话进行到哪一步, 前端据此显示进度, 不写入历史
+	status := func(code, key string, args ...any) {
+		emit(&chat.ChatMessage{Type: "status", Status: code, Content: T(clientInfoFrom(ctx).locale, key, args...), SessionId: sess.ID})
+	}
+
+	// 配置了语义缓存时, 最近回答过相似的问题就直接使用当时的回答, 不再调用大模型和工具
+	cacheScope, cacheable := cc.cacheScope(ctx, sess, settings.model, n)
+	var question []float32
+	if cacheable {
+		var embedErr error
+		if question, embedErr = cc.cache.embed(ctx, userInput); embedErr != nil {
+			cacheLookups.Inc("error")
+			logf("cache.embed_failed", logTag(ctx, sess.ID), embedErr)
+			cacheable = false
+		} else if answer, ok := cc.cache.lookup(cacheScope, question); ok {
+			cacheLookups.Inc("hit")
+			markCached(ctx)
+			stats.cached = true
+			status("cached", "status.cached")
+			sess.AppendUser(senderFrom(ctx), userInput)
+			sess.Append(openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: answer})
+			return answer, nil
+		} else {
+			cacheLookups.Inc("miss")
+		}
+	}
+
+	// 配置了 inject 的工具参数由主机填入当前用户和会话
+	identity := toolIdentityFrom(ctx)
+	identity.userID, identity.sessionID = senderFrom(ctx), sess.ID
+	if identity.userID == "" {
+		identity.userID = sess.UserID()
+	}
+	ctx = withToolIdentity(ctx, identity)
+
+	// 开启记忆时加入记忆工具, 工具通过 ctx 得知当前用户
+	mcpClients := cc.servers()
+	if owner, ok := cc.memoryOwner(sess.UserID()); ok {
+		ctx = withMemoryOwner(ctx, owner)
+		mcpClients = append(slices.Clip(mcpClients), cc.memory.client)
+	}
+	for _, builtin := range []*MCPClient{cc.clock, cc.workflows} {
+		if builtin != nil {
+			mcpClients = append(slices.Clip(mcpClients), builtin)
+		}
+	}
+
+	// 列出所有可用工具, 个别服务失败时用其他服务的工具继续, 并提醒客户端
+	discoveryStart := time.Now()
+	catalog := cc.discoverTools(ctx, sess.ID, mcpClients, role)
+	timingsFrom(ctx).add("discovery", "", discoveryStart, nil)
+	catalog.warn(ctx, sess.ID, emit)
+	toolNameMap := catalog.servers
+	var toolOutputs []ToolResult // 本轮的原始工具结果, 用于核对回答
+	budgetExhausted := false     // 本轮的工具预算已经用完
+
+	// 首轮交互
+	sess.AppendUser(senderFrom(ctx), userInput)
+
+	// 遍历每个mcpClient读取其对应的mcpServer上的工具告诉大模型
+	status("thinking", "status.thinking")
+	resp, err := cc.completeTurn(ctx, sess.ID, stats, openai.ChatCompletionRequest{
+		Model:       settings.model,
+		Temperature: settings.temperature,
+		Messages:    cc.buildMessages(ctx, sess, settings),
+		Tools:       catalog.tools,
+		N:           n,
+	})
+	if err != nil {
+		return "", err
+	}
+	// fmt.Println(resp)
+
+	// OpenAI的API设计上支持一次请求返回多个候选回答（choices）默认为1
+	for _, choice := range resp.Choices {
+
+		// message.Content和message.ToolCalls二选一的关系
+		// 如果用户输入涉及需要调用工具，模型一般会返回 ToolCalls
+		// 否则直接返回 Content 作为文本回答
+		message := choice.Message
+
+		if message.Content != "" { // 若直接生成文本
+			progress.text = append(progress.text, message.Content)
+
+		} else if len(message.ToolCalls) > 0 { // 若调用工具
+			// 这个代码len(message.ToolCalls)永远为1
+			// 但如果一个MCP Server里注册了两个工具get_temperature和get_humidity
+			// 我问大模型: “我想调用xxx工具看一下今天的温度和湿度分别是多少?”message.ToolCalls就变2了
+			// 如果多个mcp server 一个注册get_temperature, 一个注册get_humidity
+			// 就要把ChatClient的mcpClient改成数组了 通过for循环每个mcpClient来列出所有可用工具给大模型
+			toolCallMessages := []openai.ChatCompletionMessage{}
+			callCounts := make(map[string]int) // 按工具统计本轮调用次数
+
+			for i, toolCall := range message.ToolCalls {
+				toolName := toolCall.Function.Name
+				toolArgsRaw := toolCall.Function.Arguments
+				// fmt.Println("=====toolCall.Function.Arguments:", toolArgsRaw)
+				var toolArgs map[string]any
+				_ = json.Unmarshal([]byte(toolArgsRaw), &toolArgs)
+
+				// 调用工具
+				req := mcp.CallToolRequest{}
+				req.Params.Name = toolName
+				req.Params.Arguments = toolArgs
+				if id := traceFrom(ctx); id != "" {
+					req.Params.Meta = &mcp.Meta{AdditionalFields: map[string]any{"traceId": id}}
+				}
+				//resp, err := cc.mcpClient.CallTool(ctx, req)
+				mcpClient, ok := toolNameMap[toolName]
+				if !ok {
+					// 每个 tool_call 都要有对应的 tool 消息, 否则大模型接口拒绝后续的请求
+					logf("mcp.unknown_tool", logTag(ctx, sess.ID), toolName)
+					toolCallMessages = append(toolCallMessages, openai.ChatCompletionMessage{
+						Role:       openai.ChatMessageRoleTool,
+						ToolCallID: toolCall.ID,
+						Content:    unknownToolMessage(toolName, toolNameMap),
+						Name:       toolName,
+					})
+					continue
+				}
+				toolArgs = mcpClient.toolArguments(ctx, toolName, toolArgs)
+				req.Params.Arguments = toolArgs
+				limits := mcpClient.Tools[toolName]
+				if callCounts[toolName]++; limits.MaxCallsPerTurn > 0 && callCounts[toolName] > limits.MaxCallsPerTurn {
+					// 仍然要回复这个 tool_call, 告诉大模型已达到调用上限
+					logf("mcp.call_limit", logTag(ctx, sess.ID), toolName, limits.MaxCallsPerTurn)
+					toolCallMessages = append(toolCallMessages, openai.ChatCompletionMessage{
+						Role:       openai.ChatMessageRoleTool,
+						ToolCallID: toolCall.ID,
+						Content:    fmt.Sprintf("error: %s can be called at most %d times per turn", toolName, limits.MaxCallsPerTurn),
+						Name:       toolName,
+					})
+					continue
+				}
+				// 本轮的工具预算用完后不再调用, 回复说明让大模型根据已有的结果回答
+				if limit := cc.toolBudget.exhausted(stats); limit != "" {
+					if !budgetExhausted {
+						budgetExhausted = true
+						toolBudgetExhausted.Inc(limit)
+						logf("mcp.budget_exhausted", logTag(ctx, sess.ID), limit, toolName)
+						status("tool_budget", "status.tool_budget")
+					}
+					toolCallMessages = append(toolCallMessages, openai.ChatCompletionMessage{
+						Role:       openai.ChatMessageRoleTool,
+						ToolCallID: toolCall.ID,
+						Content:    cc.toolBudget.message(limit),
+						Name:       toolName,
+					})
+					continue
+				}
+				// 需要批准的工具等用户决定后再调用, 没有批准时告诉大模型
+				if limits.RequireApproval {
+					outcome, err := cc.approvals.request(ctx, sess.ID, mcpClient.Name, toolName, mcpClient.visibleArguments(toolName, toolArgs), emit)
+					if err != nil {
+						break
+					}
+					toolApprovals.Inc(outcome)
+					logf("mcp.approval", logTag(ctx, sess.ID), toolName, outcome)
+					if outcome != approvalApproved {
+						toolCallMessages = append(toolCallMessages, openai.ChatCompletionMessage{
+							Role:       openai.ChatMessageRoleTool,
+							ToolCallID: toolCall.ID,
+							Content:    approvalMessage(toolName, outcome),
+							Name:       toolName,
+						})
+						continue
+					}
+				}
+				status("calling_tool", "status.calling_tool", toolName, i+1, len(message.ToolCalls))
+				callCtx, callCancel := mcpClient.WithToolTimeout(ctx, toolName)
+				callCtx, budgetCancel := cc.toolBudget.limit(callCtx, stats)
+				callCtx = withElicitTarget(callCtx, cc.elicitations, sess.ID, emit)
+				callStart := time.Now()
+				progress.tool = toolName
+				// 演示模式下不真正调用工具
+				var resp *mcp.CallToolResult
+				var err error
+				if demo, ok := cc.demo.toolResult(toolName); ok {
+					resp = demo
+				} else {
+					resp, err = mcpClient.CallTool(callCtx, req)
+				}
+				budgetCancel()
+				callCancel()
+				stats.addTool(toolName, time.Since(callStart), err)
+				cc.analytics.record(mcpClient.Name, toolName, identity.userID, userInput, time.Since(callStart), err)
+				timingsFrom(ctx).add("tool", toolName, callStart, err)
+				toolEvent := map[string]any{"server": mcpClient.Name, "tool": toolName, "duration_ms": time.Since(callStart).Milliseconds()}
+				if err != nil {
+					toolEvent["error"] = err.Error()
+				} else {
+					toolEvent["output_bytes"] = resultBytes(resp.Content)
+				}
+				cc.events.Publish(EventToolExecuted, sess.ID, traceData(ctx, toolEvent))
+				if ctx.Err() != nil {
+					// 本轮已超时或被取消, 不再调用剩下的工具
+					break
+				}
+				if err != nil {
+					logf("mcp.call_failed", logTag(ctx, sess.ID), mcpClient.Name, toolName, err)
+					toolCallMessages = append(toolCallMessages, openai.ChatCompletionMessage{
+						Role:       openai.ChatMessageRoleTool,
+						ToolCallID: toolCall.ID,
+						Content:    fmt.Sprintf("error: calling %s failed: %v", toolName, err),
+						Name:       toolName,
+					})
+					continue
+				}
+
+				// 构造 tool message
+				// 把工具返回的答案记录下来，作为后续模型推理的输入
+				toolCallMessages = append(toolCallMessages, openai.ChatCompletionMessage{
+					Role:       openai.ChatMessageRoleTool, // 说明是工具的响应
+					ToolCallID: toolCall.ID,                // 绑定之前模型说要调用的那个 tool_call.id
+					Content:    truncateOutput(cc.toolResultText(sess, toolName, mcpClient.TransformResult(toolName, resp.Content), limits.Ephemeral, emit), limits.MaxOutputBytes),
+					Name:       toolName, // 只记录在历史中, 方便按工具查询
+				})
+				toolOutputs = append(toolOutputs, ToolResult{Tool: toolName, Content: toolCallMessages[len(toolCallMessages)-1].Content})
+				if !limits.Ephemeral {
+					progress.results = append(progress.results, T(clientInfoFrom(ctx).locale, "chat.partial_result", toolName, toolCallMessages[len(toolCallMessages)-1].Content))
+				}
+			}
+
+			// 调用过程中被取消时, 部分工具没有结果, 不能写入历史
+			if err := ctx.Err(); err != nil {
+				return "", err
+			}
+			progress.tool = ""
+
+			// 配置了草稿时用汇总代替原始结果
+			if cc.scratchpad != nil {
+				status("condensing", "status.condensing")
+				cc.condenseResults(ctx, sess, stats, userInput, toolCallMessages, toolNameMap)
+			}
+
+			// 下面这个顺序模拟了人机对话流程
+			// 助理说：“我已经调用了这些工具（toolCalls）”
+			// 然后工具返回了结果（toolCallMessages）
+
+			// 添加 assistant tool call 信息
+			sess.Append(openai.ChatCompletionMessage{
+				Role:      openai.ChatMessageRoleAssistant,
+				Content:   "",
+				ToolCalls: message.ToolCalls,
+			})
+
+			// 添加 tool 响应, 临时工具的结果在历史中只保存占位文字
+			for _, msg := range toolCallMessages {
+				if toolNameMap[msg.Name].ephemeral(msg.Name) {
+					sess.AppendEphemeral(T(serverLocale, "prompt.ephemeral", msg.Name), msg)
+				} else {
+					sess.Append(msg)
+				}
+			}
+
+			// 再次发送给模型
+			// 把助理声明调用了哪些工具（toolCalls）和这些工具的返回结果（toolCallMessages）一起发送给模型，
+			// 让模型基于工具的响应继续生成下一步的回复
+			status("summarizing", "status.summarizing")
+			nextResponse, err := cc.completeTurn(ctx, sess.ID, stats, openai.ChatCompletionRequest{
+				Model:       settings.model,
+				Temperature: settings.temperature,
+				Messages:    cc.buildMessages(ctx, sess, settings),
+				N:           n,
+			})
+			if err != nil {
+				return "", err
+			}
+
+			for _, nextChoice := range nextResponse.Choices {
+				if nextChoice.Message.Content != "" {
+					progress.text = append(progress.text, nextChoice.Message.Content)
+				}
+			}
+		}
+	}
+
+	if n > 1 {
+		return cc.offerChoices(ctx, sess, stats, settings.model, progress.text, emit)
+	}
+
+	// 多个候选回答 (多个 choice 或工具循环的多段回答) 只保留一个, 避免重复内容
+	response = cc.assembleResponse(ctx, sess.ID, stats, settings.model, userInput, progress.text)
+	if cc.verification != nil && len(toolOutputs) > 0 {
+		status("verifying", "status.verifying")
+		response = cc.verifyAnswer(ctx, sess.ID, stats, settings.model, userInput, response, toolOutputs)
+	}
+	if language := sess.Language(); language != "" && cc.language != nil && cc.language.Translate {
+		status("translating", "status.translating")
+		response = cc.translate(ctx, sess.ID, stats, settings.model, response, language)
+	}
+	if max := sess.Preferences().MaxLength; max > 0 {
+		response = cc.enforceLength(ctx, sess.ID, stats, settings.model, response, max)
+	}
+	response = cc.leaks.mask(ctx, sess.ID, response)
+	response, err = cc.policy.Apply(policyOutput, response)
+	if err != nil {
+		return "", err
+	}
+	sess.Append(openai.ChatCompletionMessage{
+		Role:    openai.ChatMessageRoleAssistant,
+		Content: response,
+	})
+	// 有服务获取工具失败时回答可能不完整, 不缓存
+	if cacheable && len(catalog.failed) == 0 {
+		cc.cache.store(cacheScope, question, response)
+	}
+	return response, nil
+}
+
+// createChatCompletion 经过限流后调用大模型, 并记录耗时和用量
+func (cc *ChatClient) createChatCompletion(ctx context.Context, sessionID string, stats *turnStats, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	estimated := estimateTokens(req)
+	if err := cc.limiter.Wait(ctx, sessionID, estimated); err != nil {
+		return openai.ChatCompletionResponse{}, err
+	}
+	cc.demo.limitRequest(&req)
+	contextEchoFrom(ctx).echo(ctx, req)
+	start := time.Now()
+	resp, err := cc.provider.CreateChatCompletion(ctx, req)
+	stats.addLLM(req.Model, time.Since(start), resp.Usage)
+	timingsFrom(ctx).add("llm", req.Model, start, err)
+	if err == nil {
+		cc.limiter.Adjust(estimated, resp.Usage.TotalTokens)
+	}
+	return resp, err
+}
+
+// buildMessages 组装发给大模型的上下文: 系统消息 + 当前时间 + 回答语言 + 回答格式 + 参与者 + 用户记忆 + 附件 + 工具结果草稿 + 会话历史
+func (cc *ChatClient) buildMessages(ctx context.Context, sess *Session, settings turnSettings) []openai.ChatCompletionMessage {
+	var msgs []openai.ChatCompletionMessage
+	if settings.systemPrompt != "" {
+		msgs = append(msgs, openai.ChatCompletionMessage{Role: openai.ChatMessageRoleSystem, Content: settings.systemPrompt})
+	}
+	msgs = append(msgs, clockMessage(ctx))
+	if language := sess.Language(); language != "" {
+		msgs = append(msgs, languageMessage(language))
+	}
+	if m, ok := preferencesMessage(sess.Preferences()); ok {
+		msgs = append(msgs, m)
+	}
+	if m, ok := participantsMessage(sess); ok {
+		msgs = append(msgs, m)
+	}
+	if m, ok := cc.memoryMessage(sess); ok {
+		msgs = append(msgs, m)
+	}
+	if m, ok := cc.uploads.attachmentsMessage(sess.ID); ok {
+		msgs = append(msgs, m)
+	}
+	if m, ok := scratchpadMessage(sess); ok {
+		msgs = append(msgs, m)
+	}
+	return append(msgs, sess.Messages(cc.context)...)
+}
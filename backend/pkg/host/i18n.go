@@ -0,0 +1,717 @@
+package host
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const defaultLocale = "zh"
+
+// serverLocale 是日志和服务端错误使用的语言, 由配置中的 locale 决定
+var serverLocale = defaultLocale
+
+// catalog 按语言保存所有面向用户和日志的文本
+var catalog = map[string]map[string]string{
+	"zh": {
+		"config.syntax":                 "语法错误: %v",
+		"config.type_mismatch":          "类型错误, 期望 %s 实际为 %s",
+		"config.unknown_field":          "未知字段",
+		"config.required":               "缺少必填字段",
+		"config.duration_type":          `时长必须是字符串, 比如 "30s"`,
+		"config.duration_invalid":       "无效的时长 %q",
+		"config.duration_negative":      "时长不能为负数 %q",
+		"config.key_source":             "keyEnv, keyFile, keyCommand 必须且只能指定一个",
+		"config.stdio_command":          "stdio 类型必须指定 command",
+		"config.unsupported_field":      "%s 类型不支持 %s",
+		"config.url_required":           "%s 类型必须指定 url",
+		"config.url_invalid":            "无效的服务地址 %q",
+		"config.command_and_url":        "%s 类型不支持同时指定 command 和 url",
+		"config.unknown_type":           "未知服务类型 %q (可选 stdio, http, sse, builtin:<名称>)",
+		"config.unknown_builtin":        "未知的内置服务 %q (可选 %s)",
+		"config.unknown_locale":         "不支持的语言 %q (可选 %s)",
+		"config.deprecated_command":     "[%s] command 作为服务地址已废弃, 请改用 url 字段",
+		"config.duplicate_name":         "名称 %q 重复",
+		"config.history_backend":        "dir 和 redis 必须且只能指定一个",
+		"config.unknown_backend":        "未知后端 %q (可选 %s)",
+		"config.unknown_strategy":       "未知策略 %q (可选 %s)",
+		"config.unknown_dialect":        "未知 schema 方言 %q (可选 %s)",
+		"config.unknown_config_backend": "未知配置中心 %q (可选 %s)",
+		"config.unknown_inject_source":  "未知的注入来源 %q (可选 %s)",
+		"config.pool_size":              "连接池大小必须大于 0, 实际为 %d",
+		"config.compression_level":      "压缩级别必须在 1 到 9 之间, 实际为 %d",
+		"config.redis_url":              "无效的 Redis 地址: %v",
+		"config.negative":               "不能为负数: %v",
+		"config.latency_factor":         "必须大于 1: %v",
+		"config.temperature_range":      "temperature 必须在 0 到 2 之间, 实际为 %v",
+		"config.rate_range":             "比例必须在 0 到 1 之间, 实际为 %v",
+		"config.invalid_ip":             "不是有效的 IP 地址或 CIDR 网段: %q",
+		"config.unknown_role":           "未知角色 %q (可选 %s)",
+		"config.unknown_log_level":      "未知日志级别 %q (可选 %s)",
+		"config.auth_source":            "oidc 不能和 userHeader, roleHeader 同时使用",
+		"config.auth_header_untrusted":  "userHeader, roleHeader 需要同时配置 network.trustedProxies, 只有受信任的代理转来的请求才采信这些请求头",
+		"config.search_encrypted":       "search 的全文索引以明文保存消息, 不能和 history.encryption 同时使用",
+		"config.transform_source":       "jq 和 template 必须且只能指定一个",
+		"config.transform_invalid":      "无效的结果转换: %v",
+		"config.workflow_invalid":       "无效的工作流: %v",
+		"config.env_missing":            "环境变量 %s 未设置",
+		"config.secret_ref":             "密钥引用必须是字符串",
+		"config.secret_failed":          "读取密钥失败: %s",
+		"config.overlay_applied":        "已叠加环境配置 %s",
+		"config.overlay_missing":        "%s=%s 对应的环境配置 %s 不存在, 只使用基础配置",
+		"chaos.enabled":                 "故障注入已开启 (工具失败 %v, 慢工具 %v, 丢弃消息 %v, 断开连接 %v), 只应在测试环境使用",
+		"demo.enabled":                  "演示模式已开启: 工具不会真正执行, 每个用户每天最多 %d 个 token, 每次回答最多 %d 个 token",
+		"chaos.ignored":                 "%s=prod, 忽略 chaos 配置",
+
+		"mcp.create_failed":        "[%s] 创建客户端失败: %v",
+		"mcp.initializing":         "[%s] 正在初始化客户端...",
+		"mcp.init_failed":          "[%s] 初始化失败: %v",
+		"mcp.connected":            "[%s] 已连接服务: %s %s",
+		"mcp.unknown_type":         "未知服务类型: %s (%s)",
+		"mcp.list_tools_failed":    "[%s] 获取工具列表失败: %v",
+		"mcp.empty_tools_response": "服务返回了空的工具列表响应",
+		"mcp.duplicate_tool":       "工具 %s 同时由 %s 和 %s 提供, 只使用前者",
+		"mcp.invalid_tool_name":    "[%s] 工具名 %q 不符合大模型接口的要求 (字母、数字、下划线和连字符, 最长 64 个字符), 已跳过",
+		"mcp.tools_changed":        "服务 %s 的工具列表已变化, 下一轮重新获取",
+		"mcp.duplicate_server":     "进程内服务 %s 与配置中的服务重名, 已忽略",
+		"mcp.in_process":           "[%s] 已通过进程内传输连接",
+		"mcp.call_failed":          "[%s] 工具 %s/%s 调用失败: %v",
+		"mcp.stdio_signal_failed":  "向 MCP 服务 %s 的进程组发送终止信号失败: %v",
+		"mcp.stdio_killed":         "MCP 服务 %s 在 %s 内没有退出, 已强制结束",
+		"mcp.unknown_tool":         "[%s] 大模型请求了不可用的工具 %s",
+		"mcp.call_limit":           "[%s] 工具 %s 本轮调用次数超过上限 %d",
+		"mcp.budget_exhausted":     "[%s] 本轮的工具预算 (%s) 已用完, 不再调用 %s",
+		"mcp.approval":             "[%s] 工具 %s 的批准结果: %s",
+		"mcp.approval_unknown":     "[%s] 没有等待批准的工具调用 %q, 可能已超时或已处理",
+		"mcp.elicitation":          "[%s] MCP 服务 %s 请求用户输入",
+		"mcp.elicitation_unrouted": "MCP 服务 %s 的 elicitation 请求无法确定所属会话, 已拒绝",
+		"mcp.elicitation_rejected": "[%s] elicitation 回复 %q 无效: %v",
+		"mcp.transform_failed":     "[%s] 工具 %s 的结果转换失败, 使用原结果: %v",
+		"workflow.failed":          "工作流 %s 执行失败: %v",
+		"mcp.pool_failed":          "[%s] 连接池第 %d 个连接创建失败: %v",
+		"mcp.pool_ready":           "[%s] 连接池已就绪, 共 %d 个连接",
+		"mcp.pool_unhealthy":       "[%s] 连接 %d 健康检查失败, 暂停使用: %v",
+		"mcp.pool_recovered":       "[%s] 连接 %d 已恢复",
+		"mcp.health_down":          "[%s] 健康检查失败: %s",
+		"mcp.latency_degraded":     "[%s] 延迟变慢: 最近 ping %.1fms, 基线 %.1fms",
+		"mcp.latency_recovered":    "[%s] 延迟已恢复: 最近 ping %.1fms",
+		"mcp.health_up":            "[%s] 健康检查已恢复",
+
+		"policy.bad_pattern":   "无效的正则表达式 %q",
+		"policy.bad_action":    "未知动作 %q (可选 block, mask, log)",
+		"policy.bad_direction": "未知方向 %q (可选 input, output)",
+		"policy.matched":       "内容策略 %s 命中 %s, 动作 %s",
+		"policy.blocked":       "内容被策略 %s 拦截",
+
+		"events.connect_failed":   "连接事件总线 %s 失败: %v",
+		"events.forward_failed":   "转发事件到 %s 失败 (%s): %v",
+		"secrets.env_unset":       "环境变量 %s 未设置",
+		"secrets.vault_ref":       "无效的 Vault 引用 %q, 格式为 <path>#<key>",
+		"secrets.vault_key":       "Vault 中 %[2]s 没有 %[1]s",
+		"secrets.vault_env":       "读取 Vault 需要设置 VAULT_ADDR 和 VAULT_TOKEN",
+		"secrets.vault_status":    "读取 Vault %s 失败: %s",
+		"dashboard.render_failed": "渲染运行状态页面失败: %v",
+
+		"proxy.invalid": "无效的代理地址 %q (支持 http, https, socks5 或 direct)",
+
+		"search.init_failed":           "初始化搜索索引失败 (需要以 -tags sqlite_fts5 编译): %v",
+		"search.index_failed":          "[%s] 写入搜索索引失败: %v",
+		"search.query_failed":          "搜索 %q 失败: %v",
+		"memory.load_failed":           "读取用户记忆失败: %v",
+		"memory.save_failed":           "保存用户记忆失败: %v",
+		"checkpoint.unsupported_store": "会话历史存储不支持删除消息, 不能回滚",
+		"checkpoint.rollback_failed":   "会话 %s 回滚到检查点 %s 失败: %v",
+		"checkpoint.rolled_back":       "会话 %s 已回滚到检查点 %s, 删除 %d 条消息",
+		"prompts.load_failed":          "读取提示词模板失败: %v",
+		"prompts.save_failed":          "保存提示词模板失败: %v",
+		"memory.prompt":                "以下是用户让你记住的信息, 回答时请参考:",
+		"clock.prompt":                 "当前时间是 %s, 用户所在时区为 %s, 用户语言为 %s。回答涉及日期和时间的问题时以此为准。",
+		"clock.bad_timezone":           "无效的时区 %q, 使用服务端时区: %v",
+		"language.directive":           "无论用户提问或工具结果使用什么语言, 始终使用 %s 回答。",
+		"language.translate":           "把用户发来的内容翻译成 %s, 已经是该语言的部分保持不变, 保留格式, 只输出翻译结果。",
+		"language.translate_failed":    "[%s] 翻译回答失败, 使用原文: %v",
+		"preferences.bullets":          "用要点列表的形式回答。",
+		"preferences.prose":            "用连贯的段落回答, 不要使用列表。",
+		"preferences.code":             "只输出代码块, 不要任何解释。",
+		"preferences.max_length":       "回答不超过 %d 个字符。",
+		"preferences.shorten":          "把用户发来的回答缩短到不超过 %d 个字符, 保留要点和原有格式, 使用原来的语言, 只输出缩短后的回答。",
+		"preferences.truncated":        "[%s] 回答超过 %d 个字符, 缩短失败, 已截断: %v",
+		"response.rerank":              "下面是同一个问题的 %d 个候选回答, 请选出最准确、最完整的一个, 只回复它的编号, 不要输出其他内容",
+		"response.rerank_failed":       "[%s] 挑选候选回答失败, 使用第一个: %v",
+		"llm.malformed_response":       "[%s] 大模型返回了不可用的结果 (%s), 第 %d 次",
+		"llm.malformed_failed":         "大模型连续 %d 次返回不可用的结果: %s",
+		"scratchpad.failed":            "[%s] 汇总工具结果失败, 使用原始结果: %v",
+		"verification.prompt":          "你负责核对回答。下面依次是用户的问题、本轮工具返回的原始结果 (以工具名标注) 和准备发给用户的回答。检查回答是否和工具结果矛盾或编造了工具结果中没有的数据, 只回复一个 JSON 对象: {\"verdict\": \"ok | fixed | low_confidence\", \"answer\": \"改正后的完整回答\", \"note\": \"一句话说明问题\"}。没有问题时 verdict 为 ok; 有矛盾并且可以根据工具结果改正时为 fixed, answer 为改正后的回答, 保持原来的语言和格式; 无法确定时为 low_confidence。note 使用回答的语言",
+		"verification.failed":          "[%s] 核对回答失败, 使用原来的回答: %v",
+		"verification.fixed":           "[%s] 回答和工具结果矛盾, 已改正: %s",
+		"leakguard.masked":             "[%s] 回答中有 %d 处疑似泄露的内部配置, 已替换",
+		"scratchpad.empty":             "大模型返回了空的汇总",
+		"digest.failed":                "[%s] 生成会话摘要失败: %v",
+		"digest.save_failed":           "[%s] 保存会话摘要失败: %v",
+		"digest.load_failed":           "读取会话摘要失败: %v",
+		"digest.finished":              "已生成 %d 个会话摘要 (%s 至 %s)",
+		"digest.empty":                 "大模型返回了空的摘要",
+		"analytics.export_failed":      "导出工具调用统计失败: %v",
+		"analytics.exported":           "已导出工具调用统计 %s (%d 个工具)",
+		"resources.list_failed":        "获取 MCP 服务 %s 的资源模板失败: %v",
+
+		"oidc.discovery_failed":   "获取 OIDC 配置失败 (%s): %v",
+		"oidc.secret_missing":     "未设置环境变量 %s (OIDC client secret)",
+		"oidc.exchange_failed":    "OIDC 授权码换取 token 失败: %v",
+		"oidc.verify_failed":      "OIDC ID token 校验失败: %v",
+		"oidc.user_claim_missing": "ID token 中没有用户标识 claim %q",
+		"oidc.logged_in":          "用户 %s 已登录",
+
+		"history.save_failed":   "[%s] 保存历史消息失败: %v",
+		"purge.failed":          "清除用户 %s 的数据失败: %v",
+		"purge.done":            "已清除用户 %s 的数据 (操作者 %s, %d 个会话, %d 个他人会话中的 %d 条消息)",
+		"purge.scheduled":       "已软删除用户 %s 的数据 (操作者 %s), %s 后彻底清除",
+		"purge.restored":        "已恢复软删除的用户 %s 的数据 (操作者 %s)",
+		"purge.expired":         "软删除的保留期已过, 已彻底清除用户 %s 的数据 (%d 个会话, %d 个他人会话中的 %d 条消息)",
+		"purge.load_failed":     "读取软删除记录 %s 失败: %v",
+		"history.load_failed":   "[%s] 读取历史消息失败: %v",
+		"history.key_failed":    "读取历史加密密钥失败: %v",
+		"history.redis_failed":  "连接 Redis %s 失败: %v",
+		"history.unlock_failed": "[%s] 释放会话锁失败: %v",
+
+		"cipher.key_size":       "加密密钥必须是 32 字节 (AES-256), 实际为 %d 字节",
+		"cipher.env_unset":      "环境变量 %s 未设置",
+		"cipher.key_command":    "执行 keyCommand 失败: %v: %s",
+		"cipher.no_source":      "未配置密钥来源",
+		"cipher.bad_base64":     "密钥不是合法的 base64: %v",
+		"cipher.bad_ciphertext": "密文长度不正确",
+		"cipher.decrypt_failed": "解密失败, 请检查密钥是否正确",
+
+		"server.env_missing":               "检查环境变量设置: OPENAI_API_KEY, OPENAI_API_BASE, OPENAI_API_MODEL",
+		"server.started":                   "服务已启动, 监听 %s",
+		"server.stopping":                  "收到退出信号, 正在关闭服务",
+		"startup.llm_ok":                   "自检: 大模型 %s 可用, 耗时 %v",
+		"startup.llm_failed":               "自检: 大模型 %s 不可用: %v",
+		"startup.server_ok":                "自检: MCP 服务 %s 可用, %d 个工具, 耗时 %v",
+		"startup.server_failed":            "自检: MCP 服务 %s 获取工具失败: %v",
+		"startup.report":                   "自检完成: MCP 服务 %d/%d 可用, 共 %d 个工具",
+		"startup.provider_misconfigured":   "大模型接口配置错误, 检查 OPENAI_API_KEY, OPENAI_API_BASE, OPENAI_API_MODEL (模型 %s): %v",
+		"startup.servers_required":         "%d 个 MCP 服务连接失败, 配置了 startup.requireServers, 不启动",
+		"startup.llm_only":                 "没有可用的 MCP 服务, 只和大模型对话 (没有工具)",
+		"configsource.status":              "配置中心 %s 返回 %s",
+		"configsource.read_failed":         "读取配置中心 %s 失败: %v",
+		"configsource.startup_failed":      "%v, 先使用配置文件中的服务",
+		"configsource.watch_failed":        "监听配置中心 %s 失败, 稍后重试: %v",
+		"configsource.invalid":             "配置中心 %s 的配置无效, 保持当前的服务不变: %v",
+		"configsource.server_failed":       "按新配置连接 %s 失败: %v",
+		"configsource.applied":             "已应用配置中心 %s 的配置: 新增 %d 个, 重新连接 %d 个, 移除 %d 个服务, 当前共 %d 个",
+		"cache.env_missing":                "配置了 cache 但无法连接 embedding 接口: 请设置 OPENAI_EMBEDDING_API_KEY 和 OPENAI_EMBEDDING_API_BASE (或 OPENAI_API_KEY 和 OPENAI_API_BASE)",
+		"cache.empty_embedding":            "embedding 接口返回了空向量",
+		"cache.embed_failed":               "[%s] 计算问题向量失败, 本轮不使用缓存: %v",
+		"config.missing":                   "配置文件 %s 不存在, 不连接 MCP 服务",
+		"server.listen_failed":             "服务启动失败: %v",
+		"cli.config_ok":                    "配置文件 %s 检查通过",
+		"cli.empty_query":                  "问题不能为空",
+		"cli.turn_failed":                  "%v (trace id: %s)",
+		"cli.servers_failed":               "%d 个 MCP 服务连接或获取工具失败",
+		"ws.upgrade_failed":                "WebSocket 升级失败: %v",
+		"server.panic":                     "[%s] 已恢复的 panic (会话 %s): %v\n%s",
+		"ws.read_failed":                   "[%s] WebSocket 读取失败: %v",
+		"ws.write_failed":                  "[%s] WebSocket 发送失败: %v",
+		"ws.unmarshal_failed":              "[%s] 消息解析失败: %v",
+		"ws.spectator_joined":              "[%s] 旁观者已连接 (用户 %q)",
+		"ws.rejected":                      "拒绝来自 %s 的连接: %s",
+		"ws.ip_denied":                     "来源地址 %s 不允许连接",
+		"api.ip_denied":                    "来源地址 %s 不允许访问 %s",
+		"session.participant_added":        "[%s] 已邀请参与者 %q",
+		"session.resume_issued":            "[%s] 已签发转移令牌, 有效期至 %s",
+		"chat.request_failed":              "[%s] 请求失败: %v",
+		"chat.transcribe_failed":           "[%s] 语音识别失败: %v",
+		"chat.cancelled":                   "[%s] 客户端已断开, 停止处理",
+		"chat.turn_timeout":                "[%s] 本轮对话超时 (%s), 返回已经得到的内容",
+		"error.request_failed":             "请求失败, 请稍后重试",
+		"error.transcribe_failed":          "语音识别失败, 请重试",
+		"error.invalid_choice":             "候选回答已失效, 请重新提问",
+		"error.invalid_elicitation":        "回复无效: %v, 请修改后重新提交",
+		"error.policy_blocked":             "消息包含不允许的内容, 已被拦截",
+		"error.forbidden":                  "当前账号没有对话权限",
+		"error.budget_exceeded":            "今日 token 用量已达上限, 请明天再试",
+		"error.spectator_read_only":        "旁观连接是只读的, 不能发送消息",
+		"ws.rejected_server_full":          "服务器连接数已满, 请稍后再试",
+		"ws.rejected_user_limit":           "当前账号打开的连接过多, 请关闭其他页面后再试",
+		"ws.rejected_ip_limit":             "来自当前网络的连接过多, 请稍后再试",
+		"ws.rejected_unsupported_protocol": "客户端的协议版本过旧, 请刷新页面或升级客户端",
+		"status.thinking":                  "正在分析问题",
+		"status.calling_tool":              "正在调用工具 %s (%d/%d)",
+		"status.summarizing":               "正在整理回答",
+		"status.condensing":                "正在汇总工具结果",
+		"status.translating":               "正在翻译回答",
+		"status.cached":                    "使用最近相似问题的回答",
+		"status.verifying":                 "正在核对回答",
+		"status.tool_budget":               "本轮的工具调用预算已用完, 根据已有的结果回答",
+		"approval.request":                 "大模型请求调用 %s, 请确认参数后批准或拒绝",
+		"elicitation.request":              "%s 需要你提供以下信息才能继续",
+		"warning.tools_unavailable":        "工具服务 %s 暂时不可用, 本次回答无法使用它的工具",
+		"warning.llm_only":                 "当前没有可用的工具, 回答只来自大模型, 无法查询实时信息或执行操作",
+		"warning.session_not_found":        "要恢复的会话不存在或已过期, 已开始新的会话, 之前的对话内容不在其中",
+
+		"api.session_not_found":        "会话不存在",
+		"api.artifact_not_found":       "附件不存在",
+		"api.method_not_allowed":       "不支持的请求方法",
+		"api.not_pinnable":             "只能固定用户消息和助理的文字回答 (序号 %d)",
+		"api.session_anonymous":        "匿名会话不能邀请参与者",
+		"api.bad_participant":          "无效的参与者: %q",
+		"api.bad_request":              "请求无效: %v",
+		"api.missing_session_id":       "缺少 session_id",
+		"api.missing_query":            "缺少查询参数 q",
+		"api.search_disabled":          "未启用搜索",
+		"api.memory_disabled":          "未启用记忆",
+		"api.memory_not_found":         "记忆不存在",
+		"api.prompts_disabled":         "未启用提示词模板",
+		"api.digest_disabled":          "未启用会话摘要",
+		"api.soft_delete_disabled":     "未启用软删除",
+		"api.purge_not_pending":        "该用户没有等待清除的数据",
+		"api.analytics_disabled":       "未启用工具调用统计",
+		"api.server_not_found":         "MCP 服务 %q 不存在",
+		"api.bad_ref_type":             "无效的引用类型 %q (可选 ref/resource, ref/prompt)",
+		"api.complete_failed":          "补全失败: %v",
+		"api.prompt_not_found":         "提示词模板 %q 不存在",
+		"api.prompt_invalid_name":      "模板名只能包含字母、数字、下划线和连字符, 最多 64 个字符",
+		"api.prompt_empty":             "模板内容不能为空",
+		"api.prompt_missing_variables": "缺少模板变量: %s",
+		"api.checkpoint_invalid_name":  "检查点名只能包含字母、数字、下划线和连字符, 最多 64 个字符",
+		"api.checkpoint_not_found":     "检查点 %q 不存在",
+		"api.approval_not_found":       "没有等待批准的工具调用, 可能已超时或已处理",
+		"api.elicitation_not_found":    "没有等待回复的请求, 可能已超时或已处理",
+		"api.forbidden":                "没有权限",
+		"api.ip_forbidden":             "来源地址不允许访问",
+		"api.internal_error":           "服务内部错误",
+		"api.login_failed":             "登录失败, 请重试",
+		"api.session_id_order":         "session_id 必须放在文件之前",
+		"api.upload_failed":            "上传失败: %v",
+		"api.transcribe_failed":        "语音识别失败: %v",
+		"upload.too_large":             "文件超过大小限制 %d 字节",
+		"upload.save_failed":           "保存会话 %s 上传的文件失败: %v",
+		"audio.empty":                  "语音内容为空",
+		"audio.too_large":              "语音超过大小限制",
+
+		"prompt.attachments":      "用户上传了以下文件, 需要时可以把 URI (或去掉 file:// 前缀的路径) 传给工具读取:",
+		"prompt.attachment_item":  "- %s (%s, %d 字节): %s",
+		"prompt.truncated":        "...[内容过长已截断, 完整内容已作为附件 %s (%d 字节) 提供给用户]",
+		"prompt.no_artifacts":     "[%s 类型的内容, 未启用附件存储]",
+		"prompt.decode_failed":    "[无法解码的 %s 内容: %v]",
+		"prompt.save_failed":      "[保存附件失败: %v]",
+		"prompt.artifact_saved":   "[已生成附件 %s (%s, %d 字节) 并提供给用户下载]",
+		"prompt.ephemeral":        "[工具 %s 的结果只在当轮对话中使用, 已移除]",
+		"prompt.ephemeral_binary": "[%s 类型的内容, 临时工具的结果不保存]",
+		"prompt.participants":     "这是多人参与的对话, 参与者: %s。用户消息的 name 是发送者, 回答时注意区分是谁提出的问题, 需要时称呼对方的名字",
+		"prompt.strict_format":    "上一次回复的格式不正确。请直接用文字回答, 或者调用提供的工具, 工具参数必须是完整、有效的 JSON 对象",
+		"chat.partial_model":      "[回答不完整: 等待大模型回复时超过了本轮 %s 的时间限制]",
+		"chat.partial_tool":       "[回答不完整: 调用工具 %s 时超过了本轮 %s 的时间限制]",
+		"chat.partial_result":     "工具 %s 的结果:\n%s",
+		"prompt.scratchpad":       "之前的工具结果已汇总为下面的草稿, 回答时以它为准:\n%s",
+		"prompt.scratchpad_ref":   "[工具 %s 的结果已汇总到草稿中]",
+		"tools.hint":              "(近期实测: 耗时约 %s, 结果约 %d tokens)",
+		"tools.hint_failures":     "(近期实测: 耗时约 %s, 结果约 %d tokens, 失败率 %d%%)",
+		"scratchpad.prompt":       "你负责维护一份工具结果的草稿。根据用户的问题, 把新的工具结果合并进已有的草稿 (scratchpad), 保留回答问题需要的事实、数字、名称和标识, 去掉重复和无关的内容。只输出更新后的草稿, 不要回答问题",
+		"digest.prompt":           "下面是一个会话在一段时间内的对话记录, 包括工具调用的结果。请写一份简洁的摘要: 讨论了哪些问题、执行了哪些操作及其结果、得出的结论, 以及尚未解决的问题和后续事项。保留关键的数字、名称和标识, 只输出摘要",
+	},
+	"en": {
+		"config.syntax":                 "syntax error: %v",
+		"config.type_mismatch":          "type mismatch: expected %s, got %s",
+		"config.unknown_field":          "unknown field",
+		"config.required":               "missing required field",
+		"config.duration_type":          `duration must be a string such as "30s"`,
+		"config.duration_invalid":       "invalid duration %q",
+		"config.duration_negative":      "duration must not be negative: %q",
+		"config.key_source":             "exactly one of keyEnv, keyFile and keyCommand must be set",
+		"config.stdio_command":          "stdio servers require command",
+		"config.unsupported_field":      "%s servers do not support %s",
+		"config.url_required":           "%s servers require url",
+		"config.url_invalid":            "invalid server url %q",
+		"config.command_and_url":        "%s servers cannot set both command and url",
+		"config.unknown_type":           "unknown server type %q (expected stdio, http, sse or builtin:<name>)",
+		"config.unknown_builtin":        "unknown builtin server %q (expected one of %s)",
+		"config.unknown_locale":         "unsupported locale %q (expected %s)",
+		"config.deprecated_command":     "[%s] using command as the server url is deprecated, use url instead",
+		"config.duplicate_name":         "duplicate name %q",
+		"config.history_backend":        "exactly one of dir and redis must be set",
+		"config.unknown_backend":        "unknown backend %q (expected %s)",
+		"config.unknown_strategy":       "unknown strategy %q (expected %s)",
+		"config.unknown_dialect":        "unknown schema dialect %q (expected %s)",
+		"config.unknown_config_backend": "unknown config backend %q (expected %s)",
+		"config.unknown_inject_source":  "unknown inject source %q (expected %s)",
+		"config.pool_size":              "pool size must be greater than 0, got %d",
+		"config.compression_level":      "compression level must be between 1 and 9, got %d",
+		"config.redis_url":              "invalid redis url: %v",
+		"config.negative":               "must not be negative: %v",
+		"config.latency_factor":         "must be greater than 1: %v",
+		"config.temperature_range":      "temperature must be between 0 and 2, got %v",
+		"config.rate_range":             "rate must be between 0 and 1, got %v",
+		"config.invalid_ip":             "not a valid IP address or CIDR: %q",
+		"config.unknown_role":           "unknown role %q (expected %s)",
+		"config.unknown_log_level":      "unknown log level %q (expected %s)",
+		"config.auth_source":            "oidc cannot be combined with userHeader or roleHeader",
+		"config.auth_header_untrusted":  "userHeader and roleHeader require network.trustedProxies; the headers are only honoured on requests forwarded by a trusted proxy",
+		"config.search_encrypted":       "search stores messages in a plaintext full-text index and cannot be combined with history.encryption",
+		"config.transform_source":       "exactly one of jq and template must be set",
+		"config.transform_invalid":      "invalid result transform: %v",
+		"config.workflow_invalid":       "invalid workflow: %v",
+		"config.env_missing":            "environment variable %s is not set",
+		"config.secret_ref":             "secret reference must be a string",
+		"config.secret_failed":          "failed to resolve secret: %s",
+		"config.overlay_applied":        "applied environment config %s",
+		"config.overlay_missing":        "%s=%s but environment config %s does not exist, using the base config only",
+		"chaos.enabled":                 "fault injection enabled (tool failures %v, slow tools %v, dropped frames %v, disconnects %v); use in test environments only",
+		"demo.enabled":                  "demo mode enabled: tools are not executed, at most %d tokens per user per day and %d tokens per completion",
+		"chaos.ignored":                 "%s=prod, ignoring the chaos config",
+
+		"mcp.create_failed":        "[%s] failed to create client: %v",
+		"mcp.initializing":         "[%s] initializing client...",
+		"mcp.init_failed":          "[%s] initialize failed: %v",
+		"mcp.connected":            "[%s] connected to server: %s %s",
+		"mcp.unknown_type":         "unknown server type: %s (%s)",
+		"mcp.list_tools_failed":    "[%s] failed to list tools: %v",
+		"mcp.empty_tools_response": "the server returned an empty tools/list response",
+		"mcp.duplicate_tool":       "tool %s is provided by both %s and %s, using the former",
+		"mcp.invalid_tool_name":    "[%s] skipping tool %q: the name must be letters, digits, underscores and hyphens, at most 64 characters",
+		"mcp.tools_changed":        "tool list of %s changed, refetching on the next turn",
+		"mcp.duplicate_server":     "in-process server %s has the same name as a configured server, ignored",
+		"mcp.in_process":           "[%s] connected through the in-process transport",
+		"mcp.call_failed":          "[%s] tool %s/%s failed: %v",
+		"mcp.stdio_signal_failed":  "failed to signal the process group of MCP server %s: %v",
+		"mcp.stdio_killed":         "MCP server %s did not exit within %s, killed",
+		"mcp.unknown_tool":         "[%s] the model requested unavailable tool %s",
+		"mcp.call_limit":           "[%s] tool %s exceeded %d calls in this turn",
+		"mcp.budget_exhausted":     "[%s] tool budget (%s) of this turn exhausted, not calling %s",
+		"mcp.approval":             "[%s] approval of tool %s: %s",
+		"mcp.approval_unknown":     "[%s] no pending tool call %q to approve, it may have timed out or been decided",
+		"mcp.elicitation":          "[%s] MCP server %s requested user input",
+		"mcp.elicitation_unrouted": "rejected an elicitation request from MCP server %s: cannot tell which session it belongs to",
+		"mcp.elicitation_rejected": "[%s] invalid elicitation reply %q: %v",
+		"mcp.transform_failed":     "[%s] failed to transform result of tool %s, using the original: %v",
+		"workflow.failed":          "workflow %s failed: %v",
+		"mcp.pool_failed":          "[%s] failed to create pooled connection %d: %v",
+		"mcp.pool_ready":           "[%s] connection pool ready with %d connections",
+		"mcp.pool_unhealthy":       "[%s] connection %d failed health check, taking it out of rotation: %v",
+		"mcp.pool_recovered":       "[%s] connection %d recovered",
+		"mcp.health_down":          "[%s] health check failed: %s",
+		"mcp.latency_degraded":     "[%s] latency degraded: recent ping %.1fms, baseline %.1fms",
+		"mcp.latency_recovered":    "[%s] latency recovered: recent ping %.1fms",
+		"mcp.health_up":            "[%s] health check recovered",
+
+		"policy.bad_pattern":   "invalid regular expression %q",
+		"policy.bad_action":    "unknown action %q (expected block, mask or log)",
+		"policy.bad_direction": "unknown direction %q (expected input or output)",
+		"policy.matched":       "content policy %s matched %s, action %s",
+		"policy.blocked":       "content blocked by policy %s",
+
+		"events.connect_failed":   "failed to connect to event bus %s: %v",
+		"events.forward_failed":   "failed to forward event to %s (%s): %v",
+		"secrets.env_unset":       "environment variable %s is not set",
+		"secrets.vault_ref":       "invalid vault reference %q, expected <path>#<key>",
+		"secrets.vault_key":       "key %s not found in vault %s",
+		"secrets.vault_env":       "VAULT_ADDR and VAULT_TOKEN are required to read from vault",
+		"secrets.vault_status":    "failed to read vault %s: %s",
+		"dashboard.render_failed": "failed to render dashboard: %v",
+
+		"proxy.invalid": "invalid proxy %q (expected http, https, socks5 or direct)",
+
+		"search.init_failed":           "failed to initialize search index (build with -tags sqlite_fts5): %v",
+		"search.index_failed":          "[%s] failed to index messages: %v",
+		"search.query_failed":          "search %q failed: %v",
+		"memory.load_failed":           "failed to load user memories: %v",
+		"memory.save_failed":           "failed to save user memories: %v",
+		"checkpoint.unsupported_store": "the history store cannot remove messages, rollback is not supported",
+		"checkpoint.rollback_failed":   "failed to roll back session %s to checkpoint %s: %v",
+		"checkpoint.rolled_back":       "rolled back session %s to checkpoint %s, removed %d messages",
+		"prompts.load_failed":          "failed to load prompt templates: %v",
+		"prompts.save_failed":          "failed to save prompt templates: %v",
+		"memory.prompt":                "The user asked you to remember the following, take it into account when answering:",
+		"clock.prompt":                 "The current time is %s, the user's timezone is %s and their language is %s. Use this when answering questions about dates and times.",
+		"clock.bad_timezone":           "invalid timezone %q, using the server timezone: %v",
+		"language.directive":           "Always answer in %s, regardless of the language used by the user or by tool results.",
+		"language.translate":           "Translate the user's text into %s. Keep parts already in that language unchanged, preserve formatting and output only the translation.",
+		"language.translate_failed":    "[%s] failed to translate the answer, using the original: %v",
+		"preferences.bullets":          "Answer as a bulleted list.",
+		"preferences.prose":            "Answer in flowing prose, without lists.",
+		"preferences.code":             "Output only code blocks, with no explanation.",
+		"preferences.max_length":       "Keep the answer within %d characters.",
+		"preferences.shorten":          "Shorten the user's answer to at most %d characters, keeping the key points, the original format and language. Output only the shortened answer.",
+		"preferences.truncated":        "[%s] answer exceeded %d characters and could not be shortened, truncated: %v",
+		"response.rerank":              "Below are %d candidate answers to the same question. Pick the most accurate and complete one and reply with its number only, nothing else",
+		"response.rerank_failed":       "[%s] failed to rerank candidate answers, using the first: %v",
+		"llm.malformed_response":       "[%s] the model returned an unusable response (%s), attempt %d",
+		"llm.malformed_failed":         "the model returned an unusable response %d times in a row: %s",
+		"scratchpad.failed":            "[%s] failed to condense tool results, using the raw results: %v",
+		"verification.prompt":          "You verify answers. Below are the user's question, the raw tool results from this turn (labelled with the tool name) and the answer about to be sent. Check whether the answer contradicts the tool results or invents data not found in them, and reply with a single JSON object only: {\"verdict\": \"ok | fixed | low_confidence\", \"answer\": \"the full corrected answer\", \"note\": \"one sentence describing the problem\"}. Use ok when there is no problem; fixed when there is a contradiction you can correct from the tool results, with answer set to the corrected answer in the original language and format; low_confidence when you cannot tell. Write note in the language of the answer",
+		"verification.failed":          "[%s] failed to verify the answer, keeping it unchanged: %v",
+		"verification.fixed":           "[%s] answer contradicted tool results and was corrected: %s",
+		"leakguard.masked":             "[%s] masked %d apparent leaks of internal configuration in the answer",
+		"scratchpad.empty":             "the model returned an empty summary",
+		"digest.failed":                "[%s] failed to create session digest: %v",
+		"digest.save_failed":           "[%s] failed to save session digest: %v",
+		"digest.load_failed":           "failed to load session digests: %v",
+		"digest.finished":              "created %d session digests (%s to %s)",
+		"digest.empty":                 "the model returned an empty digest",
+		"analytics.export_failed":      "failed to export tool analytics: %v",
+		"analytics.exported":           "exported tool analytics to %s (%d tools)",
+		"resources.list_failed":        "failed to list resource templates of MCP server %s: %v",
+
+		"oidc.discovery_failed":   "failed to fetch OIDC configuration (%s): %v",
+		"oidc.secret_missing":     "environment variable %s (OIDC client secret) is not set",
+		"oidc.exchange_failed":    "failed to exchange OIDC authorization code: %v",
+		"oidc.verify_failed":      "failed to verify OIDC ID token: %v",
+		"oidc.user_claim_missing": "ID token has no user claim %q",
+		"oidc.logged_in":          "user %s logged in",
+
+		"history.save_failed":   "[%s] failed to save history: %v",
+		"purge.failed":          "failed to purge data of user %s: %v",
+		"purge.done":            "purged data of user %s (by %s, %d sessions, %d shared sessions with %d messages redacted)",
+		"purge.scheduled":       "soft-deleted data of user %s (by %s), to be purged after %s",
+		"purge.restored":        "restored soft-deleted data of user %s (by %s)",
+		"purge.expired":         "retention of soft-deleted user %s expired, data purged (%d sessions, %d shared sessions with %d messages redacted)",
+		"purge.load_failed":     "failed to read soft delete records %s: %v",
+		"history.load_failed":   "[%s] failed to load history: %v",
+		"history.key_failed":    "failed to load history encryption key: %v",
+		"history.redis_failed":  "failed to connect to redis %s: %v",
+		"history.unlock_failed": "[%s] failed to release session lock: %v",
+
+		"cipher.key_size":       "encryption key must be 32 bytes (AES-256), got %d bytes",
+		"cipher.env_unset":      "environment variable %s is not set",
+		"cipher.key_command":    "keyCommand failed: %v: %s",
+		"cipher.no_source":      "no key source configured",
+		"cipher.bad_base64":     "key is not valid base64: %v",
+		"cipher.bad_ciphertext": "ciphertext has invalid length",
+		"cipher.decrypt_failed": "decryption failed, check that the key is correct",
+
+		"server.env_missing":               "check environment variables: OPENAI_API_KEY, OPENAI_API_BASE, OPENAI_API_MODEL",
+		"server.started":                   "server started on %s",
+		"server.stopping":                  "received shutdown signal, stopping server",
+		"startup.llm_ok":                   "self-test: model %s is reachable (%v)",
+		"startup.llm_failed":               "self-test: model %s is not available: %v",
+		"startup.server_ok":                "self-test: MCP server %s is available with %d tools (%v)",
+		"startup.server_failed":            "self-test: failed to list tools of MCP server %s: %v",
+		"startup.report":                   "self-test finished: %d/%d MCP servers available, %d tools in total",
+		"startup.provider_misconfigured":   "the model provider is misconfigured, check OPENAI_API_KEY, OPENAI_API_BASE and OPENAI_API_MODEL (model %s): %v",
+		"startup.servers_required":         "%d MCP servers failed to connect and startup.requireServers is set, not starting",
+		"startup.llm_only":                 "no MCP servers available, running in LLM-only mode without tools",
+		"configsource.status":              "config backend %s returned %s",
+		"configsource.read_failed":         "failed to read config from %s: %v",
+		"configsource.startup_failed":      "%v, using the servers from the config file for now",
+		"configsource.watch_failed":        "watching config at %s failed, retrying: %v",
+		"configsource.invalid":             "invalid config at %s, keeping current servers: %v",
+		"configsource.server_failed":       "failed to connect %s with the new config: %v",
+		"configsource.applied":             "applied config from %s: %d added, %d reconnected, %d removed, %d servers now",
+		"cache.env_missing":                "cache is configured but no embedding API is available: set OPENAI_EMBEDDING_API_KEY and OPENAI_EMBEDDING_API_BASE (or OPENAI_API_KEY and OPENAI_API_BASE)",
+		"cache.empty_embedding":            "embedding API returned an empty vector",
+		"cache.embed_failed":               "[%s] failed to embed the question, skipping the cache: %v",
+		"config.missing":                   "config file %s not found, no MCP servers will be connected",
+		"server.listen_failed":             "server failed: %v",
+		"cli.config_ok":                    "config file %s is valid",
+		"cli.empty_query":                  "the question is empty",
+		"cli.turn_failed":                  "%v (trace id: %s)",
+		"cli.servers_failed":               "%d MCP server(s) failed to connect or list tools",
+		"ws.upgrade_failed":                "websocket upgrade failed: %v",
+		"server.panic":                     "[%s] recovered panic (session %s): %v\n%s",
+		"ws.read_failed":                   "[%s] websocket read failed: %v",
+		"ws.write_failed":                  "[%s] websocket write failed: %v",
+		"ws.unmarshal_failed":              "[%s] failed to unmarshal message: %v",
+		"ws.spectator_joined":              "[%s] spectator connected (user %q)",
+		"ws.rejected":                      "rejected connection from %s: %s",
+		"ws.ip_denied":                     "connection from %s denied by IP rules",
+		"api.ip_denied":                    "access from %s to %s denied by IP rules",
+		"session.participant_added":        "[%s] participant %q added",
+		"session.resume_issued":            "[%s] resume token issued, expires at %s",
+		"chat.request_failed":              "[%s] request failed: %v",
+		"chat.transcribe_failed":           "[%s] transcription failed: %v",
+		"chat.cancelled":                   "[%s] client disconnected, turn cancelled",
+		"chat.turn_timeout":                "[%s] turn timed out (%s), returning what was produced so far",
+		"error.request_failed":             "The request failed, please try again later",
+		"error.transcribe_failed":          "Speech recognition failed, please try again",
+		"error.invalid_choice":             "The candidate answers are no longer available, please ask again",
+		"error.invalid_elicitation":        "Invalid reply: %v, please correct it and submit again",
+		"error.policy_blocked":             "The message contains disallowed content and was blocked",
+		"error.forbidden":                  "Your account is not allowed to chat",
+		"error.budget_exceeded":            "Your daily token budget has been used up, please try again tomorrow",
+		"error.spectator_read_only":        "This is a read-only spectator connection, messages cannot be sent",
+		"ws.rejected_server_full":          "The server has reached its connection limit, please try again later",
+		"ws.rejected_user_limit":           "Your account has too many open connections, close other tabs and try again",
+		"ws.rejected_ip_limit":             "Too many connections from your network, please try again later",
+		"ws.rejected_unsupported_protocol": "Your client uses an unsupported protocol version, please reload the page or upgrade the client",
+		"status.thinking":                  "Analyzing your question",
+		"status.calling_tool":              "Calling tool %s (%d/%d)",
+		"status.summarizing":               "Summarizing the results",
+		"status.condensing":                "Condensing tool results",
+		"status.translating":               "Translating the answer",
+		"status.cached":                    "Using the answer to a recent similar question",
+		"status.verifying":                 "Checking the answer against tool results",
+		"status.tool_budget":               "Tool budget for this turn is exhausted, answering with the results so far",
+		"approval.request":                 "The model wants to call %s; review the arguments and approve or decline",
+		"elicitation.request":              "%s needs the following information to continue",
+		"warning.tools_unavailable":        "The tool server %s is unavailable right now, so its tools cannot be used for this answer",
+		"warning.llm_only":                 "No tools are available right now; answers come from the model alone and cannot use live data or perform actions",
+		"warning.session_not_found":        "The session you tried to resume no longer exists; a new session was started without the earlier conversation",
+
+		"api.session_not_found":        "session not found",
+		"api.artifact_not_found":       "artifact not found",
+		"api.method_not_allowed":       "method not allowed",
+		"api.not_pinnable":             "only user messages and assistant text replies can be pinned (index %d)",
+		"api.session_anonymous":        "participants cannot be added to an anonymous session",
+		"api.bad_participant":          "invalid participant: %q",
+		"api.bad_request":              "bad request: %v",
+		"api.missing_session_id":       "missing session_id",
+		"api.missing_query":            "missing query parameter q",
+		"api.search_disabled":          "search is not enabled",
+		"api.memory_disabled":          "memory is not enabled",
+		"api.memory_not_found":         "memory not found",
+		"api.prompts_disabled":         "prompt templates are not enabled",
+		"api.digest_disabled":          "session digests are not enabled",
+		"api.soft_delete_disabled":     "soft delete is not enabled",
+		"api.purge_not_pending":        "no pending purge for this user",
+		"api.analytics_disabled":       "tool analytics is not enabled",
+		"api.server_not_found":         "MCP server %q not found",
+		"api.bad_ref_type":             "invalid ref type %q (expected ref/resource or ref/prompt)",
+		"api.complete_failed":          "completion failed: %v",
+		"api.prompt_not_found":         "prompt template %q not found",
+		"api.prompt_invalid_name":      "template names may contain only letters, digits, underscores and hyphens (at most 64 characters)",
+		"api.prompt_empty":             "template must not be empty",
+		"api.prompt_missing_variables": "missing template variables: %s",
+		"api.checkpoint_invalid_name":  "checkpoint names may contain only letters, digits, underscores and hyphens (at most 64 characters)",
+		"api.checkpoint_not_found":     "checkpoint %q not found",
+		"api.approval_not_found":       "no such pending tool call, it may have timed out or been decided",
+		"api.elicitation_not_found":    "no such pending elicitation request, it may have timed out or been answered",
+		"api.forbidden":                "forbidden",
+		"api.ip_forbidden":             "access denied for this address",
+		"api.internal_error":           "internal server error",
+		"api.login_failed":             "login failed, please try again",
+		"api.session_id_order":         "session_id must precede file parts",
+		"api.upload_failed":            "upload failed: %v",
+		"api.transcribe_failed":        "transcription failed: %v",
+		"upload.too_large":             "file exceeds the size limit of %d bytes",
+		"upload.save_failed":           "failed to save an upload of session %s: %v",
+		"audio.empty":                  "audio is empty",
+		"audio.too_large":              "audio is too large",
+
+		"prompt.attachments":      "The user uploaded the following files. Pass the URI (or the path without the file:// prefix) to tools when needed:",
+		"prompt.attachment_item":  "- %s (%s, %d bytes): %s",
+		"prompt.truncated":        "...[truncated, the full content was provided to the user as attachment %s (%d bytes)]",
+		"prompt.no_artifacts":     "[%s content, artifact storage is disabled]",
+		"prompt.decode_failed":    "[undecodable %s content: %v]",
+		"prompt.save_failed":      "[failed to save attachment: %v]",
+		"prompt.artifact_saved":   "[generated attachment %s (%s, %d bytes) for the user to download]",
+		"prompt.ephemeral":        "[the result of tool %s was only used in its own turn and has been removed]",
+		"prompt.ephemeral_binary": "[%s content, not kept for an ephemeral tool]",
+		"prompt.participants":     "This conversation has multiple participants: %s. The name of each user message is its sender; keep track of who asked what and address people by name when helpful.",
+		"prompt.strict_format":    "Your previous reply was malformed. Either answer in plain text or call one of the provided tools; tool arguments must be a complete, valid JSON object.",
+		"chat.partial_model":      "[partial answer: the %s turn limit was reached while waiting for the model]",
+		"chat.partial_tool":       "[partial answer: timed out during tool %s, the turn limit is %s]",
+		"chat.partial_result":     "Result of tool %s:\n%s",
+		"prompt.scratchpad":       "Earlier tool results have been condensed into the scratchpad below; rely on it when answering:\n%s",
+		"prompt.scratchpad_ref":   "[the result of tool %s has been condensed into the scratchpad]",
+		"tools.hint":              "(recently measured: about %s per call, about %d tokens per result)",
+		"tools.hint_failures":     "(recently measured: about %s per call, about %d tokens per result, %d%% failed)",
+		"scratchpad.prompt":       "You maintain a scratchpad of tool results. Given the user's question, merge the new tool results into the existing scratchpad, keeping the facts, numbers, names and identifiers needed to answer and dropping duplicated or irrelevant content. Output only the updated scratchpad; do not answer the question.",
+		"digest.prompt":           "Below is the transcript of a conversation over a period of time, including tool results. Write a concise digest: the topics discussed, the actions taken and their results, the conclusions reached, and any open issues or follow-ups. Keep key numbers, names and identifiers. Output only the digest.",
+	},
+}
+
+// supportedLocales 返回排好序的可用语言
+func supportedLocales() []string {
+	locales := make([]string, 0, len(catalog))
+	for l := range catalog {
+		locales = append(locales, l)
+	}
+	sort.Strings(locales)
+	return locales
+}
+
+// T 按语言翻译, 找不到时回退到默认语言, 再找不到时原样返回 key
+func T(locale, key string, args ...any) string {
+	msg, ok := catalog[locale][key]
+	if !ok {
+		if msg, ok = catalog[defaultLocale][key]; !ok {
+			msg = key
+		}
+	}
+	if len(args) == 0 {
+		return msg
+	}
+	return fmt.Sprintf(msg, args...)
+}
+
+// logf 按服务端语言输出日志
+func logf(key string, args ...any) {
+	log.Print(T(serverLocale, key, args...))
+}
+
+// i18nError 保存消息 key 和参数, 输出时再翻译
+type i18nError struct {
+	key  string
+	args []any
+}
+
+func newError(key string, args ...any) error {
+	return &i18nError{key: key, args: args}
+}
+
+// hasErrorKey 判断 err 是否是 key 对应的 i18nError
+func hasErrorKey(err error, key string) bool {
+	var e *i18nError
+	return errors.As(err, &e) && e.key == key
+}
+
+func (e *i18nError) Error() string {
+	return T(serverLocale, e.key, e.args...)
+}
+
+// localize 把错误翻译成指定语言, 非 i18nError 原样输出
+func localize(err error, locale string) string {
+	var e *i18nError
+	if errors.As(err, &e) && e == err {
+		return T(locale, e.key, e.args...)
+	}
+	return err.Error()
+}
+
+// requestLocale 根据 ?lang= 或 Accept-Language 选择语言, 都不匹配时使用服务端语言
+func requestLocale(r *http.Request) string {
+	if l := matchLocale(r.URL.Query().Get("lang")); l != "" {
+		return l
+	}
+
+	type tag struct {
+		lang string
+		q    float64
+	}
+	var tags []tag
+	for _, part := range strings.Split(r.Header.Get("Accept-Language"), ",") {
+		lang, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				q = f
+			}
+		}
+		tags = append(tags, tag{lang, q})
+	}
+	sort.SliceStable(tags, func(i, j int) bool { return tags[i].q > tags[j].q })
+	for _, t := range tags {
+		if l := matchLocale(t.lang); l != "" {
+			return l
+		}
+	}
+	return serverLocale
+}
+
+// matchLocale 把 zh-CN, en-US 这样的语言标签对应到已有的语言
+func matchLocale(lang string) string {
+	lang = strings.ToLower(strings.TrimSpace(lang))
+	if lang == "" {
+		return ""
+	}
+	base, _, _ := strings.Cut(strings.ReplaceAll(lang, "_", "-"), "-")
+	if _, ok := catalog[base]; ok {
+		return base
+	}
+	return ""
+}
@@ -0,0 +1,59 @@
+package host
+
+import (
+	"net/http"
+	"strings"
+)
+
+var authHeadersIgnored = metrics.Counter("auth_headers_ignored_total", "Requests whose identity headers were ignored because they did not come from a trusted proxy.")
+
+// identity 是请求的用户身份, user 为空表示匿名
+type identity struct {
+	user   string
+	groups []string // 身份提供方给出的角色或组, 用于确定 RBAC 角色
+}
+
+// identity 按配置从 OIDC 登录状态或反向代理设置的请求头中取得用户身份
+// 未配置认证或未登录时返回匿名身份
+func (cc *ChatClient) identity(r *http.Request) identity {
+	if cc.auth == nil {
+		return identity{}
+	}
+	if cc.oidc != nil {
+		return cc.oidc.identity(r)
+	}
+	// 信任反向代理设置的请求头 (auth.userHeader), 比如 oauth2-proxy 的 X-Forwarded-User。
+	// 只采信 network.trustedProxies 中的代理转来的请求, 直接连接的客户端可以随意设置这些请求头
+	var id identity
+	if (cc.auth.UserHeader != "" || cc.auth.RoleHeader != "") && !cc.network.fromTrustedProxy(r) {
+		authHeadersIgnored.Inc()
+		return id
+	}
+	if cc.auth.UserHeader != "" {
+		id.user = strings.TrimSpace(r.Header.Get(cc.auth.UserHeader))
+	}
+	if cc.auth.RoleHeader != "" {
+		id.groups = strings.Split(r.Header.Get(cc.auth.RoleHeader), ",")
+	}
+	return id
+}
+
+// userID 返回请求的用户标识, 匿名时返回空字符串
+func (cc *ChatClient) userID(r *http.Request) string {
+	return cc.identity(r).user
+}
+
+// sessionFor 按 id 取会话, 并检查当前用户是会话的所有者或参与者, 或者带了这个会话的转移令牌
+// 匿名会话任何人凭 id 都可以访问, 和之前的行为一致
+func (cc *ChatClient) sessionFor(r *http.Request, id string) (*Session, bool) {
+	sess, ok := cc.sessions.Get(id)
+	if !ok {
+		return nil, false
+	}
+	if !sess.CanAccess(cc.userID(r)) {
+		if claims, ok := cc.resumeClaims(r); !ok || claims.SessionID != sess.ID {
+			return nil, false
+		}
+	}
+	return sess, true
+}
@@ -0,0 +1,132 @@
+package host
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestHeaderIdentityTrustedProxy(t *testing.T) {
+	auth := &AuthConfig{UserHeader: "X-Forwarded-User", RoleHeader: "X-Forwarded-Groups", DefaultRole: RoleReadonly}
+	proxies := newNetworkPolicy(&NetworkConfig{TrustedProxies: []string{"10.0.0.0/8"}})
+	tests := []struct {
+		name     string
+		remote   string
+		network  *networkPolicy
+		wantUser string
+		wantRole string
+	}{
+		{"trusted proxy", "10.1.2.3:4000", proxies, "alice", RoleAdmin},
+		{"direct client", "203.0.113.9:4000", proxies, "", RoleReadonly},
+		{"no trusted proxies", "10.1.2.3:4000", nil, "", RoleReadonly},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &ChatClient{auth: auth, network: tt.network}
+			r := httptest.NewRequest("GET", "/api/sessions", nil)
+			r.RemoteAddr = tt.remote
+			r.Header.Set("X-Forwarded-User", "alice")
+			r.Header.Set("X-Forwarded-Groups", "user, admin")
+			if got := c.userID(r); got != tt.wantUser {
+				t.Errorf("user = %q, want %q", got, tt.wantUser)
+			}
+			if got := c.role(r); got != tt.wantRole {
+				t.Errorf("role = %q, want %q", got, tt.wantRole)
+			}
+		})
+	}
+}
+
+func TestHeaderAuthRequiresTrustedProxies(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		wantErr string
+	}{
+		{"user header", `{"auth": {"userHeader": "X-Forwarded-User"}}`, "auth.userHeader"},
+		{"role header", `{"auth": {"roleHeader": "X-Forwarded-Groups"}}`, "auth.roleHeader"},
+		{"empty proxies", `{"network": {"trustedProxies": []}, "auth": {"userHeader": "X-Forwarded-User"}}`, "auth.userHeader"},
+		{"trusted proxies", `{"network": {"trustedProxies": ["10.0.0.1"]}, "auth": {"userHeader": "X-Forwarded-User"}}`, ""},
+		{"no header auth", `{"auth": {"defaultRole": "user"}}`, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := parseTestConfig(tt.config)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) || !strings.Contains(err.Error(), "trustedProxies") {
+				t.Errorf("err = %v, want an error at %s", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// 启用认证时 WebSocket 握手只接受同源、配置的前端地址和不带 Origin 的客户端, 防止跨站劫持登录用户的连接
+func TestWebSocketOrigin(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		auth   *AuthConfig
+		origin string
+		want   bool
+	}{
+		{"no auth", nil, "https://evil.example", true},
+		{"no origin", &AuthConfig{}, "", true},
+		{"frontend", &AuthConfig{}, "http://localhost:5173", true},
+		{"cross site", &AuthConfig{}, "https://evil.example", false},
+		{"null origin", &AuthConfig{}, "null", false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cc := &ChatClient{auth: tt.auth, corsOrigin: "http://localhost:5173"}
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if ws, err := cc.upgrade(w, r); err == nil {
+					ws.Close()
+				}
+			}))
+			defer srv.Close()
+			header := http.Header{}
+			if tt.origin != "" {
+				header.Set("Origin", tt.origin)
+			}
+			ws, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), header)
+			if err == nil {
+				ws.Close()
+			}
+			if got := err == nil; got != tt.want {
+				t.Errorf("origin %q accepted = %v, want %v (resp %v)", tt.origin, got, tt.want, resp)
+			}
+		})
+	}
+
+	// 同源的前端 (由本服务提供) 总是可以连接
+	cc := &ChatClient{auth: &AuthConfig{}}
+	r := httptest.NewRequest(http.MethodGet, "http://chat.example.com/ws", nil)
+	r.Header.Set("Origin", "https://Chat.example.com")
+	if !cc.checkOrigin(r) {
+		t.Error("same-origin handshake was rejected")
+	}
+}
+
+// 允许跨域的前端地址保存在各自的 ChatClient 中, 不会互相影响
+func TestCORSOriginPerClient(t *testing.T) {
+	a := &ChatClient{corsOrigin: "https://a.example"}
+	b := &ChatClient{}
+	for _, tt := range []struct {
+		cc   *ChatClient
+		want string
+	}{{a, "https://a.example"}, {b, "*"}} {
+		r := httptest.NewRequest(http.MethodGet, "/api/tools", nil)
+		r.Header.Set("Origin", "https://a.example")
+		w := httptest.NewRecorder()
+		tt.cc.withCORS(func(http.ResponseWriter, *http.Request) {})(w, r)
+		if got := w.Header().Get("Access-Control-Allow-Origin"); got != tt.want {
+			t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package host
+
+import (
+	"context"
+	"strings"
+	"unicode"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+const maxLanguageLen = 32
+
+// sanitizeLanguage 语言由客户端声明 (比如 ja、English、简体中文), 会写进系统消息,
+// 限制长度并去掉控制字符, 避免借此注入提示词
+func sanitizeLanguage(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, strings.TrimSpace(s))
+	if r := []rune(s); len(r) > maxLanguageLen {
+		s = string(r[:maxLanguageLen])
+	}
+	return s
+}
+
+// languageMessage 要求大模型始终使用会话声明的语言回答
+func languageMessage(language string) openai.ChatCompletionMessage {
+	return openai.ChatCompletionMessage{
+		Role:    openai.ChatMessageRoleSystem,
+		Content: T(serverLocale, "language.directive", language),
+	}
+}
+
+// translate 开启 language.translate 时把最终回答再交给大模型翻译成会话语言,
+// 防止工具结果等其他语言的内容混入回答; 翻译失败时返回原文
+func (cc *ChatClient) translate(ctx context.Context, sessionID string, stats *turnStats, model, text, language string) string {
+	if text == "" {
+		return text
+	}
+	resp, err := cc.createChatCompletion(ctx, sessionID, stats, openai.ChatCompletionRequest{
+		Model: model,
+		Messages: []openai.ChatCompletionMessage{
+			{Role: openai.ChatMessageRoleSystem, Content: T(serverLocale, "language.translate", language)},
+			{Role: openai.ChatMessageRoleUser, Content: text},
+		},
+	})
+	if err != nil || len(resp.Choices) == 0 || resp.Choices[0].Message.Content == "" {
+		logf("language.translate_failed", logTag(ctx, sessionID), err)
+		return text
+	}
+	return resp.Choices[0].Message.Content
+}
@@ -0,0 +1,216 @@
+package host
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+var leaksMasked = metrics.Counter("output_leaks_masked_total", "Number of internal configuration values masked in answers.", "kind")
+
+// 主机自己读取的环境变量, 变量名本身也不应该出现在回答中
+var hostEnvNames = []string{
+	"OPENAI_API_KEY", "OPENAI_API_BASE", "OPENAI_API_MODEL", "OPENAI_API_PROXY",
+	"OPENAI_EMBEDDING_API_KEY", "OPENAI_EMBEDDING_API_BASE",
+	"OPENAI_TRANSCRIBE_API_KEY", "OPENAI_TRANSCRIBE_API_BASE", "OPENAI_TRANSCRIBE_MODEL", "OPENAI_TRANSCRIBE_PROXY",
+	"VAULT_TOKEN", "VAULT_NAMESPACE",
+}
+
+// 配置中引用的环境变量: ${VAR} 和 {"fromEnv": "VAR"}
+var configEnvRefRe = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)|"fromEnv"\s*:\s*"([A-Za-z_][A-Za-z0-9_]*)"`)
+
+// configEnvNames 返回配置原文中引用的环境变量名, 要在替换密钥引用之前调用
+func configEnvNames(data []byte) []string {
+	var names []string
+	for _, m := range configEnvRefRe.FindAllSubmatch(data, -1) {
+		name := string(m[1]) + string(m[2])
+		if !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// 太短的值容易误伤正常的回答, 不检查
+const minLeakTermLength = 4
+
+// leakGuard 在回答发给客户端之前检查是否泄露了内部配置: 大模型和 MCP 服务等接口的地址、配置文件和数据目录的路径、
+// 配置引用的环境变量名, 匹配到的内容替换为 ****。大模型可能从工具结果、错误信息或系统消息中得到这些内容
+type leakGuard struct {
+	replacement string
+	values      *regexp.Regexp // 地址和路径, 按原样匹配
+	names       *regexp.Regexp // 环境变量名, 按整词匹配
+}
+
+// newLeakGuard 未配置 leakGuard 时返回 nil; dirs 为附件、上传等实际使用的数据目录
+func newLeakGuard(cfg *MCPConfig, baseURL string, dirs []string) *leakGuard {
+	lc := cfg.LeakGuard
+	if lc == nil {
+		return nil
+	}
+	g := &leakGuard{replacement: lc.Replacement}
+	if g.replacement == "" {
+		g.replacement = defaultMaskReplacement
+	}
+
+	var values []string
+	addURL := func(raw string) {
+		raw = strings.TrimRight(raw, "/")
+		if raw == "" || raw == "direct" {
+			return
+		}
+		values = append(values, raw)
+		if u, err := url.Parse(raw); err == nil && u.Host != "" {
+			values = append(values, u.Host)
+		}
+	}
+	addPath := func(p string) {
+		if p == "" || !strings.ContainsAny(p, `/\`) {
+			return
+		}
+		values = append(values, p)
+		if abs, err := filepath.Abs(p); err == nil {
+			values = append(values, abs)
+		}
+	}
+	addURL(baseURL)
+	for _, name := range []string{"OPENAI_API_PROXY", "OPENAI_EMBEDDING_API_BASE", "OPENAI_TRANSCRIBE_API_BASE", "OPENAI_TRANSCRIBE_PROXY"} {
+		addURL(os.Getenv(name))
+	}
+	names := append(slices.Clone(hostEnvNames), cfg.envNames...)
+	for _, s := range cfg.MCPServers {
+		addURL(s.URL)
+		addURL(s.Proxy)
+		addPath(argPath(s.Command))
+		for _, arg := range s.Args {
+			addPath(argPath(arg))
+		}
+		names = append(names, sortedKeys(s.Env)...)
+	}
+	if cfg.ConfigSource != nil {
+		addURL(cfg.ConfigSource.Address)
+	}
+	if cfg.file != "" {
+		addPath(cfg.file)
+		addPath(filepath.Dir(cfg.file))
+	}
+	addPath(cfg.PolicyFile)
+	if h := cfg.History; h != nil {
+		addPath(h.Dir)
+		if h.Redis != nil {
+			addURL(h.Redis.URL)
+		}
+		if h.Encryption != nil {
+			addPath(h.Encryption.KeyFile)
+			names = append(names, h.Encryption.KeyEnv)
+		}
+	}
+	for _, dir := range dirs {
+		addPath(dir)
+	}
+	values = append(values, lc.Extra...)
+
+	g.values = alternation(values, false)
+	g.names = alternation(names, true)
+	return g
+}
+
+// argPath 返回 MCP 服务的命令或参数中的路径, 不是路径时返回空: 只认绝对路径、以 ./ 或 ../ 开头的和磁盘上存在的,
+// 包名 (比如 @modelcontextprotocol/server-filesystem) 这类带斜杠的参数不算; --root=/data 这样的参数取等号后的值
+func argPath(arg string) string {
+	if strings.HasPrefix(arg, "-") {
+		_, value, ok := strings.Cut(arg, "=")
+		if !ok {
+			return ""
+		}
+		arg = value
+	}
+	if arg == "" {
+		return ""
+	}
+	for _, prefix := range []string{"./", "../", `.\`, `..\`} {
+		if strings.HasPrefix(arg, prefix) {
+			return arg
+		}
+	}
+	if filepath.IsAbs(arg) {
+		return arg
+	}
+	if _, err := os.Stat(arg); err == nil {
+		return arg
+	}
+	return ""
+}
+
+// dataDirs 返回各存储实际使用的目录
+func (cc *ChatClient) dataDirs() []string {
+	dirs := []string{cc.artifacts.dir, cc.uploads.dir}
+	if cc.memory != nil {
+		dirs = append(dirs, cc.memory.dir)
+	}
+	if cc.prompts != nil {
+		dirs = append(dirs, cc.prompts.dir)
+	}
+	if cc.digests != nil {
+		dirs = append(dirs, cc.digests.dir)
+	}
+	if cc.analytics != nil {
+		dirs = append(dirs, cc.analytics.dir)
+	}
+	return dirs
+}
+
+// alternation 把各项按长度从长到短拼成一个正则, 长的优先匹配; 没有可用的项时返回 nil
+func alternation(terms []string, words bool) *regexp.Regexp {
+	var quoted []string
+	for _, t := range terms {
+		if len(t) < minLeakTermLength {
+			continue
+		}
+		if q := regexp.QuoteMeta(t); !slices.Contains(quoted, q) {
+			quoted = append(quoted, q)
+		}
+	}
+	if len(quoted) == 0 {
+		return nil
+	}
+	slices.SortFunc(quoted, func(a, b string) int { return len(b) - len(a) })
+	expr := "(?:" + strings.Join(quoted, "|") + ")"
+	if words {
+		expr = `\b` + expr + `\b`
+	}
+	return regexp.MustCompile(expr)
+}
+
+// mask 返回替换后的回答, g 为 nil 时原样返回
+func (g *leakGuard) mask(ctx context.Context, sessionID, text string) string {
+	if g == nil {
+		return text
+	}
+	total := 0
+	for _, f := range []struct {
+		kind string
+		re   *regexp.Regexp
+	}{{"value", g.values}, {"env", g.names}} {
+		if f.re == nil {
+			continue
+		}
+		n := 0
+		text = f.re.ReplaceAllStringFunc(text, func(string) string {
+			n++
+			return g.replacement
+		})
+		if n > 0 {
+			leaksMasked.Add(float64(n), f.kind)
+			total += n
+		}
+	}
+	if total > 0 {
+		logf("leakguard.masked", logTag(ctx, sessionID), total)
+	}
+	return text
+}
@@ -0,0 +1,45 @@
+package host
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// 只有像路径的服务参数才会被遮盖: 绝对路径、./ 开头的和磁盘上存在的; npm 包名等带斜杠的参数不能误伤正常的回答
+func TestLeakGuardServerArgs(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+	if err := os.MkdirAll(filepath.Join(dir, "tools"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "tools", "server.py"), nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &MCPConfig{LeakGuard: &LeakGuardConfig{}, MCPServers: map[string]MCPServer{
+		"fs": {Command: "npx", Args: []string{"-y", "@modelcontextprotocol/server-filesystem", "/srv/secret-files"}},
+		"py": {Command: "./venv/bin/python", Args: []string{"--root=/srv/other-root", "tools/server.py", "missing/server.py"}},
+	}}
+	g := newLeakGuard(cfg, "", nil)
+	for text, want := range map[string]string{
+		"install @modelcontextprotocol/server-filesystem first": "install @modelcontextprotocol/server-filesystem first",
+		"the files are in /srv/secret-files/a.txt":              "the files are in ****/a.txt",
+		"python is ./venv/bin/python":                           "python is ****",
+		"root is /srv/other-root":                               "root is ****",
+		"run tools/server.py":                                   "run ****",
+		"run missing/server.py":                                 "run missing/server.py",
+	} {
+		if got := g.mask(context.Background(), "", text); got != want {
+			t.Errorf("mask(%q) = %q, want %q", text, got, want)
+		}
+	}
+}
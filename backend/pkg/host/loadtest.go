@@ -0,0 +1,264 @@
+package host
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/guobinqiu/mcp-host-web/chat"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/sashabaranov/go-openai"
+	"google.golang.org/protobuf/proto"
+)
+
+// LoadTestOptions 是 loadtest 子命令的参数
+type LoadTestOptions struct {
+	Sessions    int           // 并发 WebSocket 会话数
+	Turns       int           // 每个会话的对话轮数
+	Prompts     string        // 提示词文件, 每行一条, 为空时使用内置提示词
+	LLMLatency  time.Duration // 模拟大模型每次调用的耗时
+	ToolLatency time.Duration // 模拟工具调用的耗时
+}
+
+var defaultLoadPrompts = []string{
+	"你好",
+	"帮我算一下 1+2",
+	"今天天气怎么样",
+	"总结一下我们刚才的对话",
+}
+
+// RunLoadTest 用模拟的大模型和 MCP 服务启动完整的对话服务, 并发模拟多个 WebSocket 会话,
+// 输出吞吐量和延迟分位数, 用于验证并发相关的改动
+func RunLoadTest(opts LoadTestOptions) error {
+	prompts := defaultLoadPrompts
+	if opts.Prompts != "" {
+		var err error
+		if prompts, err = readPrompts(opts.Prompts); err != nil {
+			return err
+		}
+	}
+
+	llm := httptest.NewServer(mockLLMHandler(opts.LLMLatency))
+	defer llm.Close()
+
+	mcpClient, err := newMockMCPClient(opts.ToolLatency)
+	if err != nil {
+		return err
+	}
+	defer mcpClient.Close()
+
+	tmp, err := os.MkdirTemp("", "mcp-host-loadtest")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+	cc, err := newLoadTestClient(llm.URL, mcpClient, tmp)
+	if err != nil {
+		return err
+	}
+	defer cc.events.Close()
+	// 压测时每个连接断开都会打日志, 只保留最后的报告
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	host := httptest.NewServer(http.HandlerFunc(cc.ChatLoop))
+	defer host.Close()
+	wsURL := "ws" + strings.TrimPrefix(host.URL, "http")
+
+	var (
+		mu        sync.Mutex
+		latencies []time.Duration
+		failed    atomic.Int64
+		wg        sync.WaitGroup
+	)
+	start := time.Now()
+	for i := 0; i < opts.Sessions; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			got, err := runLoadSession(wsURL, prompts, i, opts.Turns)
+			if err != nil {
+				failed.Add(int64(opts.Turns - len(got)))
+			}
+			mu.Lock()
+			latencies = append(latencies, got...)
+			mu.Unlock()
+		}(i)
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	fmt.Printf("sessions=%d turns=%d ok=%d failed=%d elapsed=%s\n", opts.Sessions, opts.Turns, len(latencies), failed.Load(), elapsed.Round(time.Millisecond))
+	fmt.Printf("throughput=%.1f turns/s\n", float64(len(latencies))/elapsed.Seconds())
+	fmt.Printf("latency p50=%s p90=%s p99=%s max=%s\n", percentile(latencies, 50), percentile(latencies, 90), percentile(latencies, 99), percentile(latencies, 100))
+	return nil
+}
+
+// newLoadTestClient 创建连接模拟大模型 (llmURL) 和 mcpClient 的对话服务, 附件和产物保存在 dir 中
+func newLoadTestClient(llmURL string, mcpClient *MCPClient, dir string) (*ChatClient, error) {
+	artifacts, err := NewArtifactStore(&ArtifactsConfig{Dir: dir + "/artifacts"})
+	if err != nil {
+		return nil, err
+	}
+	uploads, err := NewUploadStore(&UploadsConfig{Dir: dir + "/uploads"})
+	if err != nil {
+		return nil, err
+	}
+	events, _ := NewEventBus(nil)
+
+	config := openai.DefaultConfig("loadtest")
+	config.BaseURL = llmURL
+	return &ChatClient{
+		mcpClients:  []*MCPClient{mcpClient},
+		provider:    openai.NewClientWithConfig(config),
+		model:       "mock",
+		sessions:    NewSessionStore(nil),
+		artifacts:   artifacts,
+		uploads:     uploads,
+		events:      events,
+		turnTimeout: defaultTurnTimeout,
+		tools:       newToolRegistry(),
+	}, nil
+}
+
+// runLoadSession 模拟一个客户端, 返回每轮从发送到收到回答的耗时
+func runLoadSession(wsURL string, prompts []string, id, turns int) ([]time.Duration, error) {
+	ws, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer ws.Close()
+	for _, want := range []string{"hello", "session"} {
+		if msg, err := readChatMessage(ws); err != nil {
+			return nil, err
+		} else if msg.Type != want {
+			return nil, fmt.Errorf("unexpected %q message, want %q", msg.Type, want)
+		}
+	}
+
+	var latencies []time.Duration
+	for t := 0; t < turns; t++ {
+		buf, _ := proto.Marshal(&chat.ChatMessage{Role: openai.ChatMessageRoleUser, Content: prompts[(id+t)%len(prompts)]})
+		start := time.Now()
+		if err := ws.WriteMessage(websocket.BinaryMessage, buf); err != nil {
+			return latencies, err
+		}
+		// 跳过附件、summary 等事件, 直到收到回答或错误
+		for {
+			msg, err := readChatMessage(ws)
+			if err != nil {
+				return latencies, err
+			}
+			if msg.Type == "error" {
+				return latencies, fmt.Errorf("%s", msg.Content)
+			}
+			if msg.Type == "" && msg.Role == openai.ChatMessageRoleAssistant {
+				break
+			}
+		}
+		latencies = append(latencies, time.Since(start))
+	}
+	return latencies, nil
+}
+
+func readChatMessage(ws *websocket.Conn) (*chat.ChatMessage, error) {
+	_, data, err := ws.ReadMessage()
+	if err != nil {
+		return nil, err
+	}
+	msg := &chat.ChatMessage{}
+	return msg, proto.Unmarshal(data, msg)
+}
+
+// mockLLMHandler 模拟 chat completions 接口: 收到用户消息时要求调用 echo 工具, 收到工具结果后直接回答
+func mockLLMHandler(latency time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req openai.ChatCompletionRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.Messages) == 0 {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		time.Sleep(latency)
+
+		last := req.Messages[len(req.Messages)-1]
+		msg := openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant}
+		if last.Role == openai.ChatMessageRoleUser && len(req.Tools) > 0 {
+			args, _ := json.Marshal(map[string]string{"text": last.Content})
+			msg.ToolCalls = []openai.ToolCall{{
+				ID:       "call_" + newID()[:8],
+				Type:     openai.ToolTypeFunction,
+				Function: openai.FunctionCall{Name: "echo", Arguments: string(args)},
+			}}
+		} else {
+			msg.Content = "mock reply: " + last.Content
+		}
+		writeJSON(w, http.StatusOK, openai.ChatCompletionResponse{
+			ID:      "mock",
+			Object:  "chat.completion",
+			Created: time.Now().Unix(),
+			Model:   req.Model,
+			Choices: []openai.ChatCompletionChoice{{Message: msg, FinishReason: openai.FinishReasonStop}},
+			Usage:   openai.Usage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15},
+		})
+	}
+}
+
+// newMockMCPClient 启动进程内的 MCP 服务, 只提供一个 echo 工具
+func newMockMCPClient(latency time.Duration) (*MCPClient, error) {
+	s := server.NewMCPServer("loadtest", "1.0.0")
+	s.AddTool(mcp.NewTool("echo",
+		mcp.WithDescription("原样返回输入的文本"),
+		mcp.WithString("text", mcp.Required()),
+	), func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		time.Sleep(latency)
+		text, _ := req.GetArguments()["text"].(string)
+		return mcp.NewToolResultText(text), nil
+	})
+
+	return newInProcessMCPClient("loadtest", s)
+}
+
+func readPrompts(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var prompts []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			prompts = append(prompts, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(prompts) == 0 {
+		return nil, fmt.Errorf("%s: no prompts", path)
+	}
+	return prompts, nil
+}
+
+// percentile 返回已排序延迟的第 p 百分位
+func percentile(sorted []time.Duration, p int) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := (len(sorted)*p+99)/100 - 1
+	return sorted[max(i, 0)].Round(time.Microsecond)
+}
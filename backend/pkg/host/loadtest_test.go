@@ -0,0 +1,78 @@
+package host
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/guobinqiu/mcp-host-web/chat"
+)
+
+// newBenchClient 用 loadtest 的模拟大模型和 echo 服务 (都没有延迟) 创建对话服务, 测得的是 host 自身的开销
+func newBenchClient(b *testing.B) *ChatClient {
+	b.Helper()
+	llm := httptest.NewServer(mockLLMHandler(0))
+	b.Cleanup(llm.Close)
+	mcpClient, err := newMockMCPClient(0)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { mcpClient.Close() })
+	cc, err := newLoadTestClient(llm.URL, mcpClient, b.TempDir())
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(cc.events.Close)
+	log.SetOutput(io.Discard)
+	b.Cleanup(func() { log.SetOutput(os.Stderr) })
+	return cc
+}
+
+// chatTurn 在新会话中问一轮 (一次工具调用加一次回答), 新会话避免历史随 b.N 增长影响结果。
+// 会在 RunParallel 的 goroutine 中调用, 只能用 b.Error
+func chatTurn(b *testing.B, cc *ChatClient, prompt string) {
+	sess := cc.sessions.Create("")
+	defer cc.sessions.Delete(sess.ID)
+	got, err := cc.ProcessQuery(context.Background(), sess, prompt, func(*chat.ChatMessage) {})
+	if err != nil || got != "mock reply: "+prompt {
+		b.Errorf("got %q, %v", got, err)
+	}
+}
+
+func BenchmarkChatTurn(b *testing.B) {
+	cc := newBenchClient(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		chatTurn(b, cc, defaultLoadPrompts[i%len(defaultLoadPrompts)])
+	}
+}
+
+func BenchmarkChatTurnParallel(b *testing.B) {
+	cc := newBenchClient(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for i := 0; pb.Next(); i++ {
+			chatTurn(b, cc, defaultLoadPrompts[i%len(defaultLoadPrompts)])
+		}
+	})
+}
+
+// BenchmarkChatTurnWebSocket 包括 WebSocket 连接、protobuf 编解码和会话建立, 和 loadtest 子命令的路径相同
+func BenchmarkChatTurnWebSocket(b *testing.B) {
+	cc := newBenchClient(b)
+	host := httptest.NewServer(http.HandlerFunc(cc.ChatLoop))
+	b.Cleanup(host.Close)
+	wsURL := "ws" + strings.TrimPrefix(host.URL, "http")
+	b.ReportAllocs()
+	b.ResetTimer()
+	if _, err := runLoadSession(wsURL, defaultLoadPrompts, 0, b.N); err != nil {
+		b.Fatal(err)
+	}
+}
@@ -0,0 +1,318 @@
+package host
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/client/transport"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// MCPClient 在 mcp-go 客户端的基础上记录服务名和请求超时
+type MCPClient struct {
+	*client.Client
+	Name    string
+	Timeout time.Duration
+	Tools   map[string]ToolOverride
+
+	pool       *clientPool // 配置了 pool 时工具调用分摊到多个连接, 第一个连接就是 Client
+	transforms map[string]*resultTransform
+	chaos      *chaosInjector // 为 nil 时不注入故障
+	elicit     *elicitationHandler
+}
+
+// CallTool 配置了连接池时从池中选择连接调用工具
+func (c *MCPClient) CallTool(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	if err := c.chaos.beforeToolCall(ctx); err != nil {
+		return nil, err
+	}
+	defer c.elicit.track(ctx)()
+	if c.pool != nil {
+		return c.pool.CallTool(ctx, req)
+	}
+	return c.Client.CallTool(ctx, req)
+}
+
+func (c *MCPClient) Close() error {
+	if c.pool != nil {
+		c.pool.Close()
+	}
+	return c.Client.Close()
+}
+
+// WithTimeout 按服务配置的超时包装 ctx, 未配置时原样返回
+func (c *MCPClient) WithTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.Timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, c.Timeout)
+}
+
+// WithToolTimeout 工具单独配置了超时时优先使用, 否则按服务的超时
+func (c *MCPClient) WithToolTimeout(ctx context.Context, tool string) (context.Context, context.CancelFunc) {
+	if t := c.Tools[tool].Timeout; t > 0 {
+		return context.WithTimeout(ctx, time.Duration(t))
+	}
+	return c.WithTimeout(ctx)
+}
+
+// ephemeral 工具配置了 ephemeral 时返回 true; c 为 nil (大模型调用了不存在的工具) 时返回 false
+func (c *MCPClient) ephemeral(tool string) bool {
+	return c != nil && c.Tools[tool].Ephemeral
+}
+
+// 创建客户端实例，连接 MCP 服务端
+func LoadMCPClients(mcpConfig *MCPConfig, ctx context.Context) ([]*MCPClient, []error) {
+	var mcpClients []*MCPClient
+	var errors []error
+
+	for name, mcpServer := range mcpConfig.MCPServers {
+		mcpClient, errs := connectMCPClient(ctx, name, mcpServer)
+		errors = append(errors, errs...)
+		if mcpClient != nil {
+			mcpClients = append(mcpClients, mcpClient)
+		}
+	}
+
+	return mcpClients, errors
+}
+
+// connectMCPClient 连接一个服务并完成握手, 失败时返回 nil; 连接池中个别连接失败只返回错误
+func connectMCPClient(ctx context.Context, name string, mcpServer MCPServer) (*MCPClient, []error) {
+	mcpClient, err := newMCPClient(name, mcpServer)
+	if err != nil {
+		return nil, []error{newError("mcp.create_failed", name, err)}
+	}
+
+	// 初始化 MCP 客户端
+	logf("mcp.initializing", name)
+	initResult, err := mcpClient.initialize(ctx, mcpClient.Client)
+	if err != nil {
+		mcpClient.Client.Close()
+		return nil, []error{newError("mcp.init_failed", name, err)}
+	}
+
+	logf("mcp.connected", name, initResult.ServerInfo.Name, initResult.ServerInfo.Version)
+
+	var errors []error
+	if p := mcpServer.Pool; p != nil && p.Size > 1 {
+		clients := []*client.Client{mcpClient.Client}
+		for i := 1; i < p.Size; i++ {
+			c, err := newTransportClient(name, mcpServer, mcpClient.elicit)
+			if err == nil {
+				if _, err = mcpClient.initialize(ctx, c); err != nil {
+					c.Close()
+				}
+			}
+			if err != nil {
+				errors = append(errors, newError("mcp.pool_failed", name, i, err))
+				continue
+			}
+			clients = append(clients, c)
+		}
+		mcpClient.pool = newClientPool(name, clients, time.Duration(p.HealthCheckInterval))
+		logf("mcp.pool_ready", name, len(clients))
+	}
+	return mcpClient, errors
+}
+
+// initialize 完成 MCP 握手
+func (c *MCPClient) initialize(ctx context.Context, conn *client.Client) (*mcp.InitializeResult, error) {
+	initRequest := mcp.InitializeRequest{}
+	initRequest.Params.ProtocolVersion = mcp.LATEST_PROTOCOL_VERSION
+	initRequest.Params.ClientInfo = mcp.Implementation{
+		Name:    c.Name, // 使用配置中的名称作为客户端名
+		Version: "1.0.0",
+	}
+	initCtx, cancel := c.WithTimeout(ctx)
+	defer cancel()
+	return conn.Initialize(initCtx, initRequest)
+}
+
+// newInProcessMCPClient 通过 mcp-go 的进程内传输连接 Go 实现的 MCP 服务并完成握手, 没有进程和网络开销
+func newInProcessMCPClient(name string, s *server.MCPServer) (*MCPClient, error) {
+	elicit := newElicitationHandler(name)
+	c, err := newInProcessClient(s, elicit)
+	if err != nil {
+		return nil, err
+	}
+	mcpClient := &MCPClient{Client: c, Name: name, elicit: elicit}
+	if _, err := mcpClient.initialize(context.Background(), c); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return mcpClient, nil
+}
+
+func newMCPClient(name string, mcpServer MCPServer) (*MCPClient, error) {
+	transforms, err := compileTransforms(mcpServer.Tools)
+	if err != nil {
+		return nil, err
+	}
+	elicit := newElicitationHandler(name)
+	c, err := newTransportClient(name, mcpServer, elicit)
+	if err != nil {
+		return nil, err
+	}
+
+	return &MCPClient{
+		Client:  c,
+		Name:    name,
+		Timeout: time.Duration(mcpServer.Timeout),
+		Tools:   mcpServer.Tools,
+
+		transforms: transforms,
+		elicit:     elicit,
+	}, nil
+}
+
+// newInProcessClient 创建进程内连接, 同样声明 elicitation 能力
+func newInProcessClient(s *server.MCPServer, elicit *elicitationHandler) (*client.Client, error) {
+	t := transport.NewInProcessTransportWithOptions(s, transport.WithElicitationHandler(elicit))
+	c := client.NewClient(t, client.WithElicitationHandler(elicit))
+	if err := c.Start(context.Background()); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// newTransportClient 按服务类型创建底层连接; stdio、http 和进程内的服务可以在工具调用中途发起 elicitation 请求,
+// sse 传输不支持服务端请求, 不声明该能力
+func newTransportClient(name string, mcpServer MCPServer, elicit *elicitationHandler) (*client.Client, error) {
+	var c *client.Client
+	var err error
+
+	// http / sse 按服务配置的代理访问
+	if mcpServer.Type == "http" || mcpServer.Type == "sse" {
+		if err := proxyRoutes.route(mcpServer.URL, mcpServer.Proxy); err != nil {
+			return nil, err
+		}
+	}
+
+	switch mcpServer.Type {
+	case "stdio":
+		var t *stdioTransport
+		if t, err = startStdio(name, mcpServer); err == nil {
+			c = client.NewClient(t, client.WithElicitationHandler(elicit))
+			// 传输已经启动, Start 只登记服务端请求和通知的处理函数
+			if err = c.Start(context.Background()); err != nil {
+				t.Close()
+			}
+		}
+	case "http":
+		var opts []transport.StreamableHTTPCOption
+		if len(mcpServer.Headers) > 0 {
+			opts = append(opts, transport.WithHTTPHeaders(mcpServer.Headers))
+		}
+		var t *transport.StreamableHTTP
+		if t, err = transport.NewStreamableHTTP(mcpServer.URL, opts...); err == nil {
+			c = client.NewClient(t, client.WithElicitationHandler(elicit))
+			err = c.Start(context.Background())
+		}
+	case "sse":
+		var opts []transport.ClientOption
+		if len(mcpServer.Headers) > 0 {
+			opts = append(opts, client.WithHeaders(mcpServer.Headers))
+		}
+		c, err = client.NewSSEMCPClient(mcpServer.URL, opts...)
+		if err == nil {
+			// sse 需要先建立长连接
+			err = c.Start(context.Background())
+		}
+	default:
+		builtin, ok := builtinName(mcpServer.Type)
+		newServer := lookupBuiltin(builtin)
+		if !ok || newServer == nil {
+			err = newError("mcp.unknown_type", name, mcpServer.Type)
+			break
+		}
+		c, err = newInProcessClient(newServer(), elicit)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// ApplyOverrides 按配置调整工具描述和参数描述, 去掉由主机注入的参数, 标出参数的缺省值
+func (c *MCPClient) ApplyOverrides(tool mcp.Tool) mcp.Tool {
+	o, ok := c.Tools[tool.Name]
+	if !ok {
+		return tool
+	}
+	tool.Description = overrideText(tool.Description, o.Description, o.AppendDescription)
+
+	if (len(o.Parameters) > 0 || len(o.Inject) > 0 || len(o.Defaults) > 0) && tool.InputSchema.Properties != nil {
+		// 复制一份, 避免修改原始 schema
+		props := make(map[string]any, len(tool.InputSchema.Properties))
+		for name, prop := range tool.InputSchema.Properties {
+			props[name] = prop
+		}
+		// 由主机注入的参数不告诉大模型
+		for name := range o.Inject {
+			delete(props, name)
+		}
+		// 注入的参数和有缺省值的参数都不要求大模型给出
+		if len(o.Inject) > 0 || len(o.Defaults) > 0 {
+			tool.InputSchema.Required = slices.DeleteFunc(slices.Clone(tool.InputSchema.Required), func(name string) bool {
+				_, injected := o.Inject[name]
+				_, defaulted := o.Defaults[name]
+				return injected || defaulted
+			})
+		}
+		for name, po := range o.Parameters {
+			if copied, ok := copyProperty(props, name); ok {
+				desc, _ := copied["description"].(string)
+				copied["description"] = overrideText(desc, po.Description, po.AppendDescription)
+			}
+		}
+		for name, v := range o.Defaults {
+			if copied, ok := copyProperty(props, name); ok {
+				copied["default"] = v
+			}
+		}
+		tool.InputSchema.Properties = props
+	}
+	return tool
+}
+
+// copyProperty 把 props 中的参数 schema 换成副本后返回, 参数不存在时返回 false
+func copyProperty(props map[string]any, name string) (map[string]any, bool) {
+	schema, ok := props[name].(map[string]any)
+	if !ok {
+		return nil, false
+	}
+	copied := make(map[string]any, len(schema)+1)
+	for k, v := range schema {
+		copied[k] = v
+	}
+	props[name] = copied
+	return copied, true
+}
+
+func overrideText(orig, replace, appendText string) string {
+	if replace != "" {
+		orig = replace
+	}
+	if appendText != "" {
+		if orig != "" {
+			orig += "\n"
+		}
+		orig += appendText
+	}
+	return orig
+}
+
+// envList 把 env 配置转成 KEY=VALUE 形式, 按 key 排序保证启动参数稳定
+func envList(env map[string]string) []string {
+	list := make([]string, 0, len(env))
+	for k, v := range env {
+		list = append(list, k+"="+v)
+	}
+	sort.Strings(list)
+	return list
+}
@@ -0,0 +1,285 @@
+package host
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/sashabaranov/go-openai"
+)
+
+const (
+	memoryServerName      = "memory"
+	defaultMaxMemoryFacts = 50
+)
+
+// Fact 是用户让助理记住的一条信息
+type Fact struct {
+	ID        string    `json:"id"`
+	Text      string    `json:"text"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// MemoryStore 按用户保存记忆, 每个用户一个 json 文件, 每轮对话注入到系统消息中
+type MemoryStore struct {
+	dir      string
+	maxFacts int
+
+	mu     sync.Mutex
+	client *MCPClient // 进程内的 MCP 服务, 提供 memory_save / memory_list / memory_delete 工具
+}
+
+func NewMemoryStore(cfg *MemoryConfig) (*MemoryStore, error) {
+	st := &MemoryStore{dir: "data/memory", maxFacts: defaultMaxMemoryFacts}
+	if cfg.Dir != "" {
+		st.dir = cfg.Dir
+	}
+	if cfg.MaxFacts > 0 {
+		st.maxFacts = cfg.MaxFacts
+	}
+	if err := os.MkdirAll(st.dir, 0o700); err != nil {
+		return nil, err
+	}
+	c, err := st.newMCPClient()
+	if err != nil {
+		return nil, err
+	}
+	st.client = c
+	return st, nil
+}
+
+// path 用户标识可能包含任意字符, 文件名使用其哈希
+func (st *MemoryStore) path(owner string) string {
+	sum := sha256.Sum256([]byte(owner))
+	return filepath.Join(st.dir, hex.EncodeToString(sum[:16])+".json")
+}
+
+func (st *MemoryStore) load(owner string) ([]Fact, error) {
+	data, err := os.ReadFile(st.path(owner))
+	if errors.Is(err, os.ErrNotExist) {
+		return []Fact{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	facts := []Fact{}
+	if err := json.Unmarshal(data, &facts); err != nil {
+		return nil, err
+	}
+	return facts, nil
+}
+
+func (st *MemoryStore) save(owner string, facts []Fact) error {
+	data, err := json.MarshalIndent(facts, "", "  ")
+	if err != nil {
+		return err
+	}
+	// 先写临时文件再改名, 避免写到一半时进程退出损坏已有记忆
+	tmp := st.path(owner) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, st.path(owner))
+}
+
+func (st *MemoryStore) List(owner string) ([]Fact, error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.load(owner)
+}
+
+// Add 保存一条记忆, 超过上限时丢弃最早的记忆
+func (st *MemoryStore) Add(owner, text string) (Fact, error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	facts, err := st.load(owner)
+	if err != nil {
+		return Fact{}, err
+	}
+	for _, f := range facts {
+		if f.Text == text {
+			return f, nil
+		}
+	}
+	id := make([]byte, 4)
+	_, _ = rand.Read(id)
+	f := Fact{ID: hex.EncodeToString(id), Text: text, CreatedAt: time.Now().UTC()}
+	facts = append(facts, f)
+	if len(facts) > st.maxFacts {
+		facts = facts[len(facts)-st.maxFacts:]
+	}
+	return f, st.save(owner, facts)
+}
+
+// Delete 删除一条记忆, 不存在时返回 false
+func (st *MemoryStore) Delete(owner, id string) (bool, error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	facts, err := st.load(owner)
+	if err != nil {
+		return false, err
+	}
+	i := slices.IndexFunc(facts, func(f Fact) bool { return f.ID == id })
+	if i < 0 {
+		return false, nil
+	}
+	return true, st.save(owner, slices.Delete(facts, i, i+1))
+}
+
+// Replace 用 facts 替换用户的所有记忆, 用于回滚到检查点
+func (st *MemoryStore) Replace(owner string, facts []Fact) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.save(owner, facts)
+}
+
+// Clear 删除用户的所有记忆
+func (st *MemoryStore) Clear(owner string) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if err := os.Remove(st.path(owner)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+type memoryOwnerKey struct{}
+
+// withMemoryOwner 记忆工具通过 ctx 得知当前用户
+func withMemoryOwner(ctx context.Context, owner string) context.Context {
+	return context.WithValue(ctx, memoryOwnerKey{}, owner)
+}
+
+// newMCPClient 记忆工具和其他工具一样交给大模型, 用户说 "记住..." 时由大模型调用
+func (st *MemoryStore) newMCPClient() (*MCPClient, error) {
+	s := server.NewMCPServer(memoryServerName, "1.0.0")
+	withOwner := func(fn func(owner string, req mcp.CallToolRequest) (*mcp.CallToolResult, error)) server.ToolHandlerFunc {
+		return func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			owner, ok := ctx.Value(memoryOwnerKey{}).(string)
+			if !ok {
+				return mcp.NewToolResultError("memory is not available for this user"), nil
+			}
+			return fn(owner, req)
+		}
+	}
+
+	s.AddTool(mcp.NewTool("memory_save",
+		mcp.WithDescription("保存一条关于用户的长期记忆 (偏好、背景等), 以后的对话中都会提供给你。仅在用户明确要求记住某事时调用"),
+		mcp.WithString("fact", mcp.Required(), mcp.Description("要记住的信息, 用一句完整的话描述")),
+	), withOwner(func(owner string, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		text := strings.TrimSpace(req.GetString("fact", ""))
+		if text == "" {
+			return mcp.NewToolResultError("fact is required"), nil
+		}
+		f, err := st.Add(owner, text)
+		if err != nil {
+			return nil, err
+		}
+		return mcp.NewToolResultText("saved memory " + f.ID), nil
+	}))
+
+	s.AddTool(mcp.NewTool("memory_list",
+		mcp.WithDescription("列出已保存的用户记忆及其 id"),
+	), withOwner(func(owner string, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		facts, err := st.List(owner)
+		if err != nil {
+			return nil, err
+		}
+		data, _ := json.Marshal(facts)
+		return mcp.NewToolResultText(string(data)), nil
+	}))
+
+	s.AddTool(mcp.NewTool("memory_delete",
+		mcp.WithDescription("按 id 删除一条用户记忆, 用户要求忘记某事时先用 memory_list 查到 id"),
+		mcp.WithString("id", mcp.Required()),
+	), withOwner(func(owner string, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		ok, err := st.Delete(owner, req.GetString("id", ""))
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return mcp.NewToolResultError("memory not found"), nil
+		}
+		return mcp.NewToolResultText("deleted"), nil
+	}))
+
+	return newInProcessMCPClient(memoryServerName, s)
+}
+
+// memoryOwner 返回会话的记忆归属; 配置了认证时匿名会话不使用记忆,
+// 未配置认证时是单用户部署, 所有会话共用一份记忆
+func (cc *ChatClient) memoryOwner(userID string) (string, bool) {
+	if cc.memory == nil || (userID == "" && cc.auth != nil) || cc.softDeletes.hidden(userID) {
+		return "", false
+	}
+	return userID, true
+}
+
+// memoryMessage 把用户的记忆组装成系统消息
+func (cc *ChatClient) memoryMessage(sess *Session) (openai.ChatCompletionMessage, bool) {
+	owner, ok := cc.memoryOwner(sess.UserID())
+	if !ok {
+		return openai.ChatCompletionMessage{}, false
+	}
+	facts, err := cc.memory.List(owner)
+	if err != nil {
+		logf("memory.load_failed", err)
+		return openai.ChatCompletionMessage{}, false
+	}
+	if len(facts) == 0 {
+		return openai.ChatCompletionMessage{}, false
+	}
+	var b strings.Builder
+	b.WriteString(T(serverLocale, "memory.prompt"))
+	for _, f := range facts {
+		b.WriteString("\n- ")
+		b.WriteString(f.Text)
+	}
+	return openai.ChatCompletionMessage{Role: openai.ChatMessageRoleSystem, Content: b.String()}, true
+}
+
+// GET /api/memories 列出当前用户的记忆
+// DELETE /api/memories/{id} 删除一条记忆
+func (cc *ChatClient) handleMemories(w http.ResponseWriter, r *http.Request) {
+	owner, ok := cc.memoryOwner(cc.userID(r))
+	if !ok {
+		writeError(w, r, http.StatusNotFound, "api.memory_disabled")
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		facts, err := cc.memory.List(owner)
+		if err != nil {
+			logf("memory.load_failed", err)
+			writeError(w, r, http.StatusInternalServerError, "error.request_failed")
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"memories": facts})
+	case http.MethodDelete:
+		deleted, err := cc.memory.Delete(owner, r.PathValue("id"))
+		if err != nil {
+			logf("memory.save_failed", err)
+			writeError(w, r, http.StatusInternalServerError, "error.request_failed")
+			return
+		}
+		if !deleted {
+			writeError(w, r, http.StatusNotFound, "api.memory_not_found")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, r, http.StatusMethodNotAllowed, "api.method_not_allowed")
+	}
+}
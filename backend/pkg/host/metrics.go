@@ -0,0 +1,138 @@
+package host
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// metrics 是进程内的指标注册表, 以 Prometheus 文本格式通过 /metrics 输出
+var metrics = NewMetricsRegistry()
+
+type metricKind string
+
+const (
+	counterKind metricKind = "counter"
+	gaugeKind   metricKind = "gauge"
+)
+
+// MetricVec 是一组同名、按标签区分的指标
+type MetricVec struct {
+	name   string
+	help   string
+	kind   metricKind
+	labels []string
+
+	mu     sync.Mutex
+	values map[string]float64 // key 为按顺序拼接的标签值
+}
+
+type MetricsRegistry struct {
+	mu   sync.Mutex
+	vecs map[string]*MetricVec
+}
+
+func NewMetricsRegistry() *MetricsRegistry {
+	return &MetricsRegistry{vecs: make(map[string]*MetricVec)}
+}
+
+func (m *MetricsRegistry) register(name, help string, kind metricKind, labels []string) *MetricVec {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if v, ok := m.vecs[name]; ok {
+		return v
+	}
+	v := &MetricVec{name: name, help: help, kind: kind, labels: labels, values: make(map[string]float64)}
+	m.vecs[name] = v
+	return v
+}
+
+// Counter 注册 (或取出已注册的) 计数器
+func (m *MetricsRegistry) Counter(name, help string, labels ...string) *MetricVec {
+	return m.register(name, help, counterKind, labels)
+}
+
+// Gauge 注册 (或取出已注册的) 可增可减的指标
+func (m *MetricsRegistry) Gauge(name, help string, labels ...string) *MetricVec {
+	return m.register(name, help, gaugeKind, labels)
+}
+
+func (v *MetricVec) key(values []string) string {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metric %s: expected %d label values, got %d", v.name, len(v.labels), len(values)))
+	}
+	return strings.Join(values, "\x00")
+}
+
+func (v *MetricVec) Inc(labelValues ...string) {
+	v.Add(1, labelValues...)
+}
+
+func (v *MetricVec) Add(delta float64, labelValues ...string) {
+	k := v.key(labelValues)
+	v.mu.Lock()
+	v.values[k] += delta
+	v.mu.Unlock()
+}
+
+func (v *MetricVec) Set(value float64, labelValues ...string) {
+	k := v.key(labelValues)
+	v.mu.Lock()
+	v.values[k] = value
+	v.mu.Unlock()
+}
+
+// Value 读取某组标签的当前值
+func (v *MetricVec) Value(labelValues ...string) float64 {
+	k := v.key(labelValues)
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.values[k]
+}
+
+func (v *MetricVec) write(b *strings.Builder) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s %s\n", v.name, v.help, v.name, v.kind)
+	keys := make([]string, 0, len(v.values))
+	for k := range v.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		b.WriteString(v.name)
+		if len(v.labels) > 0 {
+			values := strings.Split(k, "\x00")
+			pairs := make([]string, len(v.labels))
+			for i, l := range v.labels {
+				pairs[i] = fmt.Sprintf("%s=%q", l, values[i])
+			}
+			b.WriteString("{" + strings.Join(pairs, ",") + "}")
+		}
+		fmt.Fprintf(b, " %g\n", v.values[k])
+	}
+}
+
+// ServeHTTP 输出所有指标
+func (m *MetricsRegistry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	names := make([]string, 0, len(m.vecs))
+	for name := range m.vecs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	vecs := make([]*MetricVec, len(names))
+	for i, name := range names {
+		vecs[i] = m.vecs[name]
+	}
+	m.mu.Unlock()
+
+	var b strings.Builder
+	for _, v := range vecs {
+		v.write(&b)
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_, _ = w.Write([]byte(b.String()))
+}
@@ -0,0 +1,154 @@
+package host
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+var ipDenied = metrics.Counter("ip_denied_total", "Number of requests denied by IP allow/deny lists.", "scope")
+
+// ipList 是 IP 地址和 CIDR 网段的列表
+type ipList []netip.Prefix
+
+// parseIPList 解析 IP 地址 (视为单个地址的网段) 或 CIDR 网段, 返回第一个无效的条目的序号
+func parseIPList(items []string) (ipList, int, error) {
+	list := make(ipList, 0, len(items))
+	for i, item := range items {
+		item = strings.TrimSpace(item)
+		if strings.Contains(item, "/") {
+			p, err := netip.ParsePrefix(item)
+			if err != nil {
+				return nil, i, err
+			}
+			list = append(list, p.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(item)
+		if err != nil {
+			return nil, i, err
+		}
+		addr = addr.Unmap()
+		list = append(list, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return list, -1, nil
+}
+
+func (l ipList) contains(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, p := range l {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// ipAccess 是一组接口的 IP 访问控制: 命中 deny 的拒绝; 配置了 allow 时只允许其中的地址
+type ipAccess struct {
+	allow, deny ipList
+}
+
+func (a *ipAccess) allowed(ip string) bool {
+	if a == nil {
+		return true
+	}
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	if a.deny.contains(addr) {
+		return false
+	}
+	return len(a.allow) == 0 || a.allow.contains(addr)
+}
+
+// networkPolicy 是 network 配置解析后的结果, 为 nil 时不信任任何代理, 也不限制来源地址
+type networkPolicy struct {
+	trusted ipList
+	ws      *ipAccess
+	admin   *ipAccess
+}
+
+// newNetworkPolicy 配置在加载时已经校验过, 这里不会出错
+func newNetworkPolicy(cfg *NetworkConfig) *networkPolicy {
+	if cfg == nil {
+		return nil
+	}
+	p := &networkPolicy{}
+	p.trusted, _, _ = parseIPList(cfg.TrustedProxies)
+	p.ws = newIPAccess(cfg.WebSocket)
+	p.admin = newIPAccess(cfg.Admin)
+	return p
+}
+
+func newIPAccess(cfg *IPAccessConfig) *ipAccess {
+	if cfg == nil {
+		return nil
+	}
+	a := &ipAccess{}
+	a.allow, _, _ = parseIPList(cfg.Allow)
+	a.deny, _, _ = parseIPList(cfg.Deny)
+	return a
+}
+
+// clientIP 返回请求的客户端地址。直接连接的一方是受信任的代理时, 从 X-Forwarded-For 的最右边开始
+// 跳过受信任的代理, 第一个不受信任的地址就是客户端 (更左边的地址可能是客户端伪造的); 没有该请求头时使用 X-Real-IP
+func (p *networkPolicy) clientIP(r *http.Request) string {
+	remote := remoteHost(r)
+	if !p.fromTrustedProxy(r) {
+		return remote
+	}
+
+	var hops []string
+	for _, h := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(h, ",")...)
+	}
+	client := ""
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break
+		}
+		client = addr.Unmap().String()
+		if !p.trusted.contains(addr) {
+			return client
+		}
+	}
+	if client != "" {
+		return client // 全部是受信任的代理, 取最左边的
+	}
+	if addr, err := netip.ParseAddr(strings.TrimSpace(r.Header.Get("X-Real-IP"))); err == nil {
+		return addr.Unmap().String()
+	}
+	return remote
+}
+
+// fromTrustedProxy 直接连接的一方是受信任的代理时返回 true, 只有这时才采信代理设置的请求头; p 为 nil 时不信任任何代理
+func (p *networkPolicy) fromTrustedProxy(r *http.Request) bool {
+	addr, err := netip.ParseAddr(remoteHost(r))
+	return p != nil && err == nil && p.trusted.contains(addr)
+}
+
+// remoteHost 返回直接连接的一方的地址, 不含端口
+func remoteHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func (p *networkPolicy) wsAllowed(ip string) bool {
+	return p == nil || p.ws.allowed(ip)
+}
+
+func (p *networkPolicy) adminAllowed(ip string) bool {
+	return p == nil || p.admin.allowed(ip)
+}
+
+// clientIP 返回请求的客户端地址, 见 networkPolicy.clientIP
+func (cc *ChatClient) clientIP(r *http.Request) string {
+	return cc.network.clientIP(r)
+}
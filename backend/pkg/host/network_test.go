@@ -0,0 +1,48 @@
+package host
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	p := newNetworkPolicy(&NetworkConfig{TrustedProxies: []string{"10.0.0.0/8", "2001:db8::/32"}})
+	tests := []struct {
+		name   string
+		policy *networkPolicy
+		remote string
+		xff    []string
+		realIP string
+		want   string
+	}{
+		{name: "no policy", policy: nil, remote: "10.0.0.1:1234", xff: []string{"198.51.100.7"}, want: "10.0.0.1"},
+		{name: "untrusted peer", policy: p, remote: "203.0.113.9:1234", xff: []string{"198.51.100.7"}, realIP: "198.51.100.8", want: "203.0.113.9"},
+		{name: "single hop", policy: p, remote: "10.0.0.1:1234", xff: []string{"198.51.100.7"}, want: "198.51.100.7"},
+		{name: "spoofed left entries", policy: p, remote: "10.0.0.1:1234", xff: []string{"1.1.1.1, 198.51.100.7, 10.0.0.2"}, want: "198.51.100.7"},
+		{name: "multiple headers", policy: p, remote: "10.0.0.1:1234", xff: []string{"1.1.1.1, 198.51.100.7", "10.0.0.3,10.0.0.2"}, want: "198.51.100.7"},
+		{name: "all trusted", policy: p, remote: "10.0.0.1:1234", xff: []string{"10.0.0.3, 10.0.0.2"}, want: "10.0.0.3"},
+		{name: "invalid hop stops the walk", policy: p, remote: "10.0.0.1:1234", xff: []string{"198.51.100.7, unknown, 10.0.0.2"}, want: "10.0.0.2"},
+		{name: "invalid only", policy: p, remote: "10.0.0.1:1234", xff: []string{"unknown"}, want: "10.0.0.1"},
+		{name: "mapped ipv4", policy: p, remote: "10.0.0.1:1234", xff: []string{"::ffff:198.51.100.7"}, want: "198.51.100.7"},
+		{name: "ipv6 proxy", policy: p, remote: "[2001:db8::1]:443", xff: []string{"2001:db8:ffff::1, 2001:db8::2"}, want: "2001:db8:ffff::1"},
+		{name: "ipv6 client", policy: p, remote: "[2001:db8::1]:443", xff: []string{"2400:cb00::1"}, want: "2400:cb00::1"},
+		{name: "x-real-ip", policy: p, remote: "10.0.0.1:1234", realIP: "198.51.100.8", want: "198.51.100.8"},
+		{name: "xff before x-real-ip", policy: p, remote: "10.0.0.1:1234", xff: []string{"198.51.100.7"}, realIP: "198.51.100.8", want: "198.51.100.7"},
+		{name: "invalid x-real-ip", policy: p, remote: "10.0.0.1:1234", realIP: "nope", want: "10.0.0.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/ws", nil)
+			r.RemoteAddr = tt.remote
+			for _, h := range tt.xff {
+				r.Header.Add("X-Forwarded-For", h)
+			}
+			if tt.realIP != "" {
+				r.Header.Set("X-Real-IP", tt.realIP)
+			}
+			if got := tt.policy.clientIP(r); got != tt.want {
+				t.Errorf("clientIP = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,195 @@
+package host
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+const (
+	idTokenCookie = "mcp_id_token"
+	stateCookie   = "mcp_oidc_state"
+	nonceCookie   = "mcp_oidc_nonce"
+)
+
+// OIDCAuth 实现授权码登录: 登录成功后把 ID token 保存在 HttpOnly cookie 中,
+// 之后每个请求都校验 ID token 并从 claim 中取得用户和角色, 服务端不保存登录状态
+type OIDCAuth struct {
+	cfg      *OIDCConfig
+	oauth2   oauth2.Config
+	verifier *oidc.IDTokenVerifier
+}
+
+// NewOIDCAuth 启动时从 issuer 获取 OIDC 元数据, 失败时返回错误
+func NewOIDCAuth(ctx context.Context, cfg *OIDCConfig) (*OIDCAuth, error) {
+	provider, err := oidc.NewProvider(ctx, cfg.Issuer)
+	if err != nil {
+		return nil, newError("oidc.discovery_failed", cfg.Issuer, err)
+	}
+	secret := os.Getenv(cfg.ClientSecretEnv)
+	if secret == "" {
+		return nil, newError("oidc.secret_missing", cfg.ClientSecretEnv)
+	}
+	return &OIDCAuth{
+		cfg: cfg,
+		oauth2: oauth2.Config{
+			ClientID:     cfg.ClientID,
+			ClientSecret: secret,
+			Endpoint:     provider.Endpoint(),
+			RedirectURL:  cfg.RedirectURL,
+			Scopes:       cfg.Scopes,
+		},
+		verifier: provider.Verifier(&oidc.Config{ClientID: cfg.ClientID}),
+	}, nil
+}
+
+// identity 从 cookie 或 Authorization: Bearer 中取 ID token 并校验, 无效时为匿名
+func (a *OIDCAuth) identity(r *http.Request) identity {
+	raw, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		c, err := r.Cookie(idTokenCookie)
+		if err != nil {
+			return identity{}
+		}
+		raw = c.Value
+	}
+	token, err := a.verifier.Verify(r.Context(), raw)
+	if err != nil {
+		return identity{}
+	}
+	return a.claims(token)
+}
+
+func (a *OIDCAuth) claims(token *oidc.IDToken) identity {
+	var claims map[string]any
+	if err := token.Claims(&claims); err != nil {
+		return identity{}
+	}
+	id := identity{user: claimString(claims[a.cfg.UserClaim])}
+	if a.cfg.RoleClaim != "" {
+		switch v := claims[a.cfg.RoleClaim].(type) {
+		case string:
+			id.groups = []string{v}
+		case []any:
+			for _, g := range v {
+				id.groups = append(id.groups, claimString(g))
+			}
+		}
+	}
+	return id
+}
+
+func claimString(v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case nil:
+		return ""
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// GET /auth/login 跳转到身份提供方登录
+func (a *OIDCAuth) handleLogin(w http.ResponseWriter, r *http.Request) {
+	state, nonce := randomToken(), randomToken()
+	setAuthCookie(w, r, stateCookie, state, 10*time.Minute)
+	setAuthCookie(w, r, nonceCookie, nonce, 10*time.Minute)
+	http.Redirect(w, r, a.oauth2.AuthCodeURL(state, oidc.Nonce(nonce)), http.StatusFound)
+}
+
+// GET /auth/callback 用授权码换取 ID token, 校验后写入 cookie 并跳回前端
+func (a *OIDCAuth) handleCallback(w http.ResponseWriter, r *http.Request) {
+	state, err := r.Cookie(stateCookie)
+	if err != nil || r.URL.Query().Get("state") != state.Value {
+		writeError(w, r, http.StatusBadRequest, "api.login_failed")
+		return
+	}
+	token, err := a.oauth2.Exchange(r.Context(), r.URL.Query().Get("code"))
+	if err != nil {
+		logf("oidc.exchange_failed", err)
+		writeError(w, r, http.StatusUnauthorized, "api.login_failed")
+		return
+	}
+	raw, _ := token.Extra("id_token").(string)
+	idToken, err := a.verifier.Verify(r.Context(), raw)
+	if err != nil {
+		logf("oidc.verify_failed", err)
+		writeError(w, r, http.StatusUnauthorized, "api.login_failed")
+		return
+	}
+	if nonce, err := r.Cookie(nonceCookie); err != nil || idToken.Nonce != nonce.Value {
+		writeError(w, r, http.StatusUnauthorized, "api.login_failed")
+		return
+	}
+	id := a.claims(idToken)
+	if id.user == "" {
+		logf("oidc.user_claim_missing", a.cfg.UserClaim)
+		writeError(w, r, http.StatusUnauthorized, "api.login_failed")
+		return
+	}
+	logf("oidc.logged_in", id.user)
+
+	setAuthCookie(w, r, stateCookie, "", -1)
+	setAuthCookie(w, r, nonceCookie, "", -1)
+	setAuthCookie(w, r, idTokenCookie, raw, time.Until(idToken.Expiry))
+	http.Redirect(w, r, a.cfg.FrontendURL, http.StatusFound)
+}
+
+// GET /auth/logout 清除登录状态
+func (a *OIDCAuth) handleLogout(w http.ResponseWriter, r *http.Request) {
+	setAuthCookie(w, r, idTokenCookie, "", -1)
+	http.Redirect(w, r, a.cfg.FrontendURL, http.StatusFound)
+}
+
+// setAuthCookie 使用 SameSite=Lax, 其他站点的页面发起的请求和 WebSocket 连接不会带上 cookie
+func setAuthCookie(w http.ResponseWriter, r *http.Request, name, value string, maxAge time.Duration) {
+	c := &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	}
+	if maxAge < 0 {
+		c.MaxAge = -1
+	} else {
+		c.MaxAge = int(maxAge.Seconds())
+	}
+	http.SetCookie(w, c)
+}
+
+// urlOrigin 取 URL 的 scheme://host 部分, 相对地址返回空字符串
+func urlOrigin(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return ""
+	}
+	return u.Scheme + "://" + u.Host
+}
+
+func randomToken() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// GET /api/me 返回当前用户和角色; 启用了 OIDC 但未登录时返回 401, 前端据此跳转到登录页
+func (cc *ChatClient) handleMe(w http.ResponseWriter, r *http.Request) {
+	user := cc.userID(r)
+	if cc.oidc != nil && user == "" {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"login": "/auth/login"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"user": user, "role": cc.role(r)})
+}
@@ -0,0 +1,374 @@
+package host
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// REST 接口的 OpenAPI 3 文档: 每个接口在 apiOperations 中登记一次, 请求和响应的 schema 由 Go 类型反射生成,
+// 通过 GET /api/openapi.json 提供, 客户端可以据此生成 SDK。新增接口时在这里补充登记
+
+// apiOperation 描述一个接口
+type apiOperation struct {
+	Method    string
+	Path      string
+	Summary   string
+	Role      string            // 需要的最低角色, 空表示不限制
+	Query     map[string]string // 查询参数和说明
+	Body      any               // JSON 请求体的类型
+	Multipart []string          // multipart 表单的字段
+	Response  any               // 成功时的 JSON 响应类型, 为 nil 时没有响应体
+	Status    int               // 成功的状态码, 缺省 200
+	Produces  string            // 响应不是 JSON 时的类型, 比如附件下载
+}
+
+// 以下类型只用于描述 handler 中以 map 写出的响应
+type (
+	pinsResponse struct {
+		Pins []int `json:"pins"`
+	}
+	pinRequest struct {
+		Index int `json:"index"`
+	}
+	checkpointsResponse struct {
+		Checkpoints []Checkpoint `json:"checkpoints"`
+	}
+	checkpointRequest struct {
+		Name string `json:"name"`
+	}
+	rollbackResponse struct {
+		Checkpoint Checkpoint `json:"checkpoint"`
+		Removed    int        `json:"removed"` // 删除的消息数
+	}
+	approvalRequest struct {
+		Approved bool `json:"approved"`
+	}
+	elicitationRequest struct {
+		Action  string         `json:"action"`            // accept | decline | cancel
+		Content map[string]any `json:"content,omitempty"` // accept 时符合请求 schema 的回答
+	}
+	participantsResponse struct {
+		Owner        string   `json:"owner"`
+		Participants []string `json:"participants"`
+	}
+	participantRequest struct {
+		User string `json:"user"`
+	}
+	resumeResponse struct {
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+	uploadResponse struct {
+		SessionID string    `json:"session_id"`
+		Files     []*Upload `json:"files"`
+	}
+	transcribeResponse struct {
+		Text string `json:"text"`
+	}
+	searchResponse struct {
+		Query string      `json:"query"`
+		Hits  []SearchHit `json:"hits"`
+	}
+	digestsResponse struct {
+		Date    string   `json:"date"`
+		Digests []Digest `json:"digests"`
+	}
+	sessionDigestsResponse struct {
+		SessionID string   `json:"session_id"`
+		Digests   []Digest `json:"digests"`
+	}
+	toolAnalyticsResponse struct {
+		Since time.Time   `json:"since"`
+		Tools []ToolUsage `json:"tools"`
+	}
+	promptsResponse struct {
+		Prompts []Prompt `json:"prompts"`
+	}
+	renderResponse struct {
+		Text string `json:"text"`
+	}
+	memoriesResponse struct {
+		Memories []Fact `json:"memories"`
+	}
+	resourceTemplatesResponse struct {
+		Templates []ResourceTemplate `json:"templates"`
+	}
+	meResponse struct {
+		User string `json:"user"`
+		Role string `json:"role"`
+	}
+	statusResponse struct {
+		Servers []ServerStatus `json:"servers"`
+		LLMOnly bool           `json:"llm_only"`
+	}
+	errorResponse struct {
+		Error string `json:"error"` // 按请求的语言本地化的错误信息
+	}
+)
+
+var apiOperations = []apiOperation{
+	{Method: "GET", Path: "/api/sessions/{id}/messages", Summary: "分页查询会话历史",
+		Query:    map[string]string{"offset": "跳过的消息数", "limit": "每页消息数, 缺省 50", "role": "按角色过滤", "tool": "只返回与该工具相关的消息"},
+		Response: messagesPage{}},
+	{Method: "GET", Path: "/api/sessions/{id}/pins", Summary: "列出固定的消息序号", Role: RoleUser, Response: pinsResponse{}},
+	{Method: "POST", Path: "/api/sessions/{id}/pins", Summary: "固定一条消息, 裁剪上下文时始终保留", Role: RoleUser, Body: pinRequest{}, Response: pinsResponse{}},
+	{Method: "DELETE", Path: "/api/sessions/{id}/pins/{index}", Summary: "取消固定", Role: RoleUser, Status: http.StatusNoContent},
+	{Method: "GET", Path: "/api/sessions/{id}/checkpoints", Summary: "列出会话的检查点", Role: RoleUser, Response: checkpointsResponse{}},
+	{Method: "POST", Path: "/api/sessions/{id}/checkpoints", Summary: "在当前位置创建检查点, 同名的被替换", Role: RoleUser, Body: checkpointRequest{}, Response: Checkpoint{}, Status: http.StatusCreated},
+	{Method: "DELETE", Path: "/api/sessions/{id}/checkpoints/{name}", Summary: "删除检查点", Role: RoleUser, Status: http.StatusNoContent},
+	{Method: "POST", Path: "/api/sessions/{id}/checkpoints/{name}/rollback", Summary: "回滚到检查点: 删除之后的消息, 恢复草稿和记忆", Role: RoleUser, Response: rollbackResponse{}},
+	{Method: "POST", Path: "/api/sessions/{id}/approvals/{approval}", Summary: "批准或拒绝等待批准的工具调用, approval 为 approval_request 消息中的 id", Role: RoleUser,
+		Body: approvalRequest{}, Status: http.StatusNoContent},
+	{Method: "POST", Path: "/api/sessions/{id}/elicitations/{elicitation}", Summary: "回复 MCP 服务索取信息的请求, elicitation 为 elicitation_request 消息中的 id", Role: RoleUser,
+		Body: elicitationRequest{}, Status: http.StatusNoContent},
+	{Method: "GET", Path: "/api/sessions/{id}/participants", Summary: "列出会话的所有者和参与者", Role: RoleUser, Response: participantsResponse{}},
+	{Method: "POST", Path: "/api/sessions/{id}/participants", Summary: "邀请用户参与对话", Role: RoleUser, Body: participantRequest{}, Response: participantsResponse{}},
+	{Method: "DELETE", Path: "/api/sessions/{id}/participants/{user}", Summary: "移除参与者", Role: RoleUser, Status: http.StatusNoContent},
+	{Method: "GET", Path: "/api/sessions/{id}/digests", Summary: "会话的定期摘要", Response: sessionDigestsResponse{}},
+	{Method: "POST", Path: "/api/sessions/{id}/resume", Summary: "签发转移令牌, 另一台设备凭令牌接着对话", Role: RoleUser, Response: resumeResponse{}},
+	{Method: "GET", Path: "/api/artifacts/{id}", Summary: "下载工具生成的附件", Produces: "application/octet-stream"},
+	{Method: "POST", Path: "/api/upload", Summary: "上传附件", Role: RoleUser,
+		Query: map[string]string{"session_id": "会话 id, 也可以放在表单中 (必须在文件之前)"}, Multipart: []string{"session_id", "file"},
+		Response: uploadResponse{}},
+	{Method: "POST", Path: "/api/transcribe", Summary: "语音转文字", Role: RoleUser, Multipart: []string{"file"}, Response: transcribeResponse{}},
+	{Method: "GET", Path: "/api/experiments", Summary: "A/B 实验各分组的汇总数据", Role: RoleAdmin, Response: []experimentStats{}},
+	{Method: "GET", Path: "/api/search", Summary: "全文搜索会话消息",
+		Query:    map[string]string{"q": "关键词", "session_id": "只搜索该会话, 匿名用户必填", "limit": "最多返回的条数, 缺省 50"},
+		Response: searchResponse{}},
+	{Method: "GET", Path: "/api/memories", Summary: "列出当前用户的记忆", Response: memoriesResponse{}},
+	{Method: "DELETE", Path: "/api/memories/{id}", Summary: "删除一条记忆", Status: http.StatusNoContent},
+	{Method: "GET", Path: "/api/prompts", Summary: "列出当前用户的提示词模板", Response: promptsResponse{}},
+	{Method: "GET", Path: "/api/prompts/{name}", Summary: "取一个提示词模板", Response: Prompt{}},
+	{Method: "PUT", Path: "/api/prompts/{name}", Summary: "新建 (201) 或替换提示词模板, 模板中的 {{变量}} 在使用时替换", Body: promptRequest{}, Response: Prompt{}},
+	{Method: "DELETE", Path: "/api/prompts/{name}", Summary: "删除提示词模板", Status: http.StatusNoContent},
+	{Method: "POST", Path: "/api/prompts/{name}/render", Summary: "替换模板变量, 返回得到的文本", Body: renderRequest{}, Response: renderResponse{}},
+	{Method: "GET", Path: "/api/me", Summary: "当前用户和角色", Response: meResponse{}},
+	{Method: "GET", Path: "/api/resources/templates", Summary: "各 MCP 服务的资源模板, 用于补全资源引用", Role: RoleUser, Response: resourceTemplatesResponse{}},
+	{Method: "POST", Path: "/api/complete", Summary: "向 MCP 服务请求资源模板变量或提示词参数的补全候选 (completion/complete)", Role: RoleUser,
+		Body: completeRequest{}, Response: completeResponse{}},
+	{Method: "GET", Path: "/api/digests", Summary: "导出某一天生成的会话摘要", Role: RoleAdmin,
+		Query: map[string]string{"date": "日期 (UTC), 形如 2024-05-01, 缺省为今天"}, Response: digestsResponse{}},
+	{Method: "DELETE", Path: "/api/users/{id}/data", Summary: "清除一个用户的会话、附件、上传的文件、记忆、模板、摘要和搜索索引", Role: RoleAdmin,
+		Query: map[string]string{"dry_run": "为 1 时只返回将要清除的内容", "immediate": "配置了 purge 时默认软删除 (返回 202), 为 1 时立即彻底清除"}, Response: PurgeReport{}},
+	{Method: "POST", Path: "/api/users/{id}/data/restore", Summary: "恢复软删除、还没有彻底清除的用户数据", Role: RoleAdmin, Status: http.StatusNoContent},
+	{Method: "GET", Path: "/api/analytics/tools", Summary: "本副本启动以来各工具的调用次数、成功率、耗时和常见问题", Role: RoleAdmin,
+		Query: map[string]string{"format": "为 csv 时返回 csv 文件"}, Response: toolAnalyticsResponse{}},
+	{Method: "GET", Path: "/api/status", Summary: "MCP 服务的健康状态", Role: RoleAdmin, Response: statusResponse{}},
+	{Method: "GET", Path: "/api/schema", Summary: "WebSocket 消息的 JSON Schema (按 protobuf 的 JSON 映射)", Response: map[string]any{}},
+	{Method: "GET", Path: "/api/schema/chat.proto", Summary: "服务端使用的 chat.proto 原文", Produces: "text/plain"},
+}
+
+var (
+	openAPIOnce sync.Once
+	openAPIDoc  []byte
+)
+
+// GET /api/openapi.json
+func (cc *ChatClient) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	openAPIOnce.Do(func() {
+		openAPIDoc, _ = json.MarshalIndent(buildOpenAPI(apiOperations), "", "  ")
+	})
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openAPIDoc)
+}
+
+var pathParam = regexp.MustCompile(`\{(\w+)\}`)
+
+// buildOpenAPI 按登记的接口生成 OpenAPI 3 文档
+func buildOpenAPI(ops []apiOperation) map[string]any {
+	b := &openAPIBuilder{schemas: map[string]any{}}
+	errorRef := b.schema(reflect.TypeOf(errorResponse{}))
+	paths := map[string]map[string]any{}
+	for _, op := range ops {
+		var params []any
+		for _, m := range pathParam.FindAllStringSubmatch(op.Path, -1) {
+			params = append(params, map[string]any{"name": m[1], "in": "path", "required": true, "schema": map[string]any{"type": "string"}})
+		}
+		for _, name := range sortedKeys(op.Query) {
+			params = append(params, map[string]any{"name": name, "in": "query", "description": op.Query[name], "schema": map[string]any{"type": "string"}})
+		}
+
+		status := op.Status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		success := map[string]any{"description": http.StatusText(status)}
+		switch {
+		case op.Produces != "":
+			success["content"] = map[string]any{op.Produces: map[string]any{"schema": map[string]any{"type": "string", "format": "binary"}}}
+		case op.Response != nil:
+			success["content"] = jsonContent(b.schema(reflect.TypeOf(op.Response)))
+		}
+		operation := map[string]any{
+			"summary":     op.Summary,
+			"operationId": operationID(op),
+			"responses": map[string]any{
+				strconv.Itoa(status): success,
+				"default":            map[string]any{"description": "错误", "content": jsonContent(errorRef)},
+			},
+		}
+		if len(params) > 0 {
+			operation["parameters"] = params
+		}
+		if op.Role != "" {
+			operation["description"] = "需要 " + op.Role + " 及以上角色"
+			operation["x-required-role"] = op.Role
+		}
+		if op.Body != nil {
+			operation["requestBody"] = map[string]any{"required": true, "content": jsonContent(b.schema(reflect.TypeOf(op.Body)))}
+		}
+		if len(op.Multipart) > 0 {
+			props := map[string]any{}
+			for _, f := range op.Multipart {
+				props[f] = map[string]any{"type": "string"}
+			}
+			props["file"] = map[string]any{"type": "string", "format": "binary"}
+			operation["requestBody"] = map[string]any{"required": true, "content": map[string]any{
+				"multipart/form-data": map[string]any{"schema": map[string]any{"type": "object", "properties": props}},
+			}}
+		}
+		if paths[op.Path] == nil {
+			paths[op.Path] = map[string]any{}
+		}
+		paths[op.Path][strings.ToLower(op.Method)] = operation
+	}
+	return map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":       "MCP Host Web",
+			"version":     "1.0.0",
+			"description": "MCP Host Web 的 REST 接口。对话通过 WebSocket (/ws, protobuf 消息见 /api/schema/chat.proto) 进行, 不在本文档中",
+		},
+		"paths":      paths,
+		"components": map[string]any{"schemas": b.schemas},
+	}
+}
+
+func jsonContent(schema any) map[string]any {
+	return map[string]any{"application/json": map[string]any{"schema": schema}}
+}
+
+// operationID 由方法和路径生成, 比如 DELETE /api/sessions/{id}/pins/{index} 为 deleteSessionsPinsByIndex
+func operationID(op apiOperation) string {
+	var b strings.Builder
+	b.WriteString(strings.ToLower(op.Method))
+	for _, part := range strings.Split(strings.TrimPrefix(op.Path, "/api/"), "/") {
+		if m := pathParam.FindStringSubmatch(part); m != nil {
+			if part == "{id}" {
+				continue
+			}
+			b.WriteString("By")
+			part = m[1]
+		}
+		b.WriteString(exportName(part))
+	}
+	return b.String()
+}
+
+func exportName(s string) string {
+	if s == "" {
+		return s
+	}
+	r := []rune(s)
+	r[0] = unicode.ToUpper(r[0])
+	return string(r)
+}
+
+// openAPIBuilder 把 Go 类型转换为 schema, 具名的结构体放到 components.schemas 中用 $ref 引用
+type openAPIBuilder struct {
+	schemas map[string]any
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func (b *openAPIBuilder) schema(t reflect.Type) map[string]any {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == timeType {
+		return map[string]any{"type": "string", "format": "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return map[string]any{"type": "integer", "format": "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return map[string]any{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]any{"type": "string", "format": "byte"}
+		}
+		return map[string]any{"type": "array", "items": b.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": b.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return b.object(t)
+		}
+		name := exportName(t.Name())
+		ref := map[string]any{"$ref": "#/components/schemas/" + name}
+		if _, ok := b.schemas[name]; !ok {
+			b.schemas[name] = map[string]any{} // 先占位, 处理自引用的类型
+			b.schemas[name] = b.object(t)
+		}
+		return ref
+	}
+	return map[string]any{}
+}
+
+// object 按 json 标签生成结构体的 schema, 没有 omitempty 的字段为必填
+func (b *openAPIBuilder) object(t reflect.Type) map[string]any {
+	props := map[string]any{}
+	var required []string
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" && indirect(f.Type).Kind() == reflect.Struct {
+			// 嵌入的结构体展开到当前对象
+			if embedded, ok := b.object(indirect(f.Type))["properties"].(map[string]any); ok {
+				for k, v := range embedded {
+					props[k] = v
+				}
+			}
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		props[name] = b.schema(f.Type)
+		if !strings.Contains(opts, "omitempty") {
+			required = append(required, name)
+		}
+	}
+	out := map[string]any{"type": "object", "properties": props}
+	if len(required) > 0 {
+		out["required"] = required
+	}
+	return out
+}
+
+func indirect(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t
+}
@@ -0,0 +1,53 @@
+package host
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// errTurnTimeout 是本轮总超时的 cause, 用来区分客户端断开等其他取消
+var errTurnTimeout = errors.New("turn timeout")
+
+// turnProgress 记录本轮已经得到的内容, 总超时时据此给出不完整的回答
+type turnProgress struct {
+	text    []string // 大模型已经给出的文字回答
+	results []string // 已经完成的工具调用结果
+	tool    string   // 正在调用的工具, 为空表示在等待大模型
+}
+
+func timedOut(ctx context.Context) bool {
+	return errors.Is(context.Cause(ctx), errTurnTimeout)
+}
+
+// partialResponse 本轮超过 turnTimeout 时把已经得到的内容作为回答写入历史, 并注明在哪一步超时,
+// 而不是返回没有说明的 context deadline exceeded
+func (cc *ChatClient) partialResponse(ctx context.Context, sess *Session, progress *turnProgress) (string, error) {
+	locale := clientInfoFrom(ctx).locale
+	stage := progress.tool
+	marker := T(locale, "chat.partial_model", cc.turnTimeout)
+	if stage != "" {
+		marker = T(locale, "chat.partial_tool", stage, cc.turnTimeout)
+	} else {
+		stage = "llm"
+	}
+	logf("chat.turn_timeout", logTag(ctx, sess.ID), stage)
+	cc.events.Publish(EventError, sess.ID, traceData(ctx, map[string]any{"stage": "timeout", "during": stage}))
+
+	parts := progress.text
+	if len(parts) == 0 {
+		parts = progress.results
+	}
+	response, err := cc.policy.Apply(policyOutput, cc.leaks.mask(ctx, sess.ID, strings.Join(append(slices.Clip(parts), marker), "\n\n")))
+	if err != nil {
+		return "", err
+	}
+	sess.Append(openai.ChatCompletionMessage{
+		Role:    openai.ChatMessageRoleAssistant,
+		Content: response,
+	})
+	return response, nil
+}
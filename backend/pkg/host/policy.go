@@ -0,0 +1,120 @@
+package host
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+)
+
+const (
+	policyInput  = "input"  // 用户输入
+	policyOutput = "output" // 模型输出
+
+	policyBlock = "block" // 拒绝整条消息
+	policyMask  = "mask"  // 替换匹配到的内容
+	policyLog   = "log"   // 只记录日志和指标
+)
+
+const defaultMaskReplacement = "****"
+
+var policyMatches = metrics.Counter("policy_matches_total", "Number of content policy rule matches.", "rule", "direction", "action")
+
+// PolicyConfig 是策略文件的结构, 规则按顺序执行
+type PolicyConfig struct {
+	Rules []PolicyRule `json:"rules"`
+}
+
+type PolicyRule struct {
+	Name        string   `json:"name"`
+	Pattern     string   `json:"pattern"`
+	ApplyTo     []string `json:"applyTo,omitempty"` // input / output, 缺省两者都检查
+	Action      string   `json:"action"`            // block / mask / log
+	Replacement string   `json:"replacement,omitempty"`
+
+	re *regexp.Regexp
+}
+
+// Policy 对用户输入和模型输出做正则过滤
+type Policy struct {
+	rules []PolicyRule
+}
+
+// PolicyViolation 表示内容被 block 规则拦截
+type PolicyViolation struct {
+	Rule      string
+	Direction string
+}
+
+func (e *PolicyViolation) Error() string {
+	return T(serverLocale, "policy.blocked", e.Rule)
+}
+
+// LoadPolicy 读取并校验策略文件, 正则表达式错误带行列号
+func LoadPolicy(file string) (*Policy, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := newConfigDoc(file, data)
+	if err != nil {
+		return nil, err
+	}
+	var cfg PolicyConfig
+	if errs := doc.decode(&cfg); len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	var errs []error
+	for i := range cfg.Rules {
+		rule := &cfg.Rules[i]
+		path := fmt.Sprintf("rules[%d]", i)
+		if rule.Name == "" {
+			errs = append(errs, doc.errorAt(path+".name", -1, doc.t("config.required")))
+		}
+		if rule.re, err = regexp.Compile(rule.Pattern); err != nil || rule.Pattern == "" {
+			errs = append(errs, doc.errorAt(path+".pattern", -1, doc.t("policy.bad_pattern", rule.Pattern)))
+		}
+		if !slices.Contains([]string{policyBlock, policyMask, policyLog}, rule.Action) {
+			errs = append(errs, doc.errorAt(path+".action", -1, doc.t("policy.bad_action", rule.Action)))
+		}
+		if len(rule.ApplyTo) == 0 {
+			rule.ApplyTo = []string{policyInput, policyOutput}
+		}
+		for _, d := range rule.ApplyTo {
+			if d != policyInput && d != policyOutput {
+				errs = append(errs, doc.errorAt(path+".applyTo", -1, doc.t("policy.bad_direction", d)))
+			}
+		}
+		if rule.Action == policyMask && rule.Replacement == "" {
+			rule.Replacement = defaultMaskReplacement
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return &Policy{rules: cfg.Rules}, nil
+}
+
+// Apply 按顺序执行规则, 返回处理后的文本; 命中 block 规则时返回 *PolicyViolation
+// 没有配置策略时 (p 为 nil) 原样返回
+func (p *Policy) Apply(direction, text string) (string, error) {
+	if p == nil {
+		return text, nil
+	}
+	for _, rule := range p.rules {
+		if !slices.Contains(rule.ApplyTo, direction) || !rule.re.MatchString(text) {
+			continue
+		}
+		policyMatches.Inc(rule.Name, direction, rule.Action)
+		logf("policy.matched", rule.Name, direction, rule.Action)
+		switch rule.Action {
+		case policyBlock:
+			return "", &PolicyViolation{Rule: rule.Name, Direction: direction}
+		case policyMask:
+			text = rule.re.ReplaceAllString(text, rule.Replacement)
+		}
+	}
+	return text, nil
+}
@@ -0,0 +1,118 @@
+package host
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+const defaultHealthCheckInterval = 30 * time.Second
+
+var (
+	poolHealthy  = metrics.Gauge("mcp_pool_healthy_connections", "Number of healthy pooled connections per MCP server.", "server")
+	poolInFlight = metrics.Gauge("mcp_pool_in_flight", "Number of in-flight tool calls per MCP server.", "server")
+)
+
+// clientPool 为 http / sse 服务维护多个连接, 工具调用分摊到负载最小的健康连接上
+type clientPool struct {
+	name    string
+	members []*poolMember
+	next    atomic.Uint64 // 负载相同时轮询的起点
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+type poolMember struct {
+	*client.Client
+	healthy  atomic.Bool
+	inFlight atomic.Int64
+}
+
+func newClientPool(name string, clients []*client.Client, interval time.Duration) *clientPool {
+	p := &clientPool{name: name, stop: make(chan struct{})}
+	for _, c := range clients {
+		m := &poolMember{Client: c}
+		m.healthy.Store(true)
+		p.members = append(p.members, m)
+	}
+	poolHealthy.Set(float64(len(p.members)), name)
+
+	if interval <= 0 {
+		interval = defaultHealthCheckInterval
+	}
+	p.wg.Add(1)
+	go p.healthLoop(interval)
+	return p
+}
+
+// pick 选出正在处理的请求最少的健康连接, 全部不健康时仍然尝试负载最小的连接
+func (p *clientPool) pick() *poolMember {
+	start := int(p.next.Add(1))
+	var best *poolMember
+	for i := range p.members {
+		m := p.members[(start+i)%len(p.members)]
+		if best == nil ||
+			(m.healthy.Load() && !best.healthy.Load()) ||
+			(m.healthy.Load() == best.healthy.Load() && m.inFlight.Load() < best.inFlight.Load()) {
+			best = m
+		}
+	}
+	return best
+}
+
+func (p *clientPool) CallTool(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	m := p.pick()
+	m.inFlight.Add(1)
+	poolInFlight.Add(1, p.name)
+	defer func() {
+		m.inFlight.Add(-1)
+		poolInFlight.Add(-1, p.name)
+	}()
+	return m.CallTool(ctx, req)
+}
+
+// healthLoop 定期 ping 每个连接, 失败的连接不再分配请求, 恢复后重新加入
+func (p *clientPool) healthLoop(interval time.Duration) {
+	defer p.wg.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+		}
+		healthy := 0
+		for i, m := range p.members {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			err := m.Ping(ctx)
+			cancel()
+			ok := err == nil
+			if m.healthy.Swap(ok) != ok {
+				if ok {
+					logf("mcp.pool_recovered", p.name, i)
+				} else {
+					logf("mcp.pool_unhealthy", p.name, i, err)
+				}
+			}
+			if ok {
+				healthy++
+			}
+		}
+		poolHealthy.Set(float64(healthy), p.name)
+	}
+}
+
+// Close 停止健康检查并关闭除第一个以外的连接, 第一个连接由 MCPClient 自己关闭
+func (p *clientPool) Close() {
+	close(p.stop)
+	p.wg.Wait()
+	for _, m := range p.members[1:] {
+		m.Close()
+	}
+}
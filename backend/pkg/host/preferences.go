@@ -0,0 +1,80 @@
+package host
+
+import (
+	"context"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// 回答的格式
+const (
+	FormatBullets = "bullets" // 要点列表
+	FormatProse   = "prose"   // 连贯的段落, 不用列表
+	FormatCode    = "code"    // 只输出代码
+)
+
+var responseFormats = []string{FormatBullets, FormatProse, FormatCode}
+
+// ResponsePreferences 是会话对回答长度和格式的要求, 零值表示不限制
+type ResponsePreferences struct {
+	MaxLength int    `json:"max_length,omitempty"` // 回答最多的字符数
+	Format    string `json:"format,omitempty"`     // bullets | prose | code
+}
+
+// applyQuery 用连接参数 format、max_length 覆盖对应的要求, 没有带上的保持不变;
+// 无效的值忽略, max_length=0 或 format= 取消限制
+func (p ResponsePreferences) applyQuery(q url.Values) ResponsePreferences {
+	if q.Has("format") {
+		if f := strings.ToLower(q.Get("format")); f == "" || slices.Contains(responseFormats, f) {
+			p.Format = f
+		}
+	}
+	if q.Has("max_length") {
+		if n, err := strconv.Atoi(q.Get("max_length")); err == nil && n >= 0 {
+			p.MaxLength = n
+		}
+	}
+	return p
+}
+
+// preferencesMessage 把会话的要求写成系统消息, 没有要求时返回 false
+func preferencesMessage(p ResponsePreferences) (openai.ChatCompletionMessage, bool) {
+	var directives []string
+	if p.Format != "" {
+		directives = append(directives, T(serverLocale, "preferences."+p.Format))
+	}
+	if p.MaxLength > 0 {
+		directives = append(directives, T(serverLocale, "preferences.max_length", p.MaxLength))
+	}
+	if len(directives) == 0 {
+		return openai.ChatCompletionMessage{}, false
+	}
+	return openai.ChatCompletionMessage{Role: openai.ChatMessageRoleSystem, Content: strings.Join(directives, "\n")}, true
+}
+
+// enforceLength 回答超过 maxLength 个字符时要求大模型在保持格式的前提下缩短,
+// 仍然超出 (或请求失败) 时截断
+func (cc *ChatClient) enforceLength(ctx context.Context, sessionID string, stats *turnStats, model, text string, maxLength int) string {
+	if maxLength <= 0 || len([]rune(text)) <= maxLength {
+		return text
+	}
+	resp, err := cc.createChatCompletion(ctx, sessionID, stats, openai.ChatCompletionRequest{
+		Model: model,
+		Messages: []openai.ChatCompletionMessage{
+			{Role: openai.ChatMessageRoleSystem, Content: T(serverLocale, "preferences.shorten", maxLength)},
+			{Role: openai.ChatMessageRoleUser, Content: text},
+		},
+	})
+	if err == nil && len(resp.Choices) > 0 && resp.Choices[0].Message.Content != "" {
+		text = resp.Choices[0].Message.Content
+		if len([]rune(text)) <= maxLength {
+			return text
+		}
+	}
+	logf("preferences.truncated", logTag(ctx, sessionID), maxLength, err)
+	return string([]rune(text)[:maxLength-1]) + "…"
+}
@@ -0,0 +1,28 @@
+//go:build !windows
+
+package host
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// setProcessGroup 让子进程成为新进程组的组长, 进程组 id 即其进程 id
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// terminateProcessGroup 向进程组发出 SIGTERM, 进程组已经不存在时不算错误
+func terminateProcessGroup(p *os.Process) error {
+	if err := syscall.Kill(-p.Pid, syscall.SIGTERM); err != nil && !errors.Is(err, syscall.ESRCH) {
+		return err
+	}
+	return nil
+}
+
+// killProcessGroup 向进程组发出 SIGKILL
+func killProcessGroup(p *os.Process) {
+	_ = syscall.Kill(-p.Pid, syscall.SIGKILL)
+}
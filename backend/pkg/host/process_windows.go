@@ -0,0 +1,25 @@
+package host
+
+import (
+	"os"
+	"os/exec"
+	"strconv"
+	"syscall"
+)
+
+// setProcessGroup 在新的进程组中启动, 主机收到 Ctrl+C 时不会直接传给 MCP 服务
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{CreationFlags: syscall.CREATE_NEW_PROCESS_GROUP}
+}
+
+// terminateProcessGroup Windows 上没有进程组信号, 用 taskkill /T 请求结束进程树;
+// 没有窗口的控制台程序不响应这个请求, 超时后由 killProcessGroup 强制结束, 所以不报告错误
+func terminateProcessGroup(p *os.Process) error {
+	_ = exec.Command("taskkill", "/T", "/PID", strconv.Itoa(p.Pid)).Run()
+	return nil
+}
+
+// killProcessGroup 用 taskkill /T /F 强制结束进程树
+func killProcessGroup(p *os.Process) {
+	_ = exec.Command("taskkill", "/T", "/F", "/PID", strconv.Itoa(p.Pid)).Run()
+}
@@ -0,0 +1,319 @@
+package host
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Prompt 是用户保存的提示词模板, 模板中的 {{变量}} 在使用时替换
+type Prompt struct {
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	Template    string    `json:"template"`
+	Variables   []string  `json:"variables"` // 模板中出现的变量, 按第一次出现的顺序
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+var (
+	promptNamePattern = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+	promptVarPattern  = regexp.MustCompile(`\{\{\s*([a-zA-Z_][a-zA-Z0-9_]*)\s*\}\}`)
+)
+
+// promptVariables 按第一次出现的顺序返回模板中的变量
+func promptVariables(template string) []string {
+	vars := []string{}
+	for _, m := range promptVarPattern.FindAllStringSubmatch(template, -1) {
+		if !slices.Contains(vars, m[1]) {
+			vars = append(vars, m[1])
+		}
+	}
+	return vars
+}
+
+// Render 替换模板中的变量, 有变量没有给出值时返回这些变量
+func (p Prompt) Render(values map[string]string) (string, []string) {
+	var missing []string
+	for _, v := range p.Variables {
+		if _, ok := values[v]; !ok {
+			missing = append(missing, v)
+		}
+	}
+	if len(missing) > 0 {
+		return "", missing
+	}
+	return promptVarPattern.ReplaceAllStringFunc(p.Template, func(s string) string {
+		return values[promptVarPattern.FindStringSubmatch(s)[1]]
+	}), nil
+}
+
+// PromptStore 按用户保存提示词模板, 每个用户一个 json 文件
+type PromptStore struct {
+	dir string
+	mu  sync.Mutex
+}
+
+func NewPromptStore(cfg *PromptsConfig) (*PromptStore, error) {
+	st := &PromptStore{dir: "data/prompts"}
+	if cfg.Dir != "" {
+		st.dir = cfg.Dir
+	}
+	if err := os.MkdirAll(st.dir, 0o700); err != nil {
+		return nil, err
+	}
+	return st, nil
+}
+
+// path 用户标识可能包含任意字符, 文件名使用其哈希
+func (st *PromptStore) path(owner string) string {
+	sum := sha256.Sum256([]byte(owner))
+	return filepath.Join(st.dir, hex.EncodeToString(sum[:16])+".json")
+}
+
+func (st *PromptStore) load(owner string) ([]Prompt, error) {
+	data, err := os.ReadFile(st.path(owner))
+	if errors.Is(err, os.ErrNotExist) {
+		return []Prompt{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	prompts := []Prompt{}
+	if err := json.Unmarshal(data, &prompts); err != nil {
+		return nil, err
+	}
+	return prompts, nil
+}
+
+func (st *PromptStore) save(owner string, prompts []Prompt) error {
+	data, err := json.MarshalIndent(prompts, "", "  ")
+	if err != nil {
+		return err
+	}
+	// 先写临时文件再改名, 避免写到一半时进程退出损坏已有模板
+	tmp := st.path(owner) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, st.path(owner))
+}
+
+// List 按名字排序返回用户的所有模板
+func (st *PromptStore) List(owner string) ([]Prompt, error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.load(owner)
+}
+
+// Get 按名字取模板
+func (st *PromptStore) Get(owner, name string) (Prompt, bool, error) {
+	prompts, err := st.List(owner)
+	if err != nil {
+		return Prompt{}, false, err
+	}
+	i := slices.IndexFunc(prompts, func(p Prompt) bool { return p.Name == name })
+	if i < 0 {
+		return Prompt{}, false, nil
+	}
+	return prompts[i], true, nil
+}
+
+// Put 新建或替换模板, 返回保存的模板和是否是新建的
+func (st *PromptStore) Put(owner string, p Prompt) (Prompt, bool, error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	prompts, err := st.load(owner)
+	if err != nil {
+		return Prompt{}, false, err
+	}
+	p.Variables = promptVariables(p.Template)
+	p.UpdatedAt = time.Now().UTC()
+	i := slices.IndexFunc(prompts, func(q Prompt) bool { return q.Name == p.Name })
+	created := i < 0
+	if created {
+		prompts = append(prompts, p)
+		slices.SortFunc(prompts, func(a, b Prompt) int { return strings.Compare(a.Name, b.Name) })
+	} else {
+		prompts[i] = p
+	}
+	return p, created, st.save(owner, prompts)
+}
+
+// Delete 删除模板, 不存在时返回 false
+func (st *PromptStore) Delete(owner, name string) (bool, error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	prompts, err := st.load(owner)
+	if err != nil {
+		return false, err
+	}
+	i := slices.IndexFunc(prompts, func(p Prompt) bool { return p.Name == name })
+	if i < 0 {
+		return false, nil
+	}
+	return true, st.save(owner, slices.Delete(prompts, i, i+1))
+}
+
+// Clear 删除用户的所有模板
+func (st *PromptStore) Clear(owner string) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if err := os.Remove(st.path(owner)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// promptOwner 返回用户的模板归属, 规则和记忆相同: 配置了认证时匿名用户不能使用模板,
+// 未配置认证时是单用户部署, 所有人共用一份模板
+func (cc *ChatClient) promptOwner(userID string) (string, bool) {
+	if cc.prompts == nil || (userID == "" && cc.auth != nil) || cc.softDeletes.hidden(userID) {
+		return "", false
+	}
+	return userID, true
+}
+
+// renderPrompt 按名字取用户的模板并替换变量, 失败时返回给客户端的错误信息的 key 和参数
+func (cc *ChatClient) renderPrompt(user, name string, values map[string]string) (string, string, []any) {
+	owner, ok := cc.promptOwner(user)
+	if !ok {
+		return "", "api.prompts_disabled", nil
+	}
+	p, ok, err := cc.prompts.Get(owner, name)
+	if err != nil {
+		logf("prompts.load_failed", err)
+		return "", "error.request_failed", nil
+	}
+	if !ok {
+		return "", "api.prompt_not_found", []any{name}
+	}
+	text, missing := p.Render(values)
+	if len(missing) > 0 {
+		return "", "api.prompt_missing_variables", []any{strings.Join(missing, ", ")}
+	}
+	return text, "", nil
+}
+
+type promptRequest struct {
+	Description string `json:"description,omitempty"`
+	Template    string `json:"template"`
+}
+
+type renderRequest struct {
+	Variables map[string]string `json:"variables"`
+}
+
+// GET /api/prompts 列出当前用户的模板
+// GET /api/prompts/{name} 取一个模板
+// PUT /api/prompts/{name} {"template": "...", "description": "..."} 新建或替换模板
+// DELETE /api/prompts/{name} 删除模板
+// POST /api/prompts/{name}/render {"variables": {...}} 返回替换变量后的文本
+func (cc *ChatClient) handlePrompts(w http.ResponseWriter, r *http.Request) {
+	owner, ok := cc.promptOwner(cc.userID(r))
+	if !ok {
+		writeError(w, r, http.StatusNotFound, "api.prompts_disabled")
+		return
+	}
+	name := r.PathValue("name")
+	if name == "" {
+		if r.Method != http.MethodGet {
+			writeError(w, r, http.StatusMethodNotAllowed, "api.method_not_allowed")
+			return
+		}
+		prompts, err := cc.prompts.List(owner)
+		if err != nil {
+			logf("prompts.load_failed", err)
+			writeError(w, r, http.StatusInternalServerError, "error.request_failed")
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"prompts": prompts})
+		return
+	}
+
+	if strings.HasSuffix(r.URL.Path, "/render") {
+		if r.Method != http.MethodPost {
+			writeError(w, r, http.StatusMethodNotAllowed, "api.method_not_allowed")
+			return
+		}
+		var req renderRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, r, http.StatusBadRequest, "api.bad_request", err)
+			return
+		}
+		text, key, args := cc.renderPrompt(cc.userID(r), name, req.Variables)
+		switch key {
+		case "":
+			writeJSON(w, http.StatusOK, map[string]string{"text": text})
+		case "api.prompt_not_found":
+			writeError(w, r, http.StatusNotFound, key, args...)
+		case "error.request_failed":
+			writeError(w, r, http.StatusInternalServerError, key, args...)
+		default:
+			writeError(w, r, http.StatusBadRequest, key, args...)
+		}
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		p, ok, err := cc.prompts.Get(owner, name)
+		if err != nil {
+			logf("prompts.load_failed", err)
+			writeError(w, r, http.StatusInternalServerError, "error.request_failed")
+			return
+		}
+		if !ok {
+			writeError(w, r, http.StatusNotFound, "api.prompt_not_found", name)
+			return
+		}
+		writeJSON(w, http.StatusOK, p)
+	case http.MethodPut:
+		if !promptNamePattern.MatchString(name) {
+			writeError(w, r, http.StatusBadRequest, "api.prompt_invalid_name")
+			return
+		}
+		var req promptRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, r, http.StatusBadRequest, "api.bad_request", err)
+			return
+		}
+		if strings.TrimSpace(req.Template) == "" {
+			writeError(w, r, http.StatusBadRequest, "api.prompt_empty")
+			return
+		}
+		p, created, err := cc.prompts.Put(owner, Prompt{Name: name, Description: req.Description, Template: req.Template})
+		if err != nil {
+			logf("prompts.save_failed", err)
+			writeError(w, r, http.StatusInternalServerError, "error.request_failed")
+			return
+		}
+		status := http.StatusOK
+		if created {
+			status = http.StatusCreated
+		}
+		writeJSON(w, status, p)
+	case http.MethodDelete:
+		deleted, err := cc.prompts.Delete(owner, name)
+		if err != nil {
+			logf("prompts.save_failed", err)
+			writeError(w, r, http.StatusInternalServerError, "error.request_failed")
+			return
+		}
+		if !deleted {
+			writeError(w, r, http.StatusNotFound, "api.prompt_not_found", name)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, r, http.StatusMethodNotAllowed, "api.method_not_allowed")
+	}
+}
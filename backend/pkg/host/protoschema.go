@@ -0,0 +1,111 @@
+package host
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"sync"
+
+	"github.com/guobinqiu/mcp-host-web/chat"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// WebSocket 消息格式的文档: GET /api/schema/chat.proto 返回编译进服务端的 chat.proto 原文,
+// GET /api/schema 返回各消息按 protobuf 的 JSON 映射 (protojson) 生成的 JSON Schema,
+// 客户端可以据此为正在连接的这个版本生成代码
+
+var (
+	protoSchemaOnce sync.Once
+	protoSchemaDoc  []byte
+)
+
+// GET /api/schema
+func (cc *ChatClient) handleSchema(w http.ResponseWriter, r *http.Request) {
+	protoSchemaOnce.Do(func() {
+		protoSchemaDoc, _ = json.MarshalIndent(buildProtoSchema(chat.File_chat_chat_proto, chat.Proto), "", "  ")
+	})
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(protoSchemaDoc)
+}
+
+// GET /api/schema/chat.proto
+func (cc *ChatClient) handleProtoFile(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write(chat.Proto)
+}
+
+// buildProtoSchema 把 proto 文件中的每个消息转换为 $defs 中的一个 schema, x-proto-sha256 为 proto 原文的摘要,
+// 客户端可以据此判断生成的代码是否和服务端一致
+func buildProtoSchema(file protoreflect.FileDescriptor, source []byte) map[string]any {
+	sum := sha256.Sum256(source)
+	defs := map[string]any{}
+	msgs := file.Messages()
+	for i := 0; i < msgs.Len(); i++ {
+		addMessageSchema(defs, msgs.Get(i))
+	}
+	return map[string]any{
+		"$schema":        "https://json-schema.org/draft/2020-12/schema",
+		"title":          string(file.Path()),
+		"description":    "WebSocket 消息 (ChatMessage) 及其引用的类型, 字段名和取值按 protobuf 的 JSON 映射",
+		"$ref":           "#/$defs/ChatMessage",
+		"$defs":          defs,
+		"x-proto-sha256": hex.EncodeToString(sum[:]),
+	}
+}
+
+func addMessageSchema(defs map[string]any, md protoreflect.MessageDescriptor) {
+	props := map[string]any{}
+	fields := md.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		props[fd.JSONName()] = fieldSchema(fd)
+	}
+	defs[string(md.Name())] = map[string]any{"type": "object", "properties": props, "additionalProperties": false}
+	nested := md.Messages()
+	for i := 0; i < nested.Len(); i++ {
+		if !nested.Get(i).IsMapEntry() {
+			addMessageSchema(defs, nested.Get(i))
+		}
+	}
+}
+
+func fieldSchema(fd protoreflect.FieldDescriptor) map[string]any {
+	switch {
+	case fd.IsMap():
+		return map[string]any{"type": "object", "additionalProperties": scalarSchema(fd.MapValue())}
+	case fd.IsList():
+		return map[string]any{"type": "array", "items": scalarSchema(fd)}
+	}
+	return scalarSchema(fd)
+}
+
+// scalarSchema 返回单个值的 schema: 64 位整数在 JSON 中是字符串, bytes 是 base64 字符串
+func scalarSchema(fd protoreflect.FieldDescriptor) map[string]any {
+	switch fd.Kind() {
+	case protoreflect.BoolKind:
+		return map[string]any{"type": "boolean"}
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind,
+		protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		return map[string]any{"type": "integer", "format": "int32"}
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind,
+		protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		return map[string]any{"type": "string", "format": "int64"}
+	case protoreflect.FloatKind, protoreflect.DoubleKind:
+		return map[string]any{"type": "number"}
+	case protoreflect.StringKind:
+		return map[string]any{"type": "string"}
+	case protoreflect.BytesKind:
+		return map[string]any{"type": "string", "contentEncoding": "base64"}
+	case protoreflect.EnumKind:
+		values := fd.Enum().Values()
+		names := make([]string, values.Len())
+		for i := range names {
+			names[i] = string(values.Get(i).Name())
+		}
+		return map[string]any{"type": "string", "enum": names}
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return map[string]any{"$ref": "#/$defs/" + string(fd.Message().Name())}
+	}
+	return map[string]any{}
+}
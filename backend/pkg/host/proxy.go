@@ -0,0 +1,90 @@
+package host
+
+import (
+	"net/http"
+	"net/url"
+	"sync"
+)
+
+// proxyDirect 表示不走代理, 即使设置了 HTTP_PROXY 等环境变量
+const proxyDirect = "direct"
+
+// proxyRoutes 按目标主机选择代理, 没有单独配置的主机按 HTTP_PROXY / HTTPS_PROXY / NO_PROXY 环境变量处理
+// mcp-go 的 streamable http 客户端不能替换 http.Client, 所以装在 http.DefaultTransport 上
+var proxyRoutes = newProxyRouter()
+
+type proxyRouter struct {
+	mu    sync.RWMutex
+	hosts map[string]*url.URL // 值为 nil 表示直连
+}
+
+func newProxyRouter() *proxyRouter {
+	r := &proxyRouter{hosts: make(map[string]*url.URL)}
+	if t, ok := http.DefaultTransport.(*http.Transport); ok {
+		t.Proxy = r.proxy
+	}
+	return r
+}
+
+// route 让发往 target 所在主机的请求走 proxy
+func (r *proxyRouter) route(target, proxy string) error {
+	if proxy == "" {
+		return nil
+	}
+	u, err := url.Parse(target)
+	if err != nil {
+		return err
+	}
+	p, err := parseProxy(proxy)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	r.hosts[u.Host] = p
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *proxyRouter) proxy(req *http.Request) (*url.URL, error) {
+	r.mu.RLock()
+	p, ok := r.hosts[req.URL.Host]
+	r.mu.RUnlock()
+	if ok {
+		return p, nil
+	}
+	return http.ProxyFromEnvironment(req)
+}
+
+// parseProxy 支持 http, https, socks5 代理, direct 表示直连 (返回 nil)
+func parseProxy(proxy string) (*url.URL, error) {
+	if proxy == proxyDirect {
+		return nil, nil
+	}
+	u, err := url.Parse(proxy)
+	if err != nil {
+		return nil, newError("proxy.invalid", proxy)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, newError("proxy.invalid", proxy)
+	}
+	if u.Host == "" {
+		return nil, newError("proxy.invalid", proxy)
+	}
+	return u, nil
+}
+
+// newProxyHTTPClient 为大模型接口创建使用指定代理的 http.Client, proxy 为空时返回 nil 沿用默认客户端
+func newProxyHTTPClient(proxy string) (*http.Client, error) {
+	if proxy == "" {
+		return nil, nil
+	}
+	p, err := parseProxy(proxy)
+	if err != nil {
+		return nil, err
+	}
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.Proxy = http.ProxyURL(p)
+	return &http.Client{Transport: t}, nil
+}
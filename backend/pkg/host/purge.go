@@ -0,0 +1,401 @@
+package host
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+const (
+	defaultPurgeFile   = "data/purges.json"
+	softDeleteInterval = time.Minute // 检查到期的软删除, 同时重新读取其他副本写入的记录
+)
+
+// PurgeReport 列出清除 (dry_run 时为将要清除) 的一个用户的数据
+type PurgeReport struct {
+	UserID         string   `json:"user_id"`
+	DryRun         bool     `json:"dry_run"`
+	Sessions       []string `json:"sessions"`        // 会话历史, 包括内存中缓存的和历史存储中的
+	Shared         []string `json:"shared_sessions"` // 用户参与的他人的多人会话, 只替换用户发送的消息, 会话保留
+	SharedMessages int      `json:"shared_messages"` // 这些会话中替换为占位文字的消息数
+	Artifacts      []string `json:"artifacts"`       // 这些会话中工具生成的附件
+	Uploads        int      `json:"uploads"`         // 这些会话中上传的文件数
+	Memories       int      `json:"memories"`
+	Prompts        int      `json:"prompts"`
+	Digests        int      `json:"digests"`
+	SearchEntries  int      `json:"search_entries"` // 全文索引中的消息数
+	Analytics      int      `json:"analytics"`      // 工具统计 (内存中和导出的 csv) 中该用户的问题条数
+
+	PurgeAfter *time.Time `json:"purge_after,omitempty"` // 软删除时数据被隐藏, 到这个时间后彻底删除
+}
+
+// purgeUser 收集并 (dryRun 为 false 时) 删除用户的会话、附件、上传的文件、记忆、提示词模板、会话摘要、搜索索引
+// 和工具统计中的问题; 用户参与的他人的多人会话保留, 其中用户发送的消息替换为占位文字, 这些会话的摘要也删除。
+// 中途失败时返回错误, 已经删除的不会恢复, 可以重新调用删除剩下的部分。
+// 日志和转发的事件不在清除范围内: 日志主要记录用户和会话 id 以及错误, 不记录对话的消息; 转发出去的事件由接收方保管,
+// 主机无法收回; purge.done 日志本身是清除的审计记录, 需要保留
+func (cc *ChatClient) purgeUser(userID string, dryRun bool) (*PurgeReport, error) {
+	report := &PurgeReport{UserID: userID, DryRun: dryRun}
+	var err error
+	if report.Sessions, err = cc.sessions.OwnedBy(userID); err != nil {
+		return nil, err
+	}
+	if report.Shared, err = cc.sessions.JoinedBy(userID); err != nil {
+		return nil, err
+	}
+	// 他人会话中用户发送的消息的序号, 用于删除搜索索引中的对应条目
+	redacted := make(map[string][]int, len(report.Shared))
+	for _, id := range report.Shared {
+		if redacted[id], err = cc.sessions.Redact(id, userID, true); err != nil {
+			return nil, err
+		}
+		report.SharedMessages += len(redacted[id])
+	}
+	if report.Artifacts, err = cc.artifacts.BySessions(report.Sessions); err != nil {
+		return nil, err
+	}
+	for _, id := range report.Sessions {
+		report.Uploads += len(cc.uploads.List(id))
+	}
+	if cc.memory != nil {
+		facts, err := cc.memory.List(userID)
+		if err != nil {
+			return nil, err
+		}
+		report.Memories = len(facts)
+	}
+	if cc.prompts != nil {
+		prompts, err := cc.prompts.List(userID)
+		if err != nil {
+			return nil, err
+		}
+		report.Prompts = len(prompts)
+	}
+	if cc.digests != nil {
+		if report.Digests, err = cc.digests.purge(userID, slices.Concat(report.Sessions, report.Shared), dryRun); err != nil {
+			return nil, err
+		}
+	}
+	if cc.search != nil {
+		if report.SearchEntries, err = cc.search.Purge(userID, dryRun); err != nil {
+			return nil, err
+		}
+		for _, id := range report.Shared {
+			n, err := cc.search.Remove(id, redacted[id], dryRun)
+			if err != nil {
+				return nil, err
+			}
+			report.SearchEntries += n
+		}
+	}
+	// 工具统计中的问题来自会话中的用户消息, 要在删除会话之前取出
+	if cc.analytics != nil {
+		var prompts []string
+		for _, id := range report.Sessions {
+			if sess, ok := cc.sessions.get(id); ok {
+				for _, m := range sess.History() {
+					if m.Role == openai.ChatMessageRoleUser {
+						prompts = append(prompts, m.Content)
+					}
+				}
+			}
+		}
+		for _, id := range report.Shared {
+			if sess, ok := cc.sessions.get(id); ok {
+				for _, m := range sess.History() {
+					if m.Role == openai.ChatMessageRoleUser && m.Sender == userID {
+						prompts = append(prompts, m.Content)
+					}
+				}
+			}
+		}
+		if report.Analytics, err = cc.analytics.purge(userID, prompts, dryRun); err != nil {
+			return nil, err
+		}
+	}
+	if report.Sessions == nil {
+		report.Sessions = []string{}
+	}
+	if report.Shared == nil {
+		report.Shared = []string{}
+	}
+	if report.Artifacts == nil {
+		report.Artifacts = []string{}
+	}
+	if dryRun {
+		return report, nil
+	}
+
+	for _, id := range report.Shared {
+		if _, err := cc.sessions.Redact(id, userID, false); err != nil {
+			return nil, err
+		}
+	}
+	for _, id := range report.Artifacts {
+		if err := cc.artifacts.Delete(id); err != nil {
+			return nil, err
+		}
+	}
+	for _, id := range report.Sessions {
+		if err := cc.uploads.DeleteSession(id); err != nil {
+			return nil, err
+		}
+		if err := cc.sessions.Delete(id); err != nil {
+			return nil, err
+		}
+	}
+	if cc.memory != nil {
+		if err := cc.memory.Clear(userID); err != nil {
+			return nil, err
+		}
+	}
+	if cc.prompts != nil {
+		if err := cc.prompts.Clear(userID); err != nil {
+			return nil, err
+		}
+	}
+	return report, nil
+}
+
+// softDeletes 记录软删除的用户: 用户的会话、记忆和提示词模板立即对所有人隐藏, 保留 retention 后由后台彻底清除,
+// 在此之前可以恢复。记录保存在 file 中, 重启后继续; 多副本共用一个文件时各副本定期重新读取
+type softDeletes struct {
+	file      string
+	retention time.Duration
+
+	mu      sync.Mutex
+	users   map[string]time.Time // 用户 -> 软删除的时间
+	modTime time.Time            // 上次读取时文件的修改时间
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// newSoftDeletes 未配置 purge 时返回 nil, 清除请求立即删除数据
+func newSoftDeletes(cfg *PurgeConfig) (*softDeletes, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+	d := &softDeletes{file: defaultPurgeFile, retention: time.Duration(cfg.Retention), users: map[string]time.Time{}, stop: make(chan struct{})}
+	if cfg.File != "" {
+		d.file = cfg.File
+	}
+	if err := os.MkdirAll(filepath.Dir(d.file), 0o700); err != nil {
+		return nil, err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := d.reload(); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// reload 文件有变化时重新读取, 调用方持有 d.mu
+func (d *softDeletes) reload() error {
+	fi, err := os.Stat(d.file)
+	if errors.Is(err, os.ErrNotExist) {
+		d.users, d.modTime = map[string]time.Time{}, time.Time{}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if fi.ModTime().Equal(d.modTime) {
+		return nil
+	}
+	data, err := os.ReadFile(d.file)
+	if err != nil {
+		return err
+	}
+	users := map[string]time.Time{}
+	if err := json.Unmarshal(data, &users); err != nil {
+		return err
+	}
+	d.users, d.modTime = users, fi.ModTime()
+	return nil
+}
+
+// save 写入文件, 调用方持有 d.mu
+func (d *softDeletes) save() error {
+	data, _ := json.MarshalIndent(d.users, "", "  ")
+	tmp := d.file + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, d.file); err != nil {
+		return err
+	}
+	if fi, err := os.Stat(d.file); err == nil {
+		d.modTime = fi.ModTime()
+	}
+	return nil
+}
+
+// hidden 用户已经软删除、等待清除时返回 true; d 为 nil 时返回 false
+func (d *softDeletes) hidden(userID string) bool {
+	if d == nil || userID == "" {
+		return false
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	_, ok := d.users[userID]
+	return ok
+}
+
+// mark 软删除用户, 返回彻底清除的时间; 已经软删除的用户保持原来的时间
+func (d *softDeletes) mark(userID string, now time.Time) (time.Time, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := d.reload(); err != nil {
+		return time.Time{}, err
+	}
+	if at, ok := d.users[userID]; ok {
+		return at.Add(d.retention), nil
+	}
+	d.users[userID] = now
+	return now.Add(d.retention), d.save()
+}
+
+// unmark 取消软删除 (恢复或已经彻底清除), 用户没有软删除时返回 false
+func (d *softDeletes) unmark(userID string) (bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := d.reload(); err != nil {
+		return false, err
+	}
+	if _, ok := d.users[userID]; !ok {
+		return false, nil
+	}
+	delete(d.users, userID)
+	return true, d.save()
+}
+
+// due 返回保留期已过的用户
+func (d *softDeletes) due(now time.Time) []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := d.reload(); err != nil {
+		logf("purge.load_failed", d.file, err)
+	}
+	var users []string
+	for user, at := range d.users {
+		if now.Sub(at) >= d.retention {
+			users = append(users, user)
+		}
+	}
+	slices.Sort(users)
+	return users
+}
+
+// Start 定期彻底清除保留期已过的用户, 只在 serve 中启动
+func (d *softDeletes) Start(purge func(userID string) error) {
+	if d == nil {
+		return
+	}
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		ticker := time.NewTicker(softDeleteInterval)
+		defer ticker.Stop()
+		for {
+			for _, user := range d.due(time.Now()) {
+				if err := purge(user); err != nil {
+					logf("purge.failed", user, err)
+				}
+			}
+			select {
+			case <-d.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (d *softDeletes) Close() {
+	if d == nil {
+		return
+	}
+	close(d.stop)
+	d.wg.Wait()
+}
+
+// purgeExpired 彻底清除保留期已过的用户, 成功后删除软删除的记录; 失败时保留记录, 下次再试
+func (cc *ChatClient) purgeExpired(userID string) error {
+	report, err := cc.purgeUser(userID, false)
+	if err != nil {
+		return err
+	}
+	if _, err := cc.softDeletes.unmark(userID); err != nil {
+		return err
+	}
+	logf("purge.expired", userID, len(report.Sessions), len(report.Shared), report.SharedMessages)
+	return nil
+}
+
+// DELETE /api/users/{id}/data?dry_run=1&immediate=1 清除一个用户的数据, 只有 admin 可以访问; dry_run 时只返回将要清除的内容。
+// 配置了 purge 时软删除: 返回 202 和将要清除的内容及清除时间, immediate=1 时立即彻底删除
+func (cc *ChatClient) handlePurgeUser(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		writeError(w, r, http.StatusMethodNotAllowed, "api.method_not_allowed")
+		return
+	}
+	userID := r.PathValue("id")
+	dryRun := r.URL.Query().Get("dry_run") == "1"
+	soft := cc.softDeletes != nil && !dryRun && r.URL.Query().Get("immediate") != "1"
+	report, err := cc.purgeUser(userID, dryRun || soft)
+	if err == nil && soft {
+		var at time.Time
+		if at, err = cc.softDeletes.mark(userID, time.Now()); err == nil {
+			report.DryRun, report.PurgeAfter = false, &at
+			logf("purge.scheduled", userID, cc.userID(r), at.Format(time.RFC3339))
+			writeJSON(w, http.StatusAccepted, report)
+			return
+		}
+	}
+	if err == nil && !dryRun && cc.softDeletes != nil {
+		_, err = cc.softDeletes.unmark(userID)
+	}
+	if err != nil {
+		logf("purge.failed", userID, err)
+		writeError(w, r, http.StatusInternalServerError, "error.request_failed")
+		return
+	}
+	if !dryRun {
+		logf("purge.done", userID, cc.userID(r), len(report.Sessions), len(report.Shared), report.SharedMessages)
+	}
+	writeJSON(w, http.StatusOK, report)
+}
+
+// POST /api/users/{id}/data/restore 恢复软删除、还没有彻底清除的用户数据, 只有 admin 可以访问
+func (cc *ChatClient) handleRestoreUser(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, r, http.StatusMethodNotAllowed, "api.method_not_allowed")
+		return
+	}
+	if cc.softDeletes == nil {
+		writeError(w, r, http.StatusNotFound, "api.soft_delete_disabled")
+		return
+	}
+	userID := r.PathValue("id")
+	ok, err := cc.softDeletes.unmark(userID)
+	if err != nil {
+		logf("purge.failed", userID, err)
+		writeError(w, r, http.StatusInternalServerError, "error.request_failed")
+		return
+	}
+	if !ok {
+		writeError(w, r, http.StatusNotFound, "api.purge_not_pending")
+		return
+	}
+	logf("purge.restored", userID, cc.userID(r))
+	w.WriteHeader(http.StatusNoContent)
+}
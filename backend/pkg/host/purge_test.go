@@ -0,0 +1,230 @@
+package host
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+func newPurgeClient(t *testing.T, purge *PurgeConfig) *ChatClient {
+	t.Helper()
+	cc := &ChatClient{sessions: NewSessionStore(nil)}
+	var err error
+	if cc.uploads, err = NewUploadStore(&UploadsConfig{Dir: t.TempDir()}); err != nil {
+		t.Fatal(err)
+	}
+	if cc.artifacts, err = NewArtifactStore(&ArtifactsConfig{Dir: t.TempDir()}); err != nil {
+		t.Fatal(err)
+	}
+	if cc.memory, err = NewMemoryStore(&MemoryConfig{Dir: t.TempDir()}); err != nil {
+		t.Fatal(err)
+	}
+	if cc.prompts, err = NewPromptStore(&PromptsConfig{Dir: t.TempDir()}); err != nil {
+		t.Fatal(err)
+	}
+	if cc.softDeletes, err = newSoftDeletes(purge); err != nil {
+		t.Fatal(err)
+	}
+	cc.sessions.SetHidden(cc.softDeletes.hidden)
+	return cc
+}
+
+func purgeRequest(cc *ChatClient, method, target, user string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, nil)
+	r.SetPathValue("id", user)
+	w := httptest.NewRecorder()
+	if method == http.MethodDelete {
+		cc.handlePurgeUser(w, r)
+	} else {
+		cc.handleRestoreUser(w, r)
+	}
+	return w
+}
+
+func TestSoftDeletePurge(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "purges.json")
+	cc := newPurgeClient(t, &PurgeConfig{Retention: Duration(time.Hour), File: file})
+	alice := cc.sessions.Create("alice")
+	bob := cc.sessions.Create("bob")
+	if _, err := cc.memory.Add("alice", "likes tea"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := cc.prompts.Put("alice", Prompt{Name: "review", Template: "Review {{file}}"}); err != nil {
+		t.Fatal(err)
+	}
+
+	w := purgeRequest(cc, http.MethodDelete, "/api/users/alice/data", "alice")
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("status = %d, want 202: %s", w.Code, w.Body)
+	}
+	var report PurgeReport
+	if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.DryRun || report.PurgeAfter == nil || len(report.Sessions) != 1 || report.Memories != 1 || report.Prompts != 1 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+
+	// 软删除后对所有人隐藏, 但数据还在
+	if _, ok := cc.sessions.Get(alice.ID); ok {
+		t.Error("soft-deleted session is still visible")
+	}
+	if _, ok := cc.sessions.Get(bob.ID); !ok {
+		t.Error("other user's session is hidden")
+	}
+	if all := cc.sessions.All(); len(all) != 1 || all[0].ID != bob.ID {
+		t.Errorf("All() = %d sessions, want only bob's", len(all))
+	}
+	if _, ok := cc.memoryOwner("alice"); ok {
+		t.Error("soft-deleted user still has memory")
+	}
+	if _, ok := cc.promptOwner("alice"); ok {
+		t.Error("soft-deleted user still has prompts")
+	}
+	if facts, _ := cc.memory.List("alice"); len(facts) != 1 {
+		t.Error("soft delete removed the memory")
+	}
+
+	// 其他副本 (同一个文件) 读到同样的记录
+	other, err := newSoftDeletes(&PurgeConfig{Retention: Duration(time.Hour), File: file})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !other.hidden("alice") || other.hidden("bob") {
+		t.Error("soft deletes were not persisted")
+	}
+
+	// 恢复
+	if w := purgeRequest(cc, http.MethodPost, "/api/users/alice/data/restore", "alice"); w.Code != http.StatusNoContent {
+		t.Fatalf("restore status = %d, want 204: %s", w.Code, w.Body)
+	}
+	if w := purgeRequest(cc, http.MethodPost, "/api/users/alice/data/restore", "alice"); w.Code != http.StatusNotFound {
+		t.Errorf("second restore status = %d, want 404", w.Code)
+	}
+	if _, ok := cc.sessions.Get(alice.ID); !ok {
+		t.Error("restored session is not visible")
+	}
+	if _, ok := cc.memoryOwner("alice"); !ok {
+		t.Error("restored user has no memory")
+	}
+
+	// 保留期过后由后台彻底清除
+	if _, err := cc.softDeletes.mark("alice", time.Now().Add(-2*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	due := cc.softDeletes.due(time.Now())
+	if len(due) != 1 || due[0] != "alice" {
+		t.Fatalf("due = %v, want [alice]", due)
+	}
+	if err := cc.purgeExpired("alice"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := cc.sessions.get(alice.ID); ok {
+		t.Error("expired session was not deleted")
+	}
+	if facts, _ := cc.memory.List("alice"); len(facts) != 0 {
+		t.Error("expired memory was not deleted")
+	}
+	if cc.softDeletes.hidden("alice") {
+		t.Error("purged user is still marked")
+	}
+	if _, ok := cc.sessions.Get(bob.ID); !ok {
+		t.Error("other user's session was deleted")
+	}
+}
+
+func TestPurgeImmediate(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		purge  *PurgeConfig
+		target string
+	}{
+		{"soft delete disabled", nil, "/api/users/alice/data"},
+		{"immediate", &PurgeConfig{Retention: Duration(time.Hour), File: filepath.Join(t.TempDir(), "purges.json")}, "/api/users/alice/data?immediate=1"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cc := newPurgeClient(t, tt.purge)
+			alice := cc.sessions.Create("alice")
+			if w := purgeRequest(cc, http.MethodDelete, tt.target, "alice"); w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200: %s", w.Code, w.Body)
+			}
+			if _, ok := cc.sessions.get(alice.ID); ok {
+				t.Error("session was not deleted")
+			}
+			if cc.softDeletes.hidden("alice") {
+				t.Error("user is still marked after a hard purge")
+			}
+			if w := purgeRequest(cc, http.MethodPost, "/api/users/alice/data/restore", "alice"); w.Code != http.StatusNotFound {
+				t.Errorf("restore status = %d, want 404", w.Code)
+			}
+		})
+	}
+}
+
+// 清除只参与了他人多人会话的用户: 会话保留, 其中该用户发送的消息在内存和历史存储中都替换为占位文字
+func TestPurgeSharedSession(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewFileHistoryStore(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cc := newPurgeClient(t, nil)
+	cc.sessions = NewSessionStore(store)
+	shared := cc.sessions.Create("alice")
+	shared.AddParticipant("bob")
+	shared.AppendUser("alice", "plan the offsite")
+	shared.AppendUser("bob", "my phone is 555-0100")
+	shared.Append(openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: "noted"})
+	// 另一个会话只在历史存储中, 模拟重启后没有加载到内存
+	stored := NewSessionStore(store).Create("carol")
+	stored.AddParticipant("bob")
+	stored.AppendUser("bob", "bob was here")
+
+	report, err := cc.purgeUser("bob", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{shared.ID, stored.ID}
+	slices.Sort(want)
+	if len(report.Sessions) != 0 || !slices.Equal(report.Shared, want) || report.SharedMessages != 2 {
+		t.Fatalf("dry run report = %+v, want shared %v with 2 messages", report, want)
+	}
+	if got := shared.History()[1].Content; got != "my phone is 555-0100" {
+		t.Fatalf("dry run changed the message: %q", got)
+	}
+
+	if _, err := cc.purgeUser("bob", false); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := cc.sessions.get(shared.ID); !ok {
+		t.Fatal("the owner's session was deleted")
+	}
+	if shared.CanAccess("bob") {
+		t.Error("bob is still a participant")
+	}
+	for _, id := range want {
+		persisted, err := store.Load(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, m := range persisted {
+			if m.Sender == "bob" || strings.Contains(m.Content, "555-0100") || strings.Contains(m.Content, "bob was here") {
+				t.Errorf("session %s still has bob's message: %+v", id, m)
+			}
+		}
+	}
+	history := shared.History()
+	if len(history) != 3 || history[0].Content != "plan the offsite" || history[1].Content != purgedMessage || history[2].Content != "noted" {
+		t.Errorf("unexpected history after purge: %+v", history)
+	}
+	if report, err := cc.purgeUser("bob", true); err != nil || len(report.Shared) != 0 {
+		t.Errorf("bob is still found in shared sessions: %+v, %v", report, err)
+	}
+}
@@ -0,0 +1,199 @@
+package host
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+var (
+	rateLimitWaitSeconds = metrics.Counter("llm_ratelimit_wait_seconds_total", "Total time LLM requests spent waiting for the rate limiter.")
+	rateLimitQueued      = metrics.Gauge("llm_ratelimit_queued_requests", "Number of LLM requests waiting for the rate limiter.")
+)
+
+// LLMLimiter 按服务商的配额 (每分钟请求数和 token 数) 限制大模型请求,
+// 排队的请求按会话轮流放行, 避免一个会话的大量请求把其他会话都挤成 429
+type LLMLimiter struct {
+	rpm, tpm float64 // 0 表示不限制
+
+	mu       sync.Mutex
+	requests float64 // 令牌桶中剩余的请求数
+	tokens   float64 // 令牌桶中剩余的 token 数, 实际用量超过预估时可以为负
+	last     time.Time
+	queues   map[string][]*limitWaiter // 按会话排队
+	order    []string                  // 有请求在排队的会话, 轮流放行
+	wake     chan struct{}
+}
+
+type limitWaiter struct {
+	tokens  float64
+	ready   chan struct{}
+	granted bool
+}
+
+// NewLLMLimiter 未配置或两项都为 0 时返回 nil, 不做限制
+func NewLLMLimiter(cfg *RateLimitConfig) *LLMLimiter {
+	if cfg == nil || (cfg.RequestsPerMinute == 0 && cfg.TokensPerMinute == 0) {
+		return nil
+	}
+	l := &LLMLimiter{
+		rpm:      float64(cfg.RequestsPerMinute),
+		tpm:      float64(cfg.TokensPerMinute),
+		requests: float64(cfg.RequestsPerMinute),
+		tokens:   float64(cfg.TokensPerMinute),
+		last:     time.Now(),
+		queues:   make(map[string][]*limitWaiter),
+		wake:     make(chan struct{}, 1),
+	}
+	go l.dispatch()
+	return l
+}
+
+// Wait 等待放行, tokens 为本次请求预估的 token 数
+func (l *LLMLimiter) Wait(ctx context.Context, sessionID string, tokens int) error {
+	if l == nil {
+		return nil
+	}
+	w := &limitWaiter{tokens: float64(tokens), ready: make(chan struct{})}
+	if l.tpm > 0 {
+		w.tokens = min(w.tokens, l.tpm) // 超过每分钟上限的请求也要能放行
+	}
+
+	start := time.Now()
+	l.mu.Lock()
+	if len(l.queues[sessionID]) == 0 {
+		l.order = append(l.order, sessionID)
+	}
+	l.queues[sessionID] = append(l.queues[sessionID], w)
+	rateLimitQueued.Add(1)
+	l.mu.Unlock()
+	l.notify()
+
+	select {
+	case <-w.ready:
+		rateLimitWaitSeconds.Add(time.Since(start).Seconds())
+		return nil
+	case <-ctx.Done():
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		if !w.granted {
+			l.remove(sessionID, w)
+		}
+		return ctx.Err()
+	}
+}
+
+// Adjust 用实际用量修正预估的 token 数
+func (l *LLMLimiter) Adjust(estimated, actual int) {
+	if l == nil || l.tpm == 0 {
+		return
+	}
+	l.mu.Lock()
+	l.tokens -= float64(actual - estimated)
+	l.mu.Unlock()
+}
+
+func (l *LLMLimiter) notify() {
+	select {
+	case l.wake <- struct{}{}:
+	default:
+	}
+}
+
+// dispatch 按会话轮流放行排队的请求, 令牌不足时等到补足为止
+func (l *LLMLimiter) dispatch() {
+	for {
+		l.mu.Lock()
+		l.refill(time.Now())
+		if len(l.order) == 0 {
+			l.mu.Unlock()
+			<-l.wake
+			continue
+		}
+		sessionID := l.order[0]
+		w := l.queues[sessionID][0]
+		wait := l.waitFor(w.tokens)
+		if wait == 0 {
+			if l.rpm > 0 {
+				l.requests--
+			}
+			if l.tpm > 0 {
+				l.tokens -= w.tokens
+			}
+			w.granted = true
+			close(w.ready)
+			// 该会话还有请求时排到队尾
+			l.order = l.order[1:]
+			l.remove(sessionID, w)
+			if len(l.queues[sessionID]) > 0 {
+				l.order = append(l.order, sessionID)
+			}
+			l.mu.Unlock()
+			continue
+		}
+		l.mu.Unlock()
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-l.wake:
+			timer.Stop()
+		}
+	}
+}
+
+// remove 把 w 移出队列, 队列空了的会话也移出轮转
+func (l *LLMLimiter) remove(sessionID string, w *limitWaiter) {
+	q := l.queues[sessionID]
+	if i := slices.Index(q, w); i >= 0 {
+		q = slices.Delete(q, i, i+1)
+		rateLimitQueued.Add(-1)
+	}
+	if len(q) > 0 {
+		l.queues[sessionID] = q
+		return
+	}
+	delete(l.queues, sessionID)
+	if i := slices.Index(l.order, sessionID); i >= 0 {
+		l.order = slices.Delete(l.order, i, i+1)
+	}
+}
+
+func (l *LLMLimiter) refill(now time.Time) {
+	minutes := now.Sub(l.last).Minutes()
+	l.last = now
+	l.requests = min(l.rpm, l.requests+l.rpm*minutes)
+	l.tokens = min(l.tpm, l.tokens+l.tpm*minutes)
+}
+
+// waitFor 计算令牌补足还需要等多久
+func (l *LLMLimiter) waitFor(tokens float64) time.Duration {
+	var wait time.Duration
+	if l.rpm > 0 && l.requests < 1 {
+		wait = max(wait, time.Duration((1-l.requests)/l.rpm*float64(time.Minute)))
+	}
+	if l.tpm > 0 && l.tokens < tokens {
+		wait = max(wait, time.Duration((tokens-l.tokens)/l.tpm*float64(time.Minute)))
+	}
+	return wait
+}
+
+// estimateTokens 粗略估算请求的 token 数 (按 4 个字节一个 token), 实际用量在响应后修正
+func estimateTokens(req openai.ChatCompletionRequest) int {
+	n := 0
+	for _, m := range req.Messages {
+		n += len(m.Content) + 16
+		for _, tc := range m.ToolCalls {
+			n += len(tc.Function.Name) + len(tc.Function.Arguments)
+		}
+	}
+	if len(req.Tools) > 0 {
+		b, _ := json.Marshal(req.Tools)
+		n += len(b)
+	}
+	return n/4 + req.MaxTokens
+}
@@ -0,0 +1,118 @@
+package host
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// queued 返回 sessionID 排队中的请求数
+func (l *LLMLimiter) queued(sessionID string) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.queues[sessionID])
+}
+
+// drain 清空令牌桶, 之后每个请求都要等令牌补足
+func (l *LLMLimiter) drain() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.requests, l.tokens, l.last = 0, 0, time.Now()
+}
+
+func TestLLMLimiterRoundRobin(t *testing.T) {
+	// 每 20ms 补充一个请求, 排队期间按会话轮流放行
+	l := NewLLMLimiter(&RateLimitConfig{RequestsPerMinute: 3000})
+	l.drain()
+
+	var mu sync.Mutex
+	var order []string
+	var wg sync.WaitGroup
+	enqueue := func(sessionID string) {
+		n := l.queued(sessionID)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := l.Wait(context.Background(), sessionID, 1); err != nil {
+				t.Error(err)
+				return
+			}
+			mu.Lock()
+			order = append(order, sessionID)
+			mu.Unlock()
+		}()
+		for l.queued(sessionID) == n {
+			time.Sleep(100 * time.Microsecond)
+		}
+	}
+	for range 4 {
+		enqueue("busy")
+	}
+	enqueue("a")
+	enqueue("b")
+	wg.Wait()
+
+	want := []string{"busy", "a", "b", "busy", "busy", "busy"}
+	if !slices.Equal(order, want) {
+		t.Errorf("granted in order %v, want %v", order, want)
+	}
+}
+
+func TestLLMLimiterTokens(t *testing.T) {
+	// 每秒 6000 个 token: 600 个 token 要等 100ms 左右
+	l := NewLLMLimiter(&RateLimitConfig{TokensPerMinute: 360000})
+	l.drain()
+	start := time.Now()
+	if err := l.Wait(context.Background(), "s", 600); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d < 80*time.Millisecond {
+		t.Errorf("granted after %v, want about 100ms", d)
+	}
+	// 实际用量超过预估时从桶中扣除, 之后的请求等更久
+	l.Adjust(0, 36000)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := l.Wait(ctx, "s", 1); err == nil {
+		t.Error("request was granted although the bucket is overdrawn")
+	}
+}
+
+func TestLLMLimiterCancel(t *testing.T) {
+	l := NewLLMLimiter(&RateLimitConfig{RequestsPerMinute: 1})
+	l.drain()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- l.Wait(ctx, "s", 1) }()
+	for l.queued("s") == 0 {
+		time.Sleep(100 * time.Microsecond)
+	}
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Fatalf("Wait = %v, want context.Canceled", err)
+	}
+	// 取消的请求移出队列, 不再占用轮转的位置
+	if n := l.queued("s"); n != 0 {
+		t.Errorf("%d requests still queued", n)
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.order) != 0 {
+		t.Errorf("session still in the rotation: %v", l.order)
+	}
+}
+
+func TestLLMLimiterDisabled(t *testing.T) {
+	for _, cfg := range []*RateLimitConfig{nil, {}} {
+		l := NewLLMLimiter(cfg)
+		if l != nil {
+			t.Fatalf("NewLLMLimiter(%+v) = %v, want nil", cfg, l)
+		}
+		if err := l.Wait(context.Background(), "s", 1_000_000); err != nil {
+			t.Error(err)
+		}
+		l.Adjust(0, 100)
+	}
+}
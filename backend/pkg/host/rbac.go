@@ -0,0 +1,152 @@
+package host
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 角色按权限从低到高: readonly 只能查看, user 可以对话和调用工具, admin 还可以访问管理接口
+const (
+	RoleReadonly = "readonly"
+	RoleUser     = "user"
+	RoleAdmin    = "admin"
+)
+
+var roleRank = map[string]int{RoleReadonly: 1, RoleUser: 2, RoleAdmin: 3}
+
+var (
+	ErrForbidden      = errors.New("forbidden")
+	ErrBudgetExceeded = errors.New("token budget exceeded")
+)
+
+type roleKey struct{}
+
+func withRole(ctx context.Context, role string) context.Context {
+	return context.WithValue(ctx, roleKey{}, role)
+}
+
+// roleFrom 取 ctx 中的角色, 没有时 (比如压测) 不做限制
+func roleFrom(ctx context.Context) string {
+	if role, ok := ctx.Value(roleKey{}).(string); ok {
+		return role
+	}
+	return RoleAdmin
+}
+
+// role 确定请求的角色: 先看配置中按用户指定的角色, 再看身份提供方给出的角色 (请求头或 OIDC claim),
+// 都没有时使用 defaultRole。未配置认证时保持原来的行为, 不做任何限制
+func (cc *ChatClient) role(r *http.Request) string {
+	a := cc.auth
+	if a == nil {
+		return RoleAdmin
+	}
+	id := cc.identity(r)
+	if id.user != "" {
+		if role, ok := a.Users[id.user]; ok {
+			return role
+		}
+	}
+	// 可能有多个组, 取其中权限最高的已知角色
+	best := ""
+	for _, g := range id.groups {
+		if g = strings.TrimSpace(g); roleRank[g] > roleRank[best] {
+			best = g
+		}
+	}
+	if best != "" {
+		return best
+	}
+	return a.DefaultRole
+}
+
+// requireRole 只允许 min 及以上的角色访问
+func (cc *ChatClient) requireRole(min string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if roleRank[cc.role(r)] < roleRank[min] {
+			writeError(w, r, http.StatusForbidden, "api.forbidden")
+			return
+		}
+		// 管理接口还要检查来源地址
+		if min == RoleAdmin {
+			if ip := cc.clientIP(r); !cc.network.adminAllowed(ip) {
+				ipDenied.Inc("admin")
+				logf("api.ip_denied", ip, r.URL.Path)
+				writeError(w, r, http.StatusForbidden, "api.ip_forbidden")
+				return
+			}
+		}
+		h(w, r)
+	}
+}
+
+func (cc *ChatClient) roleConfig(role string) RoleConfig {
+	if cc.auth == nil {
+		return RoleConfig{}
+	}
+	return cc.auth.Roles[role]
+}
+
+// toolAllowed 按角色的工具白名单 (支持 * 通配) 判断, 未配置白名单时允许全部工具
+func (cc *ChatClient) toolAllowed(role, tool string) bool {
+	patterns := cc.roleConfig(role).Tools
+	if patterns == nil {
+		return true
+	}
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, tool); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// tokenBudget 按用户统计当天 (UTC) 的 token 用量, 只保存在内存中, 重启后清零
+type tokenBudget struct {
+	mu   sync.Mutex
+	day  string
+	used map[string]int
+}
+
+func (b *tokenBudget) reset() {
+	if day := time.Now().UTC().Format(time.DateOnly); day != b.day {
+		b.day = day
+		b.used = make(map[string]int)
+	}
+}
+
+// check 当天用量达到 limit 时返回 ErrBudgetExceeded, limit 为 0 表示不限制
+func (b *tokenBudget) check(key string, limit int) error {
+	if limit <= 0 {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.reset()
+	if b.used[key] >= limit {
+		return ErrBudgetExceeded
+	}
+	return nil
+}
+
+func (b *tokenBudget) add(key string, tokens int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.reset()
+	b.used[key] += tokens
+}
+
+// budgetKey 登录用户按用户统计 (多人会话中按发送者), 匿名用户按会话统计
+func budgetKey(ctx context.Context, sess *Session) string {
+	if user := senderFrom(ctx); user != "" {
+		return "user:" + user
+	}
+	if user := sess.UserID(); user != "" {
+		return "user:" + user
+	}
+	return "session:" + sess.ID
+}
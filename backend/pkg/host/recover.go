@@ -0,0 +1,53 @@
+package host
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+)
+
+var panicsTotal = metrics.Counter("panics_total", "Number of recovered panics.", "stage")
+
+// PanicError 是被恢复的 panic, 作为本轮对话的错误返回
+type PanicError struct {
+	Value any
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.Value)
+}
+
+// recoverPanic 必须直接 defer 调用: 恢复 panic, 记录日志和错误事件, 进程继续运行
+// err 不为 nil 时把 panic 作为错误返回给调用方
+func (cc *ChatClient) recoverPanic(ctx context.Context, stage, sessionID string, err *error) {
+	v := recover()
+	if v == nil {
+		return
+	}
+	if v == http.ErrAbortHandler {
+		panic(v)
+	}
+	stack := debug.Stack()
+	panicsTotal.Inc(stage)
+	logf("server.panic", stage, logTag(ctx, sessionID), v, stack)
+	cc.events.Publish(EventError, sessionID, traceData(ctx, map[string]any{"stage": "panic", "where": stage, "error": fmt.Sprint(v)}))
+	if err != nil {
+		*err = &PanicError{Value: v, Stack: stack}
+	}
+}
+
+// withRecover 恢复 HTTP 处理函数中的 panic, 返回 500
+func (cc *ChatClient) withRecover(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var err error
+		defer func() {
+			if err != nil {
+				writeError(w, r, http.StatusInternalServerError, "api.internal_error")
+			}
+		}()
+		defer cc.recoverPanic(r.Context(), "http "+r.URL.Path, "", &err)
+		next.ServeHTTP(w, r)
+	})
+}
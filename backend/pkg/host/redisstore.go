@@ -0,0 +1,282 @@
+package host
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	defaultRedisKeyPrefix = "mcp-host:"
+	turnLockTTL           = 2 * time.Minute        // 持有锁的副本崩溃后, 锁最多保留这么久
+	turnLockRetry         = 100 * time.Millisecond // 等锁时的重试间隔
+)
+
+// unlockScript 只释放自己持有的锁, 避免锁过期后误删其他副本的锁
+var unlockScript = redis.NewScript(`
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("del", KEYS[1])
+end
+return 0`)
+
+// RedisHistoryStore 把会话历史保存在 Redis 中, 多个副本共享同一份数据,
+// 并用分布式锁保证同一会话同一时间只有一个副本在处理
+type RedisHistoryStore struct {
+	client *redis.Client
+	prefix string
+	ttl    time.Duration  // 会话过期时间, 0 表示不过期
+	cipher *ContentCipher // 为 nil 时明文保存
+}
+
+func NewRedisHistoryStore(cfg *RedisConfig, cipher *ContentCipher) (*RedisHistoryStore, error) {
+	opts, err := redis.ParseURL(cfg.URL)
+	if err != nil {
+		return nil, err
+	}
+	client := redis.NewClient(opts)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, newError("history.redis_failed", cfg.URL, err)
+	}
+	prefix := cfg.KeyPrefix
+	if prefix == "" {
+		prefix = defaultRedisKeyPrefix
+	}
+	return &RedisHistoryStore{client: client, prefix: prefix, ttl: time.Duration(cfg.TTL), cipher: cipher}, nil
+}
+
+func (rs *RedisHistoryStore) messagesKey(sessionID string) string {
+	return rs.prefix + "session:" + sessionID + ":messages"
+}
+
+func (rs *RedisHistoryStore) metaKey(sessionID string) string {
+	return rs.prefix + "session:" + sessionID + ":meta"
+}
+
+func (rs *RedisHistoryStore) lockKey(sessionID string) string {
+	return rs.prefix + "session:" + sessionID + ":lock"
+}
+
+// Create 记录新会话, 其他副本在会话还没有消息时也能找到它
+func (rs *RedisHistoryStore) Create(sessionID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return rs.client.Set(ctx, rs.metaKey(sessionID), time.Now().Format(time.RFC3339), rs.ttl).Err()
+}
+
+func (rs *RedisHistoryStore) Append(sessionID string, msgs ...HistoryMessage) error {
+	if !sessionIDPattern.MatchString(sessionID) {
+		return fmt.Errorf("invalid session id %q", sessionID)
+	}
+	values := make([]any, 0, len(msgs))
+	for _, m := range msgs {
+		var err error
+		if rs.cipher != nil {
+			if m, err = rs.cipher.EncryptMessage(m); err != nil {
+				return err
+			}
+		}
+		b, err := json.Marshal(m)
+		if err != nil {
+			return err
+		}
+		values = append(values, b)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	pipe := rs.client.TxPipeline()
+	pipe.RPush(ctx, rs.messagesKey(sessionID), values...)
+	if rs.ttl > 0 {
+		pipe.Expire(ctx, rs.messagesKey(sessionID), rs.ttl)
+		pipe.Expire(ctx, rs.metaKey(sessionID), rs.ttl)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func (rs *RedisHistoryStore) Load(sessionID string) ([]HistoryMessage, error) {
+	if !sessionIDPattern.MatchString(sessionID) {
+		return nil, ErrSessionNotFound
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	pipe := rs.client.Pipeline()
+	exists := pipe.Exists(ctx, rs.metaKey(sessionID), rs.messagesKey(sessionID))
+	items := pipe.LRange(ctx, rs.messagesKey(sessionID), 0, -1)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+	if exists.Val() == 0 {
+		return nil, ErrSessionNotFound
+	}
+
+	msgs := make([]HistoryMessage, 0, len(items.Val()))
+	for _, item := range items.Val() {
+		var m HistoryMessage
+		if err := json.Unmarshal([]byte(item), &m); err != nil {
+			return nil, fmt.Errorf("%s: %v", sessionID, err)
+		}
+		if rs.cipher != nil {
+			var err error
+			if m, err = rs.cipher.DecryptMessage(m); err != nil {
+				return nil, fmt.Errorf("%s: %v", sessionID, err)
+			}
+		}
+		msgs = append(msgs, m)
+	}
+	return msgs, nil
+}
+
+// UserSessions 扫描所有会话, 返回 userID 拥有的会话; 会话的所有者记录在每条消息中, 只需读取第一条
+func (rs *RedisHistoryStore) UserSessions(userID string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	var ids []string
+	iter := rs.client.Scan(ctx, 0, rs.messagesKey("*"), 1000).Iterator()
+	for iter.Next(ctx) {
+		key := iter.Val()
+		id := strings.TrimSuffix(strings.TrimPrefix(key, rs.prefix+"session:"), ":messages")
+		if !sessionIDPattern.MatchString(id) {
+			continue
+		}
+		item, err := rs.client.LIndex(ctx, key, 0).Result()
+		if errors.Is(err, redis.Nil) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		var m HistoryMessage
+		if json.Unmarshal([]byte(item), &m) == nil && m.UserID == userID {
+			ids = append(ids, id)
+		}
+	}
+	return ids, iter.Err()
+}
+
+// SenderSessions 扫描所有会话的全部消息, 返回 sender 发送过消息、但由其他用户拥有的会话
+func (rs *RedisHistoryStore) SenderSessions(sender string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	var ids []string
+	iter := rs.client.Scan(ctx, 0, rs.messagesKey("*"), 1000).Iterator()
+	for iter.Next(ctx) {
+		id := strings.TrimSuffix(strings.TrimPrefix(iter.Val(), rs.prefix+"session:"), ":messages")
+		if !sessionIDPattern.MatchString(id) {
+			continue
+		}
+		msgs, err := rs.Load(id)
+		if errors.Is(err, ErrSessionNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(msgs) > 0 && msgs[0].UserID != sender && len(redactSender(msgs, sender, true)) > 0 {
+			ids = append(ids, id)
+		}
+	}
+	return ids, iter.Err()
+}
+
+// Redact 逐条改写 sender 发送的消息, 其他消息和列表的长度不变, 不影响其他副本同时追加
+func (rs *RedisHistoryStore) Redact(sessionID, sender string, dryRun bool) ([]int, error) {
+	msgs, err := rs.Load(sessionID)
+	if errors.Is(err, ErrSessionNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var positions []int
+	for i, m := range msgs {
+		if sender != "" && m.Sender == sender {
+			positions = append(positions, i)
+		}
+	}
+	idxs := redactSender(msgs, sender, dryRun)
+	if dryRun || len(idxs) == 0 {
+		return idxs, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	pipe := rs.client.TxPipeline()
+	for _, i := range positions {
+		m := msgs[i]
+		if rs.cipher != nil {
+			if m, err = rs.cipher.EncryptMessage(m); err != nil {
+				return nil, err
+			}
+		}
+		b, err := json.Marshal(m)
+		if err != nil {
+			return nil, err
+		}
+		pipe.LSet(ctx, rs.messagesKey(sessionID), int64(i), b)
+	}
+	_, err = pipe.Exec(ctx)
+	return idxs, err
+}
+
+func (rs *RedisHistoryStore) Delete(sessionID string) error {
+	if !sessionIDPattern.MatchString(sessionID) {
+		return fmt.Errorf("invalid session id %q", sessionID)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return rs.client.Del(ctx, rs.messagesKey(sessionID), rs.metaKey(sessionID)).Err()
+}
+
+// Truncate 只保留前 n 条消息
+func (rs *RedisHistoryStore) Truncate(sessionID string, n int) error {
+	if !sessionIDPattern.MatchString(sessionID) {
+		return fmt.Errorf("invalid session id %q", sessionID)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	// LTRIM key 0 -1 保留全部, n 为 0 时直接删除消息列表, 会话仍由 meta 登记
+	if n == 0 {
+		return rs.client.Del(ctx, rs.messagesKey(sessionID)).Err()
+	}
+	return rs.client.LTrim(ctx, rs.messagesKey(sessionID), 0, int64(n-1)).Err()
+}
+
+// LockTurn 获取会话的分布式锁, 直到拿到锁或 ctx 结束
+func (rs *RedisHistoryStore) LockTurn(ctx context.Context, sessionID string) (func(), error) {
+	key := rs.lockKey(sessionID)
+	token := newID()
+	for {
+		ok, err := rs.client.SetNX(ctx, key, token, turnLockTTL).Result()
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(turnLockRetry):
+		}
+	}
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := unlockScript.Run(ctx, rs.client, []string{key}, token).Err(); err != nil && !errors.Is(err, redis.Nil) {
+			logf("history.unlock_failed", sessionID, err)
+		}
+	}, nil
+}
+
+func (rs *RedisHistoryStore) Close() error {
+	return rs.client.Close()
+}
@@ -0,0 +1,170 @@
+package host
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// 大模型返回不可用的结果时最多重试的次数
+const maxRepairRetries = 2
+
+// completeTurn 调用大模型并检查结果: 工具参数是被截断的 JSON 时先尝试修复,
+// 仍然没有可用的 choice (空 choices、空消息、无法修复的工具调用) 时附加更严格的格式要求重试。
+// 返回的结果只包含可用的 choice, 畸形的回复不会写入历史
+func (cc *ChatClient) completeTurn(ctx context.Context, sessionID string, stats *turnStats, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	var reason string
+	for attempt := 0; ; attempt++ {
+		resp, err := cc.createChatCompletion(ctx, sessionID, stats, req)
+		if err != nil {
+			return resp, err
+		}
+		if reason = repairResponse(&resp, len(req.Tools) > 0); reason == "" {
+			return resp, nil
+		}
+		logf("llm.malformed_response", logTag(ctx, sessionID), reason, attempt+1)
+		cc.events.Publish(EventError, sessionID, traceData(ctx, map[string]any{"stage": "completion", "error": reason, "attempt": attempt + 1}))
+		if attempt == maxRepairRetries {
+			break
+		}
+		if attempt == 0 {
+			req.Messages = append(slices.Clip(req.Messages), openai.ChatCompletionMessage{
+				Role:    openai.ChatMessageRoleSystem,
+				Content: T(clientInfoFrom(ctx).locale, "prompt.strict_format"),
+			})
+		}
+	}
+	return openai.ChatCompletionResponse{}, newError("llm.malformed_failed", maxRepairRetries+1, reason)
+}
+
+// repairResponse 修复工具调用的参数并去掉不可用的 choice, 没有剩下可用的 choice 时返回原因。
+// toolsOffered 为 false 时本次请求没有提供工具, 只有文字回答才算可用
+func repairResponse(resp *openai.ChatCompletionResponse, toolsOffered bool) string {
+	if len(resp.Choices) == 0 {
+		return "empty choices"
+	}
+	reason := ""
+	choices := resp.Choices[:0]
+	for _, choice := range resp.Choices {
+		msg := &choice.Message
+		switch {
+		case msg.Content != "":
+		case !toolsOffered || len(msg.ToolCalls) == 0:
+			reason = "empty message"
+			continue
+		default:
+			if r := repairToolCalls(msg.ToolCalls); r != "" {
+				reason = r
+				continue
+			}
+		}
+		choices = append(choices, choice)
+	}
+	resp.Choices = choices
+	if len(choices) == 0 {
+		return reason
+	}
+	return ""
+}
+
+// repairToolCalls 就地修复工具调用的参数, 有无法修复的调用时返回原因
+func repairToolCalls(calls []openai.ToolCall) string {
+	for i := range calls {
+		call := &calls[i]
+		if call.ID == "" || call.Function.Name == "" {
+			return "tool call without id or name"
+		}
+		args, ok := repairJSON(call.Function.Arguments)
+		if !ok {
+			return "invalid arguments for tool " + call.Function.Name
+		}
+		call.Function.Arguments = args
+	}
+	return ""
+}
+
+// repairJSON 返回可以解析为 JSON 对象的参数: 空参数视为 {}, 被截断的 JSON 补全未闭合的字符串和括号;
+// 截断在键或值中间无法补全时退回到最后一个完整的成员
+func repairJSON(s string) (string, bool) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return "{}", true
+	}
+	if isJSONObject(s) {
+		return s, true
+	}
+
+	var stack []byte // 未闭合的 { 和 [
+	inString, escaped := false, false
+	lastComma, stackAtComma := -1, []byte(nil)
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if inString {
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				inString = false
+			}
+			continue
+		}
+		switch c {
+		case '"':
+			inString = true
+		case '{', '[':
+			stack = append(stack, c)
+		case '}', ']':
+			if len(stack) == 0 {
+				return "", false
+			}
+			stack = stack[:len(stack)-1]
+		case ',':
+			lastComma, stackAtComma = i, slices.Clone(stack)
+		}
+	}
+
+	head := s
+	if inString {
+		if escaped {
+			head = head[:len(head)-1]
+		}
+		head += `"`
+	}
+	head = strings.TrimRight(head, " \t\r\n,")
+	if strings.HasSuffix(head, ":") {
+		head += "null"
+	}
+	if repaired := closeJSON(head, stack); isJSONObject(repaired) {
+		return repaired, true
+	}
+	if lastComma >= 0 {
+		if repaired := closeJSON(s[:lastComma], stackAtComma); isJSONObject(repaired) {
+			return repaired, true
+		}
+	}
+	return "", false
+}
+
+// closeJSON 按从内到外的顺序补上未闭合的括号
+func closeJSON(s string, stack []byte) string {
+	var b strings.Builder
+	b.WriteString(s)
+	for i := len(stack) - 1; i >= 0; i-- {
+		if stack[i] == '{' {
+			b.WriteByte('}')
+		} else {
+			b.WriteByte(']')
+		}
+	}
+	return b.String()
+}
+
+func isJSONObject(s string) bool {
+	var v map[string]any
+	return strings.HasPrefix(s, "{") && json.Unmarshal([]byte(s), &v) == nil
+}
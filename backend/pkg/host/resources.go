@@ -0,0 +1,121 @@
+package host
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// ResourceTemplate 是 MCP 服务提供的一个资源模板, 前端据此补全用户输入的资源引用
+type ResourceTemplate struct {
+	Server      string `json:"server"`
+	URITemplate string `json:"uri_template"` // RFC 6570 URI 模板, 比如 file:///{path}
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	MIMEType    string `json:"mime_type,omitempty"`
+}
+
+// completeRequest 是 POST /api/complete 的请求体, 原样转发给 MCP 服务的 completion/complete
+type completeRequest struct {
+	Server string `json:"server"`
+	Ref    struct {
+		Type string `json:"type"`           // ref/resource | ref/prompt
+		URI  string `json:"uri,omitempty"`  // ref/resource 时为资源 URI 或 URI 模板
+		Name string `json:"name,omitempty"` // ref/prompt 时为 MCP 服务的提示词名
+	} `json:"ref"`
+	Argument struct {
+		Name  string `json:"name"`
+		Value string `json:"value"` // 已经输入的部分
+	} `json:"argument"`
+}
+
+// completeResponse 是补全的候选值, 最多 100 个; has_more 表示还有更多候选
+type completeResponse struct {
+	Values  []string `json:"values"`
+	Total   int      `json:"total,omitempty"`
+	HasMore bool     `json:"has_more,omitempty"`
+}
+
+// server 按名字查找当前连接的 MCP 服务
+func (cc *ChatClient) server(name string) *MCPClient {
+	for _, c := range cc.servers() {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// GET /api/resources/templates 列出各 MCP 服务的资源模板; 没有声明 resources 能力的服务跳过, 获取失败的服务记录日志后跳过
+func (cc *ChatClient) handleResourceTemplates(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, r, http.StatusMethodNotAllowed, "api.method_not_allowed")
+		return
+	}
+	templates := []ResourceTemplate{}
+	for _, c := range cc.servers() {
+		if c.GetServerCapabilities().Resources == nil {
+			continue
+		}
+		ctx, cancel := c.WithTimeout(r.Context())
+		res, err := c.ListResourceTemplates(ctx, mcp.ListResourceTemplatesRequest{})
+		cancel()
+		if err != nil {
+			logf("resources.list_failed", c.Name, err)
+			continue
+		}
+		for _, t := range res.ResourceTemplates {
+			rt := ResourceTemplate{Server: c.Name, Name: t.Name, Description: t.Description, MIMEType: t.MIMEType}
+			if t.URITemplate != nil && t.URITemplate.Template != nil {
+				rt.URITemplate = t.URITemplate.Raw()
+			}
+			templates = append(templates, rt)
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"templates": templates})
+}
+
+// POST /api/complete 向 MCP 服务请求资源模板变量或提示词参数的补全候选
+func (cc *ChatClient) handleComplete(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, r, http.StatusMethodNotAllowed, "api.method_not_allowed")
+		return
+	}
+	var req completeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, http.StatusBadRequest, "api.bad_request", err)
+		return
+	}
+	var ref any
+	switch req.Ref.Type {
+	case "ref/resource":
+		ref = mcp.ResourceReference{Type: req.Ref.Type, URI: req.Ref.URI}
+	case "ref/prompt":
+		ref = mcp.PromptReference{Type: req.Ref.Type, Name: req.Ref.Name}
+	default:
+		writeError(w, r, http.StatusBadRequest, "api.bad_ref_type", req.Ref.Type)
+		return
+	}
+	c := cc.server(req.Server)
+	if c == nil {
+		writeError(w, r, http.StatusNotFound, "api.server_not_found", req.Server)
+		return
+	}
+	var creq mcp.CompleteRequest
+	creq.Params.Ref = ref
+	creq.Params.Argument.Name = req.Argument.Name
+	creq.Params.Argument.Value = req.Argument.Value
+	ctx, cancel := c.WithTimeout(r.Context())
+	defer cancel()
+	res, err := c.Complete(ctx, creq)
+	if err != nil {
+		writeError(w, r, http.StatusBadGateway, "api.complete_failed", err)
+		return
+	}
+	values := res.Completion.Values
+	if values == nil {
+		values = []string{}
+	}
+	writeJSON(w, http.StatusOK, completeResponse{Values: values, Total: res.Completion.Total, HasMore: res.Completion.HasMore})
+}
@@ -0,0 +1,141 @@
+package host
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/guobinqiu/mcp-host-web/chat"
+	"github.com/sashabaranov/go-openai"
+)
+
+// 从多个候选回答中选出最终回答的策略
+const (
+	ResponseFirst   = "first"   // 第一个候选
+	ResponseLongest = "longest" // 最长的候选
+	ResponseRerank  = "rerank"  // 再调用一次大模型挑选最好的候选
+)
+
+var responseStrategies = []string{ResponseFirst, ResponseLongest, ResponseRerank}
+
+var firstNumberRe = regexp.MustCompile(`\d+`)
+
+// N-best 模式最多返回的候选回答个数
+const maxCandidates = 5
+
+type candidatesKey struct{}
+
+// withCandidates 记录客户端本轮希望得到的候选回答个数
+func withCandidates(ctx context.Context, n int) context.Context {
+	return context.WithValue(ctx, candidatesKey{}, min(n, maxCandidates))
+}
+
+func candidatesFrom(ctx context.Context) int {
+	n, _ := ctx.Value(candidatesKey{}).(int)
+	return n
+}
+
+// dedupeCandidates 去掉空白和重复的候选 (忽略首尾和连续空白的差异), 保持原有顺序
+func dedupeCandidates(candidates []string) []string {
+	seen := make(map[string]bool, len(candidates))
+	var out []string
+	for _, c := range candidates {
+		key := strings.Join(strings.Fields(c), " ")
+		if key == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		out = append(out, c)
+	}
+	return out
+}
+
+// assembleResponse 大模型返回多个 choice 或工具循环产生多段回答时, 按配置的策略只保留一个, 而不是简单拼接
+func (cc *ChatClient) assembleResponse(ctx context.Context, sessionID string, stats *turnStats, model, question string, candidates []string) string {
+	candidates = dedupeCandidates(candidates)
+	switch len(candidates) {
+	case 0:
+		return ""
+	case 1:
+		return candidates[0]
+	}
+
+	strategy := ResponseFirst
+	if cc.response != nil && cc.response.Strategy != "" {
+		strategy = cc.response.Strategy
+	}
+	switch strategy {
+	case ResponseLongest:
+		longest := candidates[0]
+		for _, c := range candidates[1:] {
+			if len([]rune(c)) > len([]rune(longest)) {
+				longest = c
+			}
+		}
+		return longest
+	case ResponseRerank:
+		if i, ok := cc.rerank(ctx, sessionID, stats, model, question, candidates); ok {
+			return candidates[i]
+		}
+	}
+	return candidates[0]
+}
+
+// rerank 把问题和编号的候选交给大模型, 要求只回复最好的候选的编号; 失败时返回 false
+func (cc *ChatClient) rerank(ctx context.Context, sessionID string, stats *turnStats, model, question string, candidates []string) (int, bool) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s\n\n", question)
+	for i, c := range candidates {
+		fmt.Fprintf(&b, "[%d]\n%s\n\n", i+1, c)
+	}
+	resp, err := cc.createChatCompletion(ctx, sessionID, stats, openai.ChatCompletionRequest{
+		Model: model,
+		Messages: []openai.ChatCompletionMessage{
+			{Role: openai.ChatMessageRoleSystem, Content: T(serverLocale, "response.rerank", len(candidates))},
+			{Role: openai.ChatMessageRoleUser, Content: b.String()},
+		},
+	})
+	if err != nil || len(resp.Choices) == 0 {
+		logf("response.rerank_failed", logTag(ctx, sessionID), err)
+		return 0, false
+	}
+	n, err := strconv.Atoi(firstNumberRe.FindString(resp.Choices[0].Message.Content))
+	if err != nil || n < 1 || n > len(candidates) {
+		logf("response.rerank_failed", logTag(ctx, sessionID), fmt.Errorf("unexpected reply %q", resp.Choices[0].Message.Content))
+		return 0, false
+	}
+	return n - 1, true
+}
+
+// offerChoices N-best 模式: 把每个候选分别经过翻译和内容策略后以 choice 消息发给客户端,
+// 等用户挑选 (见 Session.PickChoice); 只剩一个候选时直接作为回答写入历史
+func (cc *ChatClient) offerChoices(ctx context.Context, sess *Session, stats *turnStats, model string, candidates []string, emit func(*chat.ChatMessage)) (string, error) {
+	var choices []string
+	var lastErr error
+	for _, c := range dedupeCandidates(candidates) {
+		if language := sess.Language(); language != "" && cc.language != nil && cc.language.Translate {
+			c = cc.translate(ctx, sess.ID, stats, model, c, language)
+		}
+		c, err := cc.policy.Apply(policyOutput, cc.leaks.mask(ctx, sess.ID, c))
+		if err != nil {
+			// 被拦截的候选不提供给用户
+			lastErr = err
+			continue
+		}
+		choices = append(choices, c)
+	}
+	switch len(choices) {
+	case 0:
+		return "", lastErr
+	case 1:
+		sess.Append(openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: choices[0]})
+		return choices[0], nil
+	}
+	sess.SetChoices(choices)
+	for i, c := range choices {
+		emit(&chat.ChatMessage{Type: "choice", Role: openai.ChatMessageRoleAssistant, Content: c, Choice: int32(i), SessionId: sess.ID})
+	}
+	return "", nil
+}
@@ -0,0 +1,120 @@
+package host
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// 转移令牌缺省的有效期
+const defaultResumeTTL = 10 * time.Minute
+
+// resumeClaims 是转移令牌的内容: 令牌持有者可以以签发者的身份继续这个会话, 直到过期
+type resumeClaims struct {
+	SessionID string `json:"sid"`
+	User      string `json:"user,omitempty"` // 签发者, 匿名会话为空
+	Expires   int64  `json:"exp"`            // Unix 秒
+}
+
+// resumeSigner 签发和校验会话转移令牌, 令牌格式为 base64url(claims JSON).base64url(HMAC-SHA256)。
+// 不需要用户账号: 在一台设备上签发, 把链接或二维码交给另一台设备即可接着对话
+type resumeSigner struct {
+	key []byte
+	ttl time.Duration
+}
+
+// newResumeSigner 未配置 resume.secret 时使用随机密钥, 令牌只在本进程内有效 (重启或换到其他副本后失效)
+func newResumeSigner(cfg *ResumeConfig) *resumeSigner {
+	s := &resumeSigner{ttl: defaultResumeTTL}
+	if cfg != nil {
+		s.key = []byte(cfg.Secret)
+		if cfg.TTL > 0 {
+			s.ttl = time.Duration(cfg.TTL)
+		}
+	}
+	if len(s.key) == 0 {
+		s.key = make([]byte, 32)
+		_, _ = rand.Read(s.key)
+	}
+	return s
+}
+
+func (s *resumeSigner) sign(payload string) string {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// issue 为会话签发令牌, 返回令牌和过期时间
+func (s *resumeSigner) issue(sessionID, user string) (string, time.Time) {
+	expires := time.Now().Add(s.ttl).Truncate(time.Second)
+	data, _ := json.Marshal(resumeClaims{SessionID: sessionID, User: user, Expires: expires.Unix()})
+	payload := base64.RawURLEncoding.EncodeToString(data)
+	return payload + "." + s.sign(payload), expires
+}
+
+// verify 校验签名和有效期
+func (s *resumeSigner) verify(token string) (resumeClaims, bool) {
+	payload, sig, ok := strings.Cut(token, ".")
+	if !ok || !hmac.Equal([]byte(sig), []byte(s.sign(payload))) {
+		return resumeClaims{}, false
+	}
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return resumeClaims{}, false
+	}
+	var claims resumeClaims
+	if err := json.Unmarshal(data, &claims); err != nil || claims.SessionID == "" {
+		return resumeClaims{}, false
+	}
+	if time.Now().Unix() >= claims.Expires {
+		return resumeClaims{}, false
+	}
+	return claims, true
+}
+
+// resumeClaims 取请求带的转移令牌 (?resume= 或 X-Resume-Token 请求头), 没有或无效时返回 false
+func (cc *ChatClient) resumeClaims(r *http.Request) (resumeClaims, bool) {
+	token := r.URL.Query().Get("resume")
+	if token == "" {
+		token = r.Header.Get("X-Resume-Token")
+	}
+	if token == "" {
+		return resumeClaims{}, false
+	}
+	return cc.resume.verify(token)
+}
+
+// sessionUser 返回请求在会话中的身份: 凭转移令牌访问时是令牌的签发者, 否则是请求的用户
+func (cc *ChatClient) sessionUser(r *http.Request, sess *Session) string {
+	user := cc.userID(r)
+	if sess.CanAccess(user) {
+		return user
+	}
+	if claims, ok := cc.resumeClaims(r); ok && claims.SessionID == sess.ID {
+		return claims.User
+	}
+	return user
+}
+
+// POST /api/sessions/{id}/resume 为会话签发转移令牌, 返回 {"token": "...", "expires_at": "..."}。
+// 另一台设备以 /ws?resume=<token> 连接即可接着对话, 读取记录等 REST 接口也接受这个令牌
+func (cc *ChatClient) handleResumeToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, r, http.StatusMethodNotAllowed, "api.method_not_allowed")
+		return
+	}
+	sess, ok := cc.sessionFor(r, r.PathValue("id"))
+	if !ok {
+		writeError(w, r, http.StatusNotFound, "api.session_not_found")
+		return
+	}
+	token, expires := cc.resume.issue(sess.ID, cc.sessionUser(r, sess))
+	logf("session.resume_issued", sess.ID, expires.Format(time.RFC3339))
+	writeJSON(w, http.StatusOK, map[string]any{"token": token, "expires_at": expires})
+}
@@ -0,0 +1,293 @@
+package host
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+)
+
+// 工具参数 schema 的方言: 有的服务商只支持 JSON Schema 的一个子集, 遇到 $ref、anyOf 等关键字会拒绝整个请求,
+// 发给大模型之前把 MCP 服务的 InputSchema 改写成对应的子集
+const (
+	SchemaOpenAI = "openai" // 原样发送
+	SchemaBasic  = "basic"  // 展开 $ref, 组合关键字只保留一个分支, 去掉元数据关键字
+	SchemaGemini = "gemini" // 在 basic 的基础上只保留 Gemini (OpenAPI 3.0 子集) 支持的关键字, 用 nullable 表示可为 null
+)
+
+var schemaDialects = []string{SchemaOpenAI, SchemaBasic, SchemaGemini}
+
+// detectSchemaDialect 未配置 toolSchema 时按大模型接口地址推断
+func detectSchemaDialect(baseURL string) string {
+	if strings.Contains(baseURL, "generativelanguage.googleapis.com") {
+		return SchemaGemini
+	}
+	return SchemaOpenAI
+}
+
+// basic 方言删除的关键字, 这些关键字要么已经展开, 要么对大模型没有意义
+var schemaDropped = map[string]bool{
+	"$schema": true, "$id": true, "$anchor": true, "$comment": true, "$defs": true, "definitions": true,
+	"not": true, "if": true, "then": true, "else": true, "examples": true,
+	"patternProperties": true, "dependentRequired": true, "dependentSchemas": true,
+	"unevaluatedProperties": true, "unevaluatedItems": true, "propertyNames": true, "contains": true,
+}
+
+// Gemini 支持的关键字
+var geminiKeywords = map[string]bool{
+	"type": true, "format": true, "title": true, "description": true, "nullable": true, "enum": true,
+	"properties": true, "required": true, "items": true, "minItems": true, "maxItems": true,
+	"minProperties": true, "maxProperties": true, "minLength": true, "maxLength": true, "pattern": true,
+	"minimum": true, "maximum": true, "default": true,
+}
+
+// Gemini 只认这些 format, 其他的删除
+var geminiFormats = []string{"enum", "date-time", "int32", "int64", "float", "double"}
+
+// sanitizeSchema 按方言改写 schema, 返回新的对象, 不修改原始 schema
+func sanitizeSchema(dialect string, schema any) any {
+	if dialect == "" || dialect == SchemaOpenAI {
+		return schema
+	}
+	data, err := json.Marshal(schema)
+	if err != nil {
+		return schema
+	}
+	var root map[string]any
+	if err := json.Unmarshal(data, &root); err != nil {
+		return schema
+	}
+	s := &schemaSanitizer{dialect: dialect, root: root, resolving: map[string]bool{}}
+	return s.walk(root)
+}
+
+type schemaSanitizer struct {
+	dialect   string
+	root      map[string]any
+	resolving map[string]bool // 正在展开的 $ref, 遇到循环引用时不再展开
+}
+
+func (s *schemaSanitizer) walk(v map[string]any) map[string]any {
+	// $ref 展开为引用的 schema, 同级的其他关键字 (比如 description) 优先
+	if ref, ok := v["$ref"].(string); ok {
+		target, found := s.resolve(ref)
+		rest := without(v, "$ref")
+		if !found || s.resolving[ref] {
+			// 无法展开时退化为任意对象, 保留描述
+			return s.walk(merge(map[string]any{"type": "object"}, rest))
+		}
+		s.resolving[ref] = true
+		defer delete(s.resolving, ref)
+		return s.walk(merge(target, rest))
+	}
+
+	// allOf 合并各个分支
+	if all, ok := v["allOf"].([]any); ok {
+		merged := without(v, "allOf")
+		for _, branch := range all {
+			if m, ok := branch.(map[string]any); ok {
+				merged = mergeSchema(merged, s.walk(m))
+			}
+		}
+		return s.walk(merged)
+	}
+
+	// anyOf / oneOf 只保留第一个不是 null 的分支, 有 null 分支时标记为可为 null
+	nullable := false
+	for _, key := range []string{"anyOf", "oneOf"} {
+		branches, ok := v[key].([]any)
+		if !ok {
+			continue
+		}
+		var picked map[string]any
+		for _, branch := range branches {
+			m, ok := branch.(map[string]any)
+			if !ok {
+				continue
+			}
+			if m["type"] == "null" {
+				nullable = true
+			} else if picked == nil {
+				picked = m
+			}
+		}
+		rest := without(v, key)
+		if picked != nil {
+			rest = merge(picked, rest)
+		}
+		out := s.walk(rest)
+		if nullable {
+			s.markNullable(out)
+		}
+		return out
+	}
+
+	out := make(map[string]any, len(v))
+	for k, val := range v {
+		switch k {
+		case "type":
+			// ["string", "null"] 只保留第一个不是 null 的类型
+			if types, ok := val.([]any); ok {
+				for _, t := range types {
+					if t == "null" {
+						nullable = true
+					} else if _, set := out["type"]; !set {
+						out["type"] = t
+					}
+				}
+				continue
+			}
+			out[k] = val
+		case "const":
+			out["enum"] = []any{val}
+		case "properties":
+			props, ok := val.(map[string]any)
+			if !ok {
+				continue
+			}
+			walked := make(map[string]any, len(props))
+			for name, prop := range props {
+				if m, ok := prop.(map[string]any); ok {
+					walked[name] = s.walk(m)
+				}
+			}
+			out[k] = walked
+		case "items":
+			// 元组形式只保留第一个元素的 schema
+			if list, ok := val.([]any); ok && len(list) > 0 {
+				val = list[0]
+			}
+			if m, ok := val.(map[string]any); ok {
+				out[k] = s.walk(m)
+			}
+		case "additionalProperties":
+			if m, ok := val.(map[string]any); ok {
+				out[k] = s.walk(m)
+			} else {
+				out[k] = val
+			}
+		default:
+			if !schemaDropped[k] {
+				out[k] = val
+			}
+		}
+	}
+	// 缺少 type 时按 properties 或 enum 的值推断
+	if _, ok := out["type"]; !ok {
+		if _, hasProps := out["properties"]; hasProps {
+			out["type"] = "object"
+		} else if enum, ok := out["enum"].([]any); ok && len(enum) > 0 {
+			switch enum[0].(type) {
+			case string:
+				out["type"] = "string"
+			case float64:
+				out["type"] = "number"
+			case bool:
+				out["type"] = "boolean"
+			}
+		}
+	}
+	// required 中只保留存在的属性, 有的服务商遇到不存在的属性会报错
+	if req, ok := out["required"].([]any); ok {
+		props, _ := out["properties"].(map[string]any)
+		kept := make([]any, 0, len(req))
+		for _, name := range req {
+			if n, ok := name.(string); ok && props[n] != nil {
+				kept = append(kept, name)
+			}
+		}
+		if len(kept) == 0 {
+			delete(out, "required")
+		} else {
+			out["required"] = kept
+		}
+	}
+	if nullable {
+		s.markNullable(out)
+	}
+	if s.dialect == SchemaGemini {
+		for k := range out {
+			if !geminiKeywords[k] {
+				delete(out, k)
+			}
+		}
+		if f, ok := out["format"].(string); ok && !slices.Contains(geminiFormats, f) {
+			delete(out, "format")
+		}
+	}
+	return out
+}
+
+// markNullable 只有 Gemini 支持 nullable, 其他方言省略
+func (s *schemaSanitizer) markNullable(v map[string]any) {
+	if s.dialect == SchemaGemini {
+		v["nullable"] = true
+	}
+}
+
+// resolve 查找文档内的引用, 比如 #/$defs/Item, 不支持外部引用
+func (s *schemaSanitizer) resolve(ref string) (map[string]any, bool) {
+	pointer, ok := strings.CutPrefix(ref, "#")
+	if !ok {
+		return nil, false
+	}
+	var cur any = s.root
+	for _, part := range strings.Split(strings.TrimPrefix(pointer, "/"), "/") {
+		if part == "" {
+			continue
+		}
+		part = strings.NewReplacer("~1", "/", "~0", "~").Replace(part)
+		m, ok := cur.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		if cur, ok = m[part]; !ok {
+			return nil, false
+		}
+	}
+	m, ok := cur.(map[string]any)
+	return m, ok
+}
+
+// merge 返回 base 和 override 合并后的新对象, 相同的键取 override 中的值
+func merge(base, override map[string]any) map[string]any {
+	out := make(map[string]any, len(base)+len(override))
+	for k, v := range base {
+		out[k] = v
+	}
+	for k, v := range override {
+		out[k] = v
+	}
+	return out
+}
+
+// mergeSchema 合并 allOf 的分支: properties 和 required 取并集, 其他关键字后面的覆盖前面的
+func mergeSchema(a, b map[string]any) map[string]any {
+	out := merge(a, b)
+	pa, _ := a["properties"].(map[string]any)
+	pb, _ := b["properties"].(map[string]any)
+	if pa != nil && pb != nil {
+		out["properties"] = merge(pa, pb)
+	}
+	ra, _ := a["required"].([]any)
+	rb, _ := b["required"].([]any)
+	if ra != nil && rb != nil {
+		req := slices.Clone(ra)
+		for _, name := range rb {
+			if !slices.Contains(req, name) {
+				req = append(req, name)
+			}
+		}
+		out["required"] = req
+	}
+	return out
+}
+
+func without(v map[string]any, key string) map[string]any {
+	out := make(map[string]any, len(v))
+	for k, val := range v {
+		if k != key {
+			out[k] = val
+		}
+	}
+	return out
+}
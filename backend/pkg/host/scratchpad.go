@@ -0,0 +1,104 @@
+package host
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// 一轮中工具结果达到多少个时汇总到草稿, 缺省值
+const defaultScratchpadMinResults = 2
+
+// ToolResult 是一次工具调用的结果
+type ToolResult struct {
+	Tool    string
+	Content string
+}
+
+// SummarizeRequest 是交给 Summarizer 的内容
+type SummarizeRequest struct {
+	Question   string       // 本轮用户的问题
+	Scratchpad string       // 之前的草稿, 第一次汇总时为空
+	Results    []ToolResult // 本轮新得到的工具结果
+}
+
+// Summarizer 把新的工具结果合并进会话的草稿 (scratchpad), 返回更新后的草稿。
+// 嵌入时可以通过 Options.Summarizer 换成自己的实现, 缺省用 scratchpad.model 指定的大模型
+type Summarizer interface {
+	Summarize(ctx context.Context, req SummarizeRequest) (string, error)
+}
+
+// condenseResults 配置了草稿时把本轮的工具结果汇总到会话的草稿中, 工具消息只保留指向草稿的占位文字,
+// 之后的大模型请求通过草稿而不是原始结果了解工具的输出。临时工具的结果不参与汇总; 汇总失败时保留原始结果
+func (cc *ChatClient) condenseResults(ctx context.Context, sess *Session, stats *turnStats, question string, msgs []openai.ChatCompletionMessage, servers map[string]*MCPClient) {
+	var results []ToolResult
+	var indexes []int
+	for i, msg := range msgs {
+		if servers[msg.Name].ephemeral(msg.Name) {
+			continue
+		}
+		results = append(results, ToolResult{Tool: msg.Name, Content: msg.Content})
+		indexes = append(indexes, i)
+	}
+	minResults := cc.scratchpad.MinResults
+	if minResults == 0 {
+		minResults = defaultScratchpadMinResults
+	}
+	if len(results) < minResults {
+		return
+	}
+
+	summary, err := cc.summarize(ctx, sess.ID, stats, SummarizeRequest{Question: question, Scratchpad: sess.Scratchpad(), Results: results})
+	if err != nil {
+		logf("scratchpad.failed", logTag(ctx, sess.ID), err)
+		return
+	}
+	sess.SetScratchpad(summary)
+	for _, i := range indexes {
+		msgs[i].Content = T(serverLocale, "prompt.scratchpad_ref", msgs[i].Name)
+	}
+}
+
+// summarize 使用 Options.Summarizer, 没有时调用 scratchpad.model (缺省为对话使用的模型)
+func (cc *ChatClient) summarize(ctx context.Context, sessionID string, stats *turnStats, req SummarizeRequest) (string, error) {
+	if cc.summarizer != nil {
+		return cc.summarizer.Summarize(ctx, req)
+	}
+	model := cc.scratchpad.Model
+	if model == "" {
+		model = cc.model
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s\n\n", req.Question)
+	if req.Scratchpad != "" {
+		fmt.Fprintf(&b, "[scratchpad]\n%s\n\n", req.Scratchpad)
+	}
+	for _, r := range req.Results {
+		fmt.Fprintf(&b, "[%s]\n%s\n\n", r.Tool, r.Content)
+	}
+	resp, err := cc.createChatCompletion(ctx, sessionID, stats, openai.ChatCompletionRequest{
+		Model: model,
+		Messages: []openai.ChatCompletionMessage{
+			{Role: openai.ChatMessageRoleSystem, Content: T(serverLocale, "scratchpad.prompt")},
+			{Role: openai.ChatMessageRoleUser, Content: b.String()},
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(resp.Choices) == 0 || resp.Choices[0].Message.Content == "" {
+		return "", newError("scratchpad.empty")
+	}
+	return resp.Choices[0].Message.Content, nil
+}
+
+// scratchpadMessage 把会话的草稿作为系统消息交给大模型
+func scratchpadMessage(sess *Session) (openai.ChatCompletionMessage, bool) {
+	scratchpad := sess.Scratchpad()
+	if scratchpad == "" {
+		return openai.ChatCompletionMessage{}, false
+	}
+	return openai.ChatCompletionMessage{Role: openai.ChatMessageRoleSystem, Content: T(serverLocale, "prompt.scratchpad", scratchpad)}, true
+}
@@ -0,0 +1,245 @@
+package host
+
+import (
+	"database/sql"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/sashabaranov/go-openai"
+)
+
+// 三元组分词的最短查询长度, 更短的查询 (比如两个汉字) 退回到 LIKE 扫描
+const minTrigramQuery = 3
+
+// SearchIndex 用 SQLite FTS5 为用户和助理消息建立全文索引
+// 使用 trigram 分词, 中文不需要额外的分词器; 需要以 -tags sqlite_fts5 编译
+type SearchIndex struct {
+	db *sql.DB
+	mu sync.Mutex // 串行写入, 避免 database is locked
+
+	// 会话的轮次计数, 第 n 条用户消息开始第 n 轮
+	turns map[string]int
+}
+
+// SearchHit 是一条命中的消息
+type SearchHit struct {
+	SessionID string    `json:"session_id"`
+	Index     int       `json:"index"` // 消息在会话中的序号, 可用于 /api/sessions/{id}/messages?offset=
+	Turn      int       `json:"turn"`  // 所在轮次, 从 1 开始
+	Role      string    `json:"role"`
+	Snippet   string    `json:"snippet"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func NewSearchIndex(path string) (*SearchIndex, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("sqlite3", path+"?_journal_mode=WAL&_busy_timeout=5000")
+	if err != nil {
+		return nil, err
+	}
+	_, err = db.Exec(`CREATE VIRTUAL TABLE IF NOT EXISTS messages USING fts5(
+		content,
+		session_id UNINDEXED,
+		user_id UNINDEXED,
+		role UNINDEXED,
+		idx UNINDEXED,
+		turn UNINDEXED,
+		created_at UNINDEXED,
+		tokenize = 'trigram'
+	)`)
+	if err != nil {
+		db.Close()
+		return nil, newError("search.init_failed", err)
+	}
+	return &SearchIndex{db: db, turns: make(map[string]int)}, nil
+}
+
+// Index 只索引有内容的用户和助理消息
+func (si *SearchIndex) Index(sessionID, userID string, msgs ...HistoryMessage) error {
+	si.mu.Lock()
+	defer si.mu.Unlock()
+
+	turn, ok := si.turns[sessionID]
+	if !ok {
+		// 服务重启后从索引中恢复轮次
+		_ = si.db.QueryRow(`SELECT COALESCE(MAX(turn), 0) FROM messages WHERE session_id = ?`, sessionID).Scan(&turn)
+	}
+
+	tx, err := si.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, m := range msgs {
+		if m.Role == openai.ChatMessageRoleUser {
+			turn++
+		}
+		if m.Content == "" || (m.Role != openai.ChatMessageRoleUser && m.Role != openai.ChatMessageRoleAssistant) {
+			continue
+		}
+		_, err := tx.Exec(`INSERT INTO messages (content, session_id, user_id, role, idx, turn, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			m.Content, sessionID, userID, m.Role, m.Index, turn, m.CreatedAt.UTC().Format(time.RFC3339Nano))
+		if err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	si.turns[sessionID] = turn
+	return nil
+}
+
+// Search 在 userID 的消息中搜索, sessionID 不为空时只搜索该会话
+func (si *SearchIndex) Search(q, userID, sessionID string, limit int) ([]SearchHit, error) {
+	where := `user_id = ?`
+	args := []any{userID}
+	if sessionID != "" {
+		where += ` AND session_id = ?`
+		args = append(args, sessionID)
+	}
+
+	var query string
+	if utf8.RuneCountInString(q) >= minTrigramQuery {
+		// 按短语匹配, 避免查询中的 FTS5 语法字符
+		query = `SELECT session_id, idx, turn, role, snippet(messages, 0, '[', ']', '...', 16), created_at
+			FROM messages WHERE messages MATCH ? AND ` + where + ` ORDER BY rank LIMIT ?`
+		args = append([]any{`"` + strings.ReplaceAll(q, `"`, `""`) + `"`}, args...)
+	} else {
+		query = `SELECT session_id, idx, turn, role, content, created_at
+			FROM messages WHERE content LIKE ? ESCAPE '\' AND ` + where + ` ORDER BY created_at DESC LIMIT ?`
+		args = append([]any{"%" + escapeLike(q) + "%"}, args...)
+	}
+	args = append(args, limit)
+
+	rows, err := si.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	hits := []SearchHit{}
+	for rows.Next() {
+		var h SearchHit
+		var created string
+		if err := rows.Scan(&h.SessionID, &h.Index, &h.Turn, &h.Role, &h.Snippet, &created); err != nil {
+			return nil, err
+		}
+		h.CreatedAt, _ = time.Parse(time.RFC3339Nano, created)
+		hits = append(hits, h)
+	}
+	return hits, rows.Err()
+}
+
+// Purge 删除 userID 的所有消息, dryRun 时只统计, 返回删除 (或将要删除) 的消息数
+func (si *SearchIndex) Purge(userID string, dryRun bool) (int, error) {
+	si.mu.Lock()
+	defer si.mu.Unlock()
+	var n int
+	if err := si.db.QueryRow(`SELECT COUNT(*) FROM messages WHERE user_id = ?`, userID).Scan(&n); err != nil {
+		return 0, err
+	}
+	if dryRun || n == 0 {
+		return n, nil
+	}
+	if _, err := si.db.Exec(`DELETE FROM messages WHERE user_id = ?`, userID); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// Remove 删除会话中这些序号的消息, 用于清除用户在他人会话中发送的消息; dryRun 时只统计, 返回删除 (或将要删除) 的消息数
+func (si *SearchIndex) Remove(sessionID string, idxs []int, dryRun bool) (int, error) {
+	si.mu.Lock()
+	defer si.mu.Unlock()
+	tx, err := si.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	total := 0
+	for _, idx := range idxs {
+		var n int
+		if err := tx.QueryRow(`SELECT COUNT(*) FROM messages WHERE session_id = ? AND idx = ?`, sessionID, idx).Scan(&n); err != nil {
+			return 0, err
+		}
+		total += n
+		if dryRun || n == 0 {
+			continue
+		}
+		if _, err := tx.Exec(`DELETE FROM messages WHERE session_id = ? AND idx = ?`, sessionID, idx); err != nil {
+			return 0, err
+		}
+	}
+	if dryRun {
+		return total, nil
+	}
+	return total, tx.Commit()
+}
+
+// Truncate 删除会话中序号不小于 n 的消息, 用于回滚到检查点
+func (si *SearchIndex) Truncate(sessionID string, n int) error {
+	si.mu.Lock()
+	defer si.mu.Unlock()
+	// 轮次下次索引时从剩下的消息中重新计算
+	delete(si.turns, sessionID)
+	_, err := si.db.Exec(`DELETE FROM messages WHERE session_id = ? AND idx >= ?`, sessionID, n)
+	return err
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+func (si *SearchIndex) Close() error {
+	return si.db.Close()
+}
+
+// GET /api/search?q=关键词&limit=20&session_id=
+// 登录用户搜索自己的全部会话; 匿名用户必须指定 session_id, 只能搜索该会话
+func (cc *ChatClient) handleSearch(w http.ResponseWriter, r *http.Request) {
+	if cc.search == nil {
+		writeError(w, r, http.StatusNotFound, "api.search_disabled")
+		return
+	}
+	q := strings.TrimSpace(r.URL.Query().Get("q"))
+	if q == "" {
+		writeError(w, r, http.StatusBadRequest, "api.missing_query")
+		return
+	}
+	user := cc.userID(r)
+	sessionID := r.URL.Query().Get("session_id")
+	if sessionID != "" {
+		if _, ok := cc.sessionFor(r, sessionID); !ok {
+			writeError(w, r, http.StatusNotFound, "api.session_not_found")
+			return
+		}
+	} else if user == "" {
+		writeError(w, r, http.StatusBadRequest, "api.missing_session_id")
+		return
+	}
+	limit := queryInt(r, "limit", defaultPageSize)
+	if limit == 0 {
+		limit = defaultPageSize
+	}
+	limit = min(limit, maxPageSize)
+
+	if sessionID == "" && cc.softDeletes.hidden(user) {
+		writeJSON(w, http.StatusOK, map[string]any{"query": q, "hits": []SearchHit{}})
+		return
+	}
+	hits, err := cc.search.Search(q, user, sessionID, limit)
+	if err != nil {
+		logf("search.query_failed", q, err)
+		writeError(w, r, http.StatusInternalServerError, "error.request_failed")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"query": q, "hits": hits})
+}
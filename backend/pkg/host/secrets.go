@@ -0,0 +1,177 @@
+package host
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// SecretProvider 按引用读取密钥, 配置中形如 {"fromEnv": "X"} 的对象在加载时替换为读到的字符串
+type SecretProvider interface {
+	Resolve(ctx context.Context, ref string) (string, error)
+}
+
+// newSecretProviders 返回可用的密钥来源, 键是配置中的字段名; 新的来源 (比如云厂商的密钥管理服务) 在这里注册
+// 相对的文件路径按配置文件所在目录解析
+func newSecretProviders(configDir string) map[string]SecretProvider {
+	return map[string]SecretProvider{
+		"fromEnv":   envSecrets{},
+		"fromFile":  fileSecrets{dir: configDir},
+		"fromVault": &vaultSecrets{cache: map[string]map[string]any{}},
+	}
+}
+
+type envSecrets struct{}
+
+func (envSecrets) Resolve(_ context.Context, name string) (string, error) {
+	v, ok := os.LookupEnv(name)
+	if !ok {
+		return "", newError("secrets.env_unset", name)
+	}
+	return v, nil
+}
+
+// fileSecrets 读取文件内容 (比如 docker/k8s 挂载的 /run/secrets/...), 去掉末尾的换行
+type fileSecrets struct {
+	dir string
+}
+
+func (s fileSecrets) Resolve(_ context.Context, path string) (string, error) {
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(s.dir, path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// vaultSecrets 通过 HTTP API 读取 HashiCorp Vault 中的密钥, 引用格式为 <path>#<key>,
+// 地址和令牌取自 VAULT_ADDR, VAULT_TOKEN (可选 VAULT_NAMESPACE); 同一次加载中相同 path 只请求一次
+type vaultSecrets struct {
+	cache map[string]map[string]any
+}
+
+func (s *vaultSecrets) Resolve(ctx context.Context, ref string) (string, error) {
+	path, key, ok := strings.Cut(ref, "#")
+	if !ok || path == "" || key == "" {
+		return "", newError("secrets.vault_ref", ref)
+	}
+	data, ok := s.cache[path]
+	if !ok {
+		var err error
+		if data, err = s.read(ctx, path); err != nil {
+			return "", err
+		}
+		s.cache[path] = data
+	}
+	v, ok := data[key]
+	if !ok {
+		return "", newError("secrets.vault_key", key, path)
+	}
+	if str, ok := v.(string); ok {
+		return str, nil
+	}
+	return fmt.Sprint(v), nil
+}
+
+func (s *vaultSecrets) read(ctx context.Context, path string) (map[string]any, error) {
+	addr, token := os.Getenv("VAULT_ADDR"), os.Getenv("VAULT_TOKEN")
+	if addr == "" || token == "" {
+		return nil, newError("secrets.vault_env")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimRight(addr, "/")+"/v1/"+strings.TrimLeft(path, "/"), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", token)
+	if ns := os.Getenv("VAULT_NAMESPACE"); ns != "" {
+		req.Header.Set("X-Vault-Namespace", ns)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, newError("secrets.vault_status", path, resp.Status)
+	}
+	var body struct {
+		Data map[string]any `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, err
+	}
+	// KV v2 的值在 data.data 中, KV v1 直接在 data 中
+	if inner, ok := body.Data["data"].(map[string]any); ok {
+		if _, hasMeta := body.Data["metadata"]; hasMeta {
+			return inner, nil
+		}
+	}
+	return body.Data, nil
+}
+
+// resolveSecrets 把配置中的密钥引用替换为实际的值, 之后按普通字符串解码和校验
+func (d *configDoc) resolveSecrets() []error {
+	var raw any
+	if err := json.Unmarshal(d.data, &raw); err != nil {
+		return nil // 语法错误由 decode 报告
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	providers := newSecretProviders(filepath.Dir(d.file))
+
+	var errs []error
+	replaced := false
+	var walk func(path string, v any) any
+	walk = func(path string, v any) any {
+		switch val := v.(type) {
+		case map[string]any:
+			if len(val) == 1 {
+				for name, ref := range val {
+					provider, ok := providers[name]
+					if !ok {
+						break
+					}
+					refStr, ok := ref.(string)
+					if !ok {
+						errs = append(errs, d.errorAt(joinPath(path, name), -1, d.t("config.secret_ref")))
+						return v
+					}
+					secret, err := provider.Resolve(ctx, refStr)
+					if err != nil {
+						errs = append(errs, d.errorAt(path, -1, d.t("config.secret_failed", localize(err, d.locale))))
+						return v
+					}
+					replaced = true
+					return secret
+				}
+			}
+			for _, k := range sortedKeys(val) {
+				val[k] = walk(joinPath(path, k), val[k])
+			}
+		case []any:
+			for i, item := range val {
+				val[i] = walk(fmt.Sprintf("%s[%d]", path, i), item)
+			}
+		}
+		return v
+	}
+	raw = walk("", raw)
+	if len(errs) > 0 || !replaced {
+		return errs
+	}
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return []error{d.errorAt("", -1, err.Error())}
+	}
+	d.data = data
+	d.converted = true
+	return nil
+}
@@ -0,0 +1,109 @@
+package host
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// 启动自检缺省的超时
+const defaultSelfTestTimeout = 30 * time.Second
+
+// ExitProviderMisconfigured 是大模型接口不可用 (环境变量缺失、密钥、地址或模型名错误) 时 mcp-host 的退出码
+const ExitProviderMisconfigured = 3
+
+// ProviderError 表示大模型接口配置错误, 命令行据此以 ExitProviderMisconfigured 退出
+type ProviderError struct {
+	Err error
+}
+
+func (e *ProviderError) Error() string { return e.Err.Error() }
+func (e *ProviderError) Unwrap() error { return e.Err }
+
+// ExitCode 是命令行的退出码
+func (e *ProviderError) ExitCode() int { return ExitProviderMisconfigured }
+
+// StartupReport 是启动自检的结果
+type StartupReport struct {
+	Model      string
+	LLMLatency time.Duration
+	LLMError   error // 为 nil 时大模型可用
+	Servers    []ServerReport
+}
+
+// ServerReport 是一个 MCP 服务的自检结果
+type ServerReport struct {
+	Name    string
+	Tools   int
+	Latency time.Duration
+	Error   error
+}
+
+// SelfTest 用一次最小的补全请求检查大模型接口, 并获取所有 MCP 服务的工具, 把结果写入日志。
+// 大模型接口配置错误时返回 *ProviderError; 限流或服务端错误等临时故障和 MCP 服务的故障只记录日志
+func (e *Engine) SelfTest(ctx context.Context) (*StartupReport, error) {
+	cc := e.cc
+	report := &StartupReport{Model: cc.model}
+
+	var wg sync.WaitGroup
+	servers := cc.servers()
+	report.Servers = make([]ServerReport, len(servers))
+	for i, c := range servers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			start := time.Now()
+			tools, err := listServerTools(ctx, c)
+			report.Servers[i] = ServerReport{Name: c.Name, Tools: len(tools), Latency: time.Since(start), Error: err}
+		}()
+	}
+
+	start := time.Now()
+	_, err := cc.provider.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
+		Model:     cc.model,
+		Messages:  []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "ping"}},
+		MaxTokens: 1,
+	})
+	report.LLMLatency, report.LLMError = time.Since(start), err
+	wg.Wait()
+
+	if err == nil {
+		logf("startup.llm_ok", cc.model, report.LLMLatency.Round(time.Millisecond))
+	} else {
+		logf("startup.llm_failed", cc.model, err)
+	}
+	ok, tools := 0, 0
+	for _, s := range report.Servers {
+		if s.Error != nil {
+			logf("startup.server_failed", s.Name, s.Error)
+			continue
+		}
+		ok++
+		tools += s.Tools
+		logf("startup.server_ok", s.Name, s.Tools, s.Latency.Round(time.Millisecond))
+	}
+	logf("startup.report", ok, len(report.Servers), tools)
+
+	if err != nil && !transientLLMError(err) {
+		return report, &ProviderError{Err: newError("startup.provider_misconfigured", cc.model, err)}
+	}
+	return report, nil
+}
+
+// transientLLMError 限流和服务端错误可能很快恢复, 不因此拒绝启动
+func transientLLMError(err error) bool {
+	status := 0
+	var apiErr *openai.APIError
+	var reqErr *openai.RequestError
+	switch {
+	case errors.As(err, &apiErr):
+		status = apiErr.HTTPStatusCode
+	case errors.As(err, &reqErr):
+		status = reqErr.HTTPStatusCode
+	}
+	return status == http.StatusTooManyRequests || status >= http.StatusInternalServerError
+}
@@ -0,0 +1,703 @@
+package host
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+const sessionEvictInterval = time.Minute
+
+var sessionsEvicted = metrics.Counter("sessions_evicted_total", "Number of idle sessions removed from the in-memory cache.")
+
+// HistoryMessage 是保存在会话中的一条消息
+type HistoryMessage struct {
+	Index      int               `json:"index"`
+	Role       string            `json:"role"`
+	Content    string            `json:"content"`
+	ToolCalls  []openai.ToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string            `json:"tool_call_id,omitempty"`
+	Name       string            `json:"name,omitempty"`     // role 为 tool 时记录工具名
+	Variants   map[string]string `json:"variants,omitempty"` // 生成该消息时所在的实验分组
+	UserID     string            `json:"user_id,omitempty"`  // 会话所属用户, 匿名会话为空
+	Sender     string            `json:"sender,omitempty"`   // 发送这条用户消息的用户, 多人会话中区分参与者
+	Language   string            `json:"language,omitempty"` // 会话的回答语言
+	CreatedAt  time.Time         `json:"created_at"`
+	Pinned     bool              `json:"pinned,omitempty"` // 裁剪上下文时始终保留, 只在 History 中设置
+
+	redacted string // 非空时 Content 是临时工具的原始结果, 只在本轮对话中使用, 持久化的是这里的占位文字
+}
+
+// Session 表示一次对话, 保存多轮对话的历史消息
+type Session struct {
+	ID        string
+	CreatedAt time.Time
+
+	// turnMu 保证同一会话同一时间只处理一轮对话, 多副本时还要加分布式锁, 见 SessionStore.BeginTurn
+	turnMu   sync.Mutex
+	lastUsed atomic.Int64 // 最后一次取用或结束一轮对话的时间 (UnixNano), 用于移出空闲的会话
+
+	mu           sync.RWMutex
+	messages     []HistoryMessage
+	variants     map[string]string // 当前所在的实验分组, 写入之后追加的消息
+	userID       string
+	language     string              // 回答使用的语言, 为空时不限制
+	choices      []string            // N-best 模式下等待用户挑选的候选回答, 只保存在内存中
+	pins         map[int]bool        // 固定的消息序号, 只保存在内存中, 进程重启后失效
+	outboxes     map[string]*outbox  // 客户端启用确认时尚未确认的消息, 按参与者区分
+	audience     audience            // 会话的所有连接, 包括只读旁观的连接
+	participants map[string]bool     // 所有者之外可以参与对话的用户, 只保存在内存中
+	scratchpad   string              // 工具结果的累积摘要, 见 condenseResults, 只保存在内存中
+	debug        bool                // 每轮下发各阶段的耗时, 只保存在内存中
+	debugContext bool                // 向管理员的连接下发每次发给大模型的上下文, 只保存在内存中
+	preferences  ResponsePreferences // 回答的长度和格式要求, 只保存在内存中
+	checkpoints  []Checkpoint        // 命名的检查点, 按创建顺序排列, 只保存在内存中
+	store        HistoryStore        // 为 nil 时不持久化
+	index        MessageIndex        // 为 nil 时不建立搜索索引
+}
+
+// MessageIndex 在消息写入会话时建立索引, 比如全文搜索
+type MessageIndex interface {
+	Index(sessionID, userID string, msgs ...HistoryMessage) error
+}
+
+// TruncatableIndex 可以删除会话中某条之后的消息的索引, 用于回滚到检查点
+type TruncatableIndex interface {
+	MessageIndex
+	Truncate(sessionID string, n int) error // 删除序号不小于 n 的消息
+}
+
+func (s *Session) touch() {
+	s.lastUsed.Store(time.Now().UnixNano())
+}
+
+// UserID 返回会话所属用户, 匿名会话为空
+func (s *Session) UserID() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.userID
+}
+
+func (s *Session) Append(msgs ...openai.ChatCompletionMessage) {
+	s.append("", "", msgs...)
+}
+
+// Scratchpad 返回工具结果的累积摘要, 没有时为空
+func (s *Session) Scratchpad() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.scratchpad
+}
+
+func (s *Session) SetScratchpad(scratchpad string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.scratchpad = scratchpad
+}
+
+// AppendUser 追加用户消息并记录发送者; 多人会话中用 name 告诉大模型是哪位参与者说的
+func (s *Session) AppendUser(sender, content string) {
+	msg := openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: content}
+	if s.Collaborative() && sender != "" {
+		msg.Name = senderName(sender)
+	}
+	s.append("", sender, msg)
+}
+
+// AppendEphemeral 追加临时工具 (ephemeral) 的结果: 本轮对话的上下文中使用原始内容,
+// 持久化和搜索索引只写入占位文字, 本轮结束时 (ForgetEphemeral) 内存中的内容也替换为占位文字
+func (s *Session) AppendEphemeral(placeholder string, msg openai.ChatCompletionMessage) {
+	s.append(placeholder, "", msg)
+}
+
+// ForgetEphemeral 把临时工具的原始结果替换为占位文字, 之后的对话中大模型看不到原始内容
+func (s *Session) ForgetEphemeral() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.messages {
+		if m := &s.messages[i]; m.redacted != "" {
+			m.Content, m.redacted = m.redacted, ""
+		}
+	}
+}
+
+func (s *Session) append(placeholder, sender string, msgs ...openai.ChatCompletionMessage) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	added := make([]HistoryMessage, 0, len(msgs))
+	for _, m := range msgs {
+		hm := HistoryMessage{
+			Index:      len(s.messages),
+			Role:       m.Role,
+			Content:    m.Content,
+			ToolCalls:  m.ToolCalls,
+			ToolCallID: m.ToolCallID,
+			Name:       m.Name,
+			Variants:   s.variants,
+			UserID:     s.userID,
+			Sender:     sender,
+			Language:   s.language,
+			CreatedAt:  time.Now(),
+		}
+		stored := hm
+		if placeholder != "" {
+			stored.Content = placeholder
+			hm.redacted = placeholder
+		}
+		s.messages = append(s.messages, hm)
+		added = append(added, stored)
+	}
+	if s.store != nil {
+		if err := s.store.Append(s.ID, added...); err != nil {
+			logf("history.save_failed", s.ID, err)
+		}
+	}
+	if s.index != nil {
+		if err := s.index.Index(s.ID, s.userID, added...); err != nil {
+			logf("search.index_failed", s.ID, err)
+		}
+	}
+}
+
+// outboxFor 返回参与者 user 的 outbox, 同一用户的多个连接 (比如断线重连) 共用一个
+func (s *Session) outboxFor(user string) *outbox {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.outboxes == nil {
+		s.outboxes = make(map[string]*outbox)
+	}
+	o, ok := s.outboxes[user]
+	if !ok {
+		o = &outbox{}
+		s.outboxes[user] = o
+	}
+	return o
+}
+
+// CanAccess user 是否可以访问会话: 匿名会话任何人凭 id 都可以访问, 否则只有所有者和参与者
+func (s *Session) CanAccess(user string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.userID == "" || s.userID == user || s.participants[user]
+}
+
+// AddParticipant 允许 user 参与对话
+func (s *Session) AddParticipant(user string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.participants == nil {
+		s.participants = make(map[string]bool)
+	}
+	s.participants[user] = true
+}
+
+func (s *Session) RemoveParticipant(user string) {
+	s.mu.Lock()
+	delete(s.participants, user)
+	s.mu.Unlock()
+}
+
+// Participants 返回所有者之外的参与者, 按用户名排序
+func (s *Session) Participants() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return sortedKeys(s.participants)
+}
+
+// Collaborative 是否有所有者之外的参与者
+func (s *Session) Collaborative() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.participants) > 0
+}
+
+// SetVariants 设置之后追加的消息所属的实验分组
+func (s *Session) SetVariants(variants map[string]string) {
+	s.mu.Lock()
+	s.variants = variants
+	s.mu.Unlock()
+}
+
+// Variants 返回会话当前的实验分组, 从历史恢复的会话取最后一条消息的记录
+func (s *Session) Variants() map[string]string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.variants != nil || len(s.messages) == 0 {
+		return s.variants
+	}
+	return s.messages[len(s.messages)-1].Variants
+}
+
+// SetLanguage 设置之后的回答使用的语言
+func (s *Session) SetLanguage(language string) {
+	s.mu.Lock()
+	s.language = language
+	s.mu.Unlock()
+}
+
+// Language 返回会话的回答语言, 从历史恢复的会话取最后一条消息的记录
+func (s *Session) Language() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.language != "" || len(s.messages) == 0 {
+		return s.language
+	}
+	return s.messages[len(s.messages)-1].Language
+}
+
+// SetPreferences 设置之后的回答的长度和格式要求
+func (s *Session) SetPreferences(p ResponsePreferences) {
+	s.mu.Lock()
+	s.preferences = p
+	s.mu.Unlock()
+}
+
+func (s *Session) Preferences() ResponsePreferences {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.preferences
+}
+
+// SetDebug 开启或关闭调试, 开启后每轮对话下发各阶段的耗时
+func (s *Session) SetDebug(debug bool) {
+	s.mu.Lock()
+	s.debug = debug
+	s.mu.Unlock()
+}
+
+func (s *Session) Debug() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.debug
+}
+
+// SetDebugContext 开启或关闭上下文调试, 开启后管理员的连接收到每次发给大模型的上下文 (脱敏后)
+func (s *Session) SetDebugContext(on bool) {
+	s.mu.Lock()
+	s.debugContext = on
+	s.mu.Unlock()
+}
+
+func (s *Session) DebugContext() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.debugContext
+}
+
+// SetChoices 保存等待用户挑选的候选回答, 选定之前不写入历史
+func (s *Session) SetChoices(choices []string) {
+	s.mu.Lock()
+	s.choices = choices
+	s.mu.Unlock()
+}
+
+// HasChoices 是否有等待挑选的候选回答
+func (s *Session) HasChoices() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.choices) > 0
+}
+
+// PickChoice 把第 i 个候选作为助理的回答写入历史, 其余候选丢弃
+func (s *Session) PickChoice(i int) (string, bool) {
+	s.mu.Lock()
+	if i < 0 || i >= len(s.choices) {
+		s.mu.Unlock()
+		return "", false
+	}
+	picked := s.choices[i]
+	s.choices = nil
+	s.mu.Unlock()
+
+	s.Append(openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: picked})
+	return picked, true
+}
+
+// Pin 固定一条消息, 裁剪上下文时始终保留, 消息不存在或不能固定时返回 false
+func (s *Session) Pin(index int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if index < 0 || index >= len(s.messages) || !pinnable(s.messages[index]) {
+		return false
+	}
+	if s.pins == nil {
+		s.pins = make(map[int]bool)
+	}
+	s.pins[index] = true
+	return true
+}
+
+// Unpin 取消固定
+func (s *Session) Unpin(index int) {
+	s.mu.Lock()
+	delete(s.pins, index)
+	s.mu.Unlock()
+}
+
+// Pins 返回固定的消息序号, 从小到大排列
+func (s *Session) Pins() []int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	pins := make([]int, 0, len(s.pins))
+	for i := range s.messages {
+		if s.pins[i] {
+			pins = append(pins, i)
+		}
+	}
+	return pins
+}
+
+// Messages 返回发给大模型的上下文, 按 cfg 裁剪较早的轮次, cfg 为 nil 时返回全部历史
+func (s *Session) Messages(cfg *ContextConfig) []openai.ChatCompletionMessage {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	window := contextMessages(s.messages, s.pins, cfg)
+	msgs := make([]openai.ChatCompletionMessage, 0, len(window))
+	for _, m := range window {
+		msg := openai.ChatCompletionMessage{
+			Role:       m.Role,
+			Content:    m.Content,
+			ToolCalls:  m.ToolCalls,
+			ToolCallID: m.ToolCallID,
+		}
+		// 工具名只用于历史查询, 不发给大模型
+		if m.Role != openai.ChatMessageRoleTool {
+			msg.Name = m.Name
+		}
+		msgs = append(msgs, msg)
+	}
+	return msgs
+}
+
+// History 返回历史消息的副本
+func (s *Session) History() []HistoryMessage {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	msgs := append([]HistoryMessage(nil), s.messages...)
+	for i := range msgs {
+		if msgs[i].redacted != "" {
+			msgs[i].Content, msgs[i].redacted = msgs[i].redacted, ""
+		}
+		msgs[i].Pinned = s.pins[i]
+	}
+	return msgs
+}
+
+// reload 用存储中的历史替换内存中的消息
+func (s *Session) reload(msgs []HistoryMessage) {
+	s.mu.Lock()
+	s.messages = msgs
+	s.mu.Unlock()
+}
+
+// SessionStore 在内存中缓存所有会话, 配置了 history 时从持久化存储中恢复
+type SessionStore struct {
+	mu       sync.RWMutex
+	sessions map[string]*Session
+	history  HistoryStore
+	shared   SharedHistoryStore // 多副本共享存储, 为 nil 时以内存缓存为准
+	index    MessageIndex
+	hidden   func(userID string) bool // 为 true 的用户的会话 Get 和 All 都取不到, 可以为 nil
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// SetIndex 设置消息索引, 之后创建或加载的会话都会写入索引
+func (st *SessionStore) SetIndex(index MessageIndex) {
+	st.index = index
+}
+
+// SetHidden 设置要隐藏会话的用户, 比如已经软删除、等待彻底清除的用户
+func (st *SessionStore) SetHidden(hidden func(userID string) bool) {
+	st.hidden = hidden
+}
+
+func (st *SessionStore) isHidden(s *Session) bool {
+	return st.hidden != nil && st.hidden(s.UserID())
+}
+
+func NewSessionStore(history HistoryStore) *SessionStore {
+	st := &SessionStore{sessions: make(map[string]*Session), history: history, stop: make(chan struct{})}
+	st.shared, _ = history.(SharedHistoryStore)
+	return st
+}
+
+// refresh 从共享存储重新读取历史, 其他副本可能已经追加了消息
+func (st *SessionStore) refresh(s *Session) {
+	msgs, err := st.shared.Load(s.ID)
+	if err != nil {
+		logf("history.load_failed", s.ID, err)
+		return
+	}
+	s.reload(msgs)
+}
+
+// BeginTurn 开始一轮对话, 返回的函数用于结束本轮
+// 共享存储时还会获取分布式锁并刷新历史, 保证多个副本不会同时处理同一会话
+func (st *SessionStore) BeginTurn(ctx context.Context, s *Session) (func(), error) {
+	s.turnMu.Lock()
+	if st.shared == nil {
+		return func() {
+			s.touch()
+			s.turnMu.Unlock()
+		}, nil
+	}
+	unlock, err := st.shared.LockTurn(ctx, s.ID)
+	if err != nil {
+		s.turnMu.Unlock()
+		return nil, err
+	}
+	st.refresh(s)
+	return func() {
+		unlock()
+		s.touch()
+		s.turnMu.Unlock()
+	}, nil
+}
+
+// Get 按 id 取会话, 内存中没有时从历史存储中加载; 隐藏的会话返回 false
+func (st *SessionStore) Get(id string) (*Session, bool) {
+	s, ok := st.get(id)
+	if !ok || st.isHidden(s) {
+		return nil, false
+	}
+	return s, true
+}
+
+// get 和 Get 相同, 但不管会话是否隐藏, 用于清除用户数据
+func (st *SessionStore) get(id string) (*Session, bool) {
+	if id == "" {
+		return nil, false
+	}
+	st.mu.RLock()
+	s, ok := st.sessions[id]
+	st.mu.RUnlock()
+	if ok {
+		s.touch()
+		if st.shared != nil {
+			st.refresh(s)
+		}
+	}
+	if ok || st.history == nil {
+		return s, ok
+	}
+
+	msgs, err := st.history.Load(id)
+	if err != nil {
+		if !errors.Is(err, ErrSessionNotFound) {
+			logf("history.load_failed", id, err)
+		}
+		return nil, false
+	}
+	s = &Session{ID: id, CreatedAt: time.Now(), messages: msgs, store: st.history, index: st.index}
+	if len(msgs) > 0 {
+		s.CreatedAt = msgs[0].CreatedAt
+		s.userID = msgs[0].UserID
+	}
+	s.touch()
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	// 并发加载时以先放入缓存的为准
+	if existing, ok := st.sessions[id]; ok {
+		return existing, true
+	}
+	st.sessions[id] = s
+	return s, true
+}
+
+// All 返回内存中缓存的所有会话 (本进程创建或加载过的会话), 不包括隐藏的会话
+func (st *SessionStore) All() []*Session {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+	sessions := make([]*Session, 0, len(st.sessions))
+	for _, s := range st.sessions {
+		if !st.isHidden(s) {
+			sessions = append(sessions, s)
+		}
+	}
+	return sessions
+}
+
+// Create 新建会话, userID 为空表示匿名会话
+func (st *SessionStore) Create(userID string) *Session {
+	s := &Session{ID: newID(), CreatedAt: time.Now(), userID: userID, store: st.history, index: st.index}
+	s.touch()
+	if st.shared != nil {
+		if err := st.shared.Create(s.ID); err != nil {
+			logf("history.save_failed", s.ID, err)
+		}
+	}
+	st.mu.Lock()
+	st.sessions[s.ID] = s
+	st.mu.Unlock()
+	return s
+}
+
+// OwnedBy 返回 userID 拥有的会话: 内存中缓存的, 以及历史存储中的 (存储支持按用户查找时)
+func (st *SessionStore) OwnedBy(userID string) ([]string, error) {
+	var ids []string
+	st.mu.RLock()
+	for id, s := range st.sessions {
+		if s.UserID() == userID {
+			ids = append(ids, id)
+		}
+	}
+	st.mu.RUnlock()
+	if ps, ok := st.history.(PurgeableHistoryStore); ok {
+		stored, err := ps.UserSessions(userID)
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range stored {
+			if !slices.Contains(ids, id) {
+				ids = append(ids, id)
+			}
+		}
+	}
+	slices.Sort(ids)
+	return ids, nil
+}
+
+// JoinedBy 返回 userID 参与、但由其他用户拥有的多人会话: 内存中 userID 是参与者或发送过消息的,
+// 以及历史存储中 userID 发送过消息的 (存储支持按用户查找时)
+func (st *SessionStore) JoinedBy(userID string) ([]string, error) {
+	var ids []string
+	st.mu.RLock()
+	for id, s := range st.sessions {
+		if s.UserID() == userID {
+			continue
+		}
+		s.mu.RLock()
+		joined := s.participants[userID] || len(redactSender(s.messages, userID, true)) > 0
+		s.mu.RUnlock()
+		if joined {
+			ids = append(ids, id)
+		}
+	}
+	st.mu.RUnlock()
+	if ps, ok := st.history.(PurgeableHistoryStore); ok {
+		stored, err := ps.SenderSessions(userID)
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range stored {
+			if !slices.Contains(ids, id) {
+				ids = append(ids, id)
+			}
+		}
+	}
+	slices.Sort(ids)
+	return ids, nil
+}
+
+// Redact 把会话中 sender 发送的消息替换为占位文字, 并取消 sender 的参与者身份, 返回替换的消息序号;
+// dryRun 时只返回序号。会话的其他消息不变, 所有者和其他参与者可以继续对话
+func (st *SessionStore) Redact(id, sender string, dryRun bool) ([]int, error) {
+	st.mu.RLock()
+	s, ok := st.sessions[id]
+	st.mu.RUnlock()
+	var idxs []int
+	if ok {
+		s.mu.Lock()
+		idxs = redactSender(s.messages, sender, dryRun)
+		if !dryRun {
+			delete(s.participants, sender)
+			delete(s.outboxes, sender)
+		}
+		s.mu.Unlock()
+	}
+	if ps, isPurgeable := st.history.(PurgeableHistoryStore); isPurgeable {
+		stored, err := ps.Redact(id, sender, dryRun)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			idxs = stored
+		}
+	}
+	return idxs, nil
+}
+
+// Delete 从缓存和历史存储中删除会话; 仍在使用这个会话的连接可以继续对话, 但之后的消息不再保存和索引
+func (st *SessionStore) Delete(id string) error {
+	st.mu.Lock()
+	s, ok := st.sessions[id]
+	delete(st.sessions, id)
+	st.mu.Unlock()
+	if ok {
+		s.mu.Lock()
+		s.store, s.index = nil, nil
+		s.mu.Unlock()
+	}
+	if ps, ok := st.history.(PurgeableHistoryStore); ok {
+		return ps.Delete(id)
+	}
+	return nil
+}
+
+// evictIdle 把空闲超过 ttl、没有连接也没有进行中的对话的会话移出内存缓存, 返回移出的个数。
+// 配置了 history 时之后 Get 会从存储中重新加载, 只保存在内存中的状态 (固定的消息、参与者、检查点等) 丢失;
+// 没有配置 history 时会话彻底消失
+func (st *SessionStore) evictIdle(now time.Time, ttl time.Duration) int {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	n := 0
+	for id, s := range st.sessions {
+		if now.Sub(time.Unix(0, s.lastUsed.Load())) < ttl || s.audience.size() > 0 {
+			continue
+		}
+		// 拿不到锁说明正在进行一轮对话
+		if !s.turnMu.TryLock() {
+			continue
+		}
+		delete(st.sessions, id)
+		s.turnMu.Unlock()
+		n++
+	}
+	if n > 0 {
+		sessionsEvicted.Add(float64(n))
+	}
+	return n
+}
+
+// Start 定期移出空闲超过 idleTTL 的会话, 只在 serve 中启动; idleTTL 为 0 时不移出
+func (st *SessionStore) Start(idleTTL time.Duration) {
+	if idleTTL <= 0 {
+		return
+	}
+	st.wg.Add(1)
+	go func() {
+		defer st.wg.Done()
+		ticker := time.NewTicker(min(sessionEvictInterval, idleTTL))
+		defer ticker.Stop()
+		for {
+			select {
+			case <-st.stop:
+				return
+			case now := <-ticker.C:
+				st.evictIdle(now, idleTTL)
+			}
+		}
+	}()
+}
+
+func (st *SessionStore) Close() {
+	close(st.stop)
+	st.wg.Wait()
+}
+
+// newID 生成随机 id
+func newID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
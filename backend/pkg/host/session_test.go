@@ -0,0 +1,133 @@
+package host
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/sashabaranov/go-openai"
+)
+
+func TestEvictIdleSessions(t *testing.T) {
+	history, err := NewFileHistoryStore(t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	st := NewSessionStore(history)
+	idle := st.Create("alice")
+	idle.Append(openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: "hello"})
+	connected := st.Create("bob")
+	connected.audience.add(&wsConn{})
+	busy := st.Create("carol")
+	end, err := st.BeginTurn(context.Background(), busy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fresh := st.Create("dave")
+
+	// 只有前三个会话空闲超过一小时
+	later := time.Now().Add(time.Hour)
+	fresh.lastUsed.Store(later.UnixNano())
+	if n := st.evictIdle(later, time.Hour); n != 1 {
+		t.Fatalf("evicted %d sessions, want 1", n)
+	}
+	ids := map[string]bool{}
+	for _, s := range st.All() {
+		ids[s.ID] = true
+	}
+	if ids[idle.ID] || !ids[connected.ID] || !ids[busy.ID] || !ids[fresh.ID] {
+		t.Errorf("wrong sessions evicted, remaining: %v", ids)
+	}
+
+	// 移出的会话从历史存储中重新加载
+	s, ok := st.Get(idle.ID)
+	if !ok {
+		t.Fatal("evicted session was not reloaded")
+	}
+	if s == idle || len(s.History()) != 1 || s.UserID() != "alice" {
+		t.Errorf("reloaded session: same=%v history=%d user=%q", s == idle, len(s.History()), s.UserID())
+	}
+
+	// 对话结束后重新计算空闲时间
+	end()
+	if n := st.evictIdle(later, time.Hour); n != 0 {
+		t.Errorf("evicted %d sessions right after a turn or a reload, want 0", n)
+	}
+}
+
+func TestEvictIdleWithoutHistory(t *testing.T) {
+	st := NewSessionStore(nil)
+	sess := st.Create("")
+	if n := st.evictIdle(time.Now().Add(2*time.Hour), time.Hour); n != 1 {
+		t.Fatalf("evicted %d sessions, want 1", n)
+	}
+	if _, ok := st.Get(sess.ID); ok {
+		t.Error("evicted session without history is still available")
+	}
+	st.Start(time.Hour)
+	st.Close()
+}
+
+// 要恢复的会话已经不存在时新建会话, 并告诉客户端
+func TestResumeMissingSession(t *testing.T) {
+	llm := httptest.NewServer(mockLLMHandler(0))
+	defer llm.Close()
+	mcpClient, err := newMockMCPClient(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mcpClient.Close()
+	cc, err := newLoadTestClient(llm.URL, mcpClient, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cc.events.Close()
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+	host := httptest.NewServer(http.HandlerFunc(cc.ChatLoop))
+	defer host.Close()
+	existing := cc.sessions.Create("")
+
+	for _, tt := range []struct {
+		name, sessionID string
+		wantNew         bool
+	}{
+		{"existing session", existing.ID, false},
+		{"evicted session", "0123456789abcdef0123456789abcdef", true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			ws, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(host.URL, "http")+"?session_id="+tt.sessionID, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer ws.Close()
+			var session string
+			for {
+				msg, err := readChatMessage(ws)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if msg.Type == "session" {
+					session = msg.SessionId
+					break
+				}
+			}
+			if (session != tt.sessionID) != tt.wantNew {
+				t.Fatalf("session = %q, requested %q", session, tt.sessionID)
+			}
+			ws.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+			msg, err := readChatMessage(ws)
+			warned := err == nil && msg.Type == "warning" && msg.Status == "session_not_found"
+			if warned != tt.wantNew {
+				t.Errorf("session_not_found warning = %v, want %v (%v, %v)", warned, tt.wantNew, msg, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package host
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/guobinqiu/mcp-host-web/chat"
+	"google.golang.org/protobuf/proto"
+)
+
+// 广播的写入超时, 慢的连接不能拖慢对话
+const broadcastWriteTimeout = 5 * time.Second
+
+// audience 是同一会话的所有连接: 参与对话的连接和只读旁观的连接 (用于客服或同事实时查看对话过程),
+// 一个连接产生的消息广播给其他连接。只在本副本内存中, 要连到对话所在的副本
+type audience struct {
+	mu    sync.Mutex
+	conns map[*wsConn]bool
+}
+
+func (a *audience) add(conn *wsConn) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.conns == nil {
+		a.conns = make(map[*wsConn]bool)
+	}
+	a.conns[conn] = true
+}
+
+// size 返回会话当前的连接数
+func (a *audience) size() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return len(a.conns)
+}
+
+func (a *audience) remove(conn *wsConn) {
+	a.mu.Lock()
+	delete(a.conns, conn)
+	a.mu.Unlock()
+}
+
+// broadcast 把 from 产生的消息发给会话的其他连接, 发送失败的连接关闭并移除
+func (a *audience) broadcast(msg *chat.ChatMessage, from *wsConn) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if len(a.conns) == 0 || (len(a.conns) == 1 && a.conns[from]) {
+		return
+	}
+	// 广播的消息不经过 outbox, 不需要确认, 去掉编号
+	msg = proto.Clone(msg).(*chat.ChatMessage)
+	msg.Seq = 0
+	for conn := range a.conns {
+		if conn == from {
+			continue
+		}
+		if err := conn.write(msg, broadcastWriteTimeout); err != nil {
+			conn.ws.Close()
+			delete(a.conns, conn)
+		}
+	}
+}
+
+// canWatch 能访问会话的用户 (所有者和参与者) 和 admin 可以旁观, 匿名会话知道 id 即可旁观
+func (cc *ChatClient) canWatch(r *http.Request, sess *Session) bool {
+	return sess.CanAccess(cc.userID(r)) || cc.role(r) == RoleAdmin
+}
+
+// spectate 处理 /ws?session_id=xxx&watch=1 的旁观连接: 先发 type=session 的消息 (spectator 为 true),
+// 之后推送会话的所有消息, 直到连接断开; 旁观者发来的消息一律以错误回复
+func (cc *ChatClient) spectate(conn *wsConn, r *http.Request) {
+	locale := requestLocale(r)
+	sess, ok := cc.sessions.Get(r.URL.Query().Get("session_id"))
+	if !ok || !cc.canWatch(r, sess) {
+		conn.write(&chat.ChatMessage{Type: "error", Content: T(locale, "api.session_not_found")}, 0)
+		return
+	}
+	defer cc.recoverPanic(r.Context(), "connection", sess.ID, nil)
+
+	if err := conn.write(&chat.ChatMessage{Type: "session", SessionId: sess.ID, Spectator: true}, 0); err != nil {
+		logf("ws.write_failed", sess.ID, err)
+		return
+	}
+	sess.audience.add(conn)
+	defer sess.audience.remove(conn)
+	logf("ws.spectator_joined", sess.ID, cc.userID(r))
+
+	for {
+		_, msgBytes, err := conn.ws.ReadMessage()
+		if err != nil {
+			return
+		}
+		recvMsg := &chat.ChatMessage{}
+		if err := proto.Unmarshal(msgBytes, recvMsg); err != nil || recvMsg.Type == "ack" {
+			continue
+		}
+		if err := conn.write(&chat.ChatMessage{Type: "error", Content: T(locale, "error.spectator_read_only"), SessionId: sess.ID}, broadcastWriteTimeout); err != nil {
+			return
+		}
+	}
+}
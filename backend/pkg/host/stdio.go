@@ -0,0 +1,206 @@
+package host
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/client/transport"
+)
+
+// platformCommand 返回 goos (windows、darwin 或 linux) 对应的按系统覆盖的字段名和字段, 其他系统返回 nil
+func (s *MCPServer) platformCommand(goos string) (string, *string) {
+	switch goos {
+	case "windows":
+		return "commandWindows", &s.CommandWindows
+	case "darwin":
+		return "commandDarwin", &s.CommandDarwin
+	case "linux":
+		return "commandLinux", &s.CommandLinux
+	}
+	return "", nil
+}
+
+// platformCommandFields 返回配置了的按系统覆盖的字段名, 用于检查非 stdio 服务
+func platformCommandFields(s MCPServer) []string {
+	var fields []string
+	for _, f := range []struct {
+		name, value string
+	}{{"commandWindows", s.CommandWindows}, {"commandDarwin", s.CommandDarwin}, {"commandLinux", s.CommandLinux}} {
+		if f.value != "" {
+			fields = append(fields, f.name)
+		}
+	}
+	return fields
+}
+
+// stdioCommand 按当前系统解析 stdio 服务的命令
+func stdioCommand(command string, args []string) (string, []string) {
+	return resolveCommand(runtime.GOOS, command, args, exec.LookPath)
+}
+
+// resolveCommand 处理各系统启动命令的差异:
+//   - Windows 上 npx、npm 等是 .cmd 脚本, 不能直接作为进程启动, 要交给 cmd /c 执行; 查找时按 PATHEXT 补全扩展名
+//   - 其他系统上去掉为 Windows 写的 .exe、.cmd、.bat 扩展名, 同一份配置可以在各系统上使用
+//
+// 找不到命令时原样返回, 由启动进程时报告错误
+func resolveCommand(goos, command string, args []string, lookPath func(string) (string, error)) (string, []string) {
+	ext := strings.ToLower(filepath.Ext(command))
+	if goos != "windows" {
+		if _, err := lookPath(command); err != nil && (ext == ".exe" || ext == ".cmd" || ext == ".bat") {
+			if _, err := lookPath(strings.TrimSuffix(command, filepath.Ext(command))); err == nil {
+				return strings.TrimSuffix(command, filepath.Ext(command)), args
+			}
+		}
+		return command, args
+	}
+	path, err := lookPath(command)
+	if err != nil {
+		return command, args
+	}
+	if ext = strings.ToLower(filepath.Ext(path)); ext == ".cmd" || ext == ".bat" {
+		shell := os.Getenv("ComSpec")
+		if shell == "" {
+			shell = "cmd.exe"
+		}
+		return shell, append([]string{"/c", path}, args...)
+	}
+	return path, args
+}
+
+// 关闭 stdio 服务时, 发出终止信号后等待进程退出的缺省时间, 超时后强制结束
+const defaultStdioShutdownTimeout = 5 * time.Second
+
+// 日志级别, logLevel 和 stderrLevel 使用; stderrLevel 还可以是 off
+var logLevels = map[string]slog.Level{
+	"debug": slog.LevelDebug,
+	"info":  slog.LevelInfo,
+	"warn":  slog.LevelWarn,
+	"error": slog.LevelError,
+}
+
+// stderr 中单行的最大长度, 超过时截断
+const maxStderrLine = 64 * 1024
+
+// logStderr 把 stdio 服务的 stderr 按行写入日志, 带上服务名; level 为 off 时丢弃。
+// 必须一直读到 EOF, 否则 stderr 写满后服务会阻塞
+func logStderr(name, level string, r io.ReadCloser) {
+	defer r.Close()
+	lvl, ok := logLevels[level]
+	if level == "" {
+		lvl, ok = slog.LevelInfo, true
+	}
+	if !ok {
+		io.Copy(io.Discard, r)
+		return
+	}
+	br := bufio.NewReaderSize(r, maxStderrLine)
+	for {
+		line, isPrefix, err := br.ReadLine()
+		if len(line) > 0 {
+			slog.Log(context.Background(), lvl, string(line), "server", name)
+		}
+		// 过长的行只记录前 maxStderrLine 字节, 丢弃剩下的部分
+		for isPrefix && err == nil {
+			_, isPrefix, err = br.ReadLine()
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// stdioTransport 自己启动 stdio 服务的进程, 而不是交给 mcp-go: 服务放在单独的进程组中,
+// 关闭时先关闭标准输入并向整个进程组发出终止信号, 等待 shutdownTimeout 后强制结束进程组,
+// npx 等启动器拉起的 node 子进程也会一起结束, 不会在主机重启后遗留
+type stdioTransport struct {
+	*transport.Stdio
+	name    string
+	cmd     *exec.Cmd
+	timeout time.Duration
+	exited  chan struct{} // 进程退出后关闭
+}
+
+// startStdio 启动 stdio 服务的进程并连接其标准输入输出
+func startStdio(name string, mcpServer MCPServer) (*stdioTransport, error) {
+	command, args := stdioCommand(mcpServer.Command, mcpServer.Args)
+	cmd := exec.Command(command, args...)
+	cmd.Env = append(os.Environ(), envList(mcpServer.Env)...)
+	setProcessGroup(cmd)
+
+	// 使用 os.Pipe 而不是 cmd.StdoutPipe 等, 进程退出时 Wait 不会关闭这一端, 读取方可以读完剩下的输出
+	stdinR, stdinW, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	stdoutR, stdoutW, err := os.Pipe()
+	if err != nil {
+		closeFiles(stdinR, stdinW)
+		return nil, err
+	}
+	stderrR, stderrW, err := os.Pipe()
+	if err != nil {
+		closeFiles(stdinR, stdinW, stdoutR, stdoutW)
+		return nil, err
+	}
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = stdinR, stdoutW, stderrW
+	if err := cmd.Start(); err != nil {
+		closeFiles(stdinR, stdinW, stdoutR, stdoutW, stderrR, stderrW)
+		return nil, fmt.Errorf("failed to start command: %w", err)
+	}
+	// 子进程已经持有这些文件, 父进程要关闭自己的副本, 子进程退出时读取方才能读到 EOF
+	closeFiles(stdinR, stdoutW, stderrW)
+
+	t := &stdioTransport{
+		// stderr 由 logStderr 读到 EOF 后自己关闭, Stdio.Close 关闭时会丢掉进程退出前的输出
+		Stdio:   transport.NewIO(stdoutR, stdinW, io.NopCloser(stderrR)),
+		name:    name,
+		cmd:     cmd,
+		timeout: defaultStdioShutdownTimeout,
+		exited:  make(chan struct{}),
+	}
+	if mcpServer.ShutdownTimeout > 0 {
+		t.timeout = time.Duration(mcpServer.ShutdownTimeout)
+	}
+	go logStderr(name, mcpServer.StderrLevel, stderrR)
+	go func() {
+		cmd.Wait()
+		close(t.exited)
+	}()
+	if err := t.Stdio.Start(context.Background()); err != nil {
+		t.Close()
+		return nil, err
+	}
+	return t, nil
+}
+
+// Close 关闭标准输入, 再结束整个进程组: 先发终止信号, 超时后强制结束
+func (t *stdioTransport) Close() error {
+	err := t.Stdio.Close()
+	if terr := terminateProcessGroup(t.cmd.Process); terr != nil {
+		logf("mcp.stdio_signal_failed", t.name, terr)
+	}
+	select {
+	case <-t.exited:
+	case <-time.After(t.timeout):
+		logf("mcp.stdio_killed", t.name, t.timeout)
+	}
+	// 进程组组长已经退出时, 组内可能还有没响应终止信号的子进程, 一并强制结束
+	killProcessGroup(t.cmd.Process)
+	<-t.exited
+	return err
+}
+
+func closeFiles(files ...*os.File) {
+	for _, f := range files {
+		f.Close()
+	}
+}
@@ -0,0 +1,74 @@
+package host
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/guobinqiu/mcp-host-web/chat"
+)
+
+// turnTimings 记录一轮对话各阶段的耗时, 会话开启调试时以 type=debug 的消息下发, 帮助用户排查慢的轮次
+type turnTimings struct {
+	start time.Time
+
+	mu        sync.Mutex
+	phases    []*chat.TimingPhase
+	serialize time.Duration // 推送消息的编码和发送合计
+	messages  int
+}
+
+func newTurnTimings() *turnTimings {
+	return &turnTimings{start: time.Now()}
+}
+
+// add 记录从 start 到现在的一个阶段, t 为 nil (会话没有开启调试) 时什么也不做
+func (t *turnTimings) add(phase, name string, start time.Time, err error) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.phases = append(t.phases, &chat.TimingPhase{
+		Phase:      phase,
+		Name:       name,
+		StartMs:    start.Sub(t.start).Milliseconds(),
+		DurationMs: time.Since(start).Milliseconds(),
+		Error:      err != nil,
+	})
+}
+
+// addSerialize 累计一条推送消息的编码和发送耗时
+func (t *turnTimings) addSerialize(elapsed time.Duration) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.serialize += elapsed
+	t.messages++
+}
+
+// message 返回目前为止的耗时, 编码和发送合计为一项
+func (t *turnTimings) message() *chat.TurnTiming {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	phases := append([]*chat.TimingPhase(nil), t.phases...)
+	if t.messages > 0 {
+		phases = append(phases, &chat.TimingPhase{Phase: "serialize", Name: strconv.Itoa(t.messages), DurationMs: t.serialize.Milliseconds()})
+	}
+	return &chat.TurnTiming{TotalMs: time.Since(t.start).Milliseconds(), Phases: phases}
+}
+
+type timingsKey struct{}
+
+func withTimings(ctx context.Context, t *turnTimings) context.Context {
+	return context.WithValue(ctx, timingsKey{}, t)
+}
+
+// timingsFrom 会话没有开启调试时返回 nil
+func timingsFrom(ctx context.Context) *turnTimings {
+	t, _ := ctx.Value(timingsKey{}).(*turnTimings)
+	return t
+}
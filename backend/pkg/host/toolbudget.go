@@ -0,0 +1,53 @@
+package host
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+var toolBudgetExhausted = metrics.Counter("tool_budget_exhausted_total", "Number of turns that ran out of tool budget.", "limit")
+
+// toolBudget 限制一轮对话中工具调用的次数和累计耗时, 控制最坏情况下的等待时间和费用。
+// 用完后剩下的工具调用不再执行, 由大模型根据已有的结果回答并说明原因。为 nil 时不限制
+type toolBudget struct {
+	maxCalls    int
+	maxDuration time.Duration
+}
+
+// newToolBudget 未配置 toolBudget 时返回 nil
+func newToolBudget(cfg *ToolBudgetConfig) *toolBudget {
+	if cfg == nil || (cfg.MaxCalls == 0 && cfg.MaxDuration == 0) {
+		return nil
+	}
+	return &toolBudget{maxCalls: cfg.MaxCalls, maxDuration: time.Duration(cfg.MaxDuration)}
+}
+
+// exhausted 预算用完时返回用完的是哪一项 (calls 或 duration), 没有用完时返回空
+func (b *toolBudget) exhausted(stats *turnStats) string {
+	switch {
+	case b == nil:
+		return ""
+	case b.maxCalls > 0 && len(stats.tools) >= b.maxCalls:
+		return "calls"
+	case b.maxDuration > 0 && stats.toolTime >= b.maxDuration:
+		return "duration"
+	}
+	return ""
+}
+
+// message 是代替工具结果交给大模型的说明, 和其他工具错误一样使用英文
+func (b *toolBudget) message(limit string) string {
+	if limit == "calls" {
+		return fmt.Sprintf("error: the tool budget of this turn (%d calls) is exhausted and the tool was not called. Do not call more tools; answer with the results so far and tell the user the answer may be incomplete.", b.maxCalls)
+	}
+	return fmt.Sprintf("error: the tool budget of this turn (%s of tool time) is exhausted and the tool was not called. Do not call more tools; answer with the results so far and tell the user the answer may be incomplete.", b.maxDuration)
+}
+
+// limit 把一次工具调用的超时限制在剩下的时间预算内
+func (b *toolBudget) limit(ctx context.Context, stats *turnStats) (context.Context, context.CancelFunc) {
+	if b == nil || b.maxDuration == 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, b.maxDuration-stats.toolTime)
+}
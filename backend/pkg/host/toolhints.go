@@ -0,0 +1,116 @@
+package host
+
+import (
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// 工具提示的缺省样本数
+const (
+	defaultToolHintsWindow     = 50
+	defaultToolHintsMinSamples = 5
+)
+
+// toolHints 订阅工具调用事件, 按每个工具最近的耗时、结果大小和失败比例在描述后附上提示,
+// 有多个工具可以完成同一件事时大模型可以优先选择更快、结果更小的。只统计本副本的数据, 重启后清空
+type toolHints struct {
+	window     int
+	minSamples int
+
+	mu      sync.Mutex
+	samples map[string][]toolSample // 工具名 -> 最近的调用
+}
+
+type toolSample struct {
+	ms     int64
+	bytes  int
+	failed bool
+}
+
+// newToolHints 未配置 toolHints 时返回 nil, 不附加提示
+func newToolHints(cfg *ToolHintsConfig, events *EventBus) *toolHints {
+	if cfg == nil {
+		return nil
+	}
+	h := &toolHints{window: cfg.Window, minSamples: cfg.MinSamples, samples: make(map[string][]toolSample)}
+	if h.window == 0 {
+		h.window = defaultToolHintsWindow
+	}
+	if h.minSamples == 0 {
+		h.minSamples = defaultToolHintsMinSamples
+	}
+	events.Subscribe("tool_hints", h.handle)
+	return h
+}
+
+func (h *toolHints) handle(e Event) {
+	if e.Type != EventToolExecuted {
+		return
+	}
+	tool, _ := e.Data["tool"].(string)
+	sample := toolSample{}
+	sample.ms, _ = e.Data["duration_ms"].(int64)
+	sample.bytes, _ = e.Data["output_bytes"].(int)
+	_, sample.failed = e.Data["error"]
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	samples := append(h.samples[tool], sample)
+	if len(samples) > h.window {
+		samples = samples[len(samples)-h.window:]
+	}
+	h.samples[tool] = samples
+}
+
+// annotate 样本足够时在描述后附上耗时 (中位数)、结果的 token 数 (按成功调用的平均字节数估算) 和失败比例
+func (h *toolHints) annotate(tool, description string) string {
+	if h == nil {
+		return description
+	}
+	h.mu.Lock()
+	samples := slices.Clone(h.samples[tool])
+	h.mu.Unlock()
+	if len(samples) < h.minSamples {
+		return description
+	}
+
+	latencies := make([]int64, len(samples))
+	bytes, ok, failed := 0, 0, 0
+	for i, s := range samples {
+		latencies[i] = s.ms
+		if s.failed {
+			failed++
+			continue
+		}
+		bytes += s.bytes
+		ok++
+	}
+	slices.Sort(latencies)
+	median := time.Duration(latencies[len(latencies)/2]) * time.Millisecond
+	tokens := 0
+	if ok > 0 {
+		tokens = bytes / ok / 4
+	}
+	hint := T(serverLocale, "tools.hint", median.Round(10*time.Millisecond), tokens)
+	if failed > 0 {
+		hint = T(serverLocale, "tools.hint_failures", median.Round(10*time.Millisecond), tokens, failed*100/len(samples))
+	}
+	if description == "" {
+		return hint
+	}
+	return description + "\n" + hint
+}
+
+// resultBytes 是工具结果中文本内容的字节数
+func resultBytes(content []mcp.Content) int {
+	n := 0
+	for _, c := range content {
+		if text, ok := c.(mcp.TextContent); ok {
+			n += len(text.Text)
+		}
+	}
+	return n
+}
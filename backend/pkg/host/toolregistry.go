@@ -0,0 +1,136 @@
+package host
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+var toolListFetches = metrics.Counter("tool_list_fetches_total", "Number of tools/list requests made by the tool registry.", "server", "status")
+
+// 缓存的工具列表超过这个时间后重新获取, 兜底不发送 tools/list_changed 通知的服务
+const toolRegistryMaxAge = 10 * time.Minute
+
+// toolRegistry 缓存各 MCP 服务的工具列表, 在所有会话和轮次之间共享, 可以被多个 goroutine 同时使用。
+// 服务发来 tools/list_changed 通知、健康检查发现服务状态变化、服务被替换或移除时作废对应的缓存;
+// 获取失败的服务不缓存, 下一轮重试
+type toolRegistry struct {
+	mu      sync.Mutex
+	entries map[*MCPClient]*toolEntry
+	maxAge  time.Duration
+}
+
+type toolEntry struct {
+	tools   []mcp.Tool
+	fetched time.Time
+	ok      bool   // tools 可以使用
+	gen     uint64 // 每次作废加一, 获取期间被作废的结果不缓存
+	watched bool   // 已注册 tools/list_changed 通知
+}
+
+func newToolRegistry() *toolRegistry {
+	return &toolRegistry{entries: make(map[*MCPClient]*toolEntry), maxAge: toolRegistryMaxAge}
+}
+
+// snapshot 按 clients 的顺序返回各服务的工具, 缓存中没有或已作废的服务并发获取
+func (r *toolRegistry) snapshot(ctx context.Context, clients []*MCPClient) ([][]mcp.Tool, []error) {
+	results := make([][]mcp.Tool, len(clients))
+	errs := make([]error, len(clients))
+	var wg sync.WaitGroup
+	for i, c := range clients {
+		if tools, ok := r.cached(c); ok {
+			results[i] = tools
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], errs[i] = r.fetch(ctx, c)
+		}()
+	}
+	wg.Wait()
+	return results, errs
+}
+
+// list 返回一个服务的工具
+func (r *toolRegistry) list(ctx context.Context, c *MCPClient) ([]mcp.Tool, error) {
+	results, errs := r.snapshot(ctx, []*MCPClient{c})
+	return results[0], errs[0]
+}
+
+func (r *toolRegistry) cached(c *MCPClient) ([]mcp.Tool, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e := r.entries[c]
+	if e == nil || !e.ok || time.Since(e.fetched) > r.maxAge {
+		return nil, false
+	}
+	return e.tools, true
+}
+
+func (r *toolRegistry) fetch(ctx context.Context, c *MCPClient) ([]mcp.Tool, error) {
+	r.mu.Lock()
+	e := r.entries[c]
+	if e == nil {
+		e = &toolEntry{}
+		r.entries[c] = e
+	}
+	gen, watch := e.gen, !e.watched
+	e.watched = true
+	r.mu.Unlock()
+	// 在锁外注册: 通知的回调要获取 r.mu
+	if watch {
+		c.OnNotification(func(n mcp.JSONRPCNotification) {
+			if n.Method == mcp.MethodNotificationToolsListChanged {
+				logf("mcp.tools_changed", c.Name)
+				r.invalidate(c)
+			}
+		})
+	}
+
+	tools, err := listServerTools(ctx, c)
+	if err != nil {
+		toolListFetches.Inc(c.Name, "error")
+		return nil, err
+	}
+	toolListFetches.Inc(c.Name, "ok")
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if e := r.entries[c]; e != nil && e.gen == gen {
+		e.tools, e.fetched, e.ok = tools, time.Now(), true
+	}
+	return tools, nil
+}
+
+// invalidate 作废一个服务的缓存, 下一轮重新获取
+func (r *toolRegistry) invalidate(c *MCPClient) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if e := r.entries[c]; e != nil {
+		e.ok = false
+		e.gen++
+	}
+}
+
+// invalidateName 作废同名服务的缓存, 用于只知道服务名的健康检查
+func (r *toolRegistry) invalidateName(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for c, e := range r.entries {
+		if c.Name == name {
+			e.ok = false
+			e.gen++
+		}
+	}
+}
+
+// forget 删除已断开的服务的缓存
+func (r *toolRegistry) forget(clients ...*MCPClient) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, c := range clients {
+		delete(r.entries, c)
+	}
+}
@@ -0,0 +1,45 @@
+package host
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+)
+
+// 每轮对话生成一个 trace id: 写入这一轮的日志和事件, 随这一轮下发的消息 (包括错误) 发给客户端,
+// 并通过 _meta.traceId 传给 MCP 服务; 用户反馈问题时提供 trace id 即可找到对应的日志
+type traceKey struct{}
+
+func newTraceID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func withTrace(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, traceKey{}, id)
+}
+
+func traceFrom(ctx context.Context) string {
+	id, _ := ctx.Value(traceKey{}).(string)
+	return id
+}
+
+// logTag 日志中标识一轮对话, 比如 [<session id> trace=<trace id>]
+func logTag(ctx context.Context, sessionID string) string {
+	if id := traceFrom(ctx); id != "" {
+		return sessionID + " trace=" + id
+	}
+	return sessionID
+}
+
+// traceData 给事件数据加上 trace id
+func traceData(ctx context.Context, data map[string]any) map[string]any {
+	if id := traceFrom(ctx); id != "" {
+		if data == nil {
+			data = map[string]any{}
+		}
+		data["trace_id"] = id
+	}
+	return data
+}
@@ -0,0 +1,104 @@
+package host
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// 单段语音大小上限
+const maxAudioBytes = 25 << 20
+
+// Transcriber 调用 Whisper 兼容接口把语音转成文字
+type Transcriber struct {
+	client *openai.Client
+	model  string
+}
+
+// NewTranscriberFromEnv 读取 OPENAI_TRANSCRIBE_* 环境变量, 未设置时沿用对话接口的 key、地址和代理
+// 很多对话模型服务 (比如 deepseek) 不提供语音接口, 可以单独指定
+func NewTranscriberFromEnv(apiKey, baseURL string) (*Transcriber, error) {
+	if v := os.Getenv("OPENAI_TRANSCRIBE_API_KEY"); v != "" {
+		apiKey = v
+	}
+	if v := os.Getenv("OPENAI_TRANSCRIBE_API_BASE"); v != "" {
+		baseURL = v
+	}
+	model := os.Getenv("OPENAI_TRANSCRIBE_MODEL")
+	if model == "" {
+		model = openai.Whisper1
+	}
+	proxy := os.Getenv("OPENAI_TRANSCRIBE_PROXY")
+	if proxy == "" {
+		proxy = os.Getenv("OPENAI_API_PROXY")
+	}
+	config := openai.DefaultConfig(apiKey)
+	config.BaseURL = baseURL
+	httpClient, err := newProxyHTTPClient(proxy)
+	if err != nil {
+		return nil, err
+	}
+	if httpClient != nil {
+		config.HTTPClient = httpClient
+	}
+	return &Transcriber{client: openai.NewClientWithConfig(config), model: model}, nil
+}
+
+// Transcribe format 是音频文件扩展名, 比如 webm, mp3, wav
+func (t *Transcriber) Transcribe(ctx context.Context, audio []byte, format string) (string, error) {
+	if len(audio) == 0 {
+		return "", newError("audio.empty")
+	}
+	if len(audio) > maxAudioBytes {
+		return "", newError("audio.too_large")
+	}
+	format = strings.TrimPrefix(strings.ToLower(format), ".")
+	if format == "" {
+		format = "webm"
+	}
+	resp, err := t.client.CreateTranscription(ctx, openai.AudioRequest{
+		Model:    t.model,
+		FilePath: "audio." + format,
+		Reader:   bytes.NewReader(audio),
+	})
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(resp.Text), nil
+}
+
+// POST /api/transcribe  multipart 表单字段 file, 返回 {"text": "..."}
+func (cc *ChatClient) handleTranscribe(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, r, http.StatusMethodNotAllowed, "api.method_not_allowed")
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxAudioBytes+1<<20)
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "api.bad_request", err)
+		return
+	}
+	defer file.Close()
+	audio, err := io.ReadAll(file)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "api.bad_request", err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 60*time.Second)
+	defer cancel()
+	text, err := cc.transcriber.Transcribe(ctx, audio, filepath.Ext(header.Filename))
+	if err != nil {
+		writeError(w, r, http.StatusBadGateway, "api.transcribe_failed", localize(err, requestLocale(r)))
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"text": text})
+}
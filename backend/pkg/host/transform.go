@@ -0,0 +1,117 @@
+package host
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/itchyny/gojq"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// resultTransform 在工具结果交给大模型之前做转换, 比如只保留需要的字段以节省 token
+type resultTransform struct {
+	jq   *gojq.Code
+	tmpl *template.Template
+}
+
+// compileTransform 编译 jq 表达式或 Go 模板, 配置错误在启动时就能发现
+func compileTransform(cfg *TransformConfig) (*resultTransform, error) {
+	if cfg.JQ != "" {
+		q, err := gojq.Parse(cfg.JQ)
+		if err != nil {
+			return nil, err
+		}
+		code, err := gojq.Compile(q)
+		if err != nil {
+			return nil, err
+		}
+		return &resultTransform{jq: code}, nil
+	}
+	tmpl, err := template.New("transform").Option("missingkey=zero").Parse(cfg.Template)
+	if err != nil {
+		return nil, err
+	}
+	return &resultTransform{tmpl: tmpl}, nil
+}
+
+// apply 结果是 JSON 时按解析后的值处理, 否则作为字符串处理
+func (t *resultTransform) apply(text string) (string, error) {
+	var input any = text
+	var parsed any
+	if err := json.Unmarshal([]byte(text), &parsed); err == nil {
+		input = parsed
+	}
+
+	if t.tmpl != nil {
+		var b strings.Builder
+		if err := t.tmpl.Execute(&b, input); err != nil {
+			return "", err
+		}
+		return b.String(), nil
+	}
+
+	// jq 可能输出多个值, 每行一个; 字符串原样输出, 其他值输出为 JSON
+	var out []string
+	iter := t.jq.Run(input)
+	for {
+		v, ok := iter.Next()
+		if !ok {
+			break
+		}
+		if err, ok := v.(error); ok {
+			return "", err
+		}
+		if s, ok := v.(string); ok {
+			out = append(out, s)
+			continue
+		}
+		b, err := gojq.Marshal(v)
+		if err != nil {
+			return "", err
+		}
+		out = append(out, string(b))
+	}
+	return strings.Join(out, "\n"), nil
+}
+
+// TransformResult 按工具配置的转换处理文本结果, 转换失败时保留原结果
+func (c *MCPClient) TransformResult(tool string, contents []mcp.Content) []mcp.Content {
+	t, ok := c.transforms[tool]
+	if !ok {
+		return contents
+	}
+	transformed := make([]mcp.Content, len(contents))
+	for i, content := range contents {
+		transformed[i] = content
+		text, ok := content.(mcp.TextContent)
+		if !ok {
+			continue
+		}
+		out, err := t.apply(text.Text)
+		if err != nil {
+			logf("mcp.transform_failed", c.Name, tool, err)
+			continue
+		}
+		text.Text = out
+		transformed[i] = text
+	}
+	return transformed
+}
+
+// compileTransforms 编译服务下所有工具的结果转换
+func compileTransforms(tools map[string]ToolOverride) (map[string]*resultTransform, error) {
+	transforms := make(map[string]*resultTransform)
+	for name, o := range tools {
+		if o.Transform == nil {
+			continue
+		}
+		t, err := compileTransform(o.Transform)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		transforms[name] = t
+	}
+	return transforms, nil
+}
@@ -0,0 +1,62 @@
+package host
+
+import (
+	"slices"
+	"time"
+
+	"github.com/guobinqiu/mcp-host-web/chat"
+	"github.com/sashabaranov/go-openai"
+)
+
+// turnStats 累计一轮对话中各步骤的耗时和 token 用量, 结束时作为 summary 事件发给前端
+type turnStats struct {
+	start   time.Time
+	pricing map[string]ModelPrice
+
+	llm   time.Duration
+	tools []*chat.ToolLatency
+	// 工具调用的累计耗时
+	toolTime time.Duration
+	usage    openai.Usage
+	cost     float64
+	models   []string
+	cached   bool // 使用了语义缓存的回答
+}
+
+func newTurnStats(pricing map[string]ModelPrice) *turnStats {
+	return &turnStats{start: time.Now(), pricing: pricing}
+}
+
+// addLLM 记录一次大模型调用
+func (s *turnStats) addLLM(model string, elapsed time.Duration, usage openai.Usage) {
+	s.llm += elapsed
+	s.usage.PromptTokens += usage.PromptTokens
+	s.usage.CompletionTokens += usage.CompletionTokens
+	s.usage.TotalTokens += usage.TotalTokens
+	if p, ok := s.pricing[model]; ok {
+		s.cost += (float64(usage.PromptTokens)*p.Input + float64(usage.CompletionTokens)*p.Output) / 1e6
+	}
+	if !slices.Contains(s.models, model) {
+		s.models = append(s.models, model)
+	}
+}
+
+// addTool 记录一次工具调用
+func (s *turnStats) addTool(name string, elapsed time.Duration, err error) {
+	s.tools = append(s.tools, &chat.ToolLatency{Name: name, Ms: elapsed.Milliseconds(), Error: err != nil})
+	s.toolTime += elapsed
+}
+
+func (s *turnStats) summary() *chat.TurnSummary {
+	return &chat.TurnSummary{
+		TotalMs:          time.Since(s.start).Milliseconds(),
+		LlmMs:            s.llm.Milliseconds(),
+		Tools:            s.tools,
+		PromptTokens:     int64(s.usage.PromptTokens),
+		CompletionTokens: int64(s.usage.CompletionTokens),
+		TotalTokens:      int64(s.usage.TotalTokens),
+		Cost:             s.cost,
+		Models:           s.models,
+		Cached:           s.cached,
+	}
+}
@@ -0,0 +1,254 @@
+package host
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+const defaultMaxUploadBytes = 20 << 20
+
+// Upload 描述用户上传的一个文件, URI 是 file:// 形式的绝对路径, 工具 (比如 filesystem MCP 服务) 可以直接读取
+type Upload struct {
+	Name     string `json:"name"`
+	MimeType string `json:"mime_type"`
+	Size     int64  `json:"size"`
+	URI      string `json:"uri"`
+}
+
+// UploadStore 按会话分目录保存上传的文件
+type UploadStore struct {
+	dir      string
+	maxBytes int64
+}
+
+func NewUploadStore(cfg *UploadsConfig) (*UploadStore, error) {
+	st := &UploadStore{dir: "data/uploads", maxBytes: defaultMaxUploadBytes}
+	if cfg != nil {
+		if cfg.Dir != "" {
+			st.dir = cfg.Dir
+		}
+		if cfg.MaxBytes > 0 {
+			st.maxBytes = cfg.MaxBytes
+		}
+	}
+	dir, err := filepath.Abs(st.dir)
+	if err != nil {
+		return nil, err
+	}
+	st.dir = dir
+	if err := os.MkdirAll(st.dir, 0o700); err != nil {
+		return nil, err
+	}
+	return st, nil
+}
+
+func (st *UploadStore) sessionDir(sessionID string) string {
+	return filepath.Join(st.dir, sessionID)
+}
+
+func (st *UploadStore) Save(sessionID, name string, r io.Reader) (*Upload, error) {
+	name = sanitizeFilename(name)
+	dir := st.sessionDir(sessionID)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	path := filepath.Join(dir, name)
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	body := &bodyReader{r: io.LimitReader(r, st.maxBytes+1)}
+	n, err := io.Copy(f, body)
+	f.Close()
+	if body.err != nil {
+		err = fmt.Errorf("%w: %w", errUploadBody, body.err)
+	} else if err == nil && n > st.maxBytes {
+		err = newError("upload.too_large", st.maxBytes)
+	}
+	if err != nil {
+		os.Remove(path)
+		return nil, err
+	}
+	return newUpload(path, n), nil
+}
+
+// List 返回会话中已上传的文件
+func (st *UploadStore) List(sessionID string) []*Upload {
+	entries, err := os.ReadDir(st.sessionDir(sessionID))
+	if err != nil {
+		return nil
+	}
+	var uploads []*Upload
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		uploads = append(uploads, newUpload(filepath.Join(st.sessionDir(sessionID), e.Name()), info.Size()))
+	}
+	sort.Slice(uploads, func(i, j int) bool { return uploads[i].Name < uploads[j].Name })
+	return uploads
+}
+
+// DeleteSession 删除会话上传的所有文件
+func (st *UploadStore) DeleteSession(sessionID string) error {
+	if !sessionIDPattern.MatchString(sessionID) {
+		return nil
+	}
+	return os.RemoveAll(st.sessionDir(sessionID))
+}
+
+// errUploadBody 表示读取上传的内容失败 (请求格式错误、客户端断开), 和写入磁盘失败区分开
+var errUploadBody = errors.New("read upload")
+
+// bodyReader 记录读取上传内容时的错误
+type bodyReader struct {
+	r   io.Reader
+	err error
+}
+
+func (b *bodyReader) Read(p []byte) (int, error) {
+	n, err := b.r.Read(p)
+	if err != nil && err != io.EOF {
+		b.err = err
+	}
+	return n, err
+}
+
+// uploadStatus 返回上传失败时的状态码: 超过大小上限为 413, 请求的内容有问题为 400, 其他 (比如磁盘写入失败) 为 500
+func uploadStatus(err error) int {
+	var maxBytes *http.MaxBytesError
+	switch {
+	case hasErrorKey(err, "upload.too_large") || errors.As(err, &maxBytes):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, errUploadBody):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func newUpload(path string, size int64) *Upload {
+	mimeType := mime.TypeByExtension(filepath.Ext(path))
+	if mimeType == "" {
+		mimeType = "application/octet-stream"
+	}
+	return &Upload{
+		Name:     filepath.Base(path),
+		MimeType: mimeType,
+		Size:     size,
+		URI:      "file://" + filepath.ToSlash(path),
+	}
+}
+
+// sanitizeFilename 去掉路径部分和特殊字符, 防止写到会话目录之外
+func sanitizeFilename(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || strings.ContainsRune(`/\:*?"<>|`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+	if name == "" || name == "." || name == ".." {
+		name = "upload"
+	}
+	return name
+}
+
+// attachmentsMessage 告诉大模型当前会话有哪些附件可用
+func (st *UploadStore) attachmentsMessage(sessionID string) (openai.ChatCompletionMessage, bool) {
+	uploads := st.List(sessionID)
+	if len(uploads) == 0 {
+		return openai.ChatCompletionMessage{}, false
+	}
+	var b strings.Builder
+	b.WriteString(T(serverLocale, "prompt.attachments") + "\n")
+	for _, u := range uploads {
+		b.WriteString(T(serverLocale, "prompt.attachment_item", u.Name, u.MimeType, u.Size, u.URI) + "\n")
+	}
+	return openai.ChatCompletionMessage{Role: openai.ChatMessageRoleSystem, Content: b.String()}, true
+}
+
+// POST /api/upload  multipart 表单, 字段 session_id 和 file (可多个), session_id 也可以放在查询参数中
+func (cc *ChatClient) handleUpload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, r, http.StatusMethodNotAllowed, "api.method_not_allowed")
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, cc.uploads.maxBytes*4)
+	reader, err := r.MultipartReader()
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "api.bad_request", err)
+		return
+	}
+
+	var sess *Session
+	if id := r.URL.Query().Get("session_id"); id != "" {
+		s, ok := cc.sessionFor(r, id)
+		if !ok {
+			writeError(w, r, http.StatusNotFound, "api.session_not_found")
+			return
+		}
+		sess = s
+	}
+	uploads := []*Upload{}
+	for {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			// 整个请求超过上限时也是 413
+			status := http.StatusBadRequest
+			if uploadStatus(err) == http.StatusRequestEntityTooLarge {
+				status = http.StatusRequestEntityTooLarge
+			}
+			writeError(w, r, status, "api.bad_request", err)
+			return
+		}
+		switch part.FormName() {
+		case "session_id":
+			id, _ := io.ReadAll(io.LimitReader(part, 64))
+			s, ok := cc.sessionFor(r, strings.TrimSpace(string(id)))
+			if !ok {
+				writeError(w, r, http.StatusNotFound, "api.session_not_found")
+				return
+			}
+			sess = s
+		case "file":
+			// session_id 必须在文件之前
+			if sess == nil {
+				writeError(w, r, http.StatusBadRequest, "api.session_id_order")
+				return
+			}
+			u, err := cc.uploads.Save(sess.ID, part.FileName(), part)
+			if err != nil {
+				status := uploadStatus(err)
+				if status == http.StatusInternalServerError {
+					// 磁盘错误中有服务端的路径, 只记录在日志中
+					logf("upload.save_failed", sess.ID, err)
+					writeError(w, r, status, "error.request_failed")
+					return
+				}
+				writeError(w, r, status, "api.upload_failed", localize(err, requestLocale(r)))
+				return
+			}
+			uploads = append(uploads, u)
+		}
+	}
+	if sess == nil {
+		writeError(w, r, http.StatusBadRequest, "api.missing_session_id")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"session_id": sess.ID, "files": uploads})
+}
@@ -0,0 +1,63 @@
+package host
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+// 只有超过大小上限时返回 413, 请求格式错误返回 400, 保存失败 (磁盘错误) 返回 500 且不暴露服务端路径
+func TestUploadStatus(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		content string
+		broken  bool // 去掉 multipart 的结束边界, 读取文件内容时出错
+		diskErr bool // 会话的上传目录位置是一个普通文件, 无法创建目录
+		want    int
+	}{
+		{"ok", "hello", false, false, http.StatusOK},
+		{"too large", strings.Repeat("x", 1500), false, false, http.StatusRequestEntityTooLarge},
+		{"truncated body", "hello", true, false, http.StatusBadRequest},
+		{"disk error", "hello", false, true, http.StatusInternalServerError},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			uploads, err := NewUploadStore(&UploadsConfig{Dir: dir, MaxBytes: 1024})
+			if err != nil {
+				t.Fatal(err)
+			}
+			cc := &ChatClient{sessions: NewSessionStore(nil), uploads: uploads}
+			sess := cc.sessions.Create("")
+			if tt.diskErr {
+				if err := os.WriteFile(uploads.sessionDir(sess.ID), nil, 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			var body bytes.Buffer
+			mw := multipart.NewWriter(&body)
+			mw.WriteField("session_id", sess.ID)
+			fw, _ := mw.CreateFormFile("file", "notes.txt")
+			fw.Write([]byte(tt.content))
+			mw.Close()
+			data := body.Bytes()
+			if tt.broken {
+				data = data[:bytes.LastIndex(data, []byte("--"+mw.Boundary()))]
+			}
+			r := httptest.NewRequest(http.MethodPost, "/api/upload", bytes.NewReader(data))
+			r.Header.Set("Content-Type", mw.FormDataContentType())
+			w := httptest.NewRecorder()
+			cc.handleUpload(w, r)
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+			if tt.want != http.StatusOK && strings.Contains(w.Body.String(), dir) {
+				t.Errorf("response leaks the upload path: %s", w.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package host
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/guobinqiu/mcp-host-web/chat"
+	"github.com/sashabaranov/go-openai"
+)
+
+var answerVerifications = metrics.Counter("answer_verifications_total", "Number of answers checked against tool outputs, by verdict.", "verdict")
+
+// 核对的结论
+const (
+	VerdictOK            = "ok"             // 回答和工具结果一致
+	VerdictFixed         = "fixed"          // 回答和工具结果矛盾, 已经改正
+	VerdictLowConfidence = "low_confidence" // 无法确定回答是否正确, 提醒用户
+)
+
+// verificationReply 是核对模型回复的 JSON
+type verificationReply struct {
+	Verdict string `json:"verdict"`
+	Answer  string `json:"answer"`
+	Note    string `json:"note"`
+}
+
+// verifyAnswer 配置了 verification 时用另一次大模型调用对照本轮的原始工具结果核对回答:
+// 有矛盾时返回改正后的回答, 无法确定时把结论记在 ctx 中, 随回答消息下发。核对失败时保留原来的回答
+func (cc *ChatClient) verifyAnswer(ctx context.Context, sessionID string, stats *turnStats, model, question, answer string, results []ToolResult) string {
+	if cc.verification == nil || len(results) == 0 || answer == "" {
+		return answer
+	}
+	if cc.verification.Model != "" {
+		model = cc.verification.Model
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "[question]\n%s\n\n", question)
+	for _, r := range results {
+		fmt.Fprintf(&b, "[%s]\n%s\n\n", r.Tool, r.Content)
+	}
+	fmt.Fprintf(&b, "[answer]\n%s\n", answer)
+	resp, err := cc.createChatCompletion(ctx, sessionID, stats, openai.ChatCompletionRequest{
+		Model: model,
+		Messages: []openai.ChatCompletionMessage{
+			{Role: openai.ChatMessageRoleSystem, Content: T(serverLocale, "verification.prompt")},
+			{Role: openai.ChatMessageRoleUser, Content: b.String()},
+		},
+	})
+	if err != nil || len(resp.Choices) == 0 {
+		answerVerifications.Inc("error")
+		logf("verification.failed", logTag(ctx, sessionID), err)
+		return answer
+	}
+	reply, ok := parseVerification(resp.Choices[0].Message.Content)
+	if !ok {
+		answerVerifications.Inc("error")
+		logf("verification.failed", logTag(ctx, sessionID), fmt.Errorf("unexpected reply %q", resp.Choices[0].Message.Content))
+		return answer
+	}
+	answerVerifications.Inc(reply.Verdict)
+	switch reply.Verdict {
+	case VerdictFixed:
+		logf("verification.fixed", logTag(ctx, sessionID), reply.Note)
+		setVerification(ctx, &chat.Verification{Verdict: VerdictFixed, Note: reply.Note})
+		return reply.Answer
+	case VerdictLowConfidence:
+		setVerification(ctx, &chat.Verification{Verdict: VerdictLowConfidence, Note: reply.Note})
+	}
+	return answer
+}
+
+// parseVerification 解析核对模型的回复, 允许 JSON 外面包着 ``` 代码块或说明文字
+func parseVerification(text string) (verificationReply, bool) {
+	start, end := strings.Index(text, "{"), strings.LastIndex(text, "}")
+	if start < 0 || end < start {
+		return verificationReply{}, false
+	}
+	var reply verificationReply
+	if err := json.Unmarshal([]byte(text[start:end+1]), &reply); err != nil {
+		return verificationReply{}, false
+	}
+	switch reply.Verdict {
+	case VerdictOK, VerdictLowConfidence:
+		return reply, true
+	case VerdictFixed:
+		return reply, reply.Answer != ""
+	}
+	return verificationReply{}, false
+}
+
+type verificationKey struct{}
+
+// withVerification 让调用方得知本轮回答的核对结论, ProcessQuery 改正或无法确定回答时填写 *v
+func withVerification(ctx context.Context, v **chat.Verification) context.Context {
+	return context.WithValue(ctx, verificationKey{}, v)
+}
+
+func setVerification(ctx context.Context, v *chat.Verification) {
+	if p, ok := ctx.Value(verificationKey{}).(**chat.Verification); ok {
+		*p = v
+	}
+}
@@ -0,0 +1,42 @@
+package host
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/guobinqiu/mcp-host-web/chat"
+)
+
+// Version 是服务端的版本, 发布时通过 -ldflags "-X github.com/guobinqiu/mcp-host-web/pkg/host.Version=v1.2.0" 设置
+var Version = "dev"
+
+// WebSocket 消息格式 (chat.proto) 的版本: 只新增字段或消息类型时不变, 旧客户端忽略不认识的内容;
+// 删除字段或改变字段含义时加一, 并在 minProtocolVersion 之前的版本不再支持时提高 minProtocolVersion
+const (
+	ProtocolVersion    = 1
+	minProtocolVersion = 1
+)
+
+const rejectUnsupportedProtocol = "unsupported_protocol"
+
+// negotiateProtocol 按连接参数 ?protocol= 确定本次连接使用的协议版本: 没有带上时使用当前版本,
+// 客户端的版本比服务端新时降级到服务端的当前版本, 由客户端决定是否继续; 比支持的最早版本还旧时返回 false
+func negotiateProtocol(r *http.Request) (int32, bool) {
+	requested, err := strconv.Atoi(r.URL.Query().Get("protocol"))
+	if err != nil || requested <= 0 || requested > ProtocolVersion {
+		return ProtocolVersion, true
+	}
+	if requested < minProtocolVersion {
+		return 0, false
+	}
+	return int32(requested), true
+}
+
+// helloMessage 是连接后服务端下发的第一条消息, 告诉客户端服务端的版本和协商的协议版本
+func helloMessage(protocol int32) *chat.ChatMessage {
+	supported := make([]int32, 0, ProtocolVersion-minProtocolVersion+1)
+	for v := int32(minProtocolVersion); v <= ProtocolVersion; v++ {
+		supported = append(supported, v)
+	}
+	return &chat.ChatMessage{Type: "hello", Hello: &chat.Hello{ServerVersion: Version, ProtocolVersion: protocol, SupportedProtocols: supported}}
+}
@@ -0,0 +1,300 @@
+package host
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+const workflowServerName = "workflows"
+
+// toolCaller 按工具名调用已连接的 MCP 服务上的工具, 工作流的每一步都通过它执行
+type toolCaller func(ctx context.Context, name string, args map[string]any) (*mcp.CallToolResult, error)
+
+// workflow 是编译好的工作流, 模板在加载配置时就已解析
+type workflow struct {
+	cfg    WorkflowConfig
+	steps  []workflowStep
+	output *template.Template
+}
+
+type workflowStep struct {
+	cfg  WorkflowStep
+	cond *template.Template
+	args map[string]any // 字符串参数已解析为 *template.Template
+}
+
+// compileWorkflow 解析工作流中的所有模板
+func compileWorkflow(cfg WorkflowConfig) (*workflow, error) {
+	wf := &workflow{cfg: cfg}
+	var err error
+	if cfg.Output != "" {
+		if wf.output, err = parseWorkflowTemplate(cfg.Output); err != nil {
+			return nil, fmt.Errorf("output: %w", err)
+		}
+	}
+	for _, s := range cfg.Steps {
+		step := workflowStep{cfg: s}
+		if s.If != "" {
+			if step.cond, err = parseWorkflowTemplate(s.If); err != nil {
+				return nil, fmt.Errorf("%s.if: %w", s.ID, err)
+			}
+		}
+		args, err := compileArgs(s.Args)
+		if err != nil {
+			return nil, fmt.Errorf("%s.args: %w", s.ID, err)
+		}
+		step.args = args.(map[string]any)
+		wf.steps = append(wf.steps, step)
+	}
+	return wf, nil
+}
+
+func parseWorkflowTemplate(text string) (*template.Template, error) {
+	return template.New("workflow").Option("missingkey=zero").Parse(text)
+}
+
+// compileArgs 递归地把参数中的字符串解析为模板, 其他类型的值原样保留
+func compileArgs(v any) (any, error) {
+	switch v := v.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		for k, item := range v {
+			compiled, err := compileArgs(item)
+			if err != nil {
+				return nil, err
+			}
+			out[k] = compiled
+		}
+		return out, nil
+	case []any:
+		out := make([]any, len(v))
+		for i, item := range v {
+			compiled, err := compileArgs(item)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = compiled
+		}
+		return out, nil
+	case string:
+		return parseWorkflowTemplate(v)
+	case nil:
+		return map[string]any{}, nil
+	default:
+		return v, nil
+	}
+}
+
+func renderArgs(v any, data map[string]any) (any, error) {
+	switch v := v.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		for k, item := range v {
+			rendered, err := renderArgs(item, data)
+			if err != nil {
+				return nil, err
+			}
+			out[k] = rendered
+		}
+		return out, nil
+	case []any:
+		out := make([]any, len(v))
+		for i, item := range v {
+			rendered, err := renderArgs(item, data)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = rendered
+		}
+		return out, nil
+	case *template.Template:
+		return execTemplate(v, data)
+	default:
+		return v, nil
+	}
+}
+
+func execTemplate(t *template.Template, data map[string]any) (string, error) {
+	var b strings.Builder
+	if err := t.Execute(&b, data); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// truthy 条件模板的结果为空、false、0 或 <no value> 时跳过该步骤
+func truthy(s string) bool {
+	switch strings.TrimSpace(s) {
+	case "", "false", "0", "<no value>":
+		return false
+	}
+	return true
+}
+
+// coerceArgs 模板渲染出的都是字符串, 按工具 schema 声明的类型转换顶层参数
+func coerceArgs(args map[string]any, schema mcp.ToolInputSchema) {
+	for name, v := range args {
+		s, ok := v.(string)
+		if !ok {
+			continue
+		}
+		prop, _ := schema.Properties[name].(map[string]any)
+		switch prop["type"] {
+		case "number":
+			if f, err := strconv.ParseFloat(s, 64); err == nil {
+				args[name] = f
+			}
+		case "integer":
+			if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+				args[name] = n
+			}
+		case "boolean":
+			if b, err := strconv.ParseBool(s); err == nil {
+				args[name] = b
+			}
+		case "object", "array":
+			var parsed any
+			if err := json.Unmarshal([]byte(s), &parsed); err == nil {
+				args[name] = parsed
+			}
+		}
+	}
+}
+
+// resultValue 取工具结果的文本, 是 JSON 时解析出来方便后续步骤引用字段
+func resultValue(res *mcp.CallToolResult) (string, any) {
+	var parts []string
+	for _, c := range res.Content {
+		if text, ok := c.(mcp.TextContent); ok {
+			parts = append(parts, text.Text)
+		}
+	}
+	text := strings.Join(parts, "\n")
+	var parsed any
+	if err := json.Unmarshal([]byte(text), &parsed); err == nil {
+		return text, parsed
+	}
+	return text, text
+}
+
+// run 依次执行各步骤, 模板中可以用 .input 引用调用参数, 用 .steps.<id> 引用之前步骤的结果
+func (wf *workflow) run(ctx context.Context, call toolCaller, input map[string]any) (string, error) {
+	steps := map[string]any{}
+	data := map[string]any{"input": input, "steps": steps}
+	last := ""
+	for _, step := range wf.steps {
+		if step.cond != nil {
+			cond, err := execTemplate(step.cond, data)
+			if err != nil {
+				return "", fmt.Errorf("%s.if: %w", step.cfg.ID, err)
+			}
+			if !truthy(cond) {
+				continue
+			}
+		}
+		args, err := renderArgs(step.args, data)
+		if err != nil {
+			return "", fmt.Errorf("%s.args: %w", step.cfg.ID, err)
+		}
+		res, err := call(ctx, step.cfg.Tool, args.(map[string]any))
+		if err != nil {
+			return "", fmt.Errorf("%s (%s): %w", step.cfg.ID, step.cfg.Tool, err)
+		}
+		text, value := resultValue(res)
+		if res.IsError {
+			return "", fmt.Errorf("%s (%s): %s", step.cfg.ID, step.cfg.Tool, text)
+		}
+		steps[step.cfg.ID] = value
+		last = text
+	}
+	if wf.output == nil {
+		return last, nil
+	}
+	return execTemplate(wf.output, data)
+}
+
+// tool 把工作流描述成一个工具交给大模型
+func (wf *workflow) tool() mcp.Tool {
+	schema := mcp.ToolInputSchema{Type: "object", Properties: map[string]any{}}
+	for _, name := range sortedKeys(wf.cfg.Inputs) {
+		in := wf.cfg.Inputs[name]
+		typ := in.Type
+		if typ == "" {
+			typ = "string"
+		}
+		prop := map[string]any{"type": typ}
+		if in.Description != "" {
+			prop["description"] = in.Description
+		}
+		schema.Properties[name] = prop
+		if in.Required {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+	return mcp.Tool{Name: wf.cfg.Name, Description: wf.cfg.Description, InputSchema: schema}
+}
+
+// newWorkflowClient 在进程内的 MCP 服务上把每个工作流注册为一个工具
+func newWorkflowClient(cfgs []WorkflowConfig, call toolCaller) (*MCPClient, error) {
+	s := server.NewMCPServer(workflowServerName, "1.0.0")
+	for _, cfg := range cfgs {
+		wf, err := compileWorkflow(cfg)
+		if err != nil {
+			return nil, err
+		}
+		s.AddTool(wf.tool(), func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			out, err := wf.run(ctx, call, req.GetArguments())
+			if err != nil {
+				logf("workflow.failed", wf.cfg.Name, err)
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(out), nil
+		})
+	}
+
+	return newInProcessMCPClient(workflowServerName, s)
+}
+
+// callTool 供工作流调用工具: 按名称在已连接的服务 (包括记忆和时间工具) 中查找, 并遵守角色的工具白名单和工具的超时
+func (cc *ChatClient) callTool(ctx context.Context, name string, args map[string]any) (*mcp.CallToolResult, error) {
+	if !cc.toolAllowed(roleFrom(ctx), name) {
+		return nil, ErrForbidden
+	}
+	mcpClients := cc.servers()
+	if _, ok := ctx.Value(memoryOwnerKey{}).(string); ok {
+		mcpClients = append(slices.Clip(mcpClients), cc.memory.client)
+	}
+	if cc.clock != nil {
+		mcpClients = append(slices.Clip(mcpClients), cc.clock)
+	}
+	for _, mcpClient := range mcpClients {
+		tools, err := cc.tools.list(ctx, mcpClient)
+		if err != nil {
+			continue
+		}
+		for _, tool := range tools {
+			if tool.Name != name {
+				continue
+			}
+			coerceArgs(args, tool.InputSchema)
+			req := mcp.CallToolRequest{}
+			req.Params.Name = name
+			req.Params.Arguments = mcpClient.toolArguments(ctx, name, args)
+			if demo, ok := cc.demo.toolResult(name); ok {
+				return demo, nil
+			}
+			callCtx, callCancel := mcpClient.WithToolTimeout(ctx, name)
+			defer callCancel()
+			return mcpClient.CallTool(callCtx, req)
+		}
+	}
+	return nil, fmt.Errorf("unknown tool %q", name)
+}
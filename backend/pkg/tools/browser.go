@@ -0,0 +1,865 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+const (
+	defaultBrowserTimeout    = 30 * time.Second
+	defaultBrowserIdle       = 5 * time.Minute
+	defaultBrowserMaxActions = 100
+	defaultBrowserWindow     = time.Hour
+	defaultBrowserMaxTabs    = 4
+	defaultBrowserMaxOutput  = 20000
+	defaultBrowserViewport   = "1280x800"
+	browserMaxPageHeight     = 16384   // 整页截图的最大高度, 超过后截断
+	browserMaxScreenshot     = 8 << 20 // 截图 (base64) 的上限
+	browserMaxLinks          = 200
+	browserClickWait         = 1500 * time.Millisecond // 点击后等待导航开始的时间
+)
+
+// 没有设置 BROWSER_PATH 时在 PATH 中按顺序查找
+var browserCandidates = []string{"chromium", "chromium-browser", "google-chrome", "google-chrome-stable", "chrome", "headless_shell"}
+
+// browserConfig 从环境变量读取:
+//   - BROWSER_ALLOWED_DOMAINS: 允许打开的网站, 逗号分隔, *.example.com 匹配子域名; 必须设置, * 表示不限制
+//   - BROWSER_RESTRICT_RESOURCES: 为 1 时页面加载的脚本、图片等也必须在允许的网站中, 缺省只限制页面本身
+//   - BROWSER_ALLOW_PRIVATE: 为 1 时允许访问内网和本机地址, 缺省拒绝
+//   - BROWSER_PATH: Chrome 或 Chromium 的路径, 缺省在 PATH 中查找
+//   - BROWSER_WS_URL: 连接已经运行的浏览器 (ws://host:9222/devtools/browser/...), 设置后不启动浏览器
+//   - BROWSER_NO_SANDBOX: 为 1 时用 --no-sandbox 启动, 在容器中以 root 运行时需要
+//   - BROWSER_VIEWPORT: 窗口大小, 缺省 1280x800
+//   - BROWSER_TIMEOUT: 每次操作的超时, 缺省 30s
+//   - BROWSER_IDLE_TIMEOUT: 标签页空闲多久后关闭, 没有标签页时浏览器也退出, 缺省 5m
+//   - BROWSER_MAX_ACTIONS / BROWSER_QUOTA_WINDOW: 每个会话在窗口时间内最多的操作次数, 缺省每 1h 100 次
+//   - BROWSER_MAX_TABS: 同时打开的标签页 (会话) 数, 缺省 4, 超过时关闭最久没有使用的
+//   - BROWSER_MAX_OUTPUT: 返回的页面文字的最大字节数, 缺省 20000
+type browserConfig struct {
+	domains           []string
+	restrictResources bool
+	allowPrivate      bool
+	path              string
+	wsURL             string
+	noSandbox         bool
+	width, height     int
+	timeout           time.Duration
+	idle              time.Duration
+	maxActions        int
+	window            time.Duration
+	maxTabs           int
+	maxOutput         int
+}
+
+func browserConfigFromEnv() (browserConfig, error) {
+	cfg := browserConfig{
+		restrictResources: os.Getenv("BROWSER_RESTRICT_RESOURCES") == "1",
+		allowPrivate:      os.Getenv("BROWSER_ALLOW_PRIVATE") == "1",
+		path:              os.Getenv("BROWSER_PATH"),
+		wsURL:             os.Getenv("BROWSER_WS_URL"),
+		noSandbox:         os.Getenv("BROWSER_NO_SANDBOX") == "1",
+		timeout:           defaultBrowserTimeout,
+		idle:              defaultBrowserIdle,
+		maxActions:        defaultBrowserMaxActions,
+		window:            defaultBrowserWindow,
+		maxTabs:           defaultBrowserMaxTabs,
+		maxOutput:         defaultBrowserMaxOutput,
+	}
+	for _, d := range strings.Split(os.Getenv("BROWSER_ALLOWED_DOMAINS"), ",") {
+		if d = strings.ToLower(strings.TrimSpace(d)); d != "" {
+			cfg.domains = append(cfg.domains, d)
+		}
+	}
+	if len(cfg.domains) == 0 {
+		return cfg, errors.New("BROWSER_ALLOWED_DOMAINS is not set, list the allowed sites or use * to allow all")
+	}
+	viewport := firstNonEmpty(os.Getenv("BROWSER_VIEWPORT"), defaultBrowserViewport)
+	w, h, ok := strings.Cut(viewport, "x")
+	var err1, err2 error
+	cfg.width, err1 = strconv.Atoi(w)
+	cfg.height, err2 = strconv.Atoi(h)
+	if !ok || err1 != nil || err2 != nil || cfg.width < 100 || cfg.height < 100 || cfg.width > 4096 || cfg.height > 4096 {
+		return cfg, fmt.Errorf("BROWSER_VIEWPORT: invalid size %q, use WIDTHxHEIGHT", viewport)
+	}
+	for _, e := range []struct {
+		name string
+		dst  *time.Duration
+	}{{"BROWSER_TIMEOUT", &cfg.timeout}, {"BROWSER_IDLE_TIMEOUT", &cfg.idle}, {"BROWSER_QUOTA_WINDOW", &cfg.window}} {
+		if v := os.Getenv(e.name); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil || d <= 0 {
+				return cfg, fmt.Errorf("%s: invalid duration %q", e.name, v)
+			}
+			*e.dst = d
+		}
+	}
+	for _, e := range []struct {
+		name string
+		dst  *int
+	}{{"BROWSER_MAX_ACTIONS", &cfg.maxActions}, {"BROWSER_MAX_TABS", &cfg.maxTabs}, {"BROWSER_MAX_OUTPUT", &cfg.maxOutput}} {
+		if v := os.Getenv(e.name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 {
+				return cfg, fmt.Errorf("%s: invalid number %q", e.name, v)
+			}
+			*e.dst = n
+		}
+	}
+	return cfg, nil
+}
+
+// NewBrowserServer 提供无头浏览器工具: 打开网页、截图、提取文字和点击, 让大模型操作需要脚本渲染或交互的网站。
+// 浏览器 (Chrome/Chromium) 通过 DevTools 协议控制, 在第一次使用时启动; 每个会话使用独立的标签页和浏览器上下文
+// (配置 "inject": {"session_id": "session_id"} 时), 页面请求经过允许列表和内网地址检查; 配置见 browserConfig
+func NewBrowserServer() *server.MCPServer {
+	s := server.NewMCPServer(
+		"browser-server",
+		"1.0.0",
+		server.WithToolCapabilities(true),
+		server.WithRecovery(),
+	)
+	cfg, cfgErr := browserConfigFromEnv()
+	b := &browserClient{cfg: cfg, tabs: map[string]*browserTab{}, quota: map[string][]time.Time{}, dns: map[string]error{}}
+
+	sessionParam := mcp.WithString("session_id", mcp.Description("Browser session, provided by the host; leave empty"))
+	s.AddTool(mcp.NewTool("browser_navigate",
+		mcp.WithDescription("Open a web page in a headless browser and return its title and visible text. "+
+			"Only allowed sites can be opened: "+strings.Join(cfg.domains, ", ")),
+		mcp.WithString("url", mcp.Required(), mcp.Description("Page URL (http or https)")),
+		sessionParam,
+	), b.wrap(cfgErr, b.navigate))
+	s.AddTool(mcp.NewTool("browser_extract_text",
+		mcp.WithDescription("Return the visible text of the current page or of the element matching a CSS selector, optionally with its links"),
+		mcp.WithString("selector", mcp.Description("CSS selector; default the whole page")),
+		mcp.WithBoolean("include_links", mcp.Description("Also list the links (text and URL), default false")),
+		sessionParam,
+		mcp.WithReadOnlyHintAnnotation(true),
+	), b.wrap(cfgErr, b.extractText))
+	s.AddTool(mcp.NewTool("browser_click",
+		mcp.WithDescription("Click an element of the current page, chosen by CSS selector or by its visible text, and wait for any navigation it triggers"),
+		mcp.WithString("selector", mcp.Description("CSS selector of the element")),
+		mcp.WithString("text", mcp.Description("Visible text of a link or button, used when selector is empty")),
+		sessionParam,
+	), b.wrap(cfgErr, b.click))
+	s.AddTool(mcp.NewTool("browser_screenshot",
+		mcp.WithDescription("Take a screenshot of the current page, the whole page or one element"),
+		mcp.WithBoolean("full_page", mcp.Description("Capture the whole scrollable page instead of the viewport, default false")),
+		mcp.WithString("selector", mcp.Description("CSS selector of an element to capture")),
+		mcp.WithString("format", mcp.Description("png (default) or jpeg; jpeg is much smaller for photos and long pages")),
+		sessionParam,
+		mcp.WithReadOnlyHintAnnotation(true),
+	), b.wrap(cfgErr, b.screenshot))
+	return s
+}
+
+type browserClient struct {
+	cfg browserConfig
+
+	mu       sync.Mutex // 保护浏览器进程、标签页和配额
+	conn     *cdpConn
+	cmd      *exec.Cmd // 连接已经运行的浏览器时为 nil
+	dataDir  string
+	tabs     map[string]*browserTab // 会话 -> 标签页
+	quota    map[string][]time.Time // 会话 -> 窗口时间内的操作时间
+	sweeper  *time.Timer
+	sessions sync.Map // CDP sessionId -> *browserTab, 供事件处理使用
+
+	dnsMu sync.Mutex
+	dns   map[string]error // 域名 -> 内网地址检查的结果
+}
+
+// browserTab 是一个会话的标签页, 在独立的浏览器上下文中, cookie 和存储不与其他会话共享
+type browserTab struct {
+	mu        sync.Mutex // 同一标签页的操作串行执行
+	conn      *cdpConn
+	contextID string
+	targetID  string // 也是主框架的 frameId
+	session   string
+	lastUsed  time.Time // 由 browserClient.mu 保护
+
+	blockMu sync.Mutex
+	blocked string // 最近被拦截的页面请求, 用于说明导航失败的原因
+}
+
+// browserError 是参数错误、被拒绝的访问或页面上的错误, 作为工具结果返回给大模型
+type browserError struct{ msg string }
+
+func (e *browserError) Error() string { return e.msg }
+
+type browserHandler func(ctx context.Context, t *browserTab, req mcp.CallToolRequest) (*mcp.CallToolResult, error)
+
+func (b *browserClient) wrap(cfgErr error, h browserHandler) server.ToolHandlerFunc {
+	return func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		if cfgErr != nil {
+			return nil, cfgErr
+		}
+		ctx, cancel := context.WithTimeout(ctx, b.cfg.timeout)
+		defer cancel()
+		t, err := b.tab(ctx, req.GetString("session_id", ""))
+		var res *mcp.CallToolResult
+		if err == nil {
+			res, err = h(ctx, t, req)
+			t.mu.Unlock()
+		}
+		var berr *browserError
+		switch {
+		case errors.As(err, &berr):
+			return mcp.NewToolResultError(berr.msg), nil
+		case errors.Is(err, errCDPClosed):
+			// 浏览器崩溃或连接断开, 下次使用时重新启动
+			b.mu.Lock()
+			b.shutdown()
+			b.mu.Unlock()
+			return nil, errors.New("the browser exited unexpectedly")
+		case errors.Is(err, context.DeadlineExceeded):
+			return mcp.NewToolResultError(fmt.Sprintf("the page did not respond within %s", b.cfg.timeout)), nil
+		case err != nil:
+			return nil, err
+		}
+		return res, nil
+	}
+}
+
+// tab 检查配额, 需要时启动浏览器和打开标签页, 返回已经加锁的标签页
+func (b *browserClient) tab(ctx context.Context, key string) (*browserTab, error) {
+	b.mu.Lock()
+	now := time.Now()
+	times := slices.DeleteFunc(b.quota[key], func(t time.Time) bool { return now.Sub(t) >= b.cfg.window })
+	if len(times) >= b.cfg.maxActions {
+		b.mu.Unlock()
+		return nil, &browserError{fmt.Sprintf("browser quota exceeded: at most %d actions per %s, try again in %s",
+			b.cfg.maxActions, b.cfg.window, times[0].Add(b.cfg.window).Sub(now).Round(time.Second))}
+	}
+	b.quota[key] = append(times, now)
+
+	t, err := b.openTab(ctx, key)
+	if err != nil {
+		b.mu.Unlock()
+		return nil, err
+	}
+	t.lastUsed = now
+	if b.sweeper == nil {
+		b.sweeper = time.AfterFunc(b.cfg.idle, b.sweep)
+	} else {
+		b.sweeper.Reset(b.cfg.idle)
+	}
+	b.mu.Unlock()
+	t.mu.Lock()
+	return t, nil
+}
+
+// openTab 返回会话的标签页, 没有时新建; 调用时持有 b.mu
+func (b *browserClient) openTab(ctx context.Context, key string) (*browserTab, error) {
+	if err := b.start(ctx); err != nil {
+		return nil, err
+	}
+	if t := b.tabs[key]; t != nil {
+		return t, nil
+	}
+	if len(b.tabs) >= b.cfg.maxTabs {
+		// 关闭最久没有使用且空闲的标签页
+		var oldest string
+		for k, t := range b.tabs {
+			if oldest == "" || t.lastUsed.Before(b.tabs[oldest].lastUsed) {
+				if t.mu.TryLock() {
+					t.mu.Unlock()
+					oldest = k
+				}
+			}
+		}
+		if oldest == "" {
+			return nil, &browserError{"too many browser sessions are busy, try again later"}
+		}
+		b.closeTab(b.tabs[oldest])
+		delete(b.tabs, oldest)
+	}
+
+	c := b.conn
+	var bc struct {
+		BrowserContextID string `json:"browserContextId"`
+	}
+	if err := c.call(ctx, "", "Target.createBrowserContext", map[string]any{"disposeOnDetach": true}, &bc); err != nil {
+		return nil, err
+	}
+	t := &browserTab{conn: c, contextID: bc.BrowserContextID}
+	var target struct {
+		TargetID string `json:"targetId"`
+	}
+	var attach struct {
+		SessionID string `json:"sessionId"`
+	}
+	err := c.call(ctx, "", "Target.createTarget", map[string]any{"url": "about:blank", "browserContextId": t.contextID}, &target)
+	if err == nil {
+		t.targetID = target.TargetID
+		err = c.call(ctx, "", "Target.attachToTarget", map[string]any{"targetId": t.targetID, "flatten": true}, &attach)
+	}
+	if err != nil {
+		b.closeTab(t)
+		return nil, err
+	}
+	t.session = attach.SessionID
+	b.sessions.Store(t.session, t)
+	for _, step := range []struct {
+		method string
+		params any
+	}{
+		{"Fetch.enable", browserFetchPatterns},
+		{"Page.enable", nil},
+		{"Page.addScriptToEvaluateOnNewDocument", map[string]any{"source": browserPopupScript}},
+		{"Emulation.setDeviceMetricsOverride", map[string]any{"width": b.cfg.width, "height": b.cfg.height, "deviceScaleFactor": 1, "mobile": false}},
+		{"Target.setAutoAttach", browserAutoAttach},
+	} {
+		if err := c.call(ctx, t.session, step.method, step.params, nil); err != nil {
+			b.closeTab(t)
+			return nil, err
+		}
+	}
+	// 不允许下载文件; 旧版本的浏览器不支持按上下文设置, 忽略错误
+	c.call(ctx, "", "Browser.setDownloadBehavior", map[string]any{"behavior": "deny", "browserContextId": t.contextID}, nil)
+	b.tabs[key] = t
+	return t, nil
+}
+
+var (
+	browserFetchPatterns = map[string]any{"patterns": []map[string]any{{"urlPattern": "*", "requestStage": "Request"}}}
+	// iframe 和 worker 先暂停, 启用请求拦截后再运行
+	browserAutoAttach = map[string]any{"autoAttach": true, "waitForDebuggerOnStart": true, "flatten": true}
+)
+
+// browserPopupScript 在每个页面加载前运行, 让新窗口在当前标签页打开, 弹出的窗口不受请求拦截的保护
+const browserPopupScript = `(() => {
+  window.open = function (url) { if (url) location.href = url; return null; };
+  const strip = e => {
+    const el = e.target instanceof Element && e.target.closest('a[target], form[target]');
+    if (el) el.removeAttribute('target');
+  };
+  document.addEventListener('click', strip, true);
+  document.addEventListener('submit', strip, true);
+})();`
+
+// start 启动浏览器或连接 BROWSER_WS_URL, 已经连接时什么都不做; 调用时持有 b.mu
+func (b *browserClient) start(ctx context.Context) error {
+	if b.conn != nil && !b.conn.closed() {
+		return nil
+	}
+	b.shutdown()
+	wsURL := b.cfg.wsURL
+	if wsURL == "" {
+		path := b.cfg.path
+		for _, name := range browserCandidates {
+			if path != "" {
+				break
+			}
+			path, _ = exec.LookPath(name)
+		}
+		if path == "" {
+			return errors.New("no Chrome or Chromium found, set BROWSER_PATH or BROWSER_WS_URL")
+		}
+		args := []string{fmt.Sprintf("--window-size=%d,%d", b.cfg.width, b.cfg.height)}
+		if b.cfg.noSandbox {
+			args = append(args, "--no-sandbox")
+		}
+		cmd, u, dir, err := launchChrome(ctx, path, args)
+		if err != nil {
+			return err
+		}
+		b.cmd, b.dataDir, wsURL = cmd, dir, u
+	}
+	conn, err := dialCDP(ctx, wsURL, b.handleEvent)
+	if err == nil {
+		b.conn = conn
+		// 发现新建的页面, 关闭页面打开的弹出窗口
+		err = conn.call(ctx, "", "Target.setDiscoverTargets", map[string]any{"discover": true}, nil)
+	}
+	if err != nil {
+		b.shutdown()
+		return err
+	}
+	return nil
+}
+
+// shutdown 关闭所有标签页, 断开连接并结束启动的浏览器; 调用时持有 b.mu
+func (b *browserClient) shutdown() {
+	for key, t := range b.tabs {
+		if b.cmd == nil && b.conn != nil && !b.conn.closed() {
+			b.closeTab(t)
+		}
+		b.sessions.Delete(t.session)
+		delete(b.tabs, key)
+	}
+	if b.conn != nil {
+		b.conn.close()
+		b.conn = nil
+	}
+	if b.cmd != nil {
+		b.cmd.Process.Kill()
+		b.cmd.Wait()
+		os.RemoveAll(b.dataDir)
+		b.cmd, b.dataDir = nil, ""
+	}
+}
+
+// closeTab 销毁标签页的浏览器上下文, 其中的页面一起关闭
+func (b *browserClient) closeTab(t *browserTab) {
+	b.sessions.Delete(t.session)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	t.conn.call(ctx, "", "Target.disposeBrowserContext", map[string]any{"browserContextId": t.contextID}, nil)
+}
+
+// sweep 关闭空闲的标签页, 没有标签页时浏览器退出
+func (b *browserClient) sweep() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	for key, t := range b.tabs {
+		if now.Sub(t.lastUsed) >= b.cfg.idle && t.mu.TryLock() {
+			b.closeTab(t)
+			delete(b.tabs, key)
+			t.mu.Unlock()
+		}
+	}
+	for key, times := range b.quota {
+		if len(times) == 0 || now.Sub(times[len(times)-1]) >= b.cfg.window {
+			delete(b.quota, key)
+		}
+	}
+	if len(b.tabs) == 0 {
+		b.shutdown()
+	} else {
+		b.sweeper.Reset(b.cfg.idle)
+	}
+}
+
+// handleEvent 在连接的读循环中调用, 需要调用浏览器的处理放到单独的 goroutine 中
+func (b *browserClient) handleEvent(c *cdpConn, msg cdpMessage) {
+	switch msg.Method {
+	case "Fetch.requestPaused":
+		go b.handleRequest(c, msg)
+	case "Target.attachedToTarget":
+		go b.handleAttached(c, msg)
+	case "Target.targetCreated":
+		var p struct {
+			TargetInfo struct {
+				TargetID string `json:"targetId"`
+				Type     string `json:"type"`
+				OpenerID string `json:"openerId"`
+			} `json:"targetInfo"`
+		}
+		if json.Unmarshal(msg.Params, &p) == nil && p.TargetInfo.Type == "page" && p.TargetInfo.OpenerID != "" {
+			go func() {
+				ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				defer cancel()
+				c.call(ctx, "", "Target.closeTarget", map[string]any{"targetId": p.TargetInfo.TargetID}, nil)
+			}()
+		}
+	}
+}
+
+// handleRequest 决定是否放行页面发出的请求
+func (b *browserClient) handleRequest(c *cdpConn, msg cdpMessage) {
+	var p struct {
+		RequestID string `json:"requestId"`
+		FrameID   string `json:"frameId"`
+		Request   struct {
+			URL string `json:"url"`
+		} `json:"request"`
+		ResourceType string `json:"resourceType"`
+	}
+	if json.Unmarshal(msg.Params, &p) != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := b.checkRequest(ctx, p.Request.URL, p.ResourceType); err != nil {
+		if v, ok := b.sessions.Load(msg.SessionID); ok && p.ResourceType == "Document" && p.FrameID == v.(*browserTab).targetID {
+			v.(*browserTab).setBlocked(fmt.Sprintf("navigation to %s was blocked: %v", truncateBytes([]byte(p.Request.URL), 200), err))
+		}
+		c.call(ctx, msg.SessionID, "Fetch.failRequest", map[string]any{"requestId": p.RequestID, "errorReason": "BlockedByClient"}, nil)
+		return
+	}
+	c.call(ctx, msg.SessionID, "Fetch.continueRequest", map[string]any{"requestId": p.RequestID}, nil)
+}
+
+// handleAttached 处理页面中的 iframe 和 worker: 同样拦截请求后继续运行; 其他页面 (弹出窗口) 直接关闭
+func (b *browserClient) handleAttached(c *cdpConn, msg cdpMessage) {
+	var p struct {
+		SessionID  string `json:"sessionId"`
+		TargetInfo struct {
+			TargetID string `json:"targetId"`
+			Type     string `json:"type"`
+		} `json:"targetInfo"`
+	}
+	if json.Unmarshal(msg.Params, &p) != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if p.TargetInfo.Type == "page" {
+		c.call(ctx, "", "Target.closeTarget", map[string]any{"targetId": p.TargetInfo.TargetID}, nil)
+		return
+	}
+	c.call(ctx, p.SessionID, "Fetch.enable", browserFetchPatterns, nil)
+	c.call(ctx, p.SessionID, "Target.setAutoAttach", browserAutoAttach, nil)
+	c.call(ctx, p.SessionID, "Runtime.runIfWaitingForDebugger", nil, nil)
+}
+
+// checkRequest 检查请求的地址: 只允许 http(s) (以及 data: 等页面内部的地址), 页面必须在允许的网站中,
+// 不允许访问内网和本机地址
+func (b *browserClient) checkRequest(ctx context.Context, rawURL, resourceType string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("invalid URL %q", rawURL)
+	}
+	switch u.Scheme {
+	case "data", "blob", "about":
+		return nil
+	case "http", "https":
+	default:
+		return fmt.Errorf("URL scheme %q is not allowed", u.Scheme)
+	}
+	host := strings.ToLower(u.Hostname())
+	if (resourceType == "Document" || b.cfg.restrictResources) && !slices.Contains(b.cfg.domains, "*") && !matchDomain(b.cfg.domains, host) {
+		return fmt.Errorf("%s is not in the allowed sites (%s)", host, strings.Join(b.cfg.domains, ", "))
+	}
+	if b.cfg.allowPrivate {
+		return nil
+	}
+	b.dnsMu.Lock()
+	err, ok := b.dns[host]
+	b.dnsMu.Unlock()
+	if ok {
+		return err
+	}
+	ips := []net.IP{net.ParseIP(host)}
+	if ips[0] == nil {
+		addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+		if err != nil {
+			return nil // 解析失败时浏览器同样无法访问
+		}
+		ips = ips[:0]
+		for _, a := range addrs {
+			ips = append(ips, a.IP)
+		}
+	}
+	for _, ip := range ips {
+		if _, ok := isPublicAddr(net.JoinHostPort(ip.String(), "0")); !ok {
+			err = fmt.Errorf("access to %s is not allowed", host)
+			break
+		}
+	}
+	b.dnsMu.Lock()
+	b.dns[host] = err
+	b.dnsMu.Unlock()
+	return err
+}
+
+func (t *browserTab) setBlocked(msg string) {
+	t.blockMu.Lock()
+	t.blocked = msg
+	t.blockMu.Unlock()
+}
+
+func (t *browserTab) lastBlocked() string {
+	t.blockMu.Lock()
+	defer t.blockMu.Unlock()
+	return t.blocked
+}
+
+// evaluate 在页面中执行脚本, 结果按 JSON 解码到 result
+func (t *browserTab) evaluate(ctx context.Context, expr string, result any) error {
+	var res struct {
+		Result struct {
+			Value json.RawMessage `json:"value"`
+		} `json:"result"`
+		ExceptionDetails *struct {
+			Text      string `json:"text"`
+			Exception struct {
+				Description string `json:"description"`
+			} `json:"exception"`
+		} `json:"exceptionDetails"`
+	}
+	if err := t.conn.call(ctx, t.session, "Runtime.evaluate", map[string]any{"expression": expr, "returnByValue": true, "awaitPromise": true}, &res); err != nil {
+		return err
+	}
+	if e := res.ExceptionDetails; e != nil {
+		msg, _, _ := strings.Cut(firstNonEmpty(e.Exception.Description, e.Text), "\n")
+		return &browserError{msg}
+	}
+	if len(res.Result.Value) == 0 {
+		return nil
+	}
+	return json.Unmarshal(res.Result.Value, result)
+}
+
+// waitLoad 等待页面的 load 事件, 超过操作超时的一半时不再等待, 返回提示
+func (t *browserTab) waitLoad(ctx context.Context, loaded <-chan cdpMessage, timeout time.Duration) string {
+	timer := time.NewTimer(timeout / 2)
+	defer timer.Stop()
+	select {
+	case <-loaded:
+		return ""
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+	return "The page is still loading, the content may be incomplete"
+}
+
+func jsString(s string) string {
+	b, _ := json.Marshal(s)
+	return string(b)
+}
+
+// browserPageScript 返回页面的地址、标题和文字, 参数是选择器、是否返回文字和是否返回链接
+const browserPageScript = `(() => {
+  const sel = %s, withText = %t, withLinks = %t;
+  const el = sel ? document.querySelector(sel) : (document.body || document.documentElement);
+  const out = {url: location.href, title: document.title, found: !!el};
+  if (!el) return out;
+  if (withText) out.text = el.innerText || el.textContent || '';
+  if (withLinks) out.links = Array.from(el.querySelectorAll('a[href]')).slice(0, %d).map(a => ({
+    text: (a.innerText || a.title || a.getAttribute('aria-label') || '').trim().replace(/\s+/g, ' ').slice(0, 100),
+    href: a.href,
+  }));
+  return out;
+})()`
+
+// pageText 按 URL、标题、提示、文字和链接的顺序输出页面内容
+func (b *browserClient) pageText(ctx context.Context, t *browserTab, selector string, withText, withLinks bool, header string) (*mcp.CallToolResult, error) {
+	var page struct {
+		URL   string `json:"url"`
+		Title string `json:"title"`
+		Found bool   `json:"found"`
+		Text  string `json:"text"`
+		Links []struct {
+			Text string `json:"text"`
+			Href string `json:"href"`
+		} `json:"links"`
+	}
+	if err := t.evaluate(ctx, fmt.Sprintf(browserPageScript, jsString(selector), withText, withLinks, browserMaxLinks), &page); err != nil {
+		return nil, err
+	}
+	if !page.Found {
+		return nil, &browserError{fmt.Sprintf("no element matches %q on %s", selector, page.URL)}
+	}
+	var sb strings.Builder
+	if header != "" {
+		sb.WriteString(header + "\n")
+	}
+	fmt.Fprintf(&sb, "URL: %s\nTitle: %s\n", page.URL, page.Title)
+	if withText {
+		sb.WriteString("\n" + truncateBytes([]byte(strings.TrimSpace(page.Text)), b.cfg.maxOutput) + "\n")
+	}
+	if len(page.Links) > 0 {
+		sb.WriteString("\nLinks:\n")
+		for _, l := range page.Links {
+			fmt.Fprintf(&sb, "- [%s](%s)\n", l.Text, l.Href)
+		}
+	}
+	return mcp.NewToolResultText(sb.String()), nil
+}
+
+func (b *browserClient) navigate(ctx context.Context, t *browserTab, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	rawURL, err := req.RequireString("url")
+	if err != nil {
+		return nil, &browserError{err.Error()}
+	}
+	if err := b.checkRequest(ctx, rawURL, "Document"); err != nil {
+		return nil, &browserError{err.Error()}
+	}
+	t.setBlocked("")
+	loaded, cancel := t.conn.subscribe(t.session, "Page.loadEventFired")
+	defer cancel()
+	var res struct {
+		ErrorText string `json:"errorText"`
+	}
+	if err := t.conn.call(ctx, t.session, "Page.navigate", map[string]any{"url": rawURL}, &res); err != nil {
+		return nil, err
+	}
+	if res.ErrorText != "" {
+		if blocked := t.lastBlocked(); blocked != "" {
+			return nil, &browserError{blocked}
+		}
+		return nil, &browserError{fmt.Sprintf("cannot open %s: %s", rawURL, res.ErrorText)}
+	}
+	return b.pageText(ctx, t, "", true, false, t.waitLoad(ctx, loaded, b.cfg.timeout))
+}
+
+func (b *browserClient) extractText(ctx context.Context, t *browserTab, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return b.pageText(ctx, t, req.GetString("selector", ""), true, req.GetBool("include_links", false), "")
+}
+
+// browserFindScript 按选择器或可见文字查找元素并滚动到中间, 返回中心点在窗口中的坐标
+const browserFindScript = `(() => {
+  const sel = %s, text = %s.trim().toLowerCase();
+  const labelOf = e => (e.innerText || e.value || e.getAttribute('aria-label') || e.title || '').trim().replace(/\s+/g, ' ');
+  let el = null;
+  if (sel) {
+    el = document.querySelector(sel);
+  } else {
+    const items = Array.from(document.querySelectorAll('a[href], button, input[type=submit], input[type=button], input[type=checkbox], input[type=radio], [role=button], [role=link], [role=tab], [role=menuitem], summary, [onclick]'));
+    el = items.find(e => labelOf(e).toLowerCase() === text) || items.find(e => labelOf(e).toLowerCase().includes(text));
+  }
+  if (!el) return {found: false};
+  el.scrollIntoView({block: 'center', inline: 'center'});
+  const r = el.getBoundingClientRect();
+  return {found: true, visible: r.width > 0 && r.height > 0, x: r.left + r.width / 2, y: r.top + r.height / 2,
+    tag: el.tagName.toLowerCase(), label: labelOf(el).slice(0, 80)};
+})()`
+
+func (b *browserClient) click(ctx context.Context, t *browserTab, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	selector, text := req.GetString("selector", ""), req.GetString("text", "")
+	if selector == "" && strings.TrimSpace(text) == "" {
+		return nil, &browserError{"either selector or text is required"}
+	}
+	var el struct {
+		Found   bool    `json:"found"`
+		Visible bool    `json:"visible"`
+		X       float64 `json:"x"`
+		Y       float64 `json:"y"`
+		Tag     string  `json:"tag"`
+		Label   string  `json:"label"`
+	}
+	if err := t.evaluate(ctx, fmt.Sprintf(browserFindScript, jsString(selector), jsString(text)), &el); err != nil {
+		return nil, err
+	}
+	if !el.Found {
+		return nil, &browserError{fmt.Sprintf("no clickable element matches %q", firstNonEmpty(selector, text))}
+	}
+	if !el.Visible {
+		return nil, &browserError{fmt.Sprintf("the <%s> element %q is not visible", el.Tag, el.Label)}
+	}
+
+	t.setBlocked("")
+	started, cancelStarted := t.conn.subscribe(t.session, "Page.frameStartedLoading")
+	defer cancelStarted()
+	loaded, cancelLoaded := t.conn.subscribe(t.session, "Page.loadEventFired")
+	defer cancelLoaded()
+	for _, typ := range []string{"mouseMoved", "mousePressed", "mouseReleased"} {
+		p := map[string]any{"type": typ, "x": el.X, "y": el.Y, "button": "left", "clickCount": 1}
+		if typ == "mouseMoved" {
+			p["button"] = "none"
+		}
+		if err := t.conn.call(ctx, t.session, "Input.dispatchMouseEvent", p, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	// 点击可能触发导航, 主框架开始加载时等待加载完成
+	navigated := false
+	timer := time.NewTimer(browserClickWait)
+	defer timer.Stop()
+wait:
+	for {
+		select {
+		case msg := <-started:
+			var p struct {
+				FrameID string `json:"frameId"`
+			}
+			if json.Unmarshal(msg.Params, &p) == nil && p.FrameID == t.targetID {
+				navigated = true
+				break wait
+			}
+		case <-timer.C:
+			break wait
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	header := fmt.Sprintf("Clicked <%s> %q", el.Tag, el.Label)
+	if navigated {
+		if note := t.waitLoad(ctx, loaded, b.cfg.timeout); note != "" {
+			header += "\n" + note
+		}
+	}
+	if blocked := t.lastBlocked(); blocked != "" {
+		return nil, &browserError{header + "\n" + blocked}
+	}
+	return b.pageText(ctx, t, "", navigated, false, header)
+}
+
+// browserRectScript 返回元素在整个页面中的位置
+const browserRectScript = `(() => {
+  const el = document.querySelector(%s);
+  if (!el) return null;
+  el.scrollIntoView({block: 'start'});
+  const r = el.getBoundingClientRect();
+  return {x: r.left + window.scrollX, y: r.top + window.scrollY, width: r.width, height: r.height};
+})()`
+
+func (b *browserClient) screenshot(ctx context.Context, t *browserTab, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	format := strings.ToLower(req.GetString("format", "png"))
+	if format == "jpg" {
+		format = "jpeg"
+	}
+	if format != "png" && format != "jpeg" {
+		return nil, &browserError{fmt.Sprintf("unsupported format %q, use png or jpeg", format)}
+	}
+	params := map[string]any{"format": format}
+	if format == "jpeg" {
+		params["quality"] = 80
+	}
+	type clip struct {
+		X      float64 `json:"x"`
+		Y      float64 `json:"y"`
+		Width  float64 `json:"width"`
+		Height float64 `json:"height"`
+		Scale  float64 `json:"scale"`
+	}
+	if selector := req.GetString("selector", ""); selector != "" {
+		var rect *clip
+		if err := t.evaluate(ctx, fmt.Sprintf(browserRectScript, jsString(selector)), &rect); err != nil {
+			return nil, err
+		}
+		if rect == nil {
+			return nil, &browserError{fmt.Sprintf("no element matches %q", selector)}
+		}
+		if rect.Width < 1 || rect.Height < 1 {
+			return nil, &browserError{fmt.Sprintf("the element %q is not visible", selector)}
+		}
+		rect.Height, rect.Scale = min(rect.Height, browserMaxPageHeight), 1
+		params["clip"], params["captureBeyondViewport"] = rect, true
+	} else if req.GetBool("full_page", false) {
+		var metrics struct {
+			ContentSize    struct{ Width, Height float64 }  `json:"contentSize"`
+			CSSContentSize *struct{ Width, Height float64 } `json:"cssContentSize"`
+		}
+		if err := t.conn.call(ctx, t.session, "Page.getLayoutMetrics", nil, &metrics); err != nil {
+			return nil, err
+		}
+		size := metrics.ContentSize
+		if metrics.CSSContentSize != nil {
+			size = *metrics.CSSContentSize
+		}
+		params["clip"] = clip{Width: size.Width, Height: min(size.Height, browserMaxPageHeight), Scale: 1}
+		params["captureBeyondViewport"] = true
+	}
+	var shot struct {
+		Data string `json:"data"`
+	}
+	if err := t.conn.call(ctx, t.session, "Page.captureScreenshot", params, &shot); err != nil {
+		return nil, err
+	}
+	if len(shot.Data) > browserMaxScreenshot {
+		return nil, &browserError{"the screenshot is too large, use format jpeg, a selector or the viewport only"}
+	}
+	var page struct {
+		URL string `json:"url"`
+	}
+	t.evaluate(ctx, "({url: location.href})", &page)
+	return mcp.NewToolResultImage("Screenshot of "+page.URL, shot.Data, "image/"+format), nil
+}
@@ -0,0 +1,74 @@
+// Package tools 是随 mcp-host 打包的 MCP 服务, 可以编译成独立的程序 (见 tools 目录),
+// 也可以在配置中用 "type": "builtin:<名称>" 在进程内运行
+package tools
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// NewCalculatorServer 提供 calculate 工具, 做四则运算
+func NewCalculatorServer() *server.MCPServer {
+	s := server.NewMCPServer(
+		"calculator-server",
+		"1.0.0",
+		server.WithResourceCapabilities(true, true),
+		server.WithPromptCapabilities(true),
+		server.WithToolCapabilities(true),
+		server.WithRecovery(),
+	)
+
+	calculatorTool := mcp.NewTool("calculate",
+		mcp.WithDescription("Perform basic arithmetic operations"),
+		mcp.WithString("operation",
+			mcp.Required(),
+			mcp.Description("The operation to perform (add, subtract, multiply, divide)"),
+			mcp.Enum("add", "subtract", "multiply", "divide"),
+		),
+		mcp.WithNumber("x",
+			mcp.Required(),
+			mcp.Description("First number"),
+		),
+		mcp.WithNumber("y",
+			mcp.Required(),
+			mcp.Description("Second number"),
+		),
+	)
+	s.AddTool(calculatorTool, calculatorHandler)
+	return s
+}
+
+func calculatorHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	op, err := request.RequireString("operation")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	x, err := request.RequireFloat("x")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	y, err := request.RequireFloat("y")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	var result float64
+	switch op {
+	case "add":
+		result = x + y
+	case "subtract":
+		result = x - y
+	case "multiply":
+		result = x * y
+	case "divide":
+		if y == 0 {
+			return mcp.NewToolResultError("cannot divide by zero"), nil
+		}
+		result = x / y
+	}
+
+	return mcp.NewToolResultText(fmt.Sprintf("%.2f", result)), nil
+}
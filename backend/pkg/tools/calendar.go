@@ -0,0 +1,572 @@
+package tools
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+const (
+	defaultCalendarTimeout   = 30 * time.Second
+	defaultCalendarCacheTTL  = 5 * time.Minute
+	defaultCalendarMaxEvents = 100
+	calendarMaxRange         = 366 * 24 * time.Hour
+	calendarMaxFeed          = 20 << 20
+)
+
+// calendarConfig 从环境变量读取:
+//   - CALENDAR_ICS_URL: ICS 订阅地址 (http/https/webcal), 比如日历服务导出的私有地址; 与 CALDAV_URL 二选一
+//   - CALDAV_URL: CalDAV 日历集合的地址, 比如 https://caldav.example.com/calendars/alice/work/
+//   - CALENDAR_USERNAME / CALENDAR_PASSWORD: 有用户名时进行 Basic 认证
+//   - CALENDAR_TIMEZONE: 显示时间和解释没有时区的时间所用的时区, 比如 Asia/Shanghai, 缺省为本机时区
+//   - CALENDAR_TIMEOUT: 每次请求的超时, 缺省 30s
+//   - CALENDAR_CACHE_TTL: ICS 订阅的缓存时间, 缺省 5m
+//   - CALENDAR_MAX_EVENTS: 每次最多列出的日程数, 缺省 100
+//   - CALENDAR_ALLOW_WRITE: 为 1 时提供 calendar_create_event (只支持 CalDAV), 缺省只读
+type calendarConfig struct {
+	icsURL     string
+	caldavURL  string
+	username   string
+	password   string
+	loc        *time.Location
+	timeout    time.Duration
+	cacheTTL   time.Duration
+	maxEvents  int
+	allowWrite bool
+}
+
+func calendarConfigFromEnv() (calendarConfig, error) {
+	cfg := calendarConfig{
+		icsURL:     os.Getenv("CALENDAR_ICS_URL"),
+		caldavURL:  os.Getenv("CALDAV_URL"),
+		username:   os.Getenv("CALENDAR_USERNAME"),
+		password:   os.Getenv("CALENDAR_PASSWORD"),
+		loc:        time.Local,
+		timeout:    defaultCalendarTimeout,
+		cacheTTL:   defaultCalendarCacheTTL,
+		maxEvents:  defaultCalendarMaxEvents,
+		allowWrite: os.Getenv("CALENDAR_ALLOW_WRITE") == "1",
+	}
+	switch {
+	case cfg.icsURL == "" && cfg.caldavURL == "":
+		return cfg, errors.New("CALENDAR_ICS_URL or CALDAV_URL must be set")
+	case cfg.icsURL != "" && cfg.caldavURL != "":
+		return cfg, errors.New("only one of CALENDAR_ICS_URL and CALDAV_URL can be set")
+	case cfg.allowWrite && cfg.caldavURL == "":
+		return cfg, errors.New("CALENDAR_ALLOW_WRITE requires CALDAV_URL, an ICS feed is read-only")
+	}
+	if rest, ok := strings.CutPrefix(cfg.icsURL, "webcal://"); ok {
+		cfg.icsURL = "https://" + rest
+	}
+	if cfg.caldavURL != "" && !strings.HasSuffix(cfg.caldavURL, "/") {
+		cfg.caldavURL += "/"
+	}
+	if v := os.Getenv("CALENDAR_TIMEZONE"); v != "" {
+		loc, err := time.LoadLocation(v)
+		if err != nil {
+			return cfg, fmt.Errorf("CALENDAR_TIMEZONE: %v", err)
+		}
+		cfg.loc = loc
+	}
+	for _, e := range []struct {
+		name string
+		dst  *time.Duration
+	}{{"CALENDAR_TIMEOUT", &cfg.timeout}, {"CALENDAR_CACHE_TTL", &cfg.cacheTTL}} {
+		if v := os.Getenv(e.name); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil || d < 0 {
+				return cfg, fmt.Errorf("%s: invalid duration %q", e.name, v)
+			}
+			*e.dst = d
+		}
+	}
+	if v := os.Getenv("CALENDAR_MAX_EVENTS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return cfg, fmt.Errorf("CALENDAR_MAX_EVENTS: invalid number %q", v)
+		}
+		cfg.maxEvents = n
+	}
+	return cfg, nil
+}
+
+// NewCalendarServer 提供日历查询工具: 列出日程 (calendar_list_events) 和查询忙闲 (calendar_free_busy),
+// 日程来自 ICS 订阅或 CalDAV 日历, 重复日程按 RRULE 展开。缺省只读, CALENDAR_ALLOW_WRITE=1 时
+// 额外提供 calendar_create_event, 主机应当为它配置 requireApproval; 配置见 calendarConfig
+func NewCalendarServer() *server.MCPServer {
+	s := server.NewMCPServer(
+		"calendar-server",
+		"1.0.0",
+		server.WithToolCapabilities(true),
+		server.WithRecovery(),
+	)
+	cfg, cfgErr := calendarConfigFromEnv()
+	c := &calendarClient{cfg: cfg, http: &http.Client{Timeout: cfg.timeout}}
+
+	timeDesc := "RFC 3339, a local time such as 2006-01-02T15:04, or a date such as 2006-01-02, in " + cfg.loc.String()
+	s.AddTool(mcp.NewTool("calendar_list_events",
+		mcp.WithDescription("List calendar events in a time range, with recurring events expanded"),
+		mcp.WithString("start", mcp.Description("Range start: "+timeDesc+"; default now")),
+		mcp.WithString("end", mcp.Description("Range end in the same formats; a date means the end of that day; default 7 days after start")),
+		mcp.WithString("query", mcp.Description("Only events whose summary, location or description contains this text")),
+		mcp.WithReadOnlyHintAnnotation(true),
+	), c.wrap(cfgErr, c.listEvents))
+	s.AddTool(mcp.NewTool("calendar_free_busy",
+		mcp.WithDescription("Show busy times and free slots in a time range, e.g. to find a time for a meeting"),
+		mcp.WithString("start", mcp.Description("Range start: "+timeDesc+"; default now")),
+		mcp.WithString("end", mcp.Description("Range end in the same formats; a date means the end of that day; default 7 days after start")),
+		mcp.WithString("working_hours", mcp.Description("Only look for free slots within these hours each day, e.g. 09:00-18:00")),
+		mcp.WithBoolean("include_weekends", mcp.Description("Also look for free slots on Saturday and Sunday when working_hours is set")),
+		mcp.WithString("min_duration", mcp.Description("Shortest free slot to report, e.g. 1h; default 30m")),
+		mcp.WithReadOnlyHintAnnotation(true),
+	), c.wrap(cfgErr, c.freeBusy))
+	if cfg.allowWrite {
+		s.AddTool(mcp.NewTool("calendar_create_event",
+			mcp.WithDescription("Create a calendar event. The user may be asked to approve it first."),
+			mcp.WithString("summary", mcp.Required(), mcp.Description("Title of the event")),
+			mcp.WithString("start", mcp.Required(), mcp.Description("Start time: "+timeDesc)),
+			mcp.WithString("end", mcp.Required(), mcp.Description("End time in the same formats")),
+			mcp.WithString("location", mcp.Description("Location")),
+			mcp.WithString("description", mcp.Description("Description")),
+			mcp.WithDestructiveHintAnnotation(false),
+			mcp.WithIdempotentHintAnnotation(false),
+		), c.wrap(cfgErr, c.createEvent))
+	}
+	return s
+}
+
+type calendarClient struct {
+	cfg  calendarConfig
+	http *http.Client
+
+	mu      sync.Mutex
+	fetched time.Time
+	cached  []icsEvent // ICS 订阅的缓存
+}
+
+// calError 是参数错误, 作为工具结果返回给大模型
+type calError struct{ msg string }
+
+func (e *calError) Error() string { return e.msg }
+
+func (c *calendarClient) wrap(cfgErr error, h func(ctx context.Context, req mcp.CallToolRequest) (string, error)) server.ToolHandlerFunc {
+	return func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		if cfgErr != nil {
+			return nil, cfgErr
+		}
+		out, err := h(ctx, req)
+		var cerr *calError
+		if errors.As(err, &cerr) {
+			return mcp.NewToolResultError(cerr.msg), nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		return mcp.NewToolResultText(out), nil
+	}
+}
+
+// events 返回与 [from, to) 有重叠的日程, 重复日程已展开, 按开始时间排序
+func (c *calendarClient) events(ctx context.Context, from, to time.Time) ([]icsEvent, error) {
+	var events []icsEvent
+	var err error
+	if c.cfg.caldavURL != "" {
+		events, err = c.caldavQuery(ctx, from, to)
+	} else {
+		events, err = c.feed(ctx)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return expandICSEvents(events, from, to), nil
+}
+
+// feed 下载并解析 ICS 订阅, 在 CALENDAR_CACHE_TTL 内使用缓存
+func (c *calendarClient) feed(ctx context.Context) ([]icsEvent, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.fetched.IsZero() && time.Since(c.fetched) < c.cfg.cacheTTL {
+		return c.cached, nil
+	}
+	body, err := c.do(ctx, http.MethodGet, c.cfg.icsURL, nil, nil, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	events, err := parseICS(body, c.cfg.loc)
+	if err != nil {
+		return nil, fmt.Errorf("parse calendar feed: %v", err)
+	}
+	c.cached, c.fetched = events, time.Now()
+	return events, nil
+}
+
+// caldavMultistatus 是 REPORT 的响应 (RFC 4791), 每个 response 是一个日历对象
+type caldavMultistatus struct {
+	Responses []struct {
+		Propstat []struct {
+			Prop struct {
+				CalendarData string `xml:"urn:ietf:params:xml:ns:caldav calendar-data"`
+			} `xml:"DAV: prop"`
+		} `xml:"DAV: propstat"`
+	} `xml:"DAV: response"`
+}
+
+// caldavQuery 用 calendar-query 查询时间范围内的日程, 由服务器展开重复日程
+func (c *calendarClient) caldavQuery(ctx context.Context, from, to time.Time) ([]icsEvent, error) {
+	const layout = "20060102T150405Z"
+	start, end := from.UTC().Format(layout), to.UTC().Format(layout)
+	query := `<?xml version="1.0" encoding="utf-8"?>
+<C:calendar-query xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav">
+  <D:prop><C:calendar-data><C:expand start="` + start + `" end="` + end + `"/></C:calendar-data></D:prop>
+  <C:filter><C:comp-filter name="VCALENDAR"><C:comp-filter name="VEVENT">
+    <C:time-range start="` + start + `" end="` + end + `"/>
+  </C:comp-filter></C:comp-filter></C:filter>
+</C:calendar-query>`
+	header := http.Header{"Depth": {"1"}, "Content-Type": {"application/xml; charset=utf-8"}}
+	body, err := c.do(ctx, "REPORT", c.cfg.caldavURL, header, []byte(query), http.StatusMultiStatus)
+	if err != nil {
+		return nil, err
+	}
+	var ms caldavMultistatus
+	if err := xml.Unmarshal(body, &ms); err != nil {
+		return nil, fmt.Errorf("parse caldav response: %v", err)
+	}
+	var events []icsEvent
+	for _, r := range ms.Responses {
+		for _, ps := range r.Propstat {
+			if ps.Prop.CalendarData == "" {
+				continue
+			}
+			evs, err := parseICS([]byte(ps.Prop.CalendarData), c.cfg.loc)
+			if err != nil {
+				return nil, fmt.Errorf("parse calendar data: %v", err)
+			}
+			events = append(events, evs...)
+		}
+	}
+	return events, nil
+}
+
+// do 发送请求, 状态码不是 want 时返回错误
+func (c *calendarClient) do(ctx context.Context, method, url string, header http.Header, body []byte, want int) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if c.cfg.username != "" {
+		req.SetBasicAuth(c.cfg.username, c.cfg.password)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, calendarMaxFeed+1))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != want {
+		return nil, fmt.Errorf("calendar: %s %s: %s", method, url, resp.Status)
+	}
+	if len(data) > calendarMaxFeed {
+		return nil, fmt.Errorf("calendar: response is larger than %d bytes", calendarMaxFeed)
+	}
+	return data, nil
+}
+
+// timeRange 读取 start 和 end 参数
+func (c *calendarClient) timeRange(req mcp.CallToolRequest) (time.Time, time.Time, error) {
+	from := time.Now().In(c.cfg.loc)
+	if v := req.GetString("start", ""); v != "" {
+		t, _, err := c.parseTime(v)
+		if err != nil {
+			return from, from, err
+		}
+		from = t
+	}
+	to := from.AddDate(0, 0, 7)
+	if v := req.GetString("end", ""); v != "" {
+		t, date, err := c.parseTime(v)
+		if err != nil {
+			return from, to, err
+		}
+		if date {
+			t = t.AddDate(0, 0, 1)
+		}
+		to = t
+	}
+	if !to.After(from) {
+		return from, to, &calError{"end must be after start"}
+	}
+	if to.Sub(from) > calendarMaxRange {
+		return from, to, &calError{"the range is too long, query at most one year at a time"}
+	}
+	return from, to, nil
+}
+
+// parseTime 解析 RFC 3339、本地时间或日期, date 表示参数只有日期
+func (c *calendarClient) parseTime(v string) (t time.Time, date bool, err error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t.In(c.cfg.loc), false, nil
+	}
+	for _, layout := range []string{"2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02 15:04"} {
+		if t, err := time.ParseInLocation(layout, v, c.cfg.loc); err == nil {
+			return t, false, nil
+		}
+	}
+	if t, err := time.ParseInLocation("2006-01-02", v, c.cfg.loc); err == nil {
+		return t, true, nil
+	}
+	return time.Time{}, false, &calError{fmt.Sprintf("invalid time %q: use RFC 3339, 2006-01-02T15:04 or 2006-01-02", v)}
+}
+
+func (c *calendarClient) listEvents(ctx context.Context, req mcp.CallToolRequest) (string, error) {
+	from, to, err := c.timeRange(req)
+	if err != nil {
+		return "", err
+	}
+	events, err := c.events(ctx, from, to)
+	if err != nil {
+		return "", err
+	}
+	if q := strings.ToLower(req.GetString("query", "")); q != "" {
+		events = slices.DeleteFunc(events, func(ev icsEvent) bool {
+			return !strings.Contains(strings.ToLower(ev.summary+"\n"+ev.location+"\n"+ev.description), q)
+		})
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d events from %s to %s (%s)\n", len(events), c.formatTime(from), c.formatTime(to), c.cfg.loc)
+	for i, ev := range events {
+		if i == c.cfg.maxEvents {
+			fmt.Fprintf(&b, "... %d more, narrow the range or add a query\n", len(events)-i)
+			break
+		}
+		b.WriteString(c.formatSpan(ev))
+		b.WriteString("  " + cmp.Or(ev.summary, "(no title)"))
+		if ev.location != "" {
+			b.WriteString(" @ " + ev.location)
+		}
+		if ev.status == "CANCELLED" || ev.status == "TENTATIVE" {
+			b.WriteString(" [" + strings.ToLower(ev.status) + "]")
+		}
+		b.WriteByte('\n')
+		if ev.description != "" {
+			desc, _, _ := strings.Cut(strings.TrimSpace(ev.description), "\n")
+			b.WriteString("    " + truncateBytes([]byte(desc), 200) + "\n")
+		}
+	}
+	return b.String(), nil
+}
+
+func (c *calendarClient) freeBusy(ctx context.Context, req mcp.CallToolRequest) (string, error) {
+	from, to, err := c.timeRange(req)
+	if err != nil {
+		return "", err
+	}
+	minDuration := 30 * time.Minute
+	if v := req.GetString("min_duration", ""); v != "" {
+		if minDuration, err = time.ParseDuration(v); err != nil || minDuration <= 0 {
+			return "", &calError{fmt.Sprintf("invalid min_duration %q", v)}
+		}
+	}
+	windows := []calSpan{{from, to}}
+	if v := req.GetString("working_hours", ""); v != "" {
+		if windows, err = workingWindows(v, from, to, req.GetBool("include_weekends", false)); err != nil {
+			return "", err
+		}
+	}
+	events, err := c.events(ctx, from, to)
+	if err != nil {
+		return "", err
+	}
+
+	// 透明和已取消的日程不占用时间, 重叠的忙碌时间合并
+	var busy []calSpan
+	for _, ev := range events {
+		if ev.transparent || ev.status == "CANCELLED" || !ev.end.After(ev.start) {
+			continue
+		}
+		if n := len(busy); n > 0 && !ev.start.After(busy[n-1].end) {
+			if ev.end.After(busy[n-1].end) {
+				busy[n-1].end = ev.end
+			}
+			continue
+		}
+		busy = append(busy, calSpan{ev.start, ev.end})
+	}
+	var free []calSpan
+	for _, w := range windows {
+		cur := w.start
+		for _, bs := range busy {
+			if !bs.end.After(cur) || !bs.start.Before(w.end) {
+				continue
+			}
+			if bs.start.Sub(cur) >= minDuration {
+				free = append(free, calSpan{cur, bs.start})
+			}
+			cur = bs.end
+		}
+		if w.end.Sub(cur) >= minDuration {
+			free = append(free, calSpan{cur, w.end})
+		}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "From %s to %s (%s)\n", c.formatTime(from), c.formatTime(to), c.cfg.loc)
+	fmt.Fprintf(&b, "Busy (%d):\n", len(busy))
+	for _, s := range busy {
+		b.WriteString("  " + c.formatSpan(icsEvent{start: s.start, end: s.end}) + "\n")
+	}
+	fmt.Fprintf(&b, "Free, at least %s (%d):\n", minDuration, len(free))
+	for _, s := range free {
+		b.WriteString("  " + c.formatSpan(icsEvent{start: s.start, end: s.end}) + " (" + s.end.Sub(s.start).String() + ")\n")
+	}
+	return b.String(), nil
+}
+
+type calSpan struct{ start, end time.Time }
+
+// workingWindows 把 [from, to) 限制在每天的工作时间内, 比如 09:00-18:00
+func workingWindows(hours string, from, to time.Time, weekends bool) ([]calSpan, error) {
+	parseClock := func(s string) (time.Duration, bool) {
+		t, err := time.Parse("15:04", strings.TrimSpace(s))
+		return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, err == nil
+	}
+	a, b, _ := strings.Cut(hours, "-")
+	open, ok1 := parseClock(a)
+	closing, ok2 := parseClock(b)
+	if !ok1 || !ok2 || closing <= open {
+		return nil, &calError{fmt.Sprintf("invalid working_hours %q, use e.g. 09:00-18:00", hours)}
+	}
+	var out []calSpan
+	y, m, d := from.Date()
+	for day := time.Date(y, m, d, 0, 0, 0, 0, from.Location()); day.Before(to); day = day.AddDate(0, 0, 1) {
+		if !weekends && (day.Weekday() == time.Saturday || day.Weekday() == time.Sunday) {
+			continue
+		}
+		// 按钟点而不是时长计算, 夏令时切换的那天也是同样的钟点
+		s := time.Date(day.Year(), day.Month(), day.Day(), 0, int(open.Minutes()), 0, 0, day.Location())
+		e := time.Date(day.Year(), day.Month(), day.Day(), 0, int(closing.Minutes()), 0, 0, day.Location())
+		if s.Before(from) {
+			s = from
+		}
+		if e.After(to) {
+			e = to
+		}
+		if e.After(s) {
+			out = append(out, calSpan{s, e})
+		}
+	}
+	return out, nil
+}
+
+func (c *calendarClient) createEvent(ctx context.Context, req mcp.CallToolRequest) (string, error) {
+	summary, err := req.RequireString("summary")
+	if err != nil {
+		return "", &calError{err.Error()}
+	}
+	var times [2]time.Time
+	for i, name := range []string{"start", "end"} {
+		v, err := req.RequireString(name)
+		if err != nil {
+			return "", &calError{err.Error()}
+		}
+		if times[i], _, err = c.parseTime(v); err != nil {
+			return "", err
+		}
+	}
+	if !times[1].After(times[0]) {
+		return "", &calError{"end must be after start"}
+	}
+
+	idBytes := make([]byte, 16)
+	rand.Read(idBytes)
+	uid := hex.EncodeToString(idBytes)
+	const layout = "20060102T150405Z"
+	var b bytes.Buffer
+	line := func(name, value string) { b.WriteString(foldICSLine(name+":"+value) + "\r\n") }
+	line("BEGIN", "VCALENDAR")
+	line("VERSION", "2.0")
+	line("PRODID", "-//mcp-host-web//calendar//EN")
+	line("BEGIN", "VEVENT")
+	line("UID", uid)
+	line("DTSTAMP", time.Now().UTC().Format(layout))
+	line("DTSTART", times[0].UTC().Format(layout))
+	line("DTEND", times[1].UTC().Format(layout))
+	line("SUMMARY", escapeICSText(summary))
+	if v := req.GetString("location", ""); v != "" {
+		line("LOCATION", escapeICSText(v))
+	}
+	if v := req.GetString("description", ""); v != "" {
+		line("DESCRIPTION", escapeICSText(v))
+	}
+	line("END", "VEVENT")
+	line("END", "VCALENDAR")
+
+	// If-None-Match: * 保证不会覆盖已有的日程
+	header := http.Header{"Content-Type": {"text/calendar; charset=utf-8"}, "If-None-Match": {"*"}}
+	if _, err := c.do(ctx, http.MethodPut, c.cfg.caldavURL+uid+".ics", header, b.Bytes(), http.StatusCreated); err != nil {
+		return "", err
+	}
+	ev := icsEvent{start: times[0], end: times[1]}
+	return fmt.Sprintf("created %q, %s (%s)", summary, c.formatSpan(ev), c.cfg.loc), nil
+}
+
+func escapeICSText(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(s)
+}
+
+// foldICSLine 把超过 75 字节的行折成多行, 不拆开 UTF-8 字符
+func foldICSLine(s string) string {
+	var b strings.Builder
+	n := 0
+	for _, r := range s {
+		if size := len(string(r)); n+size > 75 {
+			b.WriteString("\r\n ")
+			n = 1
+		}
+		b.WriteRune(r)
+		n += len(string(r))
+	}
+	return b.String()
+}
+
+func (c *calendarClient) formatTime(t time.Time) string {
+	return t.In(c.cfg.loc).Format("2006-01-02 Mon 15:04")
+}
+
+// formatSpan 格式化日程的时间, 全天日程只显示日期, 同一天结束的只显示结束的钟点
+func (c *calendarClient) formatSpan(ev icsEvent) string {
+	if ev.allDay {
+		last := ev.end.AddDate(0, 0, -1)
+		if !last.After(ev.start) {
+			return ev.start.Format("2006-01-02 Mon") + " all day"
+		}
+		return ev.start.Format("2006-01-02 Mon") + " - " + last.Format("2006-01-02 Mon") + " all day"
+	}
+	start, end := ev.start.In(c.cfg.loc), ev.end.In(c.cfg.loc)
+	if end.Format("20060102") == start.Format("20060102") {
+		return c.formatTime(start) + "-" + end.Format("15:04")
+	}
+	return c.formatTime(start) + " - " + c.formatTime(end)
+}
@@ -0,0 +1,253 @@
+package tools
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// cdpConn 是到浏览器的 Chrome DevTools Protocol 连接。使用 flatten 模式, 发给页面的命令带 sessionId,
+// 所有页面共用一个 WebSocket
+type cdpConn struct {
+	ws      *websocket.Conn
+	writeMu sync.Mutex
+
+	mu      sync.Mutex
+	nextID  int64
+	pending map[int64]chan cdpMessage
+	subs    map[*cdpSub]bool
+	onEvent func(*cdpConn, cdpMessage) // 在读循环中调用, 不能阻塞
+	done    chan struct{}
+	err     error
+}
+
+type cdpMessage struct {
+	ID        int64           `json:"id,omitempty"`
+	SessionID string          `json:"sessionId,omitempty"`
+	Method    string          `json:"method,omitempty"`
+	Params    json.RawMessage `json:"params,omitempty"`
+	Result    json.RawMessage `json:"result,omitempty"`
+	Error     *cdpError       `json:"error,omitempty"`
+}
+
+type cdpError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *cdpError) Error() string { return fmt.Sprintf("%s (%d)", e.Message, e.Code) }
+
+type cdpSub struct {
+	method    string
+	sessionID string
+	ch        chan cdpMessage
+}
+
+var errCDPClosed = errors.New("browser connection closed")
+
+func dialCDP(ctx context.Context, wsURL string, onEvent func(*cdpConn, cdpMessage)) (*cdpConn, error) {
+	ws, _, err := websocket.DefaultDialer.DialContext(ctx, wsURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("connect to browser: %w", err)
+	}
+	c := &cdpConn{
+		ws:      ws,
+		pending: map[int64]chan cdpMessage{},
+		subs:    map[*cdpSub]bool{},
+		onEvent: onEvent,
+		done:    make(chan struct{}),
+	}
+	go c.readLoop()
+	return c, nil
+}
+
+func (c *cdpConn) readLoop() {
+	defer close(c.done)
+	for {
+		var msg cdpMessage
+		if err := c.ws.ReadJSON(&msg); err != nil {
+			c.mu.Lock()
+			c.err = err
+			c.mu.Unlock()
+			return
+		}
+		if msg.ID != 0 {
+			c.mu.Lock()
+			ch := c.pending[msg.ID]
+			delete(c.pending, msg.ID)
+			c.mu.Unlock()
+			if ch != nil {
+				ch <- msg
+			}
+			continue
+		}
+		if c.onEvent != nil {
+			c.onEvent(c, msg)
+		}
+		c.mu.Lock()
+		for s := range c.subs {
+			if s.method == msg.Method && s.sessionID == msg.SessionID {
+				select {
+				case s.ch <- msg:
+				default: // 没有及时读取的事件被丢弃
+				}
+			}
+		}
+		c.mu.Unlock()
+	}
+}
+
+// call 发送命令并等待结果, sessionID 为空时发给浏览器本身
+func (c *cdpConn) call(ctx context.Context, sessionID, method string, params, result any) error {
+	ch := make(chan cdpMessage, 1)
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return errCDPClosed
+	}
+	c.nextID++
+	id := c.nextID
+	c.pending[id] = ch
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+	}()
+
+	if params == nil {
+		params = struct{}{}
+	}
+	req := struct {
+		ID        int64  `json:"id"`
+		SessionID string `json:"sessionId,omitempty"`
+		Method    string `json:"method"`
+		Params    any    `json:"params"`
+	}{id, sessionID, method, params}
+	c.writeMu.Lock()
+	err := c.ws.WriteJSON(req)
+	c.writeMu.Unlock()
+	if err != nil {
+		return fmt.Errorf("%s: %w", method, err)
+	}
+
+	select {
+	case msg := <-ch:
+		if msg.Error != nil {
+			return fmt.Errorf("%s: %w", method, msg.Error)
+		}
+		if result != nil && len(msg.Result) > 0 {
+			return json.Unmarshal(msg.Result, result)
+		}
+		return nil
+	case <-c.done:
+		return errCDPClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// subscribe 订阅一个会话的事件, 需要在触发事件的命令之前订阅
+func (c *cdpConn) subscribe(sessionID, method string) (<-chan cdpMessage, func()) {
+	s := &cdpSub{method: method, sessionID: sessionID, ch: make(chan cdpMessage, 16)}
+	c.mu.Lock()
+	c.subs[s] = true
+	c.mu.Unlock()
+	return s.ch, func() {
+		c.mu.Lock()
+		delete(c.subs, s)
+		c.mu.Unlock()
+	}
+}
+
+func (c *cdpConn) closed() bool {
+	select {
+	case <-c.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (c *cdpConn) close() {
+	c.ws.Close()
+	<-c.done
+}
+
+var devtoolsListening = regexp.MustCompile(`DevTools listening on (ws://\S+)`)
+
+// launchChrome 启动无头浏览器, 从 stderr 读取 DevTools 的 WebSocket 地址; 浏览器的数据目录在 dataDir,
+// 关闭时需要结束进程并删除目录
+func launchChrome(ctx context.Context, path string, args []string) (cmd *exec.Cmd, wsURL, dataDir string, err error) {
+	dataDir, err = os.MkdirTemp("", "mcp-browser-")
+	if err != nil {
+		return nil, "", "", err
+	}
+	args = append([]string{
+		"--headless=new",
+		"--remote-debugging-port=0",
+		"--user-data-dir=" + dataDir,
+		"--no-first-run",
+		"--no-default-browser-check",
+		"--disable-extensions",
+		"--disable-background-networking",
+		"--disable-sync",
+		"--disable-default-apps",
+		"--disable-gpu",
+		"--mute-audio",
+		"--hide-scrollbars",
+		// 跨站 iframe 留在页面的进程中, 页面的请求拦截也覆盖 iframe
+		"--disable-features=IsolateOrigins,site-per-process",
+	}, args...)
+	args = append(args, "about:blank")
+	cmd = exec.Command(path, args...)
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		os.RemoveAll(dataDir)
+		return nil, "", "", err
+	}
+	if err := cmd.Start(); err != nil {
+		os.RemoveAll(dataDir)
+		return nil, "", "", fmt.Errorf("start browser %s: %w", path, err)
+	}
+	found := make(chan string, 1)
+	go func() {
+		sc := bufio.NewScanner(stderr)
+		for sc.Scan() {
+			if m := devtoolsListening.FindStringSubmatch(sc.Text()); m != nil {
+				found <- m[1]
+				break
+			}
+		}
+		// 继续读取, 避免浏览器写 stderr 时阻塞
+		for sc.Scan() {
+		}
+		close(found)
+	}()
+	t := time.NewTimer(20 * time.Second)
+	defer t.Stop()
+	select {
+	case u, ok := <-found:
+		if ok {
+			return cmd, u, dataDir, nil
+		}
+		err = errors.New("browser exited before DevTools was ready")
+	case <-t.C:
+		err = errors.New("timed out waiting for the browser to start")
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	cmd.Process.Kill()
+	cmd.Wait()
+	os.RemoveAll(dataDir)
+	return nil, "", "", err
+}
@@ -0,0 +1,580 @@
+package tools
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+	"unicode/utf8"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+const (
+	defaultDocumentDir       = "data/uploads"
+	defaultDocumentMaxBytes  = 30 << 20
+	defaultDocumentMaxOutput = 50000
+	defaultDocumentTimeout   = 60 * time.Second
+	docxMaxXML               = 50 << 20 // document.xml 解压后的上限, 防止压缩炸弹
+)
+
+// documentConfig 从环境变量读取:
+//   - DOCUMENT_ALLOWED_DIRS: 允许读取的本地目录, 逗号分隔, 缺省为 data/uploads (用户上传的文件)
+//   - DOCUMENT_ALLOW_URLS: 为 0 时不允许下载 URL, 缺省允许 http(s) 地址
+//   - DOCUMENT_ALLOWED_DOMAINS: 允许下载的域名, 逗号分隔, *.example.com 匹配子域名; 缺省不限制
+//   - DOCUMENT_ALLOW_PRIVATE: 为 1 时允许下载内网和本机地址, 缺省拒绝
+//   - DOCUMENT_MAX_BYTES: 文档大小的上限, 缺省 30MB
+//   - DOCUMENT_MAX_OUTPUT: 每次最多返回的字节数, 缺省 50000, 更长的文档需要按页分次读取
+//   - DOCUMENT_TIMEOUT: 下载的超时, 缺省 60s
+type documentConfig struct {
+	dirs         []string
+	allowURLs    bool
+	domains      []string
+	allowPrivate bool
+	maxBytes     int
+	maxOutput    int
+	timeout      time.Duration
+}
+
+func documentConfigFromEnv() (documentConfig, error) {
+	cfg := documentConfig{
+		allowURLs:    os.Getenv("DOCUMENT_ALLOW_URLS") != "0",
+		allowPrivate: os.Getenv("DOCUMENT_ALLOW_PRIVATE") == "1",
+		maxBytes:     defaultDocumentMaxBytes,
+		maxOutput:    defaultDocumentMaxOutput,
+		timeout:      defaultDocumentTimeout,
+	}
+	for _, d := range strings.Split(os.Getenv("DOCUMENT_ALLOWED_DIRS"), ",") {
+		if d = strings.TrimSpace(d); d != "" {
+			abs, err := filepath.Abs(d)
+			if err != nil {
+				return cfg, fmt.Errorf("DOCUMENT_ALLOWED_DIRS: %w", err)
+			}
+			cfg.dirs = append(cfg.dirs, abs)
+		}
+	}
+	if len(cfg.dirs) == 0 {
+		abs, err := filepath.Abs(defaultDocumentDir)
+		if err != nil {
+			return cfg, err
+		}
+		cfg.dirs = []string{abs}
+	}
+	for _, d := range strings.Split(os.Getenv("DOCUMENT_ALLOWED_DOMAINS"), ",") {
+		if d = strings.ToLower(strings.TrimSpace(d)); d != "" {
+			cfg.domains = append(cfg.domains, d)
+		}
+	}
+	for _, e := range []struct {
+		name string
+		dst  *int
+	}{{"DOCUMENT_MAX_BYTES", &cfg.maxBytes}, {"DOCUMENT_MAX_OUTPUT", &cfg.maxOutput}} {
+		if v := os.Getenv(e.name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 {
+				return cfg, fmt.Errorf("%s: invalid number %q", e.name, v)
+			}
+			*e.dst = n
+		}
+	}
+	if v := os.Getenv("DOCUMENT_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return cfg, fmt.Errorf("DOCUMENT_TIMEOUT: invalid duration %q", v)
+		}
+		cfg.timeout = d
+	}
+	return cfg, nil
+}
+
+// NewDocumentServer 提供 extract_document 工具, 从用户上传的文件或 URL 提取 PDF、DOCX、HTML 和文本文档的文字,
+// 可以按页读取, 让大模型按需阅读长文档; 配置见 documentConfig
+func NewDocumentServer() *server.MCPServer {
+	s := server.NewMCPServer(
+		"document-server",
+		"1.0.0",
+		server.WithToolCapabilities(true),
+		server.WithRecovery(),
+	)
+	cfg, cfgErr := documentConfigFromEnv()
+	d := newDocumentClient(cfg)
+
+	sourceDesc := "file:// URI or path of an uploaded file"
+	if cfg.allowURLs {
+		sourceDesc += ", or an http(s) URL"
+	}
+	s.AddTool(mcp.NewTool("extract_document",
+		mcp.WithDescription("Extract the text of a PDF, DOCX, HTML or plain text document, page by page. "+
+			"Long documents are truncated; read them in parts with the pages argument. "+
+			"Scanned PDFs without a text layer return no text"),
+		mcp.WithString("source", mcp.Required(), mcp.Description(sourceDesc)),
+		mcp.WithString("pages", mcp.Description(`Pages to extract, such as "1-3,5" or "10-" (to the end); default all pages`)),
+		mcp.WithReadOnlyHintAnnotation(true),
+	), d.wrap(cfgErr, d.extract))
+	return s
+}
+
+type documentClient struct {
+	cfg  documentConfig
+	http *http.Client
+}
+
+func newDocumentClient(cfg documentConfig) *documentClient {
+	d := &documentClient{cfg: cfg}
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	if !cfg.allowPrivate {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			if host, ok := isPublicAddr(address); !ok {
+				return &documentError{fmt.Sprintf("access to %s is not allowed", host)}
+			}
+			return nil
+		}
+	}
+	d.http = &http.Client{
+		Timeout:   cfg.timeout,
+		Transport: &http.Transport{DialContext: dialer.DialContext, TLSHandshakeTimeout: 10 * time.Second},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 5 {
+				return errors.New("too many redirects")
+			}
+			return d.checkURL(req.URL)
+		},
+	}
+	return d
+}
+
+// documentError 是参数错误或无法读取的文档, 作为工具结果返回给大模型
+type documentError struct{ msg string }
+
+func (e *documentError) Error() string { return e.msg }
+
+func (d *documentClient) wrap(cfgErr error, h func(ctx context.Context, req mcp.CallToolRequest) (string, error)) server.ToolHandlerFunc {
+	return func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		if cfgErr != nil {
+			return nil, cfgErr
+		}
+		out, err := h(ctx, req)
+		var derr *documentError
+		if errors.As(err, &derr) {
+			return mcp.NewToolResultError(derr.msg), nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		return mcp.NewToolResultText(out), nil
+	}
+}
+
+func (d *documentClient) checkURL(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return &documentError{fmt.Sprintf("unsupported URL scheme %q, use http or https", u.Scheme)}
+	}
+	if len(d.cfg.domains) > 0 && !matchDomain(d.cfg.domains, u.Hostname()) {
+		return &documentError{fmt.Sprintf("%s is not in the allowed domains (%s)", u.Hostname(), strings.Join(d.cfg.domains, ", "))}
+	}
+	return nil
+}
+
+// load 读取本地文件或下载 URL, 返回内容、文件名和 Content-Type (本地文件为空)
+func (d *documentClient) load(ctx context.Context, source string) ([]byte, string, string, error) {
+	if u, err := url.Parse(source); err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+		if !d.cfg.allowURLs {
+			return nil, "", "", &documentError{"downloading URLs is disabled, only uploaded files can be read"}
+		}
+		data, contentType, err := d.download(ctx, u)
+		return data, path.Base(u.Path), contentType, err
+	}
+	data, err := d.readFile(source)
+	return data, filepath.Base(filepath.FromSlash(source)), "", err
+}
+
+// readFile 读取允许的目录中的文件, 符号链接解析后再检查, 防止通过链接读取其他文件
+func (d *documentClient) readFile(source string) ([]byte, error) {
+	p := source
+	if rest, ok := strings.CutPrefix(source, "file://"); ok {
+		// 上传文件的 URI 没有转义 (file:///data/x.pdf, Windows 上是 file://C:/data/x.pdf), 找不到时再按转义的 URI 处理
+		p = rest
+		if _, err := os.Stat(filepath.FromSlash(p)); err != nil {
+			if unescaped, err := url.PathUnescape(rest); err == nil {
+				p = unescaped
+			}
+		}
+	} else if u, err := url.Parse(source); err == nil && len(u.Scheme) > 1 {
+		return nil, &documentError{fmt.Sprintf("unsupported source %q, use a file:// URI or an http(s) URL", source)}
+	}
+	abs, err := filepath.Abs(filepath.FromSlash(p))
+	if err != nil {
+		return nil, &documentError{err.Error()}
+	}
+	inDirs := func(p string) bool {
+		for _, dir := range d.cfg.dirs {
+			dirs := []string{dir}
+			if rd, err := filepath.EvalSymlinks(dir); err == nil {
+				dirs = append(dirs, rd)
+			}
+			for _, dir := range dirs {
+				if rel, err := filepath.Rel(dir, p); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	// 先检查路径本身, 不透露允许的目录以外的文件是否存在
+	if !inDirs(abs) {
+		return nil, &documentError{fmt.Sprintf("%s is outside the allowed directories", source)}
+	}
+	resolved, err := filepath.EvalSymlinks(abs)
+	if err != nil {
+		return nil, &documentError{fmt.Sprintf("cannot open %s: file not found", source)}
+	}
+	if !inDirs(resolved) {
+		return nil, &documentError{fmt.Sprintf("%s is outside the allowed directories", source)}
+	}
+	fi, err := os.Stat(resolved)
+	if err != nil {
+		return nil, &documentError{err.Error()}
+	}
+	if !fi.Mode().IsRegular() {
+		return nil, &documentError{fmt.Sprintf("%s is not a regular file", source)}
+	}
+	if fi.Size() > int64(d.cfg.maxBytes) {
+		return nil, &documentError{fmt.Sprintf("%s is larger than %d bytes", source, d.cfg.maxBytes)}
+	}
+	return os.ReadFile(resolved)
+}
+
+func (d *documentClient) download(ctx context.Context, u *url.URL) ([]byte, string, error) {
+	if err := d.checkURL(u); err != nil {
+		return nil, "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, "", err
+	}
+	resp, err := d.http.Do(req)
+	var derr *documentError
+	if errors.As(err, &derr) {
+		return nil, "", derr
+	}
+	if err != nil {
+		return nil, "", &documentError{err.Error()}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", &documentError{fmt.Sprintf("GET %s: %s", u, resp.Status)}
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, int64(d.cfg.maxBytes)+1))
+	if err != nil {
+		return nil, "", &documentError{err.Error()}
+	}
+	if len(body) > d.cfg.maxBytes {
+		return nil, "", &documentError{fmt.Sprintf("%s is larger than %d bytes", u, d.cfg.maxBytes)}
+	}
+	return body, resp.Header.Get("Content-Type"), nil
+}
+
+// document 是解析后的文档, page 按页码 (从 1 开始) 返回一页的文字
+type document struct {
+	kind        string
+	title       string
+	author      string
+	pages       int
+	page        func(n int) string
+	approxPages bool // DOCX 没有真正的分页, 页码按 Word 保存的分页位置估计
+}
+
+// parseDocument 按文件内容识别格式, 无法识别时按 Content-Type 和扩展名判断是否为文本
+func parseDocument(data []byte, name, contentType string) (*document, error) {
+	mediaType, params, _ := mime.ParseMediaType(contentType)
+	ext := strings.ToLower(path.Ext(name))
+	switch {
+	case bytes.HasPrefix(bytes.TrimLeft(data[:min(len(data), 1024)], "\x00\r\n\t "), []byte("%PDF-")):
+		p, err := parsePDF(data)
+		if err != nil {
+			return nil, &documentError{fmt.Sprintf("cannot read PDF: %v", err)}
+		}
+		doc := &document{kind: "PDF", pages: len(p.pages), page: func(n int) string { return p.pageText(p.pages[n-1]) }}
+		doc.title, doc.author = p.info()
+		return doc, nil
+	case bytes.HasPrefix(data, []byte("PK\x03\x04")):
+		pages, title, author, err := parseDOCX(data)
+		if err != nil {
+			return nil, &documentError{err.Error()}
+		}
+		return &document{kind: "DOCX", title: title, author: author, pages: len(pages), approxPages: len(pages) > 1,
+			page: func(n int) string { return pages[n-1] }}, nil
+	case mediaType == "text/html" || mediaType == "application/xhtml+xml" || ext == ".html" || ext == ".htm":
+		page, err := decodeHTML(data, params["charset"])
+		if err != nil {
+			return nil, &documentError{err.Error()}
+		}
+		a := extractArticle(page)
+		if a.text == "" {
+			a.text = htmlToText(page)
+		}
+		return &document{kind: "HTML", title: a.title, author: a.byline, pages: 1, page: func(int) string { return a.text }}, nil
+	case strings.HasPrefix(mediaType, "text/") || mediaType == "application/json" || documentTextExts[ext] ||
+		mediaType == "" && ext == "" && utf8.Valid(data):
+		if !utf8.Valid(data) {
+			return nil, &documentError{"the text file is not UTF-8 encoded"}
+		}
+		text := string(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")))
+		return &document{kind: "text", pages: 1, page: func(int) string { return text }}, nil
+	}
+	return nil, &documentError{"unsupported document format, supported: PDF, DOCX, HTML and plain text"}
+}
+
+var documentTextExts = map[string]bool{
+	".txt": true, ".md": true, ".markdown": true, ".csv": true, ".tsv": true, ".json": true,
+	".log": true, ".xml": true, ".yaml": true, ".yml": true, ".rst": true,
+}
+
+func (d *documentClient) extract(ctx context.Context, req mcp.CallToolRequest) (string, error) {
+	source, err := req.RequireString("source")
+	if err != nil {
+		return "", &documentError{err.Error()}
+	}
+	source = strings.TrimSpace(source)
+	data, name, contentType, err := d.load(ctx, source)
+	if err != nil {
+		return "", err
+	}
+	doc, err := parseDocument(data, name, contentType)
+	if err != nil {
+		return "", err
+	}
+	pages, err := parsePageRanges(req.GetString("pages", ""), doc.pages)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Document: %s (%s, %d page(s))\n", name, doc.kind, doc.pages)
+	if doc.title != "" {
+		fmt.Fprintf(&b, "Title: %s\n", doc.title)
+	}
+	if doc.author != "" {
+		fmt.Fprintf(&b, "Author: %s\n", doc.author)
+	}
+	if doc.approxPages {
+		b.WriteString("Note: DOCX page numbers are estimated from the page breaks saved by Word\n")
+	}
+	empty := true
+	for i, n := range pages {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		text := doc.page(n)
+		if strings.TrimSpace(text) != "" {
+			empty = false
+		}
+		if doc.pages > 1 {
+			text = fmt.Sprintf("\n--- Page %d ---\n%s\n", n, text)
+		} else {
+			text = "\n" + text + "\n"
+		}
+		// 超过上限时截断, 并提示从下一页继续读取
+		if b.Len()+len(text) > d.cfg.maxOutput {
+			if i == 0 {
+				b.WriteString(truncateBytes([]byte(text), max(d.cfg.maxOutput-b.Len(), 0)) + "\n")
+				if len(pages) > 1 {
+					fmt.Fprintf(&b, "\n[Output limit reached; continue with pages=\"%d-\"]\n", pages[1])
+				}
+			} else {
+				fmt.Fprintf(&b, "\n[Output limit reached; continue with pages=\"%d-\"]\n", n)
+			}
+			return b.String(), nil
+		}
+		b.WriteString(text)
+	}
+	if empty && doc.kind == "PDF" {
+		b.WriteString("\n[No text found. The PDF may contain only scanned images, which need OCR]\n")
+	}
+	return b.String(), nil
+}
+
+// parsePageRanges 解析 "1-3,5,10-" 形式的页码范围, 为空时返回所有页
+func parsePageRanges(spec string, total int) ([]int, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		spec = "1-"
+	}
+	var pages []int
+	seen := map[int]bool{}
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		lo, hi, isRange := strings.Cut(part, "-")
+		from, err := strconv.Atoi(strings.TrimSpace(lo))
+		if err != nil || from < 1 {
+			return nil, &documentError{fmt.Sprintf("invalid page range %q", part)}
+		}
+		to := from
+		if isRange {
+			if hi = strings.TrimSpace(hi); hi == "" {
+				to = total
+			} else if to, err = strconv.Atoi(hi); err != nil || to < from {
+				return nil, &documentError{fmt.Sprintf("invalid page range %q", part)}
+			}
+		}
+		if from > total {
+			return nil, &documentError{fmt.Sprintf("page %d is out of range, the document has %d page(s)", from, total)}
+		}
+		for n := from; n <= min(to, total); n++ {
+			if !seen[n] {
+				seen[n] = true
+				pages = append(pages, n)
+			}
+		}
+	}
+	return pages, nil
+}
+
+// parseDOCX 提取 word/document.xml 中的文字, 标题和列表转换为 Markdown 的形式, 表格的单元格用制表符分隔。
+// 优先按 Word 排版时保存的 lastRenderedPageBreak 分页, 没有时按手动分页符分页
+func parseDOCX(data []byte) (pages []string, title, author string, err error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, "", "", errors.New("not a valid DOCX file")
+	}
+	read := func(name string) ([]byte, error) {
+		for _, f := range zr.File {
+			if f.Name != name {
+				continue
+			}
+			rc, err := f.Open()
+			if err != nil {
+				return nil, err
+			}
+			defer rc.Close()
+			b, err := io.ReadAll(io.LimitReader(rc, docxMaxXML+1))
+			if err == nil && len(b) > docxMaxXML {
+				err = fmt.Errorf("%s is too large", name)
+			}
+			return b, err
+		}
+		return nil, fmt.Errorf("%s not found, the file is not a Word document", name)
+	}
+	body, err := read("word/document.xml")
+	if err != nil {
+		return nil, "", "", err
+	}
+	if core, err := read("docProps/core.xml"); err == nil {
+		var props struct {
+			Title   string `xml:"title"`
+			Creator string `xml:"creator"`
+		}
+		if xml.Unmarshal(core, &props) == nil {
+			title, author = strings.TrimSpace(props.Title), strings.TrimSpace(props.Creator)
+		}
+	}
+
+	rendered := bytes.Contains(body, []byte("lastRenderedPageBreak"))
+	var cur strings.Builder
+	newPage := func() {
+		pages = append(pages, cur.String())
+		cur.Reset()
+	}
+	attr := func(e xml.StartElement, name string) string {
+		for _, a := range e.Attr {
+			if a.Name.Local == name {
+				return a.Value
+			}
+		}
+		return ""
+	}
+	inText, cells := false, 0
+	dec := xml.NewDecoder(bytes.NewReader(body))
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, "", "", fmt.Errorf("invalid DOCX content: %v", err)
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "t":
+				inText = true
+			case "tab":
+				cur.WriteByte('\t')
+			case "br", "cr":
+				if attr(t, "type") == "page" && !rendered {
+					newPage()
+				} else if attr(t, "type") != "page" {
+					cur.WriteByte('\n')
+				}
+			case "lastRenderedPageBreak":
+				newPage()
+			case "pStyle":
+				// 段落属性在文字之前
+				style := attr(t, "val")
+				if lvl, ok := strings.CutPrefix(style, "Heading"); ok {
+					if n, err := strconv.Atoi(lvl); err == nil && n >= 1 && n <= 6 {
+						cur.WriteString(strings.Repeat("#", n) + " ")
+					}
+				} else if style == "Title" {
+					cur.WriteString("# ")
+				}
+			case "numPr":
+				cur.WriteString("- ")
+			case "tc":
+				cells++
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "t":
+				inText = false
+			case "p":
+				if cells > 0 {
+					cur.WriteByte(' ')
+				} else {
+					cur.WriteByte('\n')
+				}
+			case "tc":
+				cells--
+				cur.WriteByte('\t')
+			case "tr":
+				cur.WriteByte('\n')
+			}
+		case xml.CharData:
+			if inText {
+				cur.Write(t)
+			}
+		}
+	}
+	newPage()
+	// 文档开头的分页标记会产生空的第一页
+	if len(pages) > 1 && strings.TrimSpace(pages[0]) == "" {
+		pages = pages[1:]
+	}
+	for i, p := range pages {
+		lines := strings.Split(p, "\n")
+		for j, l := range lines {
+			lines[j] = strings.TrimRight(strings.ReplaceAll(l, " \t", "\t"), " \t")
+		}
+		p = strings.Join(lines, "\n")
+		for strings.Contains(p, "\n\n\n") {
+			p = strings.ReplaceAll(p, "\n\n\n", "\n\n")
+		}
+		pages[i] = strings.TrimSpace(p)
+	}
+	return pages, title, author, nil
+}
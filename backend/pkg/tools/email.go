@@ -0,0 +1,300 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+const (
+	defaultEmailMaxRecipients = 10
+	defaultEmailMaxBody       = 100 * 1024
+	smtpTimeout               = 30 * time.Second
+)
+
+// emailConfig 从环境变量读取:
+//   - SMTP_HOST / SMTP_PORT: SMTP 服务器, 端口缺省 587
+//   - SMTP_USERNAME / SMTP_PASSWORD: 有用户名时使用 PLAIN 认证
+//   - SMTP_TLS: starttls (缺省) | tls (直接 TLS 连接, 通常是 465 端口) | none (只用于本机的测试服务器)
+//   - SMTP_FROM: 发件人, 比如 "MCP Host <bot@example.com>"; 必填
+//   - EMAIL_ALLOWED_DOMAINS: 允许的收件人域名, 逗号分隔, *.example.com 匹配子域名; 必填
+//   - EMAIL_MAX_RECIPIENTS: 每封邮件最多的收件人数 (收件人和抄送合计), 缺省 10
+//   - EMAIL_MAX_BODY: 正文最多的字节数, 缺省 102400
+type emailConfig struct {
+	host          string
+	port          string
+	username      string
+	password      string
+	tlsMode       string
+	from          *mail.Address
+	domains       []string
+	maxRecipients int
+	maxBody       int
+}
+
+func emailConfigFromEnv() (emailConfig, error) {
+	cfg := emailConfig{
+		host:          os.Getenv("SMTP_HOST"),
+		port:          os.Getenv("SMTP_PORT"),
+		username:      os.Getenv("SMTP_USERNAME"),
+		password:      os.Getenv("SMTP_PASSWORD"),
+		tlsMode:       os.Getenv("SMTP_TLS"),
+		maxRecipients: defaultEmailMaxRecipients,
+		maxBody:       defaultEmailMaxBody,
+	}
+	if cfg.host == "" {
+		return cfg, errors.New("SMTP_HOST is not set")
+	}
+	if cfg.port == "" {
+		cfg.port = "587"
+	}
+	switch cfg.tlsMode {
+	case "":
+		cfg.tlsMode = "starttls"
+	case "starttls", "tls", "none":
+	default:
+		return cfg, fmt.Errorf("SMTP_TLS: unknown mode %q (starttls, tls, none)", cfg.tlsMode)
+	}
+	from, err := mail.ParseAddress(os.Getenv("SMTP_FROM"))
+	if err != nil {
+		return cfg, fmt.Errorf("SMTP_FROM: %v", err)
+	}
+	cfg.from = from
+	for _, d := range strings.Split(os.Getenv("EMAIL_ALLOWED_DOMAINS"), ",") {
+		if d = strings.ToLower(strings.TrimSpace(d)); d != "" {
+			cfg.domains = append(cfg.domains, d)
+		}
+	}
+	if len(cfg.domains) == 0 {
+		return cfg, errors.New("EMAIL_ALLOWED_DOMAINS is not set, no recipients are allowed")
+	}
+	for _, e := range []struct {
+		name string
+		dst  *int
+	}{{"EMAIL_MAX_RECIPIENTS", &cfg.maxRecipients}, {"EMAIL_MAX_BODY", &cfg.maxBody}} {
+		if v := os.Getenv(e.name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 {
+				return cfg, fmt.Errorf("%s: invalid number %q", e.name, v)
+			}
+			*e.dst = n
+		}
+	}
+	return cfg, nil
+}
+
+// allowed 检查收件人地址的域名是否在白名单中
+func (cfg emailConfig) allowed(addr string) bool {
+	at := strings.LastIndexByte(addr, '@')
+	if at < 0 {
+		return false
+	}
+	return matchDomain(cfg.domains, addr[at+1:])
+}
+
+// matchDomain 检查域名是否在白名单中, *.example.com 匹配子域名
+func matchDomain(patterns []string, domain string) bool {
+	domain = strings.ToLower(domain)
+	for _, d := range patterns {
+		if sub, ok := strings.CutPrefix(d, "*."); ok {
+			if strings.HasSuffix(domain, "."+sub) {
+				return true
+			}
+		} else if domain == d {
+			return true
+		}
+	}
+	return false
+}
+
+// NewEmailServer 提供 send_email 工具, 通过 SMTP 发送纯文本邮件, 只能发给白名单域名中的地址。
+// 发送邮件无法撤回, 主机应当为它配置 requireApproval, 由用户确认收件人和内容后再发送; 配置见 emailConfig
+func NewEmailServer() *server.MCPServer {
+	s := server.NewMCPServer(
+		"email-server",
+		"1.0.0",
+		server.WithToolCapabilities(true),
+		server.WithRecovery(),
+	)
+	cfg, cfgErr := emailConfigFromEnv()
+
+	recipients := mcp.Items(map[string]any{"type": "string"})
+	sendTool := mcp.NewTool("send_email",
+		mcp.WithDescription(fmt.Sprintf("Send a plain-text email, e.g. to notify someone or deliver a report. "+
+			"Recipients must be in the allowed domains (%s). The user may be asked to approve the email before it is sent.",
+			strings.Join(cfg.domains, ", "))),
+		mcp.WithArray("to", mcp.Required(), mcp.Description("Recipient addresses"), recipients),
+		mcp.WithArray("cc", mcp.Description("Carbon copy addresses"), recipients),
+		mcp.WithString("subject", mcp.Required(), mcp.Description("Subject line")),
+		mcp.WithString("body", mcp.Required(), mcp.Description("Plain-text body")),
+		mcp.WithDestructiveHintAnnotation(true),
+		mcp.WithIdempotentHintAnnotation(false),
+	)
+	s.AddTool(sendTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		if cfgErr != nil {
+			return nil, cfgErr
+		}
+		to, err := request.RequireStringSlice("to")
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		subject, err := request.RequireString("subject")
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		body, err := request.RequireString("body")
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		msg, err := newEmail(cfg, to, request.GetStringSlice("cc", nil), subject, body)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		if err := sendEmail(ctx, cfg, msg); err != nil {
+			return nil, fmt.Errorf("send email: %v", err)
+		}
+		return mcp.NewToolResultText(fmt.Sprintf("email sent to %s (message id %s)", strings.Join(msg.recipients, ", "), msg.id)), nil
+	})
+	return s
+}
+
+type email struct {
+	id         string
+	recipients []string // 收件人和抄送的地址, 用于 RCPT TO
+	data       []byte
+}
+
+// newEmail 校验收件人和内容并生成邮件, 错误交给大模型修改参数
+func newEmail(cfg emailConfig, to, cc []string, subject, body string) (*email, error) {
+	if strings.ContainsAny(subject, "\r\n") {
+		return nil, errors.New("subject must be a single line")
+	}
+	if len(body) > cfg.maxBody {
+		return nil, fmt.Errorf("body is %d bytes, the limit is %d", len(body), cfg.maxBody)
+	}
+	if len(to)+len(cc) > cfg.maxRecipients {
+		return nil, fmt.Errorf("at most %d recipients are allowed", cfg.maxRecipients)
+	}
+	m := &email{}
+	parse := func(list []string) ([]string, error) {
+		var out []string
+		for _, s := range list {
+			addr, err := mail.ParseAddress(s)
+			if err != nil {
+				return nil, fmt.Errorf("invalid address %q: %v", s, err)
+			}
+			if !cfg.allowed(addr.Address) {
+				return nil, fmt.Errorf("recipient %s is not in the allowed domains (%s)", addr.Address, strings.Join(cfg.domains, ", "))
+			}
+			m.recipients = append(m.recipients, addr.Address)
+			out = append(out, addr.String())
+		}
+		return out, nil
+	}
+	toList, err := parse(to)
+	if err != nil {
+		return nil, err
+	}
+	if len(toList) == 0 {
+		return nil, errors.New("at least one recipient is required")
+	}
+	ccList, err := parse(cc)
+	if err != nil {
+		return nil, err
+	}
+
+	idBytes := make([]byte, 12)
+	rand.Read(idBytes)
+	domain := cfg.from.Address[strings.LastIndexByte(cfg.from.Address, '@')+1:]
+	m.id = "<" + hex.EncodeToString(idBytes) + "@" + domain + ">"
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", cfg.from.String())
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(toList, ", "))
+	if len(ccList) > 0 {
+		fmt.Fprintf(&b, "Cc: %s\r\n", strings.Join(ccList, ", "))
+	}
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&b, "Message-ID: %s\r\n", m.id)
+	b.WriteString("MIME-Version: 1.0\r\nContent-Type: text/plain; charset=utf-8\r\nContent-Transfer-Encoding: quoted-printable\r\n\r\n")
+	qp := quotedprintable.NewWriter(&b)
+	qp.Write([]byte(strings.ReplaceAll(strings.ReplaceAll(body, "\r\n", "\n"), "\n", "\r\n")))
+	qp.Close()
+	m.data = b.Bytes()
+	return m, nil
+}
+
+// sendEmail 连接 SMTP 服务器发送邮件
+func sendEmail(ctx context.Context, cfg emailConfig, m *email) error {
+	addr := net.JoinHostPort(cfg.host, cfg.port)
+	dialer := &net.Dialer{Timeout: smtpTimeout}
+	var conn net.Conn
+	var err error
+	if cfg.tlsMode == "tls" {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: &tls.Config{ServerName: cfg.host}}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return err
+	}
+	deadline := time.Now().Add(smtpTimeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetDeadline(deadline)
+
+	c, err := smtp.NewClient(conn, cfg.host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+	if cfg.tlsMode == "starttls" {
+		if err := c.StartTLS(&tls.Config{ServerName: cfg.host}); err != nil {
+			return err
+		}
+	}
+	if cfg.username != "" {
+		// smtp.PlainAuth 只在 TLS 连接或 localhost 上发送密码
+		if err := c.Auth(smtp.PlainAuth("", cfg.username, cfg.password, cfg.host)); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(cfg.from.Address); err != nil {
+		return err
+	}
+	for _, rcpt := range m.recipients {
+		if err := c.Rcpt(rcpt); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(m.data); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
@@ -0,0 +1,506 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+const (
+	defaultFinanceTimeout   = 15 * time.Second
+	defaultFinanceRatesTTL  = time.Hour
+	defaultFinanceQuotesTTL = time.Minute
+)
+
+// 各数据源的地址, 是变量以便指向兼容的代理
+var (
+	frankfurterURL  = "https://api.frankfurter.app"
+	alphaVantageURL = "https://www.alphavantage.co/query"
+	finnhubURL      = "https://finnhub.io/api/v1"
+)
+
+// financeConfig 从环境变量读取:
+//   - FINANCE_RATES_PROVIDER: 汇率数据源, frankfurter (缺省, 欧洲央行每日参考汇率, 不需要 API key) | alphavantage
+//   - FINANCE_QUOTES_PROVIDER: 股票行情数据源, alphavantage | finnhub; 缺省按设置了哪个 API key 选择, 都没有时不提供 stock_quote
+//   - ALPHAVANTAGE_API_KEY / FINNHUB_API_KEY: 数据源的 API key
+//   - FINANCE_RATES_TTL: 汇率的缓存时间, 缺省 1h
+//   - FINANCE_QUOTES_TTL: 行情的缓存时间, 缺省 1m
+//   - FINANCE_TIMEOUT: 每次请求的超时, 缺省 15s
+type financeConfig struct {
+	ratesProvider  string
+	quotesProvider string
+	alphaVantage   string
+	finnhub        string
+	ratesTTL       time.Duration
+	quotesTTL      time.Duration
+	timeout        time.Duration
+}
+
+func financeConfigFromEnv() (financeConfig, error) {
+	cfg := financeConfig{
+		ratesProvider:  os.Getenv("FINANCE_RATES_PROVIDER"),
+		quotesProvider: os.Getenv("FINANCE_QUOTES_PROVIDER"),
+		alphaVantage:   os.Getenv("ALPHAVANTAGE_API_KEY"),
+		finnhub:        os.Getenv("FINNHUB_API_KEY"),
+		ratesTTL:       defaultFinanceRatesTTL,
+		quotesTTL:      defaultFinanceQuotesTTL,
+		timeout:        defaultFinanceTimeout,
+	}
+	if cfg.ratesProvider == "" {
+		cfg.ratesProvider = "frankfurter"
+	}
+	if cfg.quotesProvider == "" {
+		switch {
+		case cfg.finnhub != "":
+			cfg.quotesProvider = "finnhub"
+		case cfg.alphaVantage != "":
+			cfg.quotesProvider = "alphavantage"
+		}
+	}
+	for _, e := range []struct {
+		name string
+		dst  *time.Duration
+	}{{"FINANCE_RATES_TTL", &cfg.ratesTTL}, {"FINANCE_QUOTES_TTL", &cfg.quotesTTL}, {"FINANCE_TIMEOUT", &cfg.timeout}} {
+		if v := os.Getenv(e.name); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil || d < 0 {
+				return cfg, fmt.Errorf("%s: invalid duration %q", e.name, v)
+			}
+			*e.dst = d
+		}
+	}
+	return cfg, nil
+}
+
+// rateProvider 查询汇率, 返回 1 单位 base 可以兑换的各币种数量
+type rateProvider interface {
+	rates(ctx context.Context, base string, symbols []string) (rateTable, error)
+}
+
+type rateTable struct {
+	base  string
+	date  string // 数据源给出的日期或时间
+	rates map[string]float64
+}
+
+// quoteProvider 查询股票的最新行情
+type quoteProvider interface {
+	quote(ctx context.Context, symbol string) (stockQuote, error)
+}
+
+type stockQuote struct {
+	symbol    string
+	price     float64
+	change    float64
+	changePct float64
+	open      float64
+	high      float64
+	low       float64
+	prevClose float64
+	volume    int64 // 0 表示数据源没有提供
+	asOf      string
+}
+
+// 可选的数据源, key 是 FINANCE_RATES_PROVIDER 和 FINANCE_QUOTES_PROVIDER 的值
+var (
+	rateProviders = map[string]func(cfg financeConfig, c *http.Client) (rateProvider, error){
+		"frankfurter":  func(_ financeConfig, c *http.Client) (rateProvider, error) { return frankfurter{c}, nil },
+		"alphavantage": func(cfg financeConfig, c *http.Client) (rateProvider, error) { return newAlphaVantage(cfg, c) },
+	}
+	quoteProviders = map[string]func(cfg financeConfig, c *http.Client) (quoteProvider, error){
+		"alphavantage": func(cfg financeConfig, c *http.Client) (quoteProvider, error) { return newAlphaVantage(cfg, c) },
+		"finnhub": func(cfg financeConfig, c *http.Client) (quoteProvider, error) {
+			if cfg.finnhub == "" {
+				return nil, errors.New("FINNHUB_API_KEY is not set")
+			}
+			return finnhub{c, cfg.finnhub}, nil
+		},
+	}
+)
+
+// NewFinanceServer 提供汇率换算 (exchange_rate) 和股票行情 (stock_quote) 工具, 数据源可以替换,
+// 结果按 FINANCE_RATES_TTL 和 FINANCE_QUOTES_TTL 缓存, 免费数据源的调用次数通常很少; 配置见 financeConfig
+func NewFinanceServer() *server.MCPServer {
+	s := server.NewMCPServer(
+		"finance-server",
+		"1.0.0",
+		server.WithToolCapabilities(true),
+		server.WithRecovery(),
+	)
+	cfg, cfgErr := financeConfigFromEnv()
+	client := &http.Client{Timeout: cfg.timeout}
+	f := &financeClient{
+		rateCache:  newTTLCache[rateTable](cfg.ratesTTL),
+		quoteCache: newTTLCache[stockQuote](cfg.quotesTTL),
+	}
+	if cfgErr == nil {
+		newRates, ok := rateProviders[cfg.ratesProvider]
+		if !ok {
+			cfgErr = fmt.Errorf("FINANCE_RATES_PROVIDER: unknown provider %q", cfg.ratesProvider)
+		} else {
+			f.rateSource, cfgErr = newRates(cfg, client)
+		}
+	}
+	if cfgErr == nil && cfg.quotesProvider != "" {
+		newQuotes, ok := quoteProviders[cfg.quotesProvider]
+		if !ok {
+			cfgErr = fmt.Errorf("FINANCE_QUOTES_PROVIDER: unknown provider %q", cfg.quotesProvider)
+		} else {
+			f.quoteSource, cfgErr = newQuotes(cfg, client)
+		}
+	}
+
+	s.AddTool(mcp.NewTool("exchange_rate",
+		mcp.WithDescription("Get currency exchange rates and convert amounts between currencies"),
+		mcp.WithString("from", mcp.Required(), mcp.Description("ISO 4217 code of the source currency, e.g. USD")),
+		mcp.WithString("to", mcp.Required(), mcp.Description("Target currency codes, comma-separated, e.g. CNY,EUR")),
+		mcp.WithNumber("amount", mcp.Description("Amount in the source currency to convert, default 1")),
+		mcp.WithReadOnlyHintAnnotation(true),
+	), f.wrap(cfgErr, f.exchangeRate))
+	if cfg.quotesProvider != "" {
+		s.AddTool(mcp.NewTool("stock_quote",
+			mcp.WithDescription("Get the latest quote of a stock: price, change, open, high, low and volume"),
+			mcp.WithString("symbol", mcp.Required(), mcp.Description("Ticker symbol as used by "+cfg.quotesProvider+", e.g. AAPL")),
+			mcp.WithReadOnlyHintAnnotation(true),
+		), f.wrap(cfgErr, f.stockQuote))
+	}
+	return s
+}
+
+type financeClient struct {
+	rateSource  rateProvider
+	quoteSource quoteProvider
+	rateCache   *ttlCache[rateTable]
+	quoteCache  *ttlCache[stockQuote]
+}
+
+// financeError 是参数错误或数据源的拒绝 (代码不存在、超过调用次数), 作为工具结果返回给大模型
+type financeError struct{ msg string }
+
+func (e *financeError) Error() string { return e.msg }
+
+func (f *financeClient) wrap(cfgErr error, h func(ctx context.Context, req mcp.CallToolRequest) (string, error)) server.ToolHandlerFunc {
+	return func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		if cfgErr != nil {
+			return nil, cfgErr
+		}
+		out, err := h(ctx, req)
+		var ferr *financeError
+		if errors.As(err, &ferr) {
+			return mcp.NewToolResultError(ferr.msg), nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		return mcp.NewToolResultText(out), nil
+	}
+}
+
+var (
+	currencyPattern = regexp.MustCompile(`^[A-Z]{3}$`)
+	symbolPattern   = regexp.MustCompile(`^[A-Z0-9.^=:-]{1,20}$`)
+)
+
+func (f *financeClient) exchangeRate(ctx context.Context, req mcp.CallToolRequest) (string, error) {
+	from, err := req.RequireString("from")
+	if err != nil {
+		return "", &financeError{err.Error()}
+	}
+	to, err := req.RequireString("to")
+	if err != nil {
+		return "", &financeError{err.Error()}
+	}
+	amount := req.GetFloat("amount", 1)
+	from = strings.ToUpper(strings.TrimSpace(from))
+	var symbols []string
+	for _, s := range strings.Split(to, ",") {
+		if s = strings.ToUpper(strings.TrimSpace(s)); s != "" && s != from && !slices.Contains(symbols, s) {
+			symbols = append(symbols, s)
+		}
+	}
+	for _, c := range append([]string{from}, symbols...) {
+		if !currencyPattern.MatchString(c) {
+			return "", &financeError{fmt.Sprintf("invalid currency code %q, use ISO 4217 codes such as USD", c)}
+		}
+	}
+	if len(symbols) == 0 {
+		return "", &financeError{"no target currency other than " + from}
+	}
+
+	slices.Sort(symbols)
+	key := from + ":" + strings.Join(symbols, ",")
+	table, ok := f.rateCache.get(key)
+	if !ok {
+		if table, err = f.rateSource.rates(ctx, from, symbols); err != nil {
+			return "", err
+		}
+		f.rateCache.set(key, table)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Rates as of %s:\n", table.date)
+	for _, s := range symbols {
+		rate, ok := table.rates[s]
+		if !ok {
+			fmt.Fprintf(&b, "%s: not available\n", s)
+			continue
+		}
+		if amount == 1 {
+			fmt.Fprintf(&b, "1 %s = %s %s\n", from, formatFinanceNumber(rate), s)
+		} else {
+			fmt.Fprintf(&b, "%s %s = %s %s (rate %s)\n", formatFinanceNumber(amount), from, formatFinanceNumber(amount*rate), s, formatFinanceNumber(rate))
+		}
+	}
+	return b.String(), nil
+}
+
+func (f *financeClient) stockQuote(ctx context.Context, req mcp.CallToolRequest) (string, error) {
+	symbol, err := req.RequireString("symbol")
+	if err != nil {
+		return "", &financeError{err.Error()}
+	}
+	symbol = strings.ToUpper(strings.TrimSpace(symbol))
+	if !symbolPattern.MatchString(symbol) {
+		return "", &financeError{fmt.Sprintf("invalid symbol %q", symbol)}
+	}
+	q, ok := f.quoteCache.get(symbol)
+	if !ok {
+		if q, err = f.quoteSource.quote(ctx, symbol); err != nil {
+			return "", err
+		}
+		f.quoteCache.set(symbol, q)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s: %s", q.symbol, formatFinanceNumber(q.price))
+	fmt.Fprintf(&b, " (%+.2f, %+.2f%%)\n", q.change, q.changePct)
+	fmt.Fprintf(&b, "Open %s, high %s, low %s, previous close %s\n",
+		formatFinanceNumber(q.open), formatFinanceNumber(q.high), formatFinanceNumber(q.low), formatFinanceNumber(q.prevClose))
+	if q.volume > 0 {
+		fmt.Fprintf(&b, "Volume %d\n", q.volume)
+	}
+	fmt.Fprintf(&b, "As of %s\n", q.asOf)
+	return b.String(), nil
+}
+
+func formatFinanceNumber(v float64) string {
+	if v >= 100 || v <= -100 {
+		return strconv.FormatFloat(v, 'f', 2, 64)
+	}
+	return strconv.FormatFloat(v, 'g', 6, 64)
+}
+
+// ttlCache 是带过期时间的缓存, 过期的项在下次写入时清理
+type ttlCache[V any] struct {
+	mu  sync.Mutex
+	ttl time.Duration
+	m   map[string]ttlEntry[V]
+}
+
+type ttlEntry[V any] struct {
+	value   V
+	expires time.Time
+}
+
+func newTTLCache[V any](ttl time.Duration) *ttlCache[V] {
+	return &ttlCache[V]{ttl: ttl, m: map[string]ttlEntry[V]{}}
+}
+
+func (c *ttlCache[V]) get(key string) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.m[key]
+	if !ok || time.Now().After(e.expires) {
+		var zero V
+		return zero, false
+	}
+	return e.value, true
+}
+
+func (c *ttlCache[V]) set(key string, v V) {
+	if c.ttl <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	for k, e := range c.m {
+		if now.After(e.expires) {
+			delete(c.m, k)
+		}
+	}
+	c.m[key] = ttlEntry[V]{v, now.Add(c.ttl)}
+}
+
+// getFinanceJSON 请求数据源并解析 JSON, 404 视为代码不存在
+func getFinanceJSON(ctx context.Context, c *http.Client, u string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.Do(req)
+	if err != nil {
+		// 错误信息中的 URL 可能带有 API key
+		var uerr *url.Error
+		if errors.As(err, &uerr) {
+			err = uerr.Err
+		}
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusUnprocessableEntity:
+		return &financeError{fmt.Sprintf("not found: %s", strings.TrimSpace(string(body)))}
+	case resp.StatusCode == http.StatusTooManyRequests:
+		return &financeError{"the data provider's rate limit is exceeded, try again later"}
+	case resp.StatusCode != http.StatusOK:
+		return fmt.Errorf("finance: %s", resp.Status)
+	}
+	return json.Unmarshal(body, v)
+}
+
+// frankfurter 使用 frankfurter.app, 欧洲央行每个工作日更新的参考汇率, 约 30 种货币
+type frankfurter struct{ http *http.Client }
+
+func (p frankfurter) rates(ctx context.Context, base string, symbols []string) (rateTable, error) {
+	var resp struct {
+		Base  string             `json:"base"`
+		Date  string             `json:"date"`
+		Rates map[string]float64 `json:"rates"`
+	}
+	q := url.Values{"from": {base}, "to": {strings.Join(symbols, ",")}}
+	if err := getFinanceJSON(ctx, p.http, frankfurterURL+"/latest?"+q.Encode(), &resp); err != nil {
+		var ferr *financeError
+		if errors.As(err, &ferr) {
+			return rateTable{}, &financeError{"unknown currency, ECB reference rates cover about 30 major currencies"}
+		}
+		return rateTable{}, err
+	}
+	return rateTable{base: resp.Base, date: resp.Date + " (ECB reference rate)", rates: resp.Rates}, nil
+}
+
+// alphaVantage 使用 alphavantage.co, 同时提供汇率和行情, 免费 key 每天只能调用很少的次数
+type alphaVantage struct {
+	http *http.Client
+	key  string
+}
+
+func newAlphaVantage(cfg financeConfig, c *http.Client) (alphaVantage, error) {
+	if cfg.alphaVantage == "" {
+		return alphaVantage{}, errors.New("ALPHAVANTAGE_API_KEY is not set")
+	}
+	return alphaVantage{c, cfg.alphaVantage}, nil
+}
+
+// query 调用接口; 出错时 Alpha Vantage 仍然返回 200, 错误在 Error Message、Note 或 Information 字段中
+func (p alphaVantage) query(ctx context.Context, q url.Values, field string) (map[string]string, error) {
+	q.Set("apikey", p.key)
+	var resp map[string]json.RawMessage
+	if err := getFinanceJSON(ctx, p.http, alphaVantageURL+"?"+q.Encode(), &resp); err != nil {
+		return nil, err
+	}
+	if msg, ok := resp["Error Message"]; ok {
+		return nil, &financeError{"alphavantage: " + strings.Trim(string(msg), `"`)}
+	}
+	for _, k := range []string{"Note", "Information"} {
+		if _, ok := resp[k]; ok {
+			return nil, &financeError{"the data provider's rate limit is exceeded, try again later"}
+		}
+	}
+	var data map[string]string
+	if raw, ok := resp[field]; ok {
+		if err := json.Unmarshal(raw, &data); err != nil {
+			return nil, fmt.Errorf("alphavantage: %v", err)
+		}
+	}
+	return data, nil
+}
+
+func (p alphaVantage) rates(ctx context.Context, base string, symbols []string) (rateTable, error) {
+	// 每次只能查一对货币
+	t := rateTable{base: base, rates: map[string]float64{}}
+	for _, s := range symbols {
+		data, err := p.query(ctx, url.Values{"function": {"CURRENCY_EXCHANGE_RATE"}, "from_currency": {base}, "to_currency": {s}},
+			"Realtime Currency Exchange Rate")
+		if err != nil {
+			return t, err
+		}
+		rate, err := strconv.ParseFloat(data["5. Exchange Rate"], 64)
+		if err != nil {
+			return t, &financeError{fmt.Sprintf("no rate for %s/%s", base, s)}
+		}
+		t.rates[s] = rate
+		t.date = strings.TrimSpace(data["6. Last Refreshed"] + " " + data["7. Time Zone"])
+	}
+	return t, nil
+}
+
+func (p alphaVantage) quote(ctx context.Context, symbol string) (stockQuote, error) {
+	data, err := p.query(ctx, url.Values{"function": {"GLOBAL_QUOTE"}, "symbol": {symbol}}, "Global Quote")
+	if err != nil {
+		return stockQuote{}, err
+	}
+	if data["05. price"] == "" {
+		return stockQuote{}, &financeError{fmt.Sprintf("no quote for %s, check the symbol (e.g. use the exchange suffix such as 600519.SHH)", symbol)}
+	}
+	num := func(k string) float64 {
+		v, _ := strconv.ParseFloat(strings.TrimSuffix(data[k], "%"), 64)
+		return v
+	}
+	volume, _ := strconv.ParseInt(data["06. volume"], 10, 64)
+	return stockQuote{
+		symbol: data["01. symbol"], price: num("05. price"), change: num("09. change"), changePct: num("10. change percent"),
+		open: num("02. open"), high: num("03. high"), low: num("04. low"), prevClose: num("08. previous close"),
+		volume: volume, asOf: data["07. latest trading day"],
+	}, nil
+}
+
+// finnhub 使用 finnhub.io 的实时行情
+type finnhub struct {
+	http *http.Client
+	key  string
+}
+
+func (p finnhub) quote(ctx context.Context, symbol string) (stockQuote, error) {
+	var resp struct {
+		C  float64 `json:"c"`
+		D  float64 `json:"d"`
+		DP float64 `json:"dp"`
+		H  float64 `json:"h"`
+		L  float64 `json:"l"`
+		O  float64 `json:"o"`
+		PC float64 `json:"pc"`
+		T  int64   `json:"t"`
+	}
+	q := url.Values{"symbol": {symbol}, "token": {p.key}}
+	if err := getFinanceJSON(ctx, p.http, finnhubURL+"/quote?"+q.Encode(), &resp); err != nil {
+		return stockQuote{}, err
+	}
+	// 不存在的代码返回全 0
+	if resp.T == 0 && resp.C == 0 {
+		return stockQuote{}, &financeError{fmt.Sprintf("no quote for %s, check the symbol", symbol)}
+	}
+	return stockQuote{
+		symbol: symbol, price: resp.C, change: resp.D, changePct: resp.DP,
+		open: resp.O, high: resp.H, low: resp.L, prevClose: resp.PC,
+		asOf: time.Unix(resp.T, 0).UTC().Format("2006-01-02 15:04 UTC"),
+	}, nil
+}
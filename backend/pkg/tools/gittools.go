@@ -0,0 +1,439 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+const (
+	defaultGitDepth     = 50
+	defaultGitTimeout   = time.Minute
+	defaultGitMaxOutput = 64 * 1024
+	maxGitResults       = 500 // log 和 grep 最多返回的行数
+)
+
+var gitRepoNamePattern = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+// gitConfig 从环境变量读取:
+//   - GIT_REPOS: 允许访问的仓库, 逗号分隔, 每项为 名称=URL, 省略名称时使用 URL 的最后一段 (去掉 .git)
+//   - GIT_WORKDIR: 克隆仓库的目录, 缺省为系统临时目录下的 mcp-git-tools
+//   - GIT_CLONE_DEPTH: 浅克隆的提交数, 缺省 50
+//   - GIT_TIMEOUT: 每个 git 命令的超时, 缺省 1m
+//   - GIT_MAX_OUTPUT: 最多返回的字节数, 缺省 65536
+type gitConfig struct {
+	repos     map[string]string // 名称 -> URL
+	names     []string          // 按配置顺序
+	workdir   string
+	depth     int
+	timeout   time.Duration
+	maxOutput int
+}
+
+func gitConfigFromEnv() (gitConfig, error) {
+	cfg := gitConfig{
+		repos:     map[string]string{},
+		workdir:   filepath.Join(os.TempDir(), "mcp-git-tools"),
+		depth:     defaultGitDepth,
+		timeout:   defaultGitTimeout,
+		maxOutput: defaultGitMaxOutput,
+	}
+	for _, item := range strings.Split(os.Getenv("GIT_REPOS"), ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		name, url, ok := strings.Cut(item, "=")
+		if !ok {
+			url = name
+			name = strings.TrimSuffix(filepath.Base(strings.TrimRight(url, "/")), ".git")
+		}
+		name, url = strings.TrimSpace(name), strings.TrimSpace(url)
+		if !gitRepoNamePattern.MatchString(name) || url == "" {
+			return cfg, fmt.Errorf("GIT_REPOS: invalid repository %q", item)
+		}
+		if _, dup := cfg.repos[name]; dup {
+			return cfg, fmt.Errorf("GIT_REPOS: duplicate repository name %q", name)
+		}
+		cfg.repos[name] = url
+		cfg.names = append(cfg.names, name)
+	}
+	if len(cfg.repos) == 0 {
+		return cfg, errors.New("GIT_REPOS is not set, no repositories are allowed")
+	}
+	if v := os.Getenv("GIT_WORKDIR"); v != "" {
+		cfg.workdir = v
+	}
+	if v := os.Getenv("GIT_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return cfg, fmt.Errorf("GIT_TIMEOUT: invalid duration %q", v)
+		}
+		cfg.timeout = d
+	}
+	for _, e := range []struct {
+		name string
+		dst  *int
+	}{{"GIT_CLONE_DEPTH", &cfg.depth}, {"GIT_MAX_OUTPUT", &cfg.maxOutput}} {
+		if v := os.Getenv(e.name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 {
+				return cfg, fmt.Errorf("%s: invalid number %q", e.name, v)
+			}
+			*e.dst = n
+		}
+	}
+	return cfg, nil
+}
+
+// gitTools 在 workdir 下按仓库名克隆白名单中的仓库, 其他工具第一次用到仓库时自动克隆。
+// 同一个仓库上的命令串行执行, 避免克隆或更新时读到不完整的状态
+type gitTools struct {
+	cfg gitConfig
+
+	mu    sync.Mutex
+	locks map[string]*sync.Mutex
+}
+
+// NewGitServer 提供只读访问白名单中 git 仓库的工具: 浅克隆 (git_clone)、提交历史 (git_log)、
+// 差异 (git_diff)、逐行追溯 (git_blame) 和搜索代码 (git_grep), 配置见 gitConfig
+func NewGitServer() *server.MCPServer {
+	s := server.NewMCPServer(
+		"git-tools-server",
+		"1.0.0",
+		server.WithToolCapabilities(true),
+		server.WithRecovery(),
+	)
+	cfg, cfgErr := gitConfigFromEnv()
+	g := &gitTools{cfg: cfg, locks: map[string]*sync.Mutex{}}
+	repoArg := mcp.WithString("repo",
+		mcp.Required(),
+		mcp.Description("Repository name"),
+		mcp.Enum(cfg.names...),
+	)
+	refArg := mcp.WithString("ref",
+		mcp.Description("Branch, tag or commit; defaults to HEAD"),
+	)
+
+	s.AddTool(mcp.NewTool("git_list_repos",
+		mcp.WithDescription("List the git repositories that can be queried and whether they are cloned"),
+	), g.wrap(cfgErr, g.listRepos))
+	s.AddTool(mcp.NewTool("git_clone",
+		mcp.WithDescription(fmt.Sprintf("Shallow clone a repository (last %d commits), or update it if already cloned. "+
+			"Other git tools clone the default branch automatically; call this to switch to another branch or tag, or to fetch new commits.", cfg.depth)),
+		repoArg,
+		mcp.WithString("ref", mcp.Description("Branch or tag to check out; defaults to the remote's default branch")),
+	), g.wrap(cfgErr, g.clone))
+	s.AddTool(mcp.NewTool("git_log",
+		mcp.WithDescription("Show the commit history of a repository, optionally limited to a path"),
+		repoArg, refArg,
+		mcp.WithString("path", mcp.Description("Only commits touching this file or directory")),
+		mcp.WithString("author", mcp.Description("Only commits by authors matching this pattern")),
+		mcp.WithString("grep", mcp.Description("Only commits whose message matches this pattern")),
+		mcp.WithString("since", mcp.Description("Only commits after this date, e.g. 2024-01-01 or \"2 weeks ago\"")),
+		mcp.WithNumber("max_count", mcp.Description("Maximum number of commits, default 20")),
+	), g.wrap(cfgErr, g.log))
+	s.AddTool(mcp.NewTool("git_diff",
+		mcp.WithDescription("Show the changes between two commits"),
+		repoArg,
+		mcp.WithString("from", mcp.Description("Base commit, default HEAD~1")),
+		mcp.WithString("to", mcp.Description("Target commit, default HEAD")),
+		mcp.WithString("path", mcp.Description("Only changes to this file or directory")),
+		mcp.WithBoolean("stat", mcp.Description("Only show changed files and line counts")),
+	), g.wrap(cfgErr, g.diff))
+	s.AddTool(mcp.NewTool("git_blame",
+		mcp.WithDescription("Show which commit and author last changed each line of a file"),
+		repoArg, refArg,
+		mcp.WithString("path", mcp.Required(), mcp.Description("File path relative to the repository root")),
+		mcp.WithNumber("start_line", mcp.Description("First line, default 1")),
+		mcp.WithNumber("end_line", mcp.Description("Last line, default end of file")),
+	), g.wrap(cfgErr, g.blame))
+	s.AddTool(mcp.NewTool("git_grep",
+		mcp.WithDescription("Search the files of a repository for a regular expression, returning file:line:text matches"),
+		repoArg, refArg,
+		mcp.WithString("pattern", mcp.Required(), mcp.Description("Extended regular expression")),
+		mcp.WithString("path", mcp.Description("Only search this file or directory, or a glob such as *.go")),
+		mcp.WithBoolean("ignore_case", mcp.Description("Case-insensitive search")),
+		mcp.WithNumber("max_results", mcp.Description("Maximum number of matching lines, default 100")),
+	), g.wrap(cfgErr, g.grep))
+	return s
+}
+
+// gitError 是 git 命令失败的输出, 作为工具结果返回给大模型
+type gitError struct{ msg string }
+
+func (e *gitError) Error() string { return e.msg }
+
+// wrap 检查配置并把 gitError 和参数错误转换为工具结果
+func (g *gitTools) wrap(cfgErr error, h func(ctx context.Context, req mcp.CallToolRequest) (string, error)) server.ToolHandlerFunc {
+	return func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		if cfgErr != nil {
+			return nil, cfgErr
+		}
+		out, err := h(ctx, req)
+		var gerr *gitError
+		if errors.As(err, &gerr) {
+			return mcp.NewToolResultError(gerr.msg), nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		return mcp.NewToolResultText(out), nil
+	}
+}
+
+// repo 校验仓库名, 返回克隆目录并锁定仓库, 调用方负责 unlock
+func (g *gitTools) repo(req mcp.CallToolRequest) (dir string, unlock func(), err error) {
+	name, err := req.RequireString("repo")
+	if err != nil {
+		return "", nil, &gitError{err.Error()}
+	}
+	if _, ok := g.cfg.repos[name]; !ok {
+		return "", nil, &gitError{fmt.Sprintf("repository %q is not allowed (available: %s)", name, strings.Join(g.cfg.names, ", "))}
+	}
+	g.mu.Lock()
+	l, ok := g.locks[name]
+	if !ok {
+		l = &sync.Mutex{}
+		g.locks[name] = l
+	}
+	g.mu.Unlock()
+	l.Lock()
+	return filepath.Join(g.cfg.workdir, name), l.Unlock, nil
+}
+
+// run 执行 git 命令, 失败时返回带 stderr 的 gitError
+func (g *gitTools) run(ctx context.Context, dir string, args ...string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, g.cfg.timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	// 不弹出凭据提示, 需要认证的仓库应在 URL 或 git 的凭据配置中提供
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0", "GIT_ASKPASS=", "LC_ALL=C")
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return nil, &gitError{fmt.Sprintf("git %s: timed out after %s", args[0], g.cfg.timeout)}
+		}
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			return nil, err
+		}
+		return stdout.Bytes(), &gitError{fmt.Sprintf("git %s: %s", args[0], strings.TrimSpace(stderr.String()))}
+	}
+	return stdout.Bytes(), nil
+}
+
+// ensureCloned 仓库未克隆时浅克隆缺省分支, 调用方已锁定仓库
+func (g *gitTools) ensureCloned(ctx context.Context, req mcp.CallToolRequest, dir string) error {
+	if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+		return nil
+	}
+	return g.cloneRepo(ctx, req.GetString("repo", ""), dir, "")
+}
+
+func (g *gitTools) cloneRepo(ctx context.Context, name, dir, ref string) error {
+	if err := os.MkdirAll(g.cfg.workdir, 0o755); err != nil {
+		return err
+	}
+	// 克隆到临时目录后再改名, 失败时不留下不完整的仓库
+	tmp, err := os.MkdirTemp(g.cfg.workdir, "."+name+"-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+	args := []string{"clone", "--depth", strconv.Itoa(g.cfg.depth), "--no-tags", "--quiet"}
+	if ref != "" {
+		args = append(args, "--branch", ref)
+	}
+	if _, err := g.run(ctx, g.cfg.workdir, append(args, "--", g.cfg.repos[name], tmp)...); err != nil {
+		return err
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+	return os.Rename(tmp, dir)
+}
+
+func (g *gitTools) listRepos(ctx context.Context, req mcp.CallToolRequest) (string, error) {
+	var b strings.Builder
+	for _, name := range g.cfg.names {
+		dir := filepath.Join(g.cfg.workdir, name)
+		head, err := g.run(ctx, dir, "log", "-1", "--format=%h %ad %s", "--date=short")
+		if err != nil {
+			fmt.Fprintf(&b, "%s: not cloned\n", name)
+			continue
+		}
+		fmt.Fprintf(&b, "%s: cloned, HEAD %s", name, head)
+	}
+	return b.String(), nil
+}
+
+func (g *gitTools) clone(ctx context.Context, req mcp.CallToolRequest) (string, error) {
+	dir, unlock, err := g.repo(req)
+	if err != nil {
+		return "", err
+	}
+	defer unlock()
+	ref := req.GetString("ref", "")
+	if err := checkGitArg("ref", ref); err != nil {
+		return "", err
+	}
+	// 已克隆时重新克隆: 浅克隆的仓库只有一个分支, 切换分支和获取新提交最简单可靠的办法就是重新克隆
+	if err := g.cloneRepo(ctx, req.GetString("repo", ""), dir, ref); err != nil {
+		return "", err
+	}
+	out, err := g.run(ctx, dir, "log", "-1", "--format=%H %ad %an: %s", "--date=short")
+	if err != nil {
+		return "", err
+	}
+	return "cloned, HEAD " + string(out), nil
+}
+
+func (g *gitTools) log(ctx context.Context, req mcp.CallToolRequest) (string, error) {
+	args := []string{"log", "--date=short", "--format=%h %ad %an: %s",
+		"--max-count=" + strconv.Itoa(min(max(req.GetInt("max_count", 20), 1), maxGitResults))}
+	for _, f := range []string{"author", "grep", "since"} {
+		if v := req.GetString(f, ""); v != "" {
+			args = append(args, "--"+f+"="+v)
+		}
+	}
+	ref := req.GetString("ref", "")
+	if err := checkGitArg("ref", ref); err != nil {
+		return "", err
+	}
+	if ref != "" {
+		args = append(args, ref)
+	}
+	return g.query(ctx, req, append(args, pathspec(req.GetString("path", ""))...), "no commits")
+}
+
+func (g *gitTools) diff(ctx context.Context, req mcp.CallToolRequest) (string, error) {
+	from, to := req.GetString("from", "HEAD~1"), req.GetString("to", "HEAD")
+	if err := checkGitArg("from", from); err != nil {
+		return "", err
+	}
+	if err := checkGitArg("to", to); err != nil {
+		return "", err
+	}
+	args := []string{"diff", "--no-color", "--no-ext-diff"}
+	if req.GetBool("stat", false) {
+		args = append(args, "--stat")
+	}
+	args = append(args, from, to)
+	return g.query(ctx, req, append(args, pathspec(req.GetString("path", ""))...), "no changes")
+}
+
+func (g *gitTools) blame(ctx context.Context, req mcp.CallToolRequest) (string, error) {
+	path, err := req.RequireString("path")
+	if err != nil {
+		return "", &gitError{err.Error()}
+	}
+	ref := req.GetString("ref", "")
+	if err := checkGitArg("ref", ref); err != nil {
+		return "", err
+	}
+	args := []string{"blame", "--date=short"}
+	start, end := req.GetInt("start_line", 0), req.GetInt("end_line", 0)
+	if start > 0 || end > 0 {
+		r := strconv.Itoa(max(start, 1)) + ","
+		if end > 0 {
+			r += strconv.Itoa(end)
+		}
+		args = append(args, "-L", r)
+	}
+	if ref != "" {
+		args = append(args, ref)
+	}
+	return g.query(ctx, req, append(args, "--", path), "empty file")
+}
+
+func (g *gitTools) grep(ctx context.Context, req mcp.CallToolRequest) (string, error) {
+	pattern, err := req.RequireString("pattern")
+	if err != nil {
+		return "", &gitError{err.Error()}
+	}
+	ref := req.GetString("ref", "")
+	if err := checkGitArg("ref", ref); err != nil {
+		return "", err
+	}
+	args := []string{"grep", "--line-number", "-I", "--extended-regexp", "--no-color"}
+	if req.GetBool("ignore_case", false) {
+		args = append(args, "--ignore-case")
+	}
+	args = append(args, "-e", pattern)
+	if ref != "" {
+		args = append(args, ref)
+	}
+	dir, unlock, err := g.repo(req)
+	if err != nil {
+		return "", err
+	}
+	defer unlock()
+	if err := g.ensureCloned(ctx, req, dir); err != nil {
+		return "", err
+	}
+	out, err := g.run(ctx, dir, append(args, pathspec(req.GetString("path", ""))...)...)
+	var gerr *gitError
+	// 没有匹配时 git grep 以状态 1 退出, 没有输出
+	if errors.As(err, &gerr) && len(out) == 0 && !strings.Contains(gerr.msg, "fatal") {
+		return "no matches", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	lines := strings.SplitAfter(strings.TrimSuffix(string(out), "\n"), "\n")
+	limit := min(max(req.GetInt("max_results", 100), 1), maxGitResults)
+	if len(lines) > limit {
+		lines = append(lines[:limit], fmt.Sprintf("\n... (%d more matches)", len(lines)-limit))
+	}
+	return truncateBytes([]byte(strings.Join(lines, "")), g.cfg.maxOutput), nil
+}
+
+// query 在仓库中执行只读的 git 命令, 输出为空时返回 empty
+func (g *gitTools) query(ctx context.Context, req mcp.CallToolRequest, args []string, empty string) (string, error) {
+	dir, unlock, err := g.repo(req)
+	if err != nil {
+		return "", err
+	}
+	defer unlock()
+	if err := g.ensureCloned(ctx, req, dir); err != nil {
+		return "", err
+	}
+	out, err := g.run(ctx, dir, args...)
+	if err != nil {
+		return "", err
+	}
+	if len(bytes.TrimSpace(out)) == 0 {
+		return empty, nil
+	}
+	return truncateBytes(out, g.cfg.maxOutput), nil
+}
+
+// checkGitArg 拒绝以 - 开头的引用, 防止被 git 当作选项 (比如 --output=...)
+func checkGitArg(name, v string) error {
+	if strings.HasPrefix(v, "-") {
+		return &gitError{fmt.Sprintf("%s must not start with '-'", name)}
+	}
+	return nil
+}
+
+// pathspec 把路径放在 -- 之后, git 只把它当作路径, 并且不允许指向仓库之外
+func pathspec(path string) []string {
+	if path == "" {
+		return nil
+	}
+	return []string{"--", path}
+}
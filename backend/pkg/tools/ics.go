@@ -0,0 +1,428 @@
+package tools
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// icsEvent 是 iCalendar (RFC 5545) 中的一个 VEVENT, 只解析日程问答用到的属性
+type icsEvent struct {
+	uid          string
+	summary      string
+	location     string
+	description  string
+	status       string // TENTATIVE | CONFIRMED | CANCELLED
+	transparent  bool   // TRANSP:TRANSPARENT, 不占用时间
+	start, end   time.Time
+	allDay       bool
+	rrule        string
+	exdates      []time.Time
+	recurrenceID time.Time // 重复日程中被单独修改的一次, 替换主日程在这个时间的那次
+}
+
+// parseICS 解析日历中的日程, 没有时区的时间 (浮动时间和全天日程) 按 loc 解释
+func parseICS(data []byte, loc *time.Location) ([]icsEvent, error) {
+	// 折行: 以空格或制表符开头的行接在上一行后面
+	data = bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n"))
+	data = bytes.ReplaceAll(data, []byte("\n "), nil)
+	data = bytes.ReplaceAll(data, []byte("\n\t"), nil)
+
+	var events []icsEvent
+	var ev *icsEvent
+	depth := 0 // VEVENT 中嵌套的组件, 比如 VALARM
+	var duration time.Duration
+	hasDuration := false
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	sc.Buffer(make([]byte, 0, 64*1024), 4<<20)
+	for lineNo := 1; sc.Scan(); lineNo++ {
+		line := strings.TrimRight(sc.Text(), "\r")
+		name, params, value, ok := parseICSLine(line)
+		if !ok {
+			continue
+		}
+		switch {
+		case name == "BEGIN" && value == "VEVENT" && ev == nil:
+			ev, depth, hasDuration = &icsEvent{}, 0, false
+			continue
+		case name == "BEGIN" && ev != nil:
+			depth++
+			continue
+		case name == "END" && ev != nil && depth > 0:
+			depth--
+			continue
+		case name == "END" && value == "VEVENT" && ev != nil:
+			if ev.start.IsZero() {
+				ev = nil
+				continue
+			}
+			if ev.end.IsZero() {
+				switch {
+				case hasDuration:
+					ev.end = ev.start.Add(duration)
+				case ev.allDay:
+					ev.end = ev.start.AddDate(0, 0, 1)
+				default:
+					ev.end = ev.start
+				}
+			}
+			events = append(events, *ev)
+			ev = nil
+			continue
+		}
+		if ev == nil || depth > 0 {
+			continue
+		}
+		var err error
+		switch name {
+		case "UID":
+			ev.uid = value
+		case "SUMMARY":
+			ev.summary = unescapeICSText(value)
+		case "LOCATION":
+			ev.location = unescapeICSText(value)
+		case "DESCRIPTION":
+			ev.description = unescapeICSText(value)
+		case "STATUS":
+			ev.status = strings.ToUpper(value)
+		case "TRANSP":
+			ev.transparent = strings.EqualFold(value, "TRANSPARENT")
+		case "DTSTART":
+			ev.start, ev.allDay, err = parseICSTime(value, params, loc)
+		case "DTEND":
+			ev.end, _, err = parseICSTime(value, params, loc)
+		case "DURATION":
+			duration, err = parseICSDuration(value)
+			hasDuration = err == nil
+		case "RRULE":
+			ev.rrule = value
+		case "EXDATE":
+			for _, v := range strings.Split(value, ",") {
+				t, _, err := parseICSTime(v, params, loc)
+				if err == nil {
+					ev.exdates = append(ev.exdates, t)
+				}
+			}
+		case "RECURRENCE-ID":
+			ev.recurrenceID, _, err = parseICSTime(value, params, loc)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s: %v", lineNo, name, err)
+		}
+	}
+	return events, sc.Err()
+}
+
+// parseICSLine 把 NAME;PARAM=VALUE:值 拆开, 参数值可以用双引号括起来 (其中可以有冒号)
+func parseICSLine(line string) (name string, params map[string]string, value string, ok bool) {
+	quoted := false
+	colon := -1
+	for i, r := range line {
+		if r == '"' {
+			quoted = !quoted
+		} else if r == ':' && !quoted {
+			colon = i
+			break
+		}
+	}
+	if colon < 0 {
+		return "", nil, "", false
+	}
+	parts := strings.Split(line[:colon], ";")
+	name = strings.ToUpper(parts[0])
+	for _, p := range parts[1:] {
+		if k, v, ok := strings.Cut(p, "="); ok {
+			if params == nil {
+				params = map[string]string{}
+			}
+			params[strings.ToUpper(k)] = strings.Trim(v, `"`)
+		}
+	}
+	return name, params, line[colon+1:], true
+}
+
+func unescapeICSText(s string) string {
+	return strings.NewReplacer(`\n`, "\n", `\N`, "\n", `\,`, ",", `\;`, ";", `\\`, `\`).Replace(s)
+}
+
+// parseICSTime 解析 DATE (全天) 和 DATE-TIME: 以 Z 结尾为 UTC, 有 TZID 时按该时区, 否则为浮动时间, 按 loc 解释。
+// 无法识别的 TZID (比如 Outlook 的 Windows 时区名) 也按 loc 解释
+func parseICSTime(value string, params map[string]string, loc *time.Location) (time.Time, bool, error) {
+	if params["VALUE"] == "DATE" || len(value) == 8 {
+		t, err := time.ParseInLocation("20060102", value, loc)
+		return t, true, err
+	}
+	if strings.HasSuffix(value, "Z") {
+		t, err := time.Parse("20060102T150405Z", value)
+		return t, false, err
+	}
+	if tzid := params["TZID"]; tzid != "" {
+		if l, err := time.LoadLocation(strings.TrimPrefix(tzid, "/")); err == nil {
+			loc = l
+		}
+	}
+	t, err := time.ParseInLocation("20060102T150405", value, loc)
+	return t, false, err
+}
+
+// parseICSDuration 解析 [+-]P[nW][nD][T[nH][nM][nS]]
+func parseICSDuration(v string) (time.Duration, error) {
+	s := strings.TrimPrefix(v, "+")
+	neg := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(s, "-")
+	if !strings.HasPrefix(s, "P") {
+		return 0, fmt.Errorf("invalid duration %q", v)
+	}
+	var d time.Duration
+	num := ""
+	inTime := false
+	for _, r := range s[1:] {
+		switch {
+		case r >= '0' && r <= '9':
+			num += string(r)
+			continue
+		case r == 'T':
+			inTime = true
+			continue
+		}
+		n, err := strconv.Atoi(num)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", v)
+		}
+		unit := map[rune]time.Duration{'W': 7 * 24 * time.Hour, 'D': 24 * time.Hour, 'H': time.Hour, 'S': time.Second}[r]
+		if r == 'M' && inTime {
+			unit = time.Minute
+		}
+		if unit == 0 {
+			return 0, fmt.Errorf("invalid duration %q", v)
+		}
+		d += time.Duration(n) * unit
+		num = ""
+	}
+	if neg {
+		d = -d
+	}
+	return d, nil
+}
+
+// icsRule 是 RRULE 中支持的部分: FREQ、INTERVAL、COUNT、UNTIL、BYDAY 和 BYMONTHDAY
+type icsRule struct {
+	freq       string
+	interval   int
+	count      int
+	until      time.Time
+	byDay      []icsWeekday
+	byMonthDay []int
+}
+
+// icsWeekday 是 BYDAY 中的一项, n 不为 0 时表示每月的第 n 个 (负数从月末算起), 比如 -1FR
+type icsWeekday struct {
+	n   int
+	day time.Weekday
+}
+
+var icsWeekdays = map[string]time.Weekday{
+	"SU": time.Sunday, "MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday,
+	"TH": time.Thursday, "FR": time.Friday, "SA": time.Saturday,
+}
+
+func parseICSRule(s string, loc *time.Location) (icsRule, error) {
+	r := icsRule{interval: 1}
+	for _, part := range strings.Split(s, ";") {
+		k, v, _ := strings.Cut(part, "=")
+		var err error
+		switch strings.ToUpper(k) {
+		case "FREQ":
+			r.freq = strings.ToUpper(v)
+		case "INTERVAL":
+			r.interval, err = strconv.Atoi(v)
+		case "COUNT":
+			r.count, err = strconv.Atoi(v)
+		case "UNTIL":
+			r.until, _, err = parseICSTime(v, nil, loc)
+		case "BYDAY":
+			for _, d := range strings.Split(v, ",") {
+				day, ok := icsWeekdays[d[max(len(d)-2, 0):]]
+				if !ok {
+					return r, fmt.Errorf("invalid BYDAY %q", d)
+				}
+				n := 0
+				if prefix := d[:len(d)-2]; prefix != "" {
+					if n, err = strconv.Atoi(prefix); err != nil {
+						return r, fmt.Errorf("invalid BYDAY %q", d)
+					}
+				}
+				r.byDay = append(r.byDay, icsWeekday{n, day})
+			}
+		case "BYMONTHDAY":
+			for _, d := range strings.Split(v, ",") {
+				n, err := strconv.Atoi(d)
+				if err != nil {
+					return r, fmt.Errorf("invalid BYMONTHDAY %q", d)
+				}
+				r.byMonthDay = append(r.byMonthDay, n)
+			}
+		}
+		if err != nil {
+			return r, fmt.Errorf("invalid %s %q", k, v)
+		}
+	}
+	switch r.freq {
+	case "DAILY", "WEEKLY", "MONTHLY", "YEARLY":
+	default:
+		return r, fmt.Errorf("unsupported FREQ %q", r.freq)
+	}
+	r.interval = max(r.interval, 1)
+	return r, nil
+}
+
+// maxICSPeriods 限制展开重复日程时遍历的周期数, 防止很早开始的每日日程占用太多时间
+const maxICSPeriods = 20000
+
+// expandICSEvents 展开重复日程, 返回与 [from, to) 有重叠的各次日程, 按开始时间排序。
+// 被单独修改的一次 (RECURRENCE-ID) 代替主日程中的那一次; 无法解析的 RRULE 只保留第一次
+func expandICSEvents(events []icsEvent, from, to time.Time) []icsEvent {
+	overrides := map[string][]time.Time{}
+	for _, ev := range events {
+		if !ev.recurrenceID.IsZero() {
+			overrides[ev.uid] = append(overrides[ev.uid], ev.recurrenceID)
+		}
+	}
+	var out []icsEvent
+	overlaps := func(ev icsEvent) bool {
+		return ev.start.Before(to) && (ev.end.After(from) || (ev.end.Equal(ev.start) && !ev.start.Before(from)))
+	}
+	for _, ev := range events {
+		if ev.rrule == "" || !ev.recurrenceID.IsZero() {
+			if overlaps(ev) {
+				out = append(out, ev)
+			}
+			continue
+		}
+		rule, err := parseICSRule(ev.rrule, ev.start.Location())
+		if err != nil {
+			if overlaps(ev) {
+				out = append(out, ev)
+			}
+			continue
+		}
+		length := ev.end.Sub(ev.start)
+		skip := append(slices.Clip(ev.exdates), overrides[ev.uid]...)
+		n := 0
+		for _, start := range rule.occurrences(ev.start, to) {
+			if n++; rule.count > 0 && n > rule.count {
+				break
+			}
+			if !rule.until.IsZero() && start.After(rule.until) {
+				break
+			}
+			if slices.ContainsFunc(skip, start.Equal) {
+				continue
+			}
+			occ := ev
+			occ.start, occ.end = start, start.Add(length)
+			if overlaps(occ) {
+				out = append(out, occ)
+			}
+		}
+	}
+	slices.SortStableFunc(out, func(a, b icsEvent) int { return a.start.Compare(b.start) })
+	return out
+}
+
+// occurrences 按时间顺序生成从 dtstart 开始、早于 to 的各次开始时间, 保持 dtstart 的时刻 (当地时间, 跨夏令时不变)
+func (r icsRule) occurrences(dtstart, to time.Time) []time.Time {
+	var out []time.Time
+	y, m, d := dtstart.Date()
+	hh, mm, ss := dtstart.Clock()
+	loc := dtstart.Location()
+	at := func(y int, m time.Month, d int) (time.Time, bool) {
+		t := time.Date(y, m, d, hh, mm, ss, 0, loc)
+		// 不存在的日期 (比如 2 月 30 日) 被 time.Date 规范化到下个月, 跳过
+		return t, t.Day() == d && t.Month() == m
+	}
+	for p := 0; p < maxICSPeriods; p++ {
+		var candidates []time.Time
+		switch r.freq {
+		case "DAILY":
+			candidates = append(candidates, time.Date(y, m, d+p*r.interval, hh, mm, ss, 0, loc))
+		case "WEEKLY":
+			// 周从星期一开始
+			weekStart := d - (int(dtstart.Weekday())+6)%7 + p*7*r.interval
+			if len(r.byDay) == 0 {
+				candidates = append(candidates, time.Date(y, m, d+p*7*r.interval, hh, mm, ss, 0, loc))
+			}
+			for _, wd := range r.byDay {
+				candidates = append(candidates, time.Date(y, m, weekStart+(int(wd.day)+6)%7, hh, mm, ss, 0, loc))
+			}
+		case "MONTHLY":
+			first := time.Date(y, m+time.Month(p*r.interval), 1, hh, mm, ss, 0, loc)
+			candidates = r.monthDays(first, d)
+		case "YEARLY":
+			if t, ok := at(y+p*r.interval, m, d); ok {
+				candidates = append(candidates, t)
+			}
+		}
+		slices.SortFunc(candidates, func(a, b time.Time) int { return a.Compare(b) })
+		for _, t := range candidates {
+			if !t.Before(to) {
+				return out
+			}
+			if !t.Before(dtstart) {
+				out = append(out, t)
+			}
+		}
+		if !r.until.IsZero() && len(candidates) > 0 && candidates[0].After(r.until) {
+			return out
+		}
+		if r.count > 0 && len(out) >= r.count {
+			return out
+		}
+	}
+	return out
+}
+
+// monthDays 返回某月中匹配 BYDAY (第 n 个星期几) 或 BYMONTHDAY 的日期, 都没有时为 dtstart 的那一天
+func (r icsRule) monthDays(first time.Time, day int) []time.Time {
+	y, m, _ := first.Date()
+	hh, mm, ss := first.Clock()
+	loc := first.Location()
+	daysIn := time.Date(y, m+1, 0, 0, 0, 0, 0, loc).Day()
+	var out []time.Time
+	add := func(d int) {
+		if d >= 1 && d <= daysIn {
+			out = append(out, time.Date(y, m, d, hh, mm, ss, 0, loc))
+		}
+	}
+	switch {
+	case len(r.byDay) > 0:
+		for _, wd := range r.byDay {
+			offset := (int(wd.day) - int(first.Weekday()) + 7) % 7 // 第一个这个星期几是 1+offset 号
+			switch {
+			case wd.n > 0:
+				add(1 + offset + (wd.n-1)*7)
+			case wd.n < 0:
+				last := 1 + offset + ((daysIn-1-offset)/7)*7
+				add(last + (wd.n+1)*7)
+			default:
+				for d := 1 + offset; d <= daysIn; d += 7 {
+					add(d)
+				}
+			}
+		}
+	case len(r.byMonthDay) > 0:
+		for _, d := range r.byMonthDay {
+			if d < 0 {
+				d = daysIn + 1 + d
+			}
+			add(d)
+		}
+	default:
+		add(day)
+	}
+	return out
+}
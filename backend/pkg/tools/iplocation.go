@@ -0,0 +1,64 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// NewIPLocationServer 提供 ip_location_query 工具, 通过 ip-api.com 查询 IP 地址的地理位置
+func NewIPLocationServer() *server.MCPServer {
+	s := server.NewMCPServer(
+		"ip-location-server",
+		"1.0.0",
+		server.WithResourceCapabilities(true, true),
+		server.WithPromptCapabilities(true),
+		server.WithToolCapabilities(true),
+		server.WithRecovery(),
+	)
+
+	ipTool := mcp.NewTool("ip_location_query",
+		mcp.WithDescription("查询IP地址的地理位置"),
+		mcp.WithString("ip",
+			mcp.Required(),
+			mcp.Description("要查询的IP地址"),
+		),
+	)
+	s.AddTool(ipTool, ipQueryHandler)
+	return s
+}
+
+func ipQueryHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	ip, ok := request.GetArguments()["ip"].(string)
+	if !ok {
+		return nil, errors.New("ip must be a string")
+	}
+
+	parsedIP := net.ParseIP(ip)
+	if parsedIP == nil {
+		return nil, errors.New("无效的 IP 地址")
+	}
+
+	// 调用外部IP地理位置服务
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://ip-api.com/json/"+ip, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("查询失败: %v", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("读取响应体错误: %v", err)
+	}
+	return mcp.NewToolResultText(string(data)), nil
+}
@@ -0,0 +1,667 @@
+package tools
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	defaultK8sTimeout   = 30 * time.Second
+	defaultK8sMaxOutput = 64 * 1024
+	maxK8sLogLines      = 2000
+
+	inClusterTokenFile = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+	inClusterCAFile    = "/var/run/secrets/kubernetes.io/serviceaccount/ca.crt"
+)
+
+// k8sKind 是 k8s_describe 支持的资源类型, 不包括 Secret
+type k8sKind struct {
+	api      string // /api/v1 或 /apis/<group>/<version>
+	resource string
+	kind     string
+}
+
+var k8sKinds = map[string]k8sKind{
+	"pod":                   {"/api/v1", "pods", "Pod"},
+	"service":               {"/api/v1", "services", "Service"},
+	"configmap":             {"/api/v1", "configmaps", "ConfigMap"},
+	"persistentvolumeclaim": {"/api/v1", "persistentvolumeclaims", "PersistentVolumeClaim"},
+	"deployment":            {"/apis/apps/v1", "deployments", "Deployment"},
+	"statefulset":           {"/apis/apps/v1", "statefulsets", "StatefulSet"},
+	"daemonset":             {"/apis/apps/v1", "daemonsets", "DaemonSet"},
+	"replicaset":            {"/apis/apps/v1", "replicasets", "ReplicaSet"},
+	"job":                   {"/apis/batch/v1", "jobs", "Job"},
+	"cronjob":               {"/apis/batch/v1", "cronjobs", "CronJob"},
+	"ingress":               {"/apis/networking.k8s.io/v1", "ingresses", "Ingress"},
+}
+
+// k8sConfig 从环境变量读取:
+//   - K8S_NAMESPACES: 允许访问的命名空间, 逗号分隔, * 表示全部, 缺省只允许 default
+//   - KUBECONFIG: kubeconfig 文件, 有多个路径时使用第一个; 未设置时在集群内运行则使用 ServiceAccount, 否则使用 ~/.kube/config
+//   - K8S_CONTEXT: 使用 kubeconfig 中的哪个 context, 缺省为 current-context
+//   - K8S_TIMEOUT: 每个请求的超时, 缺省 30s
+//   - K8S_MAX_OUTPUT: 最多返回的字节数, 缺省 65536
+type k8sConfig struct {
+	namespaces []string // nil 表示全部
+	kubeconfig string
+	context    string
+	timeout    time.Duration
+	maxOutput  int
+}
+
+func k8sConfigFromEnv() (k8sConfig, error) {
+	cfg := k8sConfig{
+		namespaces: []string{"default"},
+		context:    os.Getenv("K8S_CONTEXT"),
+		timeout:    defaultK8sTimeout,
+		maxOutput:  defaultK8sMaxOutput,
+	}
+	if v := os.Getenv("K8S_NAMESPACES"); v != "" {
+		cfg.namespaces = nil
+		for _, ns := range strings.Split(v, ",") {
+			if ns = strings.TrimSpace(ns); ns == "*" {
+				cfg.namespaces = nil
+				break
+			} else if ns != "" {
+				cfg.namespaces = append(cfg.namespaces, ns)
+			}
+		}
+	}
+	if v := os.Getenv("KUBECONFIG"); v != "" {
+		cfg.kubeconfig = filepath.SplitList(v)[0]
+	}
+	if v := os.Getenv("K8S_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return cfg, fmt.Errorf("K8S_TIMEOUT: invalid duration %q", v)
+		}
+		cfg.timeout = d
+	}
+	if v := os.Getenv("K8S_MAX_OUTPUT"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return cfg, fmt.Errorf("K8S_MAX_OUTPUT: invalid number %q", v)
+		}
+		cfg.maxOutput = n
+	}
+	return cfg, nil
+}
+
+// k8sClient 只读访问 Kubernetes API, 只用到 GET 请求
+type k8sClient struct {
+	server    string
+	token     string
+	tokenFile string // 集群内的令牌会轮换, 每次请求时重新读取
+	http      *http.Client
+}
+
+// kubeconfig 是 kubeconfig 文件中用到的字段, 不支持 exec 和 auth-provider 插件
+type kubeconfig struct {
+	CurrentContext string `yaml:"current-context"`
+	Clusters       []struct {
+		Name    string `yaml:"name"`
+		Cluster struct {
+			Server                   string `yaml:"server"`
+			CertificateAuthority     string `yaml:"certificate-authority"`
+			CertificateAuthorityData string `yaml:"certificate-authority-data"`
+			InsecureSkipTLSVerify    bool   `yaml:"insecure-skip-tls-verify"`
+		} `yaml:"cluster"`
+	} `yaml:"clusters"`
+	Users []struct {
+		Name string `yaml:"name"`
+		User struct {
+			Token                 string    `yaml:"token"`
+			TokenFile             string    `yaml:"tokenFile"`
+			ClientCertificate     string    `yaml:"client-certificate"`
+			ClientCertificateData string    `yaml:"client-certificate-data"`
+			ClientKey             string    `yaml:"client-key"`
+			ClientKeyData         string    `yaml:"client-key-data"`
+			Exec                  yaml.Node `yaml:"exec"`
+		} `yaml:"user"`
+	} `yaml:"users"`
+	Contexts []struct {
+		Name    string `yaml:"name"`
+		Context struct {
+			Cluster string `yaml:"cluster"`
+			User    string `yaml:"user"`
+		} `yaml:"context"`
+	} `yaml:"contexts"`
+}
+
+// newK8sClient 按 kubectl 的顺序选择凭据: 指定的 kubeconfig、集群内的 ServiceAccount、~/.kube/config
+func newK8sClient(cfg k8sConfig) (*k8sClient, error) {
+	if cfg.kubeconfig == "" && os.Getenv("KUBERNETES_SERVICE_HOST") != "" {
+		if _, err := os.Stat(inClusterTokenFile); err == nil {
+			return inClusterK8sClient(cfg)
+		}
+	}
+	path := cfg.kubeconfig
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+		path = filepath.Join(home, ".kube", "config")
+	}
+	return kubeconfigK8sClient(cfg, path)
+}
+
+func inClusterK8sClient(cfg k8sConfig) (*k8sClient, error) {
+	ca, err := os.ReadFile(inClusterCAFile)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("invalid CA certificate in %s", inClusterCAFile)
+	}
+	host := net.JoinHostPort(os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT"))
+	return &k8sClient{
+		server:    "https://" + host,
+		tokenFile: inClusterTokenFile,
+		http:      &http.Client{Timeout: cfg.timeout, Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}},
+	}, nil
+}
+
+func kubeconfigK8sClient(cfg k8sConfig, path string) (*k8sClient, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("no Kubernetes credentials: %v", err)
+	}
+	var kc kubeconfig
+	if err := yaml.Unmarshal(data, &kc); err != nil {
+		return nil, fmt.Errorf("parse %s: %v", path, err)
+	}
+	name := cfg.context
+	if name == "" {
+		name = kc.CurrentContext
+	}
+	var kctx struct{ cluster, user string }
+	found := false
+	for _, c := range kc.Contexts {
+		if c.Name == name {
+			kctx.cluster, kctx.user, found = c.Context.Cluster, c.Context.User, true
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("context %q not found in %s", name, path)
+	}
+
+	// kubeconfig 中的相对路径相对于 kubeconfig 文件所在的目录
+	dir := filepath.Dir(path)
+	readFileOrData := func(file, b64 string) ([]byte, error) {
+		if b64 != "" {
+			return base64.StdEncoding.DecodeString(b64)
+		}
+		if file == "" {
+			return nil, nil
+		}
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(dir, file)
+		}
+		return os.ReadFile(file)
+	}
+
+	c := &k8sClient{}
+	tlsConfig := &tls.Config{}
+	found = false
+	for _, cl := range kc.Clusters {
+		if cl.Name != kctx.cluster {
+			continue
+		}
+		found = true
+		c.server = strings.TrimRight(cl.Cluster.Server, "/")
+		tlsConfig.InsecureSkipVerify = cl.Cluster.InsecureSkipTLSVerify
+		ca, err := readFileOrData(cl.Cluster.CertificateAuthority, cl.Cluster.CertificateAuthorityData)
+		if err != nil {
+			return nil, fmt.Errorf("cluster %q: certificate authority: %v", cl.Name, err)
+		}
+		if ca != nil {
+			tlsConfig.RootCAs = x509.NewCertPool()
+			if !tlsConfig.RootCAs.AppendCertsFromPEM(ca) {
+				return nil, fmt.Errorf("cluster %q: invalid certificate authority", cl.Name)
+			}
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("cluster %q not found in %s", kctx.cluster, path)
+	}
+	for _, u := range kc.Users {
+		if u.Name != kctx.user {
+			continue
+		}
+		if !u.User.Exec.IsZero() {
+			return nil, fmt.Errorf("user %q: exec credential plugins are not supported, use a token or client certificate", u.Name)
+		}
+		c.token = u.User.Token
+		if u.User.TokenFile != "" {
+			c.tokenFile = u.User.TokenFile
+			if !filepath.IsAbs(c.tokenFile) {
+				c.tokenFile = filepath.Join(dir, c.tokenFile)
+			}
+		}
+		cert, err := readFileOrData(u.User.ClientCertificate, u.User.ClientCertificateData)
+		if err != nil {
+			return nil, fmt.Errorf("user %q: client certificate: %v", u.Name, err)
+		}
+		key, err := readFileOrData(u.User.ClientKey, u.User.ClientKeyData)
+		if err != nil {
+			return nil, fmt.Errorf("user %q: client key: %v", u.Name, err)
+		}
+		if cert != nil {
+			pair, err := tls.X509KeyPair(cert, key)
+			if err != nil {
+				return nil, fmt.Errorf("user %q: %v", u.Name, err)
+			}
+			tlsConfig.Certificates = []tls.Certificate{pair}
+		}
+	}
+	c.http = &http.Client{Timeout: cfg.timeout, Transport: &http.Transport{TLSClientConfig: tlsConfig, Proxy: http.ProxyFromEnvironment}}
+	return c, nil
+}
+
+// k8sAPIError 是 Kubernetes API 返回的错误 (比如对象不存在、没有权限), 作为工具结果返回给大模型
+type k8sAPIError struct{ msg string }
+
+func (e *k8sAPIError) Error() string { return e.msg }
+
+// get 请求 API, 返回响应体, 最多读取 limit 字节
+func (c *k8sClient) get(ctx context.Context, path string, query url.Values, limit int) ([]byte, error) {
+	u := c.server + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	token := c.token
+	if c.tokenFile != "" {
+		b, err := os.ReadFile(c.tokenFile)
+		if err != nil {
+			return nil, err
+		}
+		token = strings.TrimSpace(string(b))
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, int64(limit)))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		var status struct {
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(body, &status) == nil && status.Message != "" {
+			return nil, &k8sAPIError{status.Message}
+		}
+		return nil, &k8sAPIError{resp.Status}
+	}
+	return body, nil
+}
+
+// k8sTools 在第一次调用工具时建立客户端, 没有集群时服务也能启动, 工具调用时返回错误
+type k8sTools struct {
+	cfg    k8sConfig
+	client func() (*k8sClient, error)
+}
+
+// NewK8sServer 提供只读的 Kubernetes 工具: 列出 Pod (k8s_list_pods)、查看对象和相关事件 (k8s_describe)、
+// Pod 日志 (k8s_logs) 和事件 (k8s_events), 只能访问允许的命名空间, 不能读取 Secret。
+// 凭据的权限应当同样是只读的, 配置见 k8sConfig
+func NewK8sServer() *server.MCPServer {
+	s := server.NewMCPServer(
+		"k8s-tools-server",
+		"1.0.0",
+		server.WithToolCapabilities(true),
+		server.WithRecovery(),
+	)
+	cfg, cfgErr := k8sConfigFromEnv()
+	t := &k8sTools{cfg: cfg, client: sync.OnceValues(func() (*k8sClient, error) {
+		if cfgErr != nil {
+			return nil, cfgErr
+		}
+		return newK8sClient(cfg)
+	})}
+
+	nsDesc := "Namespace, default " + t.defaultNamespace()
+	nsOpts := []mcp.PropertyOption{mcp.Description(nsDesc)}
+	if cfg.namespaces != nil {
+		nsOpts = append(nsOpts, mcp.Enum(cfg.namespaces...))
+	}
+	kinds := make([]string, 0, len(k8sKinds))
+	for k := range k8sKinds {
+		kinds = append(kinds, k)
+	}
+	slices.Sort(kinds)
+
+	s.AddTool(mcp.NewTool("k8s_list_pods",
+		mcp.WithDescription("List the pods in a Kubernetes namespace with their readiness, status, restarts, age and node"),
+		mcp.WithString("namespace", nsOpts...),
+		mcp.WithString("label_selector", mcp.Description("Label selector, e.g. app=web,tier!=cache")),
+	), t.wrap(t.listPods))
+	s.AddTool(mcp.NewTool("k8s_describe",
+		mcp.WithDescription("Show a Kubernetes object (spec and status as YAML) and its recent events"),
+		mcp.WithString("namespace", nsOpts...),
+		mcp.WithString("kind", mcp.Required(), mcp.Description("Object kind"), mcp.Enum(kinds...)),
+		mcp.WithString("name", mcp.Required(), mcp.Description("Object name")),
+	), t.wrap(t.describe))
+	s.AddTool(mcp.NewTool("k8s_logs",
+		mcp.WithDescription("Show the logs of a pod container"),
+		mcp.WithString("namespace", nsOpts...),
+		mcp.WithString("pod", mcp.Required(), mcp.Description("Pod name")),
+		mcp.WithString("container", mcp.Description("Container name, required if the pod has several containers")),
+		mcp.WithNumber("tail_lines", mcp.Description("Number of lines from the end, default 100")),
+		mcp.WithNumber("since_seconds", mcp.Description("Only logs newer than this many seconds")),
+		mcp.WithBoolean("previous", mcp.Description("Logs of the previous terminated container, e.g. after a crash")),
+	), t.wrap(t.logs))
+	s.AddTool(mcp.NewTool("k8s_events",
+		mcp.WithDescription("List recent events in a Kubernetes namespace, newest last"),
+		mcp.WithString("namespace", nsOpts...),
+		mcp.WithString("object", mcp.Description("Only events about the object with this name")),
+		mcp.WithBoolean("warnings_only", mcp.Description("Only Warning events")),
+		mcp.WithNumber("limit", mcp.Description("Maximum number of events, default 50")),
+	), t.wrap(t.events))
+	return s
+}
+
+func (t *k8sTools) defaultNamespace() string {
+	if t.cfg.namespaces != nil {
+		return t.cfg.namespaces[0]
+	}
+	return "default"
+}
+
+// wrap 建立客户端、检查命名空间, 并把 API 错误和参数错误转换为工具结果
+func (t *k8sTools) wrap(h func(ctx context.Context, c *k8sClient, ns string, req mcp.CallToolRequest) (string, error)) server.ToolHandlerFunc {
+	return func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		c, err := t.client()
+		if err != nil {
+			return nil, err
+		}
+		ns := req.GetString("namespace", t.defaultNamespace())
+		if t.cfg.namespaces != nil && !slices.Contains(t.cfg.namespaces, ns) {
+			return mcp.NewToolResultError(fmt.Sprintf("namespace %q is not allowed (available: %s)", ns, strings.Join(t.cfg.namespaces, ", "))), nil
+		}
+		out, err := h(ctx, c, ns, req)
+		var apiErr *k8sAPIError
+		if errors.As(err, &apiErr) {
+			return mcp.NewToolResultError(apiErr.msg), nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		return mcp.NewToolResultText(truncateBytes([]byte(out), t.cfg.maxOutput)), nil
+	}
+}
+
+// k8sObjectMeta 是各种对象共有的元数据中用到的部分
+type k8sObjectMeta struct {
+	Name              string     `json:"name"`
+	CreationTimestamp time.Time  `json:"creationTimestamp"`
+	DeletionTimestamp *time.Time `json:"deletionTimestamp"`
+}
+
+type k8sContainerState struct {
+	Waiting    *struct{ Reason string } `json:"waiting"`
+	Terminated *struct{ Reason string } `json:"terminated"`
+}
+
+type k8sPod struct {
+	Metadata k8sObjectMeta `json:"metadata"`
+	Spec     struct {
+		NodeName   string `json:"nodeName"`
+		Containers []struct {
+			Name string `json:"name"`
+		} `json:"containers"`
+	} `json:"spec"`
+	Status struct {
+		Phase             string `json:"phase"`
+		Reason            string `json:"reason"`
+		ContainerStatuses []struct {
+			Ready        bool              `json:"ready"`
+			RestartCount int               `json:"restartCount"`
+			State        k8sContainerState `json:"state"`
+		} `json:"containerStatuses"`
+	} `json:"status"`
+}
+
+// status 和 kubectl get pods 的 STATUS 列相同: 容器等待或退出的原因优先于 Pod 的阶段
+func (p *k8sPod) status() string {
+	if p.Metadata.DeletionTimestamp != nil {
+		return "Terminating"
+	}
+	status := p.Status.Phase
+	if p.Status.Reason != "" {
+		status = p.Status.Reason
+	}
+	for _, cs := range p.Status.ContainerStatuses {
+		switch {
+		case cs.State.Waiting != nil && cs.State.Waiting.Reason != "":
+			return cs.State.Waiting.Reason
+		case cs.State.Terminated != nil && cs.State.Terminated.Reason != "" && status != "Succeeded":
+			status = cs.State.Terminated.Reason
+		}
+	}
+	return status
+}
+
+func (t *k8sTools) listPods(ctx context.Context, c *k8sClient, ns string, req mcp.CallToolRequest) (string, error) {
+	q := url.Values{}
+	if sel := req.GetString("label_selector", ""); sel != "" {
+		q.Set("labelSelector", sel)
+	}
+	var list struct{ Items []k8sPod }
+	if err := t.getJSON(ctx, c, "/api/v1/namespaces/"+url.PathEscape(ns)+"/pods", q, &list); err != nil {
+		return "", err
+	}
+	if len(list.Items) == 0 {
+		return "no pods in namespace " + ns, nil
+	}
+	var b strings.Builder
+	w := tabwriter.NewWriter(&b, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tREADY\tSTATUS\tRESTARTS\tAGE\tNODE")
+	for _, p := range list.Items {
+		ready, restarts := 0, 0
+		for _, cs := range p.Status.ContainerStatuses {
+			if cs.Ready {
+				ready++
+			}
+			restarts += cs.RestartCount
+		}
+		fmt.Fprintf(w, "%s\t%d/%d\t%s\t%d\t%s\t%s\n", p.Metadata.Name, ready, len(p.Spec.Containers),
+			p.status(), restarts, k8sAge(p.Metadata.CreationTimestamp), p.Spec.NodeName)
+	}
+	w.Flush()
+	return b.String(), nil
+}
+
+func (t *k8sTools) describe(ctx context.Context, c *k8sClient, ns string, req mcp.CallToolRequest) (string, error) {
+	kindName, err := req.RequireString("kind")
+	if err != nil {
+		return "", &k8sAPIError{err.Error()}
+	}
+	name, err := req.RequireString("name")
+	if err != nil {
+		return "", &k8sAPIError{err.Error()}
+	}
+	kind, ok := k8sKinds[strings.ToLower(kindName)]
+	if !ok {
+		return "", &k8sAPIError{fmt.Sprintf("unsupported kind %q", kindName)}
+	}
+	var obj map[string]any
+	path := kind.api + "/namespaces/" + url.PathEscape(ns) + "/" + kind.resource + "/" + url.PathEscape(name)
+	if err := t.getJSON(ctx, c, path, nil, &obj); err != nil {
+		return "", err
+	}
+	// managedFields 和 last-applied-configuration 很长, 对排查问题没有帮助
+	if meta, ok := obj["metadata"].(map[string]any); ok {
+		delete(meta, "managedFields")
+		if ann, ok := meta["annotations"].(map[string]any); ok {
+			delete(ann, "kubectl.kubernetes.io/last-applied-configuration")
+		}
+	}
+	var out strings.Builder
+	enc := yaml.NewEncoder(&out)
+	enc.SetIndent(2)
+	if err := enc.Encode(obj); err != nil {
+		return "", err
+	}
+	events, err := t.listEvents(ctx, c, ns, url.Values{
+		"fieldSelector": {"involvedObject.name=" + name + ",involvedObject.kind=" + kind.kind},
+	}, 20)
+	if err != nil {
+		events = "failed to list events: " + err.Error() + "\n"
+	}
+	return out.String() + "\nEvents:\n" + events, nil
+}
+
+func (t *k8sTools) logs(ctx context.Context, c *k8sClient, ns string, req mcp.CallToolRequest) (string, error) {
+	pod, err := req.RequireString("pod")
+	if err != nil {
+		return "", &k8sAPIError{err.Error()}
+	}
+	q := url.Values{"tailLines": {strconv.Itoa(min(max(req.GetInt("tail_lines", 100), 1), maxK8sLogLines))}}
+	if v := req.GetString("container", ""); v != "" {
+		q.Set("container", v)
+	}
+	if v := req.GetInt("since_seconds", 0); v > 0 {
+		q.Set("sinceSeconds", strconv.Itoa(v))
+	}
+	if req.GetBool("previous", false) {
+		q.Set("previous", "true")
+	}
+	// 日志可能很长, 请求时就限制字节数
+	q.Set("limitBytes", strconv.Itoa(t.cfg.maxOutput))
+	ctx, cancel := context.WithTimeout(ctx, t.cfg.timeout)
+	defer cancel()
+	out, err := c.get(ctx, "/api/v1/namespaces/"+url.PathEscape(ns)+"/pods/"+url.PathEscape(pod)+"/log", q, t.cfg.maxOutput+1)
+	if err != nil {
+		return "", err
+	}
+	if len(out) == 0 {
+		return "no logs", nil
+	}
+	return string(out), nil
+}
+
+func (t *k8sTools) events(ctx context.Context, c *k8sClient, ns string, req mcp.CallToolRequest) (string, error) {
+	var selectors []string
+	if v := req.GetString("object", ""); v != "" {
+		selectors = append(selectors, "involvedObject.name="+v)
+	}
+	if req.GetBool("warnings_only", false) {
+		selectors = append(selectors, "type=Warning")
+	}
+	q := url.Values{}
+	if len(selectors) > 0 {
+		q.Set("fieldSelector", strings.Join(selectors, ","))
+	}
+	return t.listEvents(ctx, c, ns, q, min(max(req.GetInt("limit", 50), 1), 500))
+}
+
+type k8sEvent struct {
+	Metadata       k8sObjectMeta `json:"metadata"`
+	Type           string        `json:"type"`
+	Reason         string        `json:"reason"`
+	Message        string        `json:"message"`
+	Count          int           `json:"count"`
+	LastTimestamp  *time.Time    `json:"lastTimestamp"`
+	EventTime      *time.Time    `json:"eventTime"`
+	InvolvedObject struct {
+		Kind string `json:"kind"`
+		Name string `json:"name"`
+	} `json:"involvedObject"`
+}
+
+// lastSeen 依次使用 lastTimestamp、eventTime (events.k8s.io 写入的事件) 和创建时间
+func (e *k8sEvent) lastSeen() time.Time {
+	switch {
+	case e.LastTimestamp != nil && !e.LastTimestamp.IsZero():
+		return *e.LastTimestamp
+	case e.EventTime != nil && !e.EventTime.IsZero():
+		return *e.EventTime
+	}
+	return e.Metadata.CreationTimestamp
+}
+
+// listEvents 按时间顺序返回最近的 limit 个事件
+func (t *k8sTools) listEvents(ctx context.Context, c *k8sClient, ns string, q url.Values, limit int) (string, error) {
+	var list struct{ Items []k8sEvent }
+	if err := t.getJSON(ctx, c, "/api/v1/namespaces/"+url.PathEscape(ns)+"/events", q, &list); err != nil {
+		return "", err
+	}
+	if len(list.Items) == 0 {
+		return "no events\n", nil
+	}
+	slices.SortStableFunc(list.Items, func(a, b k8sEvent) int { return a.lastSeen().Compare(b.lastSeen()) })
+	if len(list.Items) > limit {
+		list.Items = list.Items[len(list.Items)-limit:]
+	}
+	var b strings.Builder
+	w := tabwriter.NewWriter(&b, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "LAST SEEN\tTYPE\tREASON\tOBJECT\tCOUNT\tMESSAGE")
+	for _, e := range list.Items {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s/%s\t%d\t%s\n", k8sAge(e.lastSeen()), e.Type, e.Reason,
+			strings.ToLower(e.InvolvedObject.Kind), e.InvolvedObject.Name, max(e.Count, 1), strings.TrimSpace(e.Message))
+	}
+	w.Flush()
+	return b.String(), nil
+}
+
+// getJSON 请求 API 并解析 JSON 响应; 列表可能很大, 不限制响应的大小, 输出时再截断
+func (t *k8sTools) getJSON(ctx context.Context, c *k8sClient, path string, q url.Values, v any) error {
+	ctx, cancel := context.WithTimeout(ctx, t.cfg.timeout)
+	defer cancel()
+	body, err := c.get(ctx, path, q, 64<<20)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(body, v)
+}
+
+// k8sAge 和 kubectl 的 AGE 列相同, 比如 45s、12m、5h、3d
+func k8sAge(t time.Time) string {
+	if t.IsZero() {
+		return "<unknown>"
+	}
+	d := time.Since(t)
+	switch {
+	case d < time.Minute:
+		return fmt.Sprintf("%ds", max(int(d.Seconds()), 0))
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	case d < 48*time.Hour:
+		return fmt.Sprintf("%dh", int(d.Hours()))
+	}
+	return fmt.Sprintf("%dd", int(d.Hours()/24))
+}
@@ -0,0 +1,574 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unicode/utf8"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+const (
+	defaultNewsTimeout    = 20 * time.Second
+	defaultNewsInterval   = 2 * time.Second
+	defaultNewsMaxArticle = 20000
+	defaultNewsUserAgent  = "mcp-host-web-news/1.0"
+	newsMaxDownload       = 5 << 20
+	newsMaxWait           = 30 * time.Second // 同一网站排队超过这个时间时不再等待
+	newsMaxItems          = 50
+)
+
+// newsConfig 从环境变量读取:
+//   - NEWS_FEEDS: 预先配置的订阅, 逗号分隔, 每项为 名称=URL, fetch_feed 可以直接用名称
+//   - NEWS_ALLOWED_DOMAINS: 允许访问的域名, 逗号分隔, *.example.com 匹配子域名; 缺省不限制
+//   - NEWS_RATE_INTERVAL: 对同一域名两次请求的最小间隔, 缺省 2s
+//   - NEWS_TIMEOUT: 每次请求的超时, 缺省 20s
+//   - NEWS_MAX_ARTICLE: 文章正文最多返回的字节数, 缺省 20000
+//   - NEWS_USER_AGENT: 请求的 User-Agent
+//   - NEWS_ALLOW_PRIVATE: 为 1 时允许访问内网和本机地址, 缺省拒绝, 防止通过工具访问内部服务
+type newsConfig struct {
+	feeds        map[string]string // 名称 -> URL
+	names        []string          // 按配置顺序
+	domains      []string
+	interval     time.Duration
+	timeout      time.Duration
+	maxArticle   int
+	userAgent    string
+	allowPrivate bool
+}
+
+var newsFeedNamePattern = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+func newsConfigFromEnv() (newsConfig, error) {
+	cfg := newsConfig{
+		feeds:        map[string]string{},
+		interval:     defaultNewsInterval,
+		timeout:      defaultNewsTimeout,
+		maxArticle:   defaultNewsMaxArticle,
+		userAgent:    defaultNewsUserAgent,
+		allowPrivate: os.Getenv("NEWS_ALLOW_PRIVATE") == "1",
+	}
+	for _, item := range strings.Split(os.Getenv("NEWS_FEEDS"), ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		name, u, ok := strings.Cut(item, "=")
+		name, u = strings.TrimSpace(name), strings.TrimSpace(u)
+		if !ok || !newsFeedNamePattern.MatchString(name) || u == "" {
+			return cfg, fmt.Errorf("NEWS_FEEDS: invalid feed %q, use name=url", item)
+		}
+		if _, dup := cfg.feeds[name]; dup {
+			return cfg, fmt.Errorf("NEWS_FEEDS: duplicate feed name %q", name)
+		}
+		cfg.feeds[name] = u
+		cfg.names = append(cfg.names, name)
+	}
+	for _, d := range strings.Split(os.Getenv("NEWS_ALLOWED_DOMAINS"), ",") {
+		if d = strings.ToLower(strings.TrimSpace(d)); d != "" {
+			cfg.domains = append(cfg.domains, d)
+		}
+	}
+	for _, e := range []struct {
+		name string
+		dst  *time.Duration
+	}{{"NEWS_RATE_INTERVAL", &cfg.interval}, {"NEWS_TIMEOUT", &cfg.timeout}} {
+		if v := os.Getenv(e.name); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil || d < 0 {
+				return cfg, fmt.Errorf("%s: invalid duration %q", e.name, v)
+			}
+			*e.dst = d
+		}
+	}
+	if v := os.Getenv("NEWS_MAX_ARTICLE"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return cfg, fmt.Errorf("NEWS_MAX_ARTICLE: invalid number %q", v)
+		}
+		cfg.maxArticle = n
+	}
+	if v := os.Getenv("NEWS_USER_AGENT"); v != "" {
+		cfg.userAgent = v
+	}
+	return cfg, nil
+}
+
+// NewNewsServer 提供新闻工具: fetch_feed 读取 RSS/Atom 订阅的最新条目, fetch_article 下载网页并提取正文,
+// 供大模型总结。对同一域名的请求按 NEWS_RATE_INTERVAL 排队, 避免频繁访问同一网站; 配置见 newsConfig
+func NewNewsServer() *server.MCPServer {
+	s := server.NewMCPServer(
+		"news-server",
+		"1.0.0",
+		server.WithToolCapabilities(true),
+		server.WithRecovery(),
+	)
+	cfg, cfgErr := newsConfigFromEnv()
+	n := newNewsClient(cfg)
+
+	feedDesc := "Feed URL (RSS or Atom)"
+	if len(cfg.names) > 0 {
+		feedDesc += " or one of the configured feeds: " + strings.Join(cfg.names, ", ")
+	}
+	s.AddTool(mcp.NewTool("fetch_feed",
+		mcp.WithDescription("Fetch the latest items of an RSS or Atom news feed: title, link, date and a short summary"),
+		mcp.WithString("feed", mcp.Required(), mcp.Description(feedDesc)),
+		mcp.WithNumber("limit", mcp.Description(fmt.Sprintf("Maximum number of items, default 10, at most %d", newsMaxItems))),
+		mcp.WithString("since", mcp.Description("Only items published after this time: RFC 3339 or a duration ago such as 24h or 3d")),
+		mcp.WithString("query", mcp.Description("Only items whose title or summary contains this text")),
+		mcp.WithReadOnlyHintAnnotation(true),
+	), n.wrap(cfgErr, n.fetchFeed))
+	s.AddTool(mcp.NewTool("fetch_article",
+		mcp.WithDescription("Download a web page such as a news article and extract its main text, without navigation, ads and comments"),
+		mcp.WithString("url", mcp.Required(), mcp.Description("Article URL")),
+		mcp.WithReadOnlyHintAnnotation(true),
+	), n.wrap(cfgErr, n.fetchArticle))
+	return s
+}
+
+type newsClient struct {
+	cfg  newsConfig
+	http *http.Client
+
+	mu   sync.Mutex
+	next map[string]time.Time // 域名 -> 下一次允许请求的时间
+}
+
+func newNewsClient(cfg newsConfig) *newsClient {
+	n := &newsClient{cfg: cfg, next: map[string]time.Time{}}
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	if !cfg.allowPrivate {
+		// 在连接时检查解析后的地址, 重定向和 DNS 解析到内网地址的域名也会被拒绝
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			if host, ok := isPublicAddr(address); !ok {
+				return &newsError{fmt.Sprintf("access to %s is not allowed", host)}
+			}
+			return nil
+		}
+	}
+	n.http = &http.Client{
+		Timeout: cfg.timeout,
+		// 不使用代理, 否则上面的地址检查只能检查代理本身
+		Transport: &http.Transport{DialContext: dialer.DialContext, TLSHandshakeTimeout: 10 * time.Second},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 5 {
+				return errors.New("too many redirects")
+			}
+			return n.checkURL(req.URL)
+		},
+	}
+	return n
+}
+
+// isPublicAddr 检查连接的地址 (ip:port) 是否为公网地址, 拒绝本机、内网和链路本地地址
+func isPublicAddr(address string) (host string, ok bool) {
+	host, _, _ = net.SplitHostPort(address)
+	ip := net.ParseIP(host)
+	return host, ip != nil && !ip.IsLoopback() && !ip.IsPrivate() && !ip.IsUnspecified() &&
+		!ip.IsLinkLocalUnicast() && !ip.IsLinkLocalMulticast()
+}
+
+// newsError 是参数错误或网站的拒绝, 作为工具结果返回给大模型
+type newsError struct{ msg string }
+
+func (e *newsError) Error() string { return e.msg }
+
+func (n *newsClient) wrap(cfgErr error, h func(ctx context.Context, req mcp.CallToolRequest) (string, error)) server.ToolHandlerFunc {
+	return func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		if cfgErr != nil {
+			return nil, cfgErr
+		}
+		out, err := h(ctx, req)
+		var nerr *newsError
+		if errors.As(err, &nerr) {
+			return mcp.NewToolResultError(nerr.msg), nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		return mcp.NewToolResultText(out), nil
+	}
+}
+
+func (n *newsClient) checkURL(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return &newsError{fmt.Sprintf("unsupported URL scheme %q, use http or https", u.Scheme)}
+	}
+	if len(n.cfg.domains) > 0 && !matchDomain(n.cfg.domains, u.Hostname()) {
+		return &newsError{fmt.Sprintf("%s is not in the allowed domains (%s)", u.Hostname(), strings.Join(n.cfg.domains, ", "))}
+	}
+	return nil
+}
+
+// wait 按域名排队, 保证对同一域名的请求间隔不小于 NEWS_RATE_INTERVAL
+func (n *newsClient) wait(ctx context.Context, host string) error {
+	n.mu.Lock()
+	now := time.Now()
+	slot := n.next[host]
+	if slot.Before(now) {
+		slot = now
+	}
+	if slot.Sub(now) > newsMaxWait {
+		n.mu.Unlock()
+		return &newsError{fmt.Sprintf("too many requests to %s, try again later", host)}
+	}
+	n.next[host] = slot.Add(n.cfg.interval)
+	n.mu.Unlock()
+
+	if d := time.Until(slot); d > 0 {
+		t := time.NewTimer(d)
+		defer t.Stop()
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// get 下载 URL, 返回内容和 Content-Type
+func (n *newsClient) get(ctx context.Context, rawURL, accept string) ([]byte, string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, "", &newsError{fmt.Sprintf("invalid URL %q", rawURL)}
+	}
+	if err := n.checkURL(u); err != nil {
+		return nil, "", err
+	}
+	if err := n.wait(ctx, strings.ToLower(u.Hostname())); err != nil {
+		return nil, "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, "", err
+	}
+	req.Header.Set("User-Agent", n.cfg.userAgent)
+	req.Header.Set("Accept", accept)
+	resp, err := n.http.Do(req)
+	var nerr *newsError
+	if errors.As(err, &nerr) {
+		return nil, "", nerr
+	}
+	if err != nil {
+		return nil, "", &newsError{err.Error()}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", &newsError{fmt.Sprintf("GET %s: %s", u, resp.Status)}
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, newsMaxDownload+1))
+	if err != nil {
+		return nil, "", &newsError{err.Error()}
+	}
+	if len(body) > newsMaxDownload {
+		return nil, "", &newsError{fmt.Sprintf("%s is larger than %d bytes", u, newsMaxDownload)}
+	}
+	return body, resp.Header.Get("Content-Type"), nil
+}
+
+// feedItem 是 RSS 的 item 或 Atom 的 entry
+type feedItem struct {
+	title     string
+	link      string
+	published time.Time
+	summary   string
+}
+
+// rssFeed 同时匹配 RSS 2.0 (item 在 channel 中) 和 RSS 1.0 (item 与 channel 同级)
+type rssFeed struct {
+	Channel struct {
+		Title string    `xml:"title"`
+		Items []rssItem `xml:"item"`
+	} `xml:"channel"`
+	Items []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string `xml:"title"`
+	Link        string `xml:"link"`
+	GUID        string `xml:"guid"`
+	PubDate     string `xml:"pubDate"`
+	Date        string `xml:"http://purl.org/dc/elements/1.1/ date"`
+	Description string `xml:"description"`
+	Content     string `xml:"http://purl.org/rss/1.0/modules/content/ encoded"`
+}
+
+type atomFeed struct {
+	Title   string `xml:"title"`
+	Entries []struct {
+		Title string `xml:"title"`
+		Links []struct {
+			Href string `xml:"href,attr"`
+			Rel  string `xml:"rel,attr"`
+		} `xml:"link"`
+		Published string `xml:"published"`
+		Updated   string `xml:"updated"`
+		Summary   string `xml:"summary"`
+		Content   string `xml:"content"`
+	} `xml:"entry"`
+}
+
+// parseFeed 解析 RSS 2.0、RSS 1.0 和 Atom
+func parseFeed(data []byte) (title string, items []feedItem, err error) {
+	newDecoder := func() *xml.Decoder {
+		d := xml.NewDecoder(bytes.NewReader(data))
+		d.Strict = false
+		d.Entity = xml.HTMLEntity
+		d.CharsetReader = xmlCharsetReader
+		return d
+	}
+	var root string
+	for d := newDecoder(); root == ""; {
+		tok, err := d.Token()
+		if err != nil {
+			return "", nil, fmt.Errorf("not an RSS or Atom feed: %v", err)
+		}
+		if se, ok := tok.(xml.StartElement); ok {
+			root = se.Name.Local
+		}
+	}
+	switch root {
+	case "rss", "RDF":
+		var f rssFeed
+		if err := newDecoder().Decode(&f); err != nil {
+			return "", nil, err
+		}
+		for _, it := range append(f.Channel.Items, f.Items...) {
+			link := strings.TrimSpace(it.Link)
+			if link == "" && strings.HasPrefix(it.GUID, "http") {
+				link = strings.TrimSpace(it.GUID)
+			}
+			items = append(items, feedItem{
+				title:     htmlToText(it.Title),
+				link:      link,
+				published: parseFeedTime(firstNonEmpty(it.PubDate, it.Date)),
+				summary:   htmlToText(firstNonEmpty(it.Description, it.Content)),
+			})
+		}
+		return htmlToText(f.Channel.Title), items, nil
+	case "feed":
+		var f atomFeed
+		if err := newDecoder().Decode(&f); err != nil {
+			return "", nil, err
+		}
+		for _, e := range f.Entries {
+			var link string
+			for _, l := range e.Links {
+				if l.Rel == "" || l.Rel == "alternate" {
+					link = l.Href
+					break
+				}
+			}
+			items = append(items, feedItem{
+				title:     htmlToText(e.Title),
+				link:      link,
+				published: parseFeedTime(firstNonEmpty(e.Published, e.Updated)),
+				summary:   htmlToText(firstNonEmpty(e.Summary, e.Content)),
+			})
+		}
+		return htmlToText(f.Title), items, nil
+	}
+	return "", nil, fmt.Errorf("not an RSS or Atom feed (root element <%s>)", root)
+}
+
+// firstNonEmpty 返回第一个去掉空白后不为空的字符串
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v = strings.TrimSpace(v); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// feedTimeLayouts 是订阅中常见的时间格式, RSS 用 RFC 822 (实际写法五花八门), Atom 用 RFC 3339
+var feedTimeLayouts = []string{
+	time.RFC1123Z, time.RFC1123, time.RFC3339, time.RFC822Z, time.RFC822,
+	"Mon, 2 Jan 2006 15:04:05 -0700", "Mon, 2 Jan 2006 15:04:05 MST", "2 Jan 2006 15:04:05 -0700",
+	"Mon, 02 Jan 2006 15:04 -0700", "2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02",
+}
+
+func parseFeedTime(v string) time.Time {
+	for _, layout := range feedTimeLayouts {
+		if t, err := time.Parse(layout, v); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// xmlCharsetReader 支持 ISO-8859-1 (和常被当作它使用的 Windows-1252) 编码的订阅, 其他非 UTF-8 编码报错
+func xmlCharsetReader(charset string, input io.Reader) (io.Reader, error) {
+	switch strings.ToLower(charset) {
+	case "utf-8", "utf8", "us-ascii", "ascii":
+		return input, nil
+	case "iso-8859-1", "latin1", "windows-1252":
+		b, err := io.ReadAll(input)
+		if err != nil {
+			return nil, err
+		}
+		return strings.NewReader(latin1ToUTF8(b)), nil
+	}
+	return nil, fmt.Errorf("unsupported charset %q", charset)
+}
+
+func latin1ToUTF8(b []byte) string {
+	r := make([]rune, len(b))
+	for i, c := range b {
+		r[i] = rune(c)
+	}
+	return string(r)
+}
+
+func (n *newsClient) fetchFeed(ctx context.Context, req mcp.CallToolRequest) (string, error) {
+	feed, err := req.RequireString("feed")
+	if err != nil {
+		return "", &newsError{err.Error()}
+	}
+	if u, ok := n.cfg.feeds[feed]; ok {
+		feed = u
+	}
+	limit := req.GetInt("limit", 10)
+	if limit <= 0 || limit > newsMaxItems {
+		limit = newsMaxItems
+	}
+	var since time.Time
+	if v := req.GetString("since", ""); v != "" {
+		if since, err = parseSince(v, time.Now()); err != nil {
+			return "", err
+		}
+	}
+	query := strings.ToLower(req.GetString("query", ""))
+
+	data, _, err := n.get(ctx, feed, "application/rss+xml, application/atom+xml, application/xml;q=0.9, */*;q=0.5")
+	if err != nil {
+		return "", err
+	}
+	title, items, err := parseFeed(data)
+	if err != nil {
+		return "", &newsError{err.Error()}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s (%s)\n", firstNonEmpty(title, "Untitled feed"), feed)
+	shown := 0
+	for _, it := range items {
+		if !since.IsZero() && (it.published.IsZero() || it.published.Before(since)) {
+			continue
+		}
+		if query != "" && !strings.Contains(strings.ToLower(it.title+"\n"+it.summary), query) {
+			continue
+		}
+		if shown == limit {
+			break
+		}
+		shown++
+		fmt.Fprintf(&b, "\n%d. %s", shown, firstNonEmpty(it.title, "(no title)"))
+		if !it.published.IsZero() {
+			fmt.Fprintf(&b, " (%s)", it.published.UTC().Format("2006-01-02 15:04 UTC"))
+		}
+		b.WriteByte('\n')
+		if it.link != "" {
+			b.WriteString("   " + it.link + "\n")
+		}
+		if it.summary != "" {
+			b.WriteString("   " + truncateBytes([]byte(it.summary), 300) + "\n")
+		}
+	}
+	if shown == 0 {
+		b.WriteString("\nNo matching items.\n")
+	}
+	return b.String(), nil
+}
+
+// parseSince 解析 RFC 3339 或多久以前, 比如 24h、3d
+func parseSince(v string, now time.Time) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	if days, ok := strings.CutSuffix(v, "d"); ok {
+		if n, err := strconv.Atoi(days); err == nil && n >= 0 {
+			return now.AddDate(0, 0, -n), nil
+		}
+	}
+	if d, err := time.ParseDuration(v); err == nil && d >= 0 {
+		return now.Add(-d), nil
+	}
+	return time.Time{}, &newsError{fmt.Sprintf("invalid since %q: use RFC 3339 or a duration such as 24h or 3d", v)}
+}
+
+func (n *newsClient) fetchArticle(ctx context.Context, req mcp.CallToolRequest) (string, error) {
+	u, err := req.RequireString("url")
+	if err != nil {
+		return "", &newsError{err.Error()}
+	}
+	data, contentType, err := n.get(ctx, u, "text/html, application/xhtml+xml, text/plain;q=0.8")
+	if err != nil {
+		return "", err
+	}
+	mediaType, params, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case "text/html", "application/xhtml+xml", "":
+	case "text/plain":
+		return truncateBytes(data, n.cfg.maxArticle), nil
+	default:
+		return "", &newsError{fmt.Sprintf("%s is not a web page (content type %s)", u, mediaType)}
+	}
+	page, err := decodeHTML(data, params["charset"])
+	if err != nil {
+		return "", &newsError{err.Error()}
+	}
+
+	a := extractArticle(page)
+	if a.text == "" {
+		return "", &newsError{fmt.Sprintf("no article text found in %s, the page may need JavaScript", u)}
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "Title: %s\nURL: %s\n", firstNonEmpty(a.title, "(no title)"), u)
+	for _, f := range []struct{ name, value string }{{"Site", a.siteName}, {"Author", a.byline}, {"Published", a.published}} {
+		if f.value != "" {
+			fmt.Fprintf(&b, "%s: %s\n", f.name, f.value)
+		}
+	}
+	b.WriteString("\n")
+	b.WriteString(truncateBytes([]byte(a.text), n.cfg.maxArticle))
+	return b.String(), nil
+}
+
+var htmlMetaCharset = regexp.MustCompile(`(?i)<meta[^>]+charset=["']?([\w-]+)`)
+
+// decodeHTML 按 Content-Type 或 <meta> 中的编码把网页转换为 UTF-8
+func decodeHTML(data []byte, charset string) (string, error) {
+	if charset == "" {
+		head := data[:min(len(data), 2048)]
+		if m := htmlMetaCharset.FindSubmatch(head); m != nil {
+			charset = string(m[1])
+		}
+	}
+	switch strings.ToLower(charset) {
+	case "", "utf-8", "utf8", "us-ascii", "ascii":
+		if !utf8.Valid(data) {
+			return strings.ToValidUTF8(string(data), "�"), nil
+		}
+		return string(data), nil
+	case "iso-8859-1", "latin1", "windows-1252":
+		return latin1ToUTF8(data), nil
+	}
+	return "", fmt.Errorf("unsupported charset %q", charset)
+}
@@ -0,0 +1,968 @@
+package tools
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/ascii85"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// 这里是只用标准库实现的 PDF 文本提取, 覆盖常见的文档: 不依赖 xref 表 (直接扫描对象, 损坏的 xref 也能读),
+// 支持对象流、FlateDecode/ASCIIHex/ASCII85、ToUnicode CMap (中文等 CID 字体需要) 和 WinAnsi 编码。
+// 不支持加密的 PDF 和扫描件 (图片中的文字需要 OCR)
+
+type (
+	pdfName    string
+	pdfString  string // 原始字节
+	pdfKeyword string // 内容流中的操作符, 以及 true/false/null 以外的关键字
+	pdfDict    map[pdfName]any
+	pdfRef     struct{ num, gen int }
+)
+
+type pdfStream struct {
+	dict pdfDict
+	raw  []byte
+}
+
+// pdfLexer 读取 PDF 对象, 也用于内容流
+type pdfLexer struct {
+	b   []byte
+	pos int
+}
+
+func isPDFSpace(c byte) bool {
+	return c == ' ' || c == '\n' || c == '\r' || c == '\t' || c == '\f' || c == 0
+}
+
+func isPDFDelim(c byte) bool {
+	return strings.IndexByte("()<>[]{}/%", c) >= 0
+}
+
+func (l *pdfLexer) skipSpace() {
+	for l.pos < len(l.b) {
+		c := l.b[l.pos]
+		if c == '%' {
+			for l.pos < len(l.b) && l.b[l.pos] != '\n' && l.b[l.pos] != '\r' {
+				l.pos++
+			}
+			continue
+		}
+		if !isPDFSpace(c) {
+			return
+		}
+		l.pos++
+	}
+}
+
+var errPDFEOF = errors.New("unexpected end of PDF data")
+
+// next 读取下一个对象; 遇到 ] 或 >> 时返回对应的 pdfKeyword
+func (l *pdfLexer) next() (any, error) {
+	l.skipSpace()
+	if l.pos >= len(l.b) {
+		return nil, errPDFEOF
+	}
+	c := l.b[l.pos]
+	switch {
+	case c == '/':
+		l.pos++
+		start := l.pos
+		for l.pos < len(l.b) && !isPDFSpace(l.b[l.pos]) && !isPDFDelim(l.b[l.pos]) {
+			l.pos++
+		}
+		return pdfName(decodePDFName(l.b[start:l.pos])), nil
+	case c == '(':
+		return l.literalString()
+	case c == '<' && l.pos+1 < len(l.b) && l.b[l.pos+1] == '<':
+		l.pos += 2
+		d := pdfDict{}
+		for {
+			k, err := l.next()
+			if err != nil {
+				return d, err
+			}
+			if k == pdfKeyword(">>") {
+				return d, nil
+			}
+			v, err := l.next()
+			if err != nil {
+				return d, err
+			}
+			if name, ok := k.(pdfName); ok {
+				d[name] = v
+			}
+		}
+	case c == '<':
+		l.pos++
+		end := bytes.IndexByte(l.b[l.pos:], '>')
+		if end < 0 {
+			return nil, errPDFEOF
+		}
+		digits := bytes.Map(func(r rune) rune {
+			if isPDFSpace(byte(r)) {
+				return -1
+			}
+			return r
+		}, l.b[l.pos:l.pos+end])
+		if len(digits)%2 == 1 {
+			digits = append(digits, '0')
+		}
+		l.pos += end + 1
+		s, _ := hex.DecodeString(string(digits))
+		return pdfString(s), nil
+	case c == '>' && l.pos+1 < len(l.b) && l.b[l.pos+1] == '>':
+		l.pos += 2
+		return pdfKeyword(">>"), nil
+	case c == '[':
+		l.pos++
+		var arr []any
+		for {
+			v, err := l.next()
+			if err != nil {
+				return arr, err
+			}
+			if v == pdfKeyword("]") {
+				return arr, nil
+			}
+			arr = append(arr, v)
+		}
+	case c == ']' || c == '{' || c == '}' || c == ')' || c == '>':
+		l.pos++
+		return pdfKeyword(string(c)), nil
+	case c >= '0' && c <= '9' || c == '+' || c == '-' || c == '.':
+		n := l.number()
+		// 整数后面跟 "整数 R" 是引用
+		if n == math.Trunc(n) && n >= 0 {
+			save := l.pos
+			l.skipSpace()
+			if l.pos < len(l.b) && l.b[l.pos] >= '0' && l.b[l.pos] <= '9' {
+				gen := l.number()
+				l.skipSpace()
+				if l.pos < len(l.b) && l.b[l.pos] == 'R' && (l.pos+1 == len(l.b) || isPDFSpace(l.b[l.pos+1]) || isPDFDelim(l.b[l.pos+1])) {
+					l.pos++
+					return pdfRef{int(n), int(gen)}, nil
+				}
+			}
+			l.pos = save
+		}
+		return n, nil
+	}
+	start := l.pos
+	for l.pos < len(l.b) && !isPDFSpace(l.b[l.pos]) && !isPDFDelim(l.b[l.pos]) {
+		l.pos++
+	}
+	if l.pos == start {
+		l.pos++
+	}
+	switch kw := string(l.b[start:l.pos]); kw {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null":
+		return nil, nil
+	default:
+		return pdfKeyword(kw), nil
+	}
+}
+
+func (l *pdfLexer) number() float64 {
+	start := l.pos
+	l.pos++
+	for l.pos < len(l.b) && (l.b[l.pos] >= '0' && l.b[l.pos] <= '9' || l.b[l.pos] == '.') {
+		l.pos++
+	}
+	n, _ := strconv.ParseFloat(string(l.b[start:l.pos]), 64)
+	return n
+}
+
+func (l *pdfLexer) literalString() (any, error) {
+	l.pos++
+	var out []byte
+	depth := 1
+	for l.pos < len(l.b) {
+		c := l.b[l.pos]
+		l.pos++
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			if depth--; depth == 0 {
+				return pdfString(out), nil
+			}
+		case '\\':
+			if l.pos >= len(l.b) {
+				continue
+			}
+			e := l.b[l.pos]
+			l.pos++
+			switch e {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r', '\n':
+				// 续行
+				if e == '\r' && l.pos < len(l.b) && l.b[l.pos] == '\n' {
+					l.pos++
+				}
+				continue
+			default:
+				if e >= '0' && e <= '7' {
+					v := int(e - '0')
+					for i := 0; i < 2 && l.pos < len(l.b) && l.b[l.pos] >= '0' && l.b[l.pos] <= '7'; i++ {
+						v = v*8 + int(l.b[l.pos]-'0')
+						l.pos++
+					}
+					c = byte(v)
+				} else {
+					c = e
+				}
+			}
+		}
+		out = append(out, c)
+	}
+	return pdfString(out), errPDFEOF
+}
+
+func decodePDFName(b []byte) string {
+	if bytes.IndexByte(b, '#') < 0 {
+		return string(b)
+	}
+	var out []byte
+	for i := 0; i < len(b); i++ {
+		if b[i] == '#' && i+2 < len(b) {
+			if v, err := strconv.ParseUint(string(b[i+1:i+3]), 16, 8); err == nil {
+				out = append(out, byte(v))
+				i += 2
+				continue
+			}
+		}
+		out = append(out, b[i])
+	}
+	return string(out)
+}
+
+// pdfDoc 是解析后的文档, 对象按编号保存, 同一编号出现多次 (增量更新) 时使用文件中靠后的定义
+type pdfDoc struct {
+	objects map[int]pdfEntry
+	trailer pdfDict
+	pages   []pdfDict // 按顺序, Resources 已从上层继承
+}
+
+type pdfEntry struct {
+	val any
+	pos int // 定义的位置, 对象流中的对象使用对象流的位置
+}
+
+var pdfObjPattern = regexp.MustCompile(`(\d+)\s+(\d+)\s+obj\b`)
+
+// parsePDF 扫描文件中的所有对象并建立页面列表
+func parsePDF(data []byte) (*pdfDoc, error) {
+	if !bytes.HasPrefix(bytes.TrimLeft(data[:min(len(data), 1024)], "\x00\r\n\t "), []byte("%PDF-")) {
+		return nil, errors.New("not a PDF file")
+	}
+	doc := &pdfDoc{objects: map[int]pdfEntry{}}
+	set := func(num int, v any, pos int) {
+		if e, ok := doc.objects[num]; !ok || pos >= e.pos {
+			doc.objects[num] = pdfEntry{v, pos}
+		}
+	}
+	var objStreams []pdfEntry
+	trailerPos := -1
+	end := 0
+	for _, m := range pdfObjPattern.FindAllSubmatchIndex(data, -1) {
+		if m[0] < end {
+			continue // 在上一个对象 (比如流的数据) 中
+		}
+		num, _ := strconv.Atoi(string(data[m[2]:m[3]]))
+		l := &pdfLexer{b: data, pos: m[1]}
+		v, err := l.next()
+		if err != nil {
+			continue
+		}
+		end = l.pos
+		l.skipSpace()
+		if d, ok := v.(pdfDict); ok && bytes.HasPrefix(data[l.pos:], []byte("stream")) {
+			start := l.pos + len("stream")
+			if start < len(data) && data[start] == '\r' {
+				start++
+			}
+			if start < len(data) && data[start] == '\n' {
+				start++
+			}
+			stop := -1
+			if n, ok := d["Length"].(float64); ok && start+int(n) <= len(data) &&
+				bytes.HasPrefix(bytes.TrimLeft(data[start+int(n):], "\r\n\t "), []byte("endstream")) {
+				stop = start + int(n)
+			} else if i := bytes.Index(data[start:], []byte("endstream")); i >= 0 {
+				stop = start + i
+				// Length 不可用时去掉 endstream 前的换行
+				for stop > start && (data[stop-1] == '\n' || data[stop-1] == '\r') {
+					stop--
+				}
+			}
+			if stop < 0 {
+				continue
+			}
+			s := &pdfStream{dict: d, raw: data[start:stop]}
+			v = s
+			end = stop
+			switch d["Type"] {
+			case pdfName("ObjStm"):
+				objStreams = append(objStreams, pdfEntry{s, m[0]})
+			case pdfName("XRef"):
+				if m[0] > trailerPos {
+					doc.trailer, trailerPos = d, m[0]
+				}
+			}
+		}
+		set(num, v, m[0])
+	}
+	// 传统的 trailer 字典
+	for i := 0; ; {
+		j := bytes.Index(data[i:], []byte("trailer"))
+		if j < 0 {
+			break
+		}
+		i += j + len("trailer")
+		l := &pdfLexer{b: data, pos: i}
+		if d, err := l.next(); err == nil {
+			if d, ok := d.(pdfDict); ok && d["Root"] != nil && i > trailerPos {
+				doc.trailer, trailerPos = d, i
+			}
+		}
+	}
+	for _, e := range objStreams {
+		doc.readObjStream(e.val.(*pdfStream), e.pos, set)
+	}
+	if doc.trailer != nil && doc.trailer["Encrypt"] != nil {
+		return nil, errors.New("encrypted PDF files are not supported")
+	}
+	doc.loadPages()
+	if len(doc.pages) == 0 {
+		return nil, errors.New("no pages found, the PDF may be damaged")
+	}
+	return doc, nil
+}
+
+// readObjStream 读取对象流中压缩保存的对象
+func (doc *pdfDoc) readObjStream(s *pdfStream, pos int, set func(int, any, int)) {
+	data, err := doc.decodeStream(s)
+	if err != nil {
+		return
+	}
+	n, _ := doc.resolve(s.dict["N"]).(float64)
+	first, _ := doc.resolve(s.dict["First"]).(float64)
+	l := &pdfLexer{b: data}
+	type entry struct{ num, off int }
+	var entries []entry
+	for i := 0; i < int(n); i++ {
+		num, err1 := l.next()
+		off, err2 := l.next()
+		nf, ok1 := num.(float64)
+		of, ok2 := off.(float64)
+		if err1 != nil || err2 != nil || !ok1 || !ok2 {
+			return
+		}
+		entries = append(entries, entry{int(nf), int(of)})
+	}
+	for _, e := range entries {
+		if int(first)+e.off >= len(data) {
+			continue
+		}
+		l := &pdfLexer{b: data, pos: int(first) + e.off}
+		if v, err := l.next(); err == nil {
+			set(e.num, v, pos)
+		}
+	}
+}
+
+// resolve 把引用替换为对象
+func (doc *pdfDoc) resolve(v any) any {
+	for i := 0; i < 16; i++ {
+		ref, ok := v.(pdfRef)
+		if !ok {
+			return v
+		}
+		v = doc.objects[ref.num].val
+	}
+	return nil
+}
+
+func (doc *pdfDoc) dict(v any) pdfDict {
+	switch v := doc.resolve(v).(type) {
+	case pdfDict:
+		return v
+	case *pdfStream:
+		return v.dict
+	}
+	return nil
+}
+
+// loadPages 按页面树的顺序列出页面; 页面树损坏时按对象编号列出所有页面
+func (doc *pdfDoc) loadPages() {
+	visited := map[any]bool{}
+	var walk func(node any, res any, depth int)
+	walk = func(node any, res any, depth int) {
+		if depth > 64 || visited[node] {
+			return
+		}
+		if ref, ok := node.(pdfRef); ok {
+			visited[ref] = true
+		}
+		d := doc.dict(node)
+		if d == nil {
+			return
+		}
+		if r, ok := d["Resources"]; ok {
+			res = r
+		}
+		kids, isTree := doc.resolve(d["Kids"]).([]any)
+		if d["Type"] == pdfName("Pages") || isTree && d["Type"] != pdfName("Page") {
+			for _, k := range kids {
+				walk(k, res, depth+1)
+			}
+			return
+		}
+		page := pdfDict{}
+		for k, v := range d {
+			page[k] = v
+		}
+		page["Resources"] = res
+		doc.pages = append(doc.pages, page)
+	}
+	if root := doc.dict(doc.trailer["Root"]); root != nil {
+		walk(root["Pages"], nil, 0)
+	}
+	if len(doc.pages) > 0 {
+		return
+	}
+	var nums []int
+	for num, e := range doc.objects {
+		if d := doc.dict(e.val); d != nil && d["Type"] == pdfName("Page") {
+			nums = append(nums, num)
+		}
+	}
+	slices.Sort(nums)
+	for _, num := range nums {
+		walk(pdfRef{num, 0}, nil, 0)
+	}
+}
+
+// decodeStream 按 Filter 解码流, 不支持的过滤器 (比如图片的 DCTDecode) 返回错误
+func (doc *pdfDoc) decodeStream(s *pdfStream) ([]byte, error) {
+	data := s.raw
+	var filters []any
+	switch f := doc.resolve(s.dict["Filter"]).(type) {
+	case pdfName:
+		filters = []any{f}
+	case []any:
+		filters = f
+	}
+	params, _ := doc.resolve(s.dict["DecodeParms"]).([]any)
+	for i, f := range filters {
+		var err error
+		switch doc.resolve(f) {
+		case pdfName("FlateDecode"), pdfName("Fl"):
+			if data, err = inflatePDF(data); err != nil {
+				return nil, err
+			}
+			var p pdfDict
+			if i < len(params) {
+				p = doc.dict(params[i])
+			} else if len(filters) == 1 {
+				p = doc.dict(s.dict["DecodeParms"])
+			}
+			if pred, _ := doc.resolve(p["Predictor"]).(float64); pred >= 10 {
+				cols, _ := doc.resolve(p["Columns"]).(float64)
+				data = unpredictPNG(data, max(int(cols), 1))
+			}
+		case pdfName("ASCIIHexDecode"), pdfName("AHx"):
+			digits := bytes.Map(func(r rune) rune {
+				if isPDFSpace(byte(r)) || r == '>' {
+					return -1
+				}
+				return r
+			}, data)
+			if len(digits)%2 == 1 {
+				digits = append(digits, '0')
+			}
+			if data, err = hex.DecodeString(string(digits)); err != nil {
+				return nil, err
+			}
+		case pdfName("ASCII85Decode"), pdfName("A85"):
+			src := bytes.TrimSpace(data)
+			src = bytes.TrimPrefix(src, []byte("<~"))
+			if i := bytes.Index(src, []byte("~>")); i >= 0 {
+				src = src[:i]
+			}
+			out := make([]byte, len(src))
+			n, _, err := ascii85.Decode(out, src, true)
+			if err != nil {
+				return nil, err
+			}
+			data = out[:n]
+		default:
+			return nil, fmt.Errorf("unsupported filter %v", f)
+		}
+	}
+	return data, nil
+}
+
+// inflatePDF 解压 FlateDecode 的数据, 截断的数据返回已解压的部分
+func inflatePDF(data []byte) ([]byte, error) {
+	r, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	out, err := io.ReadAll(r)
+	if err != nil && len(out) == 0 {
+		return nil, err
+	}
+	return out, nil
+}
+
+// unpredictPNG 还原 PNG 预测器 (常用于交叉引用流和对象流), 每行前有一个字节的过滤类型
+func unpredictPNG(data []byte, cols int) []byte {
+	var out []byte
+	prev := make([]byte, cols)
+	for len(data) >= cols+1 {
+		typ, row := data[0], slices.Clone(data[1:cols+1])
+		data = data[cols+1:]
+		for i := range row {
+			var left, upLeft byte
+			if i > 0 {
+				left, upLeft = row[i-1], prev[i-1]
+			}
+			up := prev[i]
+			switch typ {
+			case 1:
+				row[i] += left
+			case 2:
+				row[i] += up
+			case 3:
+				row[i] += byte((int(left) + int(up)) / 2)
+			case 4:
+				p := int(left) + int(up) - int(upLeft)
+				pa, pb, pc := abs(p-int(left)), abs(p-int(up)), abs(p-int(upLeft))
+				switch {
+				case pa <= pb && pa <= pc:
+					row[i] += left
+				case pb <= pc:
+					row[i] += up
+				default:
+					row[i] += upLeft
+				}
+			}
+		}
+		out = append(out, row...)
+		prev = row
+	}
+	return out
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// info 返回文档信息中的标题和作者
+func (doc *pdfDoc) info() (title, author string) {
+	info := doc.dict(doc.trailer["Info"])
+	s := func(k pdfName) string {
+		v, _ := doc.resolve(info[k]).(pdfString)
+		return strings.TrimSpace(decodePDFText(v))
+	}
+	return s("Title"), s("Author")
+}
+
+// decodePDFText 解码文档信息等处的文本字符串: 有 BOM 时是 UTF-16BE, 否则按 Latin-1 (近似 PDFDocEncoding)
+func decodePDFText(s pdfString) string {
+	if strings.HasPrefix(string(s), "\xfe\xff") {
+		return decodeUTF16BE([]byte(s[2:]))
+	}
+	if strings.HasPrefix(string(s), "\xef\xbb\xbf") {
+		return string(s[3:])
+	}
+	return latin1ToUTF8([]byte(s))
+}
+
+func decodeUTF16BE(b []byte) string {
+	u := make([]uint16, len(b)/2)
+	for i := range u {
+		u[i] = uint16(b[2*i])<<8 | uint16(b[2*i+1])
+	}
+	return string(utf16.Decode(u))
+}
+
+// pdfFont 把字符串中的编码转换为文字
+type pdfFont struct {
+	toUnicode map[string]string // 编码的字节 -> 文字
+	ranges    []pdfCodeRange    // codespacerange, 决定每个编码的字节数
+	codeLen   int               // 没有 codespacerange 时每个编码的字节数
+	simple    *[256]rune        // 单字节字体的编码
+}
+
+type pdfCodeRange struct{ lo, hi []byte }
+
+func (doc *pdfDoc) loadFont(v any) *pdfFont {
+	d := doc.dict(v)
+	f := &pdfFont{codeLen: 1}
+	if d["Subtype"] == pdfName("Type0") {
+		f.codeLen = 2
+	} else {
+		enc := winAnsiEncoding
+		if ed := doc.dict(d["Encoding"]); ed != nil {
+			// Differences: [编码 /字形名 /字形名 ... 编码 /字形名 ...]
+			diffs, _ := doc.resolve(ed["Differences"]).([]any)
+			code := 0
+			for _, x := range diffs {
+				switch x := doc.resolve(x).(type) {
+				case float64:
+					code = int(x)
+				case pdfName:
+					if r, ok := glyphRune(string(x)); ok && code >= 0 && code < 256 {
+						enc[code] = r
+					}
+					code++
+				}
+			}
+		}
+		f.simple = &enc
+	}
+	if s, ok := doc.resolve(d["ToUnicode"]).(*pdfStream); ok {
+		if data, err := doc.decodeStream(s); err == nil {
+			f.parseCMap(data)
+		}
+	}
+	return f
+}
+
+// parseCMap 读取 ToUnicode CMap 中的 codespacerange、bfchar 和 bfrange
+func (f *pdfFont) parseCMap(data []byte) {
+	f.toUnicode = map[string]string{}
+	l := &pdfLexer{b: data}
+	var operands []any
+	for {
+		v, err := l.next()
+		if err != nil {
+			return
+		}
+		kw, ok := v.(pdfKeyword)
+		if !ok {
+			operands = append(operands, v)
+			continue
+		}
+		switch kw {
+		case "endcodespacerange":
+			for i := 0; i+1 < len(operands); i += 2 {
+				lo, ok1 := operands[i].(pdfString)
+				hi, ok2 := operands[i+1].(pdfString)
+				if ok1 && ok2 && len(lo) == len(hi) && len(lo) > 0 {
+					f.ranges = append(f.ranges, pdfCodeRange{[]byte(lo), []byte(hi)})
+				}
+			}
+		case "endbfchar":
+			for i := 0; i+1 < len(operands); i += 2 {
+				src, ok1 := operands[i].(pdfString)
+				dst, ok2 := operands[i+1].(pdfString)
+				if ok1 && ok2 {
+					f.toUnicode[string(src)] = decodeUTF16BE([]byte(dst))
+				}
+			}
+		case "endbfrange":
+			for i := 0; i+2 < len(operands); i += 3 {
+				lo, ok1 := operands[i].(pdfString)
+				hi, ok2 := operands[i+1].(pdfString)
+				if !ok1 || !ok2 || len(lo) != len(hi) || len(lo) == 0 || len(lo) > 4 {
+					continue
+				}
+				from, to := pdfCode(lo), pdfCode(hi)
+				if to < from || to-from > 0xffff {
+					continue
+				}
+				switch dst := operands[i+2].(type) {
+				case pdfString:
+					// 连续的编码映射到连续的文字, 递增最后一个 UTF-16 单元
+					base := []byte(dst)
+					for c := from; c <= to; c++ {
+						b := slices.Clone(base)
+						if n := len(b); n >= 2 {
+							last := int(b[n-2])<<8 | int(b[n-1]) + int(c-from)
+							b[n-2], b[n-1] = byte(last>>8), byte(last)
+						}
+						f.toUnicode[string(pdfCodeBytes(c, len(lo)))] = decodeUTF16BE(b)
+					}
+				case []any:
+					for j, x := range dst {
+						if s, ok := x.(pdfString); ok && from+uint32(j) <= to {
+							f.toUnicode[string(pdfCodeBytes(from+uint32(j), len(lo)))] = decodeUTF16BE([]byte(s))
+						}
+					}
+				}
+			}
+		}
+		operands = operands[:0]
+	}
+}
+
+func pdfCode(b pdfString) uint32 {
+	var c uint32
+	for i := 0; i < len(b); i++ {
+		c = c<<8 | uint32(b[i])
+	}
+	return c
+}
+
+func pdfCodeBytes(c uint32, n int) []byte {
+	b := make([]byte, n)
+	for i := n - 1; i >= 0; i-- {
+		b[i] = byte(c)
+		c >>= 8
+	}
+	return b
+}
+
+// decode 把显示的字符串转换为文字, 无法转换的编码被忽略
+func (f *pdfFont) decode(s pdfString) string {
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		n := f.codeLen
+		for _, r := range f.ranges {
+			if i+len(r.lo) <= len(s) && bytes.Compare([]byte(s[i:i+len(r.lo)]), r.lo) >= 0 && bytes.Compare([]byte(s[i:i+len(r.hi)]), r.hi) <= 0 {
+				n = len(r.lo)
+				break
+			}
+		}
+		n = min(n, len(s)-i)
+		code := s[i : i+n]
+		i += n
+		if u, ok := f.toUnicode[string(code)]; ok {
+			b.WriteString(u)
+		} else if f.simple != nil && n == 1 {
+			if r := f.simple[code[0]]; r != 0 {
+				b.WriteRune(r)
+			}
+		}
+	}
+	return b.String()
+}
+
+// pageText 提取一页的文字: Td/TD/T*/Tm 使纵坐标变化时换行, TJ 中较大的间距和横向移动插入空格
+func (doc *pdfDoc) pageText(page pdfDict) string {
+	var b strings.Builder
+	doc.contentText(&b, page["Contents"], page["Resources"], 0)
+	lines := strings.Split(b.String(), "\n")
+	for i, l := range lines {
+		lines[i] = strings.TrimRight(l, " ")
+	}
+	text := strings.Join(lines, "\n")
+	for strings.Contains(text, "\n\n\n") {
+		text = strings.ReplaceAll(text, "\n\n\n", "\n\n")
+	}
+	return strings.TrimSpace(text)
+}
+
+func (doc *pdfDoc) contentText(b *strings.Builder, contents, resources any, depth int) {
+	var data []byte
+	streams := []any{contents}
+	if arr, ok := doc.resolve(contents).([]any); ok {
+		streams = arr
+	}
+	for _, s := range streams {
+		if s, ok := doc.resolve(s).(*pdfStream); ok {
+			if d, err := doc.decodeStream(s); err == nil {
+				data = append(append(data, d...), '\n')
+			}
+		}
+	}
+	res := doc.dict(resources)
+	fonts := map[pdfName]*pdfFont{}
+	var font *pdfFont
+	lastY, hasY := 0.0, false
+	lineY := 0.0 // Td 的累计纵坐标
+	newline := func() {
+		if b.Len() > 0 && !strings.HasSuffix(b.String(), "\n") {
+			b.WriteByte('\n')
+		}
+	}
+	space := func() {
+		if s := b.String(); b.Len() > 0 && !strings.HasSuffix(s, " ") && !strings.HasSuffix(s, "\n") {
+			b.WriteByte(' ')
+		}
+	}
+	moveTo := func(y float64) {
+		if hasY && math.Abs(y-lastY) > 1 {
+			newline()
+		} else if hasY {
+			space()
+		}
+		lastY, hasY = y, true
+	}
+	show := func(s pdfString) {
+		if font != nil {
+			b.WriteString(font.decode(s))
+		}
+	}
+	num := func(v any) float64 {
+		f, _ := v.(float64)
+		return f
+	}
+
+	l := &pdfLexer{b: data}
+	var ops []any
+	for {
+		v, err := l.next()
+		if err != nil {
+			break
+		}
+		kw, ok := v.(pdfKeyword)
+		if !ok {
+			ops = append(ops, v)
+			continue
+		}
+		switch kw {
+		case "Tf":
+			if len(ops) >= 2 {
+				name, _ := ops[len(ops)-2].(pdfName)
+				if fonts[name] == nil {
+					fonts[name] = doc.loadFont(doc.dict(res["Font"])[name])
+				}
+				font = fonts[name]
+			}
+		case "Td", "TD":
+			if len(ops) >= 2 {
+				lineY += num(ops[len(ops)-1])
+				if num(ops[len(ops)-1]) != 0 {
+					moveTo(lineY)
+				} else {
+					space()
+				}
+			}
+		case "Tm":
+			if len(ops) >= 6 {
+				lineY = num(ops[5])
+				moveTo(lineY)
+			}
+		case "T*":
+			newline()
+		case "Tj":
+			if len(ops) >= 1 {
+				if s, ok := ops[len(ops)-1].(pdfString); ok {
+					show(s)
+				}
+			}
+		case "'", "\"":
+			newline()
+			if len(ops) >= 1 {
+				if s, ok := ops[len(ops)-1].(pdfString); ok {
+					show(s)
+				}
+			}
+		case "TJ":
+			if len(ops) >= 1 {
+				arr, _ := ops[len(ops)-1].([]any)
+				for _, x := range arr {
+					switch x := x.(type) {
+					case pdfString:
+						show(x)
+					case float64:
+						// 单位是千分之一字号, 负数表示向右移动
+						if x < -200 {
+							space()
+						}
+					}
+				}
+			}
+		case "Do":
+			if len(ops) >= 1 && depth < 5 {
+				name, _ := ops[len(ops)-1].(pdfName)
+				if xo, ok := doc.resolve(doc.dict(res["XObject"])[name]).(*pdfStream); ok && xo.dict["Subtype"] == pdfName("Form") {
+					xres := xo.dict["Resources"]
+					if xres == nil {
+						xres = resources
+					}
+					newline()
+					doc.contentText(b, xo, xres, depth+1)
+					newline()
+				}
+			}
+		case "BI":
+			// 内嵌图片: 跳过 ID 和 EI 之间的二进制数据
+			if i := bytes.Index(data[l.pos:], []byte("ID")); i >= 0 {
+				l.pos += i + 2
+				for j := l.pos; j+2 < len(data); j++ {
+					if isPDFSpace(data[j]) && data[j+1] == 'E' && data[j+2] == 'I' && (j+3 == len(data) || isPDFSpace(data[j+3])) {
+						l.pos = j + 3
+						break
+					}
+				}
+			}
+		}
+		ops = ops[:0]
+	}
+}
+
+// winAnsiEncoding 是单字节字体的缺省编码 (Windows-1252)
+var winAnsiEncoding = func() [256]rune {
+	var t [256]rune
+	for i := 0x20; i < 0x7f; i++ {
+		t[i] = rune(i)
+	}
+	for i := 0xa0; i <= 0xff; i++ {
+		t[i] = rune(i)
+	}
+	t['\t'], t['\n'], t['\r'] = ' ', '\n', '\n'
+	for i, r := range []rune("€\x00‚ƒ„…†‡ˆ‰Š‹Œ\x00Ž\x00\x00‘’“”•–—˜™š›œ\x00žŸ") {
+		t[0x80+i] = r
+	}
+	return t
+}()
+
+// glyphNames 是 Differences 中常见的字形名, 其他按 uniXXXX 和单个字符的名称处理
+var glyphNames = map[string]rune{
+	"space": ' ', "exclam": '!', "quotedbl": '"', "numbersign": '#', "dollar": '$', "percent": '%', "ampersand": '&',
+	"quotesingle": '\'', "quoteright": '’', "quoteleft": '‘', "parenleft": '(', "parenright": ')', "asterisk": '*',
+	"plus": '+', "comma": ',', "hyphen": '-', "minus": '−', "period": '.', "slash": '/', "colon": ':', "semicolon": ';',
+	"less": '<', "equal": '=', "greater": '>', "question": '?', "at": '@', "bracketleft": '[', "backslash": '\\',
+	"bracketright": ']', "asciicircum": '^', "underscore": '_', "grave": '`', "braceleft": '{', "bar": '|',
+	"braceright": '}', "asciitilde": '~', "zero": '0', "one": '1', "two": '2', "three": '3', "four": '4', "five": '5',
+	"six": '6', "seven": '7', "eight": '8', "nine": '9', "bullet": '•', "endash": '–', "emdash": '—',
+	"quotedblleft": '“', "quotedblright": '”', "quotesinglbase": '‚', "quotedblbase": '„', "ellipsis": '…',
+	"fi": 'ﬁ', "fl": 'ﬂ', "ff": 'ﬀ', "ffi": 'ﬃ', "ffl": 'ﬄ', "degree": '°', "copyright": '©', "registered": '®',
+	"trademark": '™', "section": '§', "paragraph": '¶', "dagger": '†', "daggerdbl": '‡', "Euro": '€',
+	"nbspace": ' ', "periodcentered": '·', "multiply": '×', "divide": '÷', "plusminus": '±',
+}
+
+func glyphRune(name string) (rune, bool) {
+	if r, ok := glyphNames[name]; ok {
+		return r, true
+	}
+	if hexCode, ok := strings.CutPrefix(name, "uni"); ok && len(hexCode) == 4 {
+		if v, err := strconv.ParseUint(hexCode, 16, 32); err == nil {
+			return rune(v), true
+		}
+	}
+	if len(name) == 1 {
+		return rune(name[0]), true
+	}
+	return 0, false
+}
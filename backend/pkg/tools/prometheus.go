@@ -0,0 +1,468 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+const (
+	defaultPromTimeout   = 30 * time.Second
+	defaultPromMaxPoints = 60
+	defaultPromMaxSeries = 20
+)
+
+// promConfig 从环境变量读取:
+//   - PROMETHEUS_URL: Prometheus 的地址, 比如 http://prometheus:9090; 必填
+//   - PROMETHEUS_TOKEN: 有值时作为 Bearer 令牌发送; 或者用 PROMETHEUS_USERNAME 和 PROMETHEUS_PASSWORD 进行 Basic 认证
+//   - PROMETHEUS_TIMEOUT: 每次查询的超时, 缺省 30s
+//   - PROMETHEUS_MAX_POINTS: 范围查询中每个序列最多返回的点数, 超过时降采样, 缺省 60
+//   - PROMETHEUS_MAX_SERIES: 最多返回的序列数, 缺省 20
+type promConfig struct {
+	url       string
+	token     string
+	username  string
+	password  string
+	timeout   time.Duration
+	maxPoints int
+	maxSeries int
+}
+
+func promConfigFromEnv() (promConfig, error) {
+	cfg := promConfig{
+		url:       strings.TrimRight(os.Getenv("PROMETHEUS_URL"), "/"),
+		token:     os.Getenv("PROMETHEUS_TOKEN"),
+		username:  os.Getenv("PROMETHEUS_USERNAME"),
+		password:  os.Getenv("PROMETHEUS_PASSWORD"),
+		timeout:   defaultPromTimeout,
+		maxPoints: defaultPromMaxPoints,
+		maxSeries: defaultPromMaxSeries,
+	}
+	if cfg.url == "" {
+		return cfg, errors.New("PROMETHEUS_URL is not set")
+	}
+	if v := os.Getenv("PROMETHEUS_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return cfg, fmt.Errorf("PROMETHEUS_TIMEOUT: invalid duration %q", v)
+		}
+		cfg.timeout = d
+	}
+	for _, e := range []struct {
+		name string
+		dst  *int
+	}{{"PROMETHEUS_MAX_POINTS", &cfg.maxPoints}, {"PROMETHEUS_MAX_SERIES", &cfg.maxSeries}} {
+		if v := os.Getenv(e.name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 {
+				return cfg, fmt.Errorf("%s: invalid number %q", e.name, v)
+			}
+			*e.dst = n
+		}
+	}
+	return cfg, nil
+}
+
+// NewPrometheusServer 提供 PromQL 查询工具: 即时查询 (prometheus_query)、范围查询 (prometheus_query_range)
+// 和列出指标名 (prometheus_metrics)。范围查询的结果按 PROMETHEUS_MAX_POINTS 降采样, 并给出每个序列的最小、最大、平均和最新值,
+// 大模型不需要逐点读数据就能回答 "过去一小时的 CPU 使用率" 之类的问题。配置见 promConfig
+func NewPrometheusServer() *server.MCPServer {
+	s := server.NewMCPServer(
+		"prometheus-server",
+		"1.0.0",
+		server.WithToolCapabilities(true),
+		server.WithRecovery(),
+	)
+	cfg, cfgErr := promConfigFromEnv()
+	p := &promClient{cfg: cfg, http: &http.Client{Timeout: cfg.timeout}}
+
+	s.AddTool(mcp.NewTool("prometheus_query",
+		mcp.WithDescription("Evaluate a PromQL expression at a single point in time, e.g. the current value of a metric"),
+		mcp.WithString("query", mcp.Required(), mcp.Description("PromQL expression")),
+		mcp.WithString("time", mcp.Description("Evaluation time: RFC 3339, Unix seconds, or a duration ago such as 1h; default now")),
+	), p.wrap(cfgErr, p.query))
+	s.AddTool(mcp.NewTool("prometheus_query_range",
+		mcp.WithDescription(fmt.Sprintf("Evaluate a PromQL expression over a time range. Each series is summarized (min, max, avg, last) "+
+			"and downsampled to at most %d points.", cfg.maxPoints)),
+		mcp.WithString("query", mcp.Required(), mcp.Description("PromQL expression, e.g. avg by (instance) (rate(node_cpu_seconds_total{mode!=\"idle\"}[5m]))")),
+		mcp.WithString("start", mcp.Required(), mcp.Description("Range start: RFC 3339, Unix seconds, or a duration ago such as 1h or 7d")),
+		mcp.WithString("end", mcp.Description("Range end in the same formats, default now")),
+		mcp.WithString("step", mcp.Description("Resolution such as 30s or 5m; default chosen from the range")),
+	), p.wrap(cfgErr, p.queryRange))
+	s.AddTool(mcp.NewTool("prometheus_metrics",
+		mcp.WithDescription("List metric names known to Prometheus, to find the right metric before querying"),
+		mcp.WithString("contains", mcp.Description("Only names containing this text, e.g. cpu")),
+	), p.wrap(cfgErr, p.metrics))
+	return s
+}
+
+type promClient struct {
+	cfg  promConfig
+	http *http.Client
+}
+
+// promError 是 Prometheus 返回的查询错误 (比如 PromQL 语法错误), 作为工具结果返回给大模型
+type promError struct{ msg string }
+
+func (e *promError) Error() string { return e.msg }
+
+func (p *promClient) wrap(cfgErr error, h func(ctx context.Context, req mcp.CallToolRequest) (string, error)) server.ToolHandlerFunc {
+	return func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		if cfgErr != nil {
+			return nil, cfgErr
+		}
+		out, err := h(ctx, req)
+		var perr *promError
+		if errors.As(err, &perr) {
+			return mcp.NewToolResultError(perr.msg), nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		return mcp.NewToolResultText(out), nil
+	}
+}
+
+// promResponse 是 Prometheus HTTP API 的响应
+type promResponse struct {
+	Status    string          `json:"status"`
+	Data      json.RawMessage `json:"data"`
+	ErrorType string          `json:"errorType"`
+	Error     string          `json:"error"`
+	Warnings  []string        `json:"warnings"`
+}
+
+// promResult 是查询结果, resultType 为 vector/matrix 时 Result 是序列数组, scalar/string 时是单个 [时间, 值]
+type promResult struct {
+	ResultType string          `json:"resultType"`
+	Result     json.RawMessage `json:"result"`
+}
+
+type promSeries struct {
+	Metric map[string]string `json:"metric"`
+	Value  promSample        `json:"value"`  // vector
+	Values []promSample      `json:"values"` // matrix
+}
+
+// promSample 是 [Unix 秒, "值"]
+type promSample struct {
+	T time.Time
+	V float64
+}
+
+func (s *promSample) UnmarshalJSON(b []byte) error {
+	var raw [2]any
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	ts, ok := raw[0].(float64)
+	str, ok2 := raw[1].(string)
+	if !ok || !ok2 {
+		return fmt.Errorf("invalid sample %s", b)
+	}
+	v, err := strconv.ParseFloat(str, 64)
+	if err != nil {
+		return err
+	}
+	s.T, s.V = time.UnixMilli(int64(ts*1000)).UTC(), v
+	return nil
+}
+
+// get 请求 API, 返回 data 字段和警告
+func (p *promClient) get(ctx context.Context, path string, q url.Values) (json.RawMessage, []string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.cfg.url+path+"?"+q.Encode(), nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	switch {
+	case p.cfg.token != "":
+		req.Header.Set("Authorization", "Bearer "+p.cfg.token)
+	case p.cfg.username != "":
+		req.SetBasicAuth(p.cfg.username, p.cfg.password)
+	}
+	resp, err := p.http.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64<<20))
+	if err != nil {
+		return nil, nil, err
+	}
+	var pr promResponse
+	if err := json.Unmarshal(body, &pr); err != nil {
+		return nil, nil, fmt.Errorf("prometheus: %s", resp.Status)
+	}
+	if pr.Status != "success" {
+		// 400 和 422 是查询本身的错误, 交给大模型修改查询; 其他状态是服务的问题
+		if resp.StatusCode == http.StatusBadRequest || resp.StatusCode == http.StatusUnprocessableEntity {
+			return nil, nil, &promError{fmt.Sprintf("%s: %s", pr.ErrorType, pr.Error)}
+		}
+		return nil, nil, fmt.Errorf("prometheus: %s: %s", resp.Status, pr.Error)
+	}
+	return pr.Data, pr.Warnings, nil
+}
+
+func (p *promClient) query(ctx context.Context, req mcp.CallToolRequest) (string, error) {
+	query, err := req.RequireString("query")
+	if err != nil {
+		return "", &promError{err.Error()}
+	}
+	q := url.Values{"query": {query}}
+	if v := req.GetString("time", ""); v != "" {
+		t, err := parsePromTime(v, time.Now())
+		if err != nil {
+			return "", err
+		}
+		q.Set("time", formatPromTime(t))
+	}
+	data, warnings, err := p.get(ctx, "/api/v1/query", q)
+	if err != nil {
+		return "", err
+	}
+	var res promResult
+	if err := json.Unmarshal(data, &res); err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	switch res.ResultType {
+	case "vector":
+		var series []promSeries
+		if err := json.Unmarshal(res.Result, &series); err != nil {
+			return "", err
+		}
+		if len(series) == 0 {
+			b.WriteString("no data\n")
+		}
+		for i, s := range series {
+			if i == p.cfg.maxSeries {
+				fmt.Fprintf(&b, "... (%d more series)\n", len(series)-i)
+				break
+			}
+			fmt.Fprintf(&b, "%s %s\n", formatPromMetric(s.Metric), formatPromValue(s.Value.V))
+		}
+	case "scalar":
+		var v promSample
+		if err := json.Unmarshal(res.Result, &v); err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&b, "scalar %s\n", formatPromValue(v.V))
+	default:
+		fmt.Fprintf(&b, "%s %s\n", res.ResultType, res.Result)
+	}
+	writePromWarnings(&b, warnings)
+	return b.String(), nil
+}
+
+func (p *promClient) queryRange(ctx context.Context, req mcp.CallToolRequest) (string, error) {
+	query, err := req.RequireString("query")
+	if err != nil {
+		return "", &promError{err.Error()}
+	}
+	startArg, err := req.RequireString("start")
+	if err != nil {
+		return "", &promError{err.Error()}
+	}
+	now := time.Now()
+	start, err := parsePromTime(startArg, now)
+	if err != nil {
+		return "", err
+	}
+	end := now
+	if v := req.GetString("end", ""); v != "" {
+		if end, err = parsePromTime(v, now); err != nil {
+			return "", err
+		}
+	}
+	if !end.After(start) {
+		return "", &promError{"end must be after start"}
+	}
+	// 缺省的步长让每个序列大约有 maxPoints 个点; 指定的步长更细时查询后再降采样
+	step := (end.Sub(start) / time.Duration(p.cfg.maxPoints)).Round(time.Second)
+	if v := req.GetString("step", ""); v != "" {
+		if step, err = parsePromDuration(v); err != nil {
+			return "", err
+		}
+	}
+	// Prometheus 拒绝超过 11000 个点的查询
+	step = max(step, time.Second, (end.Sub(start)/11000).Truncate(time.Second)+time.Second)
+
+	q := url.Values{"query": {query}, "start": {formatPromTime(start)}, "end": {formatPromTime(end)}, "step": {strconv.FormatFloat(step.Seconds(), 'f', -1, 64)}}
+	data, warnings, err := p.get(ctx, "/api/v1/query_range", q)
+	if err != nil {
+		return "", err
+	}
+	var res promResult
+	if err := json.Unmarshal(data, &res); err != nil {
+		return "", err
+	}
+	var series []promSeries
+	if err := json.Unmarshal(res.Result, &series); err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "range %s to %s, step %s\n", start.UTC().Format(time.RFC3339), end.UTC().Format(time.RFC3339), step)
+	if len(series) == 0 {
+		b.WriteString("no data\n")
+	}
+	for i, s := range series {
+		if i == p.cfg.maxSeries {
+			fmt.Fprintf(&b, "... (%d more series)\n", len(series)-i)
+			break
+		}
+		writePromSeries(&b, s, p.cfg.maxPoints, end.Sub(start) >= 24*time.Hour)
+	}
+	writePromWarnings(&b, warnings)
+	return b.String(), nil
+}
+
+func (p *promClient) metrics(ctx context.Context, req mcp.CallToolRequest) (string, error) {
+	data, _, err := p.get(ctx, "/api/v1/label/__name__/values", url.Values{})
+	if err != nil {
+		return "", err
+	}
+	var names []string
+	if err := json.Unmarshal(data, &names); err != nil {
+		return "", err
+	}
+	contains := strings.ToLower(req.GetString("contains", ""))
+	names = slices.DeleteFunc(names, func(n string) bool { return !strings.Contains(strings.ToLower(n), contains) })
+	if len(names) == 0 {
+		return "no matching metrics", nil
+	}
+	const maxNames = 500
+	more := ""
+	if len(names) > maxNames {
+		more = fmt.Sprintf("\n... (%d more, narrow down with contains)", len(names)-maxNames)
+		names = names[:maxNames]
+	}
+	return strings.Join(names, "\n") + more, nil
+}
+
+// writePromSeries 输出序列的统计值和降采样后的点, 每个点是一个桶内的平均值, 时间为桶的开始时间
+func writePromSeries(b *strings.Builder, s promSeries, maxPoints int, withDate bool) {
+	fmt.Fprintf(b, "\n%s\n", formatPromMetric(s.Metric))
+	if len(s.Values) == 0 {
+		b.WriteString("  no samples\n")
+		return
+	}
+	lo, hi, sum, n := math.Inf(1), math.Inf(-1), 0.0, 0
+	for _, v := range s.Values {
+		if !math.IsNaN(v.V) {
+			lo, hi, sum, n = math.Min(lo, v.V), math.Max(hi, v.V), sum+v.V, n+1
+		}
+	}
+	last := s.Values[len(s.Values)-1]
+	fmt.Fprintf(b, "  min=%s max=%s avg=%s last=%s (%d samples)\n", formatPromValue(lo), formatPromValue(hi),
+		formatPromValue(sum/float64(n)), formatPromValue(last.V), len(s.Values))
+
+	points := downsamplePromSamples(s.Values, maxPoints)
+	layout := "15:04:05"
+	if withDate {
+		layout = "01-02 15:04"
+	}
+	parts := make([]string, len(points))
+	for i, v := range points {
+		parts[i] = v.T.Format(layout) + " " + formatPromValue(v.V)
+	}
+	if len(points) < len(s.Values) {
+		fmt.Fprintf(b, "  downsampled to %d points (bucket averages):\n", len(points))
+	}
+	b.WriteString("  " + strings.Join(parts, ", ") + "\n")
+}
+
+// downsamplePromSamples 把样本均匀分成最多 n 个桶, 每个桶取平均值
+func downsamplePromSamples(samples []promSample, n int) []promSample {
+	if len(samples) <= n {
+		return samples
+	}
+	out := make([]promSample, 0, n)
+	for i := range n {
+		lo, hi := i*len(samples)/n, (i+1)*len(samples)/n
+		sum := 0.0
+		for _, v := range samples[lo:hi] {
+			sum += v.V
+		}
+		out = append(out, promSample{T: samples[lo].T, V: sum / float64(hi-lo)})
+	}
+	return out
+}
+
+func writePromWarnings(b *strings.Builder, warnings []string) {
+	for _, w := range warnings {
+		fmt.Fprintf(b, "warning: %s\n", w)
+	}
+}
+
+// formatPromMetric 按 PromQL 的写法输出序列的标签, 比如 up{instance="a:9100", job="node"}
+func formatPromMetric(m map[string]string) string {
+	name := m["__name__"]
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		if k != "__name__" {
+			keys = append(keys, k)
+		}
+	}
+	slices.Sort(keys)
+	labels := make([]string, len(keys))
+	for i, k := range keys {
+		labels[i] = k + "=" + strconv.Quote(m[k])
+	}
+	return name + "{" + strings.Join(labels, ", ") + "}"
+}
+
+// formatPromValue 最多保留 4 位有效数字, 足够回答问题, 也节省上下文
+func formatPromValue(v float64) string {
+	return strconv.FormatFloat(v, 'g', 4, 64)
+}
+
+func formatPromTime(t time.Time) string {
+	return strconv.FormatFloat(float64(t.UnixMilli())/1000, 'f', -1, 64)
+}
+
+// parsePromTime 支持 RFC 3339、Unix 秒、now 和多久以前 (1h、7d)
+func parsePromTime(v string, now time.Time) (time.Time, error) {
+	v = strings.TrimSpace(v)
+	if v == "" || v == "now" {
+		return now, nil
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	if f, err := strconv.ParseFloat(v, 64); err == nil {
+		return time.UnixMilli(int64(f * 1000)), nil
+	}
+	if d, err := parsePromDuration(strings.TrimSuffix(strings.TrimPrefix(v, "-"), " ago")); err == nil {
+		return now.Add(-d), nil
+	}
+	return time.Time{}, &promError{fmt.Sprintf("invalid time %q: use RFC 3339, Unix seconds, or a duration ago such as 1h", v)}
+}
+
+// parsePromDuration 在 time.ParseDuration 的基础上支持 Prometheus 的 d 和 w
+func parsePromDuration(v string) (time.Duration, error) {
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if n, ok := strings.CutSuffix(v, suffix); ok {
+			if f, err := strconv.ParseFloat(n, 64); err == nil && f > 0 {
+				return time.Duration(f * float64(unit)), nil
+			}
+		}
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		return 0, &promError{fmt.Sprintf("invalid duration %q", v)}
+	}
+	return d, nil
+}
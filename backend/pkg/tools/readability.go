@@ -0,0 +1,426 @@
+package tools
+
+import (
+	"cmp"
+	"html"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// htmlToken 是 HTML 中的一段文字、开始标签或结束标签
+type htmlToken struct {
+	kind  htmlTokenKind
+	tag   string // 小写
+	attrs map[string]string
+	text  string // 已解码实体
+	void  bool   // 自闭合的开始标签
+}
+
+type htmlTokenKind int
+
+const (
+	htmlText htmlTokenKind = iota
+	htmlStart
+	htmlEnd
+)
+
+// htmlRawText 中的内容不是 HTML, 直到对应的结束标签为止
+var htmlRawText = map[string]bool{"script": true, "style": true, "textarea": true, "title": true}
+
+var htmlVoid = map[string]bool{
+	"area": true, "base": true, "br": true, "col": true, "embed": true, "hr": true, "img": true, "input": true,
+	"link": true, "meta": true, "param": true, "source": true, "track": true, "wbr": true,
+}
+
+// tokenizeHTML 是容错的 HTML 分词器, 只区分文字和标签, 不建立 DOM。注释、DOCTYPE 和处理指令被忽略,
+// 不构成标签的 "<" 当作文字
+func tokenizeHTML(s string, emit func(htmlToken)) {
+	for len(s) > 0 {
+		lt := strings.IndexByte(s, '<')
+		if lt < 0 {
+			emit(htmlToken{kind: htmlText, text: html.UnescapeString(s)})
+			return
+		}
+		if lt > 0 {
+			emit(htmlToken{kind: htmlText, text: html.UnescapeString(s[:lt])})
+			s = s[lt:]
+		}
+		switch {
+		case strings.HasPrefix(s, "<!--"):
+			end := strings.Index(s, "-->")
+			if end < 0 {
+				return
+			}
+			s = s[end+3:]
+		case strings.HasPrefix(s, "<!") || strings.HasPrefix(s, "<?"):
+			end := strings.IndexByte(s, '>')
+			if end < 0 {
+				return
+			}
+			s = s[end+1:]
+		case len(s) > 2 && s[1] == '/' && isASCIILetter(s[2]):
+			end := strings.IndexByte(s, '>')
+			if end < 0 {
+				return
+			}
+			name, _ := htmlTagName(s[2:end])
+			emit(htmlToken{kind: htmlEnd, tag: name})
+			s = s[end+1:]
+		case len(s) > 1 && isASCIILetter(s[1]):
+			end := htmlTagEnd(s)
+			if end < 0 {
+				return
+			}
+			body := s[1:end]
+			tok := htmlToken{kind: htmlStart}
+			tok.void = strings.HasSuffix(body, "/")
+			var rest string
+			tok.tag, rest = htmlTagName(body)
+			tok.attrs = parseHTMLAttrs(strings.TrimSuffix(rest, "/"))
+			tok.void = tok.void || htmlVoid[tok.tag]
+			emit(tok)
+			s = s[end+1:]
+			if htmlRawText[tok.tag] && !tok.void {
+				// 找对应的结束标签, 不区分大小写
+				closing := strings.Index(strings.ToLower(s), "</"+tok.tag)
+				if closing < 0 {
+					closing = len(s)
+				}
+				if tok.tag == "title" || tok.tag == "textarea" {
+					emit(htmlToken{kind: htmlText, text: html.UnescapeString(s[:closing])})
+				}
+				s = s[closing:]
+			}
+		default:
+			emit(htmlToken{kind: htmlText, text: "<"})
+			s = s[1:]
+		}
+	}
+}
+
+func isASCIILetter(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// htmlTagEnd 返回标签结尾的 ">" 的位置, 跳过引号中的内容
+func htmlTagEnd(s string) int {
+	var quote byte
+	for i := 1; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '>':
+			return i
+		}
+	}
+	return -1
+}
+
+func htmlTagName(s string) (name, rest string) {
+	i := strings.IndexAny(s, " \t\r\n/")
+	if i < 0 {
+		i = len(s)
+	}
+	return strings.ToLower(s[:i]), s[i:]
+}
+
+// parseHTMLAttrs 解析属性, 值可以用单引号、双引号或不加引号, 没有值的属性值为空
+func parseHTMLAttrs(s string) map[string]string {
+	attrs := map[string]string{}
+	for {
+		s = strings.TrimLeft(s, " \t\r\n/")
+		if s == "" {
+			return attrs
+		}
+		i := strings.IndexAny(s, " \t\r\n=/")
+		if i < 0 {
+			i = len(s)
+		}
+		name := strings.ToLower(s[:i])
+		s = strings.TrimLeft(s[i:], " \t\r\n")
+		if !strings.HasPrefix(s, "=") {
+			attrs[name] = ""
+			continue
+		}
+		s = strings.TrimLeft(s[1:], " \t\r\n")
+		var value string
+		if s != "" && (s[0] == '"' || s[0] == '\'') {
+			end := strings.IndexByte(s[1:], s[0])
+			if end < 0 {
+				end = len(s) - 1
+			}
+			value, s = s[1:1+end], s[min(2+end, len(s)):]
+		} else {
+			end := strings.IndexAny(s, " \t\r\n")
+			if end < 0 {
+				end = len(s)
+			}
+			value, s = s[:end], s[end:]
+		}
+		attrs[name] = html.UnescapeString(value)
+	}
+}
+
+// article 是从网页中提取的正文
+type article struct {
+	title     string
+	siteName  string
+	byline    string
+	published string
+	text      string
+}
+
+// htmlSkipTags 中的元素不是正文
+var htmlSkipTags = map[string]bool{
+	"script": true, "style": true, "noscript": true, "svg": true, "template": true, "iframe": true, "canvas": true,
+	"nav": true, "footer": true, "aside": true, "form": true, "button": true, "select": true, "textarea": true,
+}
+
+// htmlBlockTags 的开始和结束分隔段落
+var htmlBlockTags = map[string]bool{
+	"p": true, "div": true, "section": true, "article": true, "main": true, "header": true, "li": true, "ul": true, "ol": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true, "pre": true, "blockquote": true,
+	"table": true, "tr": true, "td": true, "th": true, "dl": true, "dt": true, "dd": true, "figure": true, "figcaption": true, "body": true,
+}
+
+// htmlContainerTags 可以作为正文的容器, 段落的分数加到这些祖先上
+var htmlContainerTags = map[string]bool{"div": true, "section": true, "article": true, "main": true, "td": true, "body": true}
+
+var (
+	// 参考 Mozilla Readability: class 或 id 像这些的元素多半不是正文, 除非同时像正文
+	htmlUnlikely = regexp.MustCompile(`(?i)comment|footer|sidebar|\bnav|menu|share|social|related|promo|advert|\bads?\b|banner|sponsor|cookie|popup|modal|subscribe|newsletter|breadcrumb|widget|masthead|disqus|hidden`)
+	htmlLikely   = regexp.MustCompile(`(?i)article|content|post|entry|story|main|body|text`)
+)
+
+// htmlBlock 是一个段落, ancestors 是它所在的元素, 从外到内
+type htmlBlock struct {
+	tag       string // 最内层的块元素, 决定输出的格式
+	text      string
+	linkChars int
+	ancestors []int
+}
+
+type htmlNode struct {
+	id   int
+	tag  string
+	skip bool
+	bias float64 // class/id 像正文时加分
+}
+
+// extractArticle 用简化的 Readability 算法提取正文: 去掉脚本、导航、页脚等, 按段落的长度和逗号数给祖先容器打分,
+// 取分数最高的容器中的段落; 链接文字占一半以上的段落 (比如相关文章列表) 不算正文
+func extractArticle(page string) article {
+	var a article
+	var docTitle strings.Builder
+	var stack []*htmlNode
+	var blocks []htmlBlock
+	var buf strings.Builder
+	linkChars := 0
+	nextID := 0
+
+	top := func() *htmlNode {
+		if len(stack) == 0 {
+			return nil
+		}
+		return stack[len(stack)-1]
+	}
+	inside := func(tag string) bool {
+		return slices.ContainsFunc(stack, func(n *htmlNode) bool { return n.tag == tag })
+	}
+	flush := func() {
+		raw := buf.String()
+		buf.Reset()
+		lc := linkChars
+		linkChars = 0
+		tag := ""
+		for i := len(stack) - 1; i >= 0; i-- {
+			if htmlBlockTags[stack[i].tag] {
+				tag = stack[i].tag
+				break
+			}
+		}
+		var text string
+		if tag == "pre" {
+			text = strings.Trim(strings.ReplaceAll(raw, "\x01", "\n"), "\n")
+		} else {
+			lines := strings.Split(raw, "\x01")
+			for i, l := range lines {
+				lines[i] = strings.Join(strings.Fields(l), " ")
+			}
+			text = strings.TrimSpace(strings.Join(slices.DeleteFunc(lines, func(l string) bool { return l == "" }), "\n"))
+		}
+		if text == "" {
+			return
+		}
+		ids := make([]int, 0, len(stack))
+		for _, n := range stack {
+			ids = append(ids, n.id)
+		}
+		blocks = append(blocks, htmlBlock{tag: tag, text: text, linkChars: lc, ancestors: ids})
+	}
+	pop := func(tag string) {
+		for i := len(stack) - 1; i >= 0; i-- {
+			if stack[i].tag == tag {
+				stack = stack[:i]
+				return
+			}
+			// 列表项和段落不跨越列表和容器自动关闭
+			if tag == "li" && (stack[i].tag == "ul" || stack[i].tag == "ol") || tag == "p" && htmlContainerTags[stack[i].tag] {
+				return
+			}
+		}
+	}
+	nodes := map[int]*htmlNode{}
+
+	tokenizeHTML(page, func(t htmlToken) {
+		switch t.kind {
+		case htmlText:
+			if n := top(); n != nil && n.tag == "title" {
+				docTitle.WriteString(t.text)
+				return
+			}
+			if n := top(); n != nil && n.skip {
+				return
+			}
+			buf.WriteString(t.text)
+			if inside("a") {
+				linkChars += utf8.RuneCountInString(strings.TrimSpace(t.text))
+			}
+		case htmlStart:
+			switch t.tag {
+			case "meta":
+				key := strings.ToLower(cmp.Or(t.attrs["property"], t.attrs["name"]))
+				v := strings.TrimSpace(t.attrs["content"])
+				switch key {
+				case "og:title":
+					a.title = v
+				case "og:site_name":
+					a.siteName = v
+				case "author", "article:author":
+					if !strings.HasPrefix(v, "http") {
+						a.byline = v
+					}
+				case "article:published_time", "date", "pubdate":
+					a.published = v
+				}
+				return
+			case "br":
+				buf.WriteByte('\x01')
+				return
+			}
+			if t.void {
+				return
+			}
+			if t.tag == "p" || t.tag == "li" {
+				if inside(t.tag) {
+					flush()
+					pop(t.tag)
+				}
+			}
+			if htmlBlockTags[t.tag] {
+				flush()
+			}
+			parent := top()
+			classID := t.attrs["class"] + " " + t.attrs["id"]
+			n := &htmlNode{id: nextID, tag: t.tag}
+			nextID++
+			_, hidden := t.attrs["hidden"]
+			n.skip = parent != nil && parent.skip || htmlSkipTags[t.tag] || hidden || t.attrs["aria-hidden"] == "true" ||
+				t.tag != "body" && t.tag != "article" && t.tag != "main" && htmlUnlikely.MatchString(classID) && !htmlLikely.MatchString(classID)
+			if t.tag == "article" || t.tag == "main" || htmlLikely.MatchString(classID) {
+				n.bias = 0.25
+			}
+			nodes[n.id] = n
+			stack = append(stack, n)
+		case htmlEnd:
+			if htmlBlockTags[t.tag] {
+				flush()
+			}
+			if inside(t.tag) {
+				pop(t.tag)
+			}
+		}
+	})
+	flush()
+
+	if a.title == "" {
+		a.title = strings.Join(strings.Fields(docTitle.String()), " ")
+	}
+	linkHeavy := func(b htmlBlock) bool { return b.linkChars*2 > utf8.RuneCountInString(b.text) }
+
+	// 每个段落的分数加到最近的三层容器上, 依次为 1、1/2、1/3
+	scores := map[int]float64{}
+	for _, b := range blocks {
+		n := utf8.RuneCountInString(b.text)
+		if n < 25 || linkHeavy(b) {
+			continue
+		}
+		score := 1 + float64(strings.Count(b.text, ",")+strings.Count(b.text, "，")) + min(float64(n)/100, 3)
+		level := 1
+		for i := len(b.ancestors) - 1; i >= 0 && level <= 3; i-- {
+			if node := nodes[b.ancestors[i]]; htmlContainerTags[node.tag] {
+				scores[node.id] += score / float64(level)
+				level++
+			}
+		}
+	}
+	best, bestScore := -1, 0.0
+	for id, s := range scores {
+		s *= 1 + nodes[id].bias
+		if s > bestScore || s == bestScore && id < best {
+			best, bestScore = id, s
+		}
+	}
+
+	var out strings.Builder
+	prev := ""
+	for _, b := range blocks {
+		if best >= 0 && !slices.Contains(b.ancestors, best) || linkHeavy(b) {
+			continue
+		}
+		isHeading := len(b.tag) == 2 && b.tag[0] == 'h' && b.tag[1] >= '1' && b.tag[1] <= '6'
+		if isHeading && b.text == a.title {
+			continue
+		}
+		// 连续的列表项之间不空行
+		if out.Len() > 0 {
+			if prev == "li" && b.tag == "li" {
+				out.WriteString("\n")
+			} else {
+				out.WriteString("\n\n")
+			}
+		}
+		prev = b.tag
+		switch {
+		case isHeading:
+			out.WriteString("## ")
+		case b.tag == "li":
+			out.WriteString("- ")
+		case b.tag == "blockquote":
+			out.WriteString("> ")
+		}
+		out.WriteString(b.text)
+	}
+	a.text = out.String()
+	return a
+}
+
+// htmlToText 把 HTML 片段 (比如订阅中的摘要) 转换为一行纯文本
+func htmlToText(s string) string {
+	var b strings.Builder
+	tokenizeHTML(s, func(t htmlToken) {
+		switch {
+		case t.kind == htmlText:
+			b.WriteString(t.text)
+		case htmlBlockTags[t.tag] || t.tag == "br":
+			b.WriteByte(' ')
+		}
+	})
+	return strings.Join(strings.Fields(b.String()), " ")
+}
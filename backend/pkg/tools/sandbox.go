@@ -0,0 +1,290 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+const (
+	defaultSandboxTimeout   = 10 * time.Second
+	defaultSandboxMemoryMB  = 256
+	defaultSandboxMaxOutput = 64 * 1024
+	defaultSandboxMaxProcs  = 64
+	sandboxBuildTimeout     = time.Minute // 编译 Go 代码的超时, 不计入运行的超时
+)
+
+// sandboxConfig 从环境变量读取, 内置服务和独立程序 (stdio 服务的 env) 使用同样的配置:
+//   - SANDBOX_TIMEOUT: 每次运行的超时, 缺省 10s
+//   - SANDBOX_MEMORY_MB: 进程的内存 (数据段) 上限, 缺省 256
+//   - SANDBOX_MAX_OUTPUT: stdout 和 stderr 各自最多保留的字节数, 超出时结束程序, 缺省 65536
+//   - SANDBOX_MAX_PROCS: 程序最多同时运行的进程和线程数, 缺省 64
+//   - SANDBOX_ALLOW_NETWORK: 为 1 时允许访问网络, 缺省在单独的网络命名空间中运行, 没有网络
+//   - SANDBOX_LANGUAGES: 允许的语言, 逗号分隔, 缺省 python,go
+type sandboxConfig struct {
+	timeout      time.Duration
+	memoryMB     int
+	maxOutput    int
+	maxProcs     int
+	allowNetwork bool
+	languages    []string
+}
+
+func sandboxConfigFromEnv() (sandboxConfig, error) {
+	cfg := sandboxConfig{
+		timeout:   defaultSandboxTimeout,
+		memoryMB:  defaultSandboxMemoryMB,
+		maxOutput: defaultSandboxMaxOutput,
+		maxProcs:  defaultSandboxMaxProcs,
+		languages: []string{"python", "go"},
+	}
+	if v := os.Getenv("SANDBOX_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return cfg, fmt.Errorf("SANDBOX_TIMEOUT: invalid duration %q", v)
+		}
+		cfg.timeout = d
+	}
+	for _, e := range []struct {
+		name string
+		dst  *int
+	}{{"SANDBOX_MEMORY_MB", &cfg.memoryMB}, {"SANDBOX_MAX_OUTPUT", &cfg.maxOutput}, {"SANDBOX_MAX_PROCS", &cfg.maxProcs}} {
+		if v := os.Getenv(e.name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 {
+				return cfg, fmt.Errorf("%s: invalid number %q", e.name, v)
+			}
+			*e.dst = n
+		}
+	}
+	cfg.allowNetwork = os.Getenv("SANDBOX_ALLOW_NETWORK") == "1"
+	if v := os.Getenv("SANDBOX_LANGUAGES"); v != "" {
+		cfg.languages = nil
+		for _, l := range strings.Split(v, ",") {
+			if l = strings.TrimSpace(l); l != "" {
+				cfg.languages = append(cfg.languages, l)
+			}
+		}
+	}
+	return cfg, nil
+}
+
+// NewSandboxServer 提供 run_code 工具, 在受限的环境中运行一小段 Python 或 Go 代码:
+// 每次运行使用新的临时目录, 只能看到这个目录和只读的系统目录, 有超时、内存和输出上限, 缺省没有网络,
+// 超时后结束其中所有进程。隔离依赖 Linux 的用户、mount 和 PID 命名空间, 创建时检查一次, 无法隔离时拒绝运行代码;
+// 配置见 sandboxConfig
+func NewSandboxServer() *server.MCPServer {
+	s := server.NewMCPServer(
+		"code-sandbox-server",
+		"1.0.0",
+		server.WithToolCapabilities(true),
+		server.WithRecovery(),
+	)
+	cfg, cfgErr := sandboxConfigFromEnv()
+	if cfgErr == nil {
+		cfgErr = checkSandbox(cfg)
+	}
+
+	runTool := mcp.NewTool("run_code",
+		mcp.WithDescription(fmt.Sprintf("Run a short %s program in a sandbox and return its stdout and stderr. "+
+			"Use it for calculations, data processing or checking code. The program has no network access unless enabled, "+
+			"no files from previous runs, a %s time limit and a %d MB memory limit; print the results you need.",
+			strings.Join(cfg.languages, " or "), cfg.timeout, cfg.memoryMB)),
+		mcp.WithString("language",
+			mcp.Required(),
+			mcp.Description("Programming language of the code"),
+			mcp.Enum(cfg.languages...),
+		),
+		mcp.WithString("code",
+			mcp.Required(),
+			mcp.Description("Complete program source; Go code must be a main package using only the standard library"),
+		),
+		mcp.WithString("stdin",
+			mcp.Description("Text passed to the program on standard input"),
+		),
+	)
+	s.AddTool(runTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		if cfgErr != nil {
+			return nil, cfgErr
+		}
+		language, err := request.RequireString("language")
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		code, err := request.RequireString("code")
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		return runSandboxed(ctx, cfg, language, code, request.GetString("stdin", ""))
+	})
+	return s
+}
+
+// runSandboxed 在临时目录中运行代码, 程序本身的错误 (编译失败、非零退出、超时) 作为工具结果返回, 交给大模型修改代码
+func runSandboxed(ctx context.Context, cfg sandboxConfig, language, code, stdin string) (*mcp.CallToolResult, error) {
+	allowed := false
+	for _, l := range cfg.languages {
+		allowed = allowed || l == language
+	}
+	if !allowed {
+		return mcp.NewToolResultError(fmt.Sprintf("language %q is not enabled (available: %s)", language, strings.Join(cfg.languages, ", "))), nil
+	}
+	// base/work 是程序的工作目录, base/root 是沙箱根目录的挂载点
+	base, err := os.MkdirTemp("", "mcp-sandbox-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(base)
+	dir := filepath.Join(base, "work")
+	if err := os.Mkdir(dir, 0o700); err != nil {
+		return nil, err
+	}
+
+	var argv, readOnly []string
+	switch language {
+	case "python":
+		if err := os.WriteFile(filepath.Join(dir, "main.py"), []byte(code), 0o600); err != nil {
+			return nil, err
+		}
+		python, prefixes, err := pythonPath(ctx)
+		if err != nil {
+			return nil, err
+		}
+		// 解释器和标准库不在系统目录 (比如 pyenv 安装的) 时只读挂载安装目录
+		readOnly = prefixes
+		// -I 不读取用户的 site-packages 和 PYTHON* 环境变量
+		argv = []string{python, "-I", "main.py"}
+	case "go":
+		if err := os.WriteFile(filepath.Join(dir, "main.go"), []byte(code), 0o600); err != nil {
+			return nil, err
+		}
+		// 编译时不限制内存和网络 (GOPROXY=off, 只能使用标准库), 只限制运行编译出的程序
+		out, err := buildGo(ctx, dir)
+		if err != nil {
+			return mcp.NewToolResultError("compile error:\n" + truncateBytes(out, cfg.maxOutput)), nil
+		}
+		argv = []string{"./main"}
+	default:
+		return mcp.NewToolResultError(fmt.Sprintf("unsupported language %q", language)), nil
+	}
+
+	runCtx, cancel := context.WithTimeout(ctx, cfg.timeout)
+	defer cancel()
+	// 输出超过上限时结束程序, 不会无限占用内存
+	runCtx, kill := context.WithCancelCause(runCtx)
+	defer kill(nil)
+	cmd, err := sandboxCommand(runCtx, cfg, base, readOnly, argv)
+	if err != nil {
+		return nil, err
+	}
+	stdout := &limitedBuffer{limit: cfg.maxOutput, exceeded: func() { kill(errOutputLimit) }}
+	stderr := &limitedBuffer{limit: cfg.maxOutput, exceeded: func() { kill(errOutputLimit) }}
+	cmd.Stdin = strings.NewReader(stdin)
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+	start := time.Now()
+	runErr := cmd.Run()
+
+	var b strings.Builder
+	if stdout.buf.Len() > 0 {
+		fmt.Fprintf(&b, "stdout:\n%s\n", stdout.buf.Bytes())
+	}
+	if stderr.buf.Len() > 0 {
+		fmt.Fprintf(&b, "stderr:\n%s\n", stderr.buf.Bytes())
+	}
+	switch {
+	case context.Cause(runCtx) == errOutputLimit:
+		fmt.Fprintf(&b, "killed: output limit of %d bytes exceeded", cfg.maxOutput)
+		return mcp.NewToolResultError(b.String()), nil
+	case errors.Is(runCtx.Err(), context.DeadlineExceeded):
+		fmt.Fprintf(&b, "killed: time limit of %s exceeded", cfg.timeout)
+		return mcp.NewToolResultError(b.String()), nil
+	case ctx.Err() != nil:
+		return nil, ctx.Err()
+	case runErr != nil:
+		var exitErr *exec.ExitError
+		if !errors.As(runErr, &exitErr) {
+			return nil, runErr
+		}
+		fmt.Fprintf(&b, "exit status %d after %s", exitErr.ExitCode(), time.Since(start).Round(time.Millisecond))
+		return mcp.NewToolResultError(b.String()), nil
+	}
+	fmt.Fprintf(&b, "exit status 0 after %s", time.Since(start).Round(time.Millisecond))
+	return mcp.NewToolResultText(b.String()), nil
+}
+
+// buildGo 编译 dir/main.go, 编译缓存放在系统临时目录中, 多次运行共用
+func buildGo(ctx context.Context, dir string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, sandboxBuildTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "go", "build", "-o", "main", "main.go")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(),
+		"GOPROXY=off", "GOFLAGS=", "GO111MODULE=off", "CGO_ENABLED=0",
+		"GOCACHE="+filepath.Join(os.TempDir(), "mcp-sandbox-gocache"),
+	)
+	out, err := cmd.CombinedOutput()
+	// 编译错误中的路径是临时目录, 对大模型没有意义
+	return bytes.ReplaceAll(out, []byte(dir+string(filepath.Separator)), nil), err
+}
+
+// pythonPath 返回 python3 解释器的实际路径和安装目录: PATH 中的 python3 可能是 pyenv 等工具的 shim,
+// 它依赖宿主的环境变量, 在清空了环境变量的沙箱中不能运行
+func pythonPath(ctx context.Context) (string, []string, error) {
+	python, err := exec.LookPath("python3")
+	if err != nil {
+		return "", nil, errors.New("python3 is not installed on the host")
+	}
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, python, "-c", "import sys; print(sys.executable); print(sys.base_prefix); print(sys.prefix)").Output()
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	if err != nil || len(lines) != 3 {
+		return python, nil, nil
+	}
+	return lines[0], lines[1:], nil
+}
+
+// sandboxEnv 是运行代码时的环境变量, 不继承宿主的环境变量, 避免泄露密钥等配置
+func sandboxEnv(dir string) []string {
+	return []string{"PATH=" + os.Getenv("PATH"), "HOME=" + dir, "TMPDIR=" + dir, "LANG=C.UTF-8"}
+}
+
+var errOutputLimit = errors.New("output limit exceeded")
+
+// limitedBuffer 只保留前 limit 个字节, 超出时调用一次 exceeded
+type limitedBuffer struct {
+	buf      bytes.Buffer
+	limit    int
+	exceeded func()
+	full     bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - b.buf.Len(); len(p) > room {
+		b.buf.Write(p[:room])
+		if !b.full {
+			b.full = true
+			b.exceeded()
+		}
+		return len(p), nil
+	}
+	b.buf.Write(p)
+	return len(p), nil
+}
+
+func truncateBytes(b []byte, n int) string {
+	if len(b) <= n {
+		return string(b)
+	}
+	return string(b[:n]) + fmt.Sprintf("\n... (%d more bytes truncated)", len(b)-n)
+}
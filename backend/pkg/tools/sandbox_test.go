@@ -0,0 +1,149 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func sandboxResult(t *testing.T, cfg sandboxConfig, code string) (string, bool) {
+	t.Helper()
+	res, err := runSandboxed(context.Background(), cfg, "python", code, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res.Content[0].(mcp.TextContent).Text, res.IsError
+}
+
+func TestSandboxIsolation(t *testing.T) {
+	cfg := sandboxConfig{timeout: defaultSandboxTimeout, memoryMB: defaultSandboxMemoryMB, maxOutput: 4096, maxProcs: defaultSandboxMaxProcs, languages: []string{"python"}}
+	if err := checkSandbox(cfg); err != nil {
+		t.Skip(err)
+	}
+	if _, _, err := pythonPath(context.Background()); err != nil {
+		t.Skip(err)
+	}
+	secret := filepath.Join(t.TempDir(), ".env")
+	if err := os.WriteFile(secret, []byte("OPENAI_API_KEY=sk-test"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	out, isErr := sandboxResult(t, cfg, `
+import os
+for p in [`+"'"+secret+"'"+`, '/proc/self/environ', '/etc/passwd']:
+    try:
+        print('READ', p, open(p).read())
+    except OSError:
+        pass
+for p in ['/usr/sandbox-test', '/sandbox-test']:
+    try:
+        open(p, 'w')
+        print('WROTE', p)
+    except OSError:
+        pass
+open('out.txt', 'w').write('ok')
+print(os.getcwd(), open('out.txt').read())
+`)
+	if isErr || strings.Contains(out, "READ") || strings.Contains(out, "WROTE") || !strings.Contains(out, "/work ok") {
+		t.Errorf("sandbox is not isolated:\n%s", out)
+	}
+}
+
+func TestSandboxOutputLimit(t *testing.T) {
+	cfg := sandboxConfig{timeout: defaultSandboxTimeout, memoryMB: defaultSandboxMemoryMB, maxOutput: 1000, maxProcs: defaultSandboxMaxProcs, languages: []string{"python"}}
+	if err := checkSandbox(cfg); err != nil {
+		t.Skip(err)
+	}
+	if _, _, err := pythonPath(context.Background()); err != nil {
+		t.Skip(err)
+	}
+	out, isErr := sandboxResult(t, cfg, "while True:\n    print('x' * 100)")
+	if !isErr || !strings.Contains(out, "output limit of 1000 bytes exceeded") || strings.Count(out, "x") > 1000 {
+		t.Errorf("endless output was not cut off at the limit:\n%s", out)
+	}
+}
+
+// sandboxProcesses 返回宿主上命令行中含有 arg 的进程
+func sandboxProcesses(arg string) []string {
+	var pids []string
+	entries, _ := os.ReadDir("/proc")
+	for _, e := range entries {
+		cmdline, err := os.ReadFile(filepath.Join("/proc", e.Name(), "cmdline"))
+		if err == nil && bytes.Contains(cmdline, []byte("\x00"+arg+"\x00")) {
+			pids = append(pids, e.Name())
+		}
+	}
+	return pids
+}
+
+func TestSandboxProcesses(t *testing.T) {
+	cfg := sandboxConfig{timeout: time.Second, memoryMB: defaultSandboxMemoryMB, maxOutput: 4096, maxProcs: 16, languages: []string{"python"}}
+	if err := checkSandbox(cfg); err != nil {
+		t.Skip(err)
+	}
+	if _, _, err := pythonPath(context.Background()); err != nil {
+		t.Skip(err)
+	}
+
+	// 看不到宿主的进程, 也不能向它们发信号
+	out, _ := sandboxResult(t, cfg, `
+import os
+print('pid', os.getpid())
+try:
+    os.kill(`+strconv.Itoa(os.Getpid())+`, 0)
+    print('SIGNALED')
+except OSError:
+    pass
+`)
+	if strings.Contains(out, "SIGNALED") || !strings.Contains(out, "pid 1\n") {
+		t.Errorf("sandbox shares the host PID namespace:\n%s", out)
+	}
+
+	// 进程数达到上限后不能再创建, 超时后调用了 setsid 的子进程也被结束
+	out, isErr := sandboxResult(t, cfg, `
+import subprocess, time
+started = 0
+try:
+    for _ in range(100):
+        subprocess.Popen(['sleep', '37.123'], start_new_session=True)
+        started += 1
+except OSError:
+    pass
+print('started', started, flush=True)
+time.sleep(30)
+`)
+	if !isErr || !strings.Contains(out, "time limit") {
+		t.Errorf("timeout not enforced:\n%s", out)
+	}
+	// 内核不对 root 用户检查进程数上限
+	if os.Geteuid() != 0 && strings.Contains(out, "started 100") {
+		t.Errorf("process limit not enforced:\n%s", out)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for len(sandboxProcesses("37.123")) > 0 && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+	}
+	if pids := sandboxProcesses("37.123"); len(pids) > 0 {
+		t.Errorf("sandboxed processes survived the timeout: %v", pids)
+	}
+}
+
+func TestLimitedBuffer(t *testing.T) {
+	var calls int
+	b := &limitedBuffer{limit: 5, exceeded: func() { calls++ }}
+	for _, s := range []string{"abc", "defg", "hij"} {
+		if n, err := b.Write([]byte(s)); n != len(s) || err != nil {
+			t.Fatalf("Write(%q) = %d, %v", s, n, err)
+		}
+	}
+	if got := b.buf.String(); got != "abcde" || calls != 1 {
+		t.Errorf("got %q after %d calls, want %q after 1", got, calls, "abcde")
+	}
+}
@@ -0,0 +1,156 @@
+//go:build !windows
+
+package tools
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// sandboxSystemPaths 是程序运行需要的系统目录和文件, 只读挂载到沙箱中; 不存在的跳过
+var sandboxSystemPaths = []string{"/usr", "/bin", "/sbin", "/lib", "/lib32", "/lib64", "/libx32", "/etc/ld.so.cache", "/etc/localtime"}
+
+// sandboxNetworkPaths 是允许网络时额外挂载的解析和证书配置
+var sandboxNetworkPaths = []string{"/etc/resolv.conf", "/etc/hosts", "/etc/nsswitch.conf", "/etc/ssl", "/etc/pki", "/etc/ca-certificates"}
+
+var sandboxDevices = []string{"/dev/null", "/dev/zero", "/dev/random", "/dev/urandom"}
+
+// sandboxCommand 在新的用户、mount 和 PID 命名空间中运行 argv: 根目录换成一个只读的 tmpfs, 其中只有只读的系统目录、
+// readOnly 中的路径 (比如 Python 的安装目录) 和可写的工作目录 /work (即 base/work), 宿主的其他文件
+// (.env、配置、历史记录、附件等) 和 /proc 都不可见; 不允许网络时同时放到没有网卡的网络命名空间中。
+// 准备好后去掉所有 capability 再执行, 程序不能重新挂载或 chroot。无法建立隔离 (不是 Linux、缺少 unshare 等工具、
+// 内核禁止非特权的用户命名空间) 时运行失败, 不会退回到没有隔离的方式。
+// 程序看不到宿主的进程, 不能向服务端发信号; 进程数 (包括线程) 有上限。超时后结束 unshare 所在的进程组,
+// 命名空间的 init 退出时内核结束其中所有进程, 子进程即使调用了 setsid 也不会遗留
+func sandboxCommand(ctx context.Context, cfg sandboxConfig, base string, readOnly []string, argv []string) (*exec.Cmd, error) {
+	for _, tool := range []string{"unshare", "pivot_root", "setpriv", "prlimit"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			return nil, fmt.Errorf("the sandbox needs %s (util-linux, Linux only) to isolate the file system", tool)
+		}
+	}
+	root := filepath.Join(base, "root")
+	if err := os.MkdirAll(root, 0o700); err != nil {
+		return nil, err
+	}
+	paths := append(append([]string{}, sandboxSystemPaths...), readOnly...)
+	if cfg.allowNetwork {
+		paths = append(paths, sandboxNetworkPaths...)
+	}
+	binds, links := sandboxMounts(paths)
+
+	q := shellQuote
+	var s strings.Builder
+	s.WriteString("set -e\n")
+	fmt.Fprintf(&s, "mount -t tmpfs -o mode=755 sandbox %s\n", q(root))
+	for _, p := range binds {
+		if fi, err := os.Stat(p); err == nil && fi.IsDir() {
+			fmt.Fprintf(&s, "mkdir -p %s\n", q(root+p))
+		} else {
+			fmt.Fprintf(&s, "mkdir -p %s && touch %s\n", q(root+filepath.Dir(p)), q(root+p))
+		}
+		fmt.Fprintf(&s, "mount --bind %s %s && mount -o remount,bind,ro %s\n", q(p), q(root+p), q(root+p))
+	}
+	for _, l := range links {
+		fmt.Fprintf(&s, "mkdir -p %s && ln -s %s %s\n", q(root+filepath.Dir(l[1])), q(l[0]), q(root+l[1]))
+	}
+	fmt.Fprintf(&s, "mkdir -p %s\n", q(root+"/dev"))
+	for _, d := range sandboxDevices {
+		if _, err := os.Stat(d); err == nil {
+			fmt.Fprintf(&s, "touch %s && mount --bind %s %s\n", q(root+d), q(d), q(root+d))
+		}
+	}
+	fmt.Fprintf(&s, "mkdir %s && mount --bind %s %s\n", q(root+"/work"), q(filepath.Join(base, "work")), q(root+"/work"))
+	// 切换根目录后卸载原来的根目录, umount 需要读取 /proc/self/mountinfo, 临时挂载 /proc 之后再卸载
+	fmt.Fprintf(&s, "mkdir %s %s && mount --rbind /proc %s\n", q(root+"/.old"), q(root+"/proc"), q(root+"/proc"))
+	fmt.Fprintf(&s, "cd %s && pivot_root . .old\n", q(root))
+	s.WriteString("umount -l /.old && umount -l /proc && rmdir /.old /proc && mount -o remount,ro /\n")
+	// 限制数据段 (ulimit -d) 而不是虚拟内存: Go 程序启动时会预留远大于实际使用的地址空间, ulimit -v 下无法启动
+	fmt.Fprintf(&s, "ulimit -d %d\n", cfg.memoryMB*1024)
+	// 进程数用 prlimit 限制, dash 的 ulimit 没有 -u
+	fmt.Fprintf(&s, `cd /work && exec prlimit --nproc=%d -- setpriv --inh-caps=-all --bounding-set=-all --no-new-privs -- "$@"`, cfg.maxProcs)
+
+	flags := "-rmp"
+	if !cfg.allowNetwork {
+		flags += "n"
+	}
+	// --fork: 脚本作为新 PID 命名空间的 init 运行; --kill-child: unshare 被结束时 init 也随之结束
+	cmd := exec.CommandContext(ctx, "unshare", append([]string{flags, "--fork", "--kill-child", "/bin/sh", "-c", s.String(), "sh"}, argv...)...)
+	cmd.Dir = filepath.Join(base, "work")
+	cmd.Env = sandboxEnv("/work")
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	// 子进程继承了输出管道时不等它们关闭
+	cmd.WaitDelay = time.Second
+	return cmd, nil
+}
+
+// sandboxMounts 把要挂载的路径分成绑定挂载和符号链接: 符号链接 (比如 /bin -> usr/bin) 在沙箱中原样重建,
+// 同时挂载它指向的路径; 已经在其他挂载目录下的路径不再单独挂载
+func sandboxMounts(paths []string) (binds []string, links [][2]string) {
+	covered := func(p string) bool {
+		for _, b := range binds {
+			if p == b || strings.HasPrefix(p, b+"/") {
+				return true
+			}
+		}
+		return false
+	}
+	seen := map[string]bool{}
+	for i := 0; i < len(paths); i++ {
+		p := filepath.Clean(paths[i])
+		if seen[p] || covered(p) {
+			continue
+		}
+		seen[p] = true
+		fi, err := os.Lstat(p)
+		if err != nil {
+			continue
+		}
+		if fi.Mode()&os.ModeSymlink != 0 {
+			target, err := os.Readlink(p)
+			resolved, rerr := filepath.EvalSymlinks(p)
+			if err != nil || rerr != nil {
+				continue
+			}
+			links = append(links, [2]string{target, p})
+			paths = append(paths, resolved)
+			continue
+		}
+		binds = append(binds, p)
+	}
+	return binds, links
+}
+
+// checkSandbox 运行一个空程序, 确认当前环境可以建立隔离
+func checkSandbox(cfg sandboxConfig) error {
+	base, err := os.MkdirTemp("", "mcp-sandbox-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(base)
+	if err := os.Mkdir(filepath.Join(base, "work"), 0o700); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	cmd, err := sandboxCommand(ctx, cfg, base, nil, []string{"/bin/sh", "-c", ":"})
+	if err != nil {
+		return err
+	}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("cannot isolate the sandbox file system (unprivileged user namespaces may be disabled): %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,18 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+)
+
+var errSandboxUnsupported = errors.New("the code sandbox is not supported on Windows")
+
+// sandboxCommand Windows 上没有对应的文件系统、内存和网络隔离, 不支持运行代码
+func sandboxCommand(ctx context.Context, cfg sandboxConfig, base string, readOnly []string, argv []string) (*exec.Cmd, error) {
+	return nil, errSandboxUnsupported
+}
+
+func checkSandbox(cfg sandboxConfig) error {
+	return errSandboxUnsupported
+}
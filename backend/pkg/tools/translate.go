@@ -0,0 +1,410 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+const (
+	defaultTranslateTimeout  = 30 * time.Second
+	defaultTranslateMaxChars = 10000
+)
+
+// 各翻译服务的地址, 是变量以便指向兼容的代理; DeepL 的免费 key (以 :fx 结尾) 使用 deeplFreeURL
+var (
+	deeplURL           = "https://api.deepl.com/v2/translate"
+	deeplFreeURL       = "https://api-free.deepl.com/v2/translate"
+	googleTranslateURL = "https://translation.googleapis.com/language/translate/v2"
+	azureTranslatorURL = "https://api.cognitive.microsofttranslator.com"
+)
+
+// translateConfig 从环境变量读取:
+//   - TRANSLATE_PROVIDER: deepl | google | azure; 缺省按设置了哪个 API key 选择
+//   - DEEPL_API_KEY: DeepL 的 API key
+//   - GOOGLE_TRANSLATE_API_KEY: Google Cloud Translation (v2) 的 API key
+//   - AZURE_TRANSLATOR_KEY / AZURE_TRANSLATOR_REGION: Azure Translator 的 key 和区域 (多服务或区域资源需要区域)
+//   - AZURE_TRANSLATOR_ENDPOINT: Azure Translator 的地址, 缺省为全局地址, 使用自定义域名时设置
+//   - TRANSLATE_MAX_CHARS: 每次最多翻译的字符数, 缺省 10000
+//   - TRANSLATE_TIMEOUT: 每次请求的超时, 缺省 30s
+type translateConfig struct {
+	provider    string
+	deeplKey    string
+	googleKey   string
+	azureKey    string
+	azureRegion string
+	azureURL    string
+	maxChars    int
+	timeout     time.Duration
+}
+
+func translateConfigFromEnv() (translateConfig, error) {
+	cfg := translateConfig{
+		provider:    os.Getenv("TRANSLATE_PROVIDER"),
+		deeplKey:    os.Getenv("DEEPL_API_KEY"),
+		googleKey:   os.Getenv("GOOGLE_TRANSLATE_API_KEY"),
+		azureKey:    os.Getenv("AZURE_TRANSLATOR_KEY"),
+		azureRegion: os.Getenv("AZURE_TRANSLATOR_REGION"),
+		azureURL:    strings.TrimRight(os.Getenv("AZURE_TRANSLATOR_ENDPOINT"), "/"),
+		maxChars:    defaultTranslateMaxChars,
+		timeout:     defaultTranslateTimeout,
+	}
+	if cfg.provider == "" {
+		switch {
+		case cfg.deeplKey != "":
+			cfg.provider = "deepl"
+		case cfg.googleKey != "":
+			cfg.provider = "google"
+		case cfg.azureKey != "":
+			cfg.provider = "azure"
+		default:
+			return cfg, errors.New("no translation provider: set DEEPL_API_KEY, GOOGLE_TRANSLATE_API_KEY or AZURE_TRANSLATOR_KEY")
+		}
+	}
+	if cfg.azureURL == "" {
+		cfg.azureURL = azureTranslatorURL
+	}
+	if v := os.Getenv("TRANSLATE_MAX_CHARS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return cfg, fmt.Errorf("TRANSLATE_MAX_CHARS: invalid number %q", v)
+		}
+		cfg.maxChars = n
+	}
+	if v := os.Getenv("TRANSLATE_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return cfg, fmt.Errorf("TRANSLATE_TIMEOUT: invalid duration %q", v)
+		}
+		cfg.timeout = d
+	}
+	return cfg, nil
+}
+
+// translator 是一个翻译服务, source 为空时由服务检测源语言; 语言代码已按服务的要求转换
+type translator interface {
+	translate(ctx context.Context, text, source, target string) (translation, error)
+	// lang 把 BCP 47 语言代码 (比如 zh-CN、en) 转换为服务使用的代码, source 表示用作源语言
+	lang(code string, source bool) string
+}
+
+type translation struct {
+	text     string
+	detected string // 检测到的源语言, 服务没有返回时为空
+}
+
+// translators 是可选的翻译服务, key 是 TRANSLATE_PROVIDER 的值
+var translators = map[string]func(cfg translateConfig, c *http.Client) (translator, error){
+	"deepl": func(cfg translateConfig, c *http.Client) (translator, error) {
+		if cfg.deeplKey == "" {
+			return nil, errors.New("DEEPL_API_KEY is not set")
+		}
+		u := deeplURL
+		if strings.HasSuffix(cfg.deeplKey, ":fx") {
+			u = deeplFreeURL
+		}
+		return deepl{c, u, cfg.deeplKey}, nil
+	},
+	"google": func(cfg translateConfig, c *http.Client) (translator, error) {
+		if cfg.googleKey == "" {
+			return nil, errors.New("GOOGLE_TRANSLATE_API_KEY is not set")
+		}
+		return googleTranslate{c, cfg.googleKey}, nil
+	},
+	"azure": func(cfg translateConfig, c *http.Client) (translator, error) {
+		if cfg.azureKey == "" {
+			return nil, errors.New("AZURE_TRANSLATOR_KEY is not set")
+		}
+		return azureTranslator{c, cfg.azureURL, cfg.azureKey, cfg.azureRegion}, nil
+	},
+}
+
+// NewTranslateServer 提供 translate 工具, 把翻译交给专门的翻译服务 (DeepL、Google 或 Azure),
+// 长文本和术语的翻译比聊天模型更稳定, 也不占用模型的 token; 配置见 translateConfig
+func NewTranslateServer() *server.MCPServer {
+	s := server.NewMCPServer(
+		"translate-server",
+		"1.0.0",
+		server.WithToolCapabilities(true),
+		server.WithRecovery(),
+	)
+	cfg, cfgErr := translateConfigFromEnv()
+	var tr translator
+	if cfgErr == nil {
+		newTranslator, ok := translators[cfg.provider]
+		if !ok {
+			cfgErr = fmt.Errorf("TRANSLATE_PROVIDER: unknown provider %q (deepl, google, azure)", cfg.provider)
+		} else {
+			tr, cfgErr = newTranslator(cfg, &http.Client{Timeout: cfg.timeout})
+		}
+	}
+
+	s.AddTool(mcp.NewTool("translate",
+		mcp.WithDescription(fmt.Sprintf("Translate text with a dedicated translation engine (%s). "+
+			"Prefer this over translating yourself for documents and longer texts. At most %d characters per call.", cfg.provider, cfg.maxChars)),
+		mcp.WithString("text", mcp.Required(), mcp.Description("Text to translate")),
+		mcp.WithString("target_lang", mcp.Required(), mcp.Description("Target language code, e.g. en, zh-CN, zh-TW, ja, de")),
+		mcp.WithString("source_lang", mcp.Description("Source language code; detected automatically when omitted")),
+		mcp.WithReadOnlyHintAnnotation(true),
+	), func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		if cfgErr != nil {
+			return nil, cfgErr
+		}
+		text, err := req.RequireString("text")
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		target, err := req.RequireString("target_lang")
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		if n := utf8.RuneCountInString(text); n > cfg.maxChars {
+			return mcp.NewToolResultError(fmt.Sprintf("text has %d characters, the limit is %d; split it and translate the parts", n, cfg.maxChars)), nil
+		}
+		if strings.TrimSpace(text) == "" {
+			return mcp.NewToolResultText(text), nil
+		}
+		source := req.GetString("source_lang", "")
+		if source != "" {
+			source = tr.lang(source, true)
+		}
+		t, err := tr.translate(ctx, text, source, tr.lang(target, false))
+		var terr *translateError
+		if errors.As(err, &terr) {
+			return mcp.NewToolResultError(terr.msg), nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if t.detected != "" && source == "" {
+			return mcp.NewToolResultText(fmt.Sprintf("(detected source language: %s)\n%s", t.detected, t.text)), nil
+		}
+		return mcp.NewToolResultText(t.text), nil
+	})
+	return s
+}
+
+// translateError 是服务拒绝的请求 (比如不支持的语言、超过配额), 作为工具结果返回给大模型
+type translateError struct{ msg string }
+
+func (e *translateError) Error() string { return e.msg }
+
+// postTranslateJSON 发送 JSON 请求并解析响应; 认证失败是配置的问题, 返回普通错误, 其他 4xx 交给大模型
+func postTranslateJSON(ctx context.Context, c *http.Client, provider, u string, header http.Header, in, out any) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.Do(req)
+	if err != nil {
+		// 错误信息中的 URL 可能带有 API key
+		var uerr *url.Error
+		if errors.As(err, &uerr) {
+			err = uerr.Err
+		}
+		return fmt.Errorf("%s: %v", provider, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 4<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		// DeepL 为 {"message": ...}, Google 和 Azure 为 {"error": {"message": ...}}
+		var e struct {
+			Message string `json:"message"`
+			Error   struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		json.Unmarshal(data, &e)
+		msg := firstNonEmpty(e.Message, e.Error.Message, resp.Status)
+		switch {
+		case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+			return fmt.Errorf("%s: %s", provider, msg)
+		case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == 456: // 456 是 DeepL 的配额用完
+			return &translateError{fmt.Sprintf("%s: rate limit or quota exceeded, try again later: %s", provider, msg)}
+		case resp.StatusCode < 500:
+			return &translateError{fmt.Sprintf("%s: %s", provider, msg)}
+		}
+		return fmt.Errorf("%s: %s", provider, msg)
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("%s: %v", provider, err)
+	}
+	return nil
+}
+
+// splitLang 把语言代码拆成小写的语言和大写的地区/文字, 比如 zh-hans -> zh, HANS
+func splitLang(code string) (string, string) {
+	lang, region, _ := strings.Cut(strings.ReplaceAll(strings.TrimSpace(code), "_", "-"), "-")
+	return strings.ToLower(lang), strings.ToUpper(region)
+}
+
+// chineseScript 返回中文使用简体 (Hans) 还是繁体 (Hant)
+func chineseScript(region string) string {
+	switch region {
+	case "TW", "HK", "MO", "HANT":
+		return "Hant"
+	}
+	return "Hans"
+}
+
+type deepl struct {
+	http *http.Client
+	url  string
+	key  string
+}
+
+// lang: DeepL 的目标语言区分 EN-US/EN-GB、PT-PT/PT-BR 和 ZH-HANS/ZH-HANT, 源语言只用语言部分
+func (p deepl) lang(code string, source bool) string {
+	lang, region := splitLang(code)
+	l := strings.ToUpper(lang)
+	if source {
+		return l
+	}
+	switch lang {
+	case "en":
+		if region == "GB" {
+			return "EN-GB"
+		}
+		return "EN-US"
+	case "pt":
+		if region == "BR" {
+			return "PT-BR"
+		}
+		return "PT-PT"
+	case "zh":
+		return "ZH-" + strings.ToUpper(chineseScript(region))
+	}
+	return l
+}
+
+func (p deepl) translate(ctx context.Context, text, source, target string) (translation, error) {
+	in := map[string]any{"text": []string{text}, "target_lang": target}
+	if source != "" {
+		in["source_lang"] = source
+	}
+	var out struct {
+		Translations []struct {
+			DetectedSourceLanguage string `json:"detected_source_language"`
+			Text                   string `json:"text"`
+		} `json:"translations"`
+	}
+	header := http.Header{"Authorization": {"DeepL-Auth-Key " + p.key}}
+	if err := postTranslateJSON(ctx, p.http, "deepl", p.url, header, in, &out); err != nil {
+		return translation{}, err
+	}
+	if len(out.Translations) == 0 {
+		return translation{}, errors.New("deepl: empty response")
+	}
+	return translation{out.Translations[0].Text, out.Translations[0].DetectedSourceLanguage}, nil
+}
+
+type googleTranslate struct {
+	http *http.Client
+	key  string
+}
+
+// lang: Google 对中文使用 zh-CN 和 zh-TW, 其他语言使用小写的语言代码
+func (p googleTranslate) lang(code string, _ bool) string {
+	lang, region := splitLang(code)
+	if lang == "zh" {
+		if chineseScript(region) == "Hant" {
+			return "zh-TW"
+		}
+		return "zh-CN"
+	}
+	return lang
+}
+
+func (p googleTranslate) translate(ctx context.Context, text, source, target string) (translation, error) {
+	in := map[string]any{"q": []string{text}, "target": target, "format": "text"}
+	if source != "" {
+		in["source"] = source
+	}
+	var out struct {
+		Data struct {
+			Translations []struct {
+				TranslatedText         string `json:"translatedText"`
+				DetectedSourceLanguage string `json:"detectedSourceLanguage"`
+			} `json:"translations"`
+		} `json:"data"`
+	}
+	u := googleTranslateURL + "?" + url.Values{"key": {p.key}}.Encode()
+	if err := postTranslateJSON(ctx, p.http, "google", u, nil, in, &out); err != nil {
+		return translation{}, err
+	}
+	if len(out.Data.Translations) == 0 {
+		return translation{}, errors.New("google: empty response")
+	}
+	t := out.Data.Translations[0]
+	return translation{t.TranslatedText, t.DetectedSourceLanguage}, nil
+}
+
+type azureTranslator struct {
+	http   *http.Client
+	url    string
+	key    string
+	region string
+}
+
+// lang: Azure 对中文使用 zh-Hans 和 zh-Hant, 其他语言保留地区 (比如 pt-pt、fr-ca)
+func (p azureTranslator) lang(code string, _ bool) string {
+	lang, region := splitLang(code)
+	switch {
+	case lang == "zh":
+		return "zh-" + chineseScript(region)
+	case region != "":
+		return lang + "-" + strings.ToLower(region)
+	}
+	return lang
+}
+
+func (p azureTranslator) translate(ctx context.Context, text, source, target string) (translation, error) {
+	q := url.Values{"api-version": {"3.0"}, "to": {target}}
+	if source != "" {
+		q.Set("from", source)
+	}
+	header := http.Header{"Ocp-Apim-Subscription-Key": {p.key}}
+	if p.region != "" {
+		header.Set("Ocp-Apim-Subscription-Region", p.region)
+	}
+	var out []struct {
+		DetectedLanguage struct {
+			Language string `json:"language"`
+		} `json:"detectedLanguage"`
+		Translations []struct {
+			Text string `json:"text"`
+		} `json:"translations"`
+	}
+	in := []map[string]string{{"Text": text}}
+	if err := postTranslateJSON(ctx, p.http, "azure", p.url+"/translate?"+q.Encode(), header, in, &out); err != nil {
+		return translation{}, err
+	}
+	if len(out) == 0 || len(out[0].Translations) == 0 {
+		return translation{}, errors.New("azure: empty response")
+	}
+	return translation{out[0].Translations[0].Text, out[0].DetectedLanguage.Language}, nil
+}
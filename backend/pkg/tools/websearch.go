@@ -0,0 +1,111 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// webSearchURL 是 DuckDuckGo 的 Instant Answer 接口, 不需要 API key
+const webSearchURL = "https://api.duckduckgo.com/"
+
+// NewWebSearchServer 提供 web_search 工具, 通过 DuckDuckGo 的 Instant Answer 接口查询摘要和相关链接
+func NewWebSearchServer() *server.MCPServer {
+	s := server.NewMCPServer(
+		"web-search-server",
+		"1.0.0",
+		server.WithToolCapabilities(true),
+		server.WithRecovery(),
+	)
+
+	searchTool := mcp.NewTool("web_search",
+		mcp.WithDescription("在网上搜索关键词, 返回摘要和相关链接"),
+		mcp.WithString("query",
+			mcp.Required(),
+			mcp.Description("搜索关键词"),
+		),
+		mcp.WithNumber("max_results",
+			mcp.Description("最多返回的相关链接数, 缺省 5"),
+		),
+	)
+	s.AddTool(searchTool, webSearchHandler)
+	return s
+}
+
+// instantAnswer 是 Instant Answer 接口返回的字段中用到的部分
+type instantAnswer struct {
+	Heading       string
+	AbstractText  string
+	AbstractURL   string
+	Answer        string
+	RelatedTopics []relatedTopic
+}
+
+// relatedTopic 分组时 Topics 不为空
+type relatedTopic struct {
+	Text     string
+	FirstURL string
+	Topics   []relatedTopic
+}
+
+func webSearchHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	query, err := request.RequireString("query")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	maxResults := request.GetInt("max_results", 5)
+
+	q := url.Values{"q": {query}, "format": {"json"}, "no_html": {"1"}, "skip_disambig": {"1"}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, webSearchURL+"?"+q.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("搜索失败: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("搜索失败: %s", resp.Status)
+	}
+	var answer instantAnswer
+	if err := json.NewDecoder(resp.Body).Decode(&answer); err != nil {
+		return nil, fmt.Errorf("解析搜索结果失败: %v", err)
+	}
+
+	var b strings.Builder
+	if answer.Answer != "" {
+		fmt.Fprintf(&b, "%s\n\n", answer.Answer)
+	}
+	if answer.AbstractText != "" {
+		fmt.Fprintf(&b, "%s\n%s\n%s\n\n", answer.Heading, answer.AbstractText, answer.AbstractURL)
+	}
+	n := 0
+	var walk func(topics []relatedTopic)
+	walk = func(topics []relatedTopic) {
+		for _, t := range topics {
+			if n >= maxResults {
+				return
+			}
+			if len(t.Topics) > 0 {
+				walk(t.Topics)
+				continue
+			}
+			if t.Text != "" {
+				fmt.Fprintf(&b, "- %s\n  %s\n", t.Text, t.FirstURL)
+				n++
+			}
+		}
+	}
+	walk(answer.RelatedTopics)
+	if b.Len() == 0 {
+		return mcp.NewToolResultText(fmt.Sprintf("没有找到 %q 的结果", query)), nil
+	}
+	return mcp.NewToolResultText(strings.TrimSpace(b.String())), nil
+}
@@ -1,93 +1,15 @@
 package main
 
 import (
-	"context"
 	"fmt"
 
-	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/guobinqiu/mcp-host-web/pkg/tools"
 	"github.com/mark3labs/mcp-go/server"
 )
 
 func main() {
-	// Create a new MCP server
-	s := server.NewMCPServer(
-		"calculator-server",
-		"1.0.0",
-		server.WithResourceCapabilities(true, true),
-		server.WithPromptCapabilities(true),
-		server.WithToolCapabilities(true),
-		server.WithRecovery(),
-	)
-
-	// Add a calculator tool
-	calculatorTool := mcp.NewTool("calculate",
-		mcp.WithDescription("Perform basic arithmetic operations"),
-		mcp.WithString("operation",
-			mcp.Required(),
-			mcp.Description("The operation to perform (add, subtract, multiply, divide)"),
-			mcp.Enum("add", "subtract", "multiply", "divide"),
-		),
-		mcp.WithNumber("x",
-			mcp.Required(),
-			mcp.Description("First number"),
-		),
-		mcp.WithNumber("y",
-			mcp.Required(),
-			mcp.Description("Second number"),
-		),
-	)
-
-	// Add the calculator handler
-	s.AddTool(calculatorTool, calculatorHandler)
-
 	// Start the server
-	if err := server.ServeStdio(s); err != nil {
+	if err := server.ServeStdio(tools.NewCalculatorServer()); err != nil {
 		fmt.Printf("Server error: %v\n", err)
 	}
 }
-
-func calculatorHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-	// op, ok := request.GetArguments()["operation"].(string)
-	// if !ok {
-	// 	return nil, errors.New("operation must be a string")
-	// }
-	op, err := request.RequireString("operation")
-	if err != nil {
-		return mcp.NewToolResultError(err.Error()), nil
-	}
-
-	// x, ok := request.GetArguments()["x"].(float64)
-	// if !ok {
-	// 	return nil, errors.New("x must be a float")
-	// }
-	x, err := request.RequireFloat("x")
-	if err != nil {
-		return mcp.NewToolResultError(err.Error()), nil
-	}
-
-	// y, ok := request.GetArguments()["y"].(float64)
-	// if !ok {
-	// 	return nil, errors.New("y must be a float")
-	// }
-	y, err := request.RequireFloat("y")
-	if err != nil {
-		return mcp.NewToolResultError(err.Error()), nil
-	}
-
-	var result float64
-	switch op {
-	case "add":
-		result = x + y
-	case "subtract":
-		result = x - y
-	case "multiply":
-		result = x * y
-	case "divide":
-		if y == 0 {
-			return mcp.NewToolResultError("cannot divide by zero"), nil
-		}
-		result = x / y
-	}
-
-	return mcp.NewToolResultText(fmt.Sprintf("%.2f", result)), nil
-}
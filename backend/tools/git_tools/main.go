@@ -0,0 +1,15 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/guobinqiu/mcp-host-web/pkg/tools"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+func main() {
+	// 配置通过环境变量传入, 见 tools.NewGitServer
+	if err := server.ServeStdio(tools.NewGitServer()); err != nil {
+		fmt.Printf("Server error: %v\n", err)
+	}
+}